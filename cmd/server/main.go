@@ -7,10 +7,13 @@ import (
 	"strings"
 	"time"
 
+	"booklib/internal/api"
+	"booklib/internal/covers"
 	"booklib/internal/db"
 	"booklib/internal/handlers"
 	"booklib/internal/middleware"
 	"booklib/internal/services"
+	"booklib/internal/store"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -38,27 +41,87 @@ func main() {
 		log.Println("No .env file found, using environment variables or defaults")
 	}
 
-	// Initialize database
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "./database/booklib.db"
+	// Initialize database. DATABASE_URL selects the backend (postgres:// for
+	// PostgreSQL); otherwise SQLite is used at DATABASE_PATH.
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		dbURL = os.Getenv("DATABASE_PATH")
 	}
-	if err := db.Init(dbPath); err != nil {
+	if dbURL == "" {
+		dbURL = "./database/booklib.db"
+	}
+
+	// "booklib migrate up|down|status" manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(dbURL, os.Args[2:]))
+	}
+
+	if err := services.LoadJWTSecret(); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := db.Init(dbURL); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
-	authHandler := &handlers.AuthHandler{DB: db.GetDB()}
-	bookHandler := &handlers.BookHandler{DB: db.GetDB()}
-	adminHandler := &handlers.AdminHandler{DB: db.GetDB()}
-	lendingHandler := &handlers.LendingHandler{DB: db.GetDB()}
-	statsHandler := &handlers.StatsHandler{DB: db.GetDB()}
-	readingHistoryHandler := &handlers.ReadingHistoryHandler{DB: db.GetDB()}
-	userSettingsHandler := &handlers.UserSettingsHandler{DB: db.GetDB()}
+	stores := store.NewSQL(db.GetDB(), db.Dialect)
+
+	authHandler := &handlers.AuthHandler{Users: stores.Users, Settings: stores.Settings}
+	metadata := api.NewProviderChainFromEnv()
+	log.Printf("Metadata providers: %s", metadata.Name())
+
+	// Downloaded covers are fetched again if the directory is lost, but
+	// uploaded ones can't be, so it belongs on persistent storage
+	coversDir := os.Getenv("COVERS_DIR")
+	if coversDir == "" {
+		coversDir = "./database/covers"
+	}
+	coverStore, err := covers.NewDiskStore(coversDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize cover storage: %v", err)
+	}
+	coverService := covers.NewService(coverStore)
+
+	metadataService := services.NewMetadataService(stores.Cache, metadata)
+	log.Printf("ISBN cache TTL: %s", metadataService.TTL)
+
+	enrichmentService := services.NewEnrichmentService(stores.Books, stores.Enrichment, metadataService)
+
+	bookHandler := &handlers.BookHandler{Books: stores.Books, Metadata: metadataService, Covers: coverService}
+	importHandler := &handlers.ImportHandler{
+		Books:      stores.Books,
+		Metadata:   metadataService,
+		Enrichment: enrichmentService,
+		Covers:     coverService,
+	}
+	authorHandler := &handlers.AuthorHandler{Authors: stores.Authors}
+	tagHandler := &handlers.TagHandler{Tags: stores.Tags}
+	shelfHandler := &handlers.ShelfHandler{Books: stores.Books, Shelves: stores.Shelves}
+	smartShelfHandler := &handlers.SmartShelfHandler{Shelves: stores.Smart}
+	isbnCacheHandler := &handlers.ISBNCacheHandler{Cache: stores.Cache, Metadata: metadataService}
+	enrichmentHandler := &handlers.EnrichmentHandler{
+		Enrichment: enrichmentService,
+		Proposals:  stores.Enrichment,
+		Covers:     coverService,
+	}
+	adminHandler := &handlers.AdminHandler{
+		Books:    stores.Books,
+		Users:    stores.Users,
+		Settings: stores.Settings,
+		Stats:    stores.Stats,
+		Covers:   coverService,
+	}
+	lendingHandler := &handlers.LendingHandler{Books: stores.Books, Lending: stores.Lending}
+	statsHandler := &handlers.StatsHandler{Stats: stores.Stats}
+	readingHistoryHandler := &handlers.ReadingHistoryHandler{Books: stores.Books, Reading: stores.Reading}
+	noteHandler := &handlers.NoteHandler{Books: stores.Books, Notes: stores.Notes}
+	userSettingsHandler := &handlers.UserSettingsHandler{Settings: stores.Settings}
+	exportHandler := &handlers.ExportHandler{Books: stores.Books, Exports: stores.Export, Covers: coverService}
 
 	// Initialize email and reminder services
 	emailService := services.NewEmailService()
-	reminderService := services.NewReminderService(db.GetDB(), emailService)
+	reminderService := services.NewReminderService(stores.Lending, emailService)
 
 	// Setup cron scheduler for daily reminders
 	c := cron.New()
@@ -69,7 +132,7 @@ func main() {
 		cronSchedule = "0 9 * * *" // Default: 9 AM daily
 	}
 
-	_, err := c.AddFunc(cronSchedule, func() {
+	_, err = c.AddFunc(cronSchedule, func() {
 		log.Println("Running scheduled reminder check...")
 		reminderService.CheckAndSendReminders()
 	})
@@ -77,7 +140,6 @@ func main() {
 	if err != nil {
 		log.Printf("Warning: Failed to schedule reminder cron job: %v", err)
 	} else {
-		c.Start()
 		log.Printf("Reminder cron job scheduled: %s", cronSchedule)
 
 		// Run immediately on startup if enabled
@@ -87,6 +149,18 @@ func main() {
 		}
 	}
 
+	// Refresh expired ISBN cache entries daily at 3 AM
+	refreshSchedule := os.Getenv("ISBN_CACHE_REFRESH_SCHEDULE")
+	if refreshSchedule == "" {
+		refreshSchedule = "0 3 * * *"
+	}
+	if _, err := c.AddFunc(refreshSchedule, metadataService.RunRefresh); err != nil {
+		log.Printf("Warning: Failed to schedule ISBN cache refresh job: %v", err)
+	} else {
+		log.Printf("ISBN cache refresh job scheduled: %s", refreshSchedule)
+	}
+
+	c.Start()
 	defer c.Stop()
 
 	r := chi.NewRouter()
@@ -108,7 +182,7 @@ func main() {
 		AllowedOrigins:   allowedOrigins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		ExposedHeaders:   []string{"Link", "X-Total-Count"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -139,11 +213,92 @@ func main() {
 
 		r.Get("/", bookHandler.List)
 		r.Post("/", bookHandler.Create)
+		r.Post("/import", importHandler.ImportCSV)
+		r.Post("/import/goodreads", importHandler.ImportGoodreads)
+		r.Post("/import/storygraph", importHandler.ImportStoryGraph)
 		r.Get("/search", bookHandler.Search)
 		r.Get("/search/{isbn}", bookHandler.SearchByISBN)
 		r.Get("/{id}", bookHandler.Get)
 		r.Put("/{id}", bookHandler.Update)
 		r.Delete("/{id}", bookHandler.Delete)
+		r.Get("/{id}/cover", bookHandler.Cover)
+		r.Put("/{id}/cover", bookHandler.UploadCover)
+		r.Delete("/{id}/cover", bookHandler.DeleteCover)
+		r.Get("/{id}/notes", noteHandler.List)
+		r.Post("/{id}/notes", noteHandler.Create)
+		r.Get("/{id}/notes/export", noteHandler.Export)
+	})
+
+	// Protected note routes
+	r.Route("/api/notes", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/search", noteHandler.Search)
+		r.Post("/import/kindle", noteHandler.ImportKindle)
+		r.Get("/{id}", noteHandler.Get)
+		r.Put("/{id}", noteHandler.Update)
+		r.Delete("/{id}", noteHandler.Delete)
+	})
+
+	// Protected author routes
+	r.Route("/api/authors", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", authorHandler.List)
+		r.Get("/{id}", authorHandler.Get)
+	})
+
+	// Protected tag routes
+	r.Route("/api/tags", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", tagHandler.List)
+		r.Post("/", tagHandler.Create)
+		r.Put("/{id}", tagHandler.Rename)
+		r.Delete("/{id}", tagHandler.Delete)
+		r.Post("/{id}/books", tagHandler.AddBooks)
+		r.Delete("/{id}/books/{bookID}", tagHandler.RemoveBook)
+	})
+
+	// Protected shelf routes
+	r.Route("/api/shelves", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", shelfHandler.List)
+		r.Post("/", shelfHandler.Create)
+		r.Put("/order", shelfHandler.Reorder)
+		r.Get("/{id}", shelfHandler.Get)
+		r.Put("/{id}", shelfHandler.Update)
+		r.Delete("/{id}", shelfHandler.Delete)
+		r.Post("/{id}/books", shelfHandler.AddBook)
+		r.Put("/{id}/books/order", shelfHandler.ReorderBooks)
+		r.Delete("/{id}/books/{bookID}", shelfHandler.RemoveBook)
+	})
+
+	// Protected smart shelf routes
+	r.Route("/api/smart-shelves", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", smartShelfHandler.List)
+		r.Post("/", smartShelfHandler.Create)
+		r.Post("/preview", smartShelfHandler.Preview)
+		r.Get("/{id}", smartShelfHandler.Get)
+		r.Put("/{id}", smartShelfHandler.Update)
+		r.Delete("/{id}", smartShelfHandler.Delete)
+	})
+
+	// Protected metadata enrichment routes
+	r.Route("/api/enrichment", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", enrichmentHandler.Status)
+		r.Post("/", enrichmentHandler.Start)
+		r.Delete("/", enrichmentHandler.Cancel)
+		r.Get("/proposals", enrichmentHandler.ListProposals)
+		r.Post("/proposals/accept", enrichmentHandler.AcceptAll)
+		r.Post("/proposals/reject", enrichmentHandler.RejectAll)
+		r.Post("/proposals/{id}/accept", enrichmentHandler.Accept)
+		r.Post("/proposals/{id}/reject", enrichmentHandler.Reject)
 	})
 
 	// Protected lending routes
@@ -168,10 +323,28 @@ func main() {
 	r.Route("/api/reading-history", func(r chi.Router) {
 		r.Use(middleware.AuthMiddleware)
 
+		r.Post("/", readingHistoryHandler.LogSession)
 		r.Post("/start", readingHistoryHandler.StartReading)
+		r.Put("/{id}", readingHistoryHandler.EditSession)
+		r.Delete("/{id}", readingHistoryHandler.DeleteSession)
 		r.Put("/{id}/finish", readingHistoryHandler.FinishReading)
+		r.Get("/{id}/progress", readingHistoryHandler.GetProgress)
+		r.Post("/{id}/progress", readingHistoryHandler.AddProgress)
+		r.Get("/{id}/review", readingHistoryHandler.GetReview)
+		r.Put("/{id}/review", readingHistoryHandler.SaveReview)
+		r.Delete("/{id}/review", readingHistoryHandler.DeleteReview)
 		r.Get("/book/{bookId}", readingHistoryHandler.GetBookReadingHistory)
 		r.Get("/book/{bookId}/active", readingHistoryHandler.GetActiveReadingSession)
+		r.Get("/book/{bookId}/status", readingHistoryHandler.GetStatus)
+		r.Put("/book/{bookId}/status", readingHistoryHandler.SetStatus)
+	})
+
+	// Protected export routes
+	r.Route("/api/export", func(r chi.Router) {
+		r.Use(middleware.AuthMiddleware)
+
+		r.Get("/", exportHandler.Export)
+		r.Post("/restore", exportHandler.Restore)
 	})
 
 	// Protected user settings routes
@@ -194,6 +367,14 @@ func main() {
 		r.Put("/users/{id}/role", adminHandler.UpdateUserRole)
 		r.Get("/settings", adminHandler.GetSettings)
 		r.Put("/settings", adminHandler.UpdateSetting)
+
+		r.Get("/isbn-cache", isbnCacheHandler.List)
+		r.Delete("/isbn-cache", isbnCacheHandler.Purge)
+		r.Post("/isbn-cache/refresh", isbnCacheHandler.RefreshExpired)
+		r.Get("/isbn-cache/{isbn}", isbnCacheHandler.Get)
+		r.Put("/isbn-cache/{isbn}", isbnCacheHandler.Update)
+		r.Delete("/isbn-cache/{isbn}", isbnCacheHandler.Delete)
+		r.Post("/isbn-cache/{isbn}/refresh", isbnCacheHandler.Refresh)
 	})
 
 	port := os.Getenv("PORT")
@@ -202,7 +383,7 @@ func main() {
 	}
 
 	log.Printf("Server starting on :%s", port)
-	log.Printf("Database path: %s", dbPath)
+	log.Printf("Database backend: %s", db.Dialect)
 	log.Printf("Allowed CORS origins: %v", allowedOrigins)
 
 	http.ListenAndServe(":"+port, r)
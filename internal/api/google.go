@@ -4,38 +4,59 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
+	"booklib/internal/authors"
 	"booklib/internal/models"
 
 	"google.golang.org/api/books/v1"
 	"google.golang.org/api/option"
 )
 
-// searchGoogleApi searches for book metadata by ISBN using Google Books API.
-// It accepts a context so callers can cancel or set timeouts. Returns a
-// populated IsbnCache pointer on success, (nil, nil) if not found, or an
-// error if the lookup failed.
-func searchGoogleApi(ctx context.Context, isbn int) (*models.IsbnCache, error) {
+// GoogleBooksProvider looks up metadata with the Google Books API.
+type GoogleBooksProvider struct {
+	APIKey string
+	// Endpoint overrides the API root URL (https://www.googleapis.com/);
+	// tests point it at a stand-in.
+	Endpoint string
+}
+
+func NewGoogleBooksProvider(apiKey string) *GoogleBooksProvider {
+	return &GoogleBooksProvider{APIKey: apiKey}
+}
+
+func (p *GoogleBooksProvider) Name() string {
+	return "google"
+}
+
+func (p *GoogleBooksProvider) service(ctx context.Context) (*books.Service, error) {
+	if p.APIKey == "" {
+		return nil, fmt.Errorf("GOOGLE_BOOK_API_KEY not set")
+	}
+
+	opts := []option.ClientOption{option.WithAPIKey(p.APIKey)}
+	if p.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(p.Endpoint))
+	}
+	return books.NewService(ctx, opts...)
+}
+
+// LookupISBN searches for book metadata by ISBN. It returns a populated
+// IsbnCache pointer on success, (nil, nil) if not found, or an error if the
+// lookup failed.
+func (p *GoogleBooksProvider) LookupISBN(ctx context.Context, isbnCode string) (*models.IsbnCache, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	apiKey := os.Getenv("GOOGLE_BOOK_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("GOOGLE_BOOK_API_KEY not set")
-	}
-
-	svc, err := books.NewService(ctx, option.WithAPIKey(apiKey))
+	svc, err := p.service(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	q := fmt.Sprintf("isbn:%d", isbn)
-	resp, err := svc.Volumes.List(q).Context(ctx).Do()
+	resp, err := svc.Volumes.List("isbn:" + isbnCode).Context(ctx).Do()
 	if err != nil {
 		return nil, err
 	}
@@ -43,58 +64,20 @@ func searchGoogleApi(ctx context.Context, isbn int) (*models.IsbnCache, error) {
 		return nil, nil
 	}
 
-	v := resp.Items[0]
-	vi := v.VolumeInfo
-
-	var authors string
-	if len(vi.Authors) > 0 {
-		authors = strings.Join(vi.Authors, ", ")
-	}
-
-	var genre string
-	if len(vi.Categories) > 0 {
-		genre = vi.Categories[0]
-	}
-
-	var cover string
-	if vi.ImageLinks != nil {
-		if vi.ImageLinks.Thumbnail != "" {
-			cover = vi.ImageLinks.Thumbnail
-		} else if vi.ImageLinks.SmallThumbnail != "" {
-			cover = vi.ImageLinks.SmallThumbnail
-		}
-	}
-
-	now := time.Now()
-	return &models.IsbnCache{
-		ISBN:     fmt.Sprintf("%d", isbn),
-		Title:    vi.Title,
-		Author:   authors,
-		Genre:    genre,
-		CoverUrl: cover,
-		CachedAt: &now,
-	}, nil
-}
-
-// SearchGoogleApi is the exported version that can be used by handlers.
-func SearchGoogleApi(ctx context.Context, isbn int) (*models.IsbnCache, error) {
-	return searchGoogleApi(ctx, isbn)
+	result := volumeToCache(resp.Items[0].VolumeInfo, time.Now())
+	result.ISBN = isbnCode
+	return result, nil
 }
 
-// SearchGoogleBooks performs a generic search (title, author, or ISBN) and returns multiple results.
-func SearchGoogleBooks(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+// Search performs a generic search (title, author, or ISBN) and returns multiple results.
+func (p *GoogleBooksProvider) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	apiKey := os.Getenv("GOOGLE_BOOK_API_KEY")
-	if apiKey == "" {
-		return nil, fmt.Errorf("GOOGLE_BOOK_API_KEY not set")
-	}
-
-	svc, err := books.NewService(ctx, option.WithAPIKey(apiKey))
+	svc, err := p.service(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -110,52 +93,69 @@ func SearchGoogleBooks(ctx context.Context, query string) ([]*models.IsbnCache,
 
 	results := make([]*models.IsbnCache, 0, len(resp.Items))
 	now := time.Now()
-
 	for _, v := range resp.Items {
-		vi := v.VolumeInfo
+		results = append(results, volumeToCache(v.VolumeInfo, now))
+	}
+	return results, nil
+}
 
-		var authors string
-		if len(vi.Authors) > 0 {
-			authors = strings.Join(vi.Authors, ", ")
-		}
+// volumeToCache converts a Google Books volume into cache metadata.
+func volumeToCache(vi *books.VolumeVolumeInfo, now time.Time) *models.IsbnCache {
+	if vi == nil {
+		return &models.IsbnCache{CachedAt: &now}
+	}
 
-		var genre string
-		if len(vi.Categories) > 0 {
-			genre = vi.Categories[0]
-		}
+	// Joined so that authors.Split recovers the individual names
+	author := authors.Join(vi.Authors)
 
-		var cover string
-		if vi.ImageLinks != nil {
-			if vi.ImageLinks.Thumbnail != "" {
-				cover = vi.ImageLinks.Thumbnail
-			} else if vi.ImageLinks.SmallThumbnail != "" {
-				cover = vi.ImageLinks.SmallThumbnail
-			}
+	genre, genres := genresOf(vi.Categories)
+
+	var cover string
+	if vi.ImageLinks != nil {
+		if vi.ImageLinks.Thumbnail != "" {
+			cover = vi.ImageLinks.Thumbnail
+		} else if vi.ImageLinks.SmallThumbnail != "" {
+			cover = vi.ImageLinks.SmallThumbnail
 		}
+	}
 
-		// Extract ISBN (prefer ISBN_13, fallback to ISBN_10)
-		var isbn string
-		if len(vi.IndustryIdentifiers) > 0 {
-			for _, id := range vi.IndustryIdentifiers {
-				if id.Type == "ISBN_13" {
-					isbn = id.Identifier
-					break
-				}
-			}
-			if isbn == "" {
-				isbn = vi.IndustryIdentifiers[0].Identifier
+	// Extract ISBN (prefer ISBN_13, fallback to ISBN_10)
+	var identifier string
+	if len(vi.IndustryIdentifiers) > 0 {
+		for _, id := range vi.IndustryIdentifiers {
+			if id.Type == "ISBN_13" {
+				identifier = id.Identifier
+				break
 			}
 		}
+		if identifier == "" {
+			identifier = vi.IndustryIdentifiers[0].Identifier
+		}
+	}
 
-		results = append(results, &models.IsbnCache{
-			ISBN:     isbn,
-			Title:    vi.Title,
-			Author:   authors,
-			Genre:    genre,
-			CoverUrl: cover,
-			CachedAt: &now,
-		})
+	return &models.IsbnCache{
+		ISBN:          canonicalISBN(identifier),
+		Title:         vi.Title,
+		Author:        author,
+		Genre:         genre,
+		Genres:        genres,
+		CoverUrl:      cover,
+		Description:   vi.Description,
+		PageCount:     int(vi.PageCount),
+		Publisher:     vi.Publisher,
+		PublishedDate: normalizePublishedDate(vi.PublishedDate),
+		Language:      normalizeLanguage(vi.Language),
+		CachedAt:      &now,
 	}
+}
 
-	return results, nil
+// SearchGoogleApi looks up an ISBN with the Google Books API using
+// GOOGLE_BOOK_API_KEY. Returns (nil, nil) if not found.
+func SearchGoogleApi(ctx context.Context, isbn int) (*models.IsbnCache, error) {
+	return NewGoogleBooksProvider(os.Getenv("GOOGLE_BOOK_API_KEY")).LookupISBN(ctx, fmt.Sprintf("%d", isbn))
+}
+
+// SearchGoogleBooks performs a generic search (title, author, or ISBN) and returns multiple results.
+func SearchGoogleBooks(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	return NewGoogleBooksProvider(os.Getenv("GOOGLE_BOOK_API_KEY")).Search(ctx, query)
 }
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// googleStandIn answers volume searches with body, recording the query
+// and API key of the last request.
+func googleStandIn(t *testing.T, body string) (*GoogleBooksProvider, *string, *string) {
+	t.Helper()
+	var query, key string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/books/v1/volumes" {
+			t.Errorf("request for %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		query, key = r.URL.Query().Get("q"), r.URL.Query().Get("key")
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return &GoogleBooksProvider{APIKey: "secret", Endpoint: server.URL + "/"}, &query, &key
+}
+
+func TestGoogleBooksLookupISBN(t *testing.T) {
+	p, query, key := googleStandIn(t, `{"items": [{"volumeInfo": {
+		"title": "Dune",
+		"authors": ["Herbert, Frank", "Brian Herbert"],
+		"categories": ["Fiction / Science Fiction", "Fiction / Classics"],
+		"imageLinks": {"smallThumbnail": "https://covers.example/s.jpg", "thumbnail": "https://covers.example/t.jpg"},
+		"industryIdentifiers": [{"type": "ISBN_10", "identifier": "0441013597"}, {"type": "ISBN_13", "identifier": "9780441013593"}],
+		"description": "Set on the desert planet Arrakis",
+		"pageCount": 896,
+		"publisher": "Ace",
+		"publishedDate": "2005-08",
+		"language": "en"
+	}}]}`)
+
+	got, err := p.LookupISBN(context.Background(), "0441013597")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *query != "isbn:0441013597" || *key != "secret" {
+		t.Errorf("searched for %q with key %q", *query, *key)
+	}
+	if got == nil {
+		t.Fatal("got nil metadata")
+	}
+	// The ISBN looked up is kept, not the one Google lists
+	if got.ISBN != "0441013597" || got.Title != "Dune" || got.Author != "Herbert, Frank; Brian Herbert" {
+		t.Errorf("got %q by %q (%s)", got.Title, got.Author, got.ISBN)
+	}
+	if got.Genre != "Fiction / Science Fiction" || len(got.Genres) != 2 || got.CoverUrl != "https://covers.example/t.jpg" {
+		t.Errorf("genre %q, genres %v, cover %q", got.Genre, got.Genres, got.CoverUrl)
+	}
+	if got.Description != "Set on the desert planet Arrakis" || got.PageCount != 896 || got.Publisher != "Ace" ||
+		got.PublishedDate != "2005-08" || got.Language != "en" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestGoogleBooksLookupISBNNotFound(t *testing.T) {
+	p, _, _ := googleStandIn(t, `{"totalItems": 0}`)
+	got, err := p.LookupISBN(context.Background(), "9780000000002")
+	if got != nil || err != nil {
+		t.Errorf("got %+v, %v; want nil, nil", got, err)
+	}
+}
+
+func TestGoogleBooksSearch(t *testing.T) {
+	p, query, _ := googleStandIn(t, `{"items": [
+		{"volumeInfo": {
+			"title": "Dune",
+			"authors": ["Frank Herbert"],
+			"industryIdentifiers": [{"type": "OTHER", "identifier": "UOM:39015"}, {"type": "ISBN_13", "identifier": "978-0-441-01359-3"}],
+			"imageLinks": {"smallThumbnail": "https://covers.example/s.jpg"},
+			"publishedDate": "1965"
+		}},
+		{"volumeInfo": {"title": "Dune Messiah", "industryIdentifiers": [{"type": "ISBN_10", "identifier": "0593098234"}]}},
+		{}
+	]}`)
+
+	results, err := p.Search(context.Background(), "dune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *query != "dune" {
+		t.Errorf("searched for %q", *query)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	if got := results[0]; got.ISBN != "9780441013593" || got.CoverUrl != "https://covers.example/s.jpg" || got.PublishedDate != "1965" {
+		t.Errorf("first result %+v", got)
+	}
+	// Without an ISBN-13 the first identifier is used, as ISBN-13
+	if got := results[1]; got.ISBN != "9780593098233" || got.Title != "Dune Messiah" {
+		t.Errorf("second result %+v", got)
+	}
+	if got := results[2]; got.Title != "" || got.CachedAt == nil {
+		t.Errorf("volume without info: %+v", got)
+	}
+}
+
+func TestGoogleBooksErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": {"code": 403, "message": "quota exceeded"}}`, http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	p := &GoogleBooksProvider{APIKey: "secret", Endpoint: server.URL + "/"}
+
+	if got, err := p.LookupISBN(context.Background(), "9780441013593"); err == nil {
+		t.Errorf("lookup over quota: got %+v, want an error", got)
+	}
+	if got, err := p.Search(context.Background(), "dune"); err == nil {
+		t.Errorf("search over quota: got %+v, want an error", got)
+	}
+	if _, err := (&GoogleBooksProvider{}).Search(context.Background(), "dune"); err == nil {
+		t.Error("search without an API key succeeded")
+	}
+}
@@ -0,0 +1,245 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"booklib/internal/isbn"
+	"booklib/internal/models"
+	"booklib/internal/tags"
+)
+
+// MetadataProvider looks up book metadata from an external source.
+type MetadataProvider interface {
+	// Name identifies the provider in logs and configuration.
+	Name() string
+	// LookupISBN returns metadata for a single ISBN, or (nil, nil) if the
+	// provider does not know the book.
+	LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error)
+	// Search performs a free-text search over titles, authors and ISBNs.
+	Search(ctx context.Context, query string) ([]*models.IsbnCache, error)
+}
+
+// ProviderChain queries several providers in order. ISBN lookups merge the
+// results, so fields missing from the first match are filled in by later
+// providers; searches fall back to the next provider when one fails or
+// finds nothing.
+type ProviderChain struct {
+	Providers []MetadataProvider
+}
+
+func (c *ProviderChain) Name() string {
+	names := make([]string, 0, len(c.Providers))
+	for _, p := range c.Providers {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *ProviderChain) LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	var merged *models.IsbnCache
+	var errs []error
+
+	for _, p := range c.Providers {
+		result, err := p.LookupISBN(ctx, isbn)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Metadata provider %s failed for ISBN %s: %v", p.Name(), isbn, err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		if result == nil {
+			continue
+		}
+
+		if merged == nil {
+			merged = result
+		} else {
+			mergeMetadata(merged, result)
+		}
+		if isComplete(merged) {
+			break
+		}
+	}
+
+	if merged == nil && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+func (c *ProviderChain) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	var errs []error
+
+	for _, p := range c.Providers {
+		results, err := p.Search(ctx, query)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Metadata provider %s search failed: %v", p.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+			continue
+		}
+		if len(results) > 0 {
+			return results, nil
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(c.Providers) {
+		return nil, errors.Join(errs...)
+	}
+	return []*models.IsbnCache{}, nil
+}
+
+// canonicalISBN returns the ISBN-13 form of a provider identifier, or "" if
+// it is not a valid ISBN.
+func canonicalISBN(identifier string) string {
+	normalized, err := isbn.Normalize(identifier)
+	if err != nil {
+		return ""
+	}
+	return normalized
+}
+
+// maxGenres caps the genres kept from a provider's categories or subjects;
+// Open Library lists dozens of subjects for popular books.
+const maxGenres = 5
+
+// genresOf returns the main genre and the genres for a provider's
+// categories, in the provider's order.
+func genresOf(categories []string) (string, []string) {
+	genres := tags.Dedupe(categories)
+	if len(genres) == 0 {
+		return "", nil
+	}
+	if len(genres) > maxGenres {
+		genres = genres[:maxGenres]
+	}
+	return genres[0], genres
+}
+
+// mergeMetadata fills empty fields of dst from src.
+func mergeMetadata(dst, src *models.IsbnCache) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Author == "" {
+		dst.Author = src.Author
+	}
+	if dst.Genre == "" {
+		dst.Genre, dst.Genres = src.Genre, src.Genres
+	}
+	if dst.CoverUrl == "" {
+		dst.CoverUrl = src.CoverUrl
+	}
+	if dst.Description == "" {
+		dst.Description = src.Description
+	}
+	if dst.PageCount == 0 {
+		dst.PageCount = src.PageCount
+	}
+	if dst.Publisher == "" {
+		dst.Publisher = src.Publisher
+	}
+	if dst.PublishedDate == "" {
+		dst.PublishedDate = src.PublishedDate
+	}
+	if dst.Language == "" {
+		dst.Language = src.Language
+	}
+}
+
+// isComplete reports whether every metadata field has been filled.
+func isComplete(m *models.IsbnCache) bool {
+	return m.Title != "" && m.Author != "" && m.Genre != "" && m.CoverUrl != "" &&
+		m.Description != "" && m.PageCount > 0 && m.Publisher != "" && m.PublishedDate != "" &&
+		m.Language != ""
+}
+
+// publishedDateLayouts maps the date formats providers use to the layout
+// of the precision they carry.
+var publishedDateLayouts = []struct{ in, out string }{
+	{"2006-01-02", "2006-01-02"},
+	{"2006-01", "2006-01"},
+	{"2006", "2006"},
+	{"January 2, 2006", "2006-01-02"},
+	{"Jan 2, 2006", "2006-01-02"},
+	{"2 January 2006", "2006-01-02"},
+	{"January 2006", "2006-01"},
+	{"Jan 2006", "2006-01"},
+}
+
+var yearPattern = regexp.MustCompile(`(?:^|\D)((?:1[5-9]|20)\d\d)(?:\D|$)`)
+
+// normalizePublishedDate rewrites a provider's publication date as YYYY,
+// YYYY-MM or YYYY-MM-DD, keeping only as much precision as the source has.
+// Unrecognized formats fall back to the first year they mention, or "".
+func normalizePublishedDate(value string) string {
+	value = strings.TrimSpace(value)
+	for _, layout := range publishedDateLayouts {
+		if t, err := time.Parse(layout.in, value); err == nil {
+			return t.Format(layout.out)
+		}
+	}
+	if m := yearPattern.FindStringSubmatch(value); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// iso639 maps the ISO 639-2 codes Open Library uses for common languages to
+// the ISO 639-1 codes used by Google Books and stored on books.
+var iso639 = map[string]string{
+	"ara": "ar", "chi": "zh", "cze": "cs", "dan": "da", "dut": "nl", "eng": "en",
+	"fin": "fi", "fre": "fr", "ger": "de", "gre": "el", "heb": "he", "hin": "hi",
+	"hun": "hu", "ita": "it", "jpn": "ja", "kor": "ko", "nor": "no", "pol": "pl",
+	"por": "pt", "rus": "ru", "spa": "es", "swe": "sv", "tur": "tr", "ukr": "uk",
+}
+
+// normalizeLanguage returns the ISO 639-1 code for a provider language code,
+// or "" if it is not recognized.
+func normalizeLanguage(code string) string {
+	code = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(code), "/languages/"))
+	if len(code) == 2 {
+		return code
+	}
+	return iso639[code]
+}
+
+// NewProviderChainFromEnv builds the provider chain named by
+// METADATA_PROVIDERS (comma-separated, default "google,openlibrary").
+// Google Books is skipped when GOOGLE_BOOK_API_KEY is unset.
+func NewProviderChainFromEnv() *ProviderChain {
+	names := os.Getenv("METADATA_PROVIDERS")
+	if names == "" {
+		names = "google,openlibrary"
+	}
+
+	chain := &ProviderChain{}
+	for _, name := range strings.Split(names, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "google":
+			apiKey := os.Getenv("GOOGLE_BOOK_API_KEY")
+			if apiKey == "" {
+				log.Println("GOOGLE_BOOK_API_KEY not set, skipping Google Books metadata provider")
+				continue
+			}
+			chain.Providers = append(chain.Providers, NewGoogleBooksProvider(apiKey))
+		case "openlibrary":
+			chain.Providers = append(chain.Providers, NewOpenLibraryProvider())
+		case "":
+		default:
+			log.Printf("Unknown metadata provider %q, ignoring", name)
+		}
+	}
+	return chain
+}
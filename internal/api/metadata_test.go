@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+// fakeProvider returns canned results and counts the calls made to it.
+type fakeProvider struct {
+	name    string
+	book    *models.IsbnCache
+	results []*models.IsbnCache
+	err     error
+	calls   int
+}
+
+func (p *fakeProvider) Name() string { return p.name }
+
+func (p *fakeProvider) LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	p.calls++
+	if p.err != nil {
+		return nil, p.err
+	}
+	if p.book == nil {
+		return nil, nil
+	}
+	book := *p.book
+	return &book, nil
+}
+
+func (p *fakeProvider) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	p.calls++
+	return p.results, p.err
+}
+
+// complete has every field isComplete checks.
+var complete = models.IsbnCache{
+	ISBN: "9780441013593", Title: "Dune", Author: "Frank Herbert", Genre: "Fiction",
+	Genres: []string{"Fiction"}, CoverUrl: "https://covers.example/dune.jpg", Description: "Spice",
+	PageCount: 528, Publisher: "Ace", PublishedDate: "2005", Language: "en",
+}
+
+func TestProviderChainLookupISBNMerges(t *testing.T) {
+	failing := &fakeProvider{name: "failing", err: errors.New("timeout")}
+	unknown := &fakeProvider{name: "unknown"}
+	partial := &fakeProvider{name: "partial", book: &models.IsbnCache{ISBN: "9780441013593", Title: "Dune", Author: "Frank Herbert"}}
+	rest := &fakeProvider{name: "rest", book: &complete}
+	chain := &ProviderChain{Providers: []MetadataProvider{failing, unknown, partial, rest}}
+
+	got, err := chain.LookupISBN(context.Background(), "9780441013593")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || !isComplete(got) {
+		t.Fatalf("merged %+v, want every field filled", got)
+	}
+	// Fields from the first match win; later ones only fill the gaps
+	if got.Title != "Dune" || got.Author != "Frank Herbert" || got.Publisher != "Ace" || got.Genre != "Fiction" {
+		t.Errorf("merged %+v", got)
+	}
+	for _, p := range []*fakeProvider{failing, unknown, partial, rest} {
+		if p.calls != 1 {
+			t.Errorf("%s called %d times, want 1", p.name, p.calls)
+		}
+	}
+}
+
+func TestProviderChainLookupISBNStopsWhenComplete(t *testing.T) {
+	first := &fakeProvider{name: "first", book: &complete}
+	second := &fakeProvider{name: "second", book: &models.IsbnCache{Title: "Other"}}
+	chain := &ProviderChain{Providers: []MetadataProvider{first, second}}
+
+	got, err := chain.LookupISBN(context.Background(), "9780441013593")
+	if err != nil || got == nil || got.Title != "Dune" {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	if second.calls != 0 {
+		t.Errorf("second provider called %d times after a complete match", second.calls)
+	}
+}
+
+func TestProviderChainLookupISBNMisses(t *testing.T) {
+	chain := &ProviderChain{Providers: []MetadataProvider{&fakeProvider{name: "a"}, &fakeProvider{name: "b"}}}
+	if got, err := chain.LookupISBN(context.Background(), "9780441013593"); got != nil || err != nil {
+		t.Errorf("no provider knows the book: got %+v, %v; want nil, nil", got, err)
+	}
+
+	// A failed provider might have known the book, so a miss elsewhere
+	// still reports the failure rather than an unknown ISBN
+	outage := errors.New("outage")
+	chain = &ProviderChain{Providers: []MetadataProvider{
+		&fakeProvider{name: "failing", err: outage},
+		&fakeProvider{name: "unknown"},
+	}}
+	if got, err := chain.LookupISBN(context.Background(), "9780441013593"); got != nil || !errors.Is(err, outage) {
+		t.Errorf("failure and a miss: got %+v, %v; want the failure", got, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	chain = &ProviderChain{Providers: []MetadataProvider{&fakeProvider{name: "a", err: context.Canceled}}}
+	if _, err := chain.LookupISBN(ctx, "9780441013593"); err != context.Canceled {
+		t.Errorf("canceled lookup: got %v, want context.Canceled", err)
+	}
+}
+
+func TestProviderChainSearch(t *testing.T) {
+	dune := []*models.IsbnCache{{Title: "Dune"}}
+	tests := []struct {
+		name      string
+		providers []*fakeProvider
+		want      int
+		wantErr   bool
+		calls     []int
+	}{
+		{
+			"first answers",
+			[]*fakeProvider{{results: dune}, {results: dune}},
+			1, false, []int{1, 0},
+		},
+		{
+			"falls back after an error",
+			[]*fakeProvider{{err: errors.New("timeout")}, {results: dune}},
+			1, false, []int{1, 1},
+		},
+		{
+			"falls back after no results",
+			[]*fakeProvider{{results: []*models.IsbnCache{}}, {results: dune}},
+			1, false, []int{1, 1},
+		},
+		{
+			"no results anywhere",
+			[]*fakeProvider{{err: errors.New("timeout")}, {}},
+			0, false, []int{1, 1},
+		},
+		{
+			"every provider fails",
+			[]*fakeProvider{{err: errors.New("timeout")}, {err: errors.New("outage")}},
+			0, true, []int{1, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := &ProviderChain{}
+			for _, p := range tt.providers {
+				chain.Providers = append(chain.Providers, p)
+			}
+			results, err := chain.Search(context.Background(), "dune")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (results == nil || len(results) != tt.want) {
+				t.Errorf("got %v, want %d results", results, tt.want)
+			}
+			for i, p := range tt.providers {
+				if p.calls != tt.calls[i] {
+					t.Errorf("provider %d called %d times, want %d", i, p.calls, tt.calls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizePublishedDate(t *testing.T) {
+	tests := map[string]string{
+		"2005-08-02":      "2005-08-02",
+		"2005-08":         "2005-08",
+		"1965":            "1965",
+		"August 2, 2005":  "2005-08-02",
+		"Aug 2, 2005":     "2005-08-02",
+		"2 August 2005":   "2005-08-02",
+		"August 2005":     "2005-08",
+		" 1965 ":          "1965",
+		"c1965, reprint":  "1965",
+		"[1999?]":         "1999",
+		"unknown":         "",
+		"":                "",
+		"page 12345 only": "",
+	}
+	for in, want := range tests {
+		if got := normalizePublishedDate(in); got != want {
+			t.Errorf("normalizePublishedDate(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en":             "en",
+		"EN":             "en",
+		"eng":            "en",
+		"/languages/fre": "fr",
+		"ger":            "de",
+		"xxx":            "",
+		"":               "",
+	}
+	for in, want := range tests {
+		if got := normalizeLanguage(in); got != want {
+			t.Errorf("normalizeLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"booklib/internal/authors"
+	"booklib/internal/models"
+)
+
+const openLibraryBaseURL = "https://openlibrary.org"
+
+// OpenLibraryProvider looks up metadata with the Open Library API, which
+// needs no API key.
+type OpenLibraryProvider struct {
+	// BaseURL overrides https://openlibrary.org; tests point it at a
+	// stand-in.
+	BaseURL string
+	Client  *http.Client
+}
+
+func NewOpenLibraryProvider() *OpenLibraryProvider {
+	return &OpenLibraryProvider{
+		BaseURL: openLibraryBaseURL,
+		Client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *OpenLibraryProvider) Name() string {
+	return "openlibrary"
+}
+
+// openLibraryBook is the subset of the /api/books "data" response we use.
+type openLibraryBook struct {
+	Title   string `json:"title"`
+	Authors []struct {
+		Name string `json:"name"`
+	} `json:"authors"`
+	Subjects []struct {
+		Name string `json:"name"`
+	} `json:"subjects"`
+	Cover struct {
+		Small  string `json:"small"`
+		Medium string `json:"medium"`
+		Large  string `json:"large"`
+	} `json:"cover"`
+	Publishers []struct {
+		Name string `json:"name"`
+	} `json:"publishers"`
+	PublishDate   string `json:"publish_date"`
+	NumberOfPages int    `json:"number_of_pages"`
+	Excerpts      []struct {
+		Text string `json:"text"`
+	} `json:"excerpts"`
+}
+
+// openLibrarySearch is the subset of the /search.json response we use.
+type openLibrarySearch struct {
+	Docs []struct {
+		Title      string   `json:"title"`
+		AuthorName []string `json:"author_name"`
+		ISBN       []string `json:"isbn"`
+		Subject    []string `json:"subject"`
+		CoverID    int      `json:"cover_i"`
+		Publisher  []string `json:"publisher"`
+		FirstYear  int      `json:"first_publish_year"`
+		Pages      int      `json:"number_of_pages_median"`
+		Language   []string `json:"language"`
+	} `json:"docs"`
+}
+
+func (p *OpenLibraryProvider) get(ctx context.Context, path string, query url.Values, v any) error {
+	base := p.BaseURL
+	if base == "" {
+		base = openLibraryBaseURL
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "booklib")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("open library returned status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (p *OpenLibraryProvider) LookupISBN(ctx context.Context, isbnCode string) (*models.IsbnCache, error) {
+	key := "ISBN:" + isbnCode
+	var resp map[string]openLibraryBook
+	err := p.get(ctx, "/api/books", url.Values{
+		"bibkeys": {key},
+		"format":  {"json"},
+		"jscmd":   {"data"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	book, ok := resp[key]
+	if !ok {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(book.Authors))
+	for _, a := range book.Authors {
+		names = append(names, a.Name)
+	}
+
+	subjects := make([]string, 0, len(book.Subjects))
+	for _, subject := range book.Subjects {
+		subjects = append(subjects, subject.Name)
+	}
+	genre, genres := genresOf(subjects)
+
+	cover := book.Cover.Medium
+	if cover == "" {
+		cover = book.Cover.Large
+	}
+	if cover == "" {
+		cover = book.Cover.Small
+	}
+
+	var publisher string
+	if len(book.Publishers) > 0 {
+		publisher = book.Publishers[0].Name
+	}
+
+	// The data view has no description; an excerpt is the closest thing
+	var description string
+	if len(book.Excerpts) > 0 {
+		description = book.Excerpts[0].Text
+	}
+
+	now := time.Now()
+	return &models.IsbnCache{
+		ISBN:          isbnCode,
+		Title:         book.Title,
+		Author:        authors.Join(names),
+		Genre:         genre,
+		Genres:        genres,
+		CoverUrl:      cover,
+		Description:   description,
+		PageCount:     book.NumberOfPages,
+		Publisher:     publisher,
+		PublishedDate: normalizePublishedDate(book.PublishDate),
+		CachedAt:      &now,
+	}, nil
+}
+
+func (p *OpenLibraryProvider) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	var resp openLibrarySearch
+	err := p.get(ctx, "/search.json", url.Values{
+		"q":      {query},
+		"limit":  {"10"},
+		"fields": {"title,author_name,isbn,subject,cover_i,publisher,first_publish_year,number_of_pages_median,language"},
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.IsbnCache, 0, len(resp.Docs))
+	now := time.Now()
+	for _, doc := range resp.Docs {
+		// Editions list both forms; the first valid one is as good as any
+		// since they normalize to the same ISBN-13
+		var identifier string
+		for _, id := range doc.ISBN {
+			if identifier = canonicalISBN(id); identifier != "" {
+				break
+			}
+		}
+
+		genre, genres := genresOf(doc.Subject)
+
+		var cover string
+		if doc.CoverID > 0 {
+			cover = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-M.jpg", doc.CoverID)
+		}
+
+		var publisher, published, language string
+		if len(doc.Publisher) > 0 {
+			publisher = doc.Publisher[0]
+		}
+		if doc.FirstYear > 0 {
+			published = strconv.Itoa(doc.FirstYear)
+		}
+		if len(doc.Language) > 0 {
+			language = normalizeLanguage(doc.Language[0])
+		}
+
+		results = append(results, &models.IsbnCache{
+			ISBN:          identifier,
+			Title:         doc.Title,
+			Author:        authors.Join(doc.AuthorName),
+			Genre:         genre,
+			Genres:        genres,
+			CoverUrl:      cover,
+			PageCount:     doc.Pages,
+			Publisher:     publisher,
+			PublishedDate: published,
+			Language:      language,
+			CachedAt:      &now,
+		})
+	}
+	return results, nil
+}
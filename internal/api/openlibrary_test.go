@@ -0,0 +1,139 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// standIn serves body for requests to path and fails the test on any
+// other path. A status other than 200 is sent without a body.
+func standIn(t *testing.T, path string, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("request for %s, want %s", r.URL.Path, path)
+			http.NotFound(w, r)
+			return
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOpenLibraryLookupISBN(t *testing.T) {
+	server := standIn(t, "/api/books", http.StatusOK, `{
+		"ISBN:9780441013593": {
+			"title": "Dune",
+			"authors": [{"name": "Frank Herbert"}, {"name": "Brian Herbert"}],
+			"subjects": [{"name": "Science fiction"}, {"name": "science fiction"}, {"name": "Deserts"}],
+			"cover": {"small": "https://covers.example/s.jpg", "large": "https://covers.example/l.jpg"},
+			"publishers": [{"name": "Ace"}, {"name": "Chilton"}],
+			"publish_date": "August 2, 2005",
+			"number_of_pages": 528,
+			"excerpts": [{"text": "In the week before their departure to Arrakis"}]
+		}
+	}`)
+	p := &OpenLibraryProvider{BaseURL: server.URL}
+
+	got, err := p.LookupISBN(context.Background(), "9780441013593")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("got nil metadata")
+	}
+	if got.ISBN != "9780441013593" || got.Title != "Dune" || got.Author != "Frank Herbert, Brian Herbert" {
+		t.Errorf("got %q by %q (%s)", got.Title, got.Author, got.ISBN)
+	}
+	if got.Genre != "Science fiction" || len(got.Genres) != 2 {
+		t.Errorf("genre %q, genres %v", got.Genre, got.Genres)
+	}
+	if got.CoverUrl != "https://covers.example/l.jpg" {
+		t.Errorf("cover %q, want the large one when there is no medium", got.CoverUrl)
+	}
+	if got.Publisher != "Ace" || got.PublishedDate != "2005-08-02" || got.PageCount != 528 {
+		t.Errorf("publisher %q, published %q, %d pages", got.Publisher, got.PublishedDate, got.PageCount)
+	}
+	if got.Description != "In the week before their departure to Arrakis" {
+		t.Errorf("description %q", got.Description)
+	}
+	if got.CachedAt == nil {
+		t.Error("cached_at not set")
+	}
+
+	missing, err := p.LookupISBN(context.Background(), "9780000000002")
+	if missing != nil || err != nil {
+		t.Errorf("unknown ISBN: got %+v, %v; want nil, nil", missing, err)
+	}
+}
+
+func TestOpenLibraryErrors(t *testing.T) {
+	server := standIn(t, "/api/books", http.StatusServiceUnavailable, "")
+	p := &OpenLibraryProvider{BaseURL: server.URL}
+	if got, err := p.LookupISBN(context.Background(), "9780441013593"); err == nil {
+		t.Errorf("lookup during an outage: got %+v, want an error", got)
+	}
+
+	server = standIn(t, "/search.json", http.StatusOK, `{"docs": [`)
+	p = &OpenLibraryProvider{BaseURL: server.URL}
+	if got, err := p.Search(context.Background(), "dune"); err == nil {
+		t.Errorf("search with a truncated response: got %+v, want an error", got)
+	}
+}
+
+func TestOpenLibrarySearch(t *testing.T) {
+	var query string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query().Get("q")
+		w.Write([]byte(`{"docs": [
+			{
+				"title": "Dune",
+				"author_name": ["Frank Herbert"],
+				"isbn": ["not-an-isbn", "0441013597", "9780441013593"],
+				"subject": ["Science fiction", "Deserts"],
+				"cover_i": 12345,
+				"publisher": ["Ace"],
+				"first_publish_year": 1965,
+				"number_of_pages_median": 612,
+				"language": ["eng"]
+			},
+			{"title": "Dune Messiah"}
+		]}`))
+	}))
+	t.Cleanup(server.Close)
+	p := &OpenLibraryProvider{BaseURL: server.URL}
+
+	results, err := p.Search(context.Background(), "frank herbert dune")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query != "frank herbert dune" {
+		t.Errorf("searched for %q", query)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	got := results[0]
+	// The ISBN-10 is the first valid identifier and comes back as ISBN-13
+	if got.ISBN != "9780441013593" || got.Title != "Dune" || got.Author != "Frank Herbert" {
+		t.Errorf("got %q by %q (%s)", got.Title, got.Author, got.ISBN)
+	}
+	if got.CoverUrl != "https://covers.openlibrary.org/b/id/12345-M.jpg" {
+		t.Errorf("cover %q", got.CoverUrl)
+	}
+	if got.Genre != "Science fiction" || got.Publisher != "Ace" || got.PublishedDate != "1965" ||
+		got.PageCount != 612 || got.Language != "en" {
+		t.Errorf("got %+v", got)
+	}
+	if bare := results[1]; bare.ISBN != "" || bare.CoverUrl != "" || bare.PublishedDate != "" || bare.Genres != nil {
+		t.Errorf("result without details: %+v", bare)
+	}
+}
@@ -0,0 +1,1028 @@
+// Package archive converts user data exports to and from a zip file holding
+// one CSV file per table, plus a manifest recording the archive version, and
+// streams them as JSON.
+package archive
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+	"booklib/internal/notes"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+	"booklib/internal/store"
+	"booklib/internal/tags"
+)
+
+const manifestFile = "manifest.json"
+
+// Limits on how much ReadZip decompresses, so a small archive can't expand
+// into more than a restore can hold in memory.
+const (
+	maxEntrySize   = 64 << 20
+	maxArchiveSize = 256 << 20
+)
+
+var (
+	// ErrUnsupportedVersion is returned by Validate for archives written by
+	// a version this build doesn't understand.
+	ErrUnsupportedVersion = errors.New("unsupported archive version")
+	// ErrTooLarge is returned by ReadZip for archives holding a file larger
+	// than maxEntrySize, or more than maxArchiveSize in all.
+	ErrTooLarge = errors.New("archive is too large")
+)
+
+var (
+	bookColumns = []string{
+		"id", "title", "author", "isbn", "genre", "read", "cover_url", "description", "page_count",
+		"publisher", "published_date", "language", "notes", "created_at", "status", "status_changed_at",
+	}
+	creditColumns    = []string{"book_id", "name", "role"}
+	genreColumns     = []string{"book_id", "genre"}
+	tagColumns       = []string{"book_id", "tag"}
+	lendingColumns   = []string{"id", "book_id", "lent_to", "lent_at", "due_date", "returned_at", "last_reminder_sent"}
+	readingColumns   = []string{"id", "book_id", "started_at", "completed_at", "abandoned_at"}
+	statusColumns    = []string{"id", "book_id", "from_status", "to_status", "changed_at"}
+	progressColumns  = []string{"id", "session_id", "page", "location", "location_total", "percent", "recorded_at"}
+	reviewColumns    = []string{"id", "session_id", "rating", "body", "spoiler", "created_at", "updated_at"}
+	editColumns      = []string{"id", "review_id", "rating", "body", "spoiler", "edited_at"}
+	noteColumns      = []string{"id", "book_id", "session_id", "type", "page", "location", "body", "import_key", "created_at", "updated_at"}
+	shelfColumns     = []string{"id", "name", "description"}
+	shelfBookColumns = []string{"shelf_id", "book_id"}
+	smartColumns     = []string{"id", "name", "description", "rules"}
+	settingsColumns  = []string{
+		"email_reminders_enabled", "email_upcoming_reminders", "email_overdue_reminders",
+		"default_lending_days", "yearly_reading_goal",
+	}
+)
+
+type manifest struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+// Validate checks that an archive can be restored: it was written by a
+// version this build understands, every book has a title and a unique ID,
+// credits have known roles, tags fit tags.MaxLength, reading statuses are
+// known, reviews and notes are valid, shelves have valid names and unique
+// IDs, smart shelves valid rules, lending, reading history, status changes,
+// notes and shelves only refer to books in the archive, and reading
+// progress, reviews and notes only to reading history in it, at most one
+// review per session.
+func Validate(e *models.Export) error {
+	if e.Version < 1 || e.Version > models.ExportVersion {
+		return fmt.Errorf("%w %d", ErrUnsupportedVersion, e.Version)
+	}
+
+	books := make(map[int]bool, len(e.Books))
+	for _, b := range e.Books {
+		if b.Title == "" {
+			return fmt.Errorf("book %d has no title", b.ID)
+		}
+		if books[b.ID] {
+			return fmt.Errorf("duplicate book ID %d", b.ID)
+		}
+		books[b.ID] = true
+		if b.Status != "" && !reading.Valid(b.Status) {
+			return fmt.Errorf("book %d has unknown reading status %q", b.ID, b.Status)
+		}
+		for _, credit := range b.Authors {
+			if credit.Role != "" && !slices.Contains(models.AuthorRoles, credit.Role) {
+				return fmt.Errorf("book %d credits %q with unknown role %q", b.ID, credit.Name, credit.Role)
+			}
+		}
+		for _, tag := range b.Tags {
+			if utf8.RuneCountInString(tags.Clean(tag)) > tags.MaxLength {
+				return fmt.Errorf("book %d has invalid tag %q", b.ID, tag)
+			}
+		}
+	}
+	for _, l := range e.Lending {
+		if !books[l.BookID] {
+			return fmt.Errorf("lending %d refers to unknown book %d", l.ID, l.BookID)
+		}
+	}
+	sessions := make(map[int]bool, len(e.ReadingHistory))
+	for _, h := range e.ReadingHistory {
+		if !books[h.BookID] {
+			return fmt.Errorf("reading history %d refers to unknown book %d", h.ID, h.BookID)
+		}
+		sessions[h.ID] = true
+	}
+	for _, c := range e.StatusChanges {
+		if !books[c.BookID] {
+			return fmt.Errorf("status change %d refers to unknown book %d", c.ID, c.BookID)
+		}
+		if !reading.Valid(c.From) || !reading.Valid(c.To) {
+			return fmt.Errorf("status change %d has unknown reading status", c.ID)
+		}
+	}
+	for _, p := range e.ReadingProgress {
+		if !sessions[p.SessionID] {
+			return fmt.Errorf("reading progress %d refers to unknown reading history %d", p.ID, p.SessionID)
+		}
+	}
+	reviewed := make(map[int]bool, len(e.Reviews))
+	for _, r := range e.Reviews {
+		if !sessions[r.SessionID] {
+			return fmt.Errorf("review %d refers to unknown reading history %d", r.ID, r.SessionID)
+		}
+		if reviewed[r.SessionID] {
+			return fmt.Errorf("reading history %d has more than one review", r.SessionID)
+		}
+		reviewed[r.SessionID] = true
+		if _, err := reading.NewReview(models.ReviewRequest{Rating: r.Rating, Body: r.Body, Spoiler: r.Spoiler}); err != nil {
+			return fmt.Errorf("review %d: %v", r.ID, err)
+		}
+	}
+	for _, n := range e.Notes {
+		if !books[n.BookID] {
+			return fmt.Errorf("note %d refers to unknown book %d", n.ID, n.BookID)
+		}
+		if n.SessionID != nil && !sessions[*n.SessionID] {
+			return fmt.Errorf("note %d refers to unknown reading history %d", n.ID, *n.SessionID)
+		}
+		if !slices.Contains(notes.Types, n.Type) {
+			return fmt.Errorf("note %d has unknown type %q", n.ID, n.Type)
+		}
+		check := n
+		if err := notes.Validate(&check); err != nil {
+			return fmt.Errorf("note %d: %v", n.ID, err)
+		}
+	}
+	shelfIDs := make(map[int]bool, len(e.Shelves))
+	for _, s := range e.Shelves {
+		if shelfIDs[s.ID] {
+			return fmt.Errorf("duplicate shelf ID %d", s.ID)
+		}
+		shelfIDs[s.ID] = true
+		check := models.Shelf{Name: s.Name, Description: s.Description}
+		if err := shelves.Validate(&check); err != nil {
+			return fmt.Errorf("shelf %d: %v", s.ID, err)
+		}
+		for _, bookID := range s.BookIDs {
+			if !books[bookID] {
+				return fmt.Errorf("shelf %d refers to unknown book %d", s.ID, bookID)
+			}
+		}
+	}
+	for _, s := range e.SmartShelves {
+		check := models.SmartShelf{Name: s.Name, Description: s.Description, Rules: s.Rules}
+		check.Rules.Rules = slices.Clone(s.Rules.Rules)
+		if err := shelves.ValidateSmart(&check); err != nil {
+			return fmt.Errorf("smart shelf %d: %v", s.ID, err)
+		}
+	}
+	return nil
+}
+
+// WriteJSON streams the export to w as the JSON encoding of a
+// models.Export, a record at a time.
+func WriteJSON(w io.Writer, exportedAt time.Time, r store.ExportReader) error {
+	bw := bufio.NewWriter(w)
+	header, err := json.Marshal(manifest{Version: models.ExportVersion, ExportedAt: exportedAt})
+	if err != nil {
+		return err
+	}
+	// Leave the object open for the tables
+	bw.Write(header[:len(header)-1])
+
+	if err := writeArray(bw, "books", r.Books); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "lending", r.Lending); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "reading_history", r.ReadingHistory); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "status_changes", r.StatusChanges); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "reading_progress", r.ReadingProgress); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "reviews", r.Reviews); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "notes", r.Notes); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "shelves", r.Shelves); err != nil {
+		return err
+	}
+	if err := writeArray(bw, "smart_shelves", r.SmartShelves); err != nil {
+		return err
+	}
+
+	settings, err := r.UserSettings()
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		encoded, err := json.Marshal(settings)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(`,"user_settings":`)
+		bw.Write(encoded)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// writeArray writes the records each reads as the named member of the
+// object being written.
+func writeArray[T any](bw *bufio.Writer, name string, each func(func(T) error) error) error {
+	bw.WriteString(`,"` + name + `":[`)
+	first := true
+	err := each(func(record T) error {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		_, err = bw.Write(encoded)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	_, err = bw.WriteString("]")
+	return err
+}
+
+// WriteZip streams the export to w as a zip archive, a record at a time.
+// Tables derived from the same records, such as books and their credits,
+// read them again.
+func WriteZip(w io.Writer, exportedAt time.Time, r store.ExportReader) error {
+	zw := zip.NewWriter(w)
+
+	f, err := zw.Create(manifestFile)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(manifest{Version: models.ExportVersion, ExportedAt: exportedAt}); err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "books.csv", bookColumns, func(write func([]string) error) error {
+		return r.Books(func(b models.Book) error {
+			return write([]string{
+				strconv.Itoa(b.ID), b.Title, b.Author, b.ISBN, b.Genre,
+				strconv.FormatBool(b.Read), b.CoverURL, b.Description, strconv.Itoa(b.PageCount),
+				b.Publisher, b.PublishedDate, b.Language, b.Notes, formatTime(b.CreatedAt),
+				b.Status, formatTime(b.StatusChangedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "book_authors.csv", creditColumns, func(write func([]string) error) error {
+		return r.Books(func(b models.Book) error {
+			for _, credit := range b.Authors {
+				if err := write([]string{strconv.Itoa(b.ID), credit.Name, credit.Role}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "book_genres.csv", genreColumns, func(write func([]string) error) error {
+		return r.Books(func(b models.Book) error {
+			for _, genre := range b.Genres {
+				if err := write([]string{strconv.Itoa(b.ID), genre}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "book_tags.csv", tagColumns, func(write func([]string) error) error {
+		return r.Books(func(b models.Book) error {
+			for _, tag := range b.Tags {
+				if err := write([]string{strconv.Itoa(b.ID), tag}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "lending.csv", lendingColumns, func(write func([]string) error) error {
+		return r.Lending(func(l models.Lending) error {
+			return write([]string{
+				strconv.Itoa(l.ID), strconv.Itoa(l.BookID), l.LentTo, formatTime(&l.LentAt),
+				formatTime(l.DueDate), formatTime(l.ReturnedAt), formatTime(l.LastReminderSent),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "reading_history.csv", readingColumns, func(write func([]string) error) error {
+		return r.ReadingHistory(func(h models.ReadingHistory) error {
+			return write([]string{
+				strconv.Itoa(h.ID), strconv.Itoa(h.BookID), formatTime(&h.StartedAt), formatTime(h.CompletedAt),
+				formatTime(h.AbandonedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "status_changes.csv", statusColumns, func(write func([]string) error) error {
+		return r.StatusChanges(func(c models.StatusChange) error {
+			return write([]string{
+				strconv.Itoa(c.ID), strconv.Itoa(c.BookID), c.From, c.To, formatTime(&c.ChangedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "reading_progress.csv", progressColumns, func(write func([]string) error) error {
+		return r.ReadingProgress(func(p models.ReadingProgress) error {
+			return write([]string{
+				strconv.Itoa(p.ID), strconv.Itoa(p.SessionID), formatInt(p.Page), formatInt(p.Location),
+				formatInt(p.LocationTotal), formatFloat(p.Percent), formatTime(&p.RecordedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "reviews.csv", reviewColumns, func(write func([]string) error) error {
+		return r.Reviews(func(rv models.Review) error {
+			return write([]string{
+				strconv.Itoa(rv.ID), strconv.Itoa(rv.SessionID), formatFloat(rv.Rating), rv.Body, strconv.FormatBool(rv.Spoiler),
+				formatTime(&rv.CreatedAt), formatTime(&rv.UpdatedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "review_edits.csv", editColumns, func(write func([]string) error) error {
+		return r.Reviews(func(rv models.Review) error {
+			for _, edit := range rv.Edits {
+				err := write([]string{
+					strconv.Itoa(edit.ID), strconv.Itoa(rv.ID), formatFloat(edit.Rating), edit.Body,
+					strconv.FormatBool(edit.Spoiler), formatTime(&edit.EditedAt),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "notes.csv", noteColumns, func(write func([]string) error) error {
+		return r.Notes(func(n models.Note) error {
+			return write([]string{
+				strconv.Itoa(n.ID), strconv.Itoa(n.BookID), formatInt(n.SessionID), n.Type, formatInt(n.Page),
+				formatInt(n.Location), n.Body, formatString(n.ImportKey), formatTime(&n.CreatedAt), formatTime(&n.UpdatedAt),
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "shelves.csv", shelfColumns, func(write func([]string) error) error {
+		return r.Shelves(func(s models.ExportShelf) error {
+			return write([]string{strconv.Itoa(s.ID), s.Name, s.Description})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "shelf_books.csv", shelfBookColumns, func(write func([]string) error) error {
+		return r.Shelves(func(s models.ExportShelf) error {
+			for _, bookID := range s.BookIDs {
+				if err := write([]string{strconv.Itoa(s.ID), strconv.Itoa(bookID)}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeTable(zw, "smart_shelves.csv", smartColumns, func(write func([]string) error) error {
+		return r.SmartShelves(func(s models.ExportSmartShelf) error {
+			rules, err := json.Marshal(s.Rules)
+			if err != nil {
+				return err
+			}
+			return write([]string{strconv.Itoa(s.ID), s.Name, s.Description, string(rules)})
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	settings, err := r.UserSettings()
+	if err != nil {
+		return err
+	}
+	err = writeTable(zw, "user_settings.csv", settingsColumns, func(write func([]string) error) error {
+		if settings == nil {
+			return nil
+		}
+		return write([]string{
+			strconv.FormatBool(settings.EmailRemindersEnabled), strconv.FormatBool(settings.EmailUpcomingReminders),
+			strconv.FormatBool(settings.EmailOverdueReminders), strconv.Itoa(settings.DefaultLendingDays),
+			strconv.Itoa(settings.YearlyReadingGoal),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// writeTable adds a CSV file to the archive holding the header and the rows
+// rows writes.
+func writeTable(zw *zip.Writer, name string, header []string, rows func(write func([]string) error) error) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(header)
+	if err := rows(w.Write); err != nil {
+		return err
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// ReadZip parses an archive written by WriteZip. Tables missing from the
+// archive are read as empty.
+func ReadZip(r io.ReaderAt, size int64) (*models.Export, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string]*zip.File)
+	var total uint64
+	for _, f := range zr.File {
+		if f.UncompressedSize64 > maxEntrySize {
+			return nil, fmt.Errorf("%w: %s", ErrTooLarge, f.Name)
+		}
+		total += f.UncompressedSize64
+		files[f.Name] = f
+	}
+	if total > maxArchiveSize {
+		return nil, ErrTooLarge
+	}
+	// The headers can understate the sizes, so the limits are also
+	// enforced on what is actually read
+	budget := int64(maxArchiveSize)
+
+	mf, ok := files[manifestFile]
+	if !ok {
+		return nil, errors.New("archive has no manifest")
+	}
+	rc, err := openEntry(mf, &budget)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	err = json.NewDecoder(rc).Decode(&m)
+	rc.Close()
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	e := &models.Export{
+		Version:         m.Version,
+		ExportedAt:      m.ExportedAt,
+		Books:           []models.Book{},
+		Lending:         []models.Lending{},
+		ReadingHistory:  []models.ReadingHistory{},
+		StatusChanges:   []models.StatusChange{},
+		ReadingProgress: []models.ReadingProgress{},
+		Reviews:         []models.Review{},
+		Notes:           []models.Note{},
+		Shelves:         []models.ExportShelf{},
+		SmartShelves:    []models.ExportSmartShelf{},
+	}
+
+	err = readTable(files["books.csv"], &budget, func(row tableRow) error {
+		b := models.Book{
+			ID:       row.int("id"),
+			Title:    row.get("title"),
+			Author:   row.get("author"),
+			ISBN:     row.get("isbn"),
+			Genre:    row.get("genre"),
+			Read:     row.bool("read"),
+			Status:   row.get("status"),
+			CoverURL: row.get("cover_url"),
+			Notes:    row.get("notes"),
+
+			Description:   row.get("description"),
+			PageCount:     row.int("page_count"),
+			Publisher:     row.get("publisher"),
+			PublishedDate: row.get("published_date"),
+			Language:      row.get("language"),
+		}
+		b.CreatedAt = row.time("created_at")
+		b.StatusChangedAt = row.time("status_changed_at")
+		e.Books = append(e.Books, b)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("books.csv: %w", err)
+	}
+
+	// Archives written before books had credits, genres or tags lack
+	// their tables; such books are credited from the author column and
+	// filed under the genre column on restore.
+	bookIndex := make(map[int]int, len(e.Books))
+	for i, b := range e.Books {
+		bookIndex[b.ID] = i
+	}
+	bookOf := func(row *tableRow) (*models.Book, error) {
+		i, ok := bookIndex[row.int("book_id")]
+		if row.err != nil {
+			return nil, row.err
+		}
+		if !ok {
+			return nil, fmt.Errorf("row refers to unknown book %s", row.get("book_id"))
+		}
+		return &e.Books[i], nil
+	}
+
+	err = readTable(files["book_authors.csv"], &budget, func(row tableRow) error {
+		book, err := bookOf(&row)
+		if err != nil {
+			return err
+		}
+		book.Authors = append(book.Authors, models.BookAuthor{
+			Name: row.get("name"),
+			Role: row.get("role"),
+		})
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("book_authors.csv: %w", err)
+	}
+
+	err = readTable(files["book_genres.csv"], &budget, func(row tableRow) error {
+		book, err := bookOf(&row)
+		if err != nil {
+			return err
+		}
+		book.Genres = append(book.Genres, row.get("genre"))
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("book_genres.csv: %w", err)
+	}
+
+	err = readTable(files["book_tags.csv"], &budget, func(row tableRow) error {
+		book, err := bookOf(&row)
+		if err != nil {
+			return err
+		}
+		book.Tags = append(book.Tags, row.get("tag"))
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("book_tags.csv: %w", err)
+	}
+
+	err = readTable(files["lending.csv"], &budget, func(row tableRow) error {
+		l := models.Lending{
+			ID:               row.int("id"),
+			BookID:           row.int("book_id"),
+			LentTo:           row.get("lent_to"),
+			DueDate:          row.time("due_date"),
+			ReturnedAt:       row.time("returned_at"),
+			LastReminderSent: row.time("last_reminder_sent"),
+		}
+		if lentAt := row.time("lent_at"); lentAt != nil {
+			l.LentAt = *lentAt
+		}
+		e.Lending = append(e.Lending, l)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lending.csv: %w", err)
+	}
+
+	err = readTable(files["reading_history.csv"], &budget, func(row tableRow) error {
+		h := models.ReadingHistory{
+			ID:          row.int("id"),
+			BookID:      row.int("book_id"),
+			CompletedAt: row.time("completed_at"),
+			AbandonedAt: row.time("abandoned_at"),
+		}
+		if startedAt := row.time("started_at"); startedAt != nil {
+			h.StartedAt = *startedAt
+		}
+		e.ReadingHistory = append(e.ReadingHistory, h)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading_history.csv: %w", err)
+	}
+
+	err = readTable(files["status_changes.csv"], &budget, func(row tableRow) error {
+		c := models.StatusChange{
+			ID:     row.int("id"),
+			BookID: row.int("book_id"),
+			From:   row.get("from_status"),
+			To:     row.get("to_status"),
+		}
+		if changedAt := row.time("changed_at"); changedAt != nil {
+			c.ChangedAt = *changedAt
+		}
+		e.StatusChanges = append(e.StatusChanges, c)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("status_changes.csv: %w", err)
+	}
+
+	err = readTable(files["reading_progress.csv"], &budget, func(row tableRow) error {
+		p := models.ReadingProgress{
+			ID:            row.int("id"),
+			SessionID:     row.int("session_id"),
+			Page:          row.optionalInt("page"),
+			Location:      row.optionalInt("location"),
+			LocationTotal: row.optionalInt("location_total"),
+			Percent:       row.optionalFloat("percent"),
+		}
+		if recordedAt := row.time("recorded_at"); recordedAt != nil {
+			p.RecordedAt = *recordedAt
+		}
+		e.ReadingProgress = append(e.ReadingProgress, p)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading_progress.csv: %w", err)
+	}
+
+	err = readTable(files["reviews.csv"], &budget, func(row tableRow) error {
+		r := models.Review{
+			ID:        row.int("id"),
+			SessionID: row.int("session_id"),
+			Rating:    row.optionalFloat("rating"),
+			Body:      row.get("body"),
+			Spoiler:   row.bool("spoiler"),
+			Edits:     []models.ReviewEdit{},
+		}
+		if createdAt := row.time("created_at"); createdAt != nil {
+			r.CreatedAt = *createdAt
+		}
+		if updatedAt := row.time("updated_at"); updatedAt != nil {
+			r.UpdatedAt = *updatedAt
+		}
+		e.Reviews = append(e.Reviews, r)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reviews.csv: %w", err)
+	}
+
+	// Edits are listed oldest first
+	reviewIndex := make(map[int]int, len(e.Reviews))
+	for i, r := range e.Reviews {
+		reviewIndex[r.ID] = i
+	}
+	err = readTable(files["review_edits.csv"], &budget, func(row tableRow) error {
+		edit := models.ReviewEdit{
+			ID:      row.int("id"),
+			Rating:  row.optionalFloat("rating"),
+			Body:    row.get("body"),
+			Spoiler: row.bool("spoiler"),
+		}
+		i, ok := reviewIndex[row.int("review_id")]
+		if editedAt := row.time("edited_at"); editedAt != nil {
+			edit.EditedAt = *editedAt
+		}
+		if row.err != nil {
+			return row.err
+		}
+		if !ok {
+			return fmt.Errorf("row refers to unknown review %s", row.get("review_id"))
+		}
+		edit.ReviewID = e.Reviews[i].ID
+		e.Reviews[i].Edits = append(e.Reviews[i].Edits, edit)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("review_edits.csv: %w", err)
+	}
+
+	err = readTable(files["notes.csv"], &budget, func(row tableRow) error {
+		n := models.Note{
+			ID:        row.int("id"),
+			BookID:    row.int("book_id"),
+			SessionID: row.optionalInt("session_id"),
+			Type:      row.get("type"),
+			Page:      row.optionalInt("page"),
+			Location:  row.optionalInt("location"),
+			Body:      row.get("body"),
+			ImportKey: row.optionalString("import_key"),
+		}
+		if createdAt := row.time("created_at"); createdAt != nil {
+			n.CreatedAt = *createdAt
+		}
+		if updatedAt := row.time("updated_at"); updatedAt != nil {
+			n.UpdatedAt = *updatedAt
+		}
+		e.Notes = append(e.Notes, n)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("notes.csv: %w", err)
+	}
+
+	err = readTable(files["shelves.csv"], &budget, func(row tableRow) error {
+		e.Shelves = append(e.Shelves, models.ExportShelf{
+			ID:          row.int("id"),
+			Name:        row.get("name"),
+			Description: row.get("description"),
+			BookIDs:     []int{},
+		})
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("shelves.csv: %w", err)
+	}
+
+	// Shelf books are listed in shelf order
+	shelfIndex := make(map[int]int, len(e.Shelves))
+	for i, s := range e.Shelves {
+		shelfIndex[s.ID] = i
+	}
+	err = readTable(files["shelf_books.csv"], &budget, func(row tableRow) error {
+		i, ok := shelfIndex[row.int("shelf_id")]
+		bookID := row.int("book_id")
+		if row.err != nil {
+			return row.err
+		}
+		if !ok {
+			return fmt.Errorf("row refers to unknown shelf %s", row.get("shelf_id"))
+		}
+		e.Shelves[i].BookIDs = append(e.Shelves[i].BookIDs, bookID)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("shelf_books.csv: %w", err)
+	}
+
+	err = readTable(files["smart_shelves.csv"], &budget, func(row tableRow) error {
+		s := models.ExportSmartShelf{
+			ID:          row.int("id"),
+			Name:        row.get("name"),
+			Description: row.get("description"),
+		}
+		if err := json.Unmarshal([]byte(row.get("rules")), &s.Rules); err != nil && row.err == nil {
+			row.err = fmt.Errorf("invalid rules for smart shelf %s", row.get("id"))
+		}
+		e.SmartShelves = append(e.SmartShelves, s)
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("smart_shelves.csv: %w", err)
+	}
+
+	err = readTable(files["user_settings.csv"], &budget, func(row tableRow) error {
+		e.UserSettings = &models.UserSettings{
+			EmailRemindersEnabled:  row.bool("email_reminders_enabled"),
+			EmailUpcomingReminders: row.bool("email_upcoming_reminders"),
+			EmailOverdueReminders:  row.bool("email_overdue_reminders"),
+			DefaultLendingDays:     row.int("default_lending_days"),
+			YearlyReadingGoal:      row.int("yearly_reading_goal"),
+		}
+		return row.err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("user_settings.csv: %w", err)
+	}
+
+	return e, nil
+}
+
+// tableRow is one CSV record with its values addressed by column name. The
+// typed getters record the first conversion error in err.
+type tableRow struct {
+	columns map[string]int
+	record  []string
+	err     error
+}
+
+func (r *tableRow) get(name string) string {
+	if i, ok := r.columns[name]; ok && i < len(r.record) {
+		return r.record[i]
+	}
+	return ""
+}
+
+func (r *tableRow) int(name string) int {
+	value := r.get(name)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n
+}
+
+// optionalInt is like int but returns nil for an empty value.
+func (r *tableRow) optionalInt(name string) *int {
+	if r.get(name) == "" {
+		return nil
+	}
+	n := r.int(name)
+	return &n
+}
+
+// optionalString returns the value, or nil if it is empty.
+func (r *tableRow) optionalString(name string) *string {
+	value := r.get(name)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// optionalFloat returns the value as a number, or nil if it is empty.
+func (r *tableRow) optionalFloat(name string) *float64 {
+	value := r.get(name)
+	if value == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return &f
+}
+
+func (r *tableRow) bool(name string) bool {
+	value := r.get(name)
+	if value == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil && r.err == nil {
+		r.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return b
+}
+
+func (r *tableRow) time(name string) *time.Time {
+	value := r.get(name)
+	if value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		if r.err == nil {
+			r.err = fmt.Errorf("invalid %s %q", name, value)
+		}
+		return nil
+	}
+	return &t
+}
+
+// limitedEntry reads a zip entry until it has read more than its limit,
+// then fails with ErrTooLarge. What it reads is taken from budget.
+type limitedEntry struct {
+	io.Closer
+	r      *io.LimitedReader
+	budget *int64
+}
+
+// openEntry opens f to read at most maxEntrySize bytes, or what is left of
+// budget if that is less.
+func openEntry(f *zip.File, budget *int64) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	limit := min(int64(maxEntrySize), *budget)
+	return &limitedEntry{Closer: rc, r: &io.LimitedReader{R: rc, N: limit + 1}, budget: budget}, nil
+}
+
+func (e *limitedEntry) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	*e.budget -= int64(n)
+	if e.r.N == 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func readTable(f *zip.File, budget *int64, fn func(row tableRow) error) error {
+	if f == nil {
+		return nil
+	}
+	rc, err := openEntry(f, budget)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[name] = i
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(tableRow{columns: columns, record: record}); err != nil {
+			return err
+		}
+	}
+}
+
+func formatInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+func formatString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,125 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+// testExport is a small archive of one book on one shelf.
+func testExport() *models.Export {
+	return &models.Export{
+		Version:    models.ExportVersion,
+		ExportedAt: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Books: []models.Book{
+			{ID: 1, Title: "Dune", Author: "Frank Herbert", Status: "finished", Read: true, Tags: []string{"classic"}},
+		},
+		Shelves: []models.ExportShelf{{ID: 1, Name: "Favourites", BookIDs: []int{1}}},
+	}
+}
+
+func TestZipRoundTrip(t *testing.T) {
+	exported := testExport()
+	var buf bytes.Buffer
+	if err := WriteZip(&buf, exported.ExportedAt, store.NewExportReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Books) != 1 || got.Books[0].Title != "Dune" || !got.Books[0].Read || len(got.Books[0].Tags) != 1 {
+		t.Errorf("read back %+v", got.Books)
+	}
+	if len(got.Shelves) != 1 || len(got.Shelves[0].BookIDs) != 1 {
+		t.Errorf("read back %+v", got.Shelves)
+	}
+	if err := Validate(got); err != nil {
+		t.Errorf("read back archive is invalid: %v", err)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	exported := testExport()
+	settings := models.UserSettings{DefaultLendingDays: 21}
+	exported.UserSettings = &settings
+	var buf bytes.Buffer
+	if err := WriteJSON(&buf, exported.ExportedAt, store.NewExportReader(exported)); err != nil {
+		t.Fatal(err)
+	}
+	var got models.Export
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("%v in %s", err, buf.String())
+	}
+	if got.Version != models.ExportVersion || !got.ExportedAt.Equal(exported.ExportedAt) {
+		t.Errorf("read back version %d exported at %v", got.Version, got.ExportedAt)
+	}
+	if len(got.Books) != 1 || got.Books[0].Title != "Dune" || len(got.Shelves) != 1 || got.UserSettings == nil || got.UserSettings.DefaultLendingDays != 21 {
+		t.Errorf("read back %+v", got)
+	}
+	// Empty tables are empty lists rather than null, as before
+	if got.Lending == nil || got.Notes == nil {
+		t.Errorf("empty tables read back as null in %s", buf.String())
+	}
+	if err := Validate(&got); err != nil {
+		t.Errorf("read back archive is invalid: %v", err)
+	}
+}
+
+func TestReadZipRejectsLargeEntries(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create(manifestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"version":1}`))
+	// Zeros compress to a small fraction of their size
+	f, err = zw.Create("books.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, maxEntrySize+1))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadZip(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestOpenEntryEnforcesBudget(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	f, err := zw.Create("books.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("id,title\n1,Dune\n2,Emma\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Less is left of the budget than the entry holds, whatever its header
+	// says
+	budget := int64(10)
+	rows := 0
+	err = readTable(zr.File[0], &budget, func(row tableRow) error {
+		rows++
+		return nil
+	})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v after %d rows, want ErrTooLarge", err, rows)
+	}
+}
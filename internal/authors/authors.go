@@ -0,0 +1,150 @@
+// Package authors splits and normalizes the people credited on a book.
+package authors
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+
+	"booklib/internal/models"
+)
+
+// ErrInvalidRole is returned for a credit whose role is not one of
+// models.AuthorRoles.
+var ErrInvalidRole = errors.New("invalid author role")
+
+// separators always divide names, unlike commas which also separate a
+// surname from given names.
+var separators = regexp.MustCompile(`\s*(?:;|&|\s+and\s+)\s*`)
+
+// suffixes stay with the name before them.
+var suffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true,
+}
+
+// Split splits a combined author string, such as the comma-joined list
+// metadata providers return, into individual names. "Surname, Given" with
+// a one-word surname is kept as a single name, as are suffixes such as
+// "Jr." with the name before them.
+func Split(s string) []string {
+	var names []string
+	for _, group := range separators.Split(s, -1) {
+		parts, suffix := cutSuffixes(splitTrim(group, ","))
+		if len(parts) == 2 && !strings.Contains(parts[0], " ") {
+			parts = []string{parts[0] + ", " + parts[1]}
+		}
+		for _, part := range parts {
+			if isSuffix(part) && len(names) > 0 {
+				names[len(names)-1] += ", " + part
+				continue
+			}
+			names = append(names, part)
+		}
+		if len(names) > 0 {
+			names[len(names)-1] += suffix
+		}
+	}
+	return names
+}
+
+// cutSuffixes removes the suffixes at the end of a name's comma-separated
+// parts and returns them as a string to append back.
+func cutSuffixes(parts []string) ([]string, string) {
+	suffix := ""
+	for len(parts) > 1 && isSuffix(parts[len(parts)-1]) {
+		suffix = ", " + parts[len(parts)-1] + suffix
+		parts = parts[:len(parts)-1]
+	}
+	return parts, suffix
+}
+
+func splitTrim(s, sep string) []string {
+	var parts []string
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func isSuffix(part string) bool {
+	return suffixes[strings.ToLower(strings.TrimSuffix(part, "."))]
+}
+
+// Key returns the form names are matched by: lowercase words without
+// punctuation, with "Surname, Given" turned around, so "Tolkien, J.R.R."
+// and "J. R. R. Tolkien" are the same author.
+func Key(name string) string {
+	if parts, suffix := cutSuffixes(splitTrim(name, ",")); len(parts) == 2 {
+		name = parts[1] + " " + parts[0] + suffix
+	}
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// Normalize makes a book's credits and author string agree. A book without
+// credits gets one author credit per name in its author string; otherwise
+// its author string is rebuilt from the credits. Names are trimmed, roles
+// default to author and repeated credits are dropped.
+func Normalize(book *models.Book) error {
+	if len(book.Authors) == 0 {
+		for _, name := range Split(book.Author) {
+			book.Authors = append(book.Authors, models.BookAuthor{Name: name, Role: models.RoleAuthor})
+		}
+	}
+
+	credits := make([]models.BookAuthor, 0, len(book.Authors))
+	seen := make(map[string]bool)
+	for _, credit := range book.Authors {
+		credit.Name = strings.Join(strings.Fields(credit.Name), " ")
+		if credit.Role == "" {
+			credit.Role = models.RoleAuthor
+		}
+		if !slices.Contains(models.AuthorRoles, credit.Role) {
+			return ErrInvalidRole
+		}
+		key := Key(credit.Name) + "\x00" + credit.Role
+		if credit.Name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		credits = append(credits, credit)
+	}
+	book.Authors = credits
+	book.Author = Display(credits)
+	return nil
+}
+
+// Display returns the author string for credits: the names credited as
+// author, or every name when no one is, joined by Join.
+func Display(credits []models.BookAuthor) string {
+	var names, all []string
+	for _, credit := range credits {
+		all = append(all, credit.Name)
+		if credit.Role == models.RoleAuthor {
+			names = append(names, credit.Name)
+		}
+	}
+	if len(names) == 0 {
+		names = all
+	}
+	return Join(names)
+}
+
+// Join combines names into one author string that Split takes apart
+// again. Names are joined with commas, or with semicolons when a comma
+// could be mistaken for the one in "Surname, Given".
+func Join(names []string) string {
+	sep := ", "
+	for _, name := range names {
+		if strings.Contains(name, ",") || !strings.Contains(strings.TrimSpace(name), " ") {
+			sep = "; "
+		}
+	}
+	return strings.Join(names, sep)
+}
@@ -0,0 +1,166 @@
+package authors
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Frank Herbert", []string{"Frank Herbert"}},
+		{"", nil},
+		{" ; ", nil},
+		{"  Frank   Herbert ;; ", []string{"Frank Herbert"}},
+		{"Terry Pratchett, Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Frank Herbert, Brian Herbert, Kevin J. Anderson", []string{"Frank Herbert", "Brian Herbert", "Kevin J. Anderson"}},
+		{"Terry Pratchett & Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Terry Pratchett and Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		// "and" only separates as a word of its own
+		{"Sandra Andrews", []string{"Sandra Andrews"}},
+		{"Tolkien, J.R.R.", []string{"Tolkien, J.R.R."}},
+		{"Herbert, Frank; Anderson, Kevin J.", []string{"Herbert, Frank", "Anderson, Kevin J."}},
+		// A surname of more than one word reads as a name of its own
+		{"García Márquez, Gabriel", []string{"García Márquez", "Gabriel"}},
+		{"Martin Luther King, Jr.", []string{"Martin Luther King, Jr."}},
+		{"King, Martin Luther, Jr.", []string{"King, Martin Luther, Jr."}},
+		{"Martin Luther King, Jr., Coretta Scott King", []string{"Martin Luther King, Jr.", "Coretta Scott King"}},
+		{"Henry Louis Gates, Jr., PhD", []string{"Henry Louis Gates, Jr., PhD"}},
+		{"Austen, Jane & Brontë, Charlotte", []string{"Austen, Jane", "Brontë, Charlotte"}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Frank Herbert", "frank herbert"},
+		{"  FRANK  herbert ", "frank herbert"},
+		{"Tolkien, J.R.R.", "j r r tolkien"},
+		{"J. R. R. Tolkien", "j r r tolkien"},
+		{"Martin Luther King, Jr.", "martin luther king jr"},
+		{"King, Martin Luther, Jr.", "martin luther king jr"},
+		{"Gabriel García Márquez", "gabriel garcía márquez"},
+		{"Ursula K. Le Guin", "ursula k le guin"},
+		{"", ""},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.in); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"Frank Herbert"}, "Frank Herbert"},
+		{[]string{"Terry Pratchett", "Neil Gaiman"}, "Terry Pratchett, Neil Gaiman"},
+		// A comma would read as "Surname, Given"
+		{[]string{"Tolkien, J.R.R.", "Christopher Tolkien"}, "Tolkien, J.R.R.; Christopher Tolkien"},
+		{[]string{"Homer", "Emily Wilson"}, "Homer; Emily Wilson"},
+	}
+	for _, tt := range tests {
+		got := Join(tt.names)
+		if got != tt.want {
+			t.Errorf("Join(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+		// What Join puts together Split takes apart
+		if back := Split(got); !slices.Equal(back, tt.names) {
+			t.Errorf("Split(Join(%q)) = %q", tt.names, back)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name        string
+		book        models.Book
+		wantAuthor  string
+		wantCredits []models.BookAuthor
+	}{
+		{
+			name:       "credits from the author string",
+			book:       models.Book{Author: "Terry Pratchett & Neil Gaiman"},
+			wantAuthor: "Terry Pratchett, Neil Gaiman",
+			wantCredits: []models.BookAuthor{
+				{Name: "Terry Pratchett", Role: models.RoleAuthor},
+				{Name: "Neil Gaiman", Role: models.RoleAuthor},
+			},
+		},
+		{
+			name: "author string from the credits",
+			book: models.Book{Author: "ignored", Authors: []models.BookAuthor{
+				{Name: "  Homer "},
+				{Name: "Emily  Wilson", Role: models.RoleTranslator},
+			}},
+			wantAuthor: "Homer",
+			wantCredits: []models.BookAuthor{
+				{Name: "Homer", Role: models.RoleAuthor},
+				{Name: "Emily Wilson", Role: models.RoleTranslator},
+			},
+		},
+		{
+			name: "repeated and blank credits",
+			book: models.Book{Authors: []models.BookAuthor{
+				{Name: "Tolkien, J.R.R."},
+				{Name: "J. R. R. Tolkien", Role: models.RoleAuthor},
+				{Name: "J.R.R. Tolkien", Role: models.RoleIllustrator},
+				{Name: " "},
+			}},
+			wantAuthor: "Tolkien, J.R.R.",
+			wantCredits: []models.BookAuthor{
+				{Name: "Tolkien, J.R.R.", Role: models.RoleAuthor},
+				{Name: "J.R.R. Tolkien", Role: models.RoleIllustrator},
+			},
+		},
+		{
+			name: "no one credited as author",
+			book: models.Book{Authors: []models.BookAuthor{
+				{Name: "Christopher Tolkien", Role: models.RoleEditor},
+				{Name: "Alan Lee", Role: models.RoleIllustrator},
+			}},
+			wantAuthor: "Christopher Tolkien, Alan Lee",
+			wantCredits: []models.BookAuthor{
+				{Name: "Christopher Tolkien", Role: models.RoleEditor},
+				{Name: "Alan Lee", Role: models.RoleIllustrator},
+			},
+		},
+		{
+			name:        "no authors",
+			book:        models.Book{},
+			wantAuthor:  "",
+			wantCredits: []models.BookAuthor{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := tt.book
+			if err := Normalize(&book); err != nil {
+				t.Fatal(err)
+			}
+			if book.Author != tt.wantAuthor || !slices.Equal(book.Authors, tt.wantCredits) {
+				t.Errorf("got %q, %+v; want %q, %+v", book.Author, book.Authors, tt.wantAuthor, tt.wantCredits)
+			}
+		})
+	}
+
+	book := models.Book{Authors: []models.BookAuthor{{Name: "Frank Herbert", Role: "ghostwriter"}}}
+	if err := Normalize(&book); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("unknown role: %v, want ErrInvalidRole", err)
+	}
+}
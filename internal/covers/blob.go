@@ -0,0 +1,88 @@
+package covers
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a blob or cover does not exist.
+var ErrNotFound = errors.New("cover not found")
+
+// BlobStore keeps cover images under slash-separated keys.
+type BlobStore interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put stores data under key, replacing any earlier value.
+	Put(ctx context.Context, key string, data []byte) error
+	// Delete removes key and every key below it. Missing keys are not an
+	// error.
+	Delete(ctx context.Context, key string) error
+}
+
+// DiskStore is a BlobStore that keeps each blob in a file below Dir.
+type DiskStore struct {
+	Dir string
+}
+
+func NewDiskStore(dir string) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &DiskStore{Dir: dir}, nil
+}
+
+func (s *DiskStore) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if clean == "." || filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", errors.New("invalid blob key " + key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s *DiskStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+// Put writes to a temporary file first so readers never see a partial
+// image.
+func (s *DiskStore) Put(ctx context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *DiskStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
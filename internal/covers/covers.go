@@ -0,0 +1,396 @@
+// Package covers keeps local copies of book cover images. Covers are
+// downloaded once, re-encoded as JPEG in a few thumbnail sizes and stored in
+// a BlobStore, so clients never load them from the original host.
+package covers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Size is a stored rendition of a cover, scaled down to at most Width
+// pixels wide.
+type Size struct {
+	Name  string
+	Width int
+}
+
+// Sizes lists the renditions stored for every cover.
+var Sizes = []Size{
+	{"small", 128},
+	{"medium", 256},
+	{"large", 512},
+}
+
+// DefaultSize is served when no size is requested.
+const DefaultSize = "medium"
+
+const (
+	// maxDownloadBytes caps the size of a downloaded cover.
+	maxDownloadBytes = 10 << 20
+	// maxPixels rejects images that would take too much memory to decode.
+	maxPixels = 40_000_000
+	// maxConcurrentFetches bounds the background downloads started by
+	// Prefetch.
+	maxConcurrentFetches = 4
+	// retryFailedAfter is how long a failed download is remembered.
+	retryFailedAfter = 10 * time.Minute
+	jpegQuality      = 85
+)
+
+var (
+	// ErrInvalidImage is returned for data that is not a supported image.
+	ErrInvalidImage = errors.New("not a supported image")
+	// ErrUnsupportedType is returned for uploads that are not JPEG, PNG or
+	// WebP.
+	ErrUnsupportedType = errors.New("cover must be a JPEG, PNG or WebP image")
+)
+
+// uploadSource is recorded as the source of covers uploaded by users.
+// Uploaded covers take precedence over the book's cover URL.
+const uploadSource = "upload"
+
+// MaxUploadBytes caps the size of an uploaded cover.
+const MaxUploadBytes = 10 << 20
+
+// Service downloads, stores and serves covers.
+type Service struct {
+	Store BlobStore
+	// Client fetches cover images. The default client refuses to connect
+	// to private and loopback addresses, since cover URLs come from users.
+	Client *http.Client
+
+	fetchesOnce sync.Once
+	fetches     chan struct{}
+
+	// saves serializes changes to stored covers, so a download can't
+	// replace an upload that landed while it ran.
+	saves sync.Mutex
+
+	mu sync.Mutex
+	// failed records when a URL last failed to download, so a broken link
+	// isn't retried on every request.
+	failed map[string]time.Time
+}
+
+func NewService(store BlobStore) *Service {
+	return &Service{Store: store, Client: publicClient()}
+}
+
+// publicClient returns an HTTP client that only dials public addresses.
+func publicClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+				return fmt.Errorf("refusing to fetch cover from %s", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Transport: transport, Timeout: 20 * time.Second}
+}
+
+func bookKey(bookID int) string {
+	return strconv.Itoa(bookID)
+}
+
+func sizeKey(bookID int, size string) string {
+	return bookKey(bookID) + "/" + size + ".jpg"
+}
+
+// sourceKey holds the URL a book's cover was downloaded from.
+func sourceKey(bookID int) string {
+	return bookKey(bookID) + "/source"
+}
+
+// ValidSize reports whether name is one of Sizes.
+func ValidSize(name string) bool {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns a stored rendition of the book's cover along with an ETag for
+// it. It returns ErrNotFound if the cover has not been stored.
+func (s *Service) Get(ctx context.Context, bookID int, size string) ([]byte, string, error) {
+	data, err := s.Store.Get(ctx, sizeKey(bookID, size))
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(data)
+	return data, `"` + hex.EncodeToString(sum[:12]) + `"`, nil
+}
+
+// Ensure downloads the cover at rawURL unless the book's stored cover was
+// already taken from it or was uploaded. A URL that failed recently is not
+// tried again until retryFailedAfter has passed.
+func (s *Service) Ensure(ctx context.Context, bookID int, rawURL string) error {
+	source, err := s.Store.Get(ctx, sourceKey(bookID))
+	if err == nil && (string(source) == rawURL || string(source) == uploadSource) {
+		return nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	s.mu.Lock()
+	failedAt, failed := s.failed[rawURL]
+	s.mu.Unlock()
+	if failed && time.Since(failedAt) < retryFailedAfter {
+		return fmt.Errorf("cover download from %s failed recently", rawURL)
+	}
+
+	err = s.Fetch(ctx, bookID, rawURL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil && ctx.Err() == nil {
+		if s.failed == nil {
+			s.failed = make(map[string]time.Time)
+		}
+		s.failed[rawURL] = time.Now()
+	} else {
+		delete(s.failed, rawURL)
+	}
+	return err
+}
+
+// Fetch downloads the cover at rawURL and stores it for the book, replacing
+// any earlier downloaded cover. An uploaded cover is kept.
+func (s *Service) Fetch(ctx context.Context, bookID int, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid cover URL %q", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "booklib")
+
+	client := s.Client
+	if client == nil {
+		client = publicClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("cover download returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxDownloadBytes {
+		return fmt.Errorf("cover is larger than %d bytes", maxDownloadBytes)
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	return s.Save(ctx, bookID, img, rawURL)
+}
+
+// Decode decodes a JPEG, PNG, GIF or WebP image, refusing images with too
+// many pixels before decoding them.
+func Decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d is too large", ErrInvalidImage, config.Width, config.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+	return img, nil
+}
+
+// Upload stores a user's cover image for the book, replacing any
+// downloaded cover. The type is sniffed from the data rather than trusted
+// from the client. Re-encoding drops EXIF and other metadata, so a JPEG's
+// orientation is applied to the pixels first.
+func (s *Service) Upload(ctx context.Context, bookID int, data []byte) error {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/webp":
+	default:
+		return ErrUnsupportedType
+	}
+
+	img, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	if orientation := jpegOrientation(data); orientation != 1 {
+		// Rotating is done pixel by pixel, so shrink large photos first
+		img = orient(shrink(img, 2*Sizes[len(Sizes)-1].Width), orientation)
+	}
+	return s.Save(ctx, bookID, img, uploadSource)
+}
+
+// RemoveUpload deletes the book's uploaded cover, so its cover URL is used
+// again. It returns ErrNotFound if the book has no uploaded cover.
+func (s *Service) RemoveUpload(ctx context.Context, bookID int) error {
+	s.saves.Lock()
+	defer s.saves.Unlock()
+	source, err := s.Store.Get(ctx, sourceKey(bookID))
+	if err != nil {
+		return err
+	}
+	if string(source) != uploadSource {
+		return ErrNotFound
+	}
+	return s.Store.Delete(ctx, bookKey(bookID))
+}
+
+// RemoveDownload deletes the book's cover if it was downloaded, for books
+// whose cover URL was cleared. An uploaded cover is kept.
+func (s *Service) RemoveDownload(ctx context.Context, bookID int) error {
+	s.saves.Lock()
+	defer s.saves.Unlock()
+	source, err := s.Store.Get(ctx, sourceKey(bookID))
+	if errors.Is(err, ErrNotFound) || (err == nil && string(source) == uploadSource) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, bookKey(bookID))
+}
+
+// Save stores every rendition of img as the book's cover and records
+// source as where it came from. A downloaded image doesn't replace an
+// uploaded cover, which may have been stored while it was being fetched.
+func (s *Service) Save(ctx context.Context, bookID int, img image.Image, source string) error {
+	renditions := make([][]byte, len(Sizes))
+	for i, size := range Sizes {
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resize(img, size.Width), &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return err
+		}
+		renditions[i] = buf.Bytes()
+	}
+
+	s.saves.Lock()
+	defer s.saves.Unlock()
+	if source != uploadSource {
+		stored, err := s.Store.Get(ctx, sourceKey(bookID))
+		if err == nil && string(stored) == uploadSource {
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	for i, size := range Sizes {
+		if err := s.Store.Put(ctx, sizeKey(bookID, size.Name), renditions[i]); err != nil {
+			return err
+		}
+	}
+	return s.Store.Put(ctx, sourceKey(bookID), []byte(source))
+}
+
+// resize scales img down to at most width pixels wide, keeping its aspect
+// ratio, onto a white background so transparent areas don't turn black in
+// the JPEG. Smaller images are not enlarged.
+func resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > width {
+		h = max(1, h*width/w)
+		w = width
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// shrink scales img down to fit in a side by side square, keeping its
+// transparency.
+func shrink(img image.Image, side int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= side && h <= side {
+		return img
+	}
+	if w >= h {
+		w, h = side, max(1, h*side/w)
+	} else {
+		w, h = max(1, w*side/h), side
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Delete removes the book's stored cover.
+func (s *Service) Delete(ctx context.Context, bookID int) error {
+	s.saves.Lock()
+	defer s.saves.Unlock()
+	return s.Store.Delete(ctx, bookKey(bookID))
+}
+
+// Prefetch downloads the book's cover in the background, so it is stored
+// by the time a client asks for it. At most a few downloads run at once;
+// failures are only logged since Get's callers can retry with Ensure.
+func (s *Service) Prefetch(bookID int, rawURL string) {
+	if rawURL == "" {
+		return
+	}
+	s.fetchesOnce.Do(func() { s.fetches = make(chan struct{}, maxConcurrentFetches) })
+	go func() {
+		s.fetches <- struct{}{}
+		defer func() { <-s.fetches }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.Ensure(ctx, bookID, rawURL); err != nil {
+			log.Printf("Failed to fetch cover for book %d: %v", bookID, err)
+		}
+	}()
+}
@@ -0,0 +1,152 @@
+package covers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	store, err := NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewService(store)
+}
+
+// storedSize decodes the stored small rendition of the book's cover.
+func storedSize(t *testing.T, s *Service, bookID int) image.Rectangle {
+	t.Helper()
+	data, _, err := s.Get(context.Background(), bookID, "small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.Bounds()
+}
+
+func TestUpload(t *testing.T) {
+	ctx := context.Background()
+	img := image.NewPaletted(image.Rect(0, 0, 40, 20), color.Palette{color.White, color.Black})
+	var pngData, gifData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := gif.Encode(&gifData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	jpegData := testJPEG(t, 40, 20)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"PNG", pngData.Bytes(), nil},
+		{"JPEG", jpegData, nil},
+		{"GIF", gifData.Bytes(), ErrUnsupportedType},
+		{"text", []byte("not an image"), ErrUnsupportedType},
+		{"HTML", []byte("<html><body><img src=x></body></html>"), ErrUnsupportedType},
+		{"empty", nil, ErrUnsupportedType},
+		{"JPEG header only", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10}, ErrInvalidImage},
+		{"truncated JPEG", jpegData[:len(jpegData)/2], ErrInvalidImage},
+		{"truncated PNG", pngData.Bytes()[:40], ErrInvalidImage},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			err := s.Upload(ctx, i+1, tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Upload = %v, want %v", err, tt.err)
+			}
+			_, _, err = s.Get(ctx, i+1, "small")
+			if tt.err != nil && !errors.Is(err, ErrNotFound) {
+				t.Errorf("rejected upload was stored: %v", err)
+			}
+			if tt.err == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := storedSize(t, s, i+1); got.Dx() != 40 || got.Dy() != 20 {
+					t.Errorf("stored a %dx%d cover, want 40x20", got.Dx(), got.Dy())
+				}
+			}
+		})
+	}
+}
+
+func TestUploadAppliesOrientation(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	plain := testJPEG(t, 40, 20)
+	for orientation, want := range map[uint16]image.Point{1: {40, 20}, 3: {40, 20}, 6: {20, 40}, 8: {20, 40}} {
+		for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+			data := withSegments(plain, exifSegment(tiffHeader(order, orientation)))
+			if err := s.Upload(ctx, 1, data); err != nil {
+				t.Fatal(err)
+			}
+			if got := storedSize(t, s, 1).Size(); got != want {
+				t.Errorf("orientation %d (%v): stored %v, want %v", orientation, order, got, want)
+			}
+		}
+	}
+
+	// A malformed EXIF segment leaves the image as it is
+	data := withSegments(plain, exifSegment([]byte("MM\x00\x2a\xff\xff\xff\xff")))
+	if err := s.Upload(ctx, 2, data); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedSize(t, s, 2).Size(); got != (image.Point{40, 20}) {
+		t.Errorf("malformed EXIF: stored %v, want 40x20", got)
+	}
+}
+
+func TestDownloadKeepsUpload(t *testing.T) {
+	ctx := context.Background()
+	s := newTestService(t)
+	requested := make(chan struct{}, 2)
+	release := make(chan struct{})
+	downloaded := testJPEG(t, 60, 30)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested <- struct{}{}
+		<-release
+		w.Write(downloaded)
+	}))
+	defer server.Close()
+	s.Client = server.Client()
+
+	// The user uploads a cover while the book's cover URL is downloading
+	done := make(chan error)
+	go func() { done <- s.Ensure(ctx, 1, server.URL+"/cover.jpg") }()
+	<-requested
+	if err := s.Upload(ctx, 1, testJPEG(t, 40, 20)); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := storedSize(t, s, 1); got.Dx() != 40 || got.Dy() != 20 {
+		t.Errorf("stored a %dx%d cover, want the 40x20 upload", got.Dx(), got.Dy())
+	}
+
+	// Without an upload the download is stored
+	if err := s.Fetch(ctx, 2, server.URL+"/cover.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if got := storedSize(t, s, 2); got.Dx() != 60 || got.Dy() != 30 {
+		t.Errorf("stored a %dx%d cover, want the 60x30 download", got.Dx(), got.Dy())
+	}
+}
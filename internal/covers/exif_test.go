@@ -0,0 +1,174 @@
+package covers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+)
+
+// tiffHeader returns a TIFF header whose first IFD holds an orientation
+// tag.
+func tiffHeader(order binary.AppendByteOrder, orientation uint16) []byte {
+	tiff := []byte("II")
+	if order == binary.BigEndian {
+		tiff = []byte("MM")
+	}
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = order.AppendUint16(tiff, 1)
+	// Tag, SHORT type, one value, the value padded to four bytes
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3)
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0)
+	return order.AppendUint32(tiff, 0)
+}
+
+// segment returns a JPEG marker segment carrying payload.
+func segment(marker byte, payload []byte) []byte {
+	s := []byte{0xFF, marker}
+	s = binary.BigEndian.AppendUint16(s, uint16(2+len(payload)))
+	return append(s, payload...)
+}
+
+// exifSegment returns an APP1 segment with the TIFF header.
+func exifSegment(tiff []byte) []byte {
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff...))
+}
+
+// testJPEG encodes a w by h JPEG whose top-left pixel is red.
+func testJPEG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withSegments inserts segments right after the JPEG's start of image.
+func withSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	plain := testJPEG(t, 4, 2)
+	jfif := segment(0xE0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"))
+	tests := []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"little endian", withSegments(plain, exifSegment(tiffHeader(binary.LittleEndian, 6))), 6},
+		{"big endian", withSegments(plain, exifSegment(tiffHeader(binary.BigEndian, 8))), 8},
+		{"after other segments", withSegments(plain, jfif, exifSegment(tiffHeader(binary.LittleEndian, 3))), 3},
+		{"no EXIF", plain, 1},
+		{"not a JPEG", []byte("\x89PNG\r\n\x1a\n"), 1},
+		{"empty", nil, 1},
+		{"orientation out of range", withSegments(plain, exifSegment(tiffHeader(binary.LittleEndian, 9))), 1},
+		{"APP1 that isn't EXIF", withSegments(plain, segment(0xE1, []byte("http://ns.adobe.com/xap/1.0/\x00"))), 1},
+		{"EXIF after start of scan", append(append([]byte{0xFF, 0xD8}, segment(0xDA, []byte{0})...), exifSegment(tiffHeader(binary.LittleEndian, 6))...), 1},
+		{"segment length below 2", withSegments(plain, []byte{0xFF, 0xE1, 0x00, 0x01}), 1},
+		{"segment past the end", []byte{0xFF, 0xD8, 0xFF, 0xE1, 0x10, 0x00, 'E', 'x'}, 1},
+		{"garbage between segments", withSegments(plain, []byte{0x00}, exifSegment(tiffHeader(binary.LittleEndian, 6))), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := jpegOrientation(tt.data); got != tt.want {
+				t.Errorf("jpegOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJPEGOrientationTruncated(t *testing.T) {
+	data := withSegments(testJPEG(t, 4, 2), exifSegment(tiffHeader(binary.BigEndian, 6)))
+	exifEnd := 2 + len(exifSegment(tiffHeader(binary.BigEndian, 6)))
+	for n := range len(data) {
+		want := 1
+		if n >= exifEnd {
+			want = 6
+		}
+		if got := jpegOrientation(data[:n]); got != want {
+			t.Errorf("first %d bytes: orientation %d, want %d", n, got, want)
+		}
+	}
+}
+
+func TestTIFFOrientation(t *testing.T) {
+	valid := tiffHeader(binary.LittleEndian, 5)
+	pastEnd := tiffHeader(binary.LittleEndian, 5)
+	binary.LittleEndian.PutUint32(pastEnd[4:], uint32(len(pastEnd)))
+	intoHeader := tiffHeader(binary.LittleEndian, 5)
+	binary.LittleEndian.PutUint32(intoHeader[4:], 4)
+	otherTag := tiffHeader(binary.LittleEndian, 5)
+	binary.LittleEndian.PutUint16(otherTag[10:], 0x0100)
+	tooMany := append([]byte{}, otherTag...)
+	binary.LittleEndian.PutUint16(tooMany[8:], 2)
+	tests := []struct {
+		name string
+		tiff []byte
+		want int
+	}{
+		{"valid", valid, 5},
+		{"unknown byte order", append([]byte("XX"), valid[2:]...), 1},
+		{"too short", valid[:7], 1},
+		{"IFD past the end", pastEnd, 1},
+		{"IFD inside the header", intoHeader, 1},
+		{"entry cut off", valid[:len(valid)-8], 1},
+		{"more entries than data", tooMany, 1},
+		{"no orientation tag", otherTag, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tiffOrientation(tt.tiff); got != tt.want {
+				t.Errorf("tiffOrientation = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 3 by 2 image with its top-left pixel marked
+	src := image.NewGray(image.Rect(0, 0, 3, 2))
+	src.SetGray(0, 0, color.Gray{Y: 255})
+	tests := []struct {
+		orientation int
+		w, h        int
+		x, y        int
+	}{
+		{1, 3, 2, 0, 0},
+		{2, 3, 2, 2, 0},
+		{3, 3, 2, 2, 1},
+		{4, 3, 2, 0, 1},
+		{5, 2, 3, 0, 0},
+		{6, 2, 3, 1, 0},
+		{7, 2, 3, 1, 2},
+		{8, 2, 3, 0, 2},
+	}
+	for _, tt := range tests {
+		got := orient(src, tt.orientation)
+		if b := got.Bounds(); b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: %dx%d, want %dx%d", tt.orientation, b.Dx(), b.Dy(), tt.w, tt.h)
+			continue
+		}
+		if r, _, _, _ := got.At(tt.x, tt.y).RGBA(); r == 0 {
+			t.Errorf("orientation %d: marked pixel isn't at (%d, %d)", tt.orientation, tt.x, tt.y)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package dialect
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    string
+	}{
+		{
+			"sqlite keeps placeholders",
+			SQLite,
+			"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
+			"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
+		},
+		{
+			"no placeholders",
+			Postgres,
+			"SELECT COUNT(*) FROM books",
+			"SELECT COUNT(*) FROM books",
+		},
+		{
+			"numbered in order",
+			Postgres,
+			"UPDATE books SET title = ?, author = ? WHERE id = ? AND user_id = ?",
+			"UPDATE books SET title = $1, author = $2 WHERE id = $3 AND user_id = $4",
+		},
+		{
+			"string literal",
+			Postgres,
+			"SELECT id FROM books WHERE title = 'Why?' AND id = ?",
+			"SELECT id FROM books WHERE title = 'Why?' AND id = $1",
+		},
+		{
+			"escaped quote in string literal",
+			Postgres,
+			"SELECT ? FROM books WHERE title = 'Who''s there?' AND id = ?",
+			"SELECT $1 FROM books WHERE title = 'Who''s there?' AND id = $2",
+		},
+		{
+			"quoted identifier",
+			Postgres,
+			`SELECT "what?" FROM books WHERE id = ?`,
+			`SELECT "what?" FROM books WHERE id = $1`,
+		},
+		{
+			"double quote inside string literal",
+			Postgres,
+			`SELECT id FROM books WHERE title = 'say "hi?"' AND id = ?`,
+			`SELECT id FROM books WHERE title = 'say "hi?"' AND id = $1`,
+		},
+		{
+			"adjacent placeholders",
+			Postgres,
+			"INSERT INTO t VALUES (?,?,?)",
+			"INSERT INTO t VALUES ($1,$2,$3)",
+		},
+		{
+			"more than nine",
+			Postgres,
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.dialect.Rebind(tt.query); got != tt.want {
+				t.Errorf("Rebind(%q)\n got %q\nwant %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		dialect Dialect
+		dsn     string
+	}{
+		{"postgres://u:p@localhost/booklib", Postgres, "postgres://u:p@localhost/booklib"},
+		{"postgresql://localhost/booklib?sslmode=disable", Postgres, "postgresql://localhost/booklib?sslmode=disable"},
+		{"sqlite://./database/booklib.db", SQLite, "./database/booklib.db"},
+		{"./database/booklib.db", SQLite, "./database/booklib.db"},
+	}
+	for _, tt := range tests {
+		dialect, dsn := FromURL(tt.url)
+		if dialect != tt.dialect || dsn != tt.dsn {
+			t.Errorf("FromURL(%q) = %s, %q; want %s, %q", tt.url, dialect, dsn, tt.dialect, tt.dsn)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package fuzzy compares the titles and names of books that are spelled
+// slightly differently in different places.
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+
+	"booklib/internal/authors"
+)
+
+// Normalize lowercases text and reduces it to its words, dropping
+// punctuation and a leading article.
+func Normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 1 && (words[0] == "the" || words[0] == "a" || words[0] == "an") {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// Similarity returns 1 less the edit distance between a and b relative to
+// the longer of them, from 0 for nothing in common to 1 for equal strings.
+// An empty string is similar to nothing, not even another empty string.
+func Similarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	ra, rb := []rune(a), []rune(b)
+	return 1 - float64(distance(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+// AuthorSimilarity returns how closely any of the names in one author
+// string matches any in the other, comparing them by authors.Key so
+// "Herbert, Frank" and "Frank Herbert" are the same.
+func AuthorSimilarity(a, b string) float64 {
+	best := 0.0
+	for _, nameA := range authors.Split(a) {
+		for _, nameB := range authors.Split(b) {
+			best = max(best, Similarity(authors.Key(nameA), authors.Key(nameB)))
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			prev, row[j] = row[j], min(row[j]+1, row[j-1]+1, prev+cost)
+		}
+	}
+	return row[len(b)]
+}
@@ -0,0 +1,40 @@
+package fuzzy
+
+import "testing"
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"dune", "dune", 1},
+		{"dune", "dune mess", 1 - 5.0/9},
+		{"kitten", "sitting", 1 - 3.0/7},
+		{"émile", "emile", 0.8},
+		{"", "dune", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if got := Similarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := Similarity(tt.b, tt.a); got != tt.want {
+			t.Errorf("Similarity(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"The Left Hand of Darkness", "left hand of darkness"},
+		{"A Wizard of Earthsea", "wizard of earthsea"},
+		{"The", "the"},
+		{"Dune: Deluxe Edition!", "dune deluxe edition"},
+		{"  Emma  ", "emma"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestAdminRequiresAdmin(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.createUser("reader", "user")
+	for _, tt := range []struct {
+		method, path, body string
+	}{
+		{"GET", "/api/admin/stats", ""},
+		{"GET", "/api/admin/users", ""},
+		{"GET", fmt.Sprintf("/api/admin/users/%d", user), ""},
+		{"DELETE", fmt.Sprintf("/api/admin/users/%d", user), ""},
+		{"PUT", fmt.Sprintf("/api/admin/users/%d/role", user), `{"role":"admin"}`},
+		{"GET", "/api/admin/settings", ""},
+		{"PUT", "/api/admin/settings", `{"key":"registration_enabled","value":"false"}`},
+		{"GET", "/api/admin/isbn-cache", ""},
+	} {
+		if code := api.do(user, tt.method, tt.path, tt.body, nil); code != http.StatusForbidden {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, code, http.StatusForbidden)
+		}
+	}
+
+	// Nothing was changed on the way
+	if got, err := api.stores.Users.Get(t.Context(), user); err != nil || got.Role != "user" {
+		t.Errorf("user after rejected requests: %+v, %v", got, err)
+	}
+}
+
+func TestAdminUsers(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	reader := api.createUser("reader", "user")
+	api.createBook(reader, `{"title":"Dune"}`)
+	api.createBook(admin, `{"title":"Emma"}`)
+
+	var stats models.AdminStats
+	if code := api.do(admin, "GET", "/api/admin/stats", "", &stats); code != http.StatusOK {
+		t.Fatalf("stats: got %d", code)
+	}
+	if stats.TotalUsers != 2 || stats.TotalBooks != 2 {
+		t.Errorf("stats: %d users, %d books", stats.TotalUsers, stats.TotalBooks)
+	}
+
+	var users []models.UserWithStats
+	if code := api.do(admin, "GET", "/api/admin/users", "", &users); code != http.StatusOK || len(users) != 2 {
+		t.Fatalf("listing: got %d, %d users", code, len(users))
+	}
+
+	var detail struct {
+		User  models.User   `json:"user"`
+		Books []models.Book `json:"books"`
+	}
+	path := fmt.Sprintf("/api/admin/users/%d", reader)
+	if code := api.do(admin, "GET", path, "", &detail); code != http.StatusOK {
+		t.Fatalf("getting user: got %d", code)
+	}
+	if detail.User.Username != "reader" || len(detail.Books) != 1 || detail.Books[0].Title != "Dune" {
+		t.Errorf("user detail %+v", detail)
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"GET", "/api/admin/users/abc", "", http.StatusBadRequest},
+		{"GET", "/api/admin/users/999", "", http.StatusNotFound},
+		{"DELETE", "/api/admin/users/abc", "", http.StatusBadRequest},
+		{"DELETE", "/api/admin/users/999", "", http.StatusNotFound},
+		{"PUT", "/api/admin/users/abc/role", `{"role":"admin"}`, http.StatusBadRequest},
+		{"PUT", path + "/role", `{`, http.StatusBadRequest},
+		{"PUT", path + "/role", `{"role":"owner"}`, http.StatusBadRequest},
+		{"PUT", "/api/admin/users/999/role", `{"role":"admin"}`, http.StatusNotFound},
+	} {
+		if code := api.do(admin, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s %s: got %d, want %d", tt.method, tt.path, tt.body, code, tt.want)
+		}
+	}
+
+	// A promoted user can reach the admin routes
+	if code := api.do(admin, "PUT", path+"/role", `{"role":"admin"}`, nil); code != http.StatusOK {
+		t.Fatalf("promoting: got %d", code)
+	}
+	if code := api.do(reader, "GET", "/api/admin/users", "", nil); code != http.StatusOK {
+		t.Errorf("promoted user: got %d", code)
+	}
+
+	// Deleting a user takes their books with them
+	if code := api.do(admin, "DELETE", path, "", nil); code != http.StatusOK {
+		t.Fatalf("deleting: got %d", code)
+	}
+	if code := api.do(admin, "GET", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("deleted user: got %d, want %d", code, http.StatusNotFound)
+	}
+	if books, err := api.stores.Books.List(t.Context(), reader); err != nil || len(books) != 0 {
+		t.Errorf("deleted user's books: %d, %v", len(books), err)
+	}
+}
+
+func TestAdminSettings(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+
+	if code := api.do(admin, "PUT", "/api/admin/settings", `{"key":"registration_enabled","value":"false"}`, nil); code != http.StatusOK {
+		t.Fatalf("updating: got %d", code)
+	}
+	var settings map[string]string
+	if code := api.do(admin, "GET", "/api/admin/settings", "", &settings); code != http.StatusOK {
+		t.Fatalf("listing: got %d", code)
+	}
+	if len(settings) != 1 || settings["registration_enabled"] != "false" {
+		t.Errorf("settings %v", settings)
+	}
+
+	for _, body := range []string{`{`, `{"value":"true"}`} {
+		if code := api.do(admin, "PUT", "/api/admin/settings", body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+}
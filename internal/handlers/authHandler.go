@@ -1,23 +1,24 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"booklib/internal/middleware"
 	"booklib/internal/models"
 	"booklib/internal/services"
+	"booklib/internal/store"
 )
 
 type AuthHandler struct {
-	DB *sql.DB
+	Users    store.UserStore
+	Settings store.SettingsStore
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Check if registration is enabled
-	var registrationEnabled string
-	err := h.DB.QueryRow("SELECT value FROM settings WHERE key = 'registration_enabled'").Scan(&registrationEnabled)
+	registrationEnabled, err := h.Settings.GetAppSetting(r.Context(), "registration_enabled")
 	if err == nil && registrationEnabled != "true" {
 		http.Error(w, `{"error":"Registration is currently disabled"}`, http.StatusForbidden)
 		return
@@ -35,24 +36,22 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.DB.Exec(
-		"INSERT INTO users (username, email, password_hash, role) VALUES (?, ?, ?, 'user')",
-		req.Username,
-		req.Email,
-		hash,
-	)
-
-	if err != nil {
+	user := models.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		PasswordHash: hash,
+		Role:         "user",
+	}
+	err = h.Users.Create(r.Context(), &user)
+	if errors.Is(err, store.ErrConflict) {
 		http.Error(w, `{"error":"User already exists"}`, http.StatusConflict)
 		return
 	}
-
-	id, err := result.LastInsertId()
 	if err != nil {
-		http.Error(w, `{"error":"Failed to get user ID"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to create user"}`, http.StatusInternalServerError)
 		return
 	}
-	userID := int(id)
+	userID := user.ID
 
 	token, err := services.GenerateJWT(userID, req.Username, "user")
 	if err != nil {
@@ -92,16 +91,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var user models.User
-	err := h.DB.QueryRow(
-		"SELECT id, username, email, password_hash, role FROM users WHERE email = ?",
-		req.Email,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role)
-
-	if err == sql.ErrNoRows {
+	user, err := h.Users.GetByEmail(r.Context(), req.Email)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
 		return
 	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch user"}`, http.StatusInternalServerError)
+		return
+	}
 
 	if !services.CheckPassword(req.Password, user.PasswordHash) {
 		http.Error(w, `{"error":"Invalid credentials"}`, http.StatusUnauthorized)
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+)
+
+// session is a browser talking to the auth routes, keeping the auth cookie
+// between requests.
+type session struct {
+	api    *testAPI
+	client *http.Client
+}
+
+func (a *testAPI) newSession() *session {
+	a.t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return &session{api: a, client: &http.Client{Jar: jar}}
+}
+
+// do sends body, if not empty, and decodes the response into out, if not nil
+// and the request succeeded. It returns the status code.
+func (s *session) do(method, path, body string, out any) int {
+	t := s.api.t
+	t.Helper()
+	req, err := http.NewRequest(method, s.api.server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+type me struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func TestAuth(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.newSession()
+
+	if code := alice.do("GET", "/api/auth/me", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("before registering: got %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	body := `{"username":"alice","email":"alice@example.com","password":"correct horse"}`
+	if code := alice.do("POST", "/api/auth/register", body, nil); code != http.StatusOK {
+		t.Fatalf("registering: got %d", code)
+	}
+	var got me
+	if code := alice.do("GET", "/api/auth/me", "", &got); code != http.StatusOK {
+		t.Fatalf("me: got %d", code)
+	}
+	if got.ID == 0 || got.Username != "alice" || got.Role != "user" {
+		t.Errorf("me %+v", got)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"taken username", `{"username":"alice","email":"other@example.com","password":"secret"}`, http.StatusConflict},
+	} {
+		if code := api.newSession().do("POST", "/api/auth/register", tt.body, nil); code != tt.want {
+			t.Errorf("registering with %s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	// Logging out clears the cookie
+	if code := alice.do("POST", "/api/auth/logout", "", nil); code != http.StatusOK {
+		t.Fatalf("logging out: got %d", code)
+	}
+	if code := alice.do("GET", "/api/auth/me", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("after logging out: got %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"unknown email", `{"email":"bob@example.com","password":"correct horse"}`, http.StatusUnauthorized},
+		{"wrong password", `{"email":"alice@example.com","password":"battery staple"}`, http.StatusUnauthorized},
+	} {
+		if code := alice.do("POST", "/api/auth/login", tt.body, nil); code != tt.want {
+			t.Errorf("logging in with %s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	// The token carries the role the user has when logging in
+	if err := api.stores.Users.UpdateRole(context.Background(), got.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if code := alice.do("POST", "/api/auth/login", `{"email":"alice@example.com","password":"correct horse"}`, nil); code != http.StatusOK {
+		t.Fatalf("logging in: got %d", code)
+	}
+	if code := alice.do("GET", "/api/auth/me", "", &got); code != http.StatusOK || got.Username != "alice" || got.Role != "admin" {
+		t.Errorf("me after logging in: got %d, %+v", code, got)
+	}
+}
+
+func TestAuthBadToken(t *testing.T) {
+	api := newTestAPI(t)
+	req, err := http.NewRequest("GET", api.server.URL+"/api/auth/me", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: "auth_token", Value: "not-a-token"})
+	resp, err := api.server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestRegistrationDisabled(t *testing.T) {
+	api := newTestAPI(t)
+	if err := api.stores.Settings.SetAppSetting(context.Background(), "registration_enabled", "false"); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"username":"alice","email":"alice@example.com","password":"correct horse"}`
+	if code := api.newSession().do("POST", "/api/auth/register", body, nil); code != http.StatusForbidden {
+		t.Errorf("got %d, want %d", code, http.StatusForbidden)
+	}
+	if users, err := api.stores.Users.ListWithStats(context.Background()); err != nil || len(users) != 0 {
+		t.Errorf("users after rejected registration: %d, %v", len(users), err)
+	}
+
+	if err := api.stores.Settings.SetAppSetting(context.Background(), "registration_enabled", "true"); err != nil {
+		t.Fatal(err)
+	}
+	if code := api.newSession().do("POST", "/api/auth/register", body, nil); code != http.StatusOK {
+		t.Errorf("re-enabled: got %d", code)
+	}
+}
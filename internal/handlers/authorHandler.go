@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"booklib/internal/middleware"
+	"booklib/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type AuthorHandler struct {
+	Authors store.AuthorStore
+}
+
+// List returns the authors credited on the user's books with their book
+// counts. q filters by name.
+func (h *AuthorHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	list, err := h.Authors.List(r.Context(), userID, strings.TrimSpace(r.URL.Query().Get("q")))
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch authors"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Get returns an author's page: every book the user owns that credits
+// them, with their roles on it.
+func (h *AuthorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	authorID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid author ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	author, err := h.Authors.Get(r.Context(), userID, authorID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Author not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch author"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(author)
+}
@@ -1,47 +1,300 @@
 package handlers
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
-	"booklib/internal/api"
+	"booklib/internal/authors"
+	"booklib/internal/covers"
+	"booklib/internal/isbn"
 	"booklib/internal/middleware"
 	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/services"
+	"booklib/internal/store"
+	"booklib/internal/tags"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// normalizeBookISBN rewrites the book's ISBN to its canonical ISBN-13 form.
+// An empty ISBN is left alone since it is optional.
+func normalizeBookISBN(book *models.Book) error {
+	if isbn.Clean(book.ISBN) == "" {
+		book.ISBN = ""
+		return nil
+	}
+	normalized, err := isbn.Normalize(book.ISBN)
+	if err != nil {
+		return err
+	}
+	book.ISBN = normalized
+	return nil
+}
+
+// missingMetadata reports whether any field fillFromMetadata can fill is
+// empty.
+func missingMetadata(book *models.Book) bool {
+	return book.Title == "" || book.Author == "" || book.Genre == "" || book.CoverURL == "" ||
+		book.Description == "" || book.PageCount == 0 || book.Publisher == "" ||
+		book.PublishedDate == "" || book.Language == ""
+}
+
+// fillFromMetadata copies metadata into the book's empty fields, so values
+// the user supplied win.
+func fillFromMetadata(book *models.Book, meta *models.IsbnCache) {
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&book.Title, meta.Title)
+	fill(&book.Author, meta.Author)
+	if book.Genre == "" {
+		book.Genre, book.Genres = meta.Genre, slices.Clone(meta.Genres)
+	}
+	fill(&book.CoverURL, meta.CoverUrl)
+	fill(&book.Description, meta.Description)
+	fill(&book.Publisher, meta.Publisher)
+	fill(&book.PublishedDate, meta.PublishedDate)
+	fill(&book.Language, meta.Language)
+	if book.PageCount == 0 {
+		book.PageCount = meta.PageCount
+	}
+}
+
+// metadataResult is the response for one metadata lookup or search result.
+func metadataResult(meta *models.IsbnCache, alreadyOwned bool) map[string]interface{} {
+	return map[string]interface{}{
+		"isbn":           meta.ISBN,
+		"title":          meta.Title,
+		"author":         meta.Author,
+		"genre":          meta.Genre,
+		"genres":         meta.Genres,
+		"cover_url":      meta.CoverUrl,
+		"description":    meta.Description,
+		"page_count":     meta.PageCount,
+		"publisher":      meta.Publisher,
+		"published_date": meta.PublishedDate,
+		"language":       meta.Language,
+		"already_owned":  alreadyOwned,
+	}
+}
+
 type BookHandler struct {
-	DB *sql.DB
+	Books    store.BookStore
+	Metadata *services.MetadataService
+	Covers   *covers.Service
+}
+
+const (
+	// maxPageSize caps the limit parameter of List.
+	maxPageSize = 500
+)
+
+// bookCursor is the opaque pagination cursor handed to clients. It records
+// the sort order it was issued for so it can't be replayed against another.
+type bookCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Key  string `json:"k"`
+	ID   int    `json:"i"`
+}
+
+func encodeCursor(q store.BookQuery, next *store.BookCursor) string {
+	data, _ := json.Marshal(bookCursor{Sort: q.Sort, Desc: q.Desc, Key: next.Key, ID: next.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, q store.BookQuery) (*store.BookCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var c bookCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, errors.New("cursor was issued for a different sort order")
+	}
+	return &store.BookCursor{Key: c.Key, ID: c.ID}, nil
+}
+
+// parseDateParam parses a date or RFC 3339 timestamp. A bare date used as
+// an upper bound covers that whole day.
+func parseDateParam(value string, upper bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upper {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// parseBookQuery reads List's query parameters. It returns a message for
+// the client when one of them is invalid.
+func parseBookQuery(params url.Values) (store.BookQuery, string) {
+	q := store.BookQuery{
+		Sort:   params.Get("sort"),
+		Search: strings.TrimSpace(params.Get("q")),
+		Genre:  params.Get("genre"),
+		Author: params.Get("author"),
+		Tags:   tags.Dedupe(params["tag"]),
+	}
+
+	switch q.Sort {
+	case "":
+		q.Sort = store.SortCreatedAt
+		if q.Search != "" {
+			q.Sort = store.SortRank
+		}
+	case store.SortTitle, store.SortAuthor, store.SortCreatedAt:
+	case store.SortRank:
+		if q.Search == "" {
+			return q, "sort=rank requires q"
+		}
+	default:
+		return q, "sort must be title, author, created_at or rank"
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, "order must be asc or desc"
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, "limit must be between 1 and " + strconv.Itoa(maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if value := params.Get("author_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return q, "author_id must be a positive number"
+		}
+		q.AuthorID = id
+	}
+
+	if value := params.Get("shelf_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			return q, "shelf_id must be a positive number"
+		}
+		q.ShelfID = id
+	}
+
+	if q.Status = params.Get("status"); q.Status != "" && !reading.Valid(q.Status) {
+		return q, "status must be one of " + strings.Join(reading.Statuses, ", ")
+	}
+
+	flags := map[string]**bool{"read": &q.Read, "lent_out": &q.LentOut, "reading": &q.Reading, "started": &q.Started}
+	for name, dest := range flags {
+		if value := params.Get(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return q, name + " must be true or false"
+			}
+			*dest = &b
+		}
+	}
+
+	dates := []struct {
+		name  string
+		dest  *time.Time
+		upper bool
+	}{
+		{"added_from", &q.AddedFrom, false},
+		{"added_to", &q.AddedTo, true},
+		{"finished_from", &q.FinishedFrom, false},
+		{"finished_to", &q.FinishedTo, true},
+	}
+	for _, d := range dates {
+		if value := params.Get(d.name); value != "" {
+			t, err := parseDateParam(value, d.upper)
+			if err != nil {
+				return q, d.name + " must be a date (YYYY-MM-DD) or RFC 3339 timestamp"
+			}
+			*d.dest = t
+		}
+	}
+
+	if value := params.Get("cursor"); value != "" {
+		after, err := decodeCursor(value, q)
+		if err != nil {
+			return q, "invalid cursor"
+		}
+		q.After = after
+	}
+	return q, ""
 }
 
+// List returns the user's books. It accepts sort, order, limit and cursor
+// parameters for paging and read, status, lent_out, reading (a session in
+// progress), started (any session), genre, author, author_id, tag
+// (repeatable, matching books with every tag), shelf_id, added_from,
+// added_to, finished_from and finished_to filters. Without a limit every
+// matching book is returned. The total number of matches is sent in
+// X-Total-Count and the next page, if any, in a Link header.
+//
+// With q the books are searched by title, author, genre and notes, sorted
+// best match first unless another sort is given, and each result carries a
+// snippet of the matching text.
 func (h *BookHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
 
-	rows, err := h.DB.Query(
-		"SELECT id, title, author, isbn, genre, read, created_at FROM books WHERE user_id = ?",
-		userID,
-	)
+	q, problem := parseBookQuery(r.URL.Query())
+	if problem != "" {
+		http.Error(w, `{"error":"Invalid query: `+problem+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.Books.Query(r.Context(), userID, q)
 	if err != nil {
 		http.Error(w, `{"error":"Failed to fetch books"}`, http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	books := []models.Book{}
-	for rows.Next() {
-		var book models.Book
-		var readInt int
-		if err := rows.Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt, &book.CreatedAt); err != nil {
-			continue
-		}
-		book.Read = readInt == 1
-		books = append(books, book)
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.Next != nil {
+		next := *r.URL
+		params := next.Query()
+		params.Set("cursor", encodeCursor(q, page.Next))
+		next.RawQuery = params.Encode()
+		w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(books)
+	if q.Search == "" {
+		json.NewEncoder(w).Encode(page.Books)
+		return
+	}
+	matches := make([]models.BookMatch, len(page.Books))
+	for i, book := range page.Books {
+		matches[i] = models.BookMatch{Book: book, Snippet: page.Snippets[book.ID]}
+	}
+	json.NewEncoder(w).Encode(matches)
 }
 
 func (h *BookHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -52,43 +305,61 @@ func (h *BookHandler) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
 		return
 	}
+	if err := normalizeBookISBN(&book); err != nil {
+		http.Error(w, `{"error":"Invalid ISBN"}`, http.StatusBadRequest)
+		return
+	}
+	if err := authors.Normalize(&book); err != nil {
+		http.Error(w, `{"error":"Invalid author role: roles are author, translator, illustrator and editor"}`, http.StatusBadRequest)
+		return
+	}
+	if err := tags.Normalize(&book); err != nil {
+		http.Error(w, `{"error":"Invalid tag: tags can be at most 50 characters"}`, http.StatusBadRequest)
+		return
+	}
+	// Books are read through reading sessions, which start once they exist
+	if book.Status != "" && book.Status != reading.WantToRead && book.Status != reading.Finished {
+		http.Error(w, `{"error":"Invalid status: new books are want_to_read or finished"}`, http.StatusBadRequest)
+		return
+	}
 
 	// Check if user already owns a book with this ISBN
 	if book.ISBN != "" {
-		var existingID int
-		err := h.DB.QueryRow(
-			"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
-			userID, book.ISBN,
-		).Scan(&existingID)
-
+		_, err := h.Books.FindByISBN(r.Context(), userID, book.ISBN)
 		if err == nil {
 			// Book with this ISBN already exists for this user
 			http.Error(w, `{"error":"You already own a book with this ISBN"}`, http.StatusConflict)
 			return
-		} else if err != sql.ErrNoRows {
+		} else if !errors.Is(err, store.ErrNotFound) {
 			// Some other database error occurred
 			http.Error(w, `{"error":"Failed to check for duplicate ISBN"}`, http.StatusInternalServerError)
 			return
 		}
 	}
 
-	readInt := 0
-	if book.Read {
-		readInt = 1
+	// Fill whatever the client left out from the book's metadata
+	book.Title = strings.TrimSpace(book.Title)
+	if book.ISBN != "" && missingMetadata(&book) {
+		if meta, _ := h.Metadata.Lookup(r.Context(), book.ISBN, true); meta != nil {
+			fillFromMetadata(&book, meta)
+		}
+	}
+	if book.Title == "" {
+		http.Error(w, `{"error":"Title is required"}`, http.StatusBadRequest)
+		return
 	}
 
-	result, err := h.DB.Exec(
-		"INSERT INTO books (user_id, title, author, isbn, genre, read) VALUES (?, ?, ?, ?, ?, ?)",
-		userID, book.Title, book.Author, book.ISBN, book.Genre, readInt,
-	)
-	if err != nil {
-		// Check if it's a unique constraint violation (in case the check above was bypassed)
+	if err := h.Books.Create(r.Context(), userID, &book); err != nil {
+		// The unique index catches duplicates that slipped past the check above
+		if errors.Is(err, store.ErrConflict) {
+			http.Error(w, `{"error":"You already own a book with this ISBN"}`, http.StatusConflict)
+			return
+		}
 		http.Error(w, `{"error":"Failed to create book"}`, http.StatusInternalServerError)
 		return
 	}
 
-	id, _ := result.LastInsertId()
-	book.ID = int(id)
+	h.Covers.Prefetch(book.ID, book.CoverURL)
 
 	w.Header().Set("Content-type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -103,20 +374,15 @@ func (h *BookHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var book models.Book
-	var readInt int
-	err = h.DB.QueryRow(
-		"SELECT id, title, author, isbn, genre, read, created_at FROM books WHERE id = ? AND user_id = ?",
-		bookID,
-		userID,
-	).Scan(&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt, &book.CreatedAt)
-
-	if err == sql.ErrNoRows {
+	book, err := h.Books.Get(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
 		return
 	}
-
-	book.Read = readInt == 1
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(book)
@@ -130,39 +396,75 @@ func (h *BookHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var book models.Book
-	if err := json.NewDecoder(r.Body).Decode(&book); err != nil {
+	// Read and Status shadow the book's own, to tell which were sent
+	var req struct {
+		models.Book
+		Read   *bool   `json:"read"`
+		Status *string `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
 		return
 	}
+	book := req.Book
+	// Updates replace the whole book, so a body without a title would blank it
+	book.Title = strings.TrimSpace(book.Title)
+	if book.Title == "" {
+		http.Error(w, `{"error":"Title is required"}`, http.StatusBadRequest)
+		return
+	}
+	if err := normalizeBookISBN(&book); err != nil {
+		http.Error(w, `{"error":"Invalid ISBN"}`, http.StatusBadRequest)
+		return
+	}
+	if err := authors.Normalize(&book); err != nil {
+		http.Error(w, `{"error":"Invalid author role: roles are author, translator, illustrator and editor"}`, http.StatusBadRequest)
+		return
+	}
+	if err := tags.Normalize(&book); err != nil {
+		http.Error(w, `{"error":"Invalid tag: tags can be at most 50 characters"}`, http.StatusBadRequest)
+		return
+	}
 
-	readInt := 0
-	if book.Read {
-		readInt = 1
+	// Sending back the book as fetched is fine, but its reading state moves
+	// through the status endpoint
+	if req.Read != nil || req.Status != nil {
+		existing, err := h.Books.Get(r.Context(), userID, bookID)
+		if errors.Is(err, store.ErrNotFound) {
+			http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"Failed to update book"}`, http.StatusInternalServerError)
+			return
+		}
+		if (req.Read != nil && *req.Read != existing.Read) || (req.Status != nil && *req.Status != existing.Status) {
+			http.Error(w, `{"error":"Reading status and read can't be changed here: use PUT /api/reading-history/book/{bookId}/status"}`, http.StatusBadRequest)
+			return
+		}
 	}
 
-	result, err := h.DB.Exec(
-		"UPDATE books SET title=?, author=?, isbn=?, genre=?, read=? WHERE id=? AND user_id=?",
-		book.Title,
-		book.Author,
-		book.ISBN,
-		book.Genre,
-		readInt,
-		bookID,
-		userID,
-	)
+	book.ID = bookID
+	err = h.Books.Update(r.Context(), userID, &book)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already own a book with this ISBN"}`, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, `{"error":"Failed to update book"}`, http.StatusInternalServerError)
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
-		return
+	// Downloads the new cover, if the URL changed
+	if book.CoverURL != "" {
+		h.Covers.Prefetch(book.ID, book.CoverURL)
+	} else if err := h.Covers.RemoveDownload(r.Context(), book.ID); err != nil {
+		log.Printf("Failed to delete cover for book %d: %v", book.ID, err)
 	}
 
-	book.ID = bookID
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(book)
 }
@@ -175,181 +477,229 @@ func (h *BookHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := h.DB.Exec("DELETE FROM books WHERE id=? AND user_id=?", bookID, userID)
+	err = h.Books.Delete(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, `{"error":"Failed to delete book"}`, http.StatusInternalServerError)
 		return
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
-		return
+	if err := h.Covers.Delete(r.Context(), bookID); err != nil {
+		log.Printf("Failed to delete cover for book %d: %v", bookID, err)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Book deleted successfully"})
 }
 
-func (h *BookHandler) SearchByISBN(w http.ResponseWriter, r *http.Request) {
-	userID, _ := middleware.GetUserID(r.Context())
-	isbnParam := chi.URLParam(r, "isbn")
+// deleteCovers removes the stored covers of deleted books. Failures are
+// only logged, since the books are gone either way.
+func deleteCovers(ctx context.Context, c *covers.Service, books []models.Book) {
+	for _, book := range books {
+		if err := c.Delete(ctx, book.ID); err != nil {
+			log.Printf("Failed to delete cover for book %d: %v", book.ID, err)
+		}
+	}
+}
 
-	isbn, err := strconv.Atoi(isbnParam)
+// Cover serves the book's cover from the local cover store in the size
+// given by the size parameter (small, medium or large). Covers missing from
+// the store, or stored from a different URL than the book's cover URL, are
+// downloaded first, and a downloaded cover of a book whose cover URL was
+// cleared is not served. Responses carry an ETag so clients can revalidate.
+func (h *BookHandler) Cover(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
-		http.Error(w, `{"error":"Invalid ISBN"}`, http.StatusBadRequest)
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+	size := r.URL.Query().Get("size")
+	if size == "" {
+		size = covers.DefaultSize
+	}
+	if !covers.ValidSize(size) {
+		http.Error(w, `{"error":"size must be small, medium or large"}`, http.StatusBadRequest)
 		return
 	}
 
-	ctx := r.Context()
-
-	// Check if user already owns this book
-	var existingBookID int
-	err = h.DB.QueryRowContext(ctx,
-		"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
-		userID, isbnParam,
-	).Scan(&existingBookID)
-
-	alreadyOwned := err == nil
+	book, err := h.Books.Get(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
 
-	// Check db cache first
-	row := h.DB.QueryRowContext(
-		ctx,
-		"SELECT isbn, title, author, genre, cover_url, cached_at FROM isbn_cache WHERE isbn = ?",
-		isbnParam,
-	)
-
-	var cache models.IsbnCache
-	err = row.Scan(&cache.ISBN, &cache.Title, &cache.Author, &cache.Genre, &cache.CoverUrl, &cache.CachedAt)
-
-	if err == sql.ErrNoRows {
-		// No book found in Cache -> search via Google API
-		gb, gerr := api.SearchGoogleApi(ctx, isbn)
-		if gerr != nil {
-			http.Error(w, `{"error":"Failed to search Google Books API"}`, http.StatusInternalServerError)
-			return
-		}
-		if gb == nil {
-			http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+	// A failed download still leaves any earlier cover to serve
+	var fetchErr error
+	if book.CoverURL != "" {
+		fetchErr = h.Covers.Ensure(r.Context(), bookID, book.CoverURL)
+	} else if err := h.Covers.RemoveDownload(r.Context(), bookID); err != nil {
+		http.Error(w, `{"error":"Failed to load cover"}`, http.StatusInternalServerError)
+		return
+	}
+	data, etag, err := h.Covers.Get(r.Context(), bookID, size)
+	if errors.Is(err, covers.ErrNotFound) {
+		if fetchErr != nil {
+			log.Printf("Failed to fetch cover for book %d: %v", bookID, fetchErr)
+			http.Error(w, `{"error":"Failed to fetch cover"}`, http.StatusBadGateway)
 			return
 		}
+		http.Error(w, `{"error":"Book has no cover"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to load cover"}`, http.StatusInternalServerError)
+		return
+	}
 
-		// Cache in DB
-		_, ierr := h.DB.ExecContext(
-			ctx,
-			`INSERT INTO isbn_cache (isbn, title, author, genre, cover_url, cached_at) VALUES (?, ?, ?, ?, ?, ?)`,
-			gb.ISBN,
-			gb.Title,
-			gb.Author,
-			gb.Genre,
-			gb.CoverUrl,
-			gb.CachedAt,
-		)
-		if ierr != nil {
-			// Log but don't fail the request
-			http.Error(w, `{"error":"Failed to cache book data"}`, http.StatusInternalServerError)
-			return
-		}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	// ServeContent answers If-None-Match with 304 Not Modified
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
 
-		// Return result with ownership status
-		result := map[string]interface{}{
-			"isbn":          gb.ISBN,
-			"title":         gb.Title,
-			"author":        gb.Author,
-			"genre":         gb.Genre,
-			"cover_url":     gb.CoverUrl,
-			"already_owned": alreadyOwned,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(result)
+// UploadCover replaces the book's cover with an uploaded JPEG, PNG or WebP
+// image, sent as the "file" field of a multipart form or as the raw body.
+// The uploaded cover takes precedence over the book's cover URL until it is
+// removed with DeleteCover.
+func (h *BookHandler) UploadCover(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Books.Get(r.Context(), userID, bookID); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
 		return
 	} else if err != nil {
-		http.Error(w, `{"error":"Database error"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Book found in Cache -> Return with ownership status
-	result := map[string]interface{}{
-		"isbn":          cache.ISBN,
-		"title":         cache.Title,
-		"author":        cache.Author,
-		"genre":         cache.Genre,
-		"cover_url":     cache.CoverUrl,
-		"already_owned": alreadyOwned,
+	// Leave room for the multipart framing around the image
+	file, err := uploadedFile(w, r, covers.MaxUploadBytes+64<<10)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, `{"error":"Cover must be at most 10MB"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, covers.MaxUploadBytes+1))
+	if errors.As(err, &tooLarge) || len(data) > covers.MaxUploadBytes {
+		http.Error(w, `{"error":"Cover must be at most 10MB"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Covers.Upload(r.Context(), bookID, data)
+	if errors.Is(err, covers.ErrUnsupportedType) {
+		http.Error(w, `{"error":"Cover must be a JPEG, PNG or WebP image"}`, http.StatusUnsupportedMediaType)
+		return
 	}
+	if errors.Is(err, covers.ErrInvalidImage) {
+		http.Error(w, `{"error":"Cover image is damaged or too large"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to save cover"}`, http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cover uploaded successfully"})
 }
 
-func (h *BookHandler) Search(w http.ResponseWriter, r *http.Request) {
+// DeleteCover removes the book's uploaded cover, going back to the cover
+// found by the metadata lookup.
+func (h *BookHandler) DeleteCover(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
-	query := r.URL.Query().Get("q")
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+	if _, err := h.Books.Get(r.Context(), userID, bookID); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
 
-	if query == "" {
-		http.Error(w, `{"error":"Search query is required"}`, http.StatusBadRequest)
+	err = h.Covers.RemoveUpload(r.Context(), bookID)
+	if errors.Is(err, covers.ErrNotFound) {
+		http.Error(w, `{"error":"Book has no uploaded cover"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete cover"}`, http.StatusInternalServerError)
 		return
 	}
 
-	ctx := r.Context()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cover deleted successfully"})
+}
 
-	// Check if the query looks like an ISBN (only digits, 10 or 13 characters)
-	isISBN := len(query) >= 10 && len(query) <= 13
-	for _, c := range query {
-		if c < '0' || c > '9' {
-			isISBN = false
-			break
-		}
+func (h *BookHandler) SearchByISBN(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	// Accept ISBN-10 or ISBN-13, with or without hyphens; everything below
+	// works on the canonical ISBN-13
+	isbnParam, err := isbn.Normalize(chi.URLParam(r, "isbn"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid ISBN"}`, http.StatusBadRequest)
+		return
 	}
 
-	var books []*models.IsbnCache
+	ctx := r.Context()
+
+	// Check if user already owns this book
+	_, err = h.Books.FindByISBN(ctx, userID, isbnParam)
+	alreadyOwned := err == nil
 
-	// If it's an ISBN, check cache first
-	if isISBN {
-		row := h.DB.QueryRowContext(
-			ctx,
-			"SELECT isbn, title, author, genre, cover_url, cached_at FROM isbn_cache WHERE isbn = ?",
-			query,
-		)
+	meta, err := h.Metadata.Lookup(ctx, isbnParam, true)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to look up book metadata"}`, http.StatusInternalServerError)
+		return
+	}
+	if meta == nil {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
 
-		var cache models.IsbnCache
-		err := row.Scan(&cache.ISBN, &cache.Title, &cache.Author, &cache.Genre, &cache.CoverUrl, &cache.CachedAt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metadataResult(meta, alreadyOwned))
+}
 
-		if err == nil {
-			// Found in cache
-			books = []*models.IsbnCache{&cache}
-		}
+func (h *BookHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	query := r.URL.Query().Get("q")
+
+	if query == "" {
+		http.Error(w, `{"error":"Search query is required"}`, http.StatusBadRequest)
+		return
 	}
 
-	// If not found in cache or not an ISBN, search Google Books API
-	if len(books) == 0 {
-		results, err := api.SearchGoogleBooks(ctx, query)
-		if err != nil {
-			http.Error(w, `{"error":"Failed to search Google Books API"}`, http.StatusInternalServerError)
-			return
-		}
-		books = results
-
-		// Cache the results if we got any
-		for _, book := range books {
-			if book.ISBN != "" {
-				// Check if already cached
-				var exists int
-				err := h.DB.QueryRowContext(ctx, "SELECT 1 FROM isbn_cache WHERE isbn = ?", book.ISBN).Scan(&exists)
-				if err == sql.ErrNoRows {
-					// Not cached, insert it
-					_, _ = h.DB.ExecContext(
-						ctx,
-						`INSERT INTO isbn_cache (isbn, title, author, genre, cover_url, cached_at) VALUES (?, ?, ?, ?, ?, ?)`,
-						book.ISBN,
-						book.Title,
-						book.Author,
-						book.Genre,
-						book.CoverUrl,
-						book.CachedAt,
-					)
-				}
-			}
-		}
+	ctx := r.Context()
+
+	books, err := h.Metadata.Search(ctx, query)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to search book metadata"}`, http.StatusInternalServerError)
+		return
 	}
 
 	// Check ownership for each book
@@ -357,22 +707,11 @@ func (h *BookHandler) Search(w http.ResponseWriter, r *http.Request) {
 	for _, book := range books {
 		alreadyOwned := false
 		if book.ISBN != "" {
-			var existingBookID int
-			err := h.DB.QueryRowContext(ctx,
-				"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
-				userID, book.ISBN,
-			).Scan(&existingBookID)
+			_, err := h.Books.FindByISBN(ctx, userID, book.ISBN)
 			alreadyOwned = err == nil
 		}
 
-		results = append(results, map[string]interface{}{
-			"isbn":          book.ISBN,
-			"title":         book.Title,
-			"author":        book.Author,
-			"genre":         book.Genre,
-			"cover_url":     book.CoverUrl,
-			"already_owned": alreadyOwned,
-		})
+		results = append(results, metadataResult(book, alreadyOwned))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
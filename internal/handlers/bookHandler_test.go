@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestBookCRUD(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":" Dune ","author":"Frank Herbert","genre":"Science Fiction"}`)
+	if book.ID == 0 || book.Title != "Dune" || book.Status != "want_to_read" || book.Read {
+		t.Fatalf("created %+v", book)
+	}
+	path := "/api/books/" + strconv.Itoa(book.ID)
+
+	var got models.Book
+	if code := api.do(1, "GET", path, "", &got); code != http.StatusOK {
+		t.Fatalf("get: got %d", code)
+	}
+	if got.Title != "Dune" || got.Author != "Frank Herbert" {
+		t.Errorf("get returned %+v", got)
+	}
+
+	var list []models.Book
+	if code := api.do(1, "GET", "/api/books", "", &list); code != http.StatusOK {
+		t.Fatalf("list: got %d", code)
+	}
+	if len(list) != 1 || list[0].ID != book.ID {
+		t.Errorf("list returned %+v", list)
+	}
+
+	var updated models.Book
+	code := api.do(1, "PUT", path, `{"title":"Dune Messiah","author":"Frank Herbert"}`, &updated)
+	if code != http.StatusOK {
+		t.Fatalf("update: got %d", code)
+	}
+	if updated.Title != "Dune Messiah" || updated.Status != "want_to_read" {
+		t.Errorf("update returned %+v", updated)
+	}
+	api.do(1, "GET", path, "", &got)
+	if got.Title != "Dune Messiah" {
+		t.Errorf("title after update is %q", got.Title)
+	}
+
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: got %d", code)
+	}
+	if code := api.do(1, "GET", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want %d", code, http.StatusNotFound)
+	}
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("second delete: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestCreateBookRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no title", `{"author":"Frank Herbert"}`, http.StatusBadRequest},
+		{"blank title", `{"title":"   "}`, http.StatusBadRequest},
+		{"bad ISBN", `{"title":"Dune","isbn":"0306406153"}`, http.StatusBadRequest},
+		{"reading status", `{"title":"Dune","status":"reading"}`, http.StatusBadRequest},
+		{"malformed body", `{"title":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			if code := api.do(1, "POST", "/api/books", tt.body, nil); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateBookDuplicateISBN(t *testing.T) {
+	api := newTestAPI(t)
+	api.createBook(1, `{"title":"Dune","isbn":"0306406152"}`)
+
+	// The ISBN-13 form of the same book
+	if code := api.do(1, "POST", "/api/books", `{"title":"Dune","isbn":"978-0-306-40615-7"}`, nil); code != http.StatusConflict {
+		t.Errorf("duplicate for the same user: got %d, want %d", code, http.StatusConflict)
+	}
+	if code := api.do(2, "POST", "/api/books", `{"title":"Dune","isbn":"9780306406157"}`, nil); code != http.StatusCreated {
+		t.Errorf("same ISBN for another user: got %d, want %d", code, http.StatusCreated)
+	}
+}
+
+func TestUpdateBookRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no title", `{"author":"Frank Herbert"}`, http.StatusBadRequest},
+		{"blank title", `{"title":" "}`, http.StatusBadRequest},
+		{"read changed", `{"title":"Dune","read":true}`, http.StatusBadRequest},
+		{"status changed", `{"title":"Dune","status":"finished"}`, http.StatusBadRequest},
+		{"read and status as they are", `{"title":"Dune","read":false,"status":"want_to_read"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			book := api.createBook(1, `{"title":"Dune"}`)
+			path := "/api/books/" + strconv.Itoa(book.ID)
+			if code := api.do(1, "PUT", path, tt.body, nil); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+			var got models.Book
+			api.do(1, "GET", path, "", &got)
+			if got.Title != "Dune" || got.Status != "want_to_read" || got.Read {
+				t.Errorf("book after update is %+v", got)
+			}
+		})
+	}
+}
+
+func TestBookOwnership(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	path := "/api/books/" + strconv.Itoa(book.ID)
+
+	if code := api.do(2, "GET", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("get as another user: got %d, want %d", code, http.StatusNotFound)
+	}
+	if code := api.do(2, "PUT", path, `{"title":"Mine now"}`, nil); code != http.StatusNotFound {
+		t.Errorf("update as another user: got %d, want %d", code, http.StatusNotFound)
+	}
+	if code := api.do(2, "DELETE", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("delete as another user: got %d, want %d", code, http.StatusNotFound)
+	}
+	var list []models.Book
+	api.do(2, "GET", "/api/books", "", &list)
+	if len(list) != 0 {
+		t.Errorf("another user lists %+v", list)
+	}
+
+	var got models.Book
+	if code := api.do(1, "GET", path, "", &got); code != http.StatusOK || got.Title != "Dune" {
+		t.Errorf("owner's book after the attempts: %d %+v", code, got)
+	}
+}
+
+func TestClearingCoverURLDropsDownloadedCover(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	cover := image.NewRGBA(image.Rect(0, 0, 20, 30))
+	var data bytes.Buffer
+	if err := png.Encode(&data, cover); err != nil {
+		t.Fatal(err)
+	}
+
+	downloaded := api.createBook(1, `{"title":"Dune"}`)
+	uploaded := api.createBook(1, `{"title":"Emma"}`)
+	// Stored as if downloaded from the URL, so updates find it current
+	const coverURL = "https://covers.example.com/dune.jpg"
+	if err := api.covers.Save(ctx, downloaded.ID, cover, coverURL); err != nil {
+		t.Fatal(err)
+	}
+	if err := api.covers.Upload(ctx, uploaded.ID, data.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+
+	path := "/api/books/" + strconv.Itoa(downloaded.ID)
+	if code := api.do(1, "PUT", path, `{"title":"Dune","cover_url":"`+coverURL+`"}`, nil); code != http.StatusOK {
+		t.Fatalf("setting the cover URL: got %d", code)
+	}
+	if code := api.do(1, "GET", path+"/cover", "", nil); code != http.StatusOK {
+		t.Fatalf("cover before clearing the URL: got %d", code)
+	}
+	if code := api.do(1, "PUT", path, `{"title":"Dune"}`, nil); code != http.StatusOK {
+		t.Fatalf("clearing the cover URL: got %d", code)
+	}
+	if code := api.do(1, "GET", path+"/cover", "", nil); code != http.StatusNotFound {
+		t.Errorf("cover after clearing the URL: got %d, want %d", code, http.StatusNotFound)
+	}
+
+	// An uploaded cover doesn't depend on the URL
+	path = "/api/books/" + strconv.Itoa(uploaded.ID)
+	if code := api.do(1, "PUT", path, `{"title":"Emma"}`, nil); code != http.StatusOK {
+		t.Fatalf("updating the book with an uploaded cover: got %d", code)
+	}
+	if code := api.do(1, "GET", path+"/cover", "", nil); code != http.StatusOK {
+		t.Errorf("uploaded cover: got %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestCoverOfClearedURLNotServed(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	// A download that finished after the URL was cleared
+	if err := api.covers.Save(context.Background(), book.ID, image.NewRGBA(image.Rect(0, 0, 20, 30)), "https://covers.example.com/dune.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if code := api.do(1, "GET", "/api/books/"+strconv.Itoa(book.ID)+"/cover", "", nil); code != http.StatusNotFound {
+		t.Errorf("got %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"booklib/internal/covers"
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/services"
+	"booklib/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// EnrichmentHandler runs metadata enrichment over a user's books and lets
+// them review the proposals it makes.
+type EnrichmentHandler struct {
+	Enrichment *services.EnrichmentService
+	Proposals  store.EnrichmentStore
+	Covers     *covers.Service
+}
+
+// decodeOptional decodes a JSON body into v, accepting an empty body.
+func decodeOptional(r *http.Request, v any) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// Status returns the user's current or last enrichment run.
+func (h *EnrichmentHandler) Status(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	job, _ := h.Enrichment.Status(userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// Start begins an enrichment run in the background. Progress is reported
+// by Status.
+func (h *EnrichmentHandler) Start(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	job, err := h.Enrichment.Start(userID)
+	if errors.Is(err, services.ErrEnrichmentRunning) {
+		http.Error(w, `{"error":"Enrichment is already running"}`, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// Cancel stops the running enrichment run. Proposals it already made are
+// kept.
+func (h *EnrichmentHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	if !h.Enrichment.Cancel(userID) {
+		http.Error(w, `{"error":"Enrichment is not running"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Enrichment cancelled"})
+}
+
+// ListProposals returns the user's pending proposals, or with
+// status=rejected the rejected ones.
+func (h *EnrichmentHandler) ListProposals(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = models.ProposalPending
+	case models.ProposalPending, models.ProposalRejected:
+	default:
+		http.Error(w, `{"error":"Invalid query: status must be pending or rejected"}`, http.StatusBadRequest)
+		return
+	}
+
+	proposals, err := h.Proposals.List(r.Context(), userID, status)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch proposals"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proposals)
+}
+
+// Accept applies a proposal to its book, optionally only some of its
+// fields, and returns the updated book.
+func (h *EnrichmentHandler) Accept(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	proposalID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid proposal ID"}`, http.StatusBadRequest)
+		return
+	}
+	var req models.AcceptProposalRequest
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.Enrichment.Accept(r.Context(), userID, proposalID, req.Fields)
+	if errors.Is(err, services.ErrUnknownField) {
+		http.Error(w, `{"error":"Invalid field: fields must be among isbn, genre, cover_url, description, page_count, publisher, published_date and language"}`, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Proposal not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to accept proposal"}`, http.StatusInternalServerError)
+		return
+	}
+	h.Covers.Prefetch(book.ID, book.CoverURL)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(book)
+}
+
+func (h *EnrichmentHandler) Reject(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	proposalID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid proposal ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Enrichment.Reject(r.Context(), userID, proposalID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Proposal not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to reject proposal"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Proposal rejected"})
+}
+
+// bulkProposalIDs returns the proposals a bulk request selects: the given
+// IDs, or every pending proposal when none are given.
+func (h *EnrichmentHandler) bulkProposalIDs(w http.ResponseWriter, r *http.Request, userID int) ([]int, bool) {
+	var req models.BulkProposalRequest
+	if err := decodeOptional(r, &req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.IDs) > 0 {
+		return req.IDs, true
+	}
+
+	proposals, err := h.Proposals.List(r.Context(), userID, models.ProposalPending)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch proposals"}`, http.StatusInternalServerError)
+		return nil, false
+	}
+	ids := make([]int, len(proposals))
+	for i, p := range proposals {
+		ids[i] = p.ID
+	}
+	return ids, true
+}
+
+// AcceptAll accepts the proposals with the given IDs, or every pending
+// one. Proposals that no longer exist are skipped.
+func (h *EnrichmentHandler) AcceptAll(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	ids, ok := h.bulkProposalIDs(w, r, userID)
+	if !ok {
+		return
+	}
+
+	accepted := 0
+	for _, id := range ids {
+		book, err := h.Enrichment.Accept(r.Context(), userID, id, nil)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, `{"error":"Failed to accept proposals","accepted":`+strconv.Itoa(accepted)+`}`, http.StatusInternalServerError)
+			return
+		}
+		h.Covers.Prefetch(book.ID, book.CoverURL)
+		accepted++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"accepted": accepted})
+}
+
+// RejectAll rejects the proposals with the given IDs, or every pending one.
+// Proposals that no longer exist are skipped.
+func (h *EnrichmentHandler) RejectAll(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	ids, ok := h.bulkProposalIDs(w, r, userID)
+	if !ok {
+		return
+	}
+
+	rejected := 0
+	for _, id := range ids {
+		err := h.Enrichment.Reject(r.Context(), userID, id)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			http.Error(w, `{"error":"Failed to reject proposals","rejected":`+strconv.Itoa(rejected)+`}`, http.StatusInternalServerError)
+			return
+		}
+		rejected++
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"rejected": rejected})
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booklib/internal/archive"
+	"booklib/internal/covers"
+	"booklib/internal/isbn"
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+// maxRestoreSize caps the size of an uploaded archive.
+const maxRestoreSize = 50 << 20
+
+type ExportHandler struct {
+	Books   store.BookStore
+	Exports store.ExportStore
+	Covers  *covers.Service
+}
+
+// Export downloads all of the user's data, as JSON by default or as a zip of
+// per-table CSV files with ?format=csv
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, `{"error":"Format must be json or csv"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The archive is streamed from a single read transaction. Once the
+	// reader is handed over the headers go out, so later failures can only
+	// truncate the download.
+	now := time.Now().UTC()
+	filename := "booklib-export-" + now.Format("2006-01-02")
+	started := false
+	err := h.Exports.Export(r.Context(), userID, func(data store.ExportReader) error {
+		started = true
+		if format == "csv" {
+			w.Header().Set("Content-Type", "application/zip")
+			w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+			return archive.WriteZip(w, now, data)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+		return archive.WriteJSON(w, now, data)
+	})
+	if err != nil && !started {
+		http.Error(w, `{"error":"Failed to export data"}`, http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to write export for user %d: %v", userID, err)
+	}
+}
+
+// Restore re-imports an archive produced by Export, in either format. Books
+// the user already owns are skipped unless ?replace=true, which first
+// deletes the user's books, lending and reading history.
+func (h *ExportHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	replace, _ := strconv.ParseBool(r.URL.Query().Get("replace"))
+
+	file, err := uploadedFile(w, r, maxRestoreSize)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	body, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+
+	var data *models.Export
+	if bytes.HasPrefix(body, []byte("PK")) {
+		data, err = archive.ReadZip(bytes.NewReader(body), int64(len(body)))
+	} else {
+		err = json.Unmarshal(body, &data)
+	}
+	if err == nil && data == nil {
+		err = errors.New("empty archive")
+	}
+	if errors.Is(err, archive.ErrTooLarge) {
+		http.Error(w, `{"error":"Archive is too large"}`, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		log.Printf("Unreadable restore for user %d: %v", userID, err)
+		http.Error(w, `{"error":"Archive can't be read"}`, http.StatusBadRequest)
+		return
+	}
+	// The reason can quote the archive's values, so it only goes to the log
+	if err := archive.Validate(data); err != nil {
+		log.Printf("Rejected restore for user %d: %v", userID, err)
+		if errors.Is(err, archive.ErrUnsupportedVersion) {
+			http.Error(w, `{"error":"Unsupported archive version"}`, http.StatusBadRequest)
+		} else {
+			http.Error(w, `{"error":"Archive contains invalid records"}`, http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Archives from older versions may predate ISBN normalization
+	for i := range data.Books {
+		if normalized, err := isbn.Normalize(data.Books[i].ISBN); err == nil {
+			data.Books[i].ISBN = normalized
+		}
+	}
+
+	// Replacing deletes the user's books, so note which covers go with them
+	var replaced []models.Book
+	if replace {
+		if replaced, err = h.Books.List(r.Context(), userID); err != nil {
+			http.Error(w, `{"error":"Failed to restore data"}`, http.StatusInternalServerError)
+			return
+		}
+	}
+
+	result, err := h.Exports.Restore(r.Context(), userID, data, replace)
+	switch {
+	case errors.Is(err, store.ErrDuplicateISBN):
+		http.Error(w, `{"error":"Archive contains duplicate ISBNs"}`, http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrDuplicateShelf):
+		http.Error(w, `{"error":"Archive contains shelves with the same name"}`, http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrDuplicateSmartShelf):
+		http.Error(w, `{"error":"Archive contains smart shelves with the same name"}`, http.StatusConflict)
+		return
+	case errors.Is(err, store.ErrConflict):
+		http.Error(w, `{"error":"Archive conflicts with existing data"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to restore data"}`, http.StatusInternalServerError)
+		return
+	}
+	deleteCovers(r.Context(), h.Covers, replaced)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+func TestExportRestore(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.createUser("owner", "user")
+	other := api.createUser("other", "user")
+	api.createBook(owner, `{"title":"Dune","author":"Frank Herbert","isbn":"9780441013593"}`)
+	api.createBook(owner, `{"title":"Emma","author":"Jane Austen"}`)
+	api.createBook(other, `{"title":"Hyperion"}`)
+
+	for _, format := range []string{"json", "csv"} {
+		resp := api.send(owner, "GET", "/api/export?format="+format, "")
+		archive, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s export: got %d", format, resp.StatusCode)
+		}
+		if !strings.Contains(resp.Header.Get("Content-Disposition"), "booklib-export-") {
+			t.Errorf("%s export: Content-Disposition %q", format, resp.Header.Get("Content-Disposition"))
+		}
+
+		// Restoring into a new account copies only the exporting user's books
+		user := api.createUser("restore-"+format, "user")
+		var result models.RestoreResult
+		if code := api.do(user, "POST", "/api/export/restore", string(archive), &result); code != http.StatusCreated {
+			t.Fatalf("%s restore: got %d", format, code)
+		}
+		if result.BooksCreated != 2 || result.BooksSkipped != 0 {
+			t.Errorf("%s restore: got %+v", format, result)
+		}
+		// Restoring again skips the books already there
+		if code := api.do(user, "POST", "/api/export/restore", string(archive), &result); code != http.StatusCreated {
+			t.Fatalf("%s restore again: got %d", format, code)
+		}
+		if result.BooksCreated != 0 || result.BooksSkipped != 2 {
+			t.Errorf("%s restore again: got %+v", format, result)
+		}
+	}
+
+	if code := api.do(owner, "GET", "/api/export?format=xml", "", nil); code != http.StatusBadRequest {
+		t.Errorf("unknown format: got %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := api.do(owner, "POST", "/api/export/restore", `{"version":`, nil); code != http.StatusBadRequest {
+		t.Errorf("unreadable archive: got %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+// conflictingExports is an export store whose restores fail with err.
+type conflictingExports struct {
+	store.ExportStore
+	err error
+}
+
+func (s conflictingExports) Restore(ctx context.Context, userID int, data *models.Export, replace bool) (*models.RestoreResult, error) {
+	return nil, s.err
+}
+
+func TestRestoreConflicts(t *testing.T) {
+	archive := `{"version":` + strconv.Itoa(models.ExportVersion) + `,"books":[]}`
+	for _, tt := range []struct {
+		err  error
+		want string
+	}{
+		{store.ErrDuplicateISBN, "Archive contains duplicate ISBNs"},
+		{store.ErrDuplicateShelf, "Archive contains shelves with the same name"},
+		{store.ErrDuplicateSmartShelf, "Archive contains smart shelves with the same name"},
+		{store.ErrConflict, "Archive conflicts with existing data"},
+	} {
+		h := &ExportHandler{Books: store.NewMemory().Books, Exports: conflictingExports{err: tt.err}}
+		req := httptest.NewRequest("POST", "/api/export/restore", strings.NewReader(archive))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, 1))
+		w := httptest.NewRecorder()
+		h.Restore(w, req)
+
+		var body struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != http.StatusConflict || body.Error != tt.want {
+			t.Errorf("%v: got %d %q, want %d %q", tt.err, w.Code, body.Error, http.StatusConflict, tt.want)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+
+	"booklib/internal/covers"
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/services"
+	"booklib/internal/store"
+)
+
+// noMetadata is a metadata provider that knows no books, so handlers never
+// reach the network.
+type noMetadata struct{}
+
+func (noMetadata) Name() string { return "none" }
+
+func (noMetadata) LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	return nil, nil
+}
+
+func (noMetadata) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	return nil, nil
+}
+
+// testAPI serves the API routes over memory stores. Requests other than the
+// auth routes name their user in the X-User-ID header in place of the auth
+// cookie; the user's role is taken from the user store, defaulting to "user".
+type testAPI struct {
+	t        *testing.T
+	server   *httptest.Server
+	stores   *store.Stores
+	covers   *covers.Service
+	metadata *services.MetadataService
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	stores := store.NewMemory()
+	coverStore, err := covers.NewDiskStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := services.NewMetadataService(stores.Cache, noMetadata{})
+	coverService := covers.NewService(coverStore)
+	books := &BookHandler{Books: stores.Books, Metadata: metadata, Covers: coverService}
+	imports := &ImportHandler{
+		Books:      stores.Books,
+		Metadata:   metadata,
+		Enrichment: services.NewEnrichmentService(stores.Books, stores.Enrichment, metadata),
+		Covers:     coverService,
+	}
+	readingHistory := &ReadingHistoryHandler{Books: stores.Books, Reading: stores.Reading}
+	tags := &TagHandler{Tags: stores.Tags}
+	shelves := &ShelfHandler{Books: stores.Books, Shelves: stores.Shelves}
+	smartShelves := &SmartShelfHandler{Shelves: stores.Smart}
+	stats := &StatsHandler{Stats: stores.Stats}
+	lending := &LendingHandler{Books: stores.Books, Lending: stores.Lending}
+	userSettings := &UserSettingsHandler{Settings: stores.Settings}
+	auth := &AuthHandler{Users: stores.Users, Settings: stores.Settings}
+	admin := &AdminHandler{
+		Books:    stores.Books,
+		Users:    stores.Users,
+		Settings: stores.Settings,
+		Stats:    stores.Stats,
+		Covers:   coverService,
+	}
+	isbnCache := &ISBNCacheHandler{Cache: stores.Cache, Metadata: metadata}
+	exports := &ExportHandler{Books: stores.Books, Exports: stores.Export, Covers: coverService}
+
+	t.Setenv("JWT_SECRET", "test-secret")
+	if err := services.LoadJWTSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Route("/api/auth", func(r chi.Router) {
+		r.Post("/register", auth.Register)
+		r.Post("/login", auth.Login)
+		r.Post("/logout", auth.Logout)
+		r.With(middleware.AuthMiddleware).Get("/me", auth.Me)
+	})
+	r.Group(func(r chi.Router) {
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, err := strconv.Atoi(r.Header.Get("X-User-ID"))
+				if err != nil {
+					http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+					return
+				}
+				role := "user"
+				if user, err := stores.Users.Get(r.Context(), userID); err == nil {
+					role = user.Role
+				}
+				ctx := context.WithValue(r.Context(), middleware.UserIDKey, userID)
+				ctx = context.WithValue(ctx, middleware.RoleKey, role)
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		})
+		r.Route("/api/books", func(r chi.Router) {
+			r.Get("/", books.List)
+			r.Post("/", books.Create)
+			r.Get("/{id}", books.Get)
+			r.Put("/{id}", books.Update)
+			r.Delete("/{id}", books.Delete)
+			r.Get("/{id}/cover", books.Cover)
+			r.Post("/import", imports.ImportCSV)
+			r.Post("/import/goodreads", imports.ImportGoodreads)
+		})
+		r.Route("/api/reading-history", func(r chi.Router) {
+			r.Post("/", readingHistory.LogSession)
+			r.Post("/start", readingHistory.StartReading)
+			r.Put("/{id}", readingHistory.EditSession)
+			r.Delete("/{id}", readingHistory.DeleteSession)
+			r.Put("/{id}/finish", readingHistory.FinishReading)
+			r.Get("/{id}/review", readingHistory.GetReview)
+			r.Get("/book/{bookId}", readingHistory.GetBookReadingHistory)
+			r.Get("/book/{bookId}/status", readingHistory.GetStatus)
+			r.Put("/book/{bookId}/status", readingHistory.SetStatus)
+		})
+		r.Route("/api/tags", func(r chi.Router) {
+			r.Get("/", tags.List)
+			r.Post("/", tags.Create)
+			r.Put("/{id}", tags.Rename)
+			r.Delete("/{id}", tags.Delete)
+			r.Post("/{id}/books", tags.AddBooks)
+			r.Delete("/{id}/books/{bookID}", tags.RemoveBook)
+		})
+		r.Route("/api/shelves", func(r chi.Router) {
+			r.Get("/", shelves.List)
+			r.Post("/", shelves.Create)
+			r.Put("/order", shelves.Reorder)
+			r.Get("/{id}", shelves.Get)
+			r.Put("/{id}", shelves.Update)
+			r.Delete("/{id}", shelves.Delete)
+			r.Post("/{id}/books", shelves.AddBook)
+			r.Put("/{id}/books/order", shelves.ReorderBooks)
+			r.Delete("/{id}/books/{bookID}", shelves.RemoveBook)
+		})
+		r.Route("/api/smart-shelves", func(r chi.Router) {
+			r.Get("/", smartShelves.List)
+			r.Post("/", smartShelves.Create)
+			r.Post("/preview", smartShelves.Preview)
+			r.Get("/{id}", smartShelves.Get)
+			r.Put("/{id}", smartShelves.Update)
+			r.Delete("/{id}", smartShelves.Delete)
+		})
+		r.Get("/api/stats", stats.GetStats)
+		r.Route("/api/lending", func(r chi.Router) {
+			r.Get("/", lending.List)
+			r.Post("/", lending.Create)
+			r.Delete("/{id}", lending.Return)
+			r.Get("/history", lending.GetHistory)
+			r.Get("/history/{bookId}", lending.GetHistory)
+		})
+		r.Route("/api/user-settings", func(r chi.Router) {
+			r.Get("/", userSettings.GetUserSettings)
+			r.Put("/", userSettings.UpdateUserSettings)
+		})
+		r.Route("/api/export", func(r chi.Router) {
+			r.Get("/", exports.Export)
+			r.Post("/restore", exports.Restore)
+		})
+		r.Route("/api/admin", func(r chi.Router) {
+			r.Use(middleware.AdminMiddleware)
+			r.Get("/stats", admin.GetStats)
+			r.Get("/users", admin.ListUsers)
+			r.Get("/users/{id}", admin.GetUser)
+			r.Delete("/users/{id}", admin.DeleteUser)
+			r.Put("/users/{id}/role", admin.UpdateUserRole)
+			r.Get("/settings", admin.GetSettings)
+			r.Put("/settings", admin.UpdateSetting)
+			r.Get("/isbn-cache", isbnCache.List)
+			r.Delete("/isbn-cache", isbnCache.Purge)
+			r.Post("/isbn-cache/refresh", isbnCache.RefreshExpired)
+			r.Get("/isbn-cache/{isbn}", isbnCache.Get)
+			r.Put("/isbn-cache/{isbn}", isbnCache.Update)
+			r.Delete("/isbn-cache/{isbn}", isbnCache.Delete)
+			r.Post("/isbn-cache/{isbn}/refresh", isbnCache.Refresh)
+		})
+	})
+
+	api := &testAPI{t: t, server: httptest.NewServer(r), stores: stores, covers: coverService, metadata: metadata}
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+// send sends body, if not empty, as user userID. The caller closes the
+// response body.
+func (a *testAPI) send(userID int, method, path, body string) *http.Response {
+	a.t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, a.server.URL+path, reader)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req.Header.Set("X-User-ID", strconv.Itoa(userID))
+	resp, err := a.server.Client().Do(req)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return resp
+}
+
+// do sends body, if not empty, as user userID and decodes the response into
+// out, if not nil and the request succeeded. It returns the status code.
+func (a *testAPI) do(userID int, method, path, body string, out any) int {
+	a.t.Helper()
+	resp := a.send(userID, method, path, body)
+	defer resp.Body.Close()
+	if out != nil && resp.StatusCode < 300 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			a.t.Fatalf("%s %s: decoding response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// createBook adds a book for the user and returns it.
+func (a *testAPI) createBook(userID int, body string) models.Book {
+	a.t.Helper()
+	var book models.Book
+	if code := a.do(userID, "POST", "/api/books", body, &book); code != http.StatusCreated {
+		a.t.Fatalf("creating book %s: got %d, want %d", body, code, http.StatusCreated)
+	}
+	return book
+}
+
+// createUser adds a user with the given role and returns its ID.
+func (a *testAPI) createUser(username, role string) int {
+	a.t.Helper()
+	user := models.User{Username: username, Email: username + "@example.com", Role: role}
+	if err := a.stores.Users.Create(context.Background(), &user); err != nil {
+		a.t.Fatal(err)
+	}
+	return user.ID
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"booklib/internal/authors"
+	"booklib/internal/isbn"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+)
+
+// parseGoodreadsCSV reads goodreads_library_export.csv. The exclusive shelf
+// decides the read status, Date Read becomes a completed reading session and
+// books on currently-reading get an open session from the day they were
+// added. Additional Authors are credited after Author.
+func parseGoodreadsCSV(file io.Reader) ([]importCandidate, error) {
+	table, err := newCSVTable(file, "title", "exclusive shelf")
+	if err != nil {
+		return nil, err
+	}
+	return table.readAll(func(t *csvTable) importCandidate {
+		c := importCandidate{
+			book: models.Book{
+				Title:         t.field("title"),
+				Author:        goodreadsAuthors(t.field("author"), t.field("additional authors")),
+				Publisher:     t.field("publisher"),
+				PublishedDate: t.field("year published"),
+			},
+		}
+		if c.book.Title == "" {
+			c.err = "title is required"
+			return c
+		}
+		// A blank or malformed page count is left for the metadata lookup
+		c.book.PageCount, _ = strconv.Atoi(t.field("number of pages"))
+
+		// Goodreads wraps ISBNs as ="0441013597" so spreadsheets keep the
+		// leading zeros
+		c.book.ISBN = unquoteGoodreads(t.field("isbn13"))
+		if c.book.ISBN == "" {
+			c.book.ISBN = unquoteGoodreads(t.field("isbn"))
+		}
+		if err := normalizeBookISBN(&c.book); err != nil {
+			c.err = "invalid ISBN"
+			return c
+		}
+
+		var finished []dateRange
+		if value := t.field("date read"); value != "" {
+			completed, err := parseImportDate(value)
+			if err != nil {
+				c.err = "invalid Date Read"
+				return c
+			}
+			finished = append(finished, dateRange{completed, completed})
+		}
+
+		if err := c.applyShelf(t.field("exclusive shelf"), finished, t.field("date added")); err != "" {
+			c.err = err
+		}
+		return c
+	})
+}
+
+// parseStoryGraphCSV reads a StoryGraph export. Every range in Dates Read
+// becomes a completed reading session, falling back to Last Date Read for
+// older exports. ISBN/UID holds StoryGraph's own ID for books without an
+// ISBN, so values that are not ISBNs are dropped rather than rejected.
+func parseStoryGraphCSV(file io.Reader) ([]importCandidate, error) {
+	table, err := newCSVTable(file, "title", "read status")
+	if err != nil {
+		return nil, err
+	}
+	return table.readAll(func(t *csvTable) importCandidate {
+		c := importCandidate{
+			book: models.Book{
+				Title:  t.field("title"),
+				Author: t.field("authors", "author"),
+			},
+		}
+		if c.book.Title == "" {
+			c.err = "title is required"
+			return c
+		}
+
+		if normalized, err := isbn.Normalize(t.field("isbn/uid", "isbn")); err == nil {
+			c.book.ISBN = normalized
+		}
+
+		var finished []dateRange
+		if value := t.field("dates read"); value != "" {
+			for _, part := range strings.Split(value, ",") {
+				r, err := parseDateRange(strings.TrimSpace(part))
+				if err != nil {
+					c.err = "invalid Dates Read"
+					return c
+				}
+				finished = append(finished, r)
+			}
+		} else if value := t.field("last date read"); value != "" {
+			completed, err := parseImportDate(value)
+			if err != nil {
+				c.err = "invalid Last Date Read"
+				return c
+			}
+			finished = append(finished, dateRange{completed, completed})
+		}
+
+		if err := c.applyShelf(t.field("read status"), finished, t.field("date added")); err != "" {
+			c.err = err
+		}
+		return c
+	})
+}
+
+// dateRange is a reading session's start and completion dates.
+type dateRange struct {
+	start, end time.Time
+}
+
+// parseDateRange parses "2023/01/02-2023/01/10" or a single date, which is
+// used as both the start and the end.
+func parseDateRange(value string) (dateRange, error) {
+	startValue, endValue, found := strings.Cut(value, "-")
+	if !found || !strings.Contains(value, "/") {
+		// A lone date, possibly in ISO form where "-" is not a separator
+		date, err := parseImportDate(value)
+		return dateRange{date, date}, err
+	}
+
+	end, err := parseImportDate(strings.TrimSpace(endValue))
+	if err != nil {
+		return dateRange{}, err
+	}
+	start := end
+	if startValue = strings.TrimSpace(startValue); startValue != "" {
+		if start, err = parseImportDate(startValue); err != nil {
+			return dateRange{}, err
+		}
+	}
+	return dateRange{start, end}, nil
+}
+
+// applyShelf sets the read status and reading sessions from a shelf name
+// shared by both services: read, currently-reading, to-read and so on, plus
+// StoryGraph's paused and did-not-finish. Finished sessions always mark the
+// book read, since a re-read may be on another shelf. It returns a
+// rejection reason if dateAdded is needed but cannot be parsed.
+func (c *importCandidate) applyShelf(shelf string, finished []dateRange, dateAdded string) string {
+	for _, r := range finished {
+		completed := r.end
+		c.sessions = append(c.sessions, models.ReadingHistory{StartedAt: r.start, CompletedAt: &completed})
+	}
+	c.book.Read = len(finished) > 0
+
+	switch strings.ToLower(shelf) {
+	case "read":
+		c.book.Read = true
+
+	case "did-not-finish":
+		c.book.Status = reading.DidNotFinish
+
+	case "currently-reading", "paused":
+		if strings.EqualFold(shelf, "paused") {
+			c.book.Status = reading.Paused
+		}
+		started := time.Now().UTC().Truncate(24 * time.Hour)
+		if dateAdded != "" {
+			added, err := parseImportDate(dateAdded)
+			if err != nil {
+				return "invalid Date Added"
+			}
+			started = added
+		}
+		// Don't start the current read before the last finished one
+		for _, r := range finished {
+			if r.end.After(started) {
+				started = r.end
+			}
+		}
+		c.sessions = append(c.sessions, models.ReadingHistory{StartedAt: started})
+	}
+	return ""
+}
+
+// unquoteGoodreads strips the ="..." spreadsheet formula wrapper.
+func unquoteGoodreads(value string) string {
+	if len(value) >= 3 && strings.HasPrefix(value, `="`) && strings.HasSuffix(value, `"`) {
+		return value[2 : len(value)-1]
+	}
+	return value
+}
+
+// goodreadsAuthors joins the Author column with the comma-separated names in
+// Additional Authors into one author string that authors.Split takes apart
+// again.
+func goodreadsAuthors(author, additional string) string {
+	var names []string
+	for _, name := range append([]string{author}, strings.Split(additional, ",")...) {
+		if name = strings.Join(strings.Fields(name), " "); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return authors.Join(names)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoodreadsISBNs(t *testing.T) {
+	// Goodreads writes ISBNs as ="..." formulas, which CSV quotes again
+	csv := `Title,Author,ISBN,ISBN13,Exclusive Shelf
+Dune,Frank Herbert,"=""0441013597""","=""9780441013593""",to-read
+The Giver,Lois Lowry,"=""080442957X""","=""""",to-read
+Le Petit Prince,Antoine de Saint-Exupéry,"=""""","=""979-10-323-0569-0""",to-read
+No ISBN,Anonymous,"=""""","=""""",to-read
+Plain,Frank Herbert,0441013597,,to-read
+Typo,Frank Herbert,"=""0441013598""","=""""",to-read
+`
+	candidates, err := parseGoodreadsCSV(strings.NewReader(csv))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ isbn, err string }{
+		{"9780441013593", ""},
+		// The ISBN column is used when ISBN13 is blank
+		{"9780804429573", ""},
+		{"9791032305690", ""},
+		{"", ""},
+		{"9780441013593", ""},
+		{"", "invalid ISBN"},
+	}
+	if len(candidates) != len(want) {
+		t.Fatalf("got %d candidates, want %d", len(candidates), len(want))
+	}
+	for i, c := range candidates {
+		if c.err != want[i].err || (c.err == "" && c.book.ISBN != want[i].isbn) {
+			t.Errorf("%s: ISBN %q, error %q; want %q, %q", c.book.Title, c.book.ISBN, c.err, want[i].isbn, want[i].err)
+		}
+	}
+}
+
+func TestUnquoteGoodreads(t *testing.T) {
+	tests := map[string]string{
+		`="0441013597"`: "0441013597",
+		`=""`:           "",
+		"0441013597":    "0441013597",
+		`="0441013597`:  `="0441013597`,
+		`0441013597"`:   `0441013597"`,
+		// The quotes of ="..." must not overlap
+		`="`: `="`,
+		"":   "",
+	}
+	for in, want := range tests {
+		if got := unquoteGoodreads(in); got != want {
+			t.Errorf("unquoteGoodreads(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGoodreadsAuthors(t *testing.T) {
+	tests := []struct{ author, additional, want string }{
+		{"Frank Herbert", "", "Frank Herbert"},
+		{"Neil Gaiman", "Terry Pratchett", "Neil Gaiman, Terry Pratchett"},
+		{"Neil Gaiman", " Terry  Pratchett , Neil Gaiman,", "Neil Gaiman, Terry Pratchett"},
+		// Single names can't be told apart from "Last, First" with commas
+		{"Homer", "Emily Wilson", "Homer; Emily Wilson"},
+	}
+	for _, tt := range tests {
+		if got := goodreadsAuthors(tt.author, tt.additional); got != tt.want {
+			t.Errorf("goodreadsAuthors(%q, %q) = %q, want %q", tt.author, tt.additional, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"booklib/internal/covers"
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/services"
+	"booklib/internal/store"
+)
+
+// maxImportSize caps the size of an uploaded import file.
+const maxImportSize = 10 << 20
+
+type ImportHandler struct {
+	Books      store.BookStore
+	Metadata   *services.MetadataService
+	Enrichment *services.EnrichmentService
+	Covers     *covers.Service
+}
+
+// importCandidate is a parsed import row. A non-empty err means the row was
+// rejected while parsing.
+type importCandidate struct {
+	row      int
+	book     models.Book
+	sessions []models.ReadingHistory
+	err      string
+}
+
+// importParser turns an uploaded file into candidates. It returns an error
+// only when the file as a whole cannot be read.
+type importParser func(file io.Reader) ([]importCandidate, error)
+
+// ImportCSV imports books from a CSV file with title, author, isbn, genre
+// and read columns. With ?dry_run=true nothing is written and the response
+// previews what would happen to each row.
+func (h *ImportHandler) ImportCSV(w http.ResponseWriter, r *http.Request) {
+	h.runImport(w, r, parseLibraryCSV, false)
+}
+
+// ImportGoodreads imports a Goodreads library export. Missing genres and
+// covers are filled in from cached metadata, and an enrichment run proposes
+// what the cache doesn't know.
+func (h *ImportHandler) ImportGoodreads(w http.ResponseWriter, r *http.Request) {
+	h.runImport(w, r, parseGoodreadsCSV, true)
+}
+
+// ImportStoryGraph imports a StoryGraph export. Missing genres and covers
+// are filled in like ImportGoodreads.
+func (h *ImportHandler) ImportStoryGraph(w http.ResponseWriter, r *http.Request) {
+	h.runImport(w, r, parseStoryGraphCSV, true)
+}
+
+func (h *ImportHandler) runImport(w http.ResponseWriter, r *http.Request, parse importParser, enrich bool) {
+	userID, _ := middleware.GetUserID(r.Context())
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	file, err := uploadedFile(w, r, maxImportSize)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	candidates, err := parse(file)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid CSV file"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, books, err := h.plan(r.Context(), userID, candidates)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to check for duplicate ISBNs"}`, http.StatusInternalServerError)
+		return
+	}
+	result.DryRun = dryRun
+
+	if enrich {
+		// Provider lookups for a large library would outlast the request,
+		// so they are left to the enrichment run started below
+		h.enrich(r.Context(), books)
+	}
+
+	status := http.StatusOK
+	if !dryRun && len(books) > 0 {
+		err := h.Books.Import(r.Context(), userID, books)
+		if errors.Is(err, store.ErrConflict) {
+			// Another request added one of these ISBNs after the check
+			http.Error(w, `{"error":"Library changed during import, please retry"}`, http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, `{"error":"Failed to import books"}`, http.StatusInternalServerError)
+			return
+		}
+		for _, book := range books {
+			h.Covers.Prefetch(book.ID, book.CoverURL)
+		}
+		if enrich && slices.ContainsFunc(books, func(b *models.ImportBook) bool { return missingMetadata(&b.Book) }) {
+			// A run already going may have listed its books before these
+			// were added; the next one picks them up
+			_, err := h.Enrichment.Start(userID)
+			result.EnrichmentStarted = err == nil
+		}
+		status = http.StatusCreated
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// plan classifies each candidate as created, duplicate or rejected and
+// returns the books to insert. The result rows point at the returned books,
+// so inserting them fills in the IDs shown in the response.
+func (h *ImportHandler) plan(ctx context.Context, userID int, candidates []importCandidate) (*models.ImportResult, []*models.ImportBook, error) {
+	result := &models.ImportResult{Rows: []models.ImportRow{}}
+	var books []*models.ImportBook
+	seen := make(map[string]int)
+
+	for _, c := range candidates {
+		row := models.ImportRow{Row: c.row}
+		switch {
+		case c.err != "":
+			row.Status = models.ImportRejected
+			row.Error = c.err
+			result.Rejected++
+
+		case c.book.ISBN != "" && seen[c.book.ISBN] != 0:
+			row.Status = models.ImportDuplicate
+			row.Error = "same ISBN as row " + strconv.Itoa(seen[c.book.ISBN])
+			result.Duplicates++
+
+		default:
+			if c.book.ISBN != "" {
+				_, err := h.Books.FindByISBN(ctx, userID, c.book.ISBN)
+				if err == nil {
+					row.Status = models.ImportDuplicate
+					row.Error = "you already own a book with this ISBN"
+					result.Duplicates++
+					break
+				} else if !errors.Is(err, store.ErrNotFound) {
+					return nil, nil, err
+				}
+				seen[c.book.ISBN] = c.row
+			}
+
+			book := &models.ImportBook{Book: c.book, Sessions: c.sessions}
+			reading.Settle(&book.Book, book.Sessions)
+			row.Status = models.ImportCreated
+			row.Book = &book.Book
+			row.ReadingHistory = book.Sessions
+			books = append(books, book)
+			result.Created++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	return result, books, nil
+}
+
+// enrich fills in missing authors, genres and covers from cached metadata.
+// Books without an ISBN, and those the cache doesn't know, are left as they
+// are.
+func (h *ImportHandler) enrich(ctx context.Context, books []*models.ImportBook) {
+	for _, book := range books {
+		if book.ISBN == "" || !missingMetadata(&book.Book) {
+			continue
+		}
+		if meta, _ := h.Metadata.Lookup(ctx, book.ISBN, false); meta != nil {
+			fillFromMetadata(&book.Book, meta)
+		}
+	}
+}
+
+// uploadedFile returns the uploaded file, taken from the "file" field of a
+// multipart form or from the raw request body, and fails reads past limit
+// bytes.
+func uploadedFile(w http.ResponseWriter, r *http.Request, limit int64) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		return file, err
+	}
+	return r.Body, nil
+}
+
+// csvTable reads a CSV file whose first row names the columns. Column names
+// are matched case-insensitively, unknown columns are ignored and short
+// rows read as blank for the missing fields.
+type csvTable struct {
+	reader  *csv.Reader
+	columns map[string]int
+	record  []string
+	// row is the current record's position in the file, counting the
+	// header as row 1
+	row int
+}
+
+func newCSVTable(file io.Reader, required ...string) (*csvTable, error) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// Spreadsheet exports often start with a byte order mark
+		name = strings.TrimPrefix(name, "\ufeff")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	for _, name := range required {
+		if _, ok := columns[name]; !ok {
+			return nil, errors.New("missing " + name + " column")
+		}
+	}
+	return &csvTable{reader: reader, columns: columns, row: 1}, nil
+}
+
+// next advances to the next record, returning false at the end of the file.
+func (t *csvTable) next() (bool, error) {
+	record, err := t.reader.Read()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	t.record = record
+	t.row++
+	return true, nil
+}
+
+// field returns the trimmed value of the first named column that is present
+// and non-blank in the current record.
+func (t *csvTable) field(names ...string) string {
+	for _, name := range names {
+		if i, ok := t.columns[name]; ok && i < len(t.record) {
+			if value := strings.TrimSpace(t.record[i]); value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// readAll parses every record with parseRow.
+func (t *csvTable) readAll(parseRow func(t *csvTable) importCandidate) ([]importCandidate, error) {
+	var candidates []importCandidate
+	for {
+		ok, err := t.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return candidates, nil
+		}
+		c := parseRow(t)
+		c.row = t.row
+		candidates = append(candidates, c)
+	}
+}
+
+// parseLibraryCSV reads the plain library format: title, author, isbn,
+// genre and read columns, of which only title is required.
+func parseLibraryCSV(file io.Reader) ([]importCandidate, error) {
+	table, err := newCSVTable(file, "title")
+	if err != nil {
+		return nil, err
+	}
+	return table.readAll(func(t *csvTable) importCandidate {
+		c := importCandidate{
+			book: models.Book{
+				Title:  t.field("title"),
+				Author: t.field("author"),
+				Genre:  t.field("genre"),
+				ISBN:   t.field("isbn"),
+				Notes:  t.field("notes"),
+			},
+		}
+		read, ok := parseReadFlag(t.field("read"))
+		c.book.Read = read
+		switch {
+		case c.book.Title == "":
+			c.err = "title is required"
+		case !ok:
+			c.err = "read must be true or false"
+		default:
+			if err := normalizeBookISBN(&c.book); err != nil {
+				c.err = "invalid ISBN"
+			}
+		}
+		return c
+	})
+}
+
+// parseReadFlag accepts the usual spellings of a yes/no spreadsheet column.
+// A blank value means unread.
+func parseReadFlag(value string) (bool, bool) {
+	switch strings.ToLower(value) {
+	case "", "0", "false", "no", "n", "unread":
+		return false, true
+	case "1", "true", "yes", "y", "read":
+		return true, true
+	}
+	return false, false
+}
+
+// importDateLayouts are the date formats seen in export files. Goodreads and
+// StoryGraph both write 2006/01/02.
+var importDateLayouts = []string{"2006/01/02", "2006-01-02", "2006/1/2"}
+
+// parseImportDate parses a calendar date as midnight UTC.
+func parseImportDate(value string) (time.Time, error) {
+	var err error
+	for _, layout := range importDateLayouts {
+		var t time.Time
+		if t, err = time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+// libraryCSV mixes rows that are created, duplicates and rejected.
+const libraryCSV = `title,author,isbn,genre,read
+Dune,Frank Herbert,978-0-441-01359-3,Science Fiction,true
+Dune again,Frank Herbert,0441013597,,false
+Emma,Jane Austen,,Classics,no
+,Nobody,,,
+Typo,Frank Herbert,9780441013594,,
+Maybe,Someone,,,perhaps
+Owned,Ursula K. Le Guin,9780441478125,,
+`
+
+func TestImportCSV(t *testing.T) {
+	api := newTestAPI(t)
+	api.createBook(1, `{"title":"The Left Hand of Darkness","isbn":"9780441478125"}`)
+
+	want := []struct {
+		status, err string
+	}{
+		{models.ImportCreated, ""},
+		// The ISBN-10 form of row 2's ISBN
+		{models.ImportDuplicate, "same ISBN as row 2"},
+		{models.ImportCreated, ""},
+		{models.ImportRejected, "title is required"},
+		{models.ImportRejected, "invalid ISBN"},
+		{models.ImportRejected, "read must be true or false"},
+		{models.ImportDuplicate, "you already own a book with this ISBN"},
+	}
+	check := func(t *testing.T, result models.ImportResult) {
+		t.Helper()
+		if result.Created != 2 || result.Duplicates != 2 || result.Rejected != 3 {
+			t.Errorf("created %d, duplicates %d, rejected %d; want 2, 2, 3", result.Created, result.Duplicates, result.Rejected)
+		}
+		if len(result.Rows) != len(want) {
+			t.Fatalf("got %d rows, want %d", len(result.Rows), len(want))
+		}
+		for i, row := range result.Rows {
+			if row.Row != i+2 || row.Status != want[i].status || row.Error != want[i].err {
+				t.Errorf("row %d is %d, %s, %q; want %d, %s, %q", i, row.Row, row.Status, row.Error, i+2, want[i].status, want[i].err)
+			}
+		}
+	}
+
+	t.Run("DryRun", func(t *testing.T) {
+		var result models.ImportResult
+		if code := api.do(1, "POST", "/api/books/import?dry_run=true", libraryCSV, &result); code != http.StatusOK {
+			t.Fatalf("got %d, want %d", code, http.StatusOK)
+		}
+		if !result.DryRun {
+			t.Errorf("dry run not reported")
+		}
+		check(t, result)
+		if book := result.Rows[0].Book; book == nil || book.ID != 0 || book.ISBN != "9780441013593" || book.Status != "finished" {
+			t.Errorf("previewed book is %+v", book)
+		}
+
+		var list []models.Book
+		api.do(1, "GET", "/api/books", "", &list)
+		if len(list) != 1 {
+			t.Errorf("dry run left %d books, want 1", len(list))
+		}
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		var result models.ImportResult
+		if code := api.do(1, "POST", "/api/books/import", libraryCSV, &result); code != http.StatusCreated {
+			t.Fatalf("got %d, want %d", code, http.StatusCreated)
+		}
+		if result.DryRun {
+			t.Errorf("commit reported as a dry run")
+		}
+		check(t, result)
+		for _, i := range []int{0, 2} {
+			if book := result.Rows[i].Book; book == nil || book.ID == 0 {
+				t.Errorf("row %d: created book is %+v", i, book)
+			}
+		}
+
+		var list []models.Book
+		api.do(1, "GET", "/api/books", "", &list)
+		if len(list) != 3 {
+			t.Errorf("got %d books after the import, want 3", len(list))
+		}
+
+		// Importing the file again finds the books with ISBNs; the one
+		// without has nothing to recognize it by
+		var again models.ImportResult
+		if code := api.do(1, "POST", "/api/books/import", libraryCSV, &again); code != http.StatusCreated {
+			t.Fatalf("importing again: got %d, want %d", code, http.StatusCreated)
+		}
+		if again.Created != 1 || again.Duplicates != 3 {
+			t.Errorf("importing again created %d and found %d duplicates", again.Created, again.Duplicates)
+		}
+	})
+}
+
+func TestImportRejectsFile(t *testing.T) {
+	api := newTestAPI(t)
+	if code := api.do(1, "POST", "/api/books/import", "author,isbn\nFrank Herbert,\n", nil); code != http.StatusBadRequest {
+		t.Errorf("file without a title column: got %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestImportGoodreadsUsesCachedMetadata(t *testing.T) {
+	api := newTestAPI(t)
+	// No provider knows any book, so metadata only comes from the cache
+	err := api.stores.Cache.Save(context.Background(), &models.IsbnCache{
+		ISBN: "9780441013593", Title: "Dune", Genre: "Science Fiction", Description: "Arrakis",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csv := `Title,Author,ISBN13,Exclusive Shelf
+Dune,Frank Herbert,"=""9780441013593""",read
+Emma,Jane Austen,"=""""",to-read
+`
+	var result models.ImportResult
+	if code := api.do(1, "POST", "/api/books/import/goodreads", csv, &result); code != http.StatusCreated {
+		t.Fatalf("got %d, want %d", code, http.StatusCreated)
+	}
+	if result.Created != 2 {
+		t.Fatalf("created %d books, want 2", result.Created)
+	}
+	if book := result.Rows[0].Book; book.Genre != "Science Fiction" || book.Description != "Arrakis" {
+		t.Errorf("cached metadata not filled in: %+v", book)
+	}
+	// Both books still lack a cover, which a run can propose
+	if !result.EnrichmentStarted {
+		t.Errorf("no enrichment run started for the incomplete books")
+	}
+}
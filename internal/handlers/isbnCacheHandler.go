@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booklib/internal/isbn"
+	"booklib/internal/models"
+	"booklib/internal/services"
+	"booklib/internal/store"
+	"booklib/internal/tags"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ISBNCacheHandler lets admins inspect and correct the shared ISBN
+// metadata cache.
+type ISBNCacheHandler struct {
+	Cache    store.ISBNCacheStore
+	Metadata *services.MetadataService
+}
+
+// isbnCacheEntry is a cache entry as shown to admins.
+type isbnCacheEntry struct {
+	models.IsbnCache
+	Expired bool `json:"expired"`
+}
+
+func (h *ISBNCacheHandler) entry(meta *models.IsbnCache, now time.Time) isbnCacheEntry {
+	return isbnCacheEntry{IsbnCache: *meta, Expired: h.Metadata.Expired(meta, now)}
+}
+
+// isbnParam returns the normalized ISBN from the URL, writing an error
+// response if it is invalid.
+func isbnParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	normalized, err := isbn.Normalize(chi.URLParam(r, "isbn"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid ISBN"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return normalized, true
+}
+
+// List returns cache entries ordered by ISBN. q searches ISBNs, titles and
+// authors, expired=true shows only expired entries (oldest first) and limit
+// and offset page the results. The number of matches is sent in
+// X-Total-Count.
+func (h *ISBNCacheHandler) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	now := time.Now()
+	q := store.ISBNCacheQuery{Search: params.Get("q")}
+
+	if value := params.Get("expired"); value != "" {
+		expired, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid query: expired must be true or false"}`, http.StatusBadRequest)
+			return
+		}
+		if expired {
+			q.ExpiredBefore = now.Add(-h.Metadata.TTL)
+		}
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			http.Error(w, `{"error":"Invalid query: limit must be between 1 and `+strconv.Itoa(maxPageSize)+`"}`, http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+	if value := params.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			http.Error(w, `{"error":"Invalid query: offset must be a non-negative number"}`, http.StatusBadRequest)
+			return
+		}
+		q.Offset = offset
+	}
+
+	entries, total, err := h.Cache.List(r.Context(), q)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch cache entries"}`, http.StatusInternalServerError)
+		return
+	}
+
+	results := make([]isbnCacheEntry, len(entries))
+	for i := range entries {
+		results[i] = h.entry(&entries[i], now)
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+func (h *ISBNCacheHandler) Get(w http.ResponseWriter, r *http.Request) {
+	isbnCode, ok := isbnParam(w, r)
+	if !ok {
+		return
+	}
+
+	meta, err := h.Cache.Get(r.Context(), isbnCode)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Cache entry not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch cache entry"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.entry(meta, time.Now()))
+}
+
+// Update replaces an entry's metadata. Edited entries are pinned, so the
+// scheduled refresh doesn't undo the correction, unless the request sets
+// pinned to false.
+func (h *ISBNCacheHandler) Update(w http.ResponseWriter, r *http.Request) {
+	isbnCode, ok := isbnParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		models.IsbnCache
+		Pinned *bool `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, `{"error":"Title is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.Cache.Get(r.Context(), isbnCode); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Cache entry not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `{"error":"Failed to fetch cache entry"}`, http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	meta := req.IsbnCache
+	meta.ISBN = isbnCode
+	meta.CachedAt = &now
+	meta.Pinned = req.Pinned == nil || *req.Pinned
+	tags.NormalizeMetadata(&meta)
+	if err := h.Cache.Save(r.Context(), &meta); err != nil {
+		http.Error(w, `{"error":"Failed to update cache entry"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.entry(&meta, now))
+}
+
+func (h *ISBNCacheHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	isbnCode, ok := isbnParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Cache.Delete(r.Context(), isbnCode)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Cache entry not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete cache entry"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cache entry deleted successfully"})
+}
+
+// Purge deletes expired entries, or with all=true every entry. Pinned
+// entries are kept either way and can only be deleted one at a time.
+func (h *ISBNCacheHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	before := time.Now().Add(-h.Metadata.TTL)
+	if value := r.URL.Query().Get("all"); value != "" {
+		all, err := strconv.ParseBool(value)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid query: all must be true or false"}`, http.StatusBadRequest)
+			return
+		}
+		if all {
+			// Entries written during this request are newer than this
+			before = time.Now().Add(time.Second)
+		}
+	}
+
+	purged, err := h.Cache.Purge(r.Context(), before)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to purge cache"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
+
+// Refresh looks an ISBN up again with the metadata providers and replaces
+// its entry, even a pinned one.
+func (h *ISBNCacheHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	isbnCode, ok := isbnParam(w, r)
+	if !ok {
+		return
+	}
+
+	meta, err := h.Metadata.Refresh(r.Context(), isbnCode)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to look up book metadata"}`, http.StatusBadGateway)
+		return
+	}
+	if meta == nil {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.entry(meta, time.Now()))
+}
+
+// RefreshExpired starts the scheduled refresh of expired entries now. It
+// runs in the background since it can outlast the request.
+func (h *ISBNCacheHandler) RefreshExpired(w http.ResponseWriter, r *http.Request) {
+	if !h.Metadata.StartRefresh() {
+		http.Error(w, `{"error":"A cache refresh is already running"}`, http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Cache refresh started"})
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+// stubMetadata answers ISBN lookups from isbns, or fails them with err if
+// set. Lookups wait for release when it is set.
+type stubMetadata struct {
+	isbns   map[string]*models.IsbnCache
+	err     error
+	release chan struct{}
+}
+
+func (p *stubMetadata) Name() string { return "stub" }
+
+func (p *stubMetadata) LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	if p.release != nil {
+		<-p.release
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if meta, ok := p.isbns[isbn]; ok {
+		copied := *meta
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (p *stubMetadata) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	return nil, nil
+}
+
+const (
+	duneISBN   = "9780441013593"
+	emmaISBN   = "9780141439518"
+	hobbitISBN = "9780261103344"
+)
+
+// cacheEntries fills the cache with an expired Dune, a fresh Emma and a
+// pinned, expired Hobbit.
+func (a *testAPI) cacheEntries() {
+	a.t.Helper()
+	old := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Now()
+	for _, entry := range []models.IsbnCache{
+		{ISBN: duneISBN, Title: "Dune", Author: "Frank Herbert", CachedAt: &old},
+		{ISBN: emmaISBN, Title: "Emma", Author: "Jane Austen", CachedAt: &now},
+		{ISBN: hobbitISBN, Title: "The Hobbit", Author: "J.R.R. Tolkien", CachedAt: &old, Pinned: true},
+	} {
+		if err := a.stores.Cache.Save(context.Background(), &entry); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+}
+
+// cacheEntry is an entry as the admin endpoints return it.
+type cacheEntry struct {
+	models.IsbnCache
+	Expired bool `json:"expired"`
+}
+
+func TestISBNCacheList(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+
+	tests := []struct {
+		query string
+		want  []string
+		total string
+	}{
+		// Ordered by ISBN
+		{"", []string{emmaISBN, hobbitISBN, duneISBN}, "3"},
+		{"?q=austen", []string{emmaISBN}, "1"},
+		{"?limit=1&offset=1", []string{hobbitISBN}, "3"},
+		{"?expired=true", []string{duneISBN}, "1"},
+		{"?expired=false", []string{emmaISBN, hobbitISBN, duneISBN}, "3"},
+	}
+	for _, tt := range tests {
+		resp := api.send(1, "GET", "/api/admin/isbn-cache"+tt.query, "")
+		resp.Body.Close()
+		if got := resp.Header.Get("X-Total-Count"); got != tt.total {
+			t.Errorf("%s: X-Total-Count is %s, want %s", tt.query, got, tt.total)
+		}
+		var entries []cacheEntry
+		if code := api.do(admin, "GET", "/api/admin/isbn-cache"+tt.query, "", &entries); code != http.StatusOK {
+			t.Fatalf("%s: got %d", tt.query, code)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.ISBN)
+			if e.Expired != (e.ISBN == duneISBN) {
+				t.Errorf("%s: %s expired is %v", tt.query, e.ISBN, e.Expired)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	for _, query := range []string{"?expired=maybe", "?limit=0", "?limit=501", "?limit=ten", "?offset=-1"} {
+		if code := api.do(admin, "GET", "/api/admin/isbn-cache"+query, "", nil); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", query, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestISBNCacheGetAndDelete(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+
+	var entry cacheEntry
+	// Hyphens are normalized away
+	if code := api.do(admin, "GET", "/api/admin/isbn-cache/978-0-441-01359-3", "", &entry); code != http.StatusOK {
+		t.Fatalf("get: got %d", code)
+	}
+	if entry.Title != "Dune" || !entry.Expired {
+		t.Errorf("got %+v", entry)
+	}
+	if code := api.do(admin, "GET", "/api/admin/isbn-cache/not-an-isbn", "", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid ISBN: got %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := api.do(admin, "GET", "/api/admin/isbn-cache/9780547928227", "", nil); code != http.StatusNotFound {
+		t.Errorf("missing entry: got %d, want %d", code, http.StatusNotFound)
+	}
+
+	if code := api.do(admin, "DELETE", "/api/admin/isbn-cache/"+duneISBN, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: got %d", code)
+	}
+	if code := api.do(admin, "DELETE", "/api/admin/isbn-cache/"+duneISBN, "", nil); code != http.StatusNotFound {
+		t.Errorf("deleting twice: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestISBNCacheUpdate(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+	path := "/api/admin/isbn-cache/" + duneISBN
+
+	var entry cacheEntry
+	body := `{"title":"Dune","author":"Frank Herbert","genres":["Science Fiction","science fiction","Classics"]}`
+	if code := api.do(admin, "PUT", path, body, &entry); code != http.StatusOK {
+		t.Fatalf("update: got %d", code)
+	}
+	if !entry.Pinned || entry.Expired || entry.Genre != "Science Fiction" || len(entry.Genres) != 2 {
+		t.Errorf("after update got %+v", entry)
+	}
+	stored, err := api.stores.Cache.Get(context.Background(), duneISBN)
+	if err != nil || !stored.Pinned {
+		t.Errorf("stored %+v, %v; want it pinned", stored, err)
+	}
+
+	if code := api.do(admin, "PUT", path, `{"title":"Dune","pinned":false}`, &entry); code != http.StatusOK || entry.Pinned {
+		t.Errorf("unpinning: got %d, %+v", code, entry)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"no title", path, `{"author":"Frank Herbert"}`, http.StatusBadRequest},
+		{"invalid JSON", path, `{"title":`, http.StatusBadRequest},
+		{"invalid ISBN", "/api/admin/isbn-cache/123", `{"title":"Dune"}`, http.StatusBadRequest},
+		{"missing entry", "/api/admin/isbn-cache/9780547928227", `{"title":"The Hobbit"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := api.do(admin, "PUT", tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+	if _, err := api.stores.Cache.Get(context.Background(), "9780547928227"); err == nil {
+		t.Error("updating a missing entry created it")
+	}
+}
+
+func TestISBNCachePurge(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+
+	var result map[string]int
+	if code := api.do(admin, "DELETE", "/api/admin/isbn-cache", "", &result); code != http.StatusOK || result["purged"] != 1 {
+		t.Errorf("purging expired entries: got %d, %v; want 1 purged", code, result)
+	}
+	if code := api.do(admin, "DELETE", "/api/admin/isbn-cache?all=true", "", &result); code != http.StatusOK || result["purged"] != 1 {
+		t.Errorf("purging all: got %d, %v; want the fresh entry purged", code, result)
+	}
+	// Only the pinned entry is left
+	if _, err := api.stores.Cache.Get(context.Background(), hobbitISBN); err != nil {
+		t.Errorf("pinned entry was purged: %v", err)
+	}
+	if code := api.do(admin, "DELETE", "/api/admin/isbn-cache?all=maybe", "", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid all: got %d, want %d", code, http.StatusBadRequest)
+	}
+}
+
+func TestISBNCacheRefresh(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+	provider := &stubMetadata{isbns: map[string]*models.IsbnCache{
+		hobbitISBN: {Title: "The Hobbit, or There and Back Again", Author: "J.R.R. Tolkien"},
+	}}
+	api.metadata.Metadata = provider
+
+	// Refreshing replaces even a pinned entry
+	var entry cacheEntry
+	if code := api.do(admin, "POST", "/api/admin/isbn-cache/"+hobbitISBN+"/refresh", "", &entry); code != http.StatusOK {
+		t.Fatalf("refresh: got %d", code)
+	}
+	if entry.Title != "The Hobbit, or There and Back Again" || entry.Pinned || entry.Expired {
+		t.Errorf("refreshed %+v", entry)
+	}
+	if code := api.do(admin, "POST", "/api/admin/isbn-cache/"+duneISBN+"/refresh", "", nil); code != http.StatusNotFound {
+		t.Errorf("book the providers don't know: got %d, want %d", code, http.StatusNotFound)
+	}
+	if stored, _ := api.stores.Cache.Get(context.Background(), duneISBN); stored == nil || stored.Title != "Dune" {
+		t.Errorf("unknown book's entry is %+v, want it kept", stored)
+	}
+	provider.err = errors.New("provider down")
+	if code := api.do(admin, "POST", "/api/admin/isbn-cache/"+emmaISBN+"/refresh", "", nil); code != http.StatusBadGateway {
+		t.Errorf("provider failure: got %d, want %d", code, http.StatusBadGateway)
+	}
+}
+
+func TestISBNCacheRefreshExpired(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.createUser("admin", "admin")
+	api.cacheEntries()
+	provider := &stubMetadata{
+		isbns:   map[string]*models.IsbnCache{duneISBN: {Title: "Dune (refreshed)"}},
+		release: make(chan struct{}),
+	}
+	api.metadata.Metadata = provider
+
+	if code := api.do(admin, "POST", "/api/admin/isbn-cache/refresh", "", nil); code != http.StatusAccepted {
+		t.Fatalf("starting a refresh: got %d, want %d", code, http.StatusAccepted)
+	}
+	// The first refresh is held up looking up Dune
+	if code := api.do(admin, "POST", "/api/admin/isbn-cache/refresh", "", nil); code != http.StatusConflict {
+		t.Errorf("starting a second refresh: got %d, want %d", code, http.StatusConflict)
+	}
+	close(provider.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		entry, err := api.stores.Cache.Get(context.Background(), duneISBN)
+		if err == nil && entry.Title == "Dune (refreshed)" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expired entry not refreshed: %+v, %v", entry, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if entry, _ := api.stores.Cache.Get(context.Background(), hobbitISBN); entry.Title != "The Hobbit" {
+		t.Errorf("pinned entry was refreshed to %+v", entry)
+	}
+}
@@ -1,66 +1,33 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
 
 	"booklib/internal/middleware"
 	"booklib/internal/models"
+	"booklib/internal/store"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type LendingHandler struct {
-	DB *sql.DB
+	Books   store.BookStore
+	Lending store.LendingStore
 }
 
 // List returns all active (not returned) lending records for the authenticated user
 func (h *LendingHandler) List(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
 
-	query := `
-		SELECT 
-			l.id, l.book_id, l.user_id, l.lent_to, l.lent_at, l.due_date,
-			b.id, b.title, b.author, b.isbn, b.genre, b.read
-		FROM lending l
-		JOIN books b ON l.book_id = b.id
-		WHERE l.user_id = ? AND l.returned_at IS NULL
-		ORDER BY l.lent_at DESC
-	`
-
-	rows, err := h.DB.Query(query, userID)
+	lendings, err := h.Lending.ListActive(r.Context(), userID)
 	if err != nil {
 		http.Error(w, `{"error":"Failed to fetch lending records"}`, http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	lendings := []models.LendingWithBook{}
-	for rows.Next() {
-		var lending models.LendingWithBook
-		var book models.Book
-		var readInt int
-		var dueDate sql.NullTime
-
-		if err := rows.Scan(
-			&lending.ID, &lending.BookID, &lending.UserID, &lending.LentTo, &lending.LentAt, &dueDate,
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt,
-		); err != nil {
-			continue
-		}
-
-		book.Read = readInt == 1
-		lending.Book = &book
-
-		if dueDate.Valid {
-			lending.DueDate = &dueDate.Time
-		}
-
-		lendings = append(lendings, lending)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(lendings)
@@ -77,9 +44,8 @@ func (h *LendingHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate that the book belongs to the user
-	var bookUserID int
-	err := h.DB.QueryRow("SELECT user_id FROM books WHERE id = ?", req.BookID).Scan(&bookUserID)
-	if err == sql.ErrNoRows {
+	bookUserID, err := h.Books.OwnerID(r.Context(), req.BookID)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
 		return
 	}
@@ -93,12 +59,7 @@ func (h *LendingHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check if book is already lent out
-	var existingID int
-	err = h.DB.QueryRow(
-		"SELECT id FROM lending WHERE book_id = ? AND returned_at IS NULL",
-		req.BookID,
-	).Scan(&existingID)
-	if err == nil {
+	if _, err := h.Lending.ActiveForBook(r.Context(), req.BookID); err == nil {
 		http.Error(w, `{"error":"Book is already lent out"}`, http.StatusConflict)
 		return
 	}
@@ -115,25 +76,16 @@ func (h *LendingHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create lending record
-	result, err := h.DB.Exec(
-		"INSERT INTO lending (book_id, user_id, lent_to, due_date) VALUES (?, ?, ?, ?)",
-		req.BookID, userID, req.LentTo, dueDate,
-	)
-	if err != nil {
-		http.Error(w, `{"error":"Failed to create lending record"}`, http.StatusInternalServerError)
-		return
-	}
-
-	id, _ := result.LastInsertId()
-
 	lending := models.Lending{
-		ID:      int(id),
 		BookID:  req.BookID,
 		UserID:  userID,
 		LentTo:  req.LentTo,
-		LentAt:  time.Now(),
 		DueDate: dueDate,
 	}
+	if err := h.Lending.Create(r.Context(), &lending); err != nil {
+		http.Error(w, `{"error":"Failed to create lending record"}`, http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
@@ -150,12 +102,8 @@ func (h *LendingHandler) Return(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Verify the lending record belongs to the user
-	var recordUserID int
-	err = h.DB.QueryRow(
-		"SELECT user_id FROM lending WHERE id = ? AND returned_at IS NULL",
-		lendingID,
-	).Scan(&recordUserID)
-	if err == sql.ErrNoRows {
+	lending, err := h.Lending.GetActive(r.Context(), lendingID)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Lending record not found or already returned"}`, http.StatusNotFound)
 		return
 	}
@@ -163,17 +111,13 @@ func (h *LendingHandler) Return(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error":"Failed to fetch lending record"}`, http.StatusInternalServerError)
 		return
 	}
-	if recordUserID != userID {
+	if lending.UserID != userID {
 		http.Error(w, `{"error":"Unauthorized"}`, http.StatusForbidden)
 		return
 	}
 
 	// Mark as returned
-	_, err = h.DB.Exec(
-		"UPDATE lending SET returned_at = CURRENT_TIMESTAMP WHERE id = ?",
-		lendingID,
-	)
-	if err != nil {
+	if err := h.Lending.MarkReturned(r.Context(), lendingID, time.Now()); err != nil {
 		http.Error(w, `{"error":"Failed to mark book as returned"}`, http.StatusInternalServerError)
 		return
 	}
@@ -185,72 +129,22 @@ func (h *LendingHandler) Return(w http.ResponseWriter, r *http.Request) {
 func (h *LendingHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
 
-	var query string
-	var args []interface{}
-
 	// Check if a specific book ID is provided
-	bookIDParam := chi.URLParam(r, "bookId")
-	if bookIDParam != "" {
-		bookID, err := strconv.Atoi(bookIDParam)
+	var bookID int
+	if bookIDParam := chi.URLParam(r, "bookId"); bookIDParam != "" {
+		id, err := strconv.Atoi(bookIDParam)
 		if err != nil {
 			http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
 			return
 		}
-
-		query = `
-			SELECT 
-				l.id, l.book_id, l.user_id, l.lent_to, l.lent_at, l.due_date, l.returned_at,
-				b.id, b.title, b.author, b.isbn, b.genre, b.read
-			FROM lending l
-			JOIN books b ON l.book_id = b.id
-			WHERE l.user_id = ? AND l.book_id = ?
-			ORDER BY l.lent_at DESC
-		`
-		args = []interface{}{userID, bookID}
-	} else {
-		query = `
-			SELECT 
-				l.id, l.book_id, l.user_id, l.lent_to, l.lent_at, l.due_date, l.returned_at,
-				b.id, b.title, b.author, b.isbn, b.genre, b.read
-			FROM lending l
-			JOIN books b ON l.book_id = b.id
-			WHERE l.user_id = ?
-			ORDER BY l.lent_at DESC
-		`
-		args = []interface{}{userID}
+		bookID = id
 	}
 
-	rows, err := h.DB.Query(query, args...)
+	history, err := h.Lending.ListHistory(r.Context(), userID, bookID)
 	if err != nil {
 		http.Error(w, `{"error":"Failed to fetch lending history"}`, http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	history := []models.LendingWithBook{}
-	for rows.Next() {
-		var lending models.LendingWithBook
-		var book models.Book
-		var readInt int
-		var dueDate, returnedAt sql.NullTime
-
-		if err := rows.Scan(
-			&lending.ID, &lending.BookID, &lending.UserID, &lending.LentTo,
-			&lending.LentAt, &dueDate, &returnedAt,
-			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt,
-		); err != nil {
-			continue
-		}
-
-		book.Read = readInt == 1
-		lending.Book = &book
-
-		if dueDate.Valid {
-			lending.DueDate = &dueDate.Time
-		}
-
-		history = append(history, lending)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestLending(t *testing.T) {
+	api := newTestAPI(t)
+	dune := api.createBook(1, `{"title":"Dune"}`)
+	emma := api.createBook(1, `{"title":"Emma"}`)
+	theirs := api.createBook(2, `{"title":"Hyperion"}`)
+
+	var lending models.Lending
+	body := fmt.Sprintf(`{"book_id":%d,"lent_to":"Alice","due_date":"2030-05-01"}`, dune.ID)
+	if code := api.do(1, "POST", "/api/lending", body, &lending); code != http.StatusCreated {
+		t.Fatalf("lending: got %d", code)
+	}
+	if lending.LentTo != "Alice" || lending.DueDate == nil || lending.DueDate.Format("2006-01-02") != "2030-05-01" {
+		t.Errorf("lending: got %+v", lending)
+	}
+
+	for _, tt := range []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"missing book", `{"book_id":999,"lent_to":"Bob"}`, http.StatusNotFound},
+		{"another user's book", fmt.Sprintf(`{"book_id":%d,"lent_to":"Bob"}`, theirs.ID), http.StatusForbidden},
+		{"already lent", fmt.Sprintf(`{"book_id":%d,"lent_to":"Bob"}`, dune.ID), http.StatusConflict},
+		{"bad due date", fmt.Sprintf(`{"book_id":%d,"lent_to":"Bob","due_date":"01/05/2030"}`, emma.ID), http.StatusBadRequest},
+	} {
+		if code := api.do(1, "POST", "/api/lending", tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	// Each user sees only their own lending
+	var active []models.LendingWithBook
+	if code := api.do(1, "GET", "/api/lending", "", &active); code != http.StatusOK {
+		t.Fatalf("listing: got %d", code)
+	}
+	if len(active) != 1 || active[0].ID != lending.ID || active[0].Book == nil || active[0].Book.Title != "Dune" {
+		t.Errorf("active lending %+v", active)
+	}
+	if code := api.do(2, "GET", "/api/lending", "", &active); code != http.StatusOK || len(active) != 0 {
+		t.Errorf("other user: got %d, %d records", code, len(active))
+	}
+	var history []models.LendingWithBook
+	if code := api.do(2, "GET", fmt.Sprintf("/api/lending/history/%d", dune.ID), "", &history); code != http.StatusOK || len(history) != 0 {
+		t.Errorf("other user's history: got %d, %d records", code, len(history))
+	}
+
+	// Only the lender can mark a book returned
+	path := fmt.Sprintf("/api/lending/%d", lending.ID)
+	if code := api.do(2, "DELETE", path, "", nil); code != http.StatusForbidden {
+		t.Errorf("returning as another user: got %d, want %d", code, http.StatusForbidden)
+	}
+	if code := api.do(1, "DELETE", "/api/lending/abc", "", nil); code != http.StatusBadRequest {
+		t.Errorf("bad ID: got %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusNoContent {
+		t.Fatalf("returning: got %d", code)
+	}
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("returning twice: got %d, want %d", code, http.StatusNotFound)
+	}
+
+	// A returned book leaves the active list but stays in the history, and
+	// can be lent again
+	if code := api.do(1, "GET", "/api/lending", "", &active); code != http.StatusOK || len(active) != 0 {
+		t.Errorf("after return: got %d, %d active", code, len(active))
+	}
+	if code := api.do(1, "GET", fmt.Sprintf("/api/lending/history/%d", dune.ID), "", &history); code != http.StatusOK || len(history) != 1 {
+		t.Errorf("history: got %d, %d records", code, len(history))
+	}
+	if code := api.do(1, "GET", "/api/lending/history/abc", "", nil); code != http.StatusBadRequest {
+		t.Errorf("history with bad ID: got %d, want %d", code, http.StatusBadRequest)
+	}
+	body = fmt.Sprintf(`{"book_id":%d,"lent_to":"Bob"}`, dune.ID)
+	if code := api.do(1, "POST", "/api/lending", body, nil); code != http.StatusCreated {
+		t.Errorf("lending again: got %d", code)
+	}
+	if code := api.do(1, "GET", "/api/lending/history", "", &history); code != http.StatusOK || len(history) != 2 {
+		t.Errorf("full history: got %d, %d records", code, len(history))
+	}
+}
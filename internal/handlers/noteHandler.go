@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"booklib/internal/kindle"
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/notes"
+	"booklib/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// NoteHandler manages the notes, quotes and highlights users keep on their
+// books.
+type NoteHandler struct {
+	Books store.BookStore
+	Notes store.NoteStore
+}
+
+// maxNoteResults caps the limit parameter of Search.
+const maxNoteResults = 100
+
+// List returns a book's notes by page, those without one last
+func (h *NoteHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.Books.Get(r.Context(), userID, bookID); errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
+
+	list, err := h.Notes.ListForBook(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch notes"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// decodeNote reads a note from the request body and validates it.
+func decodeNote(w http.ResponseWriter, r *http.Request) (*models.Note, bool) {
+	var req models.NoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	note := &models.Note{SessionID: req.SessionID, Type: req.Type, Page: req.Page, Location: req.Location,
+		Body: req.Body}
+	err := notes.Validate(note)
+	switch {
+	case errors.Is(err, notes.ErrInvalidType):
+		http.Error(w, `{"error":"Invalid note: types are quote, highlight and note"}`, http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, notes.ErrInvalidBody):
+		http.Error(w, `{"error":"Invalid note: bodies must be 1 to 20000 characters"}`, http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, notes.ErrInvalidPage):
+		http.Error(w, `{"error":"Invalid note: pages and locations start at 1"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	return note, true
+}
+
+// Create adds a note to a book, optionally tied to one of its reading
+// sessions
+func (h *NoteHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+	note, ok := decodeNote(w, r)
+	if !ok {
+		return
+	}
+
+	note.BookID = bookID
+	err = h.Notes.Create(r.Context(), userID, note, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book or reading session not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to create note"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *NoteHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	noteID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid note ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	note, err := h.Notes.Get(r.Context(), userID, noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Note not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch note"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+// Update replaces a note's session, type, page, location and body
+func (h *NoteHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	noteID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid note ID"}`, http.StatusBadRequest)
+		return
+	}
+	note, ok := decodeNote(w, r)
+	if !ok {
+		return
+	}
+
+	note.ID = noteID
+	err = h.Notes.Update(r.Context(), userID, note, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Note or reading session not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to update note"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(note)
+}
+
+func (h *NoteHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	noteID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid note ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Notes.Delete(r.Context(), userID, noteID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Note not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete note"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Note deleted successfully"})
+}
+
+// Search finds the user's notes containing words starting with each word of
+// q, best match first, with an excerpt of each. It accepts book_id, type and
+// limit filters
+func (h *NoteHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	params := r.URL.Query()
+
+	q := store.NoteQuery{Search: strings.TrimSpace(params.Get("q")), Type: params.Get("type"), Limit: 20}
+	if q.Search == "" {
+		http.Error(w, `{"error":"Search query required"}`, http.StatusBadRequest)
+		return
+	}
+	if q.Type != "" && !slices.Contains(notes.Types, q.Type) {
+		http.Error(w, `{"error":"type must be quote, highlight or note"}`, http.StatusBadRequest)
+		return
+	}
+	if value := params.Get("book_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			http.Error(w, `{"error":"book_id must be a positive number"}`, http.StatusBadRequest)
+			return
+		}
+		q.BookID = id
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxNoteResults {
+			http.Error(w, `{"error":"limit must be between 1 and `+strconv.Itoa(maxNoteResults)+`"}`, http.StatusBadRequest)
+			return
+		}
+		q.Limit = limit
+	}
+
+	matches, err := h.Notes.Search(r.Context(), userID, q)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to search notes"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matches)
+}
+
+// unsafeFilename matches runs of characters kept out of download names.
+var unsafeFilename = regexp.MustCompile(`[^\pL\pN]+`)
+
+// Export downloads a book's notes as a Markdown document
+func (h *NoteHandler) Export(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.Books.Get(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
+	list, err := h.Notes.ListForBook(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch notes"}`, http.StatusInternalServerError)
+		return
+	}
+
+	filename := strings.Trim(unsafeFilename.ReplaceAllString(strings.ToLower(book.Title), "-"), "-")
+	if filename == "" {
+		filename = "book-" + strconv.Itoa(book.ID)
+	}
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`-notes.md"`)
+	w.Write([]byte(notes.Markdown(book, list)))
+}
+
+// ImportKindle imports the highlights and notes in a Kindle "My
+// Clippings.txt" file onto the books in the library they were taken from,
+// matched by title and author. Clippings of books that don't match are left
+// out, as are those imported before. With ?dry_run=true nothing is written
+// and the response previews what would be imported
+func (h *NoteHandler) ImportKindle(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	file, err := uploadedFile(w, r, maxImportSize)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid upload"}`, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	clippings, skipped, err := kindle.Parse(file)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid clippings file"}`, http.StatusBadRequest)
+		return
+	}
+	books, err := h.Books.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch books"}`, http.StatusInternalServerError)
+		return
+	}
+	imported, err := h.Notes.ImportKeys(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to check for imported clippings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	result := &models.ClippingsResult{DryRun: dryRun, Skipped: skipped, Books: []models.ClippingsBook{}}
+	groups := make(map[[2]string]int)
+	var pending []*models.Note
+	var pendingGroups []int
+	for _, c := range clippings {
+		name := [2]string{c.Title, c.Author}
+		i, ok := groups[name]
+		if !ok {
+			i = len(result.Books)
+			groups[name] = i
+			group := models.ClippingsBook{Title: c.Title, Author: c.Author}
+			if book := kindle.Match(books, c.Title, c.Author); book != nil {
+				group.BookID = book.ID
+				group.BookTitle = book.Title
+			}
+			result.Books = append(result.Books, group)
+		}
+		group := &result.Books[i]
+		group.Clippings++
+
+		switch {
+		case group.BookID == 0:
+			result.Unmatched++
+		case imported[c.Key]:
+			// Seen in an earlier import or earlier in this file
+			group.Duplicates++
+			result.Duplicates++
+		default:
+			imported[c.Key] = true
+			key := c.Key
+			pending = append(pending, &models.Note{
+				BookID:    group.BookID,
+				Type:      c.Type,
+				Page:      c.Page,
+				Location:  c.Location,
+				Body:      c.Body,
+				ImportKey: &key,
+				CreatedAt: c.AddedAt,
+			})
+			pendingGroups = append(pendingGroups, i)
+		}
+	}
+
+	status := http.StatusOK
+	if !dryRun && len(pending) > 0 {
+		if err := h.Notes.Import(r.Context(), userID, pending, time.Now()); err != nil {
+			http.Error(w, `{"error":"Failed to import clippings"}`, http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusCreated
+	}
+	for i, note := range pending {
+		group := &result.Books[pendingGroups[i]]
+		if dryRun || note.ID != 0 {
+			group.Created++
+			result.Created++
+		} else {
+			// Another request imported it after the check
+			group.Duplicates++
+			result.Duplicates++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,20 +1,24 @@
 package handlers
 
 import (
-	"database/sql"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
 	"booklib/internal/middleware"
 	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/store"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type ReadingHistoryHandler struct {
-	DB *sql.DB
+	Books   store.BookStore
+	Reading store.ReadingStore
 }
 
 // StartReading creates a new reading history entry with started_at timestamp
@@ -28,9 +32,8 @@ func (h *ReadingHistoryHandler) StartReading(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Verify the book belongs to the user
-	var bookUserID int
-	err := h.DB.QueryRow("SELECT user_id FROM books WHERE id = ?", req.BookID).Scan(&bookUserID)
-	if err == sql.ErrNoRows {
+	bookUserID, err := h.Books.OwnerID(r.Context(), req.BookID)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
 		return
 	}
@@ -44,41 +47,19 @@ func (h *ReadingHistoryHandler) StartReading(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Check if there's already an active reading session (started but not completed)
-	var activeSessionID int
-	err = h.DB.QueryRow(`
-		SELECT id FROM reading_history 
-		WHERE book_id = ? AND user_id = ? AND completed_at IS NULL
-		ORDER BY started_at DESC LIMIT 1
-	`, req.BookID, userID).Scan(&activeSessionID)
-
-	if err == nil {
-		// Active session exists, return it
+	if _, err := h.Reading.Active(r.Context(), userID, req.BookID); err == nil {
 		http.Error(w, `{"error":"Already have an active reading session for this book"}`, http.StatusConflict)
 		return
 	}
 
-	// Create new reading history entry
-	result, err := h.DB.Exec(`
-		INSERT INTO reading_history (book_id, user_id, started_at)
-		VALUES (?, ?, ?)
-	`, req.BookID, userID, time.Now())
-
-	if err != nil {
-		http.Error(w, `{"error":"Failed to start reading session"}`, http.StatusInternalServerError)
+	// Create new reading history entry, moving the book to reading
+	history, err := h.Reading.Start(r.Context(), userID, req.BookID, time.Now())
+	if errors.Is(err, reading.ErrInvalidTransition) {
+		http.Error(w, `{"error":"This book can't be started from its current status"}`, http.StatusConflict)
 		return
 	}
-
-	id, _ := result.LastInsertId()
-
-	// Return the created reading history entry
-	var history models.ReadingHistory
-	err = h.DB.QueryRow(`
-		SELECT id, book_id, user_id, started_at, completed_at
-		FROM reading_history WHERE id = ?
-	`, id).Scan(&history.ID, &history.BookID, &history.UserID, &history.StartedAt, &history.CompletedAt)
-
 	if err != nil {
-		http.Error(w, `{"error":"Failed to retrieve reading session"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to start reading session"}`, http.StatusInternalServerError)
 		return
 	}
 
@@ -87,84 +68,172 @@ func (h *ReadingHistoryHandler) StartReading(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(history)
 }
 
-// FinishReading marks a reading history entry as completed
+// FinishReading marks a reading history entry as completed, saving the
+// review sent along with it if any
 func (h *ReadingHistoryHandler) FinishReading(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
-	historyID, err := strconv.Atoi(chi.URLParam(r, "id"))
-	if err != nil {
-		http.Error(w, `{"error":"Invalid reading history ID"}`, http.StatusBadRequest)
-		return
-	}
 
 	// Verify the reading history belongs to the user and is not already completed
-	var historyUserID int
-	var completedAt sql.NullTime
-	err = h.DB.QueryRow(`
-		SELECT user_id, completed_at FROM reading_history WHERE id = ?
-	`, historyID).Scan(&historyUserID, &completedAt)
-
-	if err == sql.ErrNoRows {
-		http.Error(w, `{"error":"Reading history not found"}`, http.StatusNotFound)
+	existing := h.sessionForUser(w, r, userID)
+	if existing == nil {
 		return
 	}
-	if err != nil {
-		http.Error(w, `{"error":"Failed to verify reading history"}`, http.StatusInternalServerError)
+	if existing.CompletedAt != nil {
+		http.Error(w, `{"error":"Reading session already completed"}`, http.StatusConflict)
 		return
 	}
-	if historyUserID != userID {
-		http.Error(w, `{"error":"Unauthorized"}`, http.StatusForbidden)
+	if existing.AbandonedAt != nil {
+		http.Error(w, `{"error":"Reading session was abandoned"}`, http.StatusConflict)
 		return
 	}
-	if completedAt.Valid {
-		http.Error(w, `{"error":"Reading session already completed"}`, http.StatusConflict)
+
+	// The body is optional
+	var req models.FinishReadingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
 		return
 	}
+	var review *models.Review
+	if req.Review != nil {
+		checked, err := reading.NewReview(*req.Review)
+		if err != nil {
+			http.Error(w, `{"error":"Invalid review: `+err.Error()+`"}`, http.StatusBadRequest)
+			return
+		}
+		review = &checked
+	}
 
-	// Get the book_id from the reading history
-	var bookID int
-	err = h.DB.QueryRow(`
-		SELECT book_id FROM reading_history WHERE id = ?
-	`, historyID).Scan(&bookID)
-
+	// Mark reading session as completed and the book as finished, saving
+	// the review along with them
+	history, err := h.Reading.Finish(r.Context(), existing.ID, review, time.Now())
+	if errors.Is(err, reading.ErrInvalidTransition) {
+		http.Error(w, `{"error":"This book can't be finished from its current status"}`, http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error":"Failed to get book ID"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to complete reading session"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Mark reading session as completed
-	_, err = h.DB.Exec(`
-		UPDATE reading_history SET completed_at = ? WHERE id = ?
-	`, time.Now(), historyID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.ReviewedSession{ReadingHistory: *history, Review: review})
+}
 
+// decodeSession reads a session's times from the request body and checks
+// them, returning the session and the book ID given with it.
+func decodeSession(w http.ResponseWriter, r *http.Request) (*models.ReadingHistory, int, bool) {
+	var req models.SessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return nil, 0, false
+	}
+	// Times are stored in UTC so sessions sort by when they happened
+	utc := func(t *time.Time) *time.Time {
+		if t == nil {
+			return nil
+		}
+		u := t.UTC()
+		return &u
+	}
+	session := &models.ReadingHistory{CompletedAt: utc(req.CompletedAt), AbandonedAt: utc(req.AbandonedAt)}
+	if req.StartedAt != nil {
+		session.StartedAt = req.StartedAt.UTC()
+	}
+	if err := reading.CheckSession(*session, time.Now()); err != nil {
+		http.Error(w, `{"error":"Invalid reading session: `+err.Error()+`"}`, http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return session, req.BookID, true
+}
+
+// LogSession records a reading session with the times given, such as a book
+// read before it was added to the library, and re-derives the book's
+// reading status and read flag from its sessions
+func (h *ReadingHistoryHandler) LogSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	session, bookID, ok := decodeSession(w, r)
+	if !ok {
+		return
+	}
+
+	session.BookID = bookID
+	state, err := h.Reading.LogSession(r.Context(), userID, session, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, reading.ErrOverlap) {
+		http.Error(w, `{"error":"Reading session overlaps another session of this book"}`, http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error":"Failed to complete reading session"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to log reading session"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Mark the book as read
-	_, err = h.DB.Exec(`
-		UPDATE books SET read = TRUE WHERE id = ? AND user_id = ?
-	`, bookID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.EditedSession{ReadingHistory: *session, ReadState: state})
+}
+
+// EditSession replaces a reading session's started_at, completed_at and
+// abandoned_at, and re-derives the book's reading status and read flag from
+// its sessions
+func (h *ReadingHistoryHandler) EditSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	existing := h.sessionForUser(w, r, userID)
+	if existing == nil {
+		return
+	}
+	session, _, ok := decodeSession(w, r)
+	if !ok {
+		return
+	}
 
+	session.ID = existing.ID
+	state, err := h.Reading.EditSession(r.Context(), userID, session, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Reading history not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, reading.ErrOverlap) {
+		http.Error(w, `{"error":"Reading session overlaps another session of this book"}`, http.StatusConflict)
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error":"Failed to mark book as read"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to update reading session"}`, http.StatusInternalServerError)
 		return
 	}
 
-	// Return the updated reading history entry
-	var history models.ReadingHistory
-	err = h.DB.QueryRow(`
-		SELECT id, book_id, user_id, started_at, completed_at
-		FROM reading_history WHERE id = ?
-	`, historyID).Scan(&history.ID, &history.BookID, &history.UserID, &history.StartedAt, &history.CompletedAt)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.EditedSession{ReadingHistory: *session, ReadState: state})
+}
 
+// DeleteSession removes a reading session with its progress and review and
+// re-derives the book's reading status and read flag from the sessions left
+func (h *ReadingHistoryHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	existing := h.sessionForUser(w, r, userID)
+	if existing == nil {
+		return
+	}
+
+	state, err := h.Reading.DeleteSession(r.Context(), userID, existing.ID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Reading history not found"}`, http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, `{"error":"Failed to retrieve reading session"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":"Failed to delete reading session"}`, http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(history)
+	json.NewEncoder(w).Encode(map[string]any{
+		"message": "Reading session deleted successfully",
+		"status":  state.Status,
+		"read":    state.Read,
+	})
 }
 
 // GetBookReadingHistory returns all reading history for a specific book
@@ -177,45 +246,33 @@ func (h *ReadingHistoryHandler) GetBookReadingHistory(w http.ResponseWriter, r *
 	}
 
 	// Verify the book belongs to the user
-	var bookUserID int
-	err = h.DB.QueryRow("SELECT user_id FROM books WHERE id = ?", bookID).Scan(&bookUserID)
-	if err == sql.ErrNoRows {
+	bookUserID, err := h.Books.OwnerID(r.Context(), bookID)
+	if errors.Is(err, store.ErrNotFound) {
 		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to verify book ownership"}`, http.StatusInternalServerError)
+		return
+	}
 	if bookUserID != userID {
 		http.Error(w, `{"error":"Unauthorized"}`, http.StatusForbidden)
 		return
 	}
 
 	// Get all reading history for this book
-	rows, err := h.DB.Query(`
-		SELECT id, book_id, user_id, started_at, completed_at
-		FROM reading_history 
-		WHERE book_id = ? AND user_id = ?
-		ORDER BY started_at DESC
-	`, bookID, userID)
-
+	history, err := h.Reading.ListForBook(r.Context(), userID, bookID)
 	if err != nil {
 		http.Error(w, `{"error":"Failed to fetch reading history"}`, http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	history := []models.ReadingHistory{}
-	for rows.Next() {
-		var h models.ReadingHistory
-		if err := rows.Scan(&h.ID, &h.BookID, &h.UserID, &h.StartedAt, &h.CompletedAt); err != nil {
-			continue
-		}
-		history = append(history, h)
-	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(history)
 }
 
 // GetActiveReadingSession returns the current active reading session for a book (if any)
+// with its progress updates, reading pace and estimated finish date
 func (h *ReadingHistoryHandler) GetActiveReadingSession(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
 	bookID, err := strconv.Atoi(chi.URLParam(r, "bookId"))
@@ -225,15 +282,8 @@ func (h *ReadingHistoryHandler) GetActiveReadingSession(w http.ResponseWriter, r
 	}
 
 	// Get active reading session (started but not completed)
-	var history models.ReadingHistory
-	err = h.DB.QueryRow(`
-		SELECT id, book_id, user_id, started_at, completed_at
-		FROM reading_history 
-		WHERE book_id = ? AND user_id = ? AND completed_at IS NULL
-		ORDER BY started_at DESC LIMIT 1
-	`, bookID, userID).Scan(&history.ID, &history.BookID, &history.UserID, &history.StartedAt, &history.CompletedAt)
-
-	if err == sql.ErrNoRows {
+	history, err := h.Reading.Active(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
 		// No active session
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(nil)
@@ -244,6 +294,261 @@ func (h *ReadingHistoryHandler) GetActiveReadingSession(w http.ResponseWriter, r
 		return
 	}
 
+	session := models.ActiveSession{ReadingHistory: *history}
+	session.Progress, err = h.Reading.Progress(r.Context(), history.ID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch reading progress"}`, http.StatusInternalServerError)
+		return
+	}
+	changes, err := h.Reading.StatusChanges(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch status changes"}`, http.StatusInternalServerError)
+		return
+	}
+	book, err := h.Books.Get(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
+	session.Pace = reading.Pace(*history, session.Progress, changes, book.PageCount, time.Now())
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(history)
+	json.NewEncoder(w).Encode(session)
+}
+
+// sessionForUser fetches a reading session, writing the error response and
+// returning nil if it doesn't exist or isn't the user's
+func (h *ReadingHistoryHandler) sessionForUser(w http.ResponseWriter, r *http.Request, userID int) *models.ReadingHistory {
+	historyID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid reading history ID"}`, http.StatusBadRequest)
+		return nil
+	}
+
+	history, err := h.Reading.Get(r.Context(), historyID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Reading history not found"}`, http.StatusNotFound)
+		return nil
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to verify reading history"}`, http.StatusInternalServerError)
+		return nil
+	}
+	if history.UserID != userID {
+		http.Error(w, `{"error":"Unauthorized"}`, http.StatusForbidden)
+		return nil
+	}
+	return history
+}
+
+// AddProgress records how far a session in progress has got, as a page, a
+// percent or an ebook location
+func (h *ReadingHistoryHandler) AddProgress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	history := h.sessionForUser(w, r, userID)
+	if history == nil {
+		return
+	}
+	if !reading.InProgress(*history) {
+		http.Error(w, `{"error":"Reading session has already ended"}`, http.StatusConflict)
+		return
+	}
+
+	var req models.ProgressRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.Books.Get(r.Context(), userID, history.BookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
+	progress, err := reading.NewProgress(req, book.PageCount)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid progress: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	progress.SessionID = history.ID
+	progress.RecordedAt = time.Now()
+	if err := h.Reading.AddProgress(r.Context(), userID, &progress); err != nil {
+		http.Error(w, `{"error":"Failed to record progress"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(progress)
+}
+
+// GetProgress returns a session's progress updates, oldest first
+func (h *ReadingHistoryHandler) GetProgress(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	history := h.sessionForUser(w, r, userID)
+	if history == nil {
+		return
+	}
+
+	progress, err := h.Reading.Progress(r.Context(), history.ID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch reading progress"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(progress)
+}
+
+// GetReview returns a session's review with its earlier versions
+func (h *ReadingHistoryHandler) GetReview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	history := h.sessionForUser(w, r, userID)
+	if history == nil {
+		return
+	}
+
+	review, err := h.Reading.Review(r.Context(), history.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Review not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch review"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// SaveReview rates and reviews a session that has ended, keeping the
+// version it replaces when the session was already reviewed
+func (h *ReadingHistoryHandler) SaveReview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	history := h.sessionForUser(w, r, userID)
+	if history == nil {
+		return
+	}
+	if reading.InProgress(*history) {
+		http.Error(w, `{"error":"Reading session is still in progress"}`, http.StatusConflict)
+		return
+	}
+
+	var req models.ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	review, err := reading.NewReview(req)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid review: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	review.SessionID = history.ID
+	if err := h.Reading.SaveReview(r.Context(), userID, &review, time.Now()); err != nil {
+		http.Error(w, `{"error":"Failed to save review"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(review)
+}
+
+// DeleteReview removes a session's review and its earlier versions
+func (h *ReadingHistoryHandler) DeleteReview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	history := h.sessionForUser(w, r, userID)
+	if history == nil {
+		return
+	}
+
+	err := h.Reading.DeleteReview(r.Context(), history.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Review not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete review"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Review deleted successfully"})
+}
+
+// GetStatus returns a book's reading status, the statuses it can move to
+// and its status changes, oldest first
+func (h *ReadingHistoryHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "bookId"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	book, err := h.Books.Get(r.Context(), userID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch book"}`, http.StatusInternalServerError)
+		return
+	}
+
+	changes, err := h.Reading.StatusChanges(r.Context(), userID, bookID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch status changes"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.BookStatus{
+		BookID:    book.ID,
+		Status:    book.Status,
+		ChangedAt: book.StatusChangedAt,
+		Next:      reading.Next(book.Status),
+		Changes:   changes,
+	})
+}
+
+// SetStatus moves a book to another reading status, starting, resuming or
+// ending its reading session as needed, and returns the change
+func (h *ReadingHistoryHandler) SetStatus(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	bookID, err := strconv.Atoi(chi.URLParam(r, "bookId"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	var req models.StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if !reading.Valid(req.Status) {
+		http.Error(w, `{"error":"Invalid status: use want_to_read, reading, paused, finished or did_not_finish"}`, http.StatusBadRequest)
+		return
+	}
+
+	change, err := h.Reading.SetStatus(r.Context(), userID, bookID, req.Status, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, reading.ErrInvalidTransition) {
+		http.Error(w, `{"error":"This book can't move to that status from its current one"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to change reading status"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
 }
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+func TestReadingFlow(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	bookPath := "/api/books/" + strconv.Itoa(book.ID)
+	start := `{"book_id":` + strconv.Itoa(book.ID) + `}`
+
+	var session models.ReadingHistory
+	if code := api.do(1, "POST", "/api/reading-history/start", start, &session); code != http.StatusCreated {
+		t.Fatalf("start: got %d", code)
+	}
+	if code := api.do(1, "POST", "/api/reading-history/start", start, nil); code != http.StatusConflict {
+		t.Errorf("second start: got %d, want %d", code, http.StatusConflict)
+	}
+
+	var finished models.ReadingHistory
+	if code := api.do(1, "PUT", "/api/reading-history/"+strconv.Itoa(session.ID)+"/finish", "", &finished); code != http.StatusOK {
+		t.Fatalf("finish: got %d", code)
+	}
+	if finished.CompletedAt == nil {
+		t.Errorf("finish returned %+v", finished)
+	}
+	var got models.Book
+	api.do(1, "GET", bookPath, "", &got)
+	if got.Status != "finished" || !got.Read {
+		t.Errorf("after finishing the book is %s, read %v", got.Status, got.Read)
+	}
+
+	// A re-read keeps the book read, since it was finished before
+	if code := api.do(1, "POST", "/api/reading-history/start", start, nil); code != http.StatusCreated {
+		t.Fatalf("re-read: got %d", code)
+	}
+	api.do(1, "GET", bookPath, "", &got)
+	if got.Status != "reading" || !got.Read {
+		t.Errorf("while re-reading the book is %s, read %v", got.Status, got.Read)
+	}
+
+	var history []models.ReadingHistory
+	api.do(1, "GET", "/api/reading-history/book/"+strconv.Itoa(book.ID), "", &history)
+	if len(history) != 2 {
+		t.Errorf("got %d sessions, want 2", len(history))
+	}
+	var status models.BookStatus
+	api.do(1, "GET", "/api/reading-history/book/"+strconv.Itoa(book.ID)+"/status", "", &status)
+	var moves []string
+	for _, c := range status.Changes {
+		moves = append(moves, c.From+">"+c.To)
+	}
+	want := []string{"want_to_read>reading", "reading>finished", "finished>reading"}
+	if len(moves) != len(want) {
+		t.Fatalf("status changes %v, want %v", moves, want)
+	}
+	for i := range want {
+		if moves[i] != want[i] {
+			t.Errorf("status changes %v, want %v", moves, want)
+			break
+		}
+	}
+}
+
+func TestFinishReading(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	start := `{"book_id":` + strconv.Itoa(book.ID) + `}`
+	var session models.ReadingHistory
+	api.do(1, "POST", "/api/reading-history/start", start, &session)
+	sessionPath := "/api/reading-history/" + strconv.Itoa(session.ID)
+
+	// An invalid review leaves the session in progress
+	if code := api.do(1, "PUT", sessionPath+"/finish", `{"review":{"rating":7}}`, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid review: got %d, want %d", code, http.StatusBadRequest)
+	}
+	var got models.Book
+	api.do(1, "GET", "/api/books/"+strconv.Itoa(book.ID), "", &got)
+	if got.Status != "reading" || got.Read {
+		t.Errorf("after the invalid review the book is %s, read %v", got.Status, got.Read)
+	}
+
+	var finished models.ReviewedSession
+	if code := api.do(1, "PUT", sessionPath+"/finish", `{"review":{"rating":4.5,"body":"Spice"}}`, &finished); code != http.StatusOK {
+		t.Fatalf("finish: got %d", code)
+	}
+	if finished.CompletedAt == nil || finished.Review == nil || *finished.Review.Rating != 4.5 {
+		t.Errorf("finish returned %+v", finished)
+	}
+	var review models.Review
+	if code := api.do(1, "GET", sessionPath+"/review", "", &review); code != http.StatusOK || review.Body != "Spice" {
+		t.Errorf("review: got %d, %+v", code, review)
+	}
+	if code := api.do(1, "PUT", sessionPath+"/finish", "", nil); code != http.StatusConflict {
+		t.Errorf("second finish: got %d, want %d", code, http.StatusConflict)
+	}
+
+	// A re-read finished without a body has no review
+	api.do(1, "POST", "/api/reading-history/start", start, &session)
+	sessionPath = "/api/reading-history/" + strconv.Itoa(session.ID)
+	if code := api.do(1, "PUT", sessionPath+"/finish", "", nil); code != http.StatusOK {
+		t.Fatalf("finish without a body: got %d", code)
+	}
+	if code := api.do(1, "GET", sessionPath+"/review", "", nil); code != http.StatusNotFound {
+		t.Errorf("review of a session finished without one: got %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestLoggedSessions(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	id := strconv.Itoa(book.ID)
+
+	var first models.EditedSession
+	code := api.do(1, "POST", "/api/reading-history",
+		`{"book_id":`+id+`,"started_at":"2020-01-01T00:00:00Z","completed_at":"2020-02-01T00:00:00Z"}`, &first)
+	if code != http.StatusCreated {
+		t.Fatalf("log: got %d", code)
+	}
+	if first.Status != "finished" || !first.Read {
+		t.Errorf("after logging a finished session the book is %s, read %v", first.Status, first.Read)
+	}
+	// The move is dated when the session ended, not when it was logged
+	var got models.Book
+	api.do(1, "GET", "/api/books/"+id, "", &got)
+	if want := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC); got.StatusChangedAt == nil || !got.StatusChangedAt.Equal(want) {
+		t.Errorf("status_changed_at is %v, want %v", got.StatusChangedAt, want)
+	}
+
+	rejected := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"overlapping", `{"book_id":` + id + `,"started_at":"2020-01-15T00:00:00Z","completed_at":"2020-03-01T00:00:00Z"}`, http.StatusConflict},
+		{"in the future", `{"book_id":` + id + `,"started_at":"2999-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"ending before it started", `{"book_id":` + id + `,"started_at":"2021-02-01T00:00:00Z","completed_at":"2021-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"completed and abandoned", `{"book_id":` + id + `,"started_at":"2021-01-01T00:00:00Z","completed_at":"2021-02-01T00:00:00Z","abandoned_at":"2021-02-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"without a start", `{"book_id":` + id + `}`, http.StatusBadRequest},
+	}
+	for _, tt := range rejected {
+		if code := api.do(1, "POST", "/api/reading-history", tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	var second models.EditedSession
+	api.do(1, "POST", "/api/reading-history", `{"book_id":`+id+`,"started_at":"2021-01-01T00:00:00Z"}`, &second)
+	if second.Status != "reading" || !second.Read {
+		t.Errorf("while re-reading the book is %s, read %v", second.Status, second.Read)
+	}
+
+	var edited models.EditedSession
+	code = api.do(1, "PUT", "/api/reading-history/"+strconv.Itoa(second.ID),
+		`{"started_at":"2021-01-01T00:00:00Z","abandoned_at":"2021-03-01T00:00:00Z"}`, &edited)
+	if code != http.StatusOK {
+		t.Fatalf("edit: got %d", code)
+	}
+	if edited.Status != "did_not_finish" || !edited.Read {
+		t.Errorf("after abandoning the re-read the book is %s, read %v", edited.Status, edited.Read)
+	}
+
+	var deleted models.ReadState
+	api.do(1, "DELETE", "/api/reading-history/"+strconv.Itoa(first.ID), "", &deleted)
+	if deleted.Status != "did_not_finish" || deleted.Read {
+		t.Errorf("without the finished session the book is %s, read %v", deleted.Status, deleted.Read)
+	}
+	api.do(1, "DELETE", "/api/reading-history/"+strconv.Itoa(second.ID), "", &deleted)
+	if deleted.Status != "want_to_read" || deleted.Read {
+		t.Errorf("without sessions the book is %s, read %v", deleted.Status, deleted.Read)
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		moves  []string
+		status string
+		want   int
+	}{
+		{"start", nil, "reading", http.StatusOK},
+		{"finish unread", nil, "finished", http.StatusConflict},
+		{"pause", []string{"reading"}, "paused", http.StatusOK},
+		{"abandon paused", []string{"reading", "paused"}, "did_not_finish", http.StatusOK},
+		{"back to the pile", []string{"reading", "finished"}, "want_to_read", http.StatusOK},
+		{"pause finished", []string{"reading", "finished"}, "paused", http.StatusConflict},
+		{"unknown", nil, "skimmed", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			book := api.createBook(1, `{"title":"Dune"}`)
+			path := "/api/reading-history/book/" + strconv.Itoa(book.ID) + "/status"
+			for _, status := range tt.moves {
+				if code := api.do(1, "PUT", path, `{"status":"`+status+`"}`, nil); code != http.StatusOK {
+					t.Fatalf("moving to %s: got %d", status, code)
+				}
+			}
+			if code := api.do(1, "PUT", path, `{"status":"`+tt.status+`"}`, nil); code != tt.want {
+				t.Errorf("got %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadingOwnership(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune"}`)
+	id := strconv.Itoa(book.ID)
+	var session models.ReadingHistory
+	api.do(1, "POST", "/api/reading-history/start", `{"book_id":`+id+`}`, &session)
+	sessionPath := "/api/reading-history/" + strconv.Itoa(session.ID)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"POST", "/api/reading-history/start", `{"book_id":` + id + `}`, http.StatusForbidden},
+		{"POST", "/api/reading-history", `{"book_id":` + id + `,"started_at":"2020-01-01T00:00:00Z"}`, http.StatusNotFound},
+		{"PUT", sessionPath + "/finish", "", http.StatusForbidden},
+		{"PUT", sessionPath, `{"started_at":"2020-01-01T00:00:00Z"}`, http.StatusForbidden},
+		{"DELETE", sessionPath, "", http.StatusForbidden},
+		{"GET", "/api/reading-history/book/" + id, "", http.StatusForbidden},
+		{"GET", "/api/reading-history/book/" + id + "/status", "", http.StatusNotFound},
+		{"PUT", "/api/reading-history/book/" + id + "/status", `{"status":"paused"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := api.do(2, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s %s as another user: got %d, want %d", tt.method, tt.path, code, tt.want)
+		}
+	}
+
+	// Nothing the other user tried went through
+	var history []models.ReadingHistory
+	api.do(1, "GET", "/api/reading-history/book/"+id, "", &history)
+	if len(history) != 1 || history[0].CompletedAt != nil || !history[0].StartedAt.Equal(session.StartedAt) {
+		t.Errorf("owner's sessions are %+v", history)
+	}
+	var got models.Book
+	api.do(1, "GET", "/api/books/"+id, "", &got)
+	if got.Status != "reading" {
+		t.Errorf("owner's book is %s", got.Status)
+	}
+}
@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+	"booklib/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// builtinShelf is a shelf every user has, holding the books that match its
+// query.
+type builtinShelf struct {
+	models.Shelf
+	query store.BookQuery
+}
+
+// builtinShelves are listed before the user's own shelves, newest books
+// first.
+var builtinShelves = []builtinShelf{
+	{
+		Shelf: models.Shelf{Slug: "currently-reading", Name: "Currently reading", Description: "Books you are reading and haven't paused"},
+		query: store.BookQuery{Status: reading.Reading},
+	},
+	{
+		Shelf: models.Shelf{Slug: "want-to-read", Name: "Want to read", Description: "Books waiting to be read"},
+		query: store.BookQuery{Status: reading.WantToRead},
+	},
+	{
+		Shelf: models.Shelf{Slug: "lent-out", Name: "Lent out", Description: "Books lent to someone and not yet returned"},
+		query: store.BookQuery{LentOut: boolPtr(true)},
+	},
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// findBuiltinShelf returns the built-in shelf with the slug, or nil.
+func findBuiltinShelf(slug string) *builtinShelf {
+	for i := range builtinShelves {
+		if builtinShelves[i].Slug == slug {
+			return &builtinShelves[i]
+		}
+	}
+	return nil
+}
+
+// ShelfHandler manages the user's shelves, along with the built-in shelves
+// derived from their reading history and lending.
+type ShelfHandler struct {
+	Books   store.BookStore
+	Shelves store.ShelfStore
+}
+
+// builtinBooks returns the user's books on a built-in shelf, or only their
+// number when withBooks is false.
+func (h *ShelfHandler) builtinBooks(r *http.Request, shelf *builtinShelf, withBooks bool) (*models.ShelfDetail, error) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	q := shelf.query
+	q.Sort, q.Desc = store.SortCreatedAt, true
+	if !withBooks {
+		q.Limit = 1
+	}
+	page, err := h.Books.Query(r.Context(), userID, q)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.ShelfDetail{Shelf: shelf.Shelf, Books: []models.Book{}}
+	detail.Builtin = true
+	detail.BookCount = page.Total
+	if withBooks {
+		detail.Books = page.Books
+	}
+	return detail, nil
+}
+
+// List returns the built-in shelves followed by the user's shelves in their
+// order, each with its number of books.
+func (h *ShelfHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	list := []models.Shelf{}
+	for i := range builtinShelves {
+		detail, err := h.builtinBooks(r, &builtinShelves[i], false)
+		if err != nil {
+			http.Error(w, `{"error":"Failed to fetch shelves"}`, http.StatusInternalServerError)
+			return
+		}
+		list = append(list, detail.Shelf)
+	}
+
+	own, err := h.Shelves.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch shelves"}`, http.StatusInternalServerError)
+		return
+	}
+	list = append(list, own...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Get returns a shelf with its books in shelf order. The ID may be the slug
+// of a built-in shelf.
+func (h *ShelfHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	param := chi.URLParam(r, "id")
+
+	var detail *models.ShelfDetail
+	var err error
+	if builtin := findBuiltinShelf(param); builtin != nil {
+		detail, err = h.builtinBooks(r, builtin, true)
+	} else {
+		shelfID, convErr := strconv.Atoi(param)
+		if convErr != nil {
+			http.Error(w, `{"error":"Shelf not found"}`, http.StatusNotFound)
+			return
+		}
+		detail, err = h.Shelves.Get(r.Context(), userID, shelfID)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// shelfID reads the ID of one of the user's own shelves from the URL.
+// Built-in shelves can't be changed.
+func shelfID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	param := chi.URLParam(r, "id")
+	if findBuiltinShelf(param) != nil {
+		http.Error(w, `{"error":"Built-in shelves can't be changed"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid shelf ID"}`, http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeShelf reads a shelf's name and description from the request body.
+func decodeShelf(w http.ResponseWriter, r *http.Request) (*models.Shelf, bool) {
+	var req models.ShelfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	shelf := &models.Shelf{Name: req.Name, Description: req.Description}
+	switch err := shelves.Validate(shelf); {
+	case errors.Is(err, shelves.ErrInvalidName):
+		http.Error(w, `{"error":"Invalid shelf: names must be 1 to 100 characters"}`, http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, shelves.ErrInvalidDescription):
+		http.Error(w, `{"error":"Invalid shelf: descriptions can be at most 1000 characters"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	return shelf, true
+}
+
+func (h *ShelfHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	shelf, ok := decodeShelf(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Shelves.Create(r.Context(), userID, shelf)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a shelf with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to create shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(shelf)
+}
+
+// Update renames a shelf and replaces its description.
+func (h *ShelfHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	id, ok := shelfID(w, r)
+	if !ok {
+		return
+	}
+	shelf, ok := decodeShelf(w, r)
+	if !ok {
+		return
+	}
+
+	shelf.ID = id
+	err := h.Shelves.Update(r.Context(), userID, shelf)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a shelf with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to update shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shelf)
+}
+
+// Delete deletes a shelf. The books on it are kept.
+func (h *ShelfHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	id, ok := shelfID(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Shelves.Delete(r.Context(), userID, id)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Shelf deleted successfully"})
+}
+
+// Reorder sets the order of the user's shelves. The request must list every
+// one of them; built-in shelves always come first.
+func (h *ShelfHandler) Reorder(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	var req models.ShelfOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.Shelves.Reorder(r.Context(), userID, req.ShelfIDs)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"Invalid order: shelf_ids must list each of your shelves exactly once"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to reorder shelves"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Shelves reordered"})
+}
+
+// AddBook places a book on a shelf, at the given position or at the end.
+func (h *ShelfHandler) AddBook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	id, ok := shelfID(w, r)
+	if !ok {
+		return
+	}
+	var req models.ShelfBookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.BookID == 0 {
+		http.Error(w, `{"error":"Invalid request: book_id is required"}`, http.StatusBadRequest)
+		return
+	}
+	position := -1
+	if req.Position != nil {
+		if *req.Position < 0 {
+			http.Error(w, `{"error":"Invalid request: position can't be negative"}`, http.StatusBadRequest)
+			return
+		}
+		position = *req.Position
+	}
+
+	err := h.Shelves.AddBook(r.Context(), userID, id, req.BookID, position)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Shelf or book not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"Book is already on this shelf"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to add book to shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Book added to shelf"})
+}
+
+// RemoveBook takes a book off a shelf.
+func (h *ShelfHandler) RemoveBook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	id, ok := shelfID(w, r)
+	if !ok {
+		return
+	}
+	bookID, err := strconv.Atoi(chi.URLParam(r, "bookID"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Shelves.RemoveBook(r.Context(), userID, id, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book is not on this shelf"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to remove book from shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Book removed from shelf"})
+}
+
+// ReorderBooks sets the order of the books on a shelf. The request must
+// list every one of them.
+func (h *ShelfHandler) ReorderBooks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	id, ok := shelfID(w, r)
+	if !ok {
+		return
+	}
+	var req models.ShelfBookOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	err := h.Shelves.ReorderBooks(r.Context(), userID, id, req.BookIDs)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"Invalid order: book_ids must list each of the shelf's books exactly once"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to reorder books"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Books reordered"})
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+// shelfBooks returns the IDs of the books on the shelf, in shelf order.
+func (a *testAPI) shelfBooks(userID int, shelf string) []int {
+	a.t.Helper()
+	var detail models.ShelfDetail
+	if code := a.do(userID, "GET", "/api/shelves/"+shelf, "", &detail); code != http.StatusOK {
+		a.t.Fatalf("getting shelf %s: got %d", shelf, code)
+	}
+	var ids []int
+	for _, b := range detail.Books {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+func TestBuiltinShelves(t *testing.T) {
+	api := newTestAPI(t)
+	dune := api.createBook(1, `{"title":"Dune"}`)
+	emma := api.createBook(1, `{"title":"Emma"}`)
+	hobbit := api.createBook(1, `{"title":"The Hobbit"}`)
+	api.createBook(1, `{"title":"Hyperion","read":true}`)
+	api.createBook(2, `{"title":"Dune"}`)
+
+	if code := api.do(1, "POST", "/api/reading-history/start", `{"book_id":`+strconv.Itoa(emma.ID)+`}`, nil); code != http.StatusCreated {
+		t.Fatalf("starting Emma: got %d", code)
+	}
+	lending := &models.Lending{BookID: hobbit.ID, UserID: 1, LentTo: "Anne", LentAt: time.Now()}
+	if err := api.stores.Lending.Create(context.Background(), lending); err != nil {
+		t.Fatal(err)
+	}
+
+	var list []models.Shelf
+	if code := api.do(1, "GET", "/api/shelves", "", &list); code != http.StatusOK {
+		t.Fatalf("list: got %d", code)
+	}
+	var got []string
+	for _, shelf := range list {
+		got = append(got, shelf.Slug+" "+strconv.Itoa(shelf.BookCount))
+		if !shelf.Builtin {
+			t.Errorf("%s isn't built in", shelf.Name)
+		}
+	}
+	if want := []string{"currently-reading 1", "want-to-read 2", "lent-out 1"}; !slices.Equal(got, want) {
+		t.Errorf("built-in shelves %q, want %q", got, want)
+	}
+
+	// Newest first
+	tests := map[string][]int{
+		"currently-reading": {emma.ID},
+		"want-to-read":      {hobbit.ID, dune.ID},
+		"lent-out":          {hobbit.ID},
+	}
+	for slug, want := range tests {
+		if got := api.shelfBooks(1, slug); !slices.Equal(got, want) {
+			t.Errorf("%s holds %v, want %v", slug, got, want)
+		}
+	}
+	if got := api.shelfBooks(2, "lent-out"); len(got) != 0 {
+		t.Errorf("another user's lent-out shelf holds %v", got)
+	}
+
+	for _, req := range []struct{ method, path, body string }{
+		{"PUT", "/api/shelves/want-to-read", `{"name":"Later"}`},
+		{"DELETE", "/api/shelves/lent-out", ""},
+		{"POST", "/api/shelves/currently-reading/books", `{"book_id":` + strconv.Itoa(dune.ID) + `}`},
+	} {
+		if code := api.do(1, req.method, req.path, req.body, nil); code != http.StatusBadRequest {
+			t.Errorf("%s %s: got %d, want %d", req.method, req.path, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestShelves(t *testing.T) {
+	api := newTestAPI(t)
+	var ids []int
+	for _, title := range []string{"Dune", "Emma", "The Hobbit"} {
+		ids = append(ids, api.createBook(1, `{"title":"`+title+`"}`).ID)
+	}
+	dune, emma, hobbit := strconv.Itoa(ids[0]), strconv.Itoa(ids[1]), strconv.Itoa(ids[2])
+	theirs := strconv.Itoa(api.createBook(2, `{"title":"Dune"}`).ID)
+
+	var favourites, classics models.Shelf
+	if code := api.do(1, "POST", "/api/shelves", `{"name":" Favourites ","description":"The best"}`, &favourites); code != http.StatusCreated {
+		t.Fatalf("create: got %d", code)
+	}
+	if favourites.Name != "Favourites" {
+		t.Errorf("created %+v", favourites)
+	}
+	api.do(1, "POST", "/api/shelves", `{"name":"Classics"}`, &classics)
+	path := "/api/shelves/" + strconv.Itoa(favourites.ID)
+
+	for _, body := range []string{`{"book_id":` + dune + `}`, `{"book_id":` + emma + `}`, `{"book_id":` + hobbit + `,"position":0}`} {
+		if code := api.do(1, "POST", path+"/books", body, nil); code != http.StatusOK {
+			t.Fatalf("adding %s: got %d", body, code)
+		}
+	}
+	if got, want := api.shelfBooks(1, strconv.Itoa(favourites.ID)), []int{ids[2], ids[0], ids[1]}; !slices.Equal(got, want) {
+		t.Errorf("shelf holds %v, want %v", got, want)
+	}
+	if code := api.do(1, "PUT", path+"/books/order", `{"book_ids":[`+emma+`,`+dune+`,`+hobbit+`]}`, nil); code != http.StatusOK {
+		t.Fatalf("reordering books: got %d", code)
+	}
+	if got, want := api.shelfBooks(1, strconv.Itoa(favourites.ID)), []int{ids[1], ids[0], ids[2]}; !slices.Equal(got, want) {
+		t.Errorf("after reordering the shelf holds %v, want %v", got, want)
+	}
+
+	order := `{"shelf_ids":[` + strconv.Itoa(classics.ID) + `,` + strconv.Itoa(favourites.ID) + `]}`
+	if code := api.do(1, "PUT", "/api/shelves/order", order, nil); code != http.StatusOK {
+		t.Fatalf("reordering shelves: got %d", code)
+	}
+	var list []models.Shelf
+	api.do(1, "GET", "/api/shelves", "", &list)
+	// The built-in shelves stay first
+	var names []string
+	for _, shelf := range list[3:] {
+		names = append(names, shelf.Name+" "+strconv.Itoa(shelf.BookCount))
+	}
+	if want := []string{"Classics 0", "Favourites 3"}; !slices.Equal(names, want) {
+		t.Errorf("own shelves %q, want %q", names, want)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"blank name", 1, "POST", "/api/shelves", `{"name":" "}`, http.StatusBadRequest},
+		{"invalid JSON", 1, "POST", "/api/shelves", `{`, http.StatusBadRequest},
+		{"existing name", 1, "POST", "/api/shelves", `{"name":"favourites"}`, http.StatusConflict},
+		{"rename to existing name", 1, "PUT", path, `{"name":"Classics"}`, http.StatusConflict},
+		{"unknown shelf", 1, "GET", "/api/shelves/nope", "", http.StatusNotFound},
+		{"invalid shelf ID", 1, "PUT", "/api/shelves/nope", `{"name":"x"}`, http.StatusBadRequest},
+		{"incomplete shelf order", 1, "PUT", "/api/shelves/order", `{"shelf_ids":[` + strconv.Itoa(classics.ID) + `]}`, http.StatusBadRequest},
+		{"no book", 1, "POST", path + "/books", `{}`, http.StatusBadRequest},
+		{"negative position", 1, "POST", path + "/books", `{"book_id":` + dune + `,"position":-1}`, http.StatusBadRequest},
+		{"book already on shelf", 1, "POST", path + "/books", `{"book_id":` + dune + `}`, http.StatusConflict},
+		{"incomplete book order", 1, "PUT", path + "/books/order", `{"book_ids":[` + emma + `]}`, http.StatusBadRequest},
+		{"book not on shelf", 1, "DELETE", "/api/shelves/" + strconv.Itoa(classics.ID) + "/books/" + dune, "", http.StatusNotFound},
+		// Another user's shelves and books are out of reach
+		{"another user's book", 1, "POST", path + "/books", `{"book_id":` + theirs + `}`, http.StatusNotFound},
+		{"get as another user", 2, "GET", path, "", http.StatusNotFound},
+		{"rename as another user", 2, "PUT", path, `{"name":"Mine"}`, http.StatusNotFound},
+		{"add as another user", 2, "POST", path + "/books", `{"book_id":` + theirs + `}`, http.StatusNotFound},
+		{"reorder as another user", 2, "PUT", path + "/books/order", `{"book_ids":[` + emma + `,` + dune + `,` + hobbit + `]}`, http.StatusNotFound},
+		{"remove as another user", 2, "DELETE", path + "/books/" + dune, "", http.StatusNotFound},
+		{"delete as another user", 2, "DELETE", path, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := api.do(tt.userID, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	if code := api.do(1, "DELETE", path+"/books/"+dune, "", nil); code != http.StatusOK {
+		t.Errorf("removing a book: got %d", code)
+	}
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: got %d", code)
+	}
+	if code := api.do(1, "GET", "/api/books/"+emma, "", nil); code != http.StatusOK {
+		t.Errorf("book on a deleted shelf: got %d", code)
+	}
+}
+
+func TestSmartShelves(t *testing.T) {
+	api := newTestAPI(t)
+	dune := api.createBook(1, `{"title":"Dune","genre":"Science Fiction"}`)
+	api.createBook(1, `{"title":"Emma","genre":"Classics"}`)
+	api.createBook(2, `{"title":"Dune","genre":"Science Fiction"}`)
+
+	rules := `{"match":"all","rules":[{"field":"genre","op":"is","value":"science fiction"}]}`
+	var preview struct {
+		BookCount int           `json:"book_count"`
+		Books     []models.Book `json:"books"`
+	}
+	if code := api.do(1, "POST", "/api/smart-shelves/preview", rules, &preview); code != http.StatusOK {
+		t.Fatalf("preview: got %d", code)
+	}
+	if preview.BookCount != 1 || preview.Books[0].ID != dune.ID {
+		t.Errorf("preview returned %+v", preview)
+	}
+
+	var shelf models.SmartShelfDetail
+	if code := api.do(1, "POST", "/api/smart-shelves", `{"name":"SF","rules":`+rules+`}`, &shelf); code != http.StatusCreated {
+		t.Fatalf("create: got %d", code)
+	}
+	if shelf.BookCount != 1 || len(shelf.Books) != 1 {
+		t.Errorf("created %+v", shelf)
+	}
+	path := "/api/smart-shelves/" + strconv.Itoa(shelf.ID)
+	if code := api.do(1, "PUT", path, `{"name":"Classics","rules":{"rules":[{"field":"genre","op":"is","value":"Classics"}]}}`, &shelf); code != http.StatusOK {
+		t.Fatalf("update: got %d", code)
+	}
+	if shelf.Name != "Classics" || len(shelf.Books) != 1 || shelf.Books[0].Title != "Emma" {
+		t.Errorf("updated %+v", shelf)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"unknown field", 1, "POST", "/api/smart-shelves/preview", `{"rules":[{"field":"colour","op":"is","value":"red"}]}`, http.StatusBadRequest},
+		{"wrong value type", 1, "POST", "/api/smart-shelves", `{"name":"x","rules":{"rules":[{"field":"page_count","op":"gt","value":"many"}]}}`, http.StatusBadRequest},
+		{"blank name", 1, "POST", "/api/smart-shelves", `{"name":"","rules":` + rules + `}`, http.StatusBadRequest},
+		{"existing name", 1, "POST", "/api/smart-shelves", `{"name":"classics","rules":` + rules + `}`, http.StatusConflict},
+		{"invalid ID", 1, "GET", "/api/smart-shelves/nope", "", http.StatusBadRequest},
+		{"get as another user", 2, "GET", path, "", http.StatusNotFound},
+		{"update as another user", 2, "PUT", path, `{"name":"Mine","rules":` + rules + `}`, http.StatusNotFound},
+		{"delete as another user", 2, "DELETE", path, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := api.do(tt.userID, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: got %d", code)
+	}
+	if code := api.do(1, "GET", path, "", nil); code != http.StatusNotFound {
+		t.Errorf("get after delete: got %d, want %d", code, http.StatusNotFound)
+	}
+}
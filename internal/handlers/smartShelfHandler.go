@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/shelves"
+	"booklib/internal/store"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// SmartShelfHandler manages the user's smart shelves, whose books are
+// those matching saved rules.
+type SmartShelfHandler struct {
+	Shelves store.SmartShelfStore
+}
+
+// List returns the user's smart shelves with how many books match each
+// right now.
+func (h *SmartShelfHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	list, err := h.Shelves.List(r.Context(), userID, time.Now())
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch smart shelves"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// Get returns a smart shelf with the books matching its rules, newest
+// first.
+func (h *SmartShelfHandler) Get(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	shelfID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid smart shelf ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	detail, err := h.Shelves.Get(r.Context(), userID, shelfID, time.Now())
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Smart shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// Preview returns the books a set of rules would select, without saving
+// them.
+func (h *SmartShelfHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	var rules models.ShelfRules
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if err := shelves.ValidateRules(&rules); err != nil {
+		http.Error(w, `{"error":"Invalid rules: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	books, err := h.Shelves.Books(r.Context(), userID, rules, time.Now())
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch books"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"book_count": len(books), "books": books})
+}
+
+// decodeSmartShelf reads a smart shelf from the request body and validates
+// it.
+func decodeSmartShelf(w http.ResponseWriter, r *http.Request) (*models.SmartShelf, bool) {
+	var req models.SmartShelfRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	shelf := &models.SmartShelf{Name: req.Name, Description: req.Description, Rules: req.Rules}
+	err := shelves.ValidateSmart(shelf)
+	switch {
+	case errors.Is(err, shelves.ErrInvalidName):
+		http.Error(w, `{"error":"Invalid smart shelf: names must be 1 to 100 characters"}`, http.StatusBadRequest)
+		return nil, false
+	case errors.Is(err, shelves.ErrInvalidDescription):
+		http.Error(w, `{"error":"Invalid smart shelf: descriptions can be at most 1000 characters"}`, http.StatusBadRequest)
+		return nil, false
+	case err != nil:
+		http.Error(w, `{"error":"Invalid rules: `+err.Error()+`"}`, http.StatusBadRequest)
+		return nil, false
+	}
+	return shelf, true
+}
+
+// Create saves a smart shelf and returns it with its books.
+func (h *SmartShelfHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	shelf, ok := decodeSmartShelf(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.Shelves.Create(r.Context(), userID, shelf)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a smart shelf with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to create smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	detail, err := h.Shelves.Get(r.Context(), userID, shelf.ID, time.Now())
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(detail)
+}
+
+// Update replaces a smart shelf's name, description and rules and returns
+// it with its books.
+func (h *SmartShelfHandler) Update(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	shelfID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid smart shelf ID"}`, http.StatusBadRequest)
+		return
+	}
+	shelf, ok := decodeSmartShelf(w, r)
+	if !ok {
+		return
+	}
+
+	shelf.ID = shelfID
+	err = h.Shelves.Update(r.Context(), userID, shelf)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Smart shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a smart shelf with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to update smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	detail, err := h.Shelves.Get(r.Context(), userID, shelfID, time.Now())
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (h *SmartShelfHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	shelfID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid smart shelf ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Shelves.Delete(r.Context(), userID, shelfID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Smart shelf not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete smart shelf"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Smart shelf deleted successfully"})
+}
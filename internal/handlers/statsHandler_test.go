@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestStats(t *testing.T) {
+	api := newTestAPI(t)
+	api.createBook(1, `{"title":"Dune","genres":["Science Fiction","Classics"],"tags":["Book Club","Favourites"],"read":true}`)
+	api.createBook(1, `{"title":"Emma","genre":"Classics","tags":["book club"]}`)
+	api.createBook(1, `{"title":"Hyperion","genre":"Science Fiction","read":true}`)
+	api.createBook(1, `{"title":"Untitled"}`)
+	api.createBook(2, `{"title":"Dune","genre":"Science Fiction","tags":["Book Club"]}`)
+
+	var stats models.UserStats
+	if code := api.do(1, "GET", "/api/stats", "", &stats); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if stats.TotalBooks != 4 || stats.BooksRead != 2 || stats.BooksUnread != 2 || stats.ReadPercentage != 50 {
+		t.Errorf("got %d books, %d read, %d unread, %v%%", stats.TotalBooks, stats.BooksRead, stats.BooksUnread, stats.ReadPercentage)
+	}
+
+	// Every genre of a book counts, not just the main one
+	var genres []string
+	for _, g := range stats.GenreBreakdown {
+		genres = append(genres, fmt.Sprintf("%s %d", g.Genre, g.Count))
+	}
+	slices.Sort(genres)
+	if want := []string{"Classics 2", "Science Fiction 2"}; !slices.Equal(genres, want) {
+		t.Errorf("genre breakdown %q, want %q", genres, want)
+	}
+
+	var tags []string
+	for _, tag := range stats.TagBreakdown {
+		tags = append(tags, fmt.Sprintf("%s %d/%d", tag.Tag, tag.Read, tag.Count))
+	}
+	if want := []string{"Book Club 1/2", "Favourites 1/1"}; !slices.Equal(tags, want) {
+		t.Errorf("tag breakdown %q, want %q", tags, want)
+	}
+
+	// A user without books has no percentage to divide by
+	if code := api.do(3, "GET", "/api/stats", "", &stats); code != http.StatusOK {
+		t.Fatalf("empty library: got %d", code)
+	}
+	if stats.TotalBooks != 0 || stats.ReadPercentage != 0 || len(stats.GenreBreakdown) != 0 || len(stats.TagBreakdown) != 0 {
+		t.Errorf("empty library: got %+v", stats)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"booklib/internal/middleware"
+	"booklib/internal/models"
+	"booklib/internal/store"
+	"booklib/internal/tags"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// TagHandler manages the user's tags. Tags can also be set on a book
+// through BookHandler, which creates the ones the user doesn't have yet.
+type TagHandler struct {
+	Tags store.TagStore
+}
+
+// List returns the user's tags with how many books carry each.
+func (h *TagHandler) List(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	list, err := h.Tags.List(r.Context(), userID)
+	if err != nil {
+		http.Error(w, `{"error":"Failed to fetch tags"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// decodeTag reads a tag name from the request body.
+func decodeTag(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req models.TagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"Invalid request"}`, http.StatusBadRequest)
+		return "", false
+	}
+	name, err := tags.Validate(req.Name)
+	if err != nil {
+		http.Error(w, `{"error":"Invalid tag: tags must be 1 to 50 characters"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return name, true
+}
+
+func (h *TagHandler) Create(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+
+	name, ok := decodeTag(w, r)
+	if !ok {
+		return
+	}
+
+	tag := models.Tag{Name: name}
+	err := h.Tags.Create(r.Context(), userID, &tag)
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a tag with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to create tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+// Rename changes a tag's name on every book carrying it.
+func (h *TagHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	tagID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid tag ID"}`, http.StatusBadRequest)
+		return
+	}
+	name, ok := decodeTag(w, r)
+	if !ok {
+		return
+	}
+
+	tag := models.Tag{ID: tagID, Name: name}
+	err = h.Tags.Rename(r.Context(), userID, &tag)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Tag not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrConflict) {
+		http.Error(w, `{"error":"You already have a tag with this name"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to rename tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// Delete deletes a tag, taking it off the user's books.
+func (h *TagHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	tagID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid tag ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Tags.Delete(r.Context(), userID, tagID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Tag not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to delete tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tag deleted successfully"})
+}
+
+// AddBooks puts a tag on several books at once.
+func (h *TagHandler) AddBooks(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	tagID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid tag ID"}`, http.StatusBadRequest)
+		return
+	}
+	var req models.TagBooksRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.BookIDs) == 0 {
+		http.Error(w, `{"error":"Invalid request: book_ids is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	added, err := h.Tags.AddBooks(r.Context(), userID, tagID, req.BookIDs)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Tag or book not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to tag books"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"tagged": added})
+}
+
+// RemoveBook takes a tag off a book.
+func (h *TagHandler) RemoveBook(w http.ResponseWriter, r *http.Request) {
+	userID, _ := middleware.GetUserID(r.Context())
+	tagID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid tag ID"}`, http.StatusBadRequest)
+		return
+	}
+	bookID, err := strconv.Atoi(chi.URLParam(r, "bookID"))
+	if err != nil {
+		http.Error(w, `{"error":"Invalid book ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	err = h.Tags.RemoveBook(r.Context(), userID, tagID, bookID)
+	if errors.Is(err, store.ErrNotFound) {
+		http.Error(w, `{"error":"Book does not have this tag"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, `{"error":"Failed to untag book"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tag removed from book"})
+}
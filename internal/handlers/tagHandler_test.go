@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestTags(t *testing.T) {
+	api := newTestAPI(t)
+	dune := api.createBook(1, `{"title":"Dune","tags":["Book Club"]}`)
+	emma := api.createBook(1, `{"title":"Emma"}`)
+	theirs := api.createBook(2, `{"title":"Dune"}`)
+
+	var tag models.Tag
+	if code := api.do(1, "POST", "/api/tags", `{"name":"  Loved   books "}`, &tag); code != http.StatusCreated {
+		t.Fatalf("create: got %d", code)
+	}
+	if tag.Name != "Loved books" {
+		t.Errorf("created %+v", tag)
+	}
+	path := "/api/tags/" + strconv.Itoa(tag.ID)
+
+	var result map[string]int
+	body := `{"book_ids":[` + strconv.Itoa(dune.ID) + `,` + strconv.Itoa(emma.ID) + `]}`
+	if code := api.do(1, "POST", path+"/books", body, &result); code != http.StatusOK || result["tagged"] != 2 {
+		t.Errorf("tagging books: got %d, %v", code, result)
+	}
+	if code := api.do(1, "PUT", path, `{"name":"Favourites"}`, &tag); code != http.StatusOK || tag.Name != "Favourites" {
+		t.Errorf("rename: got %d, %+v", code, tag)
+	}
+	var book models.Book
+	api.do(1, "GET", "/api/books/"+strconv.Itoa(dune.ID), "", &book)
+	if !slices.Equal(book.Tags, []string{"Book Club", "Favourites"}) {
+		t.Errorf("book tags %q", book.Tags)
+	}
+
+	if code := api.do(1, "DELETE", path+"/books/"+strconv.Itoa(emma.ID), "", nil); code != http.StatusOK {
+		t.Errorf("untagging: got %d", code)
+	}
+	var list []models.TagSummary
+	if code := api.do(1, "GET", "/api/tags", "", &list); code != http.StatusOK {
+		t.Fatalf("list: got %d", code)
+	}
+	var got []string
+	for _, tag := range list {
+		got = append(got, tag.Name+" "+strconv.Itoa(tag.BookCount))
+	}
+	if want := []string{"Book Club 1", "Favourites 1"}; !slices.Equal(got, want) {
+		t.Errorf("list %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"blank name", 1, "POST", "/api/tags", `{"name":"  "}`, http.StatusBadRequest},
+		{"long name", 1, "POST", "/api/tags", `{"name":"` + strings.Repeat("x", 51) + `"}`, http.StatusBadRequest},
+		{"invalid JSON", 1, "POST", "/api/tags", `{"name":`, http.StatusBadRequest},
+		{"existing name", 1, "POST", "/api/tags", `{"name":"book club"}`, http.StatusConflict},
+		{"rename to existing name", 1, "PUT", path, `{"name":"BOOK CLUB"}`, http.StatusConflict},
+		{"invalid tag ID", 1, "PUT", "/api/tags/abc", `{"name":"x"}`, http.StatusBadRequest},
+		{"no books", 1, "POST", path + "/books", `{"book_ids":[]}`, http.StatusBadRequest},
+		{"untagged book", 1, "DELETE", path + "/books/" + strconv.Itoa(emma.ID), "", http.StatusNotFound},
+		{"invalid book ID", 1, "DELETE", path + "/books/abc", "", http.StatusBadRequest},
+		// Another user's tags and books are out of reach
+		{"another user's book", 1, "POST", path + "/books", `{"book_ids":[` + strconv.Itoa(theirs.ID) + `]}`, http.StatusNotFound},
+		{"rename as another user", 2, "PUT", path, `{"name":"Mine"}`, http.StatusNotFound},
+		{"tag as another user", 2, "POST", path + "/books", `{"book_ids":[` + strconv.Itoa(theirs.ID) + `]}`, http.StatusNotFound},
+		{"untag as another user", 2, "DELETE", path + "/books/" + strconv.Itoa(dune.ID), "", http.StatusNotFound},
+		{"delete as another user", 2, "DELETE", path, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if code := api.do(tt.userID, tt.method, tt.path, tt.body, nil); code != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, code, tt.want)
+		}
+	}
+	if code := api.do(2, "GET", "/api/tags", "", &list); code != http.StatusOK || len(list) != 0 {
+		t.Errorf("another user's list: got %d, %+v", code, list)
+	}
+
+	if code := api.do(1, "DELETE", path, "", nil); code != http.StatusOK {
+		t.Fatalf("delete: got %d", code)
+	}
+	api.do(1, "GET", "/api/books/"+strconv.Itoa(dune.ID), "", &book)
+	if !slices.Equal(book.Tags, []string{"Book Club"}) {
+		t.Errorf("book tags after delete %q", book.Tags)
+	}
+}
+
+func TestUpdateBookResolvesGenres(t *testing.T) {
+	api := newTestAPI(t)
+	book := api.createBook(1, `{"title":"Dune","genres":["Science Fiction","Classics"],"tags":["Book Club"]}`)
+	path := "/api/books/" + strconv.Itoa(book.ID)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantGenre string
+		want      []string
+		wantTags  []string
+	}{
+		// Clients that only send the main genre and leave tags out keep the
+		// rest
+		{"same genre", `{"title":"Dune","genre":"science fiction"}`, "Science Fiction", []string{"Science Fiction", "Classics"}, []string{"Book Club"}},
+		{"genres", `{"title":"Dune","genres":["Classics","Epic"],"tags":[]}`, "Classics", []string{"Classics", "Epic"}, nil},
+		{"new genre", `{"title":"Dune","genre":"Adventure"}`, "Adventure", []string{"Adventure"}, nil},
+		{"no genre", `{"title":"Dune"}`, "", nil, nil},
+	}
+	for _, tt := range tests {
+		var got models.Book
+		if code := api.do(1, "PUT", path, tt.body, &got); code != http.StatusOK {
+			t.Fatalf("%s: got %d", tt.name, code)
+		}
+		api.do(1, "GET", path, "", &got)
+		if got.Genre != tt.wantGenre || !slices.Equal(got.Genres, tt.want) || !slices.Equal(got.Tags, tt.wantTags) {
+			t.Errorf("%s: got %q, %q, tags %q; want %q, %q, tags %q", tt.name, got.Genre, got.Genres, got.Tags, tt.wantGenre, tt.want, tt.wantTags)
+		}
+	}
+}
@@ -3,47 +3,25 @@ package handlers
 import (
 	"booklib/internal/middleware"
 	"booklib/internal/models"
-	"database/sql"
+	"booklib/internal/store"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"time"
 )
 
 type UserSettingsHandler struct {
-	DB *sql.DB
+	Settings store.SettingsStore
 }
 
 // GetUserSettings retrieves settings for the authenticated user
 func (h *UserSettingsHandler) GetUserSettings(w http.ResponseWriter, r *http.Request) {
 	userID, _ := middleware.GetUserID(r.Context())
 
-	var settings models.UserSettings
-	err := h.DB.QueryRow(`
-		SELECT 
-			user_id,
-			email_reminders_enabled,
-			email_upcoming_reminders,
-			email_overdue_reminders,
-			default_lending_days,
-			yearly_reading_goal,
-			created_at,
-			updated_at
-		FROM user_settings
-		WHERE user_id = ?
-	`, userID).Scan(
-		&settings.UserID,
-		&settings.EmailRemindersEnabled,
-		&settings.EmailUpcomingReminders,
-		&settings.EmailOverdueReminders,
-		&settings.DefaultLendingDays,
-		&settings.YearlyReadingGoal,
-		&settings.CreatedAt,
-		&settings.UpdatedAt,
-	)
-
-	if err == sql.ErrNoRows {
+	settings, err := h.Settings.GetUserSettings(r.Context(), userID)
+	if errors.Is(err, store.ErrNotFound) {
 		// Create default settings for user
-		settings = h.createDefaultSettings(userID)
+		settings = h.createDefaultSettings(r, userID)
 	} else if err != nil {
 		http.Error(w, `{"error":"Failed to fetch settings"}`, http.StatusInternalServerError)
 		return
@@ -64,43 +42,12 @@ func (h *UserSettingsHandler) UpdateUserSettings(w http.ResponseWriter, r *http.
 	}
 
 	// First ensure settings exist
-	var exists bool
-	err := h.DB.QueryRow("SELECT 1 FROM user_settings WHERE user_id = ?", userID).Scan(&exists)
-	if err == sql.ErrNoRows {
+	if _, err := h.Settings.GetUserSettings(r.Context(), userID); errors.Is(err, store.ErrNotFound) {
 		// Create default settings
-		h.createDefaultSettings(userID)
+		h.createDefaultSettings(r, userID)
 	}
 
-	// Build dynamic update query
-	query := "UPDATE user_settings SET updated_at = ?"
-	args := []interface{}{time.Now()}
-
-	if req.EmailRemindersEnabled != nil {
-		query += ", email_reminders_enabled = ?"
-		args = append(args, *req.EmailRemindersEnabled)
-	}
-	if req.EmailUpcomingReminders != nil {
-		query += ", email_upcoming_reminders = ?"
-		args = append(args, *req.EmailUpcomingReminders)
-	}
-	if req.EmailOverdueReminders != nil {
-		query += ", email_overdue_reminders = ?"
-		args = append(args, *req.EmailOverdueReminders)
-	}
-	if req.DefaultLendingDays != nil {
-		query += ", default_lending_days = ?"
-		args = append(args, *req.DefaultLendingDays)
-	}
-	if req.YearlyReadingGoal != nil {
-		query += ", yearly_reading_goal = ?"
-		args = append(args, *req.YearlyReadingGoal)
-	}
-
-	query += " WHERE user_id = ?"
-	args = append(args, userID)
-
-	_, err = h.DB.Exec(query, args...)
-	if err != nil {
+	if err := h.Settings.UpdateUserSettings(r.Context(), userID, req, time.Now()); err != nil {
 		http.Error(w, `{"error":"Failed to update settings"}`, http.StatusInternalServerError)
 		return
 	}
@@ -110,9 +57,9 @@ func (h *UserSettingsHandler) UpdateUserSettings(w http.ResponseWriter, r *http.
 }
 
 // createDefaultSettings creates default settings for a user
-func (h *UserSettingsHandler) createDefaultSettings(userID int) models.UserSettings {
+func (h *UserSettingsHandler) createDefaultSettings(r *http.Request, userID int) *models.UserSettings {
 	now := time.Now()
-	settings := models.UserSettings{
+	settings := &models.UserSettings{
 		UserID:                 userID,
 		EmailRemindersEnabled:  true,
 		EmailUpcomingReminders: true,
@@ -123,32 +70,8 @@ func (h *UserSettingsHandler) createDefaultSettings(userID int) models.UserSetti
 		UpdatedAt:              now,
 	}
 
-	_, err := h.DB.Exec(`
-		INSERT INTO user_settings (
-			user_id,
-			email_reminders_enabled,
-			email_upcoming_reminders,
-			email_overdue_reminders,
-			default_lending_days,
-			yearly_reading_goal,
-			created_at,
-			updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-	`,
-		settings.UserID,
-		settings.EmailRemindersEnabled,
-		settings.EmailUpcomingReminders,
-		settings.EmailOverdueReminders,
-		settings.DefaultLendingDays,
-		settings.YearlyReadingGoal,
-		settings.CreatedAt,
-		settings.UpdatedAt,
-	)
-
-	if err != nil {
-		// Log error but return defaults anyway
-		return settings
-	}
+	// Errors are ignored; the defaults are returned either way
+	_ = h.Settings.CreateUserSettings(r.Context(), settings)
 
 	return settings
 }
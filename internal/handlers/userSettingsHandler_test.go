@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestUserSettings(t *testing.T) {
+	api := newTestAPI(t)
+
+	// Settings are created with defaults on first read
+	var settings models.UserSettings
+	if code := api.do(1, "GET", "/api/user-settings", "", &settings); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if settings.UserID != 1 || !settings.EmailRemindersEnabled || settings.DefaultLendingDays != 14 || settings.YearlyReadingGoal != 0 {
+		t.Errorf("defaults %+v", settings)
+	}
+
+	// Fields left out of an update keep their value
+	body := `{"email_overdue_reminders":false,"yearly_reading_goal":24}`
+	if code := api.do(1, "PUT", "/api/user-settings", body, &settings); code != http.StatusOK {
+		t.Fatalf("updating: got %d", code)
+	}
+	if settings.EmailOverdueReminders || settings.YearlyReadingGoal != 24 || !settings.EmailUpcomingReminders || settings.DefaultLendingDays != 14 {
+		t.Errorf("after update %+v", settings)
+	}
+
+	// Updating before reading creates the settings first
+	if code := api.do(2, "PUT", "/api/user-settings", `{"default_lending_days":30}`, &settings); code != http.StatusOK {
+		t.Fatalf("updating new settings: got %d", code)
+	}
+	if settings.UserID != 2 || settings.DefaultLendingDays != 30 || settings.YearlyReadingGoal != 0 {
+		t.Errorf("new settings %+v", settings)
+	}
+
+	// Each user has their own settings
+	if code := api.do(1, "GET", "/api/user-settings", "", &settings); code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if settings.UserID != 1 || settings.DefaultLendingDays != 14 || settings.YearlyReadingGoal != 24 {
+		t.Errorf("first user's settings %+v", settings)
+	}
+
+	if code := api.do(1, "PUT", "/api/user-settings", `{"yearly_reading_goal":"many"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("invalid request: got %d, want %d", code, http.StatusBadRequest)
+	}
+}
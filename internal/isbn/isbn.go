@@ -0,0 +1,128 @@
+// Package isbn validates ISBN-10 and ISBN-13 identifiers and converts
+// between the two forms. Books and cache entries are keyed by the ISBN-13
+// returned from Normalize so the same edition is never stored twice.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrInvalid is returned for strings that are not a well-formed ISBN with a
+// correct check digit.
+var ErrInvalid = errors.New("invalid ISBN")
+
+// Clean strips hyphens and whitespace and upper-cases a trailing "x". It
+// does not validate the result.
+func Clean(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, c := range s {
+		switch {
+		case c == '-' || c == ' ' || c == '\t' || c == '‐' || c == '‑':
+			continue
+		case c == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// Normalize validates an ISBN-10 or ISBN-13 in any common formatting and
+// returns its canonical 13-digit form.
+func Normalize(s string) (string, error) {
+	s = Clean(s)
+	switch len(s) {
+	case 10:
+		return To13(s)
+	case 13:
+		if !valid13(s) {
+			return "", ErrInvalid
+		}
+		return s, nil
+	default:
+		return "", ErrInvalid
+	}
+}
+
+// Valid reports whether s is a valid ISBN-10 or ISBN-13.
+func Valid(s string) bool {
+	_, err := Normalize(s)
+	return err == nil
+}
+
+// To13 converts an ISBN-10 into its ISBN-13 equivalent.
+func To13(isbn10 string) (string, error) {
+	isbn10 = Clean(isbn10)
+	if !valid10(isbn10) {
+		return "", ErrInvalid
+	}
+	body := "978" + isbn10[:9]
+	return body + string(checkDigit13(body)), nil
+}
+
+// To10 converts an ISBN-13 into its ISBN-10 equivalent. Only ISBN-13s with
+// the 978 prefix have one.
+func To10(isbn13 string) (string, error) {
+	isbn13 = Clean(isbn13)
+	if !valid13(isbn13) || !strings.HasPrefix(isbn13, "978") {
+		return "", ErrInvalid
+	}
+	body := isbn13[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+func valid10(s string) bool {
+	if len(s) != 10 || !allDigits(s[:9]) {
+		return false
+	}
+	last := s[9]
+	if last != 'X' && (last < '0' || last > '9') {
+		return false
+	}
+	return checkDigit10(s[:9]) == last
+}
+
+func valid13(s string) bool {
+	if len(s) != 13 || !allDigits(s) {
+		return false
+	}
+	return checkDigit13(s[:12]) == s[12]
+}
+
+// checkDigit10 computes the ISBN-10 check character for nine digits.
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 computes the ISBN-13 check digit for twelve digits.
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
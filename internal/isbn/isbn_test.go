@@ -0,0 +1,102 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string // "" means ErrInvalid
+	}{
+		{"isbn-13", "9780441013593", "9780441013593"},
+		{"isbn-10", "0441013597", "9780441013593"},
+		{"isbn-10 with X check digit", "080442957X", "9780804429573"},
+		{"lower-case x", "080442957x", "9780804429573"},
+		{"hyphens", "978-0-441-01359-3", "9780441013593"},
+		{"spaces", "0 441 01359 7", "9780441013593"},
+		{"tabs and unicode hyphens", "978\t0‐441‑01359-3", "9780441013593"},
+		{"979 prefix", "979-10-323-0569-0", "9791032305690"},
+		{"bad isbn-13 checksum", "9780441013594", ""},
+		{"bad isbn-10 checksum", "0441013598", ""},
+		{"X in an isbn-10 whose check digit is a number", "044101359X", ""},
+		{"X in an isbn-13", "978044101359X", ""},
+		{"X before the check digit", "08044295X7", ""},
+		{"letters", "97804410135AB", ""},
+		{"too short", "044101359", ""},
+		{"too long", "97804410135930", ""},
+		{"empty", "", ""},
+		{"goodreads formula", `="0441013597"`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.in)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalid) {
+					t.Errorf("Normalize(%q) = %q, %v; want ErrInvalid", tt.in, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Normalize(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+			if !Valid(tt.in) {
+				t.Errorf("Valid(%q) = false", tt.in)
+			}
+		})
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string // "" means ErrInvalid
+	}{
+		{"9780441013593", "0441013597"},
+		{"978-0-8044-2957-3", "080442957X"},
+		// 979 ISBNs have no ISBN-10 form
+		{"9791032305690", ""},
+		{"9780441013594", ""},
+		{"0441013597", ""},
+	}
+	for _, tt := range tests {
+		got, err := To10(tt.in)
+		if tt.want == "" {
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("To10(%q) = %q, %v; want ErrInvalid", tt.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("To10(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+		}
+		// Converting back gives the ISBN-13 again
+		if back, err := To13(got); err != nil || back != Clean(tt.in) {
+			t.Errorf("To13(%q) = %q, %v; want %q", got, back, err, Clean(tt.in))
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	// To13 only takes ISBN-10s, so even a valid ISBN-13 is rejected
+	for _, in := range []string{"9780441013593", "0441013598", ""} {
+		if got, err := To13(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("To13(%q) = %q, %v; want ErrInvalid", in, got, err)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := map[string]string{
+		"978-0-441-01359-3": "9780441013593",
+		" 080442957x ":      "080442957X",
+		"not an isbn":       "notanisbn",
+	}
+	for in, want := range tests {
+		if got := Clean(in); got != want {
+			t.Errorf("Clean(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
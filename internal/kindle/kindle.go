@@ -0,0 +1,233 @@
+// Package kindle reads the "My Clippings.txt" file Kindle devices keep the
+// reader's highlights, notes and bookmarks in, and matches the books they
+// were taken from to books in a library.
+package kindle
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"booklib/internal/fuzzy"
+	"booklib/internal/models"
+	"booklib/internal/notes"
+)
+
+// ErrNotClippings is returned for a file with no clippings in it.
+var ErrNotClippings = errors.New("not a Kindle clippings file")
+
+// Clipping is a highlight or note read from a clippings file.
+type Clipping struct {
+	// Title and Author name the book as the Kindle does; Author is empty
+	// when the entry doesn't give one.
+	Title  string
+	Author string
+	// Type is notes.Highlight or notes.Note.
+	Type     string
+	Page     *int
+	Location *int
+	// AddedAt is when the clipping was taken, read as UTC since the Kindle
+	// records local times. It is zero when the date couldn't be read.
+	AddedAt time.Time
+	Body    string
+	// Key identifies the entry, so importing the file again can tell the
+	// clippings already imported.
+	Key string
+}
+
+// separator ends each entry in the file.
+const separator = "=========="
+
+var (
+	pagePattern     = regexp.MustCompile(`(?i)\bpage\s+(\d+)`)
+	locationPattern = regexp.MustCompile(`(?i)\b(?:location|loc\.)\s+(\d+)`)
+)
+
+// dateLayouts are the forms of the "Added on" date across Kindle models and
+// regions.
+var dateLayouts = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, January 2, 2006, 03:04 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, 2 January 2006, 15:04",
+}
+
+// Parse reads a clippings file. Bookmarks, which have no text, and entries
+// it can't make sense of, such as those from Kindles set to other languages,
+// are counted in skipped rather than returned.
+func Parse(file io.Reader) (clippings []Clipping, skipped int, err error) {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	var entry []string
+	entries := 0
+	for scanner.Scan() {
+		line := strings.TrimRight(strings.ReplaceAll(scanner.Text(), "\ufeff", ""), "\r")
+		if strings.TrimSpace(line) != separator {
+			entry = append(entry, line)
+			continue
+		}
+		entries++
+		if c, ok := parseEntry(entry); ok {
+			clippings = append(clippings, c)
+		} else {
+			skipped++
+		}
+		entry = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	if entries == 0 {
+		return nil, 0, ErrNotClippings
+	}
+	return clippings, skipped, nil
+}
+
+// parseEntry reads the lines of one entry: the book, a line describing the
+// clipping, a blank line and then the clipping's text.
+func parseEntry(lines []string) (Clipping, bool) {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	if len(lines) < 3 {
+		return Clipping{}, false
+	}
+	heading := strings.TrimSpace(lines[0])
+	meta := strings.TrimSpace(lines[1])
+	c := Clipping{Body: strings.TrimSpace(strings.Join(lines[2:], "\n"))}
+	c.Title, c.Author = splitHeading(heading)
+
+	parts := strings.Split(strings.TrimPrefix(meta, "- "), "|")
+	kind := strings.ToLower(parts[0])
+	switch {
+	case strings.Contains(kind, "bookmark"):
+		return Clipping{}, false
+	case strings.Contains(kind, "note"):
+		c.Type = notes.Note
+	case strings.Contains(kind, "highlight"), strings.Contains(kind, "clip"):
+		c.Type = notes.Highlight
+	default:
+		return Clipping{}, false
+	}
+	if c.Title == "" || c.Body == "" || utf8.RuneCountInString(c.Body) > notes.MaxLength {
+		return Clipping{}, false
+	}
+
+	c.Page = number(pagePattern, meta)
+	c.Location = number(locationPattern, meta)
+	for _, part := range parts {
+		if added, ok := strings.CutPrefix(strings.TrimSpace(part), "Added on "); ok {
+			c.AddedAt = parseDate(added)
+		}
+	}
+
+	sum := sha256.Sum256([]byte(heading + "\n" + meta + "\n" + c.Body))
+	c.Key = "kindle:" + hex.EncodeToString(sum[:])
+	return c, true
+}
+
+// splitHeading splits "Title (Author)" into its parts, taking the last
+// parenthesized group as the author so parentheses in the title, such as a
+// series name, stay with it.
+func splitHeading(heading string) (title, author string) {
+	if !strings.HasSuffix(heading, ")") {
+		return heading, ""
+	}
+	depth := 0
+	for i := len(heading) - 1; i >= 0; i-- {
+		switch heading[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+			if depth == 0 {
+				title = strings.TrimSpace(heading[:i])
+				if title == "" {
+					return heading, ""
+				}
+				return title, strings.TrimSpace(heading[i+1 : len(heading)-1])
+			}
+		}
+	}
+	return heading, ""
+}
+
+// number returns the first number pattern captures in s, or nil.
+func number(pattern *regexp.Regexp, s string) *int {
+	match := pattern.FindStringSubmatch(s)
+	if match == nil {
+		return nil
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n < 1 {
+		return nil
+	}
+	return &n
+}
+
+func parseDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// minTitleMatch and minAuthorMatch are the similarities, from 0 to 1, a
+// title and author need to be taken as the same.
+const (
+	minTitleMatch  = 0.85
+	minAuthorMatch = 0.7
+)
+
+// Match returns the book the clippings titled title, by author, were most
+// likely taken from, or nil if none is close enough. Titles are compared
+// ignoring case, punctuation, leading articles and parenthesized parts,
+// with or without their subtitles, and allowing for small differences. When
+// both sides name an author, the authors must match too.
+func Match(books []models.Book, title, author string) *models.Book {
+	var best *models.Book
+	bestScore := 0.0
+	for i := range books {
+		book := &books[i]
+		score := titleSimilarity(title, book.Title)
+		if score < minTitleMatch {
+			continue
+		}
+		if author != "" && book.Author != "" {
+			authorScore := fuzzy.AuthorSimilarity(author, book.Author)
+			if authorScore < minAuthorMatch {
+				continue
+			}
+			score = (3*score + authorScore) / 4
+		}
+		if score > bestScore {
+			best, bestScore = book, score
+		}
+	}
+	return best
+}
+
+var (
+	parenthesized = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+	subtitle      = regexp.MustCompile(`\s*(?::|\s-\s|\s–\s|\s—\s).*$`)
+)
+
+// titleSimilarity compares two titles, each with and without its subtitle.
+func titleSimilarity(a, b string) float64 {
+	a = parenthesized.ReplaceAllString(a, "")
+	b = parenthesized.ReplaceAllString(b, "")
+	fullA, fullB := fuzzy.Normalize(a), fuzzy.Normalize(b)
+	mainA := fuzzy.Normalize(subtitle.ReplaceAllString(a, ""))
+	mainB := fuzzy.Normalize(subtitle.ReplaceAllString(b, ""))
+	return max(fuzzy.Similarity(fullA, fullB), fuzzy.Similarity(mainA, fullB), fuzzy.Similarity(fullA, mainB))
+}
@@ -0,0 +1,207 @@
+package kindle
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/notes"
+)
+
+// clippings is a My Clippings.txt with the entry forms seen across Kindle
+// models, followed by entries Parse has to skip. Kindles start the file with
+// a byte order mark and end lines with CRLF.
+var clippings = strings.ReplaceAll("\ufeff"+`The Left Hand of Darkness (Ursula K. Le Guin)
+- Your Highlight on page 12 | Location 170-172 | Added on Monday, March 4, 2024 9:15:02 PM
+
+Light is the left hand of darkness.
+==========
+Dune (Dune Chronicles, Book 1) (Frank Herbert)
+- Your Note on Location 1201 | Added on Monday, 4 March 2024 21:15:02
+
+Is fear really
+the mind-killer?
+==========
+Personal Document
+- Your Highlight at location 5-6 | Added on Tuesday, March 5, 2024, 08:30 AM
+
+Notes to self.
+==========
+Dune (Frank Herbert)
+- Your Bookmark on Location 1500 | Added on Monday, March 4, 2024 9:20:00 PM
+
+
+==========
+Broken (Nobody)
+==========
+Cien años de soledad (Gabriel García Márquez)
+- La subrayado en la posición 33-34 | Añadido el lunes, 4 de marzo de 2024 21:15:02
+
+Muchos años después
+==========
+Emma (Jane Austen)
+- Your Highlight on page 3 | Added on Monday, March 4, 2024 9:30:00 PM
+
+
+==========
+`, "\n", "\r\n")
+
+func TestParse(t *testing.T) {
+	got, skipped, err := Parse(strings.NewReader(clippings))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The bookmark, the entry cut short, the Spanish one and the empty
+	// highlight
+	if skipped != 4 {
+		t.Errorf("skipped %d entries, want 4", skipped)
+	}
+	want := []Clipping{
+		{
+			Title: "The Left Hand of Darkness", Author: "Ursula K. Le Guin", Type: notes.Highlight,
+			Page: intPtr(12), Location: intPtr(170),
+			AddedAt: time.Date(2024, time.March, 4, 21, 15, 2, 0, time.UTC),
+			Body:    "Light is the left hand of darkness.",
+		},
+		{
+			Title: "Dune (Dune Chronicles, Book 1)", Author: "Frank Herbert", Type: notes.Note,
+			Location: intPtr(1201),
+			AddedAt:  time.Date(2024, time.March, 4, 21, 15, 2, 0, time.UTC),
+			Body:     "Is fear really\nthe mind-killer?",
+		},
+		{
+			Title: "Personal Document", Type: notes.Highlight,
+			Location: intPtr(5),
+			AddedAt:  time.Date(2024, time.March, 5, 8, 30, 0, 0, time.UTC),
+			Body:     "Notes to self.",
+		},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d clippings, want %d", len(got), len(want))
+	}
+	for i, c := range got {
+		w := want[i]
+		if c.Title != w.Title || c.Author != w.Author || c.Type != w.Type || c.Body != w.Body ||
+			!equalInt(c.Page, w.Page) || !equalInt(c.Location, w.Location) || !c.AddedAt.Equal(w.AddedAt) {
+			t.Errorf("clipping %d is %+v, want %+v", i, c, w)
+		}
+		if !strings.HasPrefix(c.Key, "kindle:") {
+			t.Errorf("clipping %d has key %q", i, c.Key)
+		}
+	}
+	if got[0].Key == got[1].Key {
+		t.Errorf("different clippings share the key %q", got[0].Key)
+	}
+
+	// Keys don't depend on line endings, so a file copied off the Kindle
+	// and edited elsewhere still matches what was imported
+	again, _, err := Parse(strings.NewReader(strings.ReplaceAll(clippings, "\r\n", "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range again {
+		if again[i].Key != got[i].Key {
+			t.Errorf("clipping %d has key %q the second time, %q the first", i, again[i].Key, got[i].Key)
+		}
+	}
+}
+
+func TestParseNotClippings(t *testing.T) {
+	for _, file := range []string{"", "title,author\nDune,Frank Herbert\n"} {
+		if _, _, err := Parse(strings.NewReader(file)); !errors.Is(err, ErrNotClippings) {
+			t.Errorf("Parse(%q): %v, want ErrNotClippings", file, err)
+		}
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []string
+		ok    bool
+	}{
+		{"highlight", []string{"Dune (Frank Herbert)", "- Your Highlight on Location 10", "", "Spice"}, true},
+		{"leading blank lines", []string{"", " ", "Dune (Frank Herbert)", "- Your Note on page 2", "", "Spice"}, true},
+		{"clip", []string{"Dune", "- Clip This Article", "", "Spice"}, true},
+		{"bookmark", []string{"Dune (Frank Herbert)", "- Your Bookmark on Location 10", "", ""}, false},
+		{"only a heading", []string{"Dune (Frank Herbert)"}, false},
+		{"no body", []string{"Dune (Frank Herbert)", "- Your Highlight on Location 10", ""}, false},
+		{"unknown type", []string{"Dune (Frank Herbert)", "- Votre surlignement", "", "Spice"}, false},
+		{"no title", []string{"(Frank Herbert)", "- Your Highlight on Location 10", "", "Spice"}, true},
+		{"body too long", []string{"Dune", "- Your Highlight", "", strings.Repeat("x", notes.MaxLength+1)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := parseEntry(tt.lines); ok != tt.ok {
+				t.Errorf("parseEntry(%q) ok = %v, want %v", tt.lines, ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSplitHeading(t *testing.T) {
+	tests := []struct {
+		heading, title, author string
+	}{
+		{"Dune (Frank Herbert)", "Dune", "Frank Herbert"},
+		{"Dune (Dune Chronicles, Book 1) (Frank Herbert)", "Dune (Dune Chronicles, Book 1)", "Frank Herbert"},
+		{"Mistborn (Sanderson, Brandon (Author))", "Mistborn", "Sanderson, Brandon (Author)"},
+		{"Dune", "Dune", ""},
+		{"Dune (Frank Herbert) extra", "Dune (Frank Herbert) extra", ""},
+		{"(Frank Herbert)", "(Frank Herbert)", ""},
+		{"Dune Frank Herbert)", "Dune Frank Herbert)", ""},
+	}
+	for _, tt := range tests {
+		title, author := splitHeading(tt.heading)
+		if title != tt.title || author != tt.author {
+			t.Errorf("splitHeading(%q) = %q, %q; want %q, %q", tt.heading, title, author, tt.title, tt.author)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	books := []models.Book{
+		{ID: 1, Title: "The Left Hand of Darkness", Author: "Ursula K. Le Guin"},
+		{ID: 2, Title: "Dune", Author: "Frank Herbert"},
+		{ID: 3, Title: "Dune Messiah", Author: "Frank Herbert"},
+		{ID: 4, Title: "Emma"},
+		{ID: 5, Title: "The Name of the Wind: The Kingkiller Chronicle", Author: "Patrick Rothfuss"},
+	}
+	tests := []struct {
+		title, author string
+		want          int // 0 means no match
+	}{
+		{"Dune", "Frank Herbert", 2},
+		{"Dune Messiah", "Frank Herbert", 3},
+		{"Dune (Dune Chronicles, Book 1)", "Frank Herbert", 2},
+		{"DUNE!", "Herbert, Frank", 2},
+		{"Dune", "", 2},
+		{"Left Hand of Darknes", "Ursula Le Guin", 1},
+		{"Emma", "Jane Austen", 4},
+		{"The Name of the Wind", "Patrick Rothfuss", 5},
+		// Titles need to be at least minTitleMatch alike
+		{"Duna", "Frank Herbert", 0},
+		{"Children of Dune", "Frank Herbert", 0},
+		// And authors at least minAuthorMatch, when both sides have one
+		{"Dune", "Kevin J. Anderson", 0},
+		{"The Left Hand of Darkness", "Frank Herbert", 0},
+	}
+	for _, tt := range tests {
+		got := Match(books, tt.title, tt.author)
+		id := 0
+		if got != nil {
+			id = got.ID
+		}
+		if id != tt.want {
+			t.Errorf("Match(%q, %q) = book %d, want %d", tt.title, tt.author, id, tt.want)
+		}
+	}
+}
+
+func intPtr(n int) *int { return &n }
+
+func equalInt(a, b *int) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
+}
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"booklib/internal/dialect"
+)
+
+// splitAuthors credits every book with the authors named in its author
+// string. Names that match once normalized, such as "Tolkien, J.R.R." and
+// "J. R. R. Tolkien", become one author, named as first seen. Author strings
+// themselves are left as they are.
+func splitAuthors(d dialect.Dialect) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		type storedBook struct {
+			id     int
+			author string
+		}
+
+		rows, err := tx.Query("SELECT id, author FROM books WHERE author IS NOT NULL AND author != '' ORDER BY id")
+		if err != nil {
+			return err
+		}
+		var books []storedBook
+		for rows.Next() {
+			var b storedBook
+			if err := rows.Scan(&b.id, &b.author); err != nil {
+				rows.Close()
+				return err
+			}
+			books = append(books, b)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		ids := make(map[string]int)
+		for _, b := range books {
+			credited := make(map[int]bool)
+			for position, name := range splitAuthorNames(b.author) {
+				key := authorNameKey(name)
+				if key == "" {
+					continue
+				}
+				id, ok := ids[key]
+				if !ok {
+					err := tx.QueryRow(d.Rebind("INSERT INTO authors (name, name_key) VALUES (?, ?) RETURNING id"), name, key).Scan(&id)
+					if err != nil {
+						return err
+					}
+					ids[key] = id
+				}
+				if credited[id] {
+					continue
+				}
+				credited[id] = true
+				_, err := tx.Exec(d.Rebind("INSERT INTO book_authors (book_id, author_id, role, position) VALUES (?, ?, 'author', ?)"), b.id, id, position)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// The migration splits and keys names with its own copy of authors.Split
+// and authors.Key as they were when it shipped, so that later changes to
+// them don't change what it does to a database migrated afresh.
+
+var authorSeparators = regexp.MustCompile(`\s*(?:;|&|\s+and\s+)\s*`)
+
+var authorSuffixes = map[string]bool{
+	"jr": true, "sr": true, "ii": true, "iii": true, "iv": true, "phd": true, "md": true,
+}
+
+// splitAuthorNames is authors.Split.
+func splitAuthorNames(s string) []string {
+	var names []string
+	for _, group := range authorSeparators.Split(s, -1) {
+		parts, suffix := cutAuthorSuffixes(splitNameParts(group))
+		if len(parts) == 2 && !strings.Contains(parts[0], " ") {
+			parts = []string{parts[0] + ", " + parts[1]}
+		}
+		for _, part := range parts {
+			if isAuthorSuffix(part) && len(names) > 0 {
+				names[len(names)-1] += ", " + part
+				continue
+			}
+			names = append(names, part)
+		}
+		if len(names) > 0 {
+			names[len(names)-1] += suffix
+		}
+	}
+	return names
+}
+
+func cutAuthorSuffixes(parts []string) ([]string, string) {
+	suffix := ""
+	for len(parts) > 1 && isAuthorSuffix(parts[len(parts)-1]) {
+		suffix = ", " + parts[len(parts)-1] + suffix
+		parts = parts[:len(parts)-1]
+	}
+	return parts, suffix
+}
+
+// splitNameParts splits a name at its commas, collapsing whitespace and
+// dropping empty parts.
+func splitNameParts(s string) []string {
+	var parts []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+func isAuthorSuffix(part string) bool {
+	return authorSuffixes[strings.ToLower(strings.TrimSuffix(part, "."))]
+}
+
+// authorNameKey is authors.Key.
+func authorNameKey(name string) string {
+	if parts, suffix := cutAuthorSuffixes(splitNameParts(name)); len(parts) == 2 {
+		name = parts[1] + " " + parts[0] + suffix
+	}
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitAuthorNames(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"Frank Herbert", []string{"Frank Herbert"}},
+		{"", nil},
+		{"Terry Pratchett, Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Terry Pratchett & Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Terry Pratchett and Neil Gaiman", []string{"Terry Pratchett", "Neil Gaiman"}},
+		{"Sandra Andrews", []string{"Sandra Andrews"}},
+		{"Tolkien, J.R.R.", []string{"Tolkien, J.R.R."}},
+		{"Herbert, Frank; Anderson, Kevin J.", []string{"Herbert, Frank", "Anderson, Kevin J."}},
+		{"Martin Luther King, Jr., Coretta Scott King", []string{"Martin Luther King, Jr.", "Coretta Scott King"}},
+		{"King, Martin Luther, Jr.", []string{"King, Martin Luther, Jr."}},
+	}
+	for _, tt := range tests {
+		if got := splitAuthorNames(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("splitAuthorNames(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorNameKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"  FRANK  herbert ", "frank herbert"},
+		{"Tolkien, J.R.R.", "j r r tolkien"},
+		{"J. R. R. Tolkien", "j r r tolkien"},
+		{"King, Martin Luther, Jr.", "martin luther king jr"},
+		{"...", ""},
+	}
+	for _, tt := range tests {
+		if got := authorNameKey(tt.in); got != tt.want {
+			t.Errorf("authorNameKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
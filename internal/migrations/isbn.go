@@ -0,0 +1,190 @@
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+
+	"booklib/internal/dialect"
+)
+
+// normalizeISBNs rewrites stored ISBNs to their canonical ISBN-13 form. The
+// same rewrite works on every dialect, so both histories share it.
+//
+// A book keeps its old ISBN when the user already owns the normalized one,
+// since rewriting it would break the per-user unique index. Cache entries
+// whose normalized key already exists are dropped as duplicates, and entries
+// that are not valid ISBNs are dropped because they can no longer be looked
+// up.
+func normalizeISBNs(d dialect.Dialect) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		if err := normalizeBookISBNs(tx, d); err != nil {
+			return err
+		}
+		return normalizeCacheISBNs(tx, d)
+	}
+}
+
+func normalizeBookISBNs(tx *sql.Tx, d dialect.Dialect) error {
+	type storedBook struct {
+		id     int
+		userID int
+		isbn   string
+	}
+
+	rows, err := tx.Query("SELECT id, user_id, isbn FROM books WHERE isbn IS NOT NULL AND isbn != '' ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var books []storedBook
+	owned := make(map[int]map[string]bool)
+	for rows.Next() {
+		var b storedBook
+		if err := rows.Scan(&b.id, &b.userID, &b.isbn); err != nil {
+			rows.Close()
+			return err
+		}
+		books = append(books, b)
+		if owned[b.userID] == nil {
+			owned[b.userID] = make(map[string]bool)
+		}
+		owned[b.userID][b.isbn] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	invalid, kept := 0, 0
+	for _, b := range books {
+		normalized, err := normalizeISBN(b.isbn)
+		if err != nil {
+			invalid++
+			continue
+		}
+		if normalized == b.isbn {
+			continue
+		}
+		if owned[b.userID][normalized] {
+			kept++
+			continue
+		}
+		if _, err := tx.Exec(d.Rebind("UPDATE books SET isbn = ? WHERE id = ?"), normalized, b.id); err != nil {
+			return err
+		}
+		owned[b.userID][normalized] = true
+	}
+
+	if invalid > 0 {
+		log.Printf("Warning: %d books have ISBNs that fail validation; left unchanged", invalid)
+	}
+	if kept > 0 {
+		log.Printf("Warning: %d books duplicate another copy once their ISBN is normalized; left unchanged", kept)
+	}
+	return nil
+}
+
+func normalizeCacheISBNs(tx *sql.Tx, d dialect.Dialect) error {
+	rows, err := tx.Query("SELECT isbn FROM isbn_cache")
+	if err != nil {
+		return err
+	}
+	var keys []string
+	cached := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return err
+		}
+		keys = append(keys, key)
+		cached[key] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		normalized, err := normalizeISBN(key)
+		if err == nil && normalized == key {
+			continue
+		}
+		if err != nil || cached[normalized] {
+			if _, err := tx.Exec(d.Rebind("DELETE FROM isbn_cache WHERE isbn = ?"), key); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(d.Rebind("UPDATE isbn_cache SET isbn = ? WHERE isbn = ?"), normalized, key); err != nil {
+			return err
+		}
+		cached[normalized] = true
+	}
+	return nil
+}
+
+// The migration validates ISBNs with its own copy of isbn.Normalize as it
+// was when it shipped, so that later changes to it don't change what it
+// does to a database migrated afresh.
+
+var errInvalidISBN = errors.New("invalid ISBN")
+
+// normalizeISBN is isbn.Normalize.
+func normalizeISBN(s string) (string, error) {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '-' || c == ' ' || c == '\t' || c == '‐' || c == '‑':
+			continue
+		case c == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	s = b.String()
+
+	switch {
+	case len(s) == 10 && isbnDigits(s[:9]) && (s[9] == 'X' || isbnDigits(s[9:])) && isbn10Check(s[:9]) == s[9]:
+		body := "978" + s[:9]
+		return body + string(isbn13Check(body)), nil
+	case len(s) == 13 && isbnDigits(s) && isbn13Check(s[:12]) == s[12]:
+		return s, nil
+	}
+	return "", errInvalidISBN
+}
+
+func isbn10Check(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+func isbn13Check(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		d := int(body[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isbnDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		in, want string
+		err      error
+	}{
+		{"9780441013593", "9780441013593", nil},
+		{"978-0-441-01359-3", "9780441013593", nil},
+		{"0441013597", "9780441013593", nil},
+		{"0-8044-2957-x", "9780804429573", nil},
+		{"080442957X", "9780804429573", nil},
+		{"9780441013594", "", errInvalidISBN},
+		{"0441013598", "", errInvalidISBN},
+		{"97804410135", "", errInvalidISBN},
+		{"978044101359X", "", errInvalidISBN},
+		{"", "", errInvalidISBN},
+	}
+	for _, tt := range tests {
+		got, err := normalizeISBN(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("normalizeISBN(%q) = %q, %v; want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"booklib/internal/dialect"
+)
+
+// Migration is a single numbered schema change. Up applies the change and
+// Down reverts it; both run inside a transaction together with the
+// bookkeeping row in schema_migrations, so a failing step leaves the
+// database untouched.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *sql.Tx) error
+	Down    func(tx *sql.Tx) error
+}
+
+// MigrationStatus describes whether a known migration has been applied.
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// exec returns a migration step that runs the given statements in order.
+func exec(statements ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range statements {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// All returns the migrations registered for the dialect sorted by version.
+// Each dialect keeps its own history so column types can differ, but
+// versions are kept in step between them.
+func All(d dialect.Dialect) []Migration {
+	source := sqliteMigrations
+	if d == dialect.Postgres {
+		source = postgresMigrations
+	}
+	list := make([]Migration, len(source))
+	copy(list, source)
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list
+}
+
+func ensureMigrationsTable(db *sql.DB, d dialect.Dialect) error {
+	appliedAtType := "DATETIME"
+	if d == dialect.Postgres {
+		appliedAtType = "TIMESTAMPTZ"
+	}
+	_, err := db.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at ` + appliedAtType + ` DEFAULT CURRENT_TIMESTAMP
+	);`)
+	return err
+}
+
+// applied returns the applied migration versions mapped to when they ran.
+func applied(db *sql.DB, d dialect.Dialect) (map[int]time.Time, error) {
+	if err := ensureMigrationsTable(db, d); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %v", err)
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
+
+// Up applies every pending migration in version order and returns the
+// number of migrations applied.
+func Up(db *sql.DB, d dialect.Dialect) (int, error) {
+	done, err := applied(db, d)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range All(d) {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		if err := run(db, d, m, m.Up, true); err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Down reverts the most recently applied migrations, up to steps of them,
+// and returns the number reverted.
+func Down(db *sql.DB, d dialect.Dialect, steps int) (int, error) {
+	done, err := applied(db, d)
+	if err != nil {
+		return 0, err
+	}
+
+	list := All(d)
+	count := 0
+	for i := len(list) - 1; i >= 0 && count < steps; i-- {
+		m := list[i]
+		if _, ok := done[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return count, fmt.Errorf("migration %d (%s) cannot be reverted", m.Version, m.Name)
+		}
+		if err := run(db, d, m, m.Down, false); err != nil {
+			return count, fmt.Errorf("reverting migration %d (%s) failed: %v", m.Version, m.Name, err)
+		}
+		log.Printf("Reverted migration %d: %s", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+// Status lists every known migration along with when it was applied.
+func Status(db *sql.DB, d dialect.Dialect) ([]MigrationStatus, error) {
+	done, err := applied(db, d)
+	if err != nil {
+		return nil, err
+	}
+
+	list := All(d)
+	statuses := make([]MigrationStatus, 0, len(list))
+	for _, m := range list {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if appliedAt, ok := done[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func run(db *sql.DB, d dialect.Dialect, m Migration, step func(tx *sql.Tx) error, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := step(tx); err != nil {
+		return err
+	}
+
+	if up {
+		_, err = tx.Exec(
+			d.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+			m.Version, m.Name, time.Now(),
+		)
+	} else {
+		_, err = tx.Exec(d.Rebind("DELETE FROM schema_migrations WHERE version = ?"), m.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,166 @@
+//go:build sqlite_fts5
+
+package migrations
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+
+	"booklib/internal/dialect"
+)
+
+// recorded returns the versions and names in schema_migrations, in version
+// order.
+func recorded(t *testing.T, db *sql.DB) []Migration {
+	t.Helper()
+	rows, err := db.Query("SELECT version, name FROM schema_migrations ORDER BY version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var list []Migration
+	for rows.Next() {
+		var m Migration
+		if err := rows.Scan(&m.Version, &m.Name); err != nil {
+			t.Fatal(err)
+		}
+		list = append(list, m)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+// checkApplied checks that exactly the first n migrations are reported by
+// Status as applied and recorded in schema_migrations.
+func checkApplied(t *testing.T, db *sql.DB, n int) {
+	t.Helper()
+	all := All(dialect.SQLite)
+	// Status creates schema_migrations on a new database
+	statuses, err := Status(db, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != len(all) {
+		t.Fatalf("Status lists %d migrations, want %d", len(statuses), len(all))
+	}
+	for i, status := range statuses {
+		if status.Version != all[i].Version || status.Name != all[i].Name {
+			t.Errorf("Status lists %d (%s), want %d (%s)", status.Version, status.Name, all[i].Version, all[i].Name)
+		}
+		if applied := status.AppliedAt != nil; applied != (i < n) {
+			t.Errorf("Status reports migration %d applied = %v, want %v", status.Version, applied, i < n)
+		}
+	}
+
+	got := recorded(t, db)
+	if len(got) != n {
+		t.Fatalf("%d migrations recorded, want %d", len(got), n)
+	}
+	for i, m := range got {
+		if m.Version != all[i].Version || m.Name != all[i].Name {
+			t.Errorf("recorded migration %d (%s), want %d (%s)", m.Version, m.Name, all[i].Version, all[i].Name)
+		}
+	}
+}
+
+// tableExists reports whether the SQLite database has the named table.
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestUpDownUp(t *testing.T) {
+	db := openSQLite(t)
+	all := len(All(dialect.SQLite))
+	checkApplied(t, db, 0)
+
+	count, err := Up(db, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != all {
+		t.Fatalf("applied %d migrations, want %d", count, all)
+	}
+	checkApplied(t, db, all)
+	if count, err := Up(db, dialect.SQLite); err != nil || count != 0 {
+		t.Fatalf("migrating up again applied %d: %v", count, err)
+	}
+
+	if count, err := Down(db, dialect.SQLite, 2); err != nil || count != 2 {
+		t.Fatalf("reverting two migrations reverted %d: %v", count, err)
+	}
+	checkApplied(t, db, all-2)
+
+	if count, err := Down(db, dialect.SQLite, all); err != nil || count != all-2 {
+		t.Fatalf("reverting the rest reverted %d, want %d: %v", count, all-2, err)
+	}
+	checkApplied(t, db, 0)
+	if tableExists(t, db, "books") {
+		t.Error("books table is left after migrating down")
+	}
+
+	if count, err := Up(db, dialect.SQLite); err != nil || count != all {
+		t.Fatalf("migrating up from scratch applied %d, want %d: %v", count, all, err)
+	}
+	checkApplied(t, db, all)
+}
+
+func TestFailedStepRollsBack(t *testing.T) {
+	errStep := errors.New("step failed")
+	all := len(All(dialect.SQLite))
+	failing := Migration{
+		Version: All(dialect.SQLite)[all-1].Version + 1,
+		Name:    "failing",
+		Up: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_done (id INTEGER)"); err != nil {
+				return err
+			}
+			return errStep
+		},
+		Down: func(tx *sql.Tx) error {
+			if _, err := tx.Exec("CREATE TABLE half_reverted (id INTEGER)"); err != nil {
+				return err
+			}
+			return errStep
+		},
+	}
+
+	db := openSQLite(t)
+	if _, err := Up(db, dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	saved := sqliteMigrations
+	sqliteMigrations = append(slices.Clone(saved), failing)
+	t.Cleanup(func() { sqliteMigrations = saved })
+
+	count, err := Up(db, dialect.SQLite)
+	if err == nil || count != 0 {
+		t.Fatalf("failing migration applied %d: %v", count, err)
+	}
+	if tableExists(t, db, "half_done") {
+		t.Error("failed migration's table was kept")
+	}
+	if got := recorded(t, db); len(got) != all {
+		t.Errorf("%d migrations recorded after a failure, want %d", len(got), all)
+	}
+
+	// A failing revert leaves the migration recorded and nothing changed
+	mustExec(t, db, "INSERT INTO schema_migrations (version, name) VALUES (?, ?)", failing.Version, failing.Name)
+	if count, err := Down(db, dialect.SQLite, 1); err == nil || count != 0 {
+		t.Fatalf("failing revert reverted %d: %v", count, err)
+	}
+	if tableExists(t, db, "half_reverted") {
+		t.Error("failed revert's table was kept")
+	}
+	if got := recorded(t, db); len(got) != all+1 {
+		t.Errorf("%d migrations recorded after a failed revert, want %d", len(got), all+1)
+	}
+}
@@ -0,0 +1,479 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"booklib/internal/dialect"
+)
+
+// postgresMigrations holds the schema history for PostgreSQL databases. It
+// mirrors sqliteMigrations version for version; only the column types and
+// SQL dialect differ.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: exec(
+			`CREATE TABLE IF NOT EXISTS users (
+				id SERIAL PRIMARY KEY,
+				username TEXT UNIQUE NOT NULL,
+				email TEXT UNIQUE NOT NULL,
+				password_hash TEXT NOT NULL,
+				role TEXT DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);",
+			"CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);",
+
+			`CREATE TABLE IF NOT EXISTS books (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				title TEXT NOT NULL,
+				author TEXT,
+				isbn TEXT,
+				genre TEXT,
+				read INTEGER DEFAULT 0 CHECK (read IN (0, 1)),
+				cover_url TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_books_user_id ON books(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_books_isbn ON books(isbn);",
+			"CREATE INDEX IF NOT EXISTS idx_books_title ON books(title);",
+			"CREATE INDEX IF NOT EXISTS idx_books_author ON books(author);",
+			"CREATE UNIQUE INDEX IF NOT EXISTS idx_books_user_isbn_unique ON books(user_id, isbn) WHERE isbn IS NOT NULL AND isbn != '';",
+
+			`CREATE TABLE IF NOT EXISTS isbn_cache (
+				isbn TEXT PRIMARY KEY,
+				title TEXT,
+				author TEXT,
+				genre TEXT,
+				cover_url TEXT,
+				cached_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_isbn_cache_cached_at ON isbn_cache(cached_at);",
+
+			`CREATE TABLE IF NOT EXISTS lending (
+				id SERIAL PRIMARY KEY,
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				lent_to TEXT NOT NULL,
+				lent_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				due_date TIMESTAMPTZ,
+				returned_at TIMESTAMPTZ,
+				last_reminder_sent TIMESTAMPTZ
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_lending_book_id ON lending(book_id);",
+			"CREATE INDEX IF NOT EXISTS idx_lending_user_id ON lending(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_lending_returned_at ON lending(returned_at);",
+			"CREATE INDEX IF NOT EXISTS idx_lending_due_date ON lending(due_date);",
+			"CREATE INDEX IF NOT EXISTS idx_lending_last_reminder_sent ON lending(last_reminder_sent);",
+
+			`CREATE TABLE IF NOT EXISTS reading_history (
+				id SERIAL PRIMARY KEY,
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				completed_at TIMESTAMPTZ
+			);`,
+			"CREATE INDEX IF NOT EXISTS idx_reading_history_book_id ON reading_history(book_id);",
+			"CREATE INDEX IF NOT EXISTS idx_reading_history_user_id ON reading_history(user_id);",
+			"CREATE INDEX IF NOT EXISTS idx_reading_history_completed_at ON reading_history(completed_at);",
+			"CREATE INDEX IF NOT EXISTS idx_reading_history_started_at ON reading_history(started_at);",
+
+			`CREATE TABLE IF NOT EXISTS settings (
+				key TEXT PRIMARY KEY,
+				value TEXT NOT NULL,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+			"INSERT INTO settings (key, value) VALUES ('registration_enabled', 'true') ON CONFLICT (key) DO NOTHING;",
+
+			`CREATE TABLE IF NOT EXISTS user_settings (
+				user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+				email_reminders_enabled BOOLEAN DEFAULT TRUE,
+				email_upcoming_reminders BOOLEAN DEFAULT TRUE,
+				email_overdue_reminders BOOLEAN DEFAULT TRUE,
+				default_lending_days INTEGER DEFAULT 14,
+				yearly_reading_goal INTEGER DEFAULT 0,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS user_settings;",
+			"DROP TABLE IF EXISTS settings;",
+			"DROP TABLE IF EXISTS reading_history;",
+			"DROP TABLE IF EXISTS lending;",
+			"DROP TABLE IF EXISTS isbn_cache;",
+			"DROP TABLE IF EXISTS books;",
+			"DROP TABLE IF EXISTS users;",
+		),
+	},
+	{
+		// Normalization is one-way: the original spelling of each ISBN is
+		// not kept, so reverting only forgets that the migration ran.
+		Version: 2,
+		Name:    "normalize_isbns",
+		Up:      normalizeISBNs(dialect.Postgres),
+		Down:    exec(),
+	},
+	{
+		Version: 3,
+		Name:    "add_book_notes",
+		Up:      exec("ALTER TABLE books ADD COLUMN notes TEXT;"),
+		Down:    exec("ALTER TABLE books DROP COLUMN notes;"),
+	},
+	{
+		// PostgreSQL keeps the search document in a generated column, so
+		// no triggers are needed. Weights rank title over author over
+		// genre over notes.
+		Version: 4,
+		Name:    "book_search",
+		Up: exec(
+			`ALTER TABLE books ADD COLUMN search tsvector GENERATED ALWAYS AS (
+				setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+				setweight(to_tsvector('simple', coalesce(genre, '')), 'C') ||
+				setweight(to_tsvector('simple', coalesce(notes, '')), 'D')
+			) STORED;`,
+			"CREATE INDEX IF NOT EXISTS idx_books_search ON books USING GIN (search);",
+		),
+		Down: exec(
+			"DROP INDEX IF EXISTS idx_books_search;",
+			"ALTER TABLE books DROP COLUMN search;",
+		),
+	},
+	{
+		// Published dates are kept as text since providers often only
+		// know the year or month.
+		Version: 5,
+		Name:    "add_book_metadata",
+		Up: exec(
+			"ALTER TABLE books ADD COLUMN description TEXT;",
+			"ALTER TABLE books ADD COLUMN page_count INTEGER;",
+			"ALTER TABLE books ADD COLUMN publisher TEXT;",
+			"ALTER TABLE books ADD COLUMN published_date TEXT;",
+			"ALTER TABLE books ADD COLUMN language TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN description TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN page_count INTEGER;",
+			"ALTER TABLE isbn_cache ADD COLUMN publisher TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN published_date TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN language TEXT;",
+		),
+		Down: exec(
+			"ALTER TABLE isbn_cache DROP COLUMN language;",
+			"ALTER TABLE isbn_cache DROP COLUMN published_date;",
+			"ALTER TABLE isbn_cache DROP COLUMN publisher;",
+			"ALTER TABLE isbn_cache DROP COLUMN page_count;",
+			"ALTER TABLE isbn_cache DROP COLUMN description;",
+			"ALTER TABLE books DROP COLUMN language;",
+			"ALTER TABLE books DROP COLUMN published_date;",
+			"ALTER TABLE books DROP COLUMN publisher;",
+			"ALTER TABLE books DROP COLUMN page_count;",
+			"ALTER TABLE books DROP COLUMN description;",
+		),
+	},
+	{
+		// Pinned entries were corrected by an admin, so the cache refresh
+		// leaves them alone.
+		Version: 6,
+		Name:    "isbn_cache_pinned",
+		Up:      exec("ALTER TABLE isbn_cache ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;"),
+		Down:    exec("ALTER TABLE isbn_cache DROP COLUMN pinned;"),
+	},
+	{
+		// One proposal per book: a new run skips books that already have
+		// one, so rejected proposals aren't made again.
+		Version: 7,
+		Name:    "enrichment_proposals",
+		Up: exec(
+			`CREATE TABLE enrichment_proposals (
+				id SERIAL PRIMARY KEY,
+				book_id INTEGER NOT NULL UNIQUE REFERENCES books(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'rejected')),
+				matched_by TEXT NOT NULL,
+				score DOUBLE PRECISION NOT NULL DEFAULT 1,
+				isbn TEXT,
+				genre TEXT,
+				cover_url TEXT,
+				description TEXT,
+				page_count INTEGER,
+				publisher TEXT,
+				published_date TEXT,
+				language TEXT,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+			);`,
+			"CREATE INDEX idx_enrichment_proposals_user_id ON enrichment_proposals(user_id);",
+		),
+		Down: exec("DROP TABLE IF EXISTS enrichment_proposals;"),
+	},
+	{
+		// Authors are shared between users and matched by name_key, see
+		// authors.Key. books.author is kept as the display string.
+		Version: 8,
+		Name:    "authors",
+		Up: func(tx *sql.Tx) error {
+			err := exec(
+				`CREATE TABLE authors (
+					id SERIAL PRIMARY KEY,
+					name TEXT NOT NULL,
+					name_key TEXT NOT NULL UNIQUE,
+					created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+				);`,
+				`CREATE TABLE book_authors (
+					book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+					author_id INTEGER NOT NULL REFERENCES authors(id) ON DELETE CASCADE,
+					role TEXT NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'translator', 'illustrator', 'editor')),
+					position INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (book_id, author_id, role)
+				);`,
+				"CREATE INDEX idx_book_authors_author_id ON book_authors(author_id);",
+			)(tx)
+			if err != nil {
+				return err
+			}
+			return splitAuthors(dialect.Postgres)(tx)
+		},
+		Down: exec(
+			"DROP TABLE IF EXISTS book_authors;",
+			"DROP TABLE IF EXISTS authors;",
+		),
+	},
+	{
+		// books.genre stays the book's main genre, the first of its
+		// book_genres. Tags belong to a user and are matched by name_key,
+		// see tags.Key. isbn_cache.genres holds a JSON array.
+		Version: 9,
+		Name:    "genres_and_tags",
+		Up: exec(
+			`CREATE TABLE book_genres (
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				genre TEXT NOT NULL,
+				position INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (book_id, genre)
+			);`,
+			`CREATE TABLE tags (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key)
+			);`,
+			`CREATE TABLE book_tags (
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+				PRIMARY KEY (book_id, tag_id)
+			);`,
+			"CREATE INDEX idx_book_tags_tag_id ON book_tags(tag_id);",
+			`INSERT INTO book_genres (book_id, genre, position)
+				SELECT id, TRIM(genre), 0 FROM books WHERE TRIM(COALESCE(genre, '')) <> '';`,
+			"ALTER TABLE isbn_cache ADD COLUMN genres TEXT;",
+		),
+		Down: exec(
+			"ALTER TABLE isbn_cache DROP COLUMN genres;",
+			"DROP TABLE IF EXISTS book_tags;",
+			"DROP TABLE IF EXISTS tags;",
+			"DROP TABLE IF EXISTS book_genres;",
+		),
+	},
+	{
+		// Shelves are ordered per user by position and matched by name_key,
+		// see shelves.Key. shelf_books.position orders a shelf's books.
+		Version: 10,
+		Name:    "shelves",
+		Up: exec(
+			`CREATE TABLE shelves (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				position INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key)
+			);`,
+			`CREATE TABLE shelf_books (
+				shelf_id INTEGER NOT NULL REFERENCES shelves(id) ON DELETE CASCADE,
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				position INTEGER NOT NULL DEFAULT 0,
+				added_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (shelf_id, book_id)
+			);`,
+			"CREATE INDEX idx_shelf_books_book_id ON shelf_books(book_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS shelf_books;",
+			"DROP TABLE IF EXISTS shelves;",
+		),
+	},
+	{
+		// A smart shelf's rules are a JSON models.ShelfRules, evaluated when
+		// the shelf is read. Names are matched by name_key, see shelves.Key.
+		Version: 11,
+		Name:    "smart_shelves",
+		Up: exec(
+			`CREATE TABLE smart_shelves (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				rules TEXT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key)
+			);`,
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS smart_shelves;",
+		),
+	},
+	{
+		// books.status is the book's place in the reading state machine, see
+		// package reading, while books.read says whether it was ever read: it
+		// is set while the book is finished or once a session of it was
+		// completed, so a re-read doesn't clear it. Existing books are reading
+		// with a session in progress and otherwise finished if read; they
+		// keep their read flag, and those with a completed session become
+		// read. reading_status_changes logs every move with its time.
+		Version: 12,
+		Name:    "reading_status",
+		Up: exec(
+			`ALTER TABLE books ADD COLUMN status TEXT NOT NULL DEFAULT 'want_to_read'
+				CHECK (status IN ('want_to_read', 'reading', 'paused', 'finished', 'did_not_finish'));`,
+			"ALTER TABLE books ADD COLUMN status_changed_at TIMESTAMPTZ;",
+			"ALTER TABLE reading_history ADD COLUMN abandoned_at TIMESTAMPTZ;",
+			`UPDATE books SET status = CASE
+				WHEN EXISTS (SELECT 1 FROM reading_history h WHERE h.book_id = books.id AND h.completed_at IS NULL)
+					THEN 'reading'
+				WHEN read = 1 THEN 'finished'
+				ELSE 'want_to_read'
+			END;`,
+			`UPDATE books SET read = 1 WHERE EXISTS (
+				SELECT 1 FROM reading_history h WHERE h.book_id = books.id AND h.completed_at IS NOT NULL
+			);`,
+			`UPDATE books SET status_changed_at = (
+				SELECT MAX(COALESCE(h.completed_at, h.started_at)) FROM reading_history h WHERE h.book_id = books.id
+			);`,
+			`CREATE TABLE reading_status_changes (
+				id SERIAL PRIMARY KEY,
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				from_status TEXT NOT NULL,
+				to_status TEXT NOT NULL,
+				changed_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX idx_reading_status_changes_book_id ON reading_status_changes(book_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS reading_status_changes;",
+			"ALTER TABLE reading_history DROP COLUMN abandoned_at;",
+			"ALTER TABLE books DROP COLUMN status_changed_at;",
+			"ALTER TABLE books DROP COLUMN status;",
+		),
+	},
+	{
+		// A session's progress updates give the page, percent or ebook
+		// location reached, with percent worked out from the others when the
+		// book's length is known.
+		Version: 13,
+		Name:    "reading_progress",
+		Up: exec(
+			`CREATE TABLE reading_progress (
+				id SERIAL PRIMARY KEY,
+				session_id INTEGER NOT NULL REFERENCES reading_history(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				page INTEGER,
+				location INTEGER,
+				location_total INTEGER,
+				percent DOUBLE PRECISION,
+				recorded_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX idx_reading_progress_session_id ON reading_progress(session_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS reading_progress;",
+		),
+	},
+	{
+		// A reading session has at most one review: a rating in half stars
+		// from 0.5 to 5, a written body that may be flagged as a spoiler, or
+		// both. Editing a review keeps the version it replaces in
+		// review_edits.
+		Version: 14,
+		Name:    "reviews",
+		Up: exec(
+			`CREATE TABLE reviews (
+				id SERIAL PRIMARY KEY,
+				session_id INTEGER NOT NULL UNIQUE REFERENCES reading_history(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				rating DOUBLE PRECISION CHECK (rating IS NULL OR (rating >= 0.5 AND rating <= 5)),
+				body TEXT NOT NULL DEFAULT '',
+				spoiler INTEGER NOT NULL DEFAULT 0 CHECK (spoiler IN (0, 1)),
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX idx_reviews_user_id ON reviews(user_id);",
+			`CREATE TABLE review_edits (
+				id SERIAL PRIMARY KEY,
+				review_id INTEGER NOT NULL REFERENCES reviews(id) ON DELETE CASCADE,
+				rating DOUBLE PRECISION,
+				body TEXT NOT NULL DEFAULT '',
+				spoiler INTEGER NOT NULL DEFAULT 0 CHECK (spoiler IN (0, 1)),
+				edited_at TIMESTAMPTZ NOT NULL
+			);`,
+			"CREATE INDEX idx_review_edits_review_id ON review_edits(review_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS review_edits;",
+			"DROP TABLE IF EXISTS reviews;",
+		),
+	},
+	{
+		// Notes are quotes, highlights or the reader's own notes on a book,
+		// optionally tied to the reading session they were taken in, with
+		// Markdown bodies searched through a generated tsvector like
+		// books.search.
+		Version: 15,
+		Name:    "notes",
+		Up: exec(
+			`CREATE TABLE notes (
+				id SERIAL PRIMARY KEY,
+				book_id INTEGER NOT NULL REFERENCES books(id) ON DELETE CASCADE,
+				user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				session_id INTEGER REFERENCES reading_history(id) ON DELETE SET NULL,
+				type TEXT NOT NULL CHECK (type IN ('quote', 'highlight', 'note')),
+				page INTEGER,
+				body TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				search tsvector GENERATED ALWAYS AS (to_tsvector('simple', body)) STORED
+			);`,
+			"CREATE INDEX idx_notes_book_id ON notes(book_id);",
+			"CREATE INDEX idx_notes_user_id ON notes(user_id);",
+			"CREATE INDEX idx_notes_search ON notes USING GIN (search);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS notes;",
+		),
+	},
+	{
+		// Notes imported from elsewhere, such as Kindle clippings, keep the
+		// ebook location they were taken at and a key identifying their
+		// source entry, so importing the same entries again adds nothing.
+		Version: 16,
+		Name:    "note_imports",
+		Up: exec(
+			"ALTER TABLE notes ADD COLUMN location INTEGER;",
+			"ALTER TABLE notes ADD COLUMN import_key TEXT;",
+			"CREATE UNIQUE INDEX idx_notes_import_key ON notes(user_id, import_key);",
+		),
+		Down: exec(
+			"DROP INDEX IF EXISTS idx_notes_import_key;",
+			"ALTER TABLE notes DROP COLUMN import_key;",
+			"ALTER TABLE notes DROP COLUMN location;",
+		),
+	},
+}
@@ -0,0 +1,594 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"booklib/internal/dialect"
+)
+
+// sqliteMigrations holds the schema history for SQLite databases. Append new
+// migrations to the end with the next version number; never edit one that
+// has already shipped.
+var sqliteMigrations = []Migration{
+	{
+		// The initial schema uses IF NOT EXISTS so databases created before
+		// migrations existed are adopted as-is.
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *sql.Tx) error {
+			err := exec(
+				`CREATE TABLE IF NOT EXISTS users (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					username TEXT UNIQUE NOT NULL,
+					email TEXT UNIQUE NOT NULL,
+					password_hash TEXT NOT NULL,
+					role TEXT DEFAULT 'user' CHECK (role IN ('user', 'admin')),
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);`,
+				"CREATE INDEX IF NOT EXISTS idx_users_username ON users(username);",
+				"CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);",
+
+				`CREATE TABLE IF NOT EXISTS books (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id INTEGER NOT NULL,
+					title TEXT NOT NULL,
+					author TEXT,
+					isbn TEXT,
+					genre TEXT,
+					read INTEGER DEFAULT 0 CHECK (read IN (0, 1)),
+					cover_url TEXT,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				);`,
+				"CREATE INDEX IF NOT EXISTS idx_books_user_id ON books(user_id);",
+				"CREATE INDEX IF NOT EXISTS idx_books_isbn ON books(isbn);",
+				"CREATE INDEX IF NOT EXISTS idx_books_title ON books(title);",
+				"CREATE INDEX IF NOT EXISTS idx_books_author ON books(author);",
+
+				`CREATE TABLE IF NOT EXISTS isbn_cache (
+					isbn TEXT PRIMARY KEY,
+					title TEXT,
+					author TEXT,
+					genre TEXT,
+					cover_url TEXT,
+					cached_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);`,
+				// Index for cache expiration cleanup
+				"CREATE INDEX IF NOT EXISTS idx_isbn_cache_cached_at ON isbn_cache(cached_at);",
+
+				`CREATE TABLE IF NOT EXISTS lending (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					book_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					lent_to TEXT NOT NULL,
+					lent_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					due_date DATETIME,
+					returned_at DATETIME,
+					last_reminder_sent DATETIME,
+					FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				);`,
+				"CREATE INDEX IF NOT EXISTS idx_lending_book_id ON lending(book_id);",
+				"CREATE INDEX IF NOT EXISTS idx_lending_user_id ON lending(user_id);",
+				"CREATE INDEX IF NOT EXISTS idx_lending_returned_at ON lending(returned_at);",
+				"CREATE INDEX IF NOT EXISTS idx_lending_due_date ON lending(due_date);",
+				"CREATE INDEX IF NOT EXISTS idx_lending_last_reminder_sent ON lending(last_reminder_sent);",
+
+				`CREATE TABLE IF NOT EXISTS reading_history (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					book_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					started_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					completed_at DATETIME,
+					FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				);`,
+				"CREATE INDEX IF NOT EXISTS idx_reading_history_book_id ON reading_history(book_id);",
+				"CREATE INDEX IF NOT EXISTS idx_reading_history_user_id ON reading_history(user_id);",
+				"CREATE INDEX IF NOT EXISTS idx_reading_history_completed_at ON reading_history(completed_at);",
+				"CREATE INDEX IF NOT EXISTS idx_reading_history_started_at ON reading_history(started_at);",
+
+				`CREATE TABLE IF NOT EXISTS settings (
+					key TEXT PRIMARY KEY,
+					value TEXT NOT NULL,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);`,
+				"INSERT OR IGNORE INTO settings (key, value) VALUES ('registration_enabled', 'true');",
+
+				`CREATE TABLE IF NOT EXISTS user_settings (
+					user_id INTEGER PRIMARY KEY,
+					email_reminders_enabled BOOLEAN DEFAULT 1,
+					email_upcoming_reminders BOOLEAN DEFAULT 1,
+					email_overdue_reminders BOOLEAN DEFAULT 1,
+					default_lending_days INTEGER DEFAULT 14,
+					yearly_reading_goal INTEGER DEFAULT 0,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+				);`,
+			)(tx)
+			if err != nil {
+				return err
+			}
+
+			// Older databases may already hold duplicate ISBNs for a user. Keep
+			// them rather than failing the migration; duplicate prevention is
+			// then handled in application code instead.
+			var dupCount int
+			err = tx.QueryRow(`
+				SELECT COUNT(*) FROM (
+					SELECT user_id, isbn
+					FROM books
+					WHERE isbn IS NOT NULL AND isbn != ''
+					GROUP BY user_id, isbn
+					HAVING COUNT(*) > 1
+				)
+			`).Scan(&dupCount)
+			if err != nil {
+				return err
+			}
+			if dupCount > 0 {
+				log.Printf("Warning: Found %d duplicate ISBN entries for users; skipping unique index on user_id and isbn", dupCount)
+				return nil
+			}
+
+			_, err = tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_books_user_isbn_unique ON books(user_id, isbn) WHERE isbn IS NOT NULL AND isbn != '';")
+			return err
+		},
+		Down: exec(
+			"DROP TABLE IF EXISTS user_settings;",
+			"DROP TABLE IF EXISTS settings;",
+			"DROP TABLE IF EXISTS reading_history;",
+			"DROP TABLE IF EXISTS lending;",
+			"DROP TABLE IF EXISTS isbn_cache;",
+			"DROP TABLE IF EXISTS books;",
+			"DROP TABLE IF EXISTS users;",
+		),
+	},
+	{
+		// Normalization is one-way: the original spelling of each ISBN is
+		// not kept, so reverting only forgets that the migration ran.
+		Version: 2,
+		Name:    "normalize_isbns",
+		Up:      normalizeISBNs(dialect.SQLite),
+		Down:    exec(),
+	},
+	{
+		Version: 3,
+		Name:    "add_book_notes",
+		Up:      exec("ALTER TABLE books ADD COLUMN notes TEXT;"),
+		Down:    exec("ALTER TABLE books DROP COLUMN notes;"),
+	},
+	{
+		// books_fts is an external-content FTS5 index over books kept in
+		// sync by triggers. FTS5 is only compiled into go-sqlite3 with the
+		// sqlite_fts5 build tag.
+		Version: 4,
+		Name:    "book_search",
+		Up: func(tx *sql.Tx) error {
+			_, err := tx.Exec(`CREATE VIRTUAL TABLE books_fts USING fts5(
+				title, author, genre, notes,
+				content='books', content_rowid='id',
+				tokenize='unicode61 remove_diacritics 2'
+			);`)
+			if err != nil {
+				if strings.Contains(err.Error(), "no such module: fts5") {
+					return fmt.Errorf("%v (build with -tags sqlite_fts5)", err)
+				}
+				return err
+			}
+			return exec(
+				`CREATE TRIGGER books_fts_insert AFTER INSERT ON books BEGIN
+					INSERT INTO books_fts (rowid, title, author, genre, notes)
+					VALUES (new.id, new.title, new.author, new.genre, new.notes);
+				END;`,
+				`CREATE TRIGGER books_fts_delete AFTER DELETE ON books BEGIN
+					INSERT INTO books_fts (books_fts, rowid, title, author, genre, notes)
+					VALUES ('delete', old.id, old.title, old.author, old.genre, old.notes);
+				END;`,
+				`CREATE TRIGGER books_fts_update AFTER UPDATE OF title, author, genre, notes ON books BEGIN
+					INSERT INTO books_fts (books_fts, rowid, title, author, genre, notes)
+					VALUES ('delete', old.id, old.title, old.author, old.genre, old.notes);
+					INSERT INTO books_fts (rowid, title, author, genre, notes)
+					VALUES (new.id, new.title, new.author, new.genre, new.notes);
+				END;`,
+				"INSERT INTO books_fts (books_fts) VALUES ('rebuild');",
+			)(tx)
+		},
+		Down: exec(
+			"DROP TRIGGER IF EXISTS books_fts_update;",
+			"DROP TRIGGER IF EXISTS books_fts_delete;",
+			"DROP TRIGGER IF EXISTS books_fts_insert;",
+			"DROP TABLE IF EXISTS books_fts;",
+		),
+	},
+	{
+		// Published dates are kept as text since providers often only
+		// know the year or month.
+		Version: 5,
+		Name:    "add_book_metadata",
+		Up: exec(
+			"ALTER TABLE books ADD COLUMN description TEXT;",
+			"ALTER TABLE books ADD COLUMN page_count INTEGER;",
+			"ALTER TABLE books ADD COLUMN publisher TEXT;",
+			"ALTER TABLE books ADD COLUMN published_date TEXT;",
+			"ALTER TABLE books ADD COLUMN language TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN description TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN page_count INTEGER;",
+			"ALTER TABLE isbn_cache ADD COLUMN publisher TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN published_date TEXT;",
+			"ALTER TABLE isbn_cache ADD COLUMN language TEXT;",
+		),
+		Down: exec(
+			"ALTER TABLE isbn_cache DROP COLUMN language;",
+			"ALTER TABLE isbn_cache DROP COLUMN published_date;",
+			"ALTER TABLE isbn_cache DROP COLUMN publisher;",
+			"ALTER TABLE isbn_cache DROP COLUMN page_count;",
+			"ALTER TABLE isbn_cache DROP COLUMN description;",
+			"ALTER TABLE books DROP COLUMN language;",
+			"ALTER TABLE books DROP COLUMN published_date;",
+			"ALTER TABLE books DROP COLUMN publisher;",
+			"ALTER TABLE books DROP COLUMN page_count;",
+			"ALTER TABLE books DROP COLUMN description;",
+		),
+	},
+	{
+		// Pinned entries were corrected by an admin, so the cache refresh
+		// leaves them alone.
+		Version: 6,
+		Name:    "isbn_cache_pinned",
+		Up:      exec("ALTER TABLE isbn_cache ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;"),
+		Down:    exec("ALTER TABLE isbn_cache DROP COLUMN pinned;"),
+	},
+	{
+		// One proposal per book: a new run skips books that already have
+		// one, so rejected proposals aren't made again.
+		Version: 7,
+		Name:    "enrichment_proposals",
+		Up: exec(
+			`CREATE TABLE enrichment_proposals (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				book_id INTEGER NOT NULL UNIQUE,
+				user_id INTEGER NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'rejected')),
+				matched_by TEXT NOT NULL,
+				score REAL NOT NULL DEFAULT 1,
+				isbn TEXT,
+				genre TEXT,
+				cover_url TEXT,
+				description TEXT,
+				page_count INTEGER,
+				publisher TEXT,
+				published_date TEXT,
+				language TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_enrichment_proposals_user_id ON enrichment_proposals(user_id);",
+		),
+		Down: exec("DROP TABLE IF EXISTS enrichment_proposals;"),
+	},
+	{
+		// Authors are shared between users and matched by name_key, see
+		// authors.Key. books.author is kept as the display string.
+		Version: 8,
+		Name:    "authors",
+		Up: func(tx *sql.Tx) error {
+			err := exec(
+				`CREATE TABLE authors (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					name TEXT NOT NULL,
+					name_key TEXT NOT NULL UNIQUE,
+					created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				);`,
+				`CREATE TABLE book_authors (
+					book_id INTEGER NOT NULL,
+					author_id INTEGER NOT NULL,
+					role TEXT NOT NULL DEFAULT 'author' CHECK (role IN ('author', 'translator', 'illustrator', 'editor')),
+					position INTEGER NOT NULL DEFAULT 0,
+					PRIMARY KEY (book_id, author_id, role),
+					FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+					FOREIGN KEY (author_id) REFERENCES authors(id) ON DELETE CASCADE
+				);`,
+				"CREATE INDEX idx_book_authors_author_id ON book_authors(author_id);",
+			)(tx)
+			if err != nil {
+				return err
+			}
+			return splitAuthors(dialect.SQLite)(tx)
+		},
+		Down: exec(
+			"DROP TABLE IF EXISTS book_authors;",
+			"DROP TABLE IF EXISTS authors;",
+		),
+	},
+	{
+		// books.genre stays the book's main genre, the first of its
+		// book_genres. Tags belong to a user and are matched by name_key,
+		// see tags.Key. isbn_cache.genres holds a JSON array.
+		Version: 9,
+		Name:    "genres_and_tags",
+		Up: exec(
+			`CREATE TABLE book_genres (
+				book_id INTEGER NOT NULL,
+				genre TEXT NOT NULL,
+				position INTEGER NOT NULL DEFAULT 0,
+				PRIMARY KEY (book_id, genre),
+				FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+			);`,
+			`CREATE TABLE tags (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			`CREATE TABLE book_tags (
+				book_id INTEGER NOT NULL,
+				tag_id INTEGER NOT NULL,
+				PRIMARY KEY (book_id, tag_id),
+				FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+				FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_book_tags_tag_id ON book_tags(tag_id);",
+			`INSERT INTO book_genres (book_id, genre, position)
+				SELECT id, TRIM(genre), 0 FROM books WHERE TRIM(COALESCE(genre, '')) <> '';`,
+			"ALTER TABLE isbn_cache ADD COLUMN genres TEXT;",
+		),
+		Down: exec(
+			"ALTER TABLE isbn_cache DROP COLUMN genres;",
+			"DROP TABLE IF EXISTS book_tags;",
+			"DROP TABLE IF EXISTS tags;",
+			"DROP TABLE IF EXISTS book_genres;",
+		),
+	},
+	{
+		// Shelves are ordered per user by position and matched by name_key,
+		// see shelves.Key. shelf_books.position orders a shelf's books.
+		Version: 10,
+		Name:    "shelves",
+		Up: exec(
+			`CREATE TABLE shelves (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				position INTEGER NOT NULL DEFAULT 0,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			`CREATE TABLE shelf_books (
+				shelf_id INTEGER NOT NULL,
+				book_id INTEGER NOT NULL,
+				position INTEGER NOT NULL DEFAULT 0,
+				added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				PRIMARY KEY (shelf_id, book_id),
+				FOREIGN KEY (shelf_id) REFERENCES shelves(id) ON DELETE CASCADE,
+				FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_shelf_books_book_id ON shelf_books(book_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS shelf_books;",
+			"DROP TABLE IF EXISTS shelves;",
+		),
+	},
+	{
+		// A smart shelf's rules are a JSON models.ShelfRules, evaluated when
+		// the shelf is read. Names are matched by name_key, see shelves.Key.
+		Version: 11,
+		Name:    "smart_shelves",
+		Up: exec(
+			`CREATE TABLE smart_shelves (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				name_key TEXT NOT NULL,
+				description TEXT NOT NULL DEFAULT '',
+				rules TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				UNIQUE (user_id, name_key),
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS smart_shelves;",
+		),
+	},
+	{
+		// books.status is the book's place in the reading state machine, see
+		// package reading, while books.read says whether it was ever read: it
+		// is set while the book is finished or once a session of it was
+		// completed, so a re-read doesn't clear it. Existing books are reading
+		// with a session in progress and otherwise finished if read; they
+		// keep their read flag, and those with a completed session become
+		// read. reading_status_changes logs every move with its time.
+		Version: 12,
+		Name:    "reading_status",
+		Up: exec(
+			`ALTER TABLE books ADD COLUMN status TEXT NOT NULL DEFAULT 'want_to_read'
+				CHECK (status IN ('want_to_read', 'reading', 'paused', 'finished', 'did_not_finish'));`,
+			"ALTER TABLE books ADD COLUMN status_changed_at DATETIME;",
+			"ALTER TABLE reading_history ADD COLUMN abandoned_at DATETIME;",
+			`UPDATE books SET status = CASE
+				WHEN EXISTS (SELECT 1 FROM reading_history h WHERE h.book_id = books.id AND h.completed_at IS NULL)
+					THEN 'reading'
+				WHEN read = 1 THEN 'finished'
+				ELSE 'want_to_read'
+			END;`,
+			`UPDATE books SET read = 1 WHERE EXISTS (
+				SELECT 1 FROM reading_history h WHERE h.book_id = books.id AND h.completed_at IS NOT NULL
+			);`,
+			`UPDATE books SET status_changed_at = (
+				SELECT MAX(COALESCE(h.completed_at, h.started_at)) FROM reading_history h WHERE h.book_id = books.id
+			);`,
+			`CREATE TABLE reading_status_changes (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				book_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				from_status TEXT NOT NULL,
+				to_status TEXT NOT NULL,
+				changed_at DATETIME NOT NULL,
+				FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_reading_status_changes_book_id ON reading_status_changes(book_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS reading_status_changes;",
+			"ALTER TABLE reading_history DROP COLUMN abandoned_at;",
+			"ALTER TABLE books DROP COLUMN status_changed_at;",
+			"ALTER TABLE books DROP COLUMN status;",
+		),
+	},
+	{
+		// A session's progress updates give the page, percent or ebook
+		// location reached, with percent worked out from the others when the
+		// book's length is known.
+		Version: 13,
+		Name:    "reading_progress",
+		Up: exec(
+			`CREATE TABLE reading_progress (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				session_id INTEGER NOT NULL,
+				user_id INTEGER NOT NULL,
+				page INTEGER,
+				location INTEGER,
+				location_total INTEGER,
+				percent REAL,
+				recorded_at DATETIME NOT NULL,
+				FOREIGN KEY (session_id) REFERENCES reading_history(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_reading_progress_session_id ON reading_progress(session_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS reading_progress;",
+		),
+	},
+	{
+		// A reading session has at most one review: a rating in half stars
+		// from 0.5 to 5, a written body that may be flagged as a spoiler, or
+		// both. Editing a review keeps the version it replaces in
+		// review_edits.
+		Version: 14,
+		Name:    "reviews",
+		Up: exec(
+			`CREATE TABLE reviews (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				session_id INTEGER NOT NULL UNIQUE,
+				user_id INTEGER NOT NULL,
+				rating REAL CHECK (rating IS NULL OR (rating >= 0.5 AND rating <= 5)),
+				body TEXT NOT NULL DEFAULT '',
+				spoiler INTEGER NOT NULL DEFAULT 0 CHECK (spoiler IN (0, 1)),
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL,
+				FOREIGN KEY (session_id) REFERENCES reading_history(id) ON DELETE CASCADE,
+				FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_reviews_user_id ON reviews(user_id);",
+			`CREATE TABLE review_edits (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				review_id INTEGER NOT NULL,
+				rating REAL,
+				body TEXT NOT NULL DEFAULT '',
+				spoiler INTEGER NOT NULL DEFAULT 0 CHECK (spoiler IN (0, 1)),
+				edited_at DATETIME NOT NULL,
+				FOREIGN KEY (review_id) REFERENCES reviews(id) ON DELETE CASCADE
+			);`,
+			"CREATE INDEX idx_review_edits_review_id ON review_edits(review_id);",
+		),
+		Down: exec(
+			"DROP TABLE IF EXISTS review_edits;",
+			"DROP TABLE IF EXISTS reviews;",
+		),
+	},
+	{
+		// Notes are quotes, highlights or the reader's own notes on a book,
+		// optionally tied to the reading session they were taken in, with
+		// Markdown bodies. notes_fts indexes their bodies like books_fts
+		// does books.
+		Version: 15,
+		Name:    "notes",
+		Up: func(tx *sql.Tx) error {
+			err := exec(
+				`CREATE TABLE notes (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					book_id INTEGER NOT NULL,
+					user_id INTEGER NOT NULL,
+					session_id INTEGER,
+					type TEXT NOT NULL CHECK (type IN ('quote', 'highlight', 'note')),
+					page INTEGER,
+					body TEXT NOT NULL,
+					created_at DATETIME NOT NULL,
+					updated_at DATETIME NOT NULL,
+					FOREIGN KEY (book_id) REFERENCES books(id) ON DELETE CASCADE,
+					FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+					FOREIGN KEY (session_id) REFERENCES reading_history(id) ON DELETE SET NULL
+				);`,
+				"CREATE INDEX idx_notes_book_id ON notes(book_id);",
+				"CREATE INDEX idx_notes_user_id ON notes(user_id);",
+			)(tx)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`CREATE VIRTUAL TABLE notes_fts USING fts5(
+				body,
+				content='notes', content_rowid='id',
+				tokenize='unicode61 remove_diacritics 2'
+			);`)
+			if err != nil {
+				if strings.Contains(err.Error(), "no such module: fts5") {
+					return fmt.Errorf("%v (build with -tags sqlite_fts5)", err)
+				}
+				return err
+			}
+			return exec(
+				`CREATE TRIGGER notes_fts_insert AFTER INSERT ON notes BEGIN
+					INSERT INTO notes_fts (rowid, body) VALUES (new.id, new.body);
+				END;`,
+				`CREATE TRIGGER notes_fts_delete AFTER DELETE ON notes BEGIN
+					INSERT INTO notes_fts (notes_fts, rowid, body) VALUES ('delete', old.id, old.body);
+				END;`,
+				`CREATE TRIGGER notes_fts_update AFTER UPDATE OF body ON notes BEGIN
+					INSERT INTO notes_fts (notes_fts, rowid, body) VALUES ('delete', old.id, old.body);
+					INSERT INTO notes_fts (rowid, body) VALUES (new.id, new.body);
+				END;`,
+			)(tx)
+		},
+		Down: exec(
+			"DROP TRIGGER IF EXISTS notes_fts_update;",
+			"DROP TRIGGER IF EXISTS notes_fts_delete;",
+			"DROP TRIGGER IF EXISTS notes_fts_insert;",
+			"DROP TABLE IF EXISTS notes_fts;",
+			"DROP TABLE IF EXISTS notes;",
+		),
+	},
+	{
+		// Notes imported from elsewhere, such as Kindle clippings, keep the
+		// ebook location they were taken at and a key identifying their
+		// source entry, so importing the same entries again adds nothing.
+		Version: 16,
+		Name:    "note_imports",
+		Up: exec(
+			"ALTER TABLE notes ADD COLUMN location INTEGER;",
+			"ALTER TABLE notes ADD COLUMN import_key TEXT;",
+			"CREATE UNIQUE INDEX idx_notes_import_key ON notes(user_id, import_key);",
+		),
+		Down: exec(
+			"DROP INDEX IF EXISTS idx_notes_import_key;",
+			"ALTER TABLE notes DROP COLUMN import_key;",
+			"ALTER TABLE notes DROP COLUMN location;",
+		),
+	},
+}
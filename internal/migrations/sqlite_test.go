@@ -0,0 +1,167 @@
+//go:build sqlite_fts5
+
+package migrations
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"booklib/internal/dialect"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(dialect.SQLite.DriverName(), filepath.Join(t.TempDir(), "booklib.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// migrateTo applies the SQLite migrations up to and including version.
+func migrateTo(t *testing.T, db *sql.DB, version int) {
+	t.Helper()
+	if err := ensureMigrationsTable(db, dialect.SQLite); err != nil {
+		t.Fatal(err)
+	}
+	done, err := applied(db, dialect.SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range All(dialect.SQLite) {
+		if _, ok := done[m.Version]; ok || m.Version > version {
+			continue
+		}
+		if err := run(db, dialect.SQLite, m, m.Up, true); err != nil {
+			t.Fatalf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+	}
+}
+
+func mustExec(t *testing.T, db *sql.DB, query string, args ...any) {
+	t.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+}
+
+func TestNormalizeISBNsMigration(t *testing.T) {
+	db := openSQLite(t)
+	migrateTo(t, db, 1)
+	mustExec(t, db, "INSERT INTO users (id, username, email, password_hash) VALUES (1, 'a', 'a@example.com', 'x'), (2, 'b', 'b@example.com', 'x')")
+	mustExec(t, db, `INSERT INTO books (id, user_id, title, isbn) VALUES
+		(1, 1, 'Dune', '0-441-01359-7'),
+		(2, 1, 'Dune again', '9780441013593'),
+		(3, 2, 'Dune', '0441013597'),
+		(4, 2, 'Unknown', 'not an isbn')`)
+	mustExec(t, db, `INSERT INTO isbn_cache (isbn, title) VALUES
+		('0441013597', 'Dune (old key)'),
+		('9780441013593', 'Dune'),
+		('0-14-143951-3', 'Emma'),
+		('garbage', 'Nothing')`)
+	migrateTo(t, db, 2)
+
+	books := map[int]string{
+		// Already owned in normalized form, so left alone
+		1: "0-441-01359-7",
+		2: "9780441013593",
+		3: "9780441013593",
+		4: "not an isbn",
+	}
+	for id, want := range books {
+		var got string
+		if err := db.QueryRow("SELECT isbn FROM books WHERE id = ?", id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("book %d has ISBN %q, want %q", id, got, want)
+		}
+	}
+
+	rows, err := db.Query("SELECT isbn, title FROM isbn_cache ORDER BY isbn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var isbn, title string
+		if err := rows.Scan(&isbn, &title); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, isbn+" "+title)
+	}
+	want := []string{"9780141439518 Emma", "9780441013593 Dune"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("cache holds %q, want %q", got, want)
+	}
+}
+
+func TestSplitAuthorsMigration(t *testing.T) {
+	db := openSQLite(t)
+	migrateTo(t, db, 7)
+	mustExec(t, db, "INSERT INTO users (id, username, email, password_hash) VALUES (1, 'a', 'a@example.com', 'x'), (2, 'b', 'b@example.com', 'x')")
+	mustExec(t, db, `INSERT INTO books (id, user_id, title, author) VALUES
+		(1, 1, 'The Hobbit', 'Tolkien, J.R.R.'),
+		(2, 2, 'The Silmarillion', 'J. R. R. Tolkien & Christopher Tolkien'),
+		(3, 1, 'Good Omens', 'Terry Pratchett and Neil Gaiman'),
+		(4, 1, 'Repeated', 'Frank Herbert; Herbert, Frank'),
+		(5, 1, 'Anonymous', ''),
+		(6, 1, 'Unknown', NULL)`)
+	migrateTo(t, db, 8)
+
+	rows, err := db.Query(`SELECT ba.book_id, a.name, a.name_key, ba.role, ba.position
+		FROM book_authors ba JOIN authors a ON a.id = ba.author_id
+		ORDER BY ba.book_id, ba.position`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type credit struct {
+		book      int
+		name, key string
+		role      string
+		position  int
+	}
+	var got []credit
+	for rows.Next() {
+		var c credit
+		if err := rows.Scan(&c.book, &c.name, &c.key, &c.role, &c.position); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, c)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []credit{
+		{1, "Tolkien, J.R.R.", "j r r tolkien", "author", 0},
+		// Matched across users and named as first seen
+		{2, "Tolkien, J.R.R.", "j r r tolkien", "author", 0},
+		{2, "Christopher Tolkien", "christopher tolkien", "author", 1},
+		{3, "Terry Pratchett", "terry pratchett", "author", 0},
+		{3, "Neil Gaiman", "neil gaiman", "author", 1},
+		// Credited once
+		{4, "Frank Herbert", "frank herbert", "author", 0},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got credits %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("credit %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	var author string
+	if err := db.QueryRow("SELECT author FROM books WHERE id = 2").Scan(&author); err != nil {
+		t.Fatal(err)
+	}
+	if author != "J. R. R. Tolkien & Christopher Tolkien" {
+		t.Errorf("author string rewritten to %q", author)
+	}
+}
@@ -0,0 +1,47 @@
+package models
+
+// Roles a person can be credited with on a book.
+const (
+	RoleAuthor      = "author"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+	RoleEditor      = "editor"
+)
+
+// AuthorRoles lists the valid roles.
+var AuthorRoles = []string{RoleAuthor, RoleTranslator, RoleIllustrator, RoleEditor}
+
+type Author struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// BookAuthor credits a person on a book.
+type BookAuthor struct {
+	// ID is the author's ID. It is ignored when writing a book; authors
+	// are matched by name.
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+// AuthorSummary is an author as listed for a user, with the number of the
+// user's books they are credited on.
+type AuthorSummary struct {
+	Author
+	BookCount int `json:"book_count"`
+}
+
+// AuthorDetail is an author's page: the user's books they are credited
+// on.
+type AuthorDetail struct {
+	Author
+	Books []AuthoredBook `json:"books"`
+}
+
+// AuthoredBook is a book on an author's page with the author's roles on
+// it.
+type AuthoredBook struct {
+	Book
+	Roles []string `json:"roles"`
+}
@@ -3,11 +3,42 @@ package models
 import "time"
 
 type Book struct {
-	ID        int        `json:"id"`
-	Title     string     `json:"title"`
-	Author    string     `json:"author"`
-	ISBN      string     `json:"isbn"`
-	Genre     string     `json:"genre"`
-	Read      bool       `json:"read"`
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	// Author is the display form of Authors: the names credited as author.
+	// A book written with only Author gets an author credit for each name
+	// in it.
+	Author  string       `json:"author"`
+	Authors []BookAuthor `json:"authors,omitempty"`
+	ISBN    string       `json:"isbn"`
+	// Genre is the book's main genre, the first of Genres.
+	Genre  string   `json:"genre"`
+	Genres []string `json:"genres,omitempty"`
+	// Tags name the user's tags on the book. Updates without tags leave
+	// them unchanged.
+	Tags []string `json:"tags,omitempty"`
+	// Status is the book's reading status, see package reading, and Read
+	// whether it has been read, see reading.Read. Updates can't change
+	// either: the status moves through its own endpoint.
+	Status          string     `json:"status"`
+	StatusChangedAt *time.Time `json:"status_changed_at,omitempty"`
+	Read            bool       `json:"read"`
+	CoverURL        string     `json:"cover_url,omitempty"`
+	Description     string     `json:"description,omitempty"`
+	PageCount       int        `json:"page_count,omitempty"`
+	Publisher       string     `json:"publisher,omitempty"`
+	// PublishedDate is as precise as the source knows: YYYY, YYYY-MM or
+	// YYYY-MM-DD.
+	PublishedDate string `json:"published_date,omitempty"`
+	// Language is an ISO 639-1 code such as "en".
+	Language  string     `json:"language,omitempty"`
+	Notes     string     `json:"notes,omitempty"`
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
+
+// BookMatch is a book found by a library search, with an excerpt of the
+// matching text.
+type BookMatch struct {
+	Book
+	Snippet string `json:"snippet"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import "time"
+
+// Enrichment proposal statuses. Accepted proposals are deleted once they
+// are applied.
+const (
+	ProposalPending  = "pending"
+	ProposalRejected = "rejected"
+)
+
+// Ways an enrichment proposal's metadata was matched to its book.
+const (
+	MatchedByISBN        = "isbn"
+	MatchedByTitleAuthor = "title_author"
+)
+
+// EnrichmentProposal is metadata found for a book that the user can accept
+// into it. Only fields the book was missing when the proposal was made are
+// set.
+type EnrichmentProposal struct {
+	ID     int    `json:"id"`
+	BookID int    `json:"book_id"`
+	Status string `json:"status"`
+	// MatchedBy is MatchedByISBN or MatchedByTitleAuthor. Score is how
+	// closely the title and author agreed, from 0 to 1; ISBN matches score
+	// 1.
+	MatchedBy     string     `json:"matched_by"`
+	Score         float64    `json:"score"`
+	ISBN          string     `json:"isbn,omitempty"`
+	Genre         string     `json:"genre,omitempty"`
+	CoverURL      string     `json:"cover_url,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	PageCount     int        `json:"page_count,omitempty"`
+	Publisher     string     `json:"publisher,omitempty"`
+	PublishedDate string     `json:"published_date,omitempty"`
+	Language      string     `json:"language,omitempty"`
+	CreatedAt     *time.Time `json:"created_at,omitempty"`
+	// Book is the book as it is now.
+	Book *Book `json:"book,omitempty"`
+}
+
+// EnrichmentJob reports the progress of a user's enrichment run.
+type EnrichmentJob struct {
+	Running bool `json:"running"`
+	// Total is the number of books the run looks up.
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Proposed   int        `json:"proposed"`
+	Failed     int        `json:"failed"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+type AcceptProposalRequest struct {
+	// Fields limits which proposed fields are applied, by their JSON
+	// names. Empty applies all of them.
+	Fields []string `json:"fields"`
+}
+
+type BulkProposalRequest struct {
+	// IDs selects proposals; empty selects every pending one.
+	IDs []int `json:"ids"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// ExportVersion identifies the archive layout. Restores refuse archives
+// written by a newer version.
+const ExportVersion = 1
+
+// Export is a complete copy of one user's data. IDs are those of the
+// instance that wrote it; lending, reading history, status changes, notes
+// and shelves refer to books by those IDs, and reading progress, reviews and
+// notes to reading history.
+type Export struct {
+	Version        int              `json:"version"`
+	ExportedAt     time.Time        `json:"exported_at"`
+	Books          []Book           `json:"books"`
+	Lending        []Lending        `json:"lending"`
+	ReadingHistory []ReadingHistory `json:"reading_history"`
+	// StatusChanges are the books' moves between reading statuses, oldest
+	// first.
+	StatusChanges []StatusChange `json:"status_changes"`
+	// ReadingProgress refers to its session's ID in ReadingHistory.
+	ReadingProgress []ReadingProgress `json:"reading_progress"`
+	// Reviews refer to their session's ID in ReadingHistory and carry their
+	// edits.
+	Reviews []Review `json:"reviews"`
+	// Notes refer to their book and session by their IDs in Books and
+	// ReadingHistory.
+	Notes        []Note             `json:"notes"`
+	Shelves      []ExportShelf      `json:"shelves"`
+	SmartShelves []ExportSmartShelf `json:"smart_shelves"`
+	UserSettings *UserSettings      `json:"user_settings,omitempty"`
+}
+
+// RestoreResult counts what a restore wrote. Books the user already owns are
+// skipped together with their lending, reading history, status changes and
+// notes, and aren't placed on restored shelves. Shelves named like one of the
+// user's get the restored books added to it rather than being created again,
+// and smart shelves named like one of the user's are skipped.
+type RestoreResult struct {
+	BooksCreated           int  `json:"books_created"`
+	BooksSkipped           int  `json:"books_skipped"`
+	LendingCreated         int  `json:"lending_created"`
+	ReadingHistoryCreated  int  `json:"reading_history_created"`
+	StatusChangesCreated   int  `json:"status_changes_created"`
+	ReadingProgressCreated int  `json:"reading_progress_created"`
+	ReviewsCreated         int  `json:"reviews_created"`
+	NotesCreated           int  `json:"notes_created"`
+	ShelvesCreated         int  `json:"shelves_created"`
+	SmartShelvesCreated    int  `json:"smart_shelves_created"`
+	UserSettingsRestored   bool `json:"user_settings_restored"`
+}
@@ -0,0 +1,37 @@
+package models
+
+// Import row statuses. In a dry run they describe what would happen.
+const (
+	ImportCreated   = "created"
+	ImportDuplicate = "duplicate"
+	ImportRejected  = "rejected"
+)
+
+// ImportBook is a book to import along with reading sessions recorded for it
+// in the source file.
+type ImportBook struct {
+	Book
+	Sessions []ReadingHistory
+}
+
+// ImportRow reports the outcome for one data row of an import file. Row is
+// the line's position in the file, counting the header as row 1.
+type ImportRow struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Book   *Book  `json:"book,omitempty"`
+
+	ReadingHistory []ReadingHistory `json:"reading_history,omitempty"`
+}
+
+type ImportResult struct {
+	DryRun     bool        `json:"dry_run"`
+	Created    int         `json:"created"`
+	Duplicates int         `json:"duplicates"`
+	Rejected   int         `json:"rejected"`
+	Rows       []ImportRow `json:"rows"`
+	// EnrichmentStarted is set when the import started a metadata
+	// enrichment run for the books it left incomplete.
+	EnrichmentStarted bool `json:"enrichment_started,omitempty"`
+}
@@ -3,10 +3,19 @@ package models
 import "time"
 
 type IsbnCache struct {
-	ISBN     string     `json:"isbn"`
-	Title    string     `json:"title"`
-	Author   string     `json:"author"`
-	Genre    string     `json:"genre"`
-	CoverUrl string     `json:"cover_url"`
-	CachedAt *time.Time `json:"cached_at"`
+	ISBN          string     `json:"isbn"`
+	Title         string     `json:"title"`
+	Author        string     `json:"author"`
+	Genre         string     `json:"genre"`
+	Genres        []string   `json:"genres,omitempty"`
+	CoverUrl      string     `json:"cover_url"`
+	Description   string     `json:"description"`
+	PageCount     int        `json:"page_count"`
+	Publisher     string     `json:"publisher"`
+	PublishedDate string     `json:"published_date"`
+	Language      string     `json:"language"`
+	CachedAt      *time.Time `json:"cached_at"`
+	// Pinned entries were corrected by an admin and are never expired or
+	// refreshed automatically.
+	Pinned bool `json:"pinned"`
 }
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Note is a quote, a highlight or the reader's own note on a book, written
+// in Markdown.
+type Note struct {
+	ID     int `json:"id"`
+	BookID int `json:"book_id"`
+	// SessionID is the reading session the note was taken in, if any.
+	SessionID *int   `json:"session_id,omitempty"`
+	Type      string `json:"type"`
+	Page      *int   `json:"page,omitempty"`
+	// Location is the ebook location the note was taken at, if known.
+	Location *int   `json:"location,omitempty"`
+	Body     string `json:"body"`
+	// ImportKey identifies the entry an imported note came from, so the
+	// same entry isn't imported twice.
+	ImportKey *string   `json:"import_key,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type NoteRequest struct {
+	SessionID *int   `json:"session_id"`
+	Type      string `json:"type"`
+	Page      *int   `json:"page"`
+	Location  *int   `json:"location"`
+	Body      string `json:"body"`
+}
+
+// NoteMatch is a note found by a search, with the title of its book and an
+// excerpt of the matching text.
+type NoteMatch struct {
+	Note
+	BookTitle string `json:"book_title"`
+	Snippet   string `json:"snippet"`
+}
+
+// ClippingsResult reports the outcome of importing a Kindle clippings file.
+// In a dry run it describes what would happen. Skipped counts bookmarks and
+// entries that couldn't be read.
+type ClippingsResult struct {
+	DryRun     bool            `json:"dry_run"`
+	Created    int             `json:"created"`
+	Duplicates int             `json:"duplicates"`
+	Unmatched  int             `json:"unmatched"`
+	Skipped    int             `json:"skipped"`
+	Books      []ClippingsBook `json:"books"`
+}
+
+// ClippingsBook groups the clippings taken from one book, as the Kindle
+// names it, with the library book they were matched to. BookID is zero when
+// no book matched and the clippings weren't imported.
+type ClippingsBook struct {
+	Title      string `json:"title"`
+	Author     string `json:"author,omitempty"`
+	BookID     int    `json:"book_id,omitempty"`
+	BookTitle  string `json:"book_title,omitempty"`
+	Clippings  int    `json:"clippings"`
+	Created    int    `json:"created"`
+	Duplicates int    `json:"duplicates"`
+}
@@ -8,6 +8,9 @@ type ReadingHistory struct {
 	UserID      int        `json:"user_id"`
 	StartedAt   time.Time  `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	// AbandonedAt is when the book was given up on, ending the session
+	// without finishing it.
+	AbandonedAt *time.Time `json:"abandoned_at,omitempty"`
 }
 
 type ReadingHistoryWithBook struct {
@@ -16,6 +19,7 @@ type ReadingHistoryWithBook struct {
 	UserID      int        `json:"user_id"`
 	StartedAt   time.Time  `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	AbandonedAt *time.Time `json:"abandoned_at,omitempty"`
 	Book        *Book      `json:"book"`
 }
 
@@ -25,4 +29,98 @@ type StartReadingRequest struct {
 
 type FinishReadingRequest struct {
 	ReadingHistoryID int `json:"reading_history_id"`
+	// Review, if given, is saved as the finished session's review.
+	Review *ReviewRequest `json:"review"`
+}
+
+// SessionRequest gives the times of a reading session, to log one read in
+// the past or correct one. A session neither completed nor abandoned is in
+// progress.
+type SessionRequest struct {
+	BookID      int        `json:"book_id"`
+	StartedAt   *time.Time `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	AbandonedAt *time.Time `json:"abandoned_at"`
+}
+
+// ReadState is the reading status and read flag a book was left with.
+type ReadState struct {
+	Status string `json:"status"`
+	Read   bool   `json:"read"`
+}
+
+// EditedSession is a reading session as logged or corrected, with the
+// state its book was left in.
+type EditedSession struct {
+	ReadingHistory
+	ReadState
+}
+
+// StatusChange is a move of a book from one reading status to another.
+type StatusChange struct {
+	ID        int       `json:"id"`
+	BookID    int       `json:"book_id"`
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	ChangedAt time.Time `json:"changed_at"`
+	// Session is the reading session the move started, resumed or ended,
+	// if any. It is only set on the change just made.
+	Session *ReadingHistory `json:"session,omitempty"`
+}
+
+// BookStatus is a book's reading status along with the statuses it can
+// move to and how it got there, oldest change first.
+type BookStatus struct {
+	BookID    int            `json:"book_id"`
+	Status    string         `json:"status"`
+	ChangedAt *time.Time     `json:"changed_at,omitempty"`
+	Next      []string       `json:"next"`
+	Changes   []StatusChange `json:"changes"`
+}
+
+type StatusRequest struct {
+	Status string `json:"status"`
+}
+
+// ReadingProgress is how far a reading session had got at a point in time.
+type ReadingProgress struct {
+	ID        int  `json:"id"`
+	SessionID int  `json:"session_id"`
+	Page      *int `json:"page,omitempty"`
+	// Location is an ebook location, out of LocationTotal when known.
+	Location      *int `json:"location,omitempty"`
+	LocationTotal *int `json:"location_total,omitempty"`
+	// Percent is either given or worked out from the page and the book's
+	// page count, or from the location and LocationTotal.
+	Percent    *float64  `json:"percent,omitempty"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ProgressRequest records progress as one of a page, a percent or an
+// ebook location.
+type ProgressRequest struct {
+	Page          *int     `json:"page"`
+	Percent       *float64 `json:"percent"`
+	Location      *int     `json:"location"`
+	LocationTotal *int     `json:"location_total"`
+}
+
+// ReadingPace is how fast a session is going, going by its latest progress,
+// and when it will be finished at that pace.
+type ReadingPace struct {
+	// DaysRead is how long the session has been read for, leaving out
+	// time spent paused.
+	DaysRead        float64    `json:"days_read"`
+	Percent         *float64   `json:"percent,omitempty"`
+	PercentPerDay   *float64   `json:"percent_per_day,omitempty"`
+	PagesPerDay     *float64   `json:"pages_per_day,omitempty"`
+	EstimatedFinish *time.Time `json:"estimated_finish,omitempty"`
+}
+
+// ActiveSession is a session in progress with its progress updates, oldest
+// first, and its pace once there is progress to go on.
+type ActiveSession struct {
+	ReadingHistory
+	Progress []ReadingProgress `json:"progress"`
+	Pace     *ReadingPace      `json:"pace,omitempty"`
 }
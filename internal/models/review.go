@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Review is what the user made of a reading session once it ended: a star
+// rating in half stars, a written review, or both.
+type Review struct {
+	ID        int      `json:"id"`
+	SessionID int      `json:"session_id"`
+	Rating    *float64 `json:"rating,omitempty"`
+	Body      string   `json:"body,omitempty"`
+	// Spoiler marks a body that gives away the plot.
+	Spoiler   bool      `json:"spoiler"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Edits are the versions of the review that edits replaced, oldest
+	// first.
+	Edits []ReviewEdit `json:"edits"`
+}
+
+// ReviewEdit is an earlier version of a review, as it was until EditedAt.
+type ReviewEdit struct {
+	ID       int       `json:"id"`
+	ReviewID int       `json:"review_id"`
+	Rating   *float64  `json:"rating,omitempty"`
+	Body     string    `json:"body,omitempty"`
+	Spoiler  bool      `json:"spoiler"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// ReviewedSession is a reading session along with its review, if any.
+type ReviewedSession struct {
+	ReadingHistory
+	Review *Review `json:"review,omitempty"`
+}
+
+type ReviewRequest struct {
+	Rating  *float64 `json:"rating"`
+	Body    string   `json:"body"`
+	Spoiler bool     `json:"spoiler"`
+}
+
+// BookRating is the average of the ratings given to a book's reading
+// sessions.
+type BookRating struct {
+	BookID  int     `json:"book_id"`
+	Title   string  `json:"title"`
+	Author  string  `json:"author"`
+	Average float64 `json:"average"`
+	Ratings int     `json:"ratings"`
+}
+
+// AuthorRating is the average of the ratings given to sessions of the books
+// a person is credited on as author.
+type AuthorRating struct {
+	AuthorID int     `json:"author_id"`
+	Name     string  `json:"name"`
+	Average  float64 `json:"average"`
+	Ratings  int     `json:"ratings"`
+	Books    int     `json:"books"`
+}
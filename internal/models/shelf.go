@@ -0,0 +1,100 @@
+package models
+
+import "time"
+
+// Shelf is a named list of books in an order the user chooses. A book can
+// be on any number of shelves. Built-in shelves have a Slug instead of an
+// ID; their books are derived from reading history and lending and can't
+// be placed on them by hand.
+type Shelf struct {
+	ID          int        `json:"id,omitempty"`
+	Slug        string     `json:"slug,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Builtin     bool       `json:"builtin"`
+	BookCount   int        `json:"book_count"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// ShelfDetail is a shelf with its books in shelf order.
+type ShelfDetail struct {
+	Shelf
+	Books []Book `json:"books"`
+}
+
+// ExportShelf is a shelf in an export, with the IDs of its books in shelf
+// order.
+type ExportShelf struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	BookIDs     []int  `json:"book_ids"`
+}
+
+type ShelfRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type ShelfOrderRequest struct {
+	ShelfIDs []int `json:"shelf_ids"`
+}
+
+// ShelfBookRequest places a book on a shelf. Position counts from 0; without
+// one the book goes at the end.
+type ShelfBookRequest struct {
+	BookID   int  `json:"book_id"`
+	Position *int `json:"position,omitempty"`
+}
+
+type ShelfBookOrderRequest struct {
+	BookIDs []int `json:"book_ids"`
+}
+
+// SmartShelf is a saved set of rules. Its books are the user's books
+// matching the rules at the time it is read, so its contents and count are
+// always current.
+type SmartShelf struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Rules       ShelfRules `json:"rules"`
+	BookCount   int        `json:"book_count"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+}
+
+// SmartShelfDetail is a smart shelf with its books, newest first.
+type SmartShelfDetail struct {
+	SmartShelf
+	Books []Book `json:"books"`
+}
+
+// ShelfRules selects books matching all or any of its rules, as Match is
+// "all" or "any".
+type ShelfRules struct {
+	Match string      `json:"match"`
+	Rules []ShelfRule `json:"rules"`
+}
+
+// ShelfRule compares one property of a book with a value, for example
+// {"field": "genre", "op": "is", "value": "Fantasy"}. The fields, their
+// operators and value types are listed in the shelves package.
+type ShelfRule struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+type SmartShelfRequest struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Rules       ShelfRules `json:"rules"`
+}
+
+// ExportSmartShelf is a smart shelf in an export.
+type ExportSmartShelf struct {
+	ID          int        `json:"id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Rules       ShelfRules `json:"rules"`
+}
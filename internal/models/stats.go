@@ -0,0 +1,83 @@
+package models
+
+// UserStats summarises a single user's library for the stats page.
+type UserStats struct {
+	TotalBooks        int            `json:"total_books"`
+	BooksRead         int            `json:"books_read"`
+	BooksUnread       int            `json:"books_unread"`
+	ReadPercentage    float64        `json:"read_percentage"`
+	BooksLentOut      int            `json:"books_lent_out"`
+	BooksThisMonth    int            `json:"books_this_month"`
+	BooksThisYear     int            `json:"books_this_year"`
+	BooksReadThisYear int            `json:"books_read_this_year"`
+	TotalLendings     int            `json:"total_lendings"`
+	GenreBreakdown    []GenreStat    `json:"genre_breakdown"`
+	MonthlyReading    []MonthlyCount `json:"monthly_reading"`
+	TopLentBooks      []TopBook      `json:"top_lent_books"`
+	TopAuthors        []AuthorStat   `json:"top_authors"`
+	TagBreakdown      []TagStat      `json:"tag_breakdown"`
+	// AverageRating is over every rated session, and 0 without any.
+	AverageRating float64        `json:"average_rating"`
+	RatingsGiven  int            `json:"ratings_given"`
+	BookRatings   []BookRating   `json:"book_ratings"`
+	AuthorRatings []AuthorRating `json:"author_ratings"`
+}
+
+type GenreStat struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+// TagStat counts the books with a tag and how many of them have been read.
+type TagStat struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+	Read  int    `json:"read"`
+}
+
+// AuthorStat counts the books a person is credited on as author.
+type AuthorStat struct {
+	AuthorID int    `json:"author_id"`
+	Name     string `json:"name"`
+	Count    int    `json:"count"`
+}
+
+type MonthlyCount struct {
+	Month string `json:"month"`
+	Count int    `json:"count"`
+}
+
+type TopBook struct {
+	Title     string `json:"title"`
+	Author    string `json:"author"`
+	LentCount int    `json:"lent_count"`
+	CoverURL  string `json:"cover_url,omitempty"`
+}
+
+// AdminStats summarises the whole instance for the admin dashboard.
+type AdminStats struct {
+	TotalUsers    int            `json:"total_users"`
+	TotalBooks    int            `json:"total_books"`
+	BooksRead     int            `json:"books_read"`
+	BooksUnread   int            `json:"books_unread"`
+	BooksLentOut  int            `json:"books_lent_out"`
+	OverdueBooks  int            `json:"overdue_books"`
+	RecentUsers   []User         `json:"recent_users"`
+	RecentBooks   []BookWithUser `json:"recent_books"`
+	PopularGenres []GenreCount   `json:"popular_genres"`
+}
+
+type BookWithUser struct {
+	Book
+	Username string `json:"username"`
+}
+
+type GenreCount struct {
+	Genre string `json:"genre"`
+	Count int    `json:"count"`
+}
+
+type UserWithStats struct {
+	User
+	BookCount int `json:"book_count"`
+}
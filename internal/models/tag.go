@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Tag is a free-form label a user puts on their books, such as "signed" or
+// "book club 2026".
+type Tag struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// TagSummary is a tag with the number of books carrying it.
+type TagSummary struct {
+	Tag
+	BookCount int `json:"book_count"`
+}
+
+type TagRequest struct {
+	Name string `json:"name"`
+}
+
+type TagBooksRequest struct {
+	BookIDs []int `json:"book_ids"`
+}
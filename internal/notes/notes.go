@@ -0,0 +1,100 @@
+// Package notes checks the notes, quotes and highlights readers keep on
+// their books and renders them as Markdown.
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+)
+
+// Note types.
+const (
+	Quote     = "quote"
+	Highlight = "highlight"
+	Note      = "note"
+)
+
+// Types lists the note types.
+var Types = []string{Quote, Highlight, Note}
+
+// MaxLength caps the length of a note's body in characters.
+const MaxLength = 20000
+
+// ErrInvalidType is returned for a note type other than those in Types.
+var ErrInvalidType = errors.New("invalid note type")
+
+// ErrInvalidBody is returned for a body that is empty or longer than
+// MaxLength.
+var ErrInvalidBody = errors.New("invalid note body")
+
+// ErrInvalidPage is returned for a page number or location below 1.
+var ErrInvalidPage = errors.New("invalid page")
+
+// Validate trims the note's body and checks it, defaulting its type to
+// Note.
+func Validate(note *models.Note) error {
+	if note.Type == "" {
+		note.Type = Note
+	}
+	if !slices.Contains(Types, note.Type) {
+		return ErrInvalidType
+	}
+	note.Body = strings.TrimSpace(note.Body)
+	if note.Body == "" || utf8.RuneCountInString(note.Body) > MaxLength {
+		return ErrInvalidBody
+	}
+	if (note.Page != nil && *note.Page < 1) || (note.Location != nil && *note.Location < 1) {
+		return ErrInvalidPage
+	}
+	return nil
+}
+
+// Markdown renders a book's notes as a Markdown document, in the order
+// given and separated by rules: quotes and highlights as block quotes and
+// notes as they are, each followed by its type, page and location.
+func Markdown(book *models.Book, list []models.Note) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", book.Title)
+	if book.Author != "" {
+		fmt.Fprintf(&b, "\n*%s*\n", book.Author)
+	}
+	for i, note := range list {
+		if i > 0 {
+			b.WriteString("\n---\n")
+		}
+		b.WriteString("\n")
+		switch note.Type {
+		case Quote, Highlight:
+			for _, line := range strings.Split(note.Body, "\n") {
+				b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+			}
+		default:
+			b.WriteString(note.Body + "\n")
+		}
+		b.WriteString("\n— " + label(note.Type))
+		if note.Page != nil {
+			fmt.Fprintf(&b, ", p. %d", *note.Page)
+		}
+		if note.Location != nil {
+			fmt.Fprintf(&b, ", loc. %d", *note.Location)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// label names a note type for a reader.
+func label(noteType string) string {
+	switch noteType {
+	case Quote:
+		return "Quote"
+	case Highlight:
+		return "Highlight"
+	}
+	return "Note"
+}
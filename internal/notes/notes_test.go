@@ -0,0 +1,91 @@
+package notes
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func intPtr(n int) *int {
+	return &n
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		note models.Note
+		err  error
+	}{
+		{"defaults the type", models.Note{Body: "  Fear is the mind-killer.\n"}, nil},
+		{"quote", models.Note{Type: Quote, Body: "x", Page: intPtr(1), Location: intPtr(1)}, nil},
+		{"unknown type", models.Note{Type: "bookmark", Body: "x"}, ErrInvalidType},
+		{"blank body", models.Note{Body: " \n\t"}, ErrInvalidBody},
+		{"longest body", models.Note{Body: strings.Repeat("é", MaxLength)}, nil},
+		{"body too long", models.Note{Body: strings.Repeat("é", MaxLength+1)}, ErrInvalidBody},
+		{"page 0", models.Note{Body: "x", Page: intPtr(0)}, ErrInvalidPage},
+		{"negative location", models.Note{Body: "x", Location: intPtr(-3)}, ErrInvalidPage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(&tt.note); !errors.Is(err, tt.err) {
+				t.Errorf("Validate = %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	note := models.Note{Body: "  Fear is the mind-killer.\n"}
+	if err := Validate(&note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Type != Note || note.Body != "Fear is the mind-killer." {
+		t.Errorf("validated note is %+v", note)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert"}
+	list := []models.Note{
+		{Type: Quote, Page: intPtr(8), Body: "I must not fear.\n\nFear is the mind-killer."},
+		{Type: Highlight, Location: intPtr(1204), Body: "the spice must flow"},
+		{Type: Note, Page: intPtr(12), Location: intPtr(300), Body: "Compare with *Children of Dune*."},
+		{Type: Note, Body: "Reread the appendix."},
+	}
+	want := `# Dune
+
+*Frank Herbert*
+
+> I must not fear.
+>
+> Fear is the mind-killer.
+
+— Quote, p. 8
+
+---
+
+> the spice must flow
+
+— Highlight, loc. 1204
+
+---
+
+Compare with *Children of Dune*.
+
+— Note, p. 12, loc. 300
+
+---
+
+Reread the appendix.
+
+— Note
+`
+	if got := Markdown(book, list); got != want {
+		t.Errorf("Markdown =\n%s\nwant\n%s", got, want)
+	}
+
+	// A book without an author or notes is just its title
+	if got := Markdown(&models.Book{Title: "Emma"}, nil); got != "# Emma\n" {
+		t.Errorf("Markdown of a book without notes = %q", got)
+	}
+}
@@ -0,0 +1,140 @@
+package reading
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"booklib/internal/models"
+)
+
+// NewProgress checks a progress update and works out its percent where the
+// book's page count, or the ebook's total locations, allow. pageCount is 0
+// when unknown. Error messages don't echo values, so they can be shown as
+// they are.
+func NewProgress(req models.ProgressRequest, pageCount int) (models.ReadingProgress, error) {
+	progress := models.ReadingProgress{Page: req.Page, Location: req.Location, LocationTotal: req.LocationTotal}
+	given := 0
+	for _, set := range []bool{req.Page != nil, req.Percent != nil, req.Location != nil} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return progress, errors.New("give one of page, percent or location")
+	}
+	if req.LocationTotal != nil && req.Location == nil {
+		return progress, errors.New("location_total goes with location")
+	}
+
+	var percent float64
+	switch {
+	case req.Page != nil:
+		if *req.Page < 0 {
+			return progress, errors.New("page can't be negative")
+		}
+		if pageCount > 0 && *req.Page > pageCount {
+			return progress, fmt.Errorf("page is past the book's %d pages", pageCount)
+		}
+		if pageCount == 0 {
+			return progress, nil
+		}
+		percent = float64(*req.Page) / float64(pageCount) * 100
+	case req.Percent != nil:
+		if *req.Percent < 0 || *req.Percent > 100 {
+			return progress, errors.New("percent must be between 0 and 100")
+		}
+		percent = *req.Percent
+	default:
+		if *req.Location < 0 {
+			return progress, errors.New("location can't be negative")
+		}
+		if req.LocationTotal == nil {
+			return progress, nil
+		}
+		if *req.LocationTotal <= 0 || *req.LocationTotal < *req.Location {
+			return progress, errors.New("location_total must be positive and at least location")
+		}
+		percent = float64(*req.Location) / float64(*req.LocationTotal) * 100
+	}
+	percent = round(percent)
+	progress.Percent = &percent
+	return progress, nil
+}
+
+// ReadingTime returns how long the session had been read for at t: the
+// time since it started less the time its book spent paused, going by the
+// book's status changes.
+func ReadingTime(session models.ReadingHistory, changes []models.StatusChange, t time.Time) time.Duration {
+	elapsed := t.Sub(session.StartedAt)
+	var pausedAt *time.Time
+	for _, change := range changes {
+		if change.ChangedAt.Before(session.StartedAt) || change.ChangedAt.After(t) {
+			continue
+		}
+		if change.To == Paused {
+			pausedAt = &change.ChangedAt
+		} else if change.From == Paused && pausedAt != nil {
+			elapsed -= change.ChangedAt.Sub(*pausedAt)
+			pausedAt = nil
+		}
+	}
+	if pausedAt != nil {
+		elapsed -= t.Sub(*pausedAt)
+	}
+	return max(elapsed, 0)
+}
+
+// Pace works out how fast the session is going from its latest progress
+// updates, counting from nothing read when it started and over at least a
+// day, and estimates when it will be finished reading on from now at that
+// pace. changes are the book's status changes, oldest first, and pageCount
+// is 0 when unknown. It returns nil until there is progress to go on.
+func Pace(session models.ReadingHistory, updates []models.ReadingProgress, changes []models.StatusChange, pageCount int, now time.Time) *models.ReadingPace {
+	if len(updates) == 0 {
+		return nil
+	}
+	days := func(p *models.ReadingProgress) float64 {
+		return max(ReadingTime(session, changes, p.RecordedAt).Hours()/24, 1)
+	}
+	pace := &models.ReadingPace{DaysRead: round(days(latest(updates, func(*models.ReadingProgress) bool { return true })))}
+
+	byPercent := latest(updates, func(p *models.ReadingProgress) bool { return p.Percent != nil })
+	if byPercent != nil {
+		perDay := *byPercent.Percent / days(byPercent)
+		pace.Percent = byPercent.Percent
+		pace.PercentPerDay = ptr(round(perDay))
+		if perDay > 0 {
+			remaining := (100 - *byPercent.Percent) / perDay
+			finish := now.Add(time.Duration(remaining * float64(24*time.Hour))).Round(time.Second)
+			pace.EstimatedFinish = &finish
+		}
+	}
+	if byPage := latest(updates, func(p *models.ReadingProgress) bool { return p.Page != nil }); byPage != nil {
+		pace.PagesPerDay = ptr(round(float64(*byPage.Page) / days(byPage)))
+	} else if byPercent != nil && pageCount > 0 {
+		pace.PagesPerDay = ptr(round(*byPercent.Percent / 100 * float64(pageCount) / days(byPercent)))
+	}
+	return pace
+}
+
+// latest returns the most recent of the updates matching keep, or nil.
+func latest(updates []models.ReadingProgress, keep func(*models.ReadingProgress) bool) *models.ReadingProgress {
+	var found *models.ReadingProgress
+	for i := range updates {
+		if p := &updates[i]; keep(p) && (found == nil || !p.RecordedAt.Before(found.RecordedAt)) {
+			found = p
+		}
+	}
+	return found
+}
+
+// round rounds to two decimal places.
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
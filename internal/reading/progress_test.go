@@ -0,0 +1,181 @@
+package reading
+
+import (
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+func TestNewProgress(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       models.ProgressRequest
+		pageCount int
+		percent   *float64
+		wantErr   bool
+	}{
+		{"page", models.ProgressRequest{Page: ptr(50)}, 200, ptr(25.0), false},
+		{"page rounded", models.ProgressRequest{Page: ptr(1)}, 3, ptr(33.33), false},
+		{"page of an unknown page count", models.ProgressRequest{Page: ptr(50)}, 0, nil, false},
+		{"last page", models.ProgressRequest{Page: ptr(200)}, 200, ptr(100.0), false},
+		{"page past the end", models.ProgressRequest{Page: ptr(201)}, 200, nil, true},
+		{"negative page", models.ProgressRequest{Page: ptr(-1)}, 0, nil, true},
+		{"percent", models.ProgressRequest{Percent: ptr(42.5)}, 0, ptr(42.5), false},
+		{"percent ignores the page count", models.ProgressRequest{Percent: ptr(10.0)}, 200, ptr(10.0), false},
+		{"percent over 100", models.ProgressRequest{Percent: ptr(100.5)}, 0, nil, true},
+		{"negative percent", models.ProgressRequest{Percent: ptr(-1.0)}, 0, nil, true},
+		{"location", models.ProgressRequest{Location: ptr(1500), LocationTotal: ptr(6000)}, 0, ptr(25.0), false},
+		{"location ignores the page count", models.ProgressRequest{Location: ptr(1500), LocationTotal: ptr(6000)}, 200, ptr(25.0), false},
+		{"location of an unknown total", models.ProgressRequest{Location: ptr(1500)}, 200, nil, false},
+		{"location past the total", models.ProgressRequest{Location: ptr(7000), LocationTotal: ptr(6000)}, 0, nil, true},
+		{"zero total", models.ProgressRequest{Location: ptr(0), LocationTotal: ptr(0)}, 0, nil, true},
+		{"negative location", models.ProgressRequest{Location: ptr(-5)}, 0, nil, true},
+		{"total without a location", models.ProgressRequest{Page: ptr(5), LocationTotal: ptr(6000)}, 0, nil, true},
+		{"nothing", models.ProgressRequest{}, 200, nil, true},
+		{"page and percent", models.ProgressRequest{Page: ptr(5), Percent: ptr(5.0)}, 200, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewProgress(tt.req, tt.pageCount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (got.Percent == nil) != (tt.percent == nil) || (got.Percent != nil && *got.Percent != *tt.percent) {
+				t.Errorf("percent %v, want %v", deref(got.Percent), deref(tt.percent))
+			}
+			if got.Page != tt.req.Page || got.Location != tt.req.Location {
+				t.Errorf("progress %+v doesn't keep the request's page and location", got)
+			}
+		})
+	}
+}
+
+func deref(f *float64) any {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// day returns midnight UTC of the nth day of March 2024.
+func day(n int) time.Time {
+	return time.Date(2024, time.March, n, 0, 0, 0, 0, time.UTC)
+}
+
+// change is a status change of the book at t.
+func change(from, to string, t time.Time) models.StatusChange {
+	return models.StatusChange{From: from, To: to, ChangedAt: t}
+}
+
+func TestReadingTime(t *testing.T) {
+	session := models.ReadingHistory{StartedAt: day(1)}
+	// A pause from an earlier read doesn't count against this one
+	earlier := []models.StatusChange{
+		change(Reading, Paused, day(1).Add(-48*time.Hour)),
+		change(Paused, Finished, day(1).Add(-24*time.Hour)),
+	}
+	paused := append(earlier,
+		change(WantToRead, Reading, day(1)),
+		change(Reading, Paused, day(3)),
+		change(Paused, Reading, day(6)),
+	)
+
+	tests := []struct {
+		name    string
+		changes []models.StatusChange
+		at      time.Time
+		want    time.Duration
+	}{
+		{"never paused", earlier, day(8), 7 * 24 * time.Hour},
+		{"before the pause", paused, day(2), 24 * time.Hour},
+		{"while paused", paused, day(5), 2 * 24 * time.Hour},
+		{"after the pause", paused, day(8), 4 * 24 * time.Hour},
+		{"before it started", nil, day(1).Add(-time.Hour), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReadingTime(session, tt.changes, tt.at); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPace(t *testing.T) {
+	session := models.ReadingHistory{StartedAt: day(1)}
+	paused := []models.StatusChange{
+		change(WantToRead, Reading, day(1)),
+		change(Reading, Paused, day(3)),
+		change(Paused, Reading, day(6)),
+	}
+
+	if got := Pace(session, nil, paused, 300, day(8)); got != nil {
+		t.Errorf("pace without progress is %+v", got)
+	}
+
+	t.Run("percent across a pause", func(t *testing.T) {
+		// Read for four days of the seven, at ten percent a day
+		updates := []models.ReadingProgress{
+			{Percent: ptr(40.0), RecordedAt: day(8)},
+			{Percent: ptr(20.0), RecordedAt: day(2)},
+		}
+		got := Pace(session, updates, paused, 300, day(8))
+		if got == nil || got.DaysRead != 4 || *got.Percent != 40 || *got.PercentPerDay != 10 || *got.PagesPerDay != 30 {
+			t.Fatalf("got %+v", got)
+		}
+		if want := day(14); got.EstimatedFinish == nil || !got.EstimatedFinish.Equal(want) {
+			t.Errorf("estimated finish %v, want %v", got.EstimatedFinish, want)
+		}
+	})
+
+	t.Run("pages of an unknown page count", func(t *testing.T) {
+		updates := []models.ReadingProgress{{Page: ptr(100), RecordedAt: day(5)}}
+		got := Pace(session, updates, nil, 0, day(5))
+		if got == nil || got.DaysRead != 4 || *got.PagesPerDay != 25 {
+			t.Fatalf("got %+v", got)
+		}
+		if got.Percent != nil || got.PercentPerDay != nil || got.EstimatedFinish != nil {
+			t.Errorf("a page without a page count gave a percent: %+v", got)
+		}
+	})
+
+	t.Run("percent of an unknown page count", func(t *testing.T) {
+		updates := []models.ReadingProgress{{Percent: ptr(50.0), Location: ptr(3000), RecordedAt: day(3)}}
+		got := Pace(session, updates, nil, 0, day(3))
+		if got == nil || *got.PercentPerDay != 25 || got.PagesPerDay != nil {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("pages and percent", func(t *testing.T) {
+		// Pages per day go by the latest page, not the percent
+		updates := []models.ReadingProgress{
+			{Page: ptr(60), Percent: ptr(20.0), RecordedAt: day(3)},
+			{Percent: ptr(50.0), RecordedAt: day(4)},
+		}
+		got := Pace(session, updates, nil, 300, day(4))
+		if got == nil || got.DaysRead != 3 || *got.PagesPerDay != 30 || *got.Percent != 50 {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("less than a day", func(t *testing.T) {
+		updates := []models.ReadingProgress{{Percent: ptr(5.0), RecordedAt: day(1).Add(2 * time.Hour)}}
+		got := Pace(session, updates, nil, 0, day(1).Add(2*time.Hour))
+		if got == nil || got.DaysRead != 1 || *got.PercentPerDay != 5 {
+			t.Errorf("got %+v", got)
+		}
+	})
+
+	t.Run("nothing read yet", func(t *testing.T) {
+		updates := []models.ReadingProgress{{Percent: ptr(0.0), RecordedAt: day(2)}}
+		got := Pace(session, updates, nil, 0, day(2))
+		if got == nil || *got.PercentPerDay != 0 || got.EstimatedFinish != nil {
+			t.Errorf("got %+v", got)
+		}
+	})
+}
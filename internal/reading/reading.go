@@ -0,0 +1,92 @@
+// Package reading defines the reading statuses a book moves through and
+// which moves between them are allowed, works out reading pace from
+// progress updates, and checks the reviews and hand-entered times of
+// sessions.
+package reading
+
+import (
+	"errors"
+	"slices"
+
+	"booklib/internal/models"
+)
+
+// Reading statuses of a book.
+const (
+	WantToRead   = "want_to_read"
+	Reading      = "reading"
+	Paused       = "paused"
+	Finished     = "finished"
+	DidNotFinish = "did_not_finish"
+)
+
+// Statuses lists the reading statuses in the order a book usually moves
+// through them.
+var Statuses = []string{WantToRead, Reading, Paused, Finished, DidNotFinish}
+
+// ErrInvalidTransition is returned for a move the state machine doesn't
+// allow, such as pausing a book that isn't being read.
+var ErrInvalidTransition = errors.New("invalid reading status transition")
+
+// transitions maps each status to those a book can move to from it. Moving
+// to reading starts a session, or resumes the paused one; finished and
+// did_not_finish end the session in progress. A finished or abandoned book
+// can be read again or go back on the to-read pile.
+var transitions = map[string][]string{
+	WantToRead:   {Reading},
+	Reading:      {Paused, Finished, DidNotFinish},
+	Paused:       {Reading, Finished, DidNotFinish},
+	Finished:     {Reading, WantToRead},
+	DidNotFinish: {Reading, WantToRead},
+}
+
+// Valid reports whether status is a reading status.
+func Valid(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+// CanMove reports whether a book can move from one status to another.
+func CanMove(from, to string) bool {
+	return slices.Contains(transitions[from], to)
+}
+
+// Next returns the statuses a book can move to from status.
+func Next(status string) []string {
+	return slices.Clone(transitions[status])
+}
+
+// InProgress reports whether the session has neither been completed nor
+// abandoned. A book has a session in progress exactly while it is reading
+// or paused.
+func InProgress(h models.ReadingHistory) bool {
+	return h.CompletedAt == nil && h.AbandonedAt == nil
+}
+
+// Settle sets the status of a book being added along with its reading
+// sessions, and Read to match, see Read. With a session in progress the
+// book is reading, or paused if it says so; otherwise a status that needs
+// one falls back to finished if the book is marked read and want_to_read if
+// not.
+func Settle(book *models.Book, sessions []models.ReadingHistory) {
+	inProgress := slices.ContainsFunc(sessions, InProgress)
+	switch {
+	case inProgress && book.Status != Paused:
+		book.Status = Reading
+	case !inProgress && (book.Status == "" || book.Status == Reading || book.Status == Paused):
+		book.Status = WantToRead
+		if book.Read {
+			book.Status = Finished
+		}
+	}
+	book.Read = Read(book.Status, sessions)
+}
+
+// Read reports whether a book in status with the sessions counts as read:
+// it is finished or one of its sessions was completed. Status is where the
+// reader is now, so a book being read again stays read.
+func Read(status string, sessions []models.ReadingHistory) bool {
+	return status == Finished || slices.ContainsFunc(sessions, func(h models.ReadingHistory) bool {
+		return h.CompletedAt != nil
+	})
+}
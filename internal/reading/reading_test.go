@@ -0,0 +1,113 @@
+package reading
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		status string
+		want   []string
+	}{
+		{WantToRead, []string{Reading}},
+		{Reading, []string{Paused, Finished, DidNotFinish}},
+		{Paused, []string{Reading, Finished, DidNotFinish}},
+		{Finished, []string{Reading, WantToRead}},
+		{DidNotFinish, []string{Reading, WantToRead}},
+		{"skimmed", nil},
+	}
+	for _, tt := range tests {
+		got := Next(tt.status)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.status, got, tt.want)
+		}
+		for _, to := range Statuses {
+			if want := slices.Contains(tt.want, to); CanMove(tt.status, to) != want {
+				t.Errorf("CanMove(%q, %q) = %v, want %v", tt.status, to, !want, want)
+			}
+		}
+	}
+
+	// Callers may change what Next returns
+	Next(Reading)[0] = WantToRead
+	if CanMove(Reading, WantToRead) {
+		t.Error("changing Next's result changed the transitions")
+	}
+}
+
+func TestValid(t *testing.T) {
+	for _, status := range Statuses {
+		if !Valid(status) {
+			t.Errorf("Valid(%q) = false", status)
+		}
+	}
+	for _, status := range []string{"", "read", "Reading"} {
+		if Valid(status) {
+			t.Errorf("Valid(%q) = true", status)
+		}
+	}
+}
+
+func TestSettle(t *testing.T) {
+	at := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	inProgress := models.ReadingHistory{StartedAt: at}
+	completed := models.ReadingHistory{StartedAt: at, CompletedAt: &at}
+	abandoned := models.ReadingHistory{StartedAt: at, AbandonedAt: &at}
+
+	tests := []struct {
+		name     string
+		status   string
+		read     bool
+		sessions []models.ReadingHistory
+		want     string
+		wantRead bool
+	}{
+		{"new book", "", false, nil, WantToRead, false},
+		{"marked read", "", true, nil, Finished, true},
+		{"reading without a session", Reading, false, nil, WantToRead, false},
+		{"paused without a session", Paused, true, nil, Finished, true},
+		{"session in progress", "", false, []models.ReadingHistory{inProgress}, Reading, false},
+		{"paused session", Paused, false, []models.ReadingHistory{inProgress}, Paused, false},
+		{"finished with a session in progress", Finished, true, []models.ReadingHistory{inProgress}, Reading, false},
+		{"re-read", "", false, []models.ReadingHistory{completed, inProgress}, Reading, true},
+		{"completed session", Finished, false, []models.ReadingHistory{completed}, Finished, true},
+		{"abandoned", DidNotFinish, false, []models.ReadingHistory{abandoned}, DidNotFinish, false},
+		{"abandoned re-read", DidNotFinish, false, []models.ReadingHistory{completed, abandoned}, DidNotFinish, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := models.Book{Status: tt.status, Read: tt.read}
+			Settle(&book, tt.sessions)
+			if book.Status != tt.want || book.Read != tt.wantRead {
+				t.Errorf("settled as %s, read %v; want %s, read %v", book.Status, book.Read, tt.want, tt.wantRead)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	at := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	completed := []models.ReadingHistory{{StartedAt: at, CompletedAt: &at}}
+	abandoned := []models.ReadingHistory{{StartedAt: at, AbandonedAt: &at}}
+
+	tests := []struct {
+		status   string
+		sessions []models.ReadingHistory
+		want     bool
+	}{
+		{Finished, nil, true},
+		{WantToRead, nil, false},
+		{Reading, completed, true},
+		{WantToRead, completed, true},
+		{DidNotFinish, abandoned, false},
+	}
+	for _, tt := range tests {
+		if got := Read(tt.status, tt.sessions); got != tt.want {
+			t.Errorf("Read(%q, %d sessions) = %v, want %v", tt.status, len(tt.sessions), got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package reading
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+)
+
+// MaxReviewLength is the longest review body allowed, in characters.
+const MaxReviewLength = 20000
+
+// NewReview checks a review and returns it with its body trimmed. Ratings
+// go from 0.5 to 5 stars in half stars. Error messages can be shown as they
+// are.
+func NewReview(req models.ReviewRequest) (models.Review, error) {
+	review := models.Review{Rating: req.Rating, Body: strings.TrimSpace(req.Body), Spoiler: req.Spoiler}
+	if review.Rating == nil && review.Body == "" {
+		return review, errors.New("give a rating, a body or both")
+	}
+	if r := review.Rating; r != nil && (*r < 0.5 || *r > 5 || *r*2 != math.Trunc(*r*2)) {
+		return review, errors.New("ratings go from 0.5 to 5 in half stars")
+	}
+	if utf8.RuneCountInString(review.Body) > MaxReviewLength {
+		return review, errors.New("reviews can be at most 20000 characters")
+	}
+	if review.Spoiler && review.Body == "" {
+		return review, errors.New("only a review with a body can be a spoiler")
+	}
+	return review, nil
+}
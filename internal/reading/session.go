@@ -0,0 +1,96 @@
+package reading
+
+import (
+	"errors"
+	"time"
+
+	"booklib/internal/models"
+)
+
+// ErrOverlap is returned for a session whose time overlaps another session
+// of the same book.
+var ErrOverlap = errors.New("reading sessions overlap")
+
+// CheckSession checks the times of a session logged or corrected by hand at
+// now: it needs a start, can't be both completed and abandoned, and can't
+// end before it started or start or end in the future. Error messages don't
+// echo values, so they can be shown as they are.
+func CheckSession(session models.ReadingHistory, now time.Time) error {
+	if session.StartedAt.IsZero() {
+		return errors.New("started_at is required")
+	}
+	if session.CompletedAt != nil && session.AbandonedAt != nil {
+		return errors.New("give at most one of completed_at and abandoned_at")
+	}
+	if session.StartedAt.After(now) {
+		return errors.New("started_at can't be in the future")
+	}
+	if end := ended(session); end != nil {
+		if end.Before(session.StartedAt) {
+			return errors.New("a session can't end before it started")
+		}
+		if end.After(now) {
+			return errors.New("a session can't end in the future")
+		}
+	}
+	return nil
+}
+
+// ended returns when the session was completed or abandoned, or nil while
+// it is in progress.
+func ended(session models.ReadingHistory) *time.Time {
+	if session.CompletedAt != nil {
+		return session.CompletedAt
+	}
+	return session.AbandonedAt
+}
+
+// Overlaps reports whether the session's time overlaps that of any of
+// others, the other sessions of its book; others may include the session
+// itself, which is skipped. A session in progress runs on from its start,
+// so no other can start after it, and sessions may meet end to start.
+func Overlaps(session models.ReadingHistory, others []models.ReadingHistory) bool {
+	for _, other := range others {
+		if other.ID == session.ID && session.ID != 0 {
+			continue
+		}
+		if startsBeforeEnd(session, other) && startsBeforeEnd(other, session) {
+			return true
+		}
+	}
+	return false
+}
+
+// startsBeforeEnd reports whether a starts before b ends.
+func startsBeforeEnd(a, b models.ReadingHistory) bool {
+	end := ended(b)
+	return end == nil || a.StartedAt.Before(*end)
+}
+
+// Derive returns the status of a book in status once its sessions have been
+// logged, corrected or deleted by hand, and when the sessions reached it.
+// With a session in progress it is reading since the session started, or
+// still paused if it was; otherwise it is finished or did_not_finish since
+// its latest session ended, as it ended, and want_to_read without any, with
+// a nil time. Whether the book counts as read is up to Read.
+func Derive(status string, sessions []models.ReadingHistory) (string, *time.Time) {
+	var latest *models.ReadingHistory
+	for i := range sessions {
+		if InProgress(sessions[i]) {
+			if status == Paused {
+				return Paused, &sessions[i].StartedAt
+			}
+			return Reading, &sessions[i].StartedAt
+		}
+		if latest == nil || sessions[i].StartedAt.After(latest.StartedAt) {
+			latest = &sessions[i]
+		}
+	}
+	switch {
+	case latest == nil:
+		return WantToRead, nil
+	case latest.CompletedAt != nil:
+		return Finished, latest.CompletedAt
+	}
+	return DidNotFinish, latest.AbandonedAt
+}
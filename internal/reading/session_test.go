@@ -0,0 +1,100 @@
+package reading
+
+import (
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+func TestCheckSession(t *testing.T) {
+	now := day(10)
+	tests := []struct {
+		name    string
+		session models.ReadingHistory
+		wantErr bool
+	}{
+		{"in progress", models.ReadingHistory{StartedAt: day(1)}, false},
+		{"completed", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(5))}, false},
+		{"abandoned", models.ReadingHistory{StartedAt: day(1), AbandonedAt: ptr(day(5))}, false},
+		{"read in a day", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(1))}, false},
+		{"ending now", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(now)}, false},
+		{"without a start", models.ReadingHistory{CompletedAt: ptr(day(5))}, true},
+		{"completed and abandoned", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(5)), AbandonedAt: ptr(day(5))}, true},
+		{"ending before it started", models.ReadingHistory{StartedAt: day(5), CompletedAt: ptr(day(1))}, true},
+		{"starting in the future", models.ReadingHistory{StartedAt: day(11)}, true},
+		{"ending in the future", models.ReadingHistory{StartedAt: day(1), AbandonedAt: ptr(day(11))}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckSession(tt.session, now); (err != nil) != tt.wantErr {
+				t.Errorf("got %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverlaps(t *testing.T) {
+	// One session read from the 5th to the 10th, and one in progress since
+	// the 20th
+	others := []models.ReadingHistory{
+		{ID: 1, StartedAt: day(5), CompletedAt: ptr(day(10))},
+		{ID: 2, StartedAt: day(20)},
+	}
+	tests := []struct {
+		name    string
+		session models.ReadingHistory
+		want    bool
+	}{
+		{"before", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(3))}, false},
+		{"ending as the other starts", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(5))}, false},
+		{"starting as the other ends", models.ReadingHistory{StartedAt: day(10), AbandonedAt: ptr(day(12))}, false},
+		{"in between", models.ReadingHistory{StartedAt: day(12), CompletedAt: ptr(day(15))}, false},
+		{"across the start", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(6))}, true},
+		{"inside", models.ReadingHistory{StartedAt: day(6), CompletedAt: ptr(day(7))}, true},
+		{"around", models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(15))}, true},
+		{"in progress before", models.ReadingHistory{StartedAt: day(12)}, true},
+		{"after the one in progress", models.ReadingHistory{StartedAt: day(25), CompletedAt: ptr(day(26))}, true},
+		{"itself", models.ReadingHistory{ID: 1, StartedAt: day(5), CompletedAt: ptr(day(9))}, false},
+		{"a new session at the same time", models.ReadingHistory{StartedAt: day(5), CompletedAt: ptr(day(10))}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Overlaps(tt.session, others); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerive(t *testing.T) {
+	completed := models.ReadingHistory{StartedAt: day(1), CompletedAt: ptr(day(5))}
+	abandoned := models.ReadingHistory{StartedAt: day(10), AbandonedAt: ptr(day(12))}
+	inProgress := models.ReadingHistory{StartedAt: day(20)}
+
+	tests := []struct {
+		name     string
+		status   string
+		sessions []models.ReadingHistory
+		want     string
+		wantAt   *time.Time
+	}{
+		{"no sessions", Finished, nil, WantToRead, nil},
+		{"completed", WantToRead, []models.ReadingHistory{completed}, Finished, completed.CompletedAt},
+		{"latest abandoned", Finished, []models.ReadingHistory{abandoned, completed}, DidNotFinish, abandoned.AbandonedAt},
+		{"in progress", Finished, []models.ReadingHistory{completed, inProgress}, Reading, &inProgress.StartedAt},
+		{"still paused", Paused, []models.ReadingHistory{inProgress}, Paused, &inProgress.StartedAt},
+		{"paused without a session in progress", Paused, []models.ReadingHistory{completed}, Finished, completed.CompletedAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, at := Derive(tt.status, tt.sessions)
+			if got != tt.want {
+				t.Errorf("status %s, want %s", got, tt.want)
+			}
+			if (at == nil) != (tt.wantAt == nil) || (at != nil && !at.Equal(*tt.wantAt)) {
+				t.Errorf("at %v, want %v", at, tt.wantAt)
+			}
+		})
+	}
+}
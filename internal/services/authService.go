@@ -2,7 +2,6 @@ package services
 
 import (
 	"errors"
-	"log"
 	"os"
 	"time"
 
@@ -12,17 +11,20 @@ import (
 
 var jwtSecret []byte
 
-func init() {
-	// Load JWT secret from environment variable
+// LoadJWTSecret reads the secret tokens are signed with from JWT_SECRET, or
+// SESSION_SECRET if that isn't set. The server calls it at startup, after
+// loading .env.
+func LoadJWTSecret() error {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
 		// Fall back to SESSION_SECRET if JWT_SECRET not set
 		secret = os.Getenv("SESSION_SECRET")
 	}
 	if secret == "" {
-		log.Fatal("JWT_SECRET or SESSION_SECRET environment variable must be set")
+		return errors.New("JWT_SECRET or SESSION_SECRET environment variable must be set")
 	}
 	jwtSecret = []byte(secret)
+	return nil
 }
 
 type Claims struct {
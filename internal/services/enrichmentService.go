@@ -0,0 +1,426 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"booklib/internal/fuzzy"
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+const (
+	// defaultEnrichmentRate is used when ENRICHMENT_REQUESTS_PER_MINUTE is
+	// unset.
+	defaultEnrichmentRate = 30
+	// minMatchScore is the lowest title and author similarity accepted for
+	// a book without an ISBN.
+	minMatchScore = 0.85
+)
+
+var (
+	// ErrEnrichmentRunning is returned when a user starts a run while one
+	// is still going.
+	ErrEnrichmentRunning = errors.New("enrichment already running")
+	// ErrUnknownField is returned when accepting a field that can't be
+	// proposed.
+	ErrUnknownField = errors.New("unknown proposal field")
+)
+
+// ProposalFields lists, by JSON name, the book fields a proposal can fill.
+var ProposalFields = []string{
+	"isbn", "genre", "cover_url", "description", "page_count",
+	"publisher", "published_date", "language",
+}
+
+// EnrichmentService looks up metadata for books that are missing some and
+// proposes it to their owners. Runs happen in the background, one per user
+// at a time, and all runs share one rate limit on provider lookups.
+type EnrichmentService struct {
+	Books     store.BookStore
+	Proposals store.EnrichmentStore
+	Metadata  *MetadataService
+
+	limiter *rateLimiter
+
+	mu   sync.Mutex
+	jobs map[int]*enrichmentJob
+}
+
+type enrichmentJob struct {
+	status models.EnrichmentJob
+	cancel context.CancelFunc
+}
+
+// NewEnrichmentService reads the provider rate limit from
+// ENRICHMENT_REQUESTS_PER_MINUTE.
+func NewEnrichmentService(books store.BookStore, proposals store.EnrichmentStore, metadata *MetadataService) *EnrichmentService {
+	rate := defaultEnrichmentRate
+	if value := os.Getenv("ENRICHMENT_REQUESTS_PER_MINUTE"); value != "" {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			rate = n
+		} else {
+			log.Printf("Invalid ENRICHMENT_REQUESTS_PER_MINUTE %q, using %d", value, rate)
+		}
+	}
+	return &EnrichmentService{
+		Books:     books,
+		Proposals: proposals,
+		Metadata:  metadata,
+		limiter:   &rateLimiter{interval: time.Minute / time.Duration(rate)},
+		jobs:      make(map[int]*enrichmentJob),
+	}
+}
+
+// Start begins a run over the user's books in the background and returns
+// its initial status.
+func (s *EnrichmentService) Start(userID int) (models.EnrichmentJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if job, ok := s.jobs[userID]; ok && job.status.Running {
+		return job.status, ErrEnrichmentRunning
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	now := time.Now()
+	job := &enrichmentJob{
+		status: models.EnrichmentJob{Running: true, StartedAt: &now},
+		cancel: cancel,
+	}
+	s.jobs[userID] = job
+	go s.run(ctx, userID, job)
+	return job.status, nil
+}
+
+// Status returns the user's current or last run. It returns false if the
+// user hasn't started one since the server started.
+func (s *EnrichmentService) Status(userID int) (models.EnrichmentJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[userID]
+	if !ok {
+		return models.EnrichmentJob{}, false
+	}
+	return job.status, true
+}
+
+// Cancel stops the user's running run, keeping the proposals it made. It
+// returns false if none is running.
+func (s *EnrichmentService) Cancel(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[userID]
+	if !ok || !job.status.Running {
+		return false
+	}
+	job.cancel()
+	return true
+}
+
+// update applies fn to the job's status under the lock.
+func (s *EnrichmentService) update(job *enrichmentJob, fn func(*models.EnrichmentJob)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&job.status)
+}
+
+func (s *EnrichmentService) run(ctx context.Context, userID int, job *enrichmentJob) {
+	defer job.cancel()
+
+	books, err := s.pendingBooks(ctx, userID)
+	if err == nil {
+		s.update(job, func(j *models.EnrichmentJob) { j.Total = len(books) })
+		for i := range books {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+			proposed, lookupErr := s.enrich(ctx, userID, &books[i])
+			if lookupErr != nil && ctx.Err() == nil {
+				log.Printf("Failed to enrich book %d: %v", books[i].ID, lookupErr)
+			}
+			s.update(job, func(j *models.EnrichmentJob) {
+				j.Processed++
+				if proposed {
+					j.Proposed++
+				}
+				if lookupErr != nil {
+					j.Failed++
+				}
+			})
+		}
+	}
+
+	s.update(job, func(j *models.EnrichmentJob) {
+		now := time.Now()
+		j.Running = false
+		j.FinishedAt = &now
+		if errors.Is(err, context.Canceled) {
+			j.Error = "cancelled"
+		} else if err != nil {
+			j.Error = "failed to load books"
+			log.Printf("Enrichment run for user %d failed: %v", userID, err)
+		}
+	})
+}
+
+// pendingBooks returns the user's books that are missing metadata and have
+// no proposal yet.
+func (s *EnrichmentService) pendingBooks(ctx context.Context, userID int) ([]models.Book, error) {
+	books, err := s.Books.List(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	proposals, err := s.Proposals.List(ctx, userID, "")
+	if err != nil {
+		return nil, err
+	}
+	proposed := make(map[int]bool, len(proposals))
+	for _, p := range proposals {
+		proposed[p.BookID] = true
+	}
+
+	pending := books[:0]
+	for _, book := range books {
+		if !proposed[book.ID] && needsEnrichment(&book) {
+			pending = append(pending, book)
+		}
+	}
+	return pending, nil
+}
+
+func needsEnrichment(book *models.Book) bool {
+	return book.ISBN == "" || book.Genre == "" || book.CoverURL == "" || book.Description == "" ||
+		book.PageCount == 0 || book.Publisher == "" || book.PublishedDate == "" || book.Language == ""
+}
+
+// enrich looks the book up and stores a proposal if the metadata fills any
+// of its empty fields. Books with an ISBN are looked up by it; the others,
+// and those whose ISBN no provider knows, by title and author.
+func (s *EnrichmentService) enrich(ctx context.Context, userID int, book *models.Book) (bool, error) {
+	var meta *models.IsbnCache
+	matchedBy, score := models.MatchedByISBN, 1.0
+	if book.ISBN != "" {
+		var err error
+		if meta, err = s.lookupISBN(ctx, book.ISBN); err != nil {
+			return false, err
+		}
+	}
+	if meta == nil {
+		var err error
+		if meta, score, err = s.searchTitle(ctx, book); err != nil || meta == nil {
+			return false, err
+		}
+		matchedBy = models.MatchedByTitleAuthor
+	}
+
+	proposal := propose(book, meta)
+	if proposal == nil {
+		return false, nil
+	}
+	if proposal.ISBN != "" {
+		// Another of the user's books having the ISBN suggests a duplicate,
+		// but the other fields are still worth proposing
+		if _, err := s.Books.FindByISBN(ctx, userID, proposal.ISBN); err == nil {
+			proposal.ISBN = ""
+			if isEmpty(proposal) {
+				return false, nil
+			}
+		}
+	}
+	proposal.MatchedBy = matchedBy
+	proposal.Score = score
+
+	err := s.Proposals.Create(ctx, userID, proposal)
+	if errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound) {
+		// The book got a proposal from elsewhere or was deleted meanwhile
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// lookupISBN answers from the cache when it can, only waiting for the rate
+// limiter when the providers have to be asked.
+func (s *EnrichmentService) lookupISBN(ctx context.Context, isbnCode string) (*models.IsbnCache, error) {
+	cached, err := s.Metadata.Lookup(ctx, isbnCode, false)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && !s.Metadata.Expired(cached, time.Now()) {
+		return cached, nil
+	}
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return s.Metadata.Lookup(ctx, isbnCode, true)
+}
+
+// searchTitle searches the providers for the book's title and author and
+// returns the closest result, if it is close enough.
+func (s *EnrichmentService) searchTitle(ctx context.Context, book *models.Book) (*models.IsbnCache, float64, error) {
+	if err := s.limiter.Wait(ctx); err != nil {
+		return nil, 0, err
+	}
+	results, err := s.Metadata.Search(ctx, strings.TrimSpace(book.Title+" "+book.Author))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var best *models.IsbnCache
+	bestScore := 0.0
+	for _, result := range results {
+		if score := matchScore(book, result); score > bestScore {
+			best, bestScore = result, score
+		}
+	}
+	if bestScore < minMatchScore {
+		return nil, 0, nil
+	}
+	return best, bestScore, nil
+}
+
+// propose returns the metadata's values for the book's empty fields, or nil
+// if it has none.
+func propose(book *models.Book, meta *models.IsbnCache) *models.EnrichmentProposal {
+	p := &models.EnrichmentProposal{BookID: book.ID}
+	fill := func(dst *string, current, value string) {
+		if current == "" {
+			*dst = value
+		}
+	}
+	fill(&p.ISBN, book.ISBN, meta.ISBN)
+	fill(&p.Genre, book.Genre, meta.Genre)
+	fill(&p.CoverURL, book.CoverURL, meta.CoverUrl)
+	fill(&p.Description, book.Description, meta.Description)
+	fill(&p.Publisher, book.Publisher, meta.Publisher)
+	fill(&p.PublishedDate, book.PublishedDate, meta.PublishedDate)
+	fill(&p.Language, book.Language, meta.Language)
+	if book.PageCount == 0 {
+		p.PageCount = meta.PageCount
+	}
+	if isEmpty(p) {
+		return nil
+	}
+	return p
+}
+
+func isEmpty(p *models.EnrichmentProposal) bool {
+	return p.ISBN == "" && p.Genre == "" && p.CoverURL == "" && p.Description == "" &&
+		p.PageCount == 0 && p.Publisher == "" && p.PublishedDate == "" && p.Language == ""
+}
+
+// Accept applies a proposal to its book and deletes it. With fields set
+// only those are applied. Fields the book has filled in since the proposal
+// was made keep their values, as does an ISBN another of the user's books
+// has.
+func (s *EnrichmentService) Accept(ctx context.Context, userID, proposalID int, fields []string) (*models.Book, error) {
+	for _, field := range fields {
+		if !slices.Contains(ProposalFields, field) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownField, field)
+		}
+	}
+
+	p, err := s.Proposals.Get(ctx, userID, proposalID)
+	if err != nil {
+		return nil, err
+	}
+	book := p.Book
+	want := func(field string) bool {
+		return len(fields) == 0 || slices.Contains(fields, field)
+	}
+	fill := func(field string, dst *string, value string) {
+		if want(field) && *dst == "" {
+			*dst = value
+		}
+	}
+	if want("isbn") && book.ISBN == "" && p.ISBN != "" {
+		if _, err := s.Books.FindByISBN(ctx, userID, p.ISBN); errors.Is(err, store.ErrNotFound) {
+			book.ISBN = p.ISBN
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	fill("genre", &book.Genre, p.Genre)
+	fill("cover_url", &book.CoverURL, p.CoverURL)
+	fill("description", &book.Description, p.Description)
+	fill("publisher", &book.Publisher, p.Publisher)
+	fill("published_date", &book.PublishedDate, p.PublishedDate)
+	fill("language", &book.Language, p.Language)
+	if want("page_count") && book.PageCount == 0 {
+		book.PageCount = p.PageCount
+	}
+
+	if err := s.Books.Update(ctx, userID, book); err != nil {
+		return nil, err
+	}
+	if err := s.Proposals.Delete(ctx, userID, proposalID); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	return book, nil
+}
+
+// Reject marks a proposal as rejected, so later runs don't propose
+// metadata for its book again.
+func (s *EnrichmentService) Reject(ctx context.Context, userID, proposalID int) error {
+	return s.Proposals.SetStatus(ctx, userID, proposalID, models.ProposalRejected)
+}
+
+// matchScore rates how well a search result matches the book, from 0 to 1.
+// Titles are compared with and without subtitles and weigh more than
+// authors; a book without an author is matched on its title alone.
+func matchScore(book *models.Book, result *models.IsbnCache) float64 {
+	title := max(
+		fuzzy.Similarity(fuzzy.Normalize(book.Title), fuzzy.Normalize(result.Title)),
+		fuzzy.Similarity(fuzzy.Normalize(mainTitle(book.Title)), fuzzy.Normalize(mainTitle(result.Title))),
+	)
+	if book.Author == "" {
+		return title
+	}
+
+	author := fuzzy.AuthorSimilarity(book.Author, result.Author)
+	return 0.7*title + 0.3*author
+}
+
+// mainTitle drops a subtitle after a colon or dash.
+func mainTitle(title string) string {
+	if i := strings.IndexAny(title, ":–—"); i > 0 {
+		return title[:i]
+	}
+	return title
+}
+
+// rateLimiter spaces calls out by at least interval.
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// Wait blocks until the caller's turn, or until ctx is done.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	at := time.Now()
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+// stubProvider answers ISBN lookups from isbns, or fails them with err if
+// set, and every search with results. lookups counts the ISBN lookups.
+type stubProvider struct {
+	isbns   map[string]*models.IsbnCache
+	results []*models.IsbnCache
+	err     error
+	lookups int
+}
+
+func (p *stubProvider) Name() string { return "stub" }
+
+func (p *stubProvider) LookupISBN(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	p.lookups++
+	if p.err != nil {
+		return nil, p.err
+	}
+	if meta, ok := p.isbns[isbn]; ok {
+		copied := *meta
+		return &copied, nil
+	}
+	return nil, nil
+}
+
+func (p *stubProvider) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	return p.results, nil
+}
+
+// newTestEnrichment returns a service over memory stores that asks provider
+// and doesn't wait between lookups.
+func newTestEnrichment(provider *stubProvider) *EnrichmentService {
+	stores := store.NewMemory()
+	s := NewEnrichmentService(stores.Books, stores.Enrichment, NewMetadataService(stores.Cache, provider))
+	s.limiter.interval = 0
+	return s
+}
+
+func TestPropose(t *testing.T) {
+	meta := &models.IsbnCache{
+		ISBN: "9780441013593", Genre: "Science Fiction", CoverUrl: "https://covers.example.com/dune.jpg",
+		Description: "Arrakis", PageCount: 412, Publisher: "Ace", PublishedDate: "1990", Language: "en",
+	}
+
+	book := &models.Book{ID: 7, Title: "Dune", ISBN: "9780441013593", Genre: "Classics", PageCount: 600}
+	p := propose(book, meta)
+	want := models.EnrichmentProposal{
+		BookID: 7, CoverURL: meta.CoverUrl, Description: "Arrakis", Publisher: "Ace", PublishedDate: "1990", Language: "en",
+	}
+	if p == nil || *p != want {
+		t.Errorf("propose = %+v, want %+v", p, want)
+	}
+
+	complete := &models.Book{
+		Title: "Dune", ISBN: "9780441013593", Genre: "Classics", CoverURL: "https://covers.example.com/mine.jpg",
+		Description: "Mine", PageCount: 600, Publisher: "Chilton", PublishedDate: "1965", Language: "en",
+	}
+	if p := propose(complete, meta); p != nil {
+		t.Errorf("proposed %+v for a complete book", p)
+	}
+	if p := propose(&models.Book{Title: "Dune"}, &models.IsbnCache{Title: "Dune"}); p != nil {
+		t.Errorf("proposed %+v from metadata with nothing to add", p)
+	}
+}
+
+func TestEnrichByISBN(t *testing.T) {
+	ctx := context.Background()
+	s := newTestEnrichment(&stubProvider{isbns: map[string]*models.IsbnCache{
+		"9780441013593": {Title: "Dune", Genre: "Science Fiction", PageCount: 412},
+	}})
+	book := &models.Book{Title: "Dune", ISBN: "9780441013593"}
+	if err := s.Books.Create(ctx, 1, book); err != nil {
+		t.Fatal(err)
+	}
+
+	proposed, err := s.enrich(ctx, 1, book)
+	if err != nil || !proposed {
+		t.Fatalf("enrich = %v, %v", proposed, err)
+	}
+	proposals, _ := s.Proposals.List(ctx, 1, models.ProposalPending)
+	if len(proposals) != 1 {
+		t.Fatalf("got %d proposals, want 1", len(proposals))
+	}
+	p := proposals[0]
+	if p.BookID != book.ID || p.MatchedBy != models.MatchedByISBN || p.Score != 1 || p.Genre != "Science Fiction" || p.PageCount != 412 {
+		t.Errorf("proposal is %+v", p)
+	}
+
+	// A book with a proposal isn't looked up again
+	pending, err := s.pendingBooks(ctx, 1)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("pending books are %+v, %v", pending, err)
+	}
+}
+
+func TestEnrichDropsOwnedISBN(t *testing.T) {
+	ctx := context.Background()
+	s := newTestEnrichment(&stubProvider{results: []*models.IsbnCache{
+		{ISBN: "9780441013593", Title: "Dune", Author: "Frank Herbert", Genre: "Science Fiction"},
+	}})
+	owned := &models.Book{Title: "Dune (hardcover)", ISBN: "9780441013593"}
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert"}
+	for _, b := range []*models.Book{owned, book} {
+		if err := s.Books.Create(ctx, 1, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The ISBN would make the two books duplicates, but the genre is kept
+	if proposed, err := s.enrich(ctx, 1, book); err != nil || !proposed {
+		t.Fatalf("enrich = %v, %v", proposed, err)
+	}
+	proposals, _ := s.Proposals.List(ctx, 1, models.ProposalPending)
+	if len(proposals) != 1 {
+		t.Fatalf("got %d proposals, want 1", len(proposals))
+	}
+	if p := proposals[0]; p.ISBN != "" || p.Genre != "Science Fiction" || p.MatchedBy != models.MatchedByTitleAuthor {
+		t.Errorf("proposal is %+v", p)
+	}
+}
+
+func TestEnrichRejectsDistantMatch(t *testing.T) {
+	ctx := context.Background()
+	s := newTestEnrichment(&stubProvider{results: []*models.IsbnCache{
+		{ISBN: "9780441013593", Title: "Dune Messiah", Author: "Frank Herbert", Genre: "Science Fiction"},
+	}})
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert"}
+	if err := s.Books.Create(ctx, 1, book); err != nil {
+		t.Fatal(err)
+	}
+	if proposed, err := s.enrich(ctx, 1, book); err != nil || proposed {
+		t.Errorf("enrich = %v, %v; want no proposal", proposed, err)
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		name          string
+		title, author string
+		result        models.IsbnCache
+		match         bool
+	}{
+		{"same", "Dune", "Frank Herbert", models.IsbnCache{Title: "Dune", Author: "Frank Herbert"}, true},
+		{"surname first", "Dune", "Herbert, Frank", models.IsbnCache{Title: "Dune", Author: "Frank Herbert"}, true},
+		{"one of several authors", "Good Omens", "Neil Gaiman", models.IsbnCache{Title: "Good Omens", Author: "Terry Pratchett, Neil Gaiman"}, true},
+		{"subtitle", "The Name of the Wind", "Patrick Rothfuss", models.IsbnCache{Title: "The Name of the Wind: The Kingkiller Chronicle", Author: "Patrick Rothfuss"}, true},
+		{"article and punctuation", "Left Hand of Darkness", "Ursula K. Le Guin", models.IsbnCache{Title: "The Left Hand of Darkness!", Author: "Ursula K. Le Guin"}, true},
+		{"no author", "Emma", "", models.IsbnCache{Title: "Emma", Author: "Jane Austen"}, true},
+		{"sequel", "Dune", "Frank Herbert", models.IsbnCache{Title: "Dune Messiah", Author: "Frank Herbert"}, false},
+		{"other author", "Dune", "Frank Herbert", models.IsbnCache{Title: "Dune", Author: "Kevin J. Anderson"}, false},
+		{"other book", "Emma", "Jane Austen", models.IsbnCache{Title: "Persuasion", Author: "Jane Austen"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score := matchScore(&models.Book{Title: tt.title, Author: tt.author}, &tt.result)
+			if (score >= minMatchScore) != tt.match {
+				t.Errorf("score %.2f, want a match: %v", score, tt.match)
+			}
+		})
+	}
+}
+
+func TestAccept(t *testing.T) {
+	ctx := context.Background()
+	s := newTestEnrichment(&stubProvider{})
+	book := &models.Book{Title: "Dune", Author: "Frank Herbert"}
+	if err := s.Books.Create(ctx, 1, book); err != nil {
+		t.Fatal(err)
+	}
+	proposal := &models.EnrichmentProposal{
+		BookID: book.ID, MatchedBy: models.MatchedByISBN, Score: 1,
+		ISBN: "9780441013593", Genre: "Science Fiction", Description: "Arrakis", PageCount: 412,
+	}
+	if err := s.Proposals.Create(ctx, 1, proposal); err != nil {
+		t.Fatal(err)
+	}
+
+	// The user fills the genre in themselves after the proposal was made
+	book.Genre = "Classics"
+	if err := s.Books.Update(ctx, 1, book); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Accept(ctx, 1, proposal.ID, []string{"genre", "shelf"}); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("accepting an unknown field: %v, want ErrUnknownField", err)
+	}
+	if _, err := s.Accept(ctx, 2, proposal.ID, nil); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("accepting another user's proposal: %v, want ErrNotFound", err)
+	}
+
+	got, err := s.Accept(ctx, 1, proposal.ID, []string{"genre", "page_count"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Genre != "Classics" || got.PageCount != 412 || got.Description != "" || got.ISBN != "" {
+		t.Errorf("accepted book is %+v", got)
+	}
+	stored, err := s.Books.Get(ctx, 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Genre != "Classics" || stored.PageCount != 412 || stored.Description != "" {
+		t.Errorf("stored book is %+v", stored)
+	}
+	if _, err := s.Proposals.Get(ctx, 1, proposal.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("proposal after accepting: %v, want ErrNotFound", err)
+	}
+}
+
+func TestAcceptKeepsOwnedISBN(t *testing.T) {
+	ctx := context.Background()
+	s := newTestEnrichment(&stubProvider{})
+	book := &models.Book{Title: "Dune"}
+	owned := &models.Book{Title: "Dune (hardcover)"}
+	for _, b := range []*models.Book{book, owned} {
+		if err := s.Books.Create(ctx, 1, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proposal := &models.EnrichmentProposal{BookID: book.ID, ISBN: "9780441013593", Language: "en"}
+	if err := s.Proposals.Create(ctx, 1, proposal); err != nil {
+		t.Fatal(err)
+	}
+	// Another book got the ISBN after the proposal was made
+	owned.ISBN = "9780441013593"
+	if err := s.Books.Update(ctx, 1, owned); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Accept(ctx, 1, proposal.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ISBN != "" || got.Language != "en" {
+		t.Errorf("accepted book is %+v", got)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	l := &rateLimiter{interval: interval}
+	ctx := context.Background()
+
+	start := time.Now()
+	for range 3 {
+		if err := l.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The first call goes straight through
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("three calls took %v, want at least %v", elapsed, 2*interval)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	l.interval = time.Hour
+	l.Wait(ctx)
+	if err := l.Wait(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("waiting with a cancelled context: %v, want context.Canceled", err)
+	}
+}
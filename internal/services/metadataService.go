@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"booklib/internal/api"
+	"booklib/internal/isbn"
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+const (
+	// defaultISBNCacheTTL is used when ISBN_CACHE_TTL is unset.
+	defaultISBNCacheTTL = 30 * 24 * time.Hour
+	// refreshBatchSize caps how many entries one RefreshExpired run looks
+	// up, so a large backlog is worked off over several runs instead of
+	// flooding the providers.
+	refreshBatchSize = 200
+)
+
+// MetadataService looks up book metadata through the ISBN cache. Cache
+// entries older than TTL are expired: lookups ask the providers again and
+// RefreshExpired renews them in the background. Pinned entries, which an
+// admin has edited, never expire.
+type MetadataService struct {
+	Cache    store.ISBNCacheStore
+	Metadata api.MetadataProvider
+	TTL      time.Duration
+
+	refreshing atomic.Bool
+}
+
+// ErrRefreshRunning is returned when a refresh is started while another is
+// still running.
+var ErrRefreshRunning = errors.New("ISBN cache refresh already running")
+
+// NewMetadataService reads the cache TTL from ISBN_CACHE_TTL, given as a Go
+// duration ("720h") or a number of days ("30d").
+func NewMetadataService(cache store.ISBNCacheStore, metadata api.MetadataProvider) *MetadataService {
+	ttl := defaultISBNCacheTTL
+	if value := os.Getenv("ISBN_CACHE_TTL"); value != "" {
+		parsed, err := parseTTL(value)
+		if err != nil {
+			log.Printf("Invalid ISBN_CACHE_TTL %q, using %s: %v", value, ttl, err)
+		} else {
+			ttl = parsed
+		}
+	}
+	return &MetadataService{Cache: cache, Metadata: metadata, TTL: ttl}
+}
+
+func parseTTL(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid number of days")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err == nil && ttl <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return ttl, err
+}
+
+// Expired reports whether the entry is due for a refresh at now.
+func (s *MetadataService) Expired(entry *models.IsbnCache, now time.Time) bool {
+	return !entry.Pinned && entry.CachedAt != nil && now.Sub(*entry.CachedAt) > s.TTL
+}
+
+// Lookup returns the metadata for an ISBN. Missing or expired entries are
+// looked up with the providers and cached when fetch is set. If that fails
+// an expired entry is still returned, since old metadata beats none. It
+// returns (nil, nil) when no one knows the book.
+func (s *MetadataService) Lookup(ctx context.Context, isbnCode string, fetch bool) (*models.IsbnCache, error) {
+	cached, err := s.Cache.Get(ctx, isbnCode)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	if cached != nil && (!fetch || !s.Expired(cached, time.Now())) {
+		return cached, nil
+	}
+	if !fetch {
+		return nil, nil
+	}
+
+	meta, err := s.fetch(ctx, isbnCode)
+	if err != nil || meta == nil {
+		if cached != nil {
+			return cached, nil
+		}
+		return nil, err
+	}
+	return meta, nil
+}
+
+// Refresh looks the ISBN up with the providers and replaces its cache
+// entry, pinned or not. It returns (nil, nil), keeping the entry, if the
+// providers no longer know the book.
+func (s *MetadataService) Refresh(ctx context.Context, isbnCode string) (*models.IsbnCache, error) {
+	return s.fetch(ctx, isbnCode)
+}
+
+// fetch asks the providers for an ISBN and saves the answer in the cache.
+func (s *MetadataService) fetch(ctx context.Context, isbnCode string) (*models.IsbnCache, error) {
+	meta, err := s.Metadata.LookupISBN(ctx, isbnCode)
+	if err != nil || meta == nil {
+		return nil, err
+	}
+	now := time.Now()
+	meta.ISBN = isbnCode
+	meta.CachedAt = &now
+	meta.Pinned = false
+	if err := s.Cache.Save(ctx, meta); err != nil {
+		log.Printf("Failed to cache metadata for ISBN %s: %v", isbnCode, err)
+	}
+	return meta, nil
+}
+
+// Search runs a free-text search. A query that is a cached ISBN is
+// answered from the cache; otherwise the providers are searched and new
+// results are cached.
+func (s *MetadataService) Search(ctx context.Context, query string) ([]*models.IsbnCache, error) {
+	if normalized, err := isbn.Normalize(query); err == nil {
+		query = normalized
+		if cached, err := s.Cache.Get(ctx, normalized); err == nil {
+			return []*models.IsbnCache{cached}, nil
+		}
+	}
+
+	results, err := s.Metadata.Search(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		if result.ISBN != "" {
+			_ = s.Cache.Put(ctx, result)
+		}
+	}
+	return results, nil
+}
+
+// RefreshExpired renews the oldest expired cache entries, up to
+// refreshBatchSize of them, and returns how many were refreshed and how
+// many could not be. Entries that fail, because a provider errs or no
+// longer knows the book, keep their metadata but are marked as checked, so
+// they aren't retried until they expire again and don't hold up the rest of
+// the cache in later runs.
+func (s *MetadataService) RefreshExpired(ctx context.Context) (refreshed, failed int, err error) {
+	if !s.refreshing.CompareAndSwap(false, true) {
+		return 0, 0, ErrRefreshRunning
+	}
+	defer s.refreshing.Store(false)
+	return s.refreshExpired(ctx)
+}
+
+func (s *MetadataService) refreshExpired(ctx context.Context) (refreshed, failed int, err error) {
+	entries, _, err := s.Cache.List(ctx, store.ISBNCacheQuery{
+		ExpiredBefore: time.Now().Add(-s.TTL),
+		Limit:         refreshBatchSize,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return refreshed, failed, ctx.Err()
+		}
+		meta, err := s.fetch(ctx, entry.ISBN)
+		if err != nil && ctx.Err() != nil {
+			return refreshed, failed, ctx.Err()
+		}
+		if err != nil || meta == nil {
+			failed++
+			// Stamping the attempt sends the entry to the back of the queue,
+			// so entries that keep failing don't take up every batch
+			now := time.Now()
+			entry.CachedAt = &now
+			if err := s.Cache.Save(ctx, &entry); err != nil {
+				log.Printf("Failed to mark ISBN %s as checked: %v", entry.ISBN, err)
+			}
+			continue
+		}
+		refreshed++
+	}
+	return refreshed, failed, nil
+}
+
+// StartRefresh runs RunRefresh in the background. It returns false if a
+// refresh is already running.
+func (s *MetadataService) StartRefresh() bool {
+	if !s.refreshing.CompareAndSwap(false, true) {
+		return false
+	}
+	go func() {
+		defer s.refreshing.Store(false)
+		s.logRefresh(s.refreshExpired(context.Background()))
+	}()
+	return true
+}
+
+// RunRefresh is the scheduled job wrapping RefreshExpired.
+func (s *MetadataService) RunRefresh() {
+	refreshed, failed, err := s.RefreshExpired(context.Background())
+	if errors.Is(err, ErrRefreshRunning) {
+		log.Println("ISBN cache refresh skipped: another refresh is still running")
+		return
+	}
+	s.logRefresh(refreshed, failed, err)
+}
+
+func (s *MetadataService) logRefresh(refreshed, failed int, err error) {
+	if err != nil {
+		log.Printf("ISBN cache refresh failed: %v", err)
+	}
+	log.Printf("ISBN cache refresh completed: %d refreshed, %d failed", refreshed, failed)
+}
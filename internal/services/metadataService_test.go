@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/store"
+)
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"30d", 30 * 24 * time.Hour, true},
+		{"1d", 24 * time.Hour, true},
+		{"720h", 720 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"0d", 0, false},
+		{"-2d", 0, false},
+		{"0h", 0, false},
+		{"-1h", 0, false},
+		{"d", 0, false},
+		{"1.5d", 0, false},
+		{"thirty days", 0, false},
+		{"30", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseTTL(tt.value)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseTTL(%q) = %s, %v; want %s, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewMetadataServiceTTL(t *testing.T) {
+	t.Setenv("ISBN_CACHE_TTL", "7d")
+	if s := NewMetadataService(store.NewMemory().Cache, &stubProvider{}); s.TTL != 7*24*time.Hour {
+		t.Errorf("TTL is %s, want 168h", s.TTL)
+	}
+	t.Setenv("ISBN_CACHE_TTL", "-1h")
+	if s := NewMetadataService(store.NewMemory().Cache, &stubProvider{}); s.TTL != defaultISBNCacheTTL {
+		t.Errorf("invalid ISBN_CACHE_TTL gave TTL %s, want the default", s.TTL)
+	}
+}
+
+func TestExpired(t *testing.T) {
+	s := &MetadataService{TTL: time.Hour}
+	now := time.Now()
+	old, recent := now.Add(-2*time.Hour), now.Add(-time.Minute)
+	tests := []struct {
+		name  string
+		entry models.IsbnCache
+		want  bool
+	}{
+		{"old", models.IsbnCache{CachedAt: &old}, true},
+		{"recent", models.IsbnCache{CachedAt: &recent}, false},
+		{"pinned", models.IsbnCache{CachedAt: &old, Pinned: true}, false},
+		{"never cached", models.IsbnCache{}, false},
+	}
+	for _, tt := range tests {
+		if got := s.Expired(&tt.entry, now); got != tt.want {
+			t.Errorf("%s: Expired = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// newTestMetadata returns a service over a memory cache holding entries,
+// with a TTL of an hour.
+func newTestMetadata(t *testing.T, provider *stubProvider, entries ...models.IsbnCache) *MetadataService {
+	t.Helper()
+	s := NewMetadataService(store.NewMemory().Cache, provider)
+	s.TTL = time.Hour
+	for _, entry := range entries {
+		if err := s.Cache.Save(context.Background(), &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	const dune = "9780441013593"
+	stale := time.Now().Add(-2 * time.Hour)
+	expired := models.IsbnCache{ISBN: dune, Title: "Dune (old)", CachedAt: &stale}
+	fresh := &stubProvider{isbns: map[string]*models.IsbnCache{dune: {Title: "Dune"}}}
+
+	t.Run("refetches expired entries", func(t *testing.T) {
+		s := newTestMetadata(t, fresh, expired)
+		meta, err := s.Lookup(ctx, dune, true)
+		if err != nil || meta == nil || meta.Title != "Dune" {
+			t.Fatalf("Lookup = %+v, %v", meta, err)
+		}
+		cached, _ := s.Cache.Get(ctx, dune)
+		if cached.Title != "Dune" || s.Expired(cached, time.Now()) {
+			t.Errorf("cache holds %+v", cached)
+		}
+	})
+
+	t.Run("keeps expired entries when providers fail", func(t *testing.T) {
+		s := newTestMetadata(t, &stubProvider{err: errors.New("provider down")}, expired)
+		meta, err := s.Lookup(ctx, dune, true)
+		if err != nil || meta == nil || meta.Title != "Dune (old)" {
+			t.Errorf("Lookup = %+v, %v; want the expired entry", meta, err)
+		}
+	})
+
+	t.Run("keeps expired entries the providers no longer know", func(t *testing.T) {
+		s := newTestMetadata(t, &stubProvider{}, expired)
+		if meta, err := s.Lookup(ctx, dune, true); err != nil || meta == nil || meta.Title != "Dune (old)" {
+			t.Errorf("Lookup = %+v, %v; want the expired entry", meta, err)
+		}
+	})
+
+	t.Run("without fetching", func(t *testing.T) {
+		provider := &stubProvider{isbns: fresh.isbns}
+		s := newTestMetadata(t, provider, expired)
+		if meta, err := s.Lookup(ctx, dune, false); err != nil || meta == nil || meta.Title != "Dune (old)" {
+			t.Errorf("Lookup = %+v, %v; want the expired entry", meta, err)
+		}
+		if meta, err := s.Lookup(ctx, "9780141439518", false); err != nil || meta != nil {
+			t.Errorf("Lookup of an uncached ISBN = %+v, %v; want nothing", meta, err)
+		}
+		if provider.lookups != 0 {
+			t.Errorf("asked the providers %d times", provider.lookups)
+		}
+	})
+
+	t.Run("fresh entries are not refetched", func(t *testing.T) {
+		provider := &stubProvider{isbns: fresh.isbns}
+		now := time.Now()
+		s := newTestMetadata(t, provider, models.IsbnCache{ISBN: dune, Title: "Dune (cached)", CachedAt: &now})
+		if meta, _ := s.Lookup(ctx, dune, true); meta == nil || meta.Title != "Dune (cached)" || provider.lookups != 0 {
+			t.Errorf("Lookup = %+v after %d provider lookups", meta, provider.lookups)
+		}
+	})
+
+	t.Run("misses", func(t *testing.T) {
+		s := newTestMetadata(t, &stubProvider{err: errors.New("provider down")})
+		if meta, err := s.Lookup(ctx, dune, true); err == nil || meta != nil {
+			t.Errorf("Lookup = %+v, %v; want the provider's error", meta, err)
+		}
+		s = newTestMetadata(t, &stubProvider{})
+		if meta, err := s.Lookup(ctx, dune, true); err != nil || meta != nil {
+			t.Errorf("Lookup = %+v, %v; want nothing", meta, err)
+		}
+	})
+}
+
+func TestRefreshExpired(t *testing.T) {
+	ctx := context.Background()
+	stale, recent := time.Now().Add(-2*time.Hour), time.Now()
+	provider := &stubProvider{isbns: map[string]*models.IsbnCache{
+		"9780441013593": {Title: "Dune"},
+		"9780141439518": {Title: "Emma"},
+	}}
+	s := newTestMetadata(t, provider,
+		models.IsbnCache{ISBN: "9780441013593", Title: "Dune (old)", CachedAt: &stale},
+		models.IsbnCache{ISBN: "9780141439518", Title: "Emma (old)", CachedAt: &stale},
+		// Unknown to the providers
+		models.IsbnCache{ISBN: "9780000000002", Title: "Lost", CachedAt: &stale},
+		models.IsbnCache{ISBN: "9780261103344", Title: "The Hobbit", CachedAt: &stale, Pinned: true},
+		models.IsbnCache{ISBN: "9780547928227", Title: "The Hobbit", CachedAt: &recent},
+	)
+
+	refreshed, failed, err := s.RefreshExpired(ctx)
+	if err != nil || refreshed != 2 || failed != 1 {
+		t.Fatalf("RefreshExpired = %d, %d, %v; want 2 refreshed, 1 failed", refreshed, failed, err)
+	}
+	if provider.lookups != 3 {
+		t.Errorf("looked up %d ISBNs, want 3", provider.lookups)
+	}
+	if dune, _ := s.Cache.Get(ctx, "9780441013593"); dune.Title != "Dune" {
+		t.Errorf("refreshed entry is %+v", dune)
+	}
+	lost, _ := s.Cache.Get(ctx, "9780000000002")
+	if lost.Title != "Lost" || s.Expired(lost, time.Now()) {
+		t.Errorf("unknown entry is %+v, want it kept and marked as checked", lost)
+	}
+	if pinned, _ := s.Cache.Get(ctx, "9780261103344"); !pinned.CachedAt.Equal(stale) {
+		t.Errorf("pinned entry was refreshed")
+	}
+
+	if refreshed, failed, err := s.RefreshExpired(ctx); err != nil || refreshed != 0 || failed != 0 {
+		t.Errorf("second run = %d, %d, %v; want nothing left to do", refreshed, failed, err)
+	}
+}
+
+func TestRefreshExpiredMovesPastFailures(t *testing.T) {
+	ctx := context.Background()
+	provider := &stubProvider{err: errors.New("provider down")}
+	var entries []models.IsbnCache
+	for i := range refreshBatchSize + 5 {
+		// The older an entry, the earlier it is refreshed
+		cachedAt := time.Now().Add(-2*time.Hour - time.Duration(refreshBatchSize+5-i)*time.Minute)
+		entries = append(entries, models.IsbnCache{ISBN: fmt.Sprintf("isbn-%03d", i), CachedAt: &cachedAt})
+	}
+	s := newTestMetadata(t, provider, entries...)
+
+	refreshed, failed, err := s.RefreshExpired(ctx)
+	if err != nil || refreshed != 0 || failed != refreshBatchSize {
+		t.Fatalf("first run = %d, %d, %v; want %d failed", refreshed, failed, err, refreshBatchSize)
+	}
+
+	// The next batch starts with the entries the first one didn't reach
+	provider.err = nil
+	provider.isbns = map[string]*models.IsbnCache{}
+	for _, entry := range entries[refreshBatchSize:] {
+		provider.isbns[entry.ISBN] = &models.IsbnCache{Title: "Refreshed"}
+	}
+	refreshed, failed, err = s.RefreshExpired(ctx)
+	if err != nil || refreshed != 5 || failed != 0 {
+		t.Errorf("second run = %d, %d, %v; want the 5 left over refreshed", refreshed, failed, err)
+	}
+}
+
+func TestRefreshExpiredCanceled(t *testing.T) {
+	stale := time.Now().Add(-2 * time.Hour)
+	s := newTestMetadata(t, &stubProvider{err: context.Canceled},
+		models.IsbnCache{ISBN: "9780441013593", CachedAt: &stale})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, _, err := s.RefreshExpired(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("RefreshExpired = %v, want context.Canceled", err)
+	}
+	if entry, _ := s.Cache.Get(context.Background(), "9780441013593"); !entry.CachedAt.Equal(stale) {
+		t.Errorf("canceled run marked the entry as checked")
+	}
+}
+
+func TestRefreshGuard(t *testing.T) {
+	s := newTestMetadata(t, &stubProvider{})
+	s.refreshing.Store(true)
+	if _, _, err := s.RefreshExpired(context.Background()); !errors.Is(err, ErrRefreshRunning) {
+		t.Errorf("RefreshExpired during a refresh = %v, want ErrRefreshRunning", err)
+	}
+	if s.StartRefresh() {
+		t.Error("StartRefresh started a second refresh")
+	}
+
+	s.refreshing.Store(false)
+	if _, _, err := s.RefreshExpired(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if s.refreshing.Load() {
+		t.Error("RefreshExpired left the guard set")
+	}
+}
@@ -1,25 +1,32 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"log"
 	"time"
 
-	"booklib/internal/models"
+	"booklib/internal/store"
 )
 
 type ReminderService struct {
-	DB           *sql.DB
+	Lending      store.LendingStore
 	EmailService *EmailService
 }
 
-func NewReminderService(db *sql.DB, emailService *EmailService) *ReminderService {
+func NewReminderService(lending store.LendingStore, emailService *EmailService) *ReminderService {
 	return &ReminderService{
-		DB:           db,
+		Lending:      lending,
 		EmailService: emailService,
 	}
 }
 
+// today returns midnight UTC of the current day; due dates are stored as UTC
+// calendar dates.
+func today() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
 // CheckAndSendReminders runs the daily reminder check
 func (r *ReminderService) CheckAndSendReminders() {
 	log.Println("Starting reminder check...")
@@ -40,54 +47,19 @@ func (r *ReminderService) CheckAndSendReminders() {
 func (r *ReminderService) sendUpcomingDueReminders() error {
 	// Find books due in 3 days that haven't had a reminder sent in the last 24 hours
 	// Only include users who have email reminders enabled
-	query := `
-		SELECT 
-			l.id,
-			l.user_id,
-			u.email,
-			b.title,
-			b.author,
-			l.lent_to,
-			l.due_date,
-			l.lent_at,
-			l.last_reminder_sent
-		FROM lending l
-		JOIN users u ON l.user_id = u.id
-		JOIN books b ON l.book_id = b.id
-		LEFT JOIN user_settings us ON u.id = us.user_id
-		WHERE l.returned_at IS NULL
-		AND l.due_date IS NOT NULL
-		AND DATE(l.due_date) = DATE('now', '+3 days')
-		AND (l.last_reminder_sent IS NULL OR l.last_reminder_sent < datetime('now', '-24 hours'))
-		AND (us.email_reminders_enabled IS NULL OR us.email_reminders_enabled = 1)
-		AND (us.email_upcoming_reminders IS NULL OR us.email_upcoming_reminders = 1)
-	`
-
-	rows, err := r.DB.Query(query)
+	dueFrom := today().AddDate(0, 0, 3)
+	lendings, err := r.Lending.ListUpcomingReminders(
+		context.Background(),
+		dueFrom,
+		dueFrom.AddDate(0, 0, 1),
+		time.Now().Add(-24*time.Hour),
+	)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
 	count := 0
-	for rows.Next() {
-		var lending models.ReminderLending
-		err := rows.Scan(
-			&lending.LendingID,
-			&lending.UserID,
-			&lending.UserEmail,
-			&lending.BookTitle,
-			&lending.BookAuthor,
-			&lending.LentTo,
-			&lending.DueDate,
-			&lending.LentAt,
-			&lending.LastReminderSent,
-		)
-		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
-
+	for _, lending := range lendings {
 		// Send email
 		emailData := EmailData{
 			UserEmail:  lending.UserEmail,
@@ -118,35 +90,14 @@ func (r *ReminderService) sendUpcomingDueReminders() error {
 func (r *ReminderService) sendOverdueReminders() error {
 	// Find overdue books that haven't had a reminder in the last 24 hours
 	// Only include users who have email reminders enabled
-	query := `
-		SELECT 
-			l.id,
-			l.user_id,
-			u.email,
-			b.title,
-			b.author,
-			l.lent_to,
-			l.due_date,
-			l.lent_at,
-			l.last_reminder_sent
-		FROM lending l
-		JOIN users u ON l.user_id = u.id
-		JOIN books b ON l.book_id = b.id
-		LEFT JOIN user_settings us ON u.id = us.user_id
-		WHERE l.returned_at IS NULL
-		AND l.due_date IS NOT NULL
-		AND DATE(l.due_date) < DATE('now')
-		AND (l.last_reminder_sent IS NULL OR l.last_reminder_sent < datetime('now', '-24 hours'))
-		AND (us.email_reminders_enabled IS NULL OR us.email_reminders_enabled = 1)
-		AND (us.email_overdue_reminders IS NULL OR us.email_overdue_reminders = 1)
-		ORDER BY l.user_id, l.due_date
-	`
-
-	rows, err := r.DB.Query(query)
+	lendings, err := r.Lending.ListOverdueReminders(
+		context.Background(),
+		today(),
+		time.Now().Add(-24*time.Hour),
+	)
 	if err != nil {
 		return err
 	}
-	defer rows.Close()
 
 	// Group overdue books by user
 	userBooks := make(map[int]*struct {
@@ -155,24 +106,7 @@ func (r *ReminderService) sendOverdueReminders() error {
 		LendingIDs []int
 	})
 
-	for rows.Next() {
-		var lending models.ReminderLending
-		err := rows.Scan(
-			&lending.LendingID,
-			&lending.UserID,
-			&lending.UserEmail,
-			&lending.BookTitle,
-			&lending.BookAuthor,
-			&lending.LentTo,
-			&lending.DueDate,
-			&lending.LentAt,
-			&lending.LastReminderSent,
-		)
-		if err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
-
+	for _, lending := range lendings {
 		// Calculate days overdue
 		daysOverdue := int(time.Since(lending.DueDate).Hours() / 24)
 
@@ -230,7 +164,5 @@ func (r *ReminderService) sendOverdueReminders() error {
 }
 
 func (r *ReminderService) updateLastReminderSent(lendingID int) error {
-	query := `UPDATE lending SET last_reminder_sent = datetime('now') WHERE id = ?`
-	_, err := r.DB.Exec(query, lendingID)
-	return err
+	return r.Lending.MarkReminderSent(context.Background(), lendingID, time.Now())
 }
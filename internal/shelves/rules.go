@@ -0,0 +1,188 @@
+package shelves
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/tags"
+)
+
+// Match modes of models.ShelfRules.
+const (
+	MatchAll = "all"
+	MatchAny = "any"
+)
+
+const (
+	// MaxRules caps the number of rules on a smart shelf.
+	MaxRules = 20
+	// maxTextLength caps text values in characters.
+	maxTextLength = 200
+	// dateLayout is the format of before and after values.
+	dateLayout = "2006-01-02"
+)
+
+// kind is the type of value a rule field compares.
+type kind int
+
+const (
+	kindText kind = iota
+	kindLabel
+	kindBool
+	kindNumber
+	kindDate
+	kindStatus
+)
+
+// fields maps the fields rules can test to their kind:
+//
+//   - title and author are text, matched ignoring case
+//   - genre and tag match any of the book's genres or tags, and language
+//     the book's language, ignoring case
+//   - read, lent_out, reading (a session in progress) and started (any
+//     session) are true or false
+//   - status is one of the reading statuses, see package reading
+//   - page_count is a number
+//   - added is when the book was added and finished when any of its reading
+//     sessions was completed
+var fields = map[string]kind{
+	"title":      kindText,
+	"author":     kindText,
+	"genre":      kindLabel,
+	"tag":        kindLabel,
+	"language":   kindLabel,
+	"read":       kindBool,
+	"lent_out":   kindBool,
+	"reading":    kindBool,
+	"started":    kindBool,
+	"status":     kindStatus,
+	"page_count": kindNumber,
+	"added":      kindDate,
+	"finished":   kindDate,
+}
+
+// ops lists the operators each kind supports. within_days takes a number of
+// days back from now, before and after a YYYY-MM-DD date, which they
+// exclude.
+var ops = map[kind][]string{
+	kindText:   {"is", "is_not", "contains", "not_contains"},
+	kindLabel:  {"is", "is_not"},
+	kindBool:   {"is"},
+	kindNumber: {"is", "gt", "lt"},
+	kindDate:   {"within_days", "before", "after"},
+	kindStatus: {"is", "is_not"},
+}
+
+// ValidateRules checks the rules and normalizes them: an empty Match means
+// MatchAll, text values are cleaned and numbers are float64, as decoded from
+// JSON. Error messages only name rules by position and known fields, never
+// echoing values, so they can be shown as they are.
+func ValidateRules(rules *models.ShelfRules) error {
+	switch rules.Match {
+	case "":
+		rules.Match = MatchAll
+	case MatchAll, MatchAny:
+	default:
+		return fmt.Errorf("match must be %s or %s", MatchAll, MatchAny)
+	}
+	if len(rules.Rules) == 0 || len(rules.Rules) > MaxRules {
+		return fmt.Errorf("a smart shelf needs 1 to %d rules", MaxRules)
+	}
+
+	for i := range rules.Rules {
+		if err := validateRule(&rules.Rules[i]); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateRule(rule *models.ShelfRule) error {
+	k, ok := fields[rule.Field]
+	if !ok {
+		return errors.New("unknown field")
+	}
+	if !slices.Contains(ops[k], rule.Op) {
+		return fmt.Errorf("%s supports %s", rule.Field, strings.Join(ops[k], ", "))
+	}
+
+	switch {
+	case k == kindBool:
+		if _, ok := rule.Value.(bool); !ok {
+			return fmt.Errorf("%s needs true or false", rule.Field)
+		}
+	case k == kindNumber || rule.Op == "within_days":
+		n, ok := toNumber(rule.Value)
+		if !ok || n < 0 || n != math.Trunc(n) || n > math.MaxInt32 {
+			return fmt.Errorf("%s %s needs a whole number", rule.Field, rule.Op)
+		}
+		rule.Value = n
+	case k == kindStatus:
+		if s, ok := rule.Value.(string); !ok || !reading.Valid(s) {
+			return fmt.Errorf("status needs one of %s", strings.Join(reading.Statuses, ", "))
+		}
+	case k == kindDate:
+		s, ok := rule.Value.(string)
+		if _, err := time.Parse(dateLayout, s); !ok || err != nil {
+			return fmt.Errorf("%s %s needs a YYYY-MM-DD date", rule.Field, rule.Op)
+		}
+	default:
+		s, ok := rule.Value.(string)
+		s = tags.Clean(s)
+		if !ok || s == "" || utf8.RuneCountInString(s) > maxTextLength {
+			return fmt.Errorf("%s needs 1 to %d characters of text", rule.Field, maxTextLength)
+		}
+		rule.Value = s
+	}
+	return nil
+}
+
+// toNumber converts a JSON number, which may have been decoded into an int
+// by Go callers, to float64.
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// Text returns the value of a validated text, label or status rule.
+func Text(rule models.ShelfRule) string {
+	s, _ := rule.Value.(string)
+	return s
+}
+
+// Bool returns the value of a validated true-or-false rule.
+func Bool(rule models.ShelfRule) bool {
+	b, _ := rule.Value.(bool)
+	return b
+}
+
+// Number returns the value of a validated number or within_days rule.
+func Number(rule models.ShelfRule) int {
+	n, _ := toNumber(rule.Value)
+	return int(n)
+}
+
+// Range returns the time range a validated date rule matches, including
+// from and excluding to; one of them is zero.
+func Range(rule models.ShelfRule, now time.Time) (from, to time.Time) {
+	if rule.Op == "within_days" {
+		return now.AddDate(0, 0, -Number(rule)), time.Time{}
+	}
+	date, _ := time.Parse(dateLayout, Text(rule))
+	if rule.Op == "before" {
+		return time.Time{}, date
+	}
+	return date.AddDate(0, 0, 1), time.Time{}
+}
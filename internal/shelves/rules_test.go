@@ -0,0 +1,105 @@
+package shelves
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"booklib/internal/models"
+)
+
+func TestValidateRules(t *testing.T) {
+	rule := func(field, op string, value any) models.ShelfRule {
+		return models.ShelfRule{Field: field, Op: op, Value: value}
+	}
+	tooMany := make([]models.ShelfRule, MaxRules+1)
+	for i := range tooMany {
+		tooMany[i] = rule("read", "is", true)
+	}
+
+	tests := []struct {
+		name  string
+		rules models.ShelfRules
+		err   string // "" means valid
+	}{
+		{"text", models.ShelfRules{Rules: []models.ShelfRule{rule("title", "contains", "dune")}}, ""},
+		{"any", models.ShelfRules{Match: MatchAny, Rules: []models.ShelfRule{rule("genre", "is", "Fantasy"), rule("tag", "is_not", "signed")}}, ""},
+		{"bool", models.ShelfRules{Rules: []models.ShelfRule{rule("lent_out", "is", false)}}, ""},
+		{"status", models.ShelfRules{Rules: []models.ShelfRule{rule("status", "is_not", "did_not_finish")}}, ""},
+		{"number", models.ShelfRules{Rules: []models.ShelfRule{rule("page_count", "gt", 300.0)}}, ""},
+		{"int from Go", models.ShelfRules{Rules: []models.ShelfRule{rule("page_count", "lt", 300)}}, ""},
+		{"within days", models.ShelfRules{Rules: []models.ShelfRule{rule("added", "within_days", 30.0)}}, ""},
+		{"date", models.ShelfRules{Rules: []models.ShelfRule{rule("finished", "before", "2024-01-01")}}, ""},
+
+		{"unknown match", models.ShelfRules{Match: "some", Rules: []models.ShelfRule{rule("read", "is", true)}}, "match must be all or any"},
+		{"no rules", models.ShelfRules{}, "a smart shelf needs 1 to 20 rules"},
+		{"too many rules", models.ShelfRules{Rules: tooMany}, "a smart shelf needs 1 to 20 rules"},
+		{"unknown field", models.ShelfRules{Rules: []models.ShelfRule{rule("rating", "is", 5.0)}}, "rule 1: unknown field"},
+		{"op of another kind", models.ShelfRules{Rules: []models.ShelfRule{rule("genre", "contains", "Fan")}}, "rule 1: genre supports is, is_not"},
+		{"bool as text", models.ShelfRules{Rules: []models.ShelfRule{rule("read", "is", "true")}}, "rule 1: read needs true or false"},
+		{"negative number", models.ShelfRules{Rules: []models.ShelfRule{rule("page_count", "is", -1.0)}}, "rule 1: page_count is needs a whole number"},
+		{"fraction", models.ShelfRules{Rules: []models.ShelfRule{rule("page_count", "gt", 1.5)}}, "rule 1: page_count gt needs a whole number"},
+		{"huge number", models.ShelfRules{Rules: []models.ShelfRule{rule("added", "within_days", 1e12)}}, "rule 1: added within_days needs a whole number"},
+		{"number as text", models.ShelfRules{Rules: []models.ShelfRule{rule("page_count", "is", "300")}}, "rule 1: page_count is needs a whole number"},
+		{"unknown status", models.ShelfRules{Rules: []models.ShelfRule{rule("status", "is", "shelved")}}, "rule 1: status needs one of"},
+		{"bad date", models.ShelfRules{Rules: []models.ShelfRule{rule("added", "after", "01/02/2024")}}, "rule 1: added after needs a YYYY-MM-DD date"},
+		{"date as number", models.ShelfRules{Rules: []models.ShelfRule{rule("added", "before", 2024.0)}}, "rule 1: added before needs a YYYY-MM-DD date"},
+		{"blank text", models.ShelfRules{Rules: []models.ShelfRule{rule("author", "is", "   ")}}, "rule 1: author needs 1 to 200 characters of text"},
+		{"long text", models.ShelfRules{Rules: []models.ShelfRule{rule("title", "is", strings.Repeat("x", 201))}}, "rule 1: title needs 1 to 200 characters of text"},
+		{"text as number", models.ShelfRules{Rules: []models.ShelfRule{rule("title", "is", 1.0)}}, "rule 1: title needs 1 to 200 characters of text"},
+		{"second rule", models.ShelfRules{Rules: []models.ShelfRule{rule("read", "is", true), rule("read", "is_not", true)}}, "rule 2: read supports is"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(&tt.rules)
+			if tt.err == "" {
+				if err != nil {
+					t.Errorf("got %v, want valid", err)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("got %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateRulesNormalizes(t *testing.T) {
+	rules := models.ShelfRules{Rules: []models.ShelfRule{
+		{Field: "title", Op: "is", Value: "  The   Hobbit "},
+		{Field: "page_count", Op: "gt", Value: 300},
+	}}
+	if err := ValidateRules(&rules); err != nil {
+		t.Fatal(err)
+	}
+	if rules.Match != MatchAll {
+		t.Errorf("match is %q, want %q", rules.Match, MatchAll)
+	}
+	if v := rules.Rules[0].Value; v != "The Hobbit" {
+		t.Errorf("title value is %q", v)
+	}
+	if v, ok := rules.Rules[1].Value.(float64); !ok || v != 300 {
+		t.Errorf("page_count value is %#v, want float64 300", rules.Rules[1].Value)
+	}
+}
+
+func TestRange(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 0, 0, 0, 0, time.UTC) }
+	tests := []struct {
+		rule     models.ShelfRule
+		from, to time.Time
+	}{
+		{models.ShelfRule{Field: "added", Op: "within_days", Value: 7.0}, now.AddDate(0, 0, -7), time.Time{}},
+		// before and after leave out the date itself
+		{models.ShelfRule{Field: "added", Op: "before", Value: "2024-03-05"}, time.Time{}, day(5)},
+		{models.ShelfRule{Field: "added", Op: "after", Value: "2024-03-05"}, day(6), time.Time{}},
+	}
+	for _, tt := range tests {
+		from, to := Range(tt.rule, now)
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("Range(%v) = %v, %v; want %v, %v", tt.rule, from, to, tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Package shelves validates the shelves users file their books on.
+package shelves
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+	"booklib/internal/tags"
+)
+
+const (
+	// MaxNameLength caps the length of a shelf name in characters.
+	MaxNameLength = 100
+	// MaxDescriptionLength caps the length of a shelf description in
+	// characters.
+	MaxDescriptionLength = 1000
+)
+
+var (
+	// ErrInvalidName is returned for a shelf name that is empty or longer
+	// than MaxNameLength.
+	ErrInvalidName = errors.New("invalid shelf name")
+	// ErrInvalidDescription is returned for a shelf description longer than
+	// MaxDescriptionLength.
+	ErrInvalidDescription = errors.New("invalid shelf description")
+)
+
+// Key returns the form shelf names are matched by, so a user can't have
+// both "To Read" and "to  read". Shelf names match like tags do.
+func Key(name string) string {
+	return tags.Key(name)
+}
+
+// Validate cleans the shelf's name and description and checks their
+// lengths.
+func Validate(shelf *models.Shelf) error {
+	return validateText(&shelf.Name, &shelf.Description)
+}
+
+// ValidateSmart checks a smart shelf's name and description like Validate
+// and its rules with ValidateRules.
+func ValidateSmart(shelf *models.SmartShelf) error {
+	if err := validateText(&shelf.Name, &shelf.Description); err != nil {
+		return err
+	}
+	return ValidateRules(&shelf.Rules)
+}
+
+func validateText(name, description *string) error {
+	*name = tags.Clean(*name)
+	*description = strings.TrimSpace(*description)
+	if *name == "" || utf8.RuneCountInString(*name) > MaxNameLength {
+		return ErrInvalidName
+	}
+	if utf8.RuneCountInString(*description) > MaxDescriptionLength {
+		return ErrInvalidDescription
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package store
+
+import "booklib/internal/models"
+
+// NewExportReader returns a reader over an export already in memory, such
+// as one read back by archive.ReadZip.
+func NewExportReader(e *models.Export) ExportReader {
+	return exportReader{e}
+}
+
+type exportReader struct {
+	e *models.Export
+}
+
+// each calls fn with every record, stopping at the first error.
+func each[T any](records []T, fn func(T) error) error {
+	for _, record := range records {
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r exportReader) Books(fn func(models.Book) error) error {
+	return each(r.e.Books, fn)
+}
+
+func (r exportReader) Lending(fn func(models.Lending) error) error {
+	return each(r.e.Lending, fn)
+}
+
+func (r exportReader) ReadingHistory(fn func(models.ReadingHistory) error) error {
+	return each(r.e.ReadingHistory, fn)
+}
+
+func (r exportReader) StatusChanges(fn func(models.StatusChange) error) error {
+	return each(r.e.StatusChanges, fn)
+}
+
+func (r exportReader) ReadingProgress(fn func(models.ReadingProgress) error) error {
+	return each(r.e.ReadingProgress, fn)
+}
+
+func (r exportReader) Reviews(fn func(models.Review) error) error {
+	return each(r.e.Reviews, fn)
+}
+
+func (r exportReader) Notes(fn func(models.Note) error) error {
+	return each(r.e.Notes, fn)
+}
+
+func (r exportReader) Shelves(fn func(models.ExportShelf) error) error {
+	return each(r.e.Shelves, fn)
+}
+
+func (r exportReader) SmartShelves(fn func(models.ExportSmartShelf) error) error {
+	return each(r.e.SmartShelves, fn)
+}
+
+func (r exportReader) UserSettings() (*models.UserSettings, error) {
+	return r.e.UserSettings, nil
+}
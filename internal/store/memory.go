@@ -0,0 +1,171 @@
+package store
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"booklib/internal/models"
+)
+
+// memory is an in-process database shared by the in-memory stores. A single
+// lock guards every table so cross-table operations stay consistent.
+type memory struct {
+	mu sync.RWMutex
+
+	nextID        map[string]int
+	users         map[int]*models.User
+	books         map[int]*memoryBook
+	authors       map[int]*models.Author
+	authorKeys    map[string]int
+	tags          map[int]*memoryTag
+	shelves       map[int]*memoryShelf
+	smartShelves  map[int]*memorySmartShelf
+	isbnCache     map[string]*models.IsbnCache
+	proposals     map[int]*memoryProposal
+	lending       map[int]*models.Lending
+	reading       map[int]*models.ReadingHistory
+	statusChanges map[int]*models.StatusChange
+	progress      map[int]*models.ReadingProgress
+	reviews       map[int]*models.Review
+	reviewEdits   map[int]*models.ReviewEdit
+	notes         map[int]*memoryNote
+	userSettings  map[int]*models.UserSettings
+	appSettings   map[string]string
+}
+
+// memoryBook is a books row: the API model plus columns it does not expose.
+type memoryBook struct {
+	models.Book
+	UserID int
+	// tagIDs replaces Book.Tags, which is left empty, so renamed tags show
+	// up on every book.
+	tagIDs []int
+}
+
+// copyBook returns the book with its own copy of the credits and genres,
+// and its tags' names. Callers must hold the lock.
+func (m *memory) copyBook(b *memoryBook) models.Book {
+	book := b.Book
+	book.Authors = b.credits()
+	book.Genres = slices.Clone(b.Genres)
+	book.Tags = m.tagNames(b.tagIDs)
+	return book
+}
+
+// NewMemory returns stores that keep everything in memory. It is intended
+// for tests and local experiments; nothing is persisted.
+func NewMemory() *Stores {
+	m := &memory{
+		nextID:        make(map[string]int),
+		users:         make(map[int]*models.User),
+		books:         make(map[int]*memoryBook),
+		authors:       make(map[int]*models.Author),
+		authorKeys:    make(map[string]int),
+		tags:          make(map[int]*memoryTag),
+		shelves:       make(map[int]*memoryShelf),
+		smartShelves:  make(map[int]*memorySmartShelf),
+		isbnCache:     make(map[string]*models.IsbnCache),
+		proposals:     make(map[int]*memoryProposal),
+		lending:       make(map[int]*models.Lending),
+		reading:       make(map[int]*models.ReadingHistory),
+		statusChanges: make(map[int]*models.StatusChange),
+		progress:      make(map[int]*models.ReadingProgress),
+		reviews:       make(map[int]*models.Review),
+		reviewEdits:   make(map[int]*models.ReviewEdit),
+		notes:         make(map[int]*memoryNote),
+		userSettings:  make(map[int]*models.UserSettings),
+		appSettings:   map[string]string{"registration_enabled": "true"},
+	}
+	return &Stores{
+		Books:      &memoryBookStore{m},
+		Authors:    &memoryAuthorStore{m},
+		Tags:       &memoryTagStore{m},
+		Shelves:    &memoryShelfStore{m},
+		Smart:      &memorySmartShelfStore{m},
+		Cache:      &memoryISBNCacheStore{m},
+		Enrichment: &memoryEnrichmentStore{m},
+		Lending:    &memoryLendingStore{m},
+		Reading:    &memoryReadingStore{m},
+		Notes:      &memoryNoteStore{m},
+		Users:      &memoryUserStore{m},
+		Settings:   &memorySettingsStore{m},
+		Stats:      &memoryStatsStore{m},
+		Export:     &memoryExportStore{m},
+	}
+}
+
+// id allocates the next auto-increment ID for a table. Callers must hold
+// the write lock.
+func (m *memory) id(table string) int {
+	m.nextID[table]++
+	return m.nextID[table]
+}
+
+// deleteBook removes a book and the rows that reference it, mirroring ON
+// DELETE CASCADE. Callers must hold the write lock.
+func (m *memory) deleteBook(bookID int) {
+	delete(m.books, bookID)
+	for id, l := range m.lending {
+		if l.BookID == bookID {
+			delete(m.lending, id)
+		}
+	}
+	for id, h := range m.reading {
+		if h.BookID == bookID {
+			m.deleteSession(id)
+		}
+	}
+	for id, n := range m.notes {
+		if n.BookID == bookID {
+			delete(m.notes, id)
+		}
+	}
+	for id, c := range m.statusChanges {
+		if c.BookID == bookID {
+			delete(m.statusChanges, id)
+		}
+	}
+	for id, p := range m.proposals {
+		if p.BookID == bookID {
+			delete(m.proposals, id)
+		}
+	}
+	for _, shelf := range m.shelves {
+		shelf.bookIDs = slices.DeleteFunc(shelf.bookIDs, func(id int) bool { return id == bookID })
+	}
+}
+
+// deleteSession removes a reading session with its progress updates and
+// review, and unlinks the notes taken in it. Callers must hold the write lock.
+func (m *memory) deleteSession(historyID int) {
+	delete(m.reading, historyID)
+	for id, p := range m.progress {
+		if p.SessionID == historyID {
+			delete(m.progress, id)
+		}
+	}
+	if review := m.sessionReview(historyID); review != nil {
+		m.deleteReview(review.ID)
+	}
+	for _, n := range m.notes {
+		if n.SessionID != nil && *n.SessionID == historyID {
+			n.SessionID = nil
+		}
+	}
+}
+
+// sortedIDs returns the keys of an ID-keyed table in ascending order.
+func sortedIDs[T any](table map[int]T) []int {
+	ids := make([]int, 0, len(table))
+	for id := range table {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
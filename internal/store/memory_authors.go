@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"booklib/internal/authors"
+	"booklib/internal/models"
+)
+
+// credit normalizes the book's credits and resolves them to authors,
+// creating authors that don't exist yet, like writeCredits. Callers must
+// hold the write lock.
+func (m *memory) credit(book *models.Book) error {
+	if err := authors.Normalize(book); err != nil {
+		return err
+	}
+	credits := make([]models.BookAuthor, len(book.Authors))
+	for i, credit := range book.Authors {
+		key := authors.Key(credit.Name)
+		id, ok := m.authorKeys[key]
+		if !ok {
+			id = m.id("authors")
+			m.authors[id] = &models.Author{ID: id, Name: credit.Name}
+			m.authorKeys[key] = id
+		}
+		credit.ID = id
+		credit.Name = m.authors[id].Name
+		credits[i] = credit
+	}
+	book.Authors = credits
+	return nil
+}
+
+// credits returns a copy of the book's credits, so callers can't change the
+// stored ones.
+func (b *memoryBook) credits() []models.BookAuthor {
+	if len(b.Authors) == 0 {
+		return nil
+	}
+	return append([]models.BookAuthor(nil), b.Authors...)
+}
+
+type memoryAuthorStore struct {
+	m *memory
+}
+
+func (s *memoryAuthorStore) List(ctx context.Context, userID int, search string) ([]models.AuthorSummary, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	search = strings.ToLower(search)
+	counts := make(map[int]int)
+	for _, b := range s.m.books {
+		if b.UserID != userID {
+			continue
+		}
+		seen := make(map[int]bool)
+		for _, credit := range b.Authors {
+			if !seen[credit.ID] {
+				seen[credit.ID] = true
+				counts[credit.ID]++
+			}
+		}
+	}
+
+	list := []models.AuthorSummary{}
+	for id, count := range counts {
+		author := s.m.authors[id]
+		if search != "" && !strings.Contains(strings.ToLower(author.Name), search) {
+			continue
+		}
+		list = append(list, models.AuthorSummary{Author: *author, BookCount: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := strings.ToLower(list[i].Name), strings.ToLower(list[j].Name)
+		if a != b {
+			return a < b
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (s *memoryAuthorStore) Get(ctx context.Context, userID, authorID int) (*models.AuthorDetail, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	author, ok := s.m.authors[authorID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	detail := &models.AuthorDetail{Author: *author, Books: []models.AuthoredBook{}}
+	for _, id := range sortedIDs(s.m.books) {
+		b := s.m.books[id]
+		if b.UserID != userID {
+			continue
+		}
+		var roles []string
+		for _, credit := range b.Authors {
+			if credit.ID == authorID {
+				roles = append(roles, credit.Role)
+			}
+		}
+		if len(roles) > 0 {
+			sort.Strings(roles)
+			detail.Books = append(detail.Books, models.AuthoredBook{Book: s.m.copyBook(b), Roles: roles})
+		}
+	}
+	if len(detail.Books) == 0 {
+		return nil, ErrNotFound
+	}
+	sort.SliceStable(detail.Books, func(i, j int) bool {
+		return strings.ToLower(detail.Books[i].Title) < strings.ToLower(detail.Books[j].Title)
+	})
+	return detail, nil
+}
@@ -0,0 +1,548 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"html"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"booklib/internal/authors"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/tags"
+)
+
+type memoryBookStore struct {
+	m *memory
+}
+
+func (s *memoryBookStore) List(ctx context.Context, userID int) ([]models.Book, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	books := []models.Book{}
+	for _, id := range sortedIDs(s.m.books) {
+		if b := s.m.books[id]; b.UserID == userID {
+			books = append(books, s.m.copyBook(b))
+		}
+	}
+	return books, nil
+}
+
+func (s *memoryBookStore) Get(ctx context.Context, userID, bookID int) (*models.Book, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	b, ok := s.m.books[bookID]
+	if !ok || b.UserID != userID {
+		return nil, ErrNotFound
+	}
+	book := s.m.copyBook(b)
+	return &book, nil
+}
+
+func (s *memoryBookStore) OwnerID(ctx context.Context, bookID int) (int, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	b, ok := s.m.books[bookID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return b.UserID, nil
+}
+
+func (s *memoryBookStore) FindByISBN(ctx context.Context, userID int, isbn string) (int, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	if id := s.m.findByISBN(userID, isbn); id != 0 {
+		return id, nil
+	}
+	return 0, ErrNotFound
+}
+
+// findByISBN returns the ID of the user's book with the ISBN, or 0. Callers
+// must hold the lock.
+func (m *memory) findByISBN(userID int, isbn string) int {
+	if isbn == "" {
+		return 0
+	}
+	for _, id := range sortedIDs(m.books) {
+		if b := m.books[id]; b.UserID == userID && b.ISBN == isbn {
+			return id
+		}
+	}
+	return 0
+}
+
+func (s *memoryBookStore) Create(ctx context.Context, userID int, book *models.Book) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.findByISBN(userID, book.ISBN) != 0 {
+		return ErrConflict
+	}
+	if err := tags.Normalize(book); err != nil {
+		return err
+	}
+	if err := s.m.credit(book); err != nil {
+		return err
+	}
+
+	book.ID = s.m.id("books")
+	book.CreatedAt = timePtr(time.Now())
+	book.StatusChangedAt = nil
+	reading.Settle(book, nil)
+	s.m.insertBook(userID, book)
+	return nil
+}
+
+// insertBook stores a new book, which must have been normalized and
+// credited, and settles its genres and tags. Callers must hold the write
+// lock.
+func (m *memory) insertBook(userID int, book *models.Book) {
+	tagIDs := m.label(userID, book, nil)
+	stored := &memoryBook{Book: *book, UserID: userID, tagIDs: tagIDs}
+	stored.Tags = nil
+	m.books[book.ID] = stored
+}
+
+func (s *memoryBookStore) Import(ctx context.Context, userID int, books []*models.ImportBook) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, b := range books {
+		if b.ISBN == "" {
+			continue
+		}
+		if seen[b.ISBN] || s.m.findByISBN(userID, b.ISBN) != 0 {
+			return ErrConflict
+		}
+		seen[b.ISBN] = true
+	}
+	for _, b := range books {
+		if err := tags.Normalize(&b.Book); err != nil {
+			return err
+		}
+		check := b.Book
+		if err := authors.Normalize(&check); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, b := range books {
+		b.ID = s.m.id("books")
+		b.CreatedAt = timePtr(now)
+		b.StatusChangedAt = nil
+		reading.Settle(&b.Book, b.Sessions)
+		s.m.credit(&b.Book)
+		s.m.insertBook(userID, &b.Book)
+
+		for i := range b.Sessions {
+			session := &b.Sessions[i]
+			session.ID = s.m.id("reading_history")
+			session.BookID = b.ID
+			session.UserID = userID
+			stored := *session
+			s.m.reading[stored.ID] = &stored
+		}
+	}
+	return nil
+}
+
+func (s *memoryBookStore) Update(ctx context.Context, userID int, book *models.Book) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.books[book.ID]
+	if !ok || existing.UserID != userID {
+		return ErrNotFound
+	}
+	if id := s.m.findByISBN(userID, book.ISBN); id != 0 && id != book.ID {
+		return ErrConflict
+	}
+	if err := tags.Normalize(book); err != nil {
+		return err
+	}
+	if err := s.m.credit(book); err != nil {
+		return err
+	}
+	existing.tagIDs = s.m.label(userID, book, existing)
+
+	book.Status, book.StatusChangedAt, book.Read = existing.Status, existing.StatusChangedAt, existing.Read
+	updated := *book
+	updated.CreatedAt = existing.CreatedAt
+	updated.Tags = nil
+	existing.Book = updated
+	return nil
+}
+
+func (s *memoryBookStore) Delete(ctx context.Context, userID, bookID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b, ok := s.m.books[bookID]
+	if !ok || b.UserID != userID {
+		return ErrNotFound
+	}
+	s.m.deleteBook(bookID)
+	return nil
+}
+
+type memoryISBNCacheStore struct {
+	m *memory
+}
+
+func (s *memoryISBNCacheStore) Get(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	entry, ok := s.m.isbnCache[isbn]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cached := *entry
+	return &cached, nil
+}
+
+func (s *memoryISBNCacheStore) Put(ctx context.Context, entry *models.IsbnCache) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.isbnCache[entry.ISBN]; ok {
+		return nil
+	}
+	s.m.isbnCache[entry.ISBN] = newCacheEntry(entry)
+	return nil
+}
+
+func (s *memoryISBNCacheStore) Save(ctx context.Context, entry *models.IsbnCache) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.isbnCache[entry.ISBN] = newCacheEntry(entry)
+	return nil
+}
+
+// newCacheEntry copies an entry for storage, stamping it with the current
+// time if it has no cache time.
+func newCacheEntry(entry *models.IsbnCache) *models.IsbnCache {
+	cached := *entry
+	if cached.CachedAt == nil {
+		cached.CachedAt = timePtr(time.Now())
+	}
+	return &cached
+}
+
+func (s *memoryISBNCacheStore) List(ctx context.Context, q ISBNCacheQuery) ([]models.IsbnCache, int, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	search := strings.ToLower(q.Search)
+	matched := []models.IsbnCache{}
+	for _, entry := range s.m.isbnCache {
+		if search != "" && !strings.Contains(entry.ISBN, search) &&
+			!strings.Contains(strings.ToLower(entry.Title), search) &&
+			!strings.Contains(strings.ToLower(entry.Author), search) {
+			continue
+		}
+		if !q.ExpiredBefore.IsZero() && (entry.Pinned || !entry.CachedAt.Before(q.ExpiredBefore)) {
+			continue
+		}
+		matched = append(matched, *entry)
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if !q.ExpiredBefore.IsZero() && !matched[i].CachedAt.Equal(*matched[j].CachedAt) {
+			return matched[i].CachedAt.Before(*matched[j].CachedAt)
+		}
+		return matched[i].ISBN < matched[j].ISBN
+	})
+
+	total := len(matched)
+	if q.Limit > 0 {
+		start := min(q.Offset, total)
+		matched = matched[start:min(start+q.Limit, total)]
+	}
+	return matched, total, nil
+}
+
+func (s *memoryISBNCacheStore) Delete(ctx context.Context, isbn string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.isbnCache[isbn]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.isbnCache, isbn)
+	return nil
+}
+
+func (s *memoryISBNCacheStore) Purge(ctx context.Context, cachedBefore time.Time) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	purged := 0
+	for isbn, entry := range s.m.isbnCache {
+		if !entry.Pinned && entry.CachedAt.Before(cachedBefore) {
+			delete(s.m.isbnCache, isbn)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// matches reports whether the book passes q's filters. Callers must hold the
+// lock.
+func (m *memory) matches(b *memoryBook, q BookQuery) bool {
+	if q.Read != nil && b.Read != *q.Read {
+		return false
+	}
+	if q.Status != "" && b.Status != q.Status {
+		return false
+	}
+	if q.LentOut != nil {
+		lent := false
+		for _, l := range m.lending {
+			if l.BookID == b.ID && l.ReturnedAt == nil {
+				lent = true
+				break
+			}
+		}
+		if lent != *q.LentOut {
+			return false
+		}
+	}
+	if q.Reading != nil || q.Started != nil {
+		active, started := false, false
+		for _, h := range m.reading {
+			if h.BookID == b.ID {
+				started = true
+				active = active || reading.InProgress(*h)
+			}
+		}
+		if q.Reading != nil && active != *q.Reading {
+			return false
+		}
+		if q.Started != nil && started != *q.Started {
+			return false
+		}
+	}
+	if q.ShelfID != 0 {
+		shelf, ok := m.shelves[q.ShelfID]
+		if !ok || !slices.Contains(shelf.bookIDs, b.ID) {
+			return false
+		}
+	}
+	if q.Genre != "" && !slices.ContainsFunc(b.Genres, func(genre string) bool { return strings.EqualFold(genre, q.Genre) }) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !m.hasTag(b, tag) {
+			return false
+		}
+	}
+	if q.Author != "" && !strings.Contains(strings.ToLower(b.Author), strings.ToLower(q.Author)) {
+		return false
+	}
+	if q.AuthorID != 0 && !slices.ContainsFunc(b.Authors, func(a models.BookAuthor) bool { return a.ID == q.AuthorID }) {
+		return false
+	}
+	if !q.AddedFrom.IsZero() && (b.CreatedAt == nil || b.CreatedAt.Before(q.AddedFrom)) {
+		return false
+	}
+	if !q.AddedTo.IsZero() && (b.CreatedAt == nil || !b.CreatedAt.Before(q.AddedTo)) {
+		return false
+	}
+	if !q.FinishedFrom.IsZero() || !q.FinishedTo.IsZero() {
+		finished := false
+		for _, h := range m.reading {
+			if h.BookID != b.ID || h.CompletedAt == nil {
+				continue
+			}
+			if !q.FinishedFrom.IsZero() && h.CompletedAt.Before(q.FinishedFrom) {
+				continue
+			}
+			if !q.FinishedTo.IsZero() && !h.CompletedAt.Before(q.FinishedTo) {
+				continue
+			}
+			finished = true
+			break
+		}
+		if !finished {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKey returns the book's key for a BookQuery sort order.
+func sortKey(b *models.Book, sort string) string {
+	switch sort {
+	case SortTitle:
+		return strings.ToLower(b.Title)
+	case SortAuthor:
+		return strings.ToLower(b.Author)
+	}
+	if b.CreatedAt == nil {
+		return ""
+	}
+	return b.CreatedAt.UTC().Format(time.RFC3339Nano)
+}
+
+// searchFields lists the searchable fields of a book with their weights,
+// mirroring the SQL backends' ranking.
+func searchFields(b *models.Book) []struct {
+	text   string
+	weight float64
+} {
+	return []struct {
+		text   string
+		weight float64
+	}{{b.Title, 10}, {b.Author, 5}, {b.Genre, 2}, {b.Notes, 1}}
+}
+
+// searchBook scores a book against search terms, returning false unless
+// every term prefixes a word in one of its fields. Lower scores are better.
+// The snippet is the best matching field with matching words marked.
+func searchBook(b *models.Book, terms []string) (float64, string, bool) {
+	score := 0.0
+	bestWeight := 0.0
+	snippet := ""
+	for _, term := range terms {
+		found := false
+		for _, field := range searchFields(b) {
+			for _, word := range searchTerms(field.text) {
+				if strings.HasPrefix(word, term) {
+					found = true
+					score -= field.weight
+					if field.weight > bestWeight {
+						bestWeight = field.weight
+						snippet = markTerms(field.text, terms)
+					}
+				}
+			}
+		}
+		if !found {
+			return 0, "", false
+		}
+	}
+	return score, snippet, true
+}
+
+// markTerms HTML-escapes text and wraps its words that start with one of
+// terms in <mark> tags.
+func markTerms(text string, terms []string) string {
+	var b strings.Builder
+	word := []rune{}
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		lower := strings.ToLower(w)
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				w = "<mark>" + w + "</mark>"
+				break
+			}
+		}
+		b.WriteString(w)
+		word = word[:0]
+	}
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		// Words are letters and digits, so only what lies between them
+		// needs escaping
+		flush()
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush()
+	return b.String()
+}
+
+func (s *memoryBookStore) Query(ctx context.Context, userID int, q BookQuery) (*BookPage, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	search := q.Search != ""
+	terms := searchTerms(q.Search)
+	if q.Sort == SortRank && !search {
+		return nil, errors.New("rank order requires a search")
+	}
+	if search && len(terms) == 0 {
+		return &BookPage{Books: []models.Book{}, Snippets: map[int]string{}}, nil
+	}
+
+	var matched []models.Book
+	keys := make(map[int]string)
+	snippets := make(map[int]string)
+	for _, id := range sortedIDs(s.m.books) {
+		b := s.m.books[id]
+		if b.UserID != userID || !s.m.matches(b, q) {
+			continue
+		}
+		if search {
+			score, snippet, ok := searchBook(&b.Book, terms)
+			if !ok {
+				continue
+			}
+			snippets[id] = snippet
+			keys[id] = strconv.FormatFloat(score, 'g', -1, 64)
+		}
+		matched = append(matched, s.m.copyBook(b))
+	}
+
+	key := func(b *models.Book) string {
+		if q.Sort == SortRank {
+			return keys[b.ID]
+		}
+		return sortKey(b, q.Sort)
+	}
+	// before reports whether a sorts ahead of b in the requested order
+	before := func(keyA string, idA int, keyB string, idB int) bool {
+		if keyA != keyB {
+			if q.Sort == SortRank {
+				a, _ := strconv.ParseFloat(keyA, 64)
+				b, _ := strconv.ParseFloat(keyB, 64)
+				return (a < b) != q.Desc
+			}
+			return (keyA < keyB) != q.Desc
+		}
+		return idA != idB && (idA < idB) != q.Desc
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return before(key(&matched[i]), matched[i].ID, key(&matched[j]), matched[j].ID)
+	})
+
+	page := &BookPage{Books: []models.Book{}, Total: len(matched)}
+	if search {
+		page.Snippets = make(map[int]string)
+	}
+	for _, book := range matched {
+		if q.After != nil && !before(q.After.Key, q.After.ID, key(&book), book.ID) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Books) == q.Limit {
+			last := page.Books[len(page.Books)-1]
+			page.Next = &BookCursor{Key: key(&last), ID: last.ID}
+			break
+		}
+		page.Books = append(page.Books, book)
+		if search {
+			page.Snippets[book.ID] = snippets[book.ID]
+		}
+	}
+	return page, nil
+}
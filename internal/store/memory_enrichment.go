@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type memoryEnrichmentStore struct {
+	m *memory
+}
+
+// memoryProposal is an enrichment_proposals row.
+type memoryProposal struct {
+	models.EnrichmentProposal
+	UserID int
+}
+
+// proposal returns a copy of the row with its book. Callers must hold the
+// lock.
+func (m *memory) proposal(p *memoryProposal) models.EnrichmentProposal {
+	proposal := p.EnrichmentProposal
+	if b, ok := m.books[p.BookID]; ok {
+		book := m.copyBook(b)
+		proposal.Book = &book
+	}
+	return proposal
+}
+
+func (s *memoryEnrichmentStore) List(ctx context.Context, userID int, status string) ([]models.EnrichmentProposal, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	proposals := []models.EnrichmentProposal{}
+	for _, id := range sortedIDs(s.m.proposals) {
+		p := s.m.proposals[id]
+		if p.UserID == userID && (status == "" || p.Status == status) {
+			proposals = append(proposals, s.m.proposal(p))
+		}
+	}
+	return proposals, nil
+}
+
+func (s *memoryEnrichmentStore) Get(ctx context.Context, userID, proposalID int) (*models.EnrichmentProposal, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	p, ok := s.m.proposals[proposalID]
+	if !ok || p.UserID != userID {
+		return nil, ErrNotFound
+	}
+	proposal := s.m.proposal(p)
+	return &proposal, nil
+}
+
+func (s *memoryEnrichmentStore) Create(ctx context.Context, userID int, proposal *models.EnrichmentProposal) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.books[proposal.BookID]; !ok {
+		return ErrNotFound
+	}
+	for _, p := range s.m.proposals {
+		if p.BookID == proposal.BookID {
+			return ErrConflict
+		}
+	}
+	if proposal.Status == "" {
+		proposal.Status = models.ProposalPending
+	}
+	proposal.ID = s.m.id("enrichment_proposals")
+	proposal.CreatedAt = timePtr(time.Now().UTC())
+
+	row := &memoryProposal{EnrichmentProposal: *proposal, UserID: userID}
+	row.Book = nil
+	s.m.proposals[proposal.ID] = row
+	return nil
+}
+
+func (s *memoryEnrichmentStore) SetStatus(ctx context.Context, userID, proposalID int, status string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.proposals[proposalID]
+	if !ok || p.UserID != userID {
+		return ErrNotFound
+	}
+	p.Status = status
+	return nil
+}
+
+func (s *memoryEnrichmentStore) Delete(ctx context.Context, userID, proposalID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	p, ok := s.m.proposals[proposalID]
+	if !ok || p.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.m.proposals, proposalID)
+	return nil
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"booklib/internal/authors"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+	"booklib/internal/tags"
+)
+
+type memoryExportStore struct {
+	m *memory
+}
+
+// Export copies the user's data under the read lock and reads the copy, so
+// a slow reader doesn't hold up writers.
+func (s *memoryExportStore) Export(ctx context.Context, userID int, fn func(ExportReader) error) error {
+	return fn(NewExportReader(s.snapshot(userID)))
+}
+
+func (s *memoryExportStore) snapshot(userID int) *models.Export {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	archive := &models.Export{
+		Books:           []models.Book{},
+		Lending:         []models.Lending{},
+		ReadingHistory:  []models.ReadingHistory{},
+		StatusChanges:   []models.StatusChange{},
+		ReadingProgress: []models.ReadingProgress{},
+		Reviews:         []models.Review{},
+		Notes:           []models.Note{},
+		Shelves:         []models.ExportShelf{},
+		SmartShelves:    []models.ExportSmartShelf{},
+	}
+	for _, id := range sortedIDs(s.m.books) {
+		if b := s.m.books[id]; b.UserID == userID {
+			archive.Books = append(archive.Books, s.m.copyBook(b))
+		}
+	}
+	for _, id := range sortedIDs(s.m.lending) {
+		if l := s.m.lending[id]; l.UserID == userID {
+			archive.Lending = append(archive.Lending, *l)
+		}
+	}
+	for _, id := range sortedIDs(s.m.reading) {
+		if h := s.m.reading[id]; h.UserID == userID {
+			archive.ReadingHistory = append(archive.ReadingHistory, *h)
+			archive.ReadingProgress = append(archive.ReadingProgress, s.m.sessionProgress(id)...)
+			if review := s.m.sessionReview(id); review != nil {
+				archive.Reviews = append(archive.Reviews, *s.m.copyReview(review))
+			}
+		}
+	}
+	for _, id := range sortedIDs(s.m.statusChanges) {
+		if c := s.m.statusChanges[id]; s.m.books[c.BookID] != nil && s.m.books[c.BookID].UserID == userID {
+			archive.StatusChanges = append(archive.StatusChanges, *c)
+		}
+	}
+	sort.SliceStable(archive.StatusChanges, func(i, j int) bool {
+		return archive.StatusChanges[i].ChangedAt.Before(archive.StatusChanges[j].ChangedAt)
+	})
+	for _, id := range sortedIDs(s.m.notes) {
+		if n := s.m.notes[id]; n.UserID == userID {
+			archive.Notes = append(archive.Notes, copyNote(n))
+		}
+	}
+	for _, sh := range s.m.userShelves(userID) {
+		archive.Shelves = append(archive.Shelves, models.ExportShelf{
+			ID:          sh.ID,
+			Name:        sh.Name,
+			Description: sh.Description,
+			BookIDs:     append([]int{}, sh.bookIDs...),
+		})
+	}
+	for _, id := range sortedIDs(s.m.smartShelves) {
+		if sh := s.m.smartShelves[id]; sh.UserID == userID {
+			archive.SmartShelves = append(archive.SmartShelves, models.ExportSmartShelf{
+				ID:          sh.ID,
+				Name:        sh.Name,
+				Description: sh.Description,
+				Rules:       models.ShelfRules{Match: sh.Rules.Match, Rules: slices.Clone(sh.Rules.Rules)},
+			})
+		}
+	}
+	if settings, ok := s.m.userSettings[userID]; ok {
+		copied := *settings
+		archive.UserSettings = &copied
+	}
+	return archive
+}
+
+func (s *memoryExportStore) Restore(ctx context.Context, userID int, archive *models.Export, replace bool) (*models.RestoreResult, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if replace {
+		for id, b := range s.m.books {
+			if b.UserID == userID {
+				s.m.deleteBook(id)
+			}
+		}
+		for id, sh := range s.m.shelves {
+			if sh.UserID == userID {
+				delete(s.m.shelves, id)
+			}
+		}
+		for id, sh := range s.m.smartShelves {
+			if sh.UserID == userID {
+				delete(s.m.smartShelves, id)
+			}
+		}
+	}
+
+	owned := make(map[string]bool)
+	for _, b := range s.m.books {
+		if b.UserID != userID {
+			continue
+		}
+		if b.ISBN != "" {
+			owned[b.ISBN] = true
+		}
+		owned[bookKey(b.Title, b.Author)] = true
+	}
+
+	// Work out which books are new before writing anything, so a conflict
+	// leaves the store untouched like a rolled back transaction
+	var books []models.Book
+	skipped := 0
+	for _, book := range archive.Books {
+		// Credits and tags are normalized when written, but a bad role or
+		// tag must fail the restore before anything is
+		check := book
+		if err := authors.Normalize(&check); err != nil {
+			return nil, err
+		}
+		if err := tags.Normalize(&check); err != nil {
+			return nil, err
+		}
+		key := book.ISBN
+		if key == "" {
+			key = bookKey(book.Title, book.Author)
+		}
+		if owned[key] {
+			skipped++
+			continue
+		}
+		owned[key] = true
+		books = append(books, book)
+	}
+
+	restoredShelves := make([]models.Shelf, len(archive.Shelves))
+	for i, shelf := range archive.Shelves {
+		restoredShelves[i] = models.Shelf{Name: shelf.Name, Description: shelf.Description}
+		if err := shelves.Validate(&restoredShelves[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	restoredSmart := make([]models.SmartShelf, len(archive.SmartShelves))
+	for i, shelf := range archive.SmartShelves {
+		restoredSmart[i] = models.SmartShelf{Name: shelf.Name, Description: shelf.Description, Rules: shelf.Rules}
+		if err := shelves.ValidateSmart(&restoredSmart[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &models.RestoreResult{BooksSkipped: skipped}
+	now := time.Now()
+	bookIDs := make(map[int]int)
+	sessions := sessionsByBook(archive)
+	for _, book := range books {
+		restored := book
+		restored.ID = s.m.id("books")
+		reading.Settle(&restored, sessions[book.ID])
+		tags.Normalize(&restored)
+		s.m.credit(&restored)
+		if restored.CreatedAt == nil {
+			restored.CreatedAt = timePtr(now)
+		}
+		s.m.insertBook(userID, &restored)
+		bookIDs[book.ID] = restored.ID
+		result.BooksCreated++
+	}
+
+	for _, l := range archive.Lending {
+		bookID, ok := bookIDs[l.BookID]
+		if !ok {
+			continue
+		}
+		restored := l
+		restored.ID = s.m.id("lending")
+		restored.BookID = bookID
+		restored.UserID = userID
+		s.m.lending[restored.ID] = &restored
+		result.LendingCreated++
+	}
+
+	sessionIDs := make(map[int]int)
+	for _, h := range archive.ReadingHistory {
+		bookID, ok := bookIDs[h.BookID]
+		if !ok {
+			continue
+		}
+		restored := h
+		restored.ID = s.m.id("reading_history")
+		restored.BookID = bookID
+		restored.UserID = userID
+		s.m.reading[restored.ID] = &restored
+		sessionIDs[h.ID] = restored.ID
+		result.ReadingHistoryCreated++
+	}
+
+	for _, c := range archive.StatusChanges {
+		bookID, ok := bookIDs[c.BookID]
+		if !ok {
+			continue
+		}
+		restored := c
+		restored.ID = s.m.id("reading_status_changes")
+		restored.BookID = bookID
+		restored.Session = nil
+		s.m.statusChanges[restored.ID] = &restored
+		result.StatusChangesCreated++
+	}
+
+	for _, p := range archive.ReadingProgress {
+		sessionID, ok := sessionIDs[p.SessionID]
+		if !ok {
+			continue
+		}
+		restored := p
+		restored.ID = s.m.id("reading_progress")
+		restored.SessionID = sessionID
+		s.m.progress[restored.ID] = &restored
+		result.ReadingProgressCreated++
+	}
+
+	for _, review := range archive.Reviews {
+		sessionID, ok := sessionIDs[review.SessionID]
+		if !ok {
+			continue
+		}
+		restored := review
+		restored.ID = s.m.id("reviews")
+		restored.SessionID = sessionID
+		restored.Edits = nil
+		s.m.reviews[restored.ID] = &restored
+		for _, edit := range review.Edits {
+			edit.ID = s.m.id("review_edits")
+			edit.ReviewID = restored.ID
+			s.m.reviewEdits[edit.ID] = &edit
+		}
+		result.ReviewsCreated++
+	}
+
+	for _, note := range archive.Notes {
+		if !restoreNote(&note, bookIDs, sessionIDs) {
+			continue
+		}
+		s.m.insertNote(userID, &note, now)
+		if note.ID != 0 {
+			result.NotesCreated++
+		}
+	}
+
+	for i, shelf := range archive.Shelves {
+		var sh *memoryShelf
+		if id := s.m.findShelf(userID, restoredShelves[i].Name); id != 0 {
+			sh = s.m.shelves[id]
+		} else {
+			sh = s.m.createShelf(userID, &restoredShelves[i])
+			result.ShelvesCreated++
+		}
+		for _, archiveID := range shelf.BookIDs {
+			if bookID, ok := bookIDs[archiveID]; ok && !slices.Contains(sh.bookIDs, bookID) {
+				sh.bookIDs = append(sh.bookIDs, bookID)
+			}
+		}
+	}
+
+	for i := range restoredSmart {
+		if s.m.findSmartShelf(userID, restoredSmart[i].Name) == 0 {
+			s.m.createSmartShelf(userID, &restoredSmart[i])
+			result.SmartShelvesCreated++
+		}
+	}
+
+	if archive.UserSettings != nil {
+		settings := *archive.UserSettings
+		settings.UserID = userID
+		settings.UpdatedAt = now
+		if existing, ok := s.m.userSettings[userID]; ok {
+			settings.CreatedAt = existing.CreatedAt
+		} else {
+			settings.CreatedAt = now
+		}
+		s.m.userSettings[userID] = &settings
+		result.UserSettingsRestored = true
+	}
+
+	return result, nil
+}
@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type memoryLendingStore struct {
+	m *memory
+}
+
+// withBook joins a lending to its book. Callers must hold the lock.
+func (m *memory) withBook(l *models.Lending) models.LendingWithBook {
+	lending := models.LendingWithBook{
+		ID:      l.ID,
+		BookID:  l.BookID,
+		UserID:  l.UserID,
+		LentTo:  l.LentTo,
+		LentAt:  l.LentAt,
+		DueDate: l.DueDate,
+	}
+	if b, ok := m.books[l.BookID]; ok {
+		book := b.Book
+		book.CreatedAt = nil
+		lending.Book = &book
+	}
+	return lending
+}
+
+// sortByLentAtDesc orders lendings newest first.
+func sortByLentAtDesc(lendings []models.LendingWithBook) {
+	sort.SliceStable(lendings, func(i, j int) bool {
+		return lendings[i].LentAt.After(lendings[j].LentAt)
+	})
+}
+
+func (s *memoryLendingStore) ListActive(ctx context.Context, userID int) ([]models.LendingWithBook, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	lendings := []models.LendingWithBook{}
+	for _, id := range sortedIDs(s.m.lending) {
+		l := s.m.lending[id]
+		if l.UserID == userID && l.ReturnedAt == nil {
+			lendings = append(lendings, s.m.withBook(l))
+		}
+	}
+	sortByLentAtDesc(lendings)
+	return lendings, nil
+}
+
+func (s *memoryLendingStore) ListHistory(ctx context.Context, userID, bookID int) ([]models.LendingWithBook, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	history := []models.LendingWithBook{}
+	for _, id := range sortedIDs(s.m.lending) {
+		l := s.m.lending[id]
+		if l.UserID == userID && (bookID == 0 || l.BookID == bookID) {
+			history = append(history, s.m.withBook(l))
+		}
+	}
+	sortByLentAtDesc(history)
+	return history, nil
+}
+
+func (s *memoryLendingStore) ActiveForBook(ctx context.Context, bookID int) (int, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	for _, id := range sortedIDs(s.m.lending) {
+		if l := s.m.lending[id]; l.BookID == bookID && l.ReturnedAt == nil {
+			return id, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (s *memoryLendingStore) GetActive(ctx context.Context, lendingID int) (*models.Lending, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	l, ok := s.m.lending[lendingID]
+	if !ok || l.ReturnedAt != nil {
+		return nil, ErrNotFound
+	}
+	lending := *l
+	return &lending, nil
+}
+
+func (s *memoryLendingStore) Create(ctx context.Context, lending *models.Lending) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	lending.ID = s.m.id("lending")
+	lending.LentAt = time.Now()
+	stored := *lending
+	s.m.lending[lending.ID] = &stored
+	return nil
+}
+
+func (s *memoryLendingStore) MarkReturned(ctx context.Context, lendingID int, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	l, ok := s.m.lending[lendingID]
+	if !ok || l.ReturnedAt != nil {
+		return ErrNotFound
+	}
+	l.ReturnedAt = timePtr(at)
+	return nil
+}
+
+// reminders returns unreturned lendings with a due date matching dueMatch
+// whose owners have not been reminded since remindedBefore and whose
+// settings pass wants. Callers must hold the lock.
+func (m *memory) reminders(remindedBefore time.Time, dueMatch func(time.Time) bool, wants func(*models.UserSettings) bool) []models.ReminderLending {
+	lendings := []models.ReminderLending{}
+	for _, id := range sortedIDs(m.lending) {
+		l := m.lending[id]
+		if l.ReturnedAt != nil || l.DueDate == nil || !dueMatch(*l.DueDate) {
+			continue
+		}
+		if l.LastReminderSent != nil && !l.LastReminderSent.Before(remindedBefore) {
+			continue
+		}
+		if settings, ok := m.userSettings[l.UserID]; ok && (!settings.EmailRemindersEnabled || !wants(settings)) {
+			continue
+		}
+		user, ok := m.users[l.UserID]
+		if !ok {
+			continue
+		}
+		book, ok := m.books[l.BookID]
+		if !ok {
+			continue
+		}
+		lendings = append(lendings, models.ReminderLending{
+			LendingID:        l.ID,
+			UserID:           l.UserID,
+			UserEmail:        user.Email,
+			BookTitle:        book.Title,
+			BookAuthor:       book.Author,
+			LentTo:           l.LentTo,
+			DueDate:          *l.DueDate,
+			LentAt:           l.LentAt,
+			LastReminderSent: l.LastReminderSent,
+		})
+	}
+	return lendings
+}
+
+func (s *memoryLendingStore) ListUpcomingReminders(ctx context.Context, dueFrom, dueTo, remindedBefore time.Time) ([]models.ReminderLending, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	return s.m.reminders(remindedBefore,
+		func(due time.Time) bool { return !due.Before(dueFrom) && due.Before(dueTo) },
+		func(settings *models.UserSettings) bool { return settings.EmailUpcomingReminders },
+	), nil
+}
+
+func (s *memoryLendingStore) ListOverdueReminders(ctx context.Context, dueBefore, remindedBefore time.Time) ([]models.ReminderLending, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	lendings := s.m.reminders(remindedBefore,
+		func(due time.Time) bool { return due.Before(dueBefore) },
+		func(settings *models.UserSettings) bool { return settings.EmailOverdueReminders },
+	)
+	sort.SliceStable(lendings, func(i, j int) bool {
+		if lendings[i].UserID != lendings[j].UserID {
+			return lendings[i].UserID < lendings[j].UserID
+		}
+		return lendings[i].DueDate.Before(lendings[j].DueDate)
+	})
+	return lendings, nil
+}
+
+func (s *memoryLendingStore) MarkReminderSent(ctx context.Context, lendingID int, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if l, ok := s.m.lending[lendingID]; ok {
+		l.LastReminderSent = timePtr(at)
+	}
+	return nil
+}
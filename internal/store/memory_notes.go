@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type memoryNoteStore struct {
+	m *memory
+}
+
+// memoryNote is a notes row: the API model plus its owner.
+type memoryNote struct {
+	models.Note
+	UserID int
+}
+
+// copyNote returns the note with its own copies of its pointer fields.
+func copyNote(n *memoryNote) models.Note {
+	note := n.Note
+	if n.SessionID != nil {
+		note.SessionID = intPtr(*n.SessionID)
+	}
+	if n.Page != nil {
+		note.Page = intPtr(*n.Page)
+	}
+	if n.Location != nil {
+		note.Location = intPtr(*n.Location)
+	}
+	if n.ImportKey != nil {
+		key := *n.ImportKey
+		note.ImportKey = &key
+	}
+	return note
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// sortNotes orders notes by page, then by location, those without one
+// last, then oldest first.
+func sortNotes(list []models.Note) {
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if less, ok := comparePositions(a.Page, b.Page); ok {
+			return less
+		}
+		if less, ok := comparePositions(a.Location, b.Location); ok {
+			return less
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+}
+
+// comparePositions orders two optional positions, missing ones last. It
+// returns false when they are equal.
+func comparePositions(a, b *int) (less, ok bool) {
+	if (a == nil) != (b == nil) {
+		return a != nil, true
+	}
+	if a != nil && *a != *b {
+		return *a < *b, true
+	}
+	return false, false
+}
+
+func (s *memoryNoteStore) ListForBook(ctx context.Context, userID, bookID int) ([]models.Note, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	list := []models.Note{}
+	for _, id := range sortedIDs(s.m.notes) {
+		if n := s.m.notes[id]; n.UserID == userID && n.BookID == bookID {
+			list = append(list, copyNote(n))
+		}
+	}
+	sortNotes(list)
+	return list, nil
+}
+
+func (s *memoryNoteStore) Get(ctx context.Context, userID, noteID int) (*models.Note, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	n, ok := s.m.notes[noteID]
+	if !ok || n.UserID != userID {
+		return nil, ErrNotFound
+	}
+	note := copyNote(n)
+	return &note, nil
+}
+
+// checkNote checks that the note's book is the user's and its session, if
+// any, one of the book's. Callers must hold the lock.
+func (m *memory) checkNote(userID int, note *models.Note) error {
+	if b, ok := m.books[note.BookID]; !ok || b.UserID != userID {
+		return ErrNotFound
+	}
+	if note.SessionID != nil {
+		h, ok := m.reading[*note.SessionID]
+		if !ok || h.UserID != userID || h.BookID != note.BookID {
+			return ErrNotFound
+		}
+	}
+	return nil
+}
+
+// insertNote stores a note checked to be the user's, stamped at unless it
+// has its own times. A note whose import key the user already has is
+// skipped, leaving its ID zero. Callers must hold the write lock.
+func (m *memory) insertNote(userID int, note *models.Note, at time.Time) {
+	if note.ImportKey != nil && m.importKeys(userID)[*note.ImportKey] {
+		note.ID = 0
+		return
+	}
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = at
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = note.CreatedAt
+	}
+	note.ID = m.id("notes")
+	stored := &memoryNote{Note: *note, UserID: userID}
+	m.notes[note.ID] = stored
+	stored.Note = copyNote(stored)
+}
+
+func (s *memoryNoteStore) Create(ctx context.Context, userID int, note *models.Note, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if err := s.m.checkNote(userID, note); err != nil {
+		return err
+	}
+	s.m.insertNote(userID, note, at)
+	return nil
+}
+
+func (s *memoryNoteStore) Update(ctx context.Context, userID int, note *models.Note, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	n, ok := s.m.notes[note.ID]
+	if !ok || n.UserID != userID {
+		return ErrNotFound
+	}
+	note.BookID = n.BookID
+	if err := s.m.checkNote(userID, note); err != nil {
+		return err
+	}
+	n.SessionID = note.SessionID
+	n.Type = note.Type
+	n.Page = note.Page
+	n.Location = note.Location
+	n.Body = note.Body
+	n.UpdatedAt = at
+	n.Note = copyNote(n)
+	*note = copyNote(n)
+	return nil
+}
+
+func (s *memoryNoteStore) Delete(ctx context.Context, userID, noteID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	n, ok := s.m.notes[noteID]
+	if !ok || n.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.m.notes, noteID)
+	return nil
+}
+
+// importKeys returns the import keys of the user's notes. Callers must hold
+// the lock.
+func (m *memory) importKeys(userID int) map[string]bool {
+	keys := make(map[string]bool)
+	for _, n := range m.notes {
+		if n.UserID == userID && n.ImportKey != nil {
+			keys[*n.ImportKey] = true
+		}
+	}
+	return keys
+}
+
+func (s *memoryNoteStore) ImportKeys(ctx context.Context, userID int) (map[string]bool, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	return s.m.importKeys(userID), nil
+}
+
+func (s *memoryNoteStore) Import(ctx context.Context, userID int, list []*models.Note, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, note := range list {
+		if err := s.m.checkNote(userID, note); err != nil {
+			return err
+		}
+	}
+	for _, note := range list {
+		s.m.insertNote(userID, note, at)
+	}
+	return nil
+}
+
+func (s *memoryNoteStore) Search(ctx context.Context, userID int, q NoteQuery) ([]models.NoteMatch, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	matches := []models.NoteMatch{}
+	terms := searchTerms(q.Search)
+	if len(terms) == 0 {
+		return matches, nil
+	}
+
+	scores := make(map[int]float64)
+	for _, id := range sortedIDs(s.m.notes) {
+		n := s.m.notes[id]
+		if n.UserID != userID || (q.BookID != 0 && n.BookID != q.BookID) || (q.Type != "" && n.Type != q.Type) {
+			continue
+		}
+		score, ok := searchNote(n.Body, terms)
+		if !ok {
+			continue
+		}
+		scores[id] = score
+		matches = append(matches, models.NoteMatch{
+			Note:      copyNote(n),
+			BookTitle: s.m.books[n.BookID].Title,
+			Snippet:   markTerms(n.Body, terms),
+		})
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return scores[matches[i].ID] < scores[matches[j].ID]
+	})
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches, nil
+}
+
+// searchNote scores a note's body against search terms like searchBook,
+// returning false unless every term prefixes one of its words.
+func searchNote(body string, terms []string) (float64, bool) {
+	words := searchTerms(body)
+	score := 0.0
+	for _, term := range terms {
+		found := false
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				found = true
+				score--
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return score, true
+}
@@ -0,0 +1,382 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/reading"
+)
+
+type memoryReadingStore struct {
+	m *memory
+}
+
+func (s *memoryReadingStore) Get(ctx context.Context, historyID int) (*models.ReadingHistory, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	h, ok := s.m.reading[historyID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	history := *h
+	return &history, nil
+}
+
+// readingForBook returns the user's sessions for a book, newest first.
+// Callers must hold the lock.
+func (m *memory) readingForBook(userID, bookID int) []models.ReadingHistory {
+	history := []models.ReadingHistory{}
+	for _, id := range sortedIDs(m.reading) {
+		if h := m.reading[id]; h.UserID == userID && h.BookID == bookID {
+			history = append(history, *h)
+		}
+	}
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].StartedAt.After(history[j].StartedAt)
+	})
+	return history
+}
+
+// activeSession returns the user's latest session in progress for the
+// book, or nil. Callers must hold the lock.
+func (m *memory) activeSession(userID, bookID int) *models.ReadingHistory {
+	var active *models.ReadingHistory
+	for _, h := range m.reading {
+		if h.UserID == userID && h.BookID == bookID && reading.InProgress(*h) {
+			if active == nil || h.StartedAt.After(active.StartedAt) {
+				active = h
+			}
+		}
+	}
+	return active
+}
+
+func (s *memoryReadingStore) ListForBook(ctx context.Context, userID, bookID int) ([]models.ReadingHistory, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	return s.m.readingForBook(userID, bookID), nil
+}
+
+func (s *memoryReadingStore) Active(ctx context.Context, userID, bookID int) (*models.ReadingHistory, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	h := s.m.activeSession(userID, bookID)
+	if h == nil {
+		return nil, ErrNotFound
+	}
+	active := *h
+	return &active, nil
+}
+
+func (s *memoryReadingStore) Start(ctx context.Context, userID, bookID int, at time.Time) (*models.ReadingHistory, error) {
+	change, err := s.SetStatus(ctx, userID, bookID, reading.Reading, at)
+	if err != nil {
+		return nil, err
+	}
+	return change.Session, nil
+}
+
+func (s *memoryReadingStore) Finish(ctx context.Context, historyID int, review *models.Review, at time.Time) (*models.ReadingHistory, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	h, ok := s.m.reading[historyID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	change, err := s.m.setStatus(h.UserID, h.BookID, reading.Finished, at)
+	if err != nil {
+		return nil, err
+	}
+	if review != nil {
+		review.SessionID = h.ID
+		s.m.saveReview(review, at)
+	}
+	return change.Session, nil
+}
+
+func (s *memoryReadingStore) SetStatus(ctx context.Context, userID, bookID int, status string, at time.Time) (*models.StatusChange, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	return s.m.setStatus(userID, bookID, status, at)
+}
+
+// setStatus moves the book to status, see ReadingStore.SetStatus. Callers
+// must hold the write lock.
+func (m *memory) setStatus(userID, bookID int, status string, at time.Time) (*models.StatusChange, error) {
+	b, ok := m.books[bookID]
+	if !ok || b.UserID != userID {
+		return nil, ErrNotFound
+	}
+	if !reading.CanMove(b.Status, status) {
+		return nil, reading.ErrInvalidTransition
+	}
+
+	active := m.activeSession(userID, bookID)
+	switch {
+	case status == reading.Reading && b.Status != reading.Paused:
+		active = &models.ReadingHistory{ID: m.id("reading_history"), BookID: bookID, UserID: userID, StartedAt: at}
+		m.reading[active.ID] = active
+	case active != nil && status == reading.Finished:
+		active.CompletedAt = timePtr(at)
+	case active != nil && status == reading.DidNotFinish:
+		active.AbandonedAt = timePtr(at)
+	case status == reading.WantToRead:
+		active = nil
+	}
+
+	moved := *m.recordStatus(b, status, at)
+	m.refreshRead(b)
+	if active != nil {
+		session := *active
+		moved.Session = &session
+	}
+	return &moved, nil
+}
+
+// recordStatus moves the book to status and records the change. Callers
+// refresh the read flag once its sessions are settled, and must hold the
+// write lock.
+func (m *memory) recordStatus(b *memoryBook, status string, at time.Time) *models.StatusChange {
+	change := &models.StatusChange{ID: m.id("reading_status_changes"), BookID: b.ID, From: b.Status, To: status, ChangedAt: at}
+	m.statusChanges[change.ID] = change
+	b.Status = status
+	b.StatusChangedAt = timePtr(at)
+	return change
+}
+
+// refreshRead sets the book's read flag from its status and sessions with
+// reading.Read. Callers must hold the write lock.
+func (m *memory) refreshRead(b *memoryBook) {
+	b.Read = reading.Read(b.Status, m.readingForBook(b.UserID, b.ID))
+}
+
+// settleSessions moves the book to the status derived from its sessions, if
+// that differs, and refreshes its read flag, returning both. The move is
+// stamped with when the sessions reached the status, or at if the book has
+// none left. Callers must hold the write lock.
+func (m *memory) settleSessions(b *memoryBook, at time.Time) models.ReadState {
+	derived, since := reading.Derive(b.Status, m.readingForBook(b.UserID, b.ID))
+	if since != nil {
+		at = *since
+	}
+	if derived != b.Status {
+		m.recordStatus(b, derived, at)
+	}
+	m.refreshRead(b)
+	return models.ReadState{Status: b.Status, Read: b.Read}
+}
+
+func (s *memoryReadingStore) LogSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	b, ok := s.m.books[session.BookID]
+	if !ok || b.UserID != userID {
+		return models.ReadState{}, ErrNotFound
+	}
+	if reading.Overlaps(*session, s.m.readingForBook(userID, b.ID)) {
+		return models.ReadState{}, reading.ErrOverlap
+	}
+	logged := &models.ReadingHistory{
+		ID:          s.m.id("reading_history"),
+		BookID:      b.ID,
+		UserID:      userID,
+		StartedAt:   session.StartedAt,
+		CompletedAt: session.CompletedAt,
+		AbandonedAt: session.AbandonedAt,
+	}
+	s.m.reading[logged.ID] = logged
+	*session = *logged
+	return s.m.settleSessions(b, at), nil
+}
+
+func (s *memoryReadingStore) EditSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	h, ok := s.m.reading[session.ID]
+	if !ok || h.UserID != userID {
+		return models.ReadState{}, ErrNotFound
+	}
+	session.BookID = h.BookID
+	if reading.Overlaps(*session, s.m.readingForBook(userID, h.BookID)) {
+		return models.ReadState{}, reading.ErrOverlap
+	}
+	h.StartedAt = session.StartedAt
+	h.CompletedAt = session.CompletedAt
+	h.AbandonedAt = session.AbandonedAt
+	*session = *h
+	return s.m.settleSessions(s.m.books[h.BookID], at), nil
+}
+
+func (s *memoryReadingStore) DeleteSession(ctx context.Context, userID, historyID int, at time.Time) (models.ReadState, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	h, ok := s.m.reading[historyID]
+	if !ok || h.UserID != userID {
+		return models.ReadState{}, ErrNotFound
+	}
+	s.m.deleteSession(historyID)
+	return s.m.settleSessions(s.m.books[h.BookID], at), nil
+}
+
+func (s *memoryReadingStore) StatusChanges(ctx context.Context, userID, bookID int) ([]models.StatusChange, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	changes := []models.StatusChange{}
+	b, ok := s.m.books[bookID]
+	if !ok || b.UserID != userID {
+		return changes, nil
+	}
+	for _, id := range sortedIDs(s.m.statusChanges) {
+		if c := s.m.statusChanges[id]; c.BookID == bookID {
+			changes = append(changes, *c)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].ChangedAt.Before(changes[j].ChangedAt)
+	})
+	return changes, nil
+}
+
+func (s *memoryReadingStore) AddProgress(ctx context.Context, userID int, progress *models.ReadingProgress) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if h, ok := s.m.reading[progress.SessionID]; !ok || h.UserID != userID {
+		return ErrNotFound
+	}
+	progress.ID = s.m.id("reading_progress")
+	stored := *progress
+	s.m.progress[stored.ID] = &stored
+	return nil
+}
+
+func (s *memoryReadingStore) Progress(ctx context.Context, historyID int) ([]models.ReadingProgress, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	return s.m.sessionProgress(historyID), nil
+}
+
+// sessionProgress returns the session's progress updates, oldest first.
+// Callers must hold the lock.
+func (m *memory) sessionProgress(historyID int) []models.ReadingProgress {
+	progress := []models.ReadingProgress{}
+	for _, id := range sortedIDs(m.progress) {
+		if p := m.progress[id]; p.SessionID == historyID {
+			progress = append(progress, *p)
+		}
+	}
+	sort.SliceStable(progress, func(i, j int) bool {
+		return progress[i].RecordedAt.Before(progress[j].RecordedAt)
+	})
+	return progress
+}
+
+// sessionReview returns the session's stored review, or nil. Callers must
+// hold the lock.
+func (m *memory) sessionReview(historyID int) *models.Review {
+	for _, review := range m.reviews {
+		if review.SessionID == historyID {
+			return review
+		}
+	}
+	return nil
+}
+
+// copyReview returns the review with its edits, oldest first. Callers must
+// hold the lock.
+func (m *memory) copyReview(review *models.Review) *models.Review {
+	copied := *review
+	copied.Edits = []models.ReviewEdit{}
+	for _, id := range sortedIDs(m.reviewEdits) {
+		if edit := m.reviewEdits[id]; edit.ReviewID == review.ID {
+			copied.Edits = append(copied.Edits, *edit)
+		}
+	}
+	sort.SliceStable(copied.Edits, func(i, j int) bool {
+		return copied.Edits[i].EditedAt.Before(copied.Edits[j].EditedAt)
+	})
+	return &copied
+}
+
+// deleteReview removes a review and its edits. Callers must hold the write
+// lock.
+func (m *memory) deleteReview(reviewID int) {
+	delete(m.reviews, reviewID)
+	for id, edit := range m.reviewEdits {
+		if edit.ReviewID == reviewID {
+			delete(m.reviewEdits, id)
+		}
+	}
+}
+
+func (s *memoryReadingStore) Review(ctx context.Context, historyID int) (*models.Review, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	review := s.m.sessionReview(historyID)
+	if review == nil {
+		return nil, ErrNotFound
+	}
+	return s.m.copyReview(review), nil
+}
+
+func (s *memoryReadingStore) SaveReview(ctx context.Context, userID int, review *models.Review, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if h, ok := s.m.reading[review.SessionID]; !ok || h.UserID != userID {
+		return ErrNotFound
+	}
+	s.m.saveReview(review, at)
+	return nil
+}
+
+// saveReview writes the review of its session, which callers have checked
+// is the user's, as SaveReview does. Callers must hold the write lock.
+func (m *memory) saveReview(review *models.Review, at time.Time) {
+	stored := m.sessionReview(review.SessionID)
+	if stored == nil {
+		stored = &models.Review{ID: m.id("reviews"), SessionID: review.SessionID, CreatedAt: at}
+		m.reviews[stored.ID] = stored
+	} else {
+		edit := &models.ReviewEdit{
+			ID:       m.id("review_edits"),
+			ReviewID: stored.ID,
+			Rating:   stored.Rating,
+			Body:     stored.Body,
+			Spoiler:  stored.Spoiler,
+			EditedAt: at,
+		}
+		m.reviewEdits[edit.ID] = edit
+	}
+	stored.Rating = review.Rating
+	stored.Body = review.Body
+	stored.Spoiler = review.Spoiler
+	stored.UpdatedAt = at
+
+	*review = *m.copyReview(stored)
+}
+
+func (s *memoryReadingStore) DeleteReview(ctx context.Context, historyID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	review := s.m.sessionReview(historyID)
+	if review == nil {
+		return ErrNotFound
+	}
+	s.m.deleteReview(review.ID)
+	return nil
+}
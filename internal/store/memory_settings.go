@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type memorySettingsStore struct {
+	m *memory
+}
+
+func (s *memorySettingsStore) GetUserSettings(ctx context.Context, userID int) (*models.UserSettings, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	stored, ok := s.m.userSettings[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	settings := *stored
+	return &settings, nil
+}
+
+func (s *memorySettingsStore) CreateUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.userSettings[settings.UserID]; ok {
+		return ErrConflict
+	}
+	stored := *settings
+	s.m.userSettings[settings.UserID] = &stored
+	return nil
+}
+
+func (s *memorySettingsStore) UpdateUserSettings(ctx context.Context, userID int, req models.UpdateUserSettingsRequest, at time.Time) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	settings, ok := s.m.userSettings[userID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	settings.UpdatedAt = at
+	if req.EmailRemindersEnabled != nil {
+		settings.EmailRemindersEnabled = *req.EmailRemindersEnabled
+	}
+	if req.EmailUpcomingReminders != nil {
+		settings.EmailUpcomingReminders = *req.EmailUpcomingReminders
+	}
+	if req.EmailOverdueReminders != nil {
+		settings.EmailOverdueReminders = *req.EmailOverdueReminders
+	}
+	if req.DefaultLendingDays != nil {
+		settings.DefaultLendingDays = *req.DefaultLendingDays
+	}
+	if req.YearlyReadingGoal != nil {
+		settings.YearlyReadingGoal = *req.YearlyReadingGoal
+	}
+	return nil
+}
+
+func (s *memorySettingsStore) GetAppSetting(ctx context.Context, key string) (string, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	value, ok := s.m.appSettings[key]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+func (s *memorySettingsStore) ListAppSettings(ctx context.Context) (map[string]string, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	settings := make(map[string]string, len(s.m.appSettings))
+	for key, value := range s.m.appSettings {
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+func (s *memorySettingsStore) SetAppSetting(ctx context.Context, key, value string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	s.m.appSettings[key] = value
+	return nil
+}
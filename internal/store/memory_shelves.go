@@ -0,0 +1,202 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/shelves"
+)
+
+// memoryShelf is a shelves row with its shelf_books in shelf order.
+// Shelf.BookCount is left zero; it is the length of bookIDs.
+type memoryShelf struct {
+	models.Shelf
+	UserID   int
+	position int
+	bookIDs  []int
+}
+
+// shelf returns a copy of the row with its book count.
+func (sh *memoryShelf) shelf() models.Shelf {
+	shelf := sh.Shelf
+	shelf.BookCount = len(sh.bookIDs)
+	return shelf
+}
+
+// userShelves returns the user's shelves in their order. Callers must hold
+// the lock.
+func (m *memory) userShelves(userID int) []*memoryShelf {
+	var list []*memoryShelf
+	for _, id := range sortedIDs(m.shelves) {
+		if sh := m.shelves[id]; sh.UserID == userID {
+			list = append(list, sh)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].position < list[j].position })
+	return list
+}
+
+// findShelf returns the ID of the user's shelf with the name, matched by
+// shelves.Key, or 0. Callers must hold the lock.
+func (m *memory) findShelf(userID int, name string) int {
+	key := shelves.Key(name)
+	for id, sh := range m.shelves {
+		if sh.UserID == userID && shelves.Key(sh.Name) == key {
+			return id
+		}
+	}
+	return 0
+}
+
+// createShelf inserts the shelf after the user's other shelves. Callers
+// must hold the write lock.
+func (m *memory) createShelf(userID int, shelf *models.Shelf) *memoryShelf {
+	position := 0
+	if list := m.userShelves(userID); len(list) > 0 {
+		position = list[len(list)-1].position + 1
+	}
+	shelf.ID = m.id("shelves")
+	shelf.CreatedAt = timePtr(time.Now())
+	row := &memoryShelf{Shelf: *shelf, UserID: userID, position: position}
+	m.shelves[shelf.ID] = row
+	return row
+}
+
+type memoryShelfStore struct {
+	m *memory
+}
+
+func (s *memoryShelfStore) List(ctx context.Context, userID int) ([]models.Shelf, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	list := []models.Shelf{}
+	for _, sh := range s.m.userShelves(userID) {
+		list = append(list, sh.shelf())
+	}
+	return list, nil
+}
+
+func (s *memoryShelfStore) Get(ctx context.Context, userID, shelfID int) (*models.ShelfDetail, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	sh, ok := s.m.shelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return nil, ErrNotFound
+	}
+	detail := &models.ShelfDetail{Shelf: sh.shelf(), Books: []models.Book{}}
+	for _, id := range sh.bookIDs {
+		detail.Books = append(detail.Books, s.m.copyBook(s.m.books[id]))
+	}
+	return detail, nil
+}
+
+func (s *memoryShelfStore) Create(ctx context.Context, userID int, shelf *models.Shelf) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.findShelf(userID, shelf.Name) != 0 {
+		return ErrConflict
+	}
+	s.m.createShelf(userID, shelf)
+	return nil
+}
+
+func (s *memoryShelfStore) Update(ctx context.Context, userID int, shelf *models.Shelf) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.shelves[shelf.ID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	if id := s.m.findShelf(userID, shelf.Name); id != 0 && id != shelf.ID {
+		return ErrConflict
+	}
+	sh.Name = shelf.Name
+	sh.Description = shelf.Description
+	shelf.CreatedAt = sh.CreatedAt
+	shelf.BookCount = len(sh.bookIDs)
+	return nil
+}
+
+func (s *memoryShelfStore) Delete(ctx context.Context, userID, shelfID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.shelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.m.shelves, shelfID)
+	return nil
+}
+
+func (s *memoryShelfStore) Reorder(ctx context.Context, userID int, shelfIDs []int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	var current []int
+	for _, sh := range s.m.userShelves(userID) {
+		current = append(current, sh.ID)
+	}
+	if !samePermutation(current, shelfIDs) {
+		return ErrConflict
+	}
+	for i, id := range shelfIDs {
+		s.m.shelves[id].position = i
+	}
+	return nil
+}
+
+func (s *memoryShelfStore) AddBook(ctx context.Context, userID, shelfID, bookID, position int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.shelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	if slices.Contains(sh.bookIDs, bookID) {
+		return ErrConflict
+	}
+	if b, ok := s.m.books[bookID]; !ok || b.UserID != userID {
+		return ErrNotFound
+	}
+	if position < 0 || position > len(sh.bookIDs) {
+		position = len(sh.bookIDs)
+	}
+	sh.bookIDs = slices.Insert(sh.bookIDs, position, bookID)
+	return nil
+}
+
+func (s *memoryShelfStore) RemoveBook(ctx context.Context, userID, shelfID, bookID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.shelves[shelfID]
+	if !ok || sh.UserID != userID || !slices.Contains(sh.bookIDs, bookID) {
+		return ErrNotFound
+	}
+	sh.bookIDs = slices.DeleteFunc(sh.bookIDs, func(id int) bool { return id == bookID })
+	return nil
+}
+
+func (s *memoryShelfStore) ReorderBooks(ctx context.Context, userID, shelfID int, bookIDs []int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.shelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	if !samePermutation(sh.bookIDs, bookIDs) {
+		return ErrConflict
+	}
+	sh.bookIDs = slices.Clone(bookIDs)
+	return nil
+}
@@ -0,0 +1,212 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+)
+
+// memorySmartShelf is a smart_shelves row: the API model plus its owner.
+type memorySmartShelf struct {
+	models.SmartShelf
+	UserID int
+}
+
+// matchesRules reports whether the book matches the rules, like
+// sqlDB.ruleFilter. Callers must hold the lock.
+func (m *memory) matchesRules(b *memoryBook, rules models.ShelfRules, now time.Time) bool {
+	for _, rule := range rules.Rules {
+		matched := m.matchesRule(b, rule, now)
+		if rules.Match == shelves.MatchAny && matched {
+			return true
+		}
+		if rules.Match != shelves.MatchAny && !matched {
+			return false
+		}
+	}
+	return rules.Match != shelves.MatchAny || len(rules.Rules) == 0
+}
+
+func (m *memory) matchesRule(b *memoryBook, rule models.ShelfRule, now time.Time) bool {
+	var matched bool
+	negate := rule.Op == "is_not" || rule.Op == "not_contains"
+	text := strings.ToLower(shelves.Text(rule))
+
+	switch rule.Field {
+	case "title", "author":
+		value := strings.ToLower(b.Title)
+		if rule.Field == "author" {
+			value = strings.ToLower(b.Author)
+		}
+		if rule.Op == "contains" || rule.Op == "not_contains" {
+			matched = strings.Contains(value, text)
+		} else {
+			matched = value == text
+		}
+	case "genre":
+		matched = slices.ContainsFunc(b.Genres, func(genre string) bool { return strings.ToLower(genre) == text })
+	case "tag":
+		matched = m.hasTag(b, text)
+	case "language":
+		matched = strings.ToLower(b.Language) == text
+	case "read":
+		matched = b.Read == shelves.Bool(rule)
+	case "status":
+		matched = b.Status == shelves.Text(rule)
+	case "lent_out":
+		for _, l := range m.lending {
+			matched = matched || (l.BookID == b.ID && l.ReturnedAt == nil)
+		}
+		negate = !shelves.Bool(rule)
+	case "reading", "started":
+		for _, h := range m.reading {
+			matched = matched || (h.BookID == b.ID && (rule.Field == "started" || reading.InProgress(*h)))
+		}
+		negate = !shelves.Bool(rule)
+	case "page_count":
+		n := shelves.Number(rule)
+		matched = map[string]bool{"is": b.PageCount == n, "gt": b.PageCount > n, "lt": b.PageCount < n}[rule.Op]
+	case "added":
+		matched = b.CreatedAt != nil && inRange(*b.CreatedAt, rule, now)
+	case "finished":
+		for _, h := range m.reading {
+			matched = matched || (h.BookID == b.ID && h.CompletedAt != nil && inRange(*h.CompletedAt, rule, now))
+		}
+	}
+	return matched != negate
+}
+
+// inRange reports whether t falls in the range of a date rule.
+func inRange(t time.Time, rule models.ShelfRule, now time.Time) bool {
+	from, to := shelves.Range(rule, now)
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// ruleBooks returns the user's books matching the rules, newest first.
+// Callers must hold the lock.
+func (m *memory) ruleBooks(userID int, rules models.ShelfRules, now time.Time) []models.Book {
+	books := []models.Book{}
+	for _, id := range sortedIDs(m.books) {
+		if b := m.books[id]; b.UserID == userID && m.matchesRules(b, rules, now) {
+			books = append(books, m.copyBook(b))
+		}
+	}
+	sort.Slice(books, func(i, j int) bool {
+		ki, kj := sortKey(&books[i], SortCreatedAt), sortKey(&books[j], SortCreatedAt)
+		if ki != kj {
+			return ki > kj
+		}
+		return books[i].ID > books[j].ID
+	})
+	return books
+}
+
+// findSmartShelf returns the ID of the user's smart shelf with the name,
+// matched by shelves.Key, or 0. Callers must hold the lock.
+func (m *memory) findSmartShelf(userID int, name string) int {
+	key := shelves.Key(name)
+	for id, sh := range m.smartShelves {
+		if sh.UserID == userID && shelves.Key(sh.Name) == key {
+			return id
+		}
+	}
+	return 0
+}
+
+// createSmartShelf inserts the smart shelf. Callers must hold the write
+// lock.
+func (m *memory) createSmartShelf(userID int, shelf *models.SmartShelf) {
+	shelf.ID = m.id("smart_shelves")
+	shelf.CreatedAt = timePtr(time.Now())
+	row := &memorySmartShelf{SmartShelf: *shelf, UserID: userID}
+	row.Rules.Rules = slices.Clone(shelf.Rules.Rules)
+	m.smartShelves[shelf.ID] = row
+}
+
+type memorySmartShelfStore struct {
+	m *memory
+}
+
+func (s *memorySmartShelfStore) List(ctx context.Context, userID int, now time.Time) ([]models.SmartShelf, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	list := []models.SmartShelf{}
+	for _, id := range sortedIDs(s.m.smartShelves) {
+		if sh := s.m.smartShelves[id]; sh.UserID == userID {
+			shelf := sh.SmartShelf
+			shelf.BookCount = len(s.m.ruleBooks(userID, shelf.Rules, now))
+			list = append(list, shelf)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return shelves.Key(list[i].Name) < shelves.Key(list[j].Name)
+	})
+	return list, nil
+}
+
+func (s *memorySmartShelfStore) Get(ctx context.Context, userID, shelfID int, now time.Time) (*models.SmartShelfDetail, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	sh, ok := s.m.smartShelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return nil, ErrNotFound
+	}
+	detail := &models.SmartShelfDetail{SmartShelf: sh.SmartShelf, Books: s.m.ruleBooks(userID, sh.Rules, now)}
+	detail.BookCount = len(detail.Books)
+	return detail, nil
+}
+
+func (s *memorySmartShelfStore) Books(ctx context.Context, userID int, rules models.ShelfRules, now time.Time) ([]models.Book, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	return s.m.ruleBooks(userID, rules, now), nil
+}
+
+func (s *memorySmartShelfStore) Create(ctx context.Context, userID int, shelf *models.SmartShelf) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.findSmartShelf(userID, shelf.Name) != 0 {
+		return ErrConflict
+	}
+	s.m.createSmartShelf(userID, shelf)
+	return nil
+}
+
+func (s *memorySmartShelfStore) Update(ctx context.Context, userID int, shelf *models.SmartShelf) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.smartShelves[shelf.ID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	if id := s.m.findSmartShelf(userID, shelf.Name); id != 0 && id != shelf.ID {
+		return ErrConflict
+	}
+	shelf.CreatedAt = sh.CreatedAt
+	sh.SmartShelf = *shelf
+	sh.Rules.Rules = slices.Clone(shelf.Rules.Rules)
+	return nil
+}
+
+func (s *memorySmartShelfStore) Delete(ctx context.Context, userID, shelfID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	sh, ok := s.m.smartShelves[shelfID]
+	if !ok || sh.UserID != userID {
+		return ErrNotFound
+	}
+	delete(s.m.smartShelves, shelfID)
+	return nil
+}
@@ -0,0 +1,346 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/tags"
+)
+
+type memoryStatsStore struct {
+	m *memory
+}
+
+// topGenres counts the books filed under each genre and returns the most
+// common, up to limit.
+func topGenres(books []*memoryBook, limit int) []models.GenreStat {
+	counts := make(map[string]int)
+	for _, b := range books {
+		for _, genre := range b.Genres {
+			counts[genre]++
+		}
+	}
+
+	genres := make([]models.GenreStat, 0, len(counts))
+	for genre, count := range counts {
+		genres = append(genres, models.GenreStat{Genre: genre, Count: count})
+	}
+	sort.Slice(genres, func(i, j int) bool {
+		if genres[i].Count != genres[j].Count {
+			return genres[i].Count > genres[j].Count
+		}
+		return genres[i].Genre < genres[j].Genre
+	})
+	if len(genres) > limit {
+		genres = genres[:limit]
+	}
+	return genres
+}
+
+// tagBreakdown counts the books carrying each of the user's tags and how
+// many of them have been read, most used first.
+func (m *memory) tagBreakdown(userID int, books []*memoryBook) []models.TagStat {
+	stats := make(map[int]*models.TagStat)
+	for id, t := range m.tags {
+		if t.UserID == userID {
+			stats[id] = &models.TagStat{Tag: t.Name}
+		}
+	}
+	for _, b := range books {
+		for _, id := range b.tagIDs {
+			stats[id].Count++
+			if b.Read {
+				stats[id].Read++
+			}
+		}
+	}
+
+	list := make([]models.TagStat, 0, len(stats))
+	for _, stat := range stats {
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return tags.Key(list[i].Tag) < tags.Key(list[j].Tag)
+	})
+	return list
+}
+
+// topAuthors counts the books each person is credited on as author and
+// returns the most credited, up to limit.
+func (m *memory) topAuthors(books []*memoryBook, limit int) []models.AuthorStat {
+	counts := make(map[int]int)
+	for _, b := range books {
+		credited := make(map[int]bool)
+		for _, credit := range b.Authors {
+			if credit.Role == models.RoleAuthor && !credited[credit.ID] {
+				credited[credit.ID] = true
+				counts[credit.ID]++
+			}
+		}
+	}
+
+	list := make([]models.AuthorStat, 0, len(counts))
+	for id, count := range counts {
+		list = append(list, models.AuthorStat{AuthorID: id, Name: m.authors[id].Name, Count: count})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name)
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// ratings averages the ratings the user gave their sessions, overall, per
+// book and per author, highest first.
+func (m *memory) ratings(userID int, stats *models.UserStats) {
+	type total struct {
+		sum   float64
+		count int
+		books map[int]bool
+	}
+	var overall total
+	perBook := make(map[int]*total)
+	perAuthor := make(map[int]*total)
+	add := func(totals map[int]*total, id, bookID int, rating float64) {
+		t, ok := totals[id]
+		if !ok {
+			t = &total{books: make(map[int]bool)}
+			totals[id] = t
+		}
+		t.sum += rating
+		t.count++
+		t.books[bookID] = true
+	}
+	for _, review := range m.reviews {
+		h := m.reading[review.SessionID]
+		if review.Rating == nil || h.UserID != userID {
+			continue
+		}
+		overall.sum += *review.Rating
+		overall.count++
+		add(perBook, h.BookID, h.BookID, *review.Rating)
+		credited := make(map[int]bool)
+		for _, credit := range m.books[h.BookID].Authors {
+			if credit.Role == models.RoleAuthor && !credited[credit.ID] {
+				credited[credit.ID] = true
+				add(perAuthor, credit.ID, h.BookID, *review.Rating)
+			}
+		}
+	}
+
+	stats.RatingsGiven = overall.count
+	if overall.count > 0 {
+		stats.AverageRating = roundRating(overall.sum / float64(overall.count))
+	}
+
+	stats.BookRatings = make([]models.BookRating, 0, len(perBook))
+	for id, t := range perBook {
+		b := m.books[id]
+		stats.BookRatings = append(stats.BookRatings, models.BookRating{
+			BookID:  id,
+			Title:   b.Title,
+			Author:  b.Author,
+			Average: roundRating(t.sum / float64(t.count)),
+			Ratings: t.count,
+		})
+	}
+	sort.Slice(stats.BookRatings, func(i, j int) bool {
+		a, b := stats.BookRatings[i], stats.BookRatings[j]
+		if a.Average != b.Average {
+			return a.Average > b.Average
+		}
+		if a.Ratings != b.Ratings {
+			return a.Ratings > b.Ratings
+		}
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	})
+
+	stats.AuthorRatings = make([]models.AuthorRating, 0, len(perAuthor))
+	for id, t := range perAuthor {
+		stats.AuthorRatings = append(stats.AuthorRatings, models.AuthorRating{
+			AuthorID: id,
+			Name:     m.authors[id].Name,
+			Average:  roundRating(t.sum / float64(t.count)),
+			Ratings:  t.count,
+			Books:    len(t.books),
+		})
+	}
+	sort.Slice(stats.AuthorRatings, func(i, j int) bool {
+		a, b := stats.AuthorRatings[i], stats.AuthorRatings[j]
+		if a.Average != b.Average {
+			return a.Average > b.Average
+		}
+		if a.Ratings != b.Ratings {
+			return a.Ratings > b.Ratings
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
+
+// addedBetween reports whether a book was created in [from, to). A zero to
+// means no upper bound.
+func addedBetween(b *memoryBook, from, to time.Time) bool {
+	if b.CreatedAt == nil || b.CreatedAt.Before(from) {
+		return false
+	}
+	return to.IsZero() || b.CreatedAt.Before(to)
+}
+
+func (s *memoryStatsStore) UserStats(ctx context.Context, userID int, now time.Time) (*models.UserStats, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	stats := models.UserStats{}
+	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	firstDayOfYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+
+	var books []*memoryBook
+	for _, id := range sortedIDs(s.m.books) {
+		if b := s.m.books[id]; b.UserID == userID {
+			books = append(books, b)
+		}
+	}
+
+	stats.TotalBooks = len(books)
+	for _, b := range books {
+		if b.Read {
+			stats.BooksRead++
+		}
+		if addedBetween(b, firstDayOfMonth, time.Time{}) {
+			stats.BooksThisMonth++
+		}
+		if addedBetween(b, firstDayOfYear, time.Time{}) {
+			stats.BooksThisYear++
+		}
+	}
+
+	lentOut := make(map[int]bool)
+	lentCounts := make(map[int]int)
+	for _, l := range s.m.lending {
+		if l.UserID != userID {
+			continue
+		}
+		stats.TotalLendings++
+		lentCounts[l.BookID]++
+		if l.ReturnedAt == nil {
+			lentOut[l.BookID] = true
+		}
+	}
+	stats.BooksLentOut = len(lentOut)
+
+	for _, h := range s.m.reading {
+		if h.UserID == userID && h.CompletedAt != nil && !h.CompletedAt.Before(firstDayOfYear) {
+			stats.BooksReadThisYear++
+		}
+	}
+
+	stats.GenreBreakdown = topGenres(books, 5)
+
+	stats.MonthlyReading = []models.MonthlyCount{}
+	for i := 11; i >= 0; i-- {
+		monthStart := firstDayOfMonth.AddDate(0, -i, 0)
+		monthEnd := monthStart.AddDate(0, 1, 0)
+
+		count := 0
+		for _, b := range books {
+			if addedBetween(b, monthStart, monthEnd) {
+				count++
+			}
+		}
+		stats.MonthlyReading = append(stats.MonthlyReading, models.MonthlyCount{
+			Month: monthStart.Format("Jan 2006"),
+			Count: count,
+		})
+	}
+
+	stats.TopAuthors = s.m.topAuthors(books, 5)
+	stats.TagBreakdown = s.m.tagBreakdown(userID, books)
+	s.m.ratings(userID, &stats)
+
+	stats.TopLentBooks = []models.TopBook{}
+	for _, b := range books {
+		if lentCounts[b.ID] > 0 {
+			stats.TopLentBooks = append(stats.TopLentBooks, models.TopBook{
+				Title:     b.Title,
+				Author:    b.Author,
+				LentCount: lentCounts[b.ID],
+			})
+		}
+	}
+	sort.SliceStable(stats.TopLentBooks, func(i, j int) bool {
+		return stats.TopLentBooks[i].LentCount > stats.TopLentBooks[j].LentCount
+	})
+	if len(stats.TopLentBooks) > 5 {
+		stats.TopLentBooks = stats.TopLentBooks[:5]
+	}
+
+	return &stats, nil
+}
+
+func (s *memoryStatsStore) AdminStats(ctx context.Context, now time.Time) (*models.AdminStats, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	var stats models.AdminStats
+	stats.TotalUsers = len(s.m.users)
+	stats.TotalBooks = len(s.m.books)
+
+	var books []*memoryBook
+	for _, id := range sortedIDs(s.m.books) {
+		b := s.m.books[id]
+		books = append(books, b)
+		if b.Read {
+			stats.BooksRead++
+		} else {
+			stats.BooksUnread++
+		}
+	}
+
+	for _, l := range s.m.lending {
+		if l.ReturnedAt != nil {
+			continue
+		}
+		stats.BooksLentOut++
+		if l.DueDate != nil && l.DueDate.Before(now) {
+			stats.OverdueBooks++
+		}
+	}
+
+	for _, id := range sortedIDs(s.m.users) {
+		user := *s.m.users[id]
+		user.PasswordHash = ""
+		stats.RecentUsers = append(stats.RecentUsers, user)
+	}
+	sort.SliceStable(stats.RecentUsers, func(i, j int) bool {
+		return stats.RecentUsers[i].CreatedAt.After(stats.RecentUsers[j].CreatedAt)
+	})
+	if len(stats.RecentUsers) > 5 {
+		stats.RecentUsers = stats.RecentUsers[:5]
+	}
+
+	for i := len(books) - 1; i >= 0 && len(stats.RecentBooks) < 10; i-- {
+		b := books[i]
+		var username string
+		if u, ok := s.m.users[b.UserID]; ok {
+			username = u.Username
+		}
+		stats.RecentBooks = append(stats.RecentBooks, models.BookWithUser{Book: b.Book, Username: username})
+	}
+
+	for _, g := range topGenres(books, 10) {
+		stats.PopularGenres = append(stats.PopularGenres, models.GenreCount{Genre: g.Genre, Count: g.Count})
+	}
+
+	return &stats, nil
+}
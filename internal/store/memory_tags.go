@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/tags"
+)
+
+// memoryTag is a tags row: the API model plus its owner.
+type memoryTag struct {
+	models.Tag
+	UserID int
+}
+
+// label settles the book's genres and resolves its tags to the user's tags,
+// creating missing ones, like writeGenres and writeTags. current is the
+// stored book being updated, or nil; genres and tags the book leaves out
+// are taken from it. It returns the IDs of the book's tags. The book must
+// have been normalized. Callers must hold the write lock.
+func (m *memory) label(userID int, book *models.Book, current *memoryBook) []int {
+	var genres []string
+	if current != nil {
+		genres = current.Genres
+	}
+	tags.ResolveGenres(book, genres)
+	book.Genres = slices.Clone(book.Genres)
+
+	if book.Tags == nil {
+		if current == nil {
+			return nil
+		}
+		book.Tags = m.tagNames(current.tagIDs)
+		return slices.Clone(current.tagIDs)
+	}
+	ids := make([]int, 0, len(book.Tags))
+	for i, name := range book.Tags {
+		id := m.findTag(userID, name)
+		if id == 0 {
+			id = m.id("tags")
+			m.tags[id] = &memoryTag{
+				Tag:    models.Tag{ID: id, Name: name, CreatedAt: timePtr(time.Now())},
+				UserID: userID,
+			}
+		}
+		book.Tags[i] = m.tags[id].Name
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// findTag returns the ID of the user's tag with the name, matched by
+// tags.Key, or 0. Callers must hold the lock.
+func (m *memory) findTag(userID int, name string) int {
+	key := tags.Key(name)
+	for id, t := range m.tags {
+		if t.UserID == userID && tags.Key(t.Name) == key {
+			return id
+		}
+	}
+	return 0
+}
+
+// tagNames returns the names of the tags, sorted like loadTags sorts them.
+// Callers must hold the lock.
+func (m *memory) tagNames(ids []int) []string {
+	if len(ids) == 0 {
+		return nil
+	}
+	names := make([]string, len(ids))
+	for i, id := range ids {
+		names[i] = m.tags[id].Name
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return tags.Key(names[i]) < tags.Key(names[j])
+	})
+	return names
+}
+
+// hasTag reports whether the book carries the tag with the name. Callers
+// must hold the lock.
+func (m *memory) hasTag(b *memoryBook, name string) bool {
+	return slices.Contains(b.tagIDs, m.findTag(b.UserID, name))
+}
+
+type memoryTagStore struct {
+	m *memory
+}
+
+func (s *memoryTagStore) List(ctx context.Context, userID int) ([]models.TagSummary, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	counts := make(map[int]int)
+	for _, b := range s.m.books {
+		for _, id := range b.tagIDs {
+			counts[id]++
+		}
+	}
+
+	list := []models.TagSummary{}
+	for _, id := range sortedIDs(s.m.tags) {
+		if t := s.m.tags[id]; t.UserID == userID {
+			list = append(list, models.TagSummary{Tag: t.Tag, BookCount: counts[id]})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return tags.Key(list[i].Name) < tags.Key(list[j].Name)
+	})
+	return list, nil
+}
+
+func (s *memoryTagStore) Create(ctx context.Context, userID int, tag *models.Tag) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if s.m.findTag(userID, tag.Name) != 0 {
+		return ErrConflict
+	}
+	tag.ID = s.m.id("tags")
+	tag.CreatedAt = timePtr(time.Now())
+	s.m.tags[tag.ID] = &memoryTag{Tag: *tag, UserID: userID}
+	return nil
+}
+
+func (s *memoryTagStore) Rename(ctx context.Context, userID int, tag *models.Tag) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	existing, ok := s.m.tags[tag.ID]
+	if !ok || existing.UserID != userID {
+		return ErrNotFound
+	}
+	if id := s.m.findTag(userID, tag.Name); id != 0 && id != tag.ID {
+		return ErrConflict
+	}
+	existing.Name = tag.Name
+	tag.CreatedAt = existing.CreatedAt
+	return nil
+}
+
+func (s *memoryTagStore) Delete(ctx context.Context, userID, tagID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	t, ok := s.m.tags[tagID]
+	if !ok || t.UserID != userID {
+		return ErrNotFound
+	}
+	s.m.deleteTag(tagID)
+	return nil
+}
+
+// deleteTag removes a tag and takes it off every book, mirroring ON DELETE
+// CASCADE. Callers must hold the write lock.
+func (m *memory) deleteTag(tagID int) {
+	delete(m.tags, tagID)
+	for _, b := range m.books {
+		b.tagIDs = slices.DeleteFunc(b.tagIDs, func(id int) bool { return id == tagID })
+	}
+}
+
+func (s *memoryTagStore) AddBooks(ctx context.Context, userID, tagID int, bookIDs []int) (int, error) {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if t, ok := s.m.tags[tagID]; !ok || t.UserID != userID {
+		return 0, ErrNotFound
+	}
+	for _, id := range bookIDs {
+		if b, ok := s.m.books[id]; !ok || b.UserID != userID {
+			return 0, ErrNotFound
+		}
+	}
+
+	added := 0
+	for _, id := range bookIDs {
+		b := s.m.books[id]
+		if !slices.Contains(b.tagIDs, tagID) {
+			b.tagIDs = append(b.tagIDs, tagID)
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (s *memoryTagStore) RemoveBook(ctx context.Context, userID, tagID, bookID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	t, ok := s.m.tags[tagID]
+	b, found := s.m.books[bookID]
+	if !ok || t.UserID != userID || !found || !slices.Contains(b.tagIDs, tagID) {
+		return ErrNotFound
+	}
+	b.tagIDs = slices.DeleteFunc(b.tagIDs, func(id int) bool { return id == tagID })
+	return nil
+}
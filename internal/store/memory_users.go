@@ -0,0 +1,124 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type memoryUserStore struct {
+	m *memory
+}
+
+func (s *memoryUserStore) Create(ctx context.Context, user *models.User) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	for _, u := range s.m.users {
+		if u.Username == user.Username || u.Email == user.Email {
+			return ErrConflict
+		}
+	}
+
+	now := time.Now()
+	user.ID = s.m.id("users")
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	stored := *user
+	s.m.users[user.ID] = &stored
+	return nil
+}
+
+func (s *memoryUserStore) Get(ctx context.Context, userID int) (*models.User, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user := *u
+	user.PasswordHash = ""
+	return &user, nil
+}
+
+func (s *memoryUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	for _, u := range s.m.users {
+		if u.Email == email {
+			user := *u
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryUserStore) ListWithStats(ctx context.Context) ([]models.UserWithStats, error) {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+
+	counts := make(map[int]int)
+	for _, b := range s.m.books {
+		counts[b.UserID]++
+	}
+
+	users := []models.UserWithStats{}
+	for _, id := range sortedIDs(s.m.users) {
+		user := *s.m.users[id]
+		user.PasswordHash = ""
+		users = append(users, models.UserWithStats{User: user, BookCount: counts[id]})
+	}
+	sort.SliceStable(users, func(i, j int) bool {
+		return users[i].CreatedAt.After(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+func (s *memoryUserStore) UpdateRole(ctx context.Context, userID int, role string) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	u, ok := s.m.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.Role = role
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+func (s *memoryUserStore) Delete(ctx context.Context, userID int) error {
+	s.m.mu.Lock()
+	defer s.m.mu.Unlock()
+
+	if _, ok := s.m.users[userID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m.users, userID)
+	delete(s.m.userSettings, userID)
+	for id, b := range s.m.books {
+		if b.UserID == userID {
+			s.m.deleteBook(id)
+		}
+	}
+	for id, t := range s.m.tags {
+		if t.UserID == userID {
+			s.m.deleteTag(id)
+		}
+	}
+	for id, shelf := range s.m.shelves {
+		if shelf.UserID == userID {
+			delete(s.m.shelves, id)
+		}
+	}
+	for id, shelf := range s.m.smartShelves {
+		if shelf.UserID == userID {
+			delete(s.m.smartShelves, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"booklib/internal/dialect"
+)
+
+// TestPostgresStores runs against the database named by
+// BOOKLIB_TEST_POSTGRES_URL, which must be a scratch database: the test
+// migrates it up and back down, dropping booklib's tables and their data.
+// CI runs it against a Postgres service, see .github/workflows/test.yml.
+func TestPostgresStores(t *testing.T) {
+	url := os.Getenv("BOOKLIB_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("BOOKLIB_TEST_POSTGRES_URL is not set")
+	}
+	d, dsn := dialect.FromURL(url)
+	if d != dialect.Postgres {
+		t.Fatalf("BOOKLIB_TEST_POSTGRES_URL is not a postgres:// URL")
+	}
+	db, err := sql.Open(d.DriverName(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testMigrations(t, db, d)
+	testSQLStores(t, NewSQL(db, d))
+}
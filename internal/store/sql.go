@@ -0,0 +1,133 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"booklib/internal/dialect"
+)
+
+// NewSQL returns stores backed by a SQL database whose schema has been
+// brought up to date by the migrations package.
+func NewSQL(db *sql.DB, d dialect.Dialect) *Stores {
+	conn := &sqlDB{DB: db, dialect: d}
+	return &Stores{
+		Books:      &sqlBookStore{db: conn},
+		Authors:    &sqlAuthorStore{db: conn},
+		Tags:       &sqlTagStore{db: conn},
+		Shelves:    &sqlShelfStore{db: conn},
+		Smart:      &sqlSmartShelfStore{db: conn},
+		Cache:      &sqlISBNCacheStore{db: conn},
+		Enrichment: &sqlEnrichmentStore{db: conn},
+		Lending:    &sqlLendingStore{db: conn},
+		Reading:    &sqlReadingStore{db: conn},
+		Notes:      &sqlNoteStore{db: conn},
+		Users:      &sqlUserStore{db: conn},
+		Settings:   &sqlSettingsStore{db: conn},
+		Stats:      &sqlStatsStore{db: conn},
+		Export:     &sqlExportStore{db: conn},
+	}
+}
+
+// NewSQLite returns stores backed by a SQLite database.
+func NewSQLite(db *sql.DB) *Stores {
+	return NewSQL(db, dialect.SQLite)
+}
+
+// sqlDB wraps a connection pool so queries written with "?" placeholders
+// are rebound for the underlying dialect.
+type sqlDB struct {
+	*sql.DB
+	dialect dialect.Dialect
+}
+
+func (db *sqlDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return db.DB.QueryContext(ctx, db.dialect.Rebind(query), args...)
+}
+
+func (db *sqlDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return db.DB.QueryRowContext(ctx, db.dialect.Rebind(query), args...)
+}
+
+func (db *sqlDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return db.DB.ExecContext(ctx, db.dialect.Rebind(query), args...)
+}
+
+func (db *sqlDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sqlTx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, dialect: db.dialect}, nil
+}
+
+// timestamp returns an expression for a timestamp column that sorts and
+// compares exactly. SQLite keeps timestamps as text whose format depends on
+// how the row was written, so they are normalized with datetime() first;
+// timestampArg converts values to match.
+func (db *sqlDB) timestamp(column string) string {
+	if db.dialect == dialect.Postgres {
+		return column
+	}
+	return "datetime(" + column + ")"
+}
+
+func (db *sqlDB) timestampArg(t time.Time) any {
+	if db.dialect == dialect.Postgres {
+		return t
+	}
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// sqlTx is the transaction counterpart of sqlDB.
+type sqlTx struct {
+	*sql.Tx
+	dialect dialect.Dialect
+}
+
+func (tx *sqlTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return tx.Tx.QueryContext(ctx, tx.dialect.Rebind(query), args...)
+}
+
+func (tx *sqlTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return tx.Tx.QueryRowContext(ctx, tx.dialect.Rebind(query), args...)
+}
+
+func (tx *sqlTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return tx.Tx.ExecContext(ctx, tx.dialect.Rebind(query), args...)
+}
+
+// isUniqueViolation reports whether err was caused by a UNIQUE or PRIMARY
+// KEY constraint.
+func isUniqueViolation(err error) bool {
+	return dialect.IsUniqueViolation(err)
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// requireRows returns ErrNotFound when a write matched no rows.
+func requireRows(result sql.Result) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
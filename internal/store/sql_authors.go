@@ -0,0 +1,166 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"booklib/internal/authors"
+	"booklib/internal/models"
+)
+
+// sqlConn is satisfied by both sqlDB and sqlTx.
+type sqlConn interface {
+	queryRower
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// writeCredits replaces the book's credits with book.Authors, creating
+// authors that don't exist yet, and sets the credits' author IDs and names
+// as loadCredits will return them. The credits must have been normalized.
+func writeCredits(ctx context.Context, db sqlConn, book *models.Book) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM book_authors WHERE book_id = ?", book.ID); err != nil {
+		return err
+	}
+	for i := range book.Authors {
+		credit := &book.Authors[i]
+		key := authors.Key(credit.Name)
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO authors (name, name_key) VALUES (?, ?) ON CONFLICT (name_key) DO NOTHING",
+			credit.Name, key,
+		)
+		if err != nil {
+			return err
+		}
+		if err := db.QueryRowContext(ctx, "SELECT id, name FROM authors WHERE name_key = ?", key).Scan(&credit.ID, &credit.Name); err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx,
+			"INSERT INTO book_authors (book_id, author_id, role, position) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING",
+			book.ID, credit.ID, credit.Role, i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadCredits sets the Authors of each book. Credits keep the order they
+// were written in; the names are the authors' names as first recorded.
+func loadCredits(ctx context.Context, db sqlConn, books []models.Book) error {
+	index := make(map[int]int, len(books))
+	for i := range books {
+		index[books[i].ID] = i
+		books[i].Authors = nil
+	}
+
+	return inBatches(books, func(in string, args []any) error {
+		rows, err := db.QueryContext(ctx, `
+			SELECT ba.book_id, a.id, a.name, ba.role
+			FROM book_authors ba
+			JOIN authors a ON a.id = ba.author_id
+			WHERE ba.book_id IN `+in+`
+			ORDER BY ba.book_id, ba.position`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID int
+			var credit models.BookAuthor
+			if err := rows.Scan(&bookID, &credit.ID, &credit.Name, &credit.Role); err != nil {
+				return err
+			}
+			book := &books[index[bookID]]
+			book.Authors = append(book.Authors, credit)
+		}
+		return rows.Err()
+	})
+}
+
+type sqlAuthorStore struct {
+	db *sqlDB
+}
+
+func (s *sqlAuthorStore) List(ctx context.Context, userID int, search string) ([]models.AuthorSummary, error) {
+	query := `
+		SELECT a.id, a.name, COUNT(DISTINCT b.id)
+		FROM authors a
+		JOIN book_authors ba ON ba.author_id = a.id
+		JOIN books b ON b.id = ba.book_id
+		WHERE b.user_id = ?`
+	args := []any{userID}
+	if search != "" {
+		query += " AND LOWER(a.name) LIKE ? ESCAPE '\\'"
+		args = append(args, "%"+escapeLike(strings.ToLower(search))+"%")
+	}
+	query += " GROUP BY a.id, a.name ORDER BY LOWER(a.name), a.id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.AuthorSummary{}
+	for rows.Next() {
+		var a models.AuthorSummary
+		if err := rows.Scan(&a.ID, &a.Name, &a.BookCount); err != nil {
+			return nil, err
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlAuthorStore) Get(ctx context.Context, userID, authorID int) (*models.AuthorDetail, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+bookColumns+`, ba.role
+		FROM books b
+		JOIN book_authors ba ON ba.book_id = b.id
+		WHERE ba.author_id = ? AND b.user_id = ?
+		ORDER BY LOWER(b.title), b.id, ba.role`, authorID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	detail := &models.AuthorDetail{Books: []models.AuthoredBook{}}
+	for rows.Next() {
+		var role string
+		book, err := scanBook(rows, &role)
+		if err != nil {
+			return nil, err
+		}
+		if n := len(detail.Books); n > 0 && detail.Books[n-1].ID == book.ID {
+			detail.Books[n-1].Roles = append(detail.Books[n-1].Roles, role)
+			continue
+		}
+		detail.Books = append(detail.Books, models.AuthoredBook{Book: *book, Roles: []string{role}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Authors are only visible through the user's own books
+	if len(detail.Books) == 0 {
+		return nil, ErrNotFound
+	}
+
+	err = s.db.QueryRowContext(ctx, "SELECT id, name FROM authors WHERE id = ?", authorID).Scan(&detail.ID, &detail.Name)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	books := make([]models.Book, len(detail.Books))
+	for i := range detail.Books {
+		books[i] = detail.Books[i].Book
+	}
+	if err := loadRelations(ctx, s.db, books); err != nil {
+		return nil, err
+	}
+	for i := range detail.Books {
+		detail.Books[i].Authors = books[i].Authors
+	}
+	return detail, nil
+}
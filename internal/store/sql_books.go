@@ -0,0 +1,712 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"booklib/internal/authors"
+	"booklib/internal/dialect"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/tags"
+)
+
+type sqlBookStore struct {
+	db *sqlDB
+}
+
+// bookColumns selects a books row aliased as b in the order scanBook reads
+// it.
+const bookColumns = `b.id, b.title, b.author, b.isbn, b.genre, b.read, b.status, b.status_changed_at,
+	COALESCE(b.cover_url, ''), COALESCE(b.description, ''), COALESCE(b.page_count, 0),
+	COALESCE(b.publisher, ''), COALESCE(b.published_date, ''), COALESCE(b.language, ''), COALESCE(b.notes, ''), b.created_at`
+
+// scanBook reads bookColumns followed by any extra columns into extra.
+func scanBook(row interface{ Scan(...any) error }, extra ...any) (*models.Book, error) {
+	var book models.Book
+	var readInt int
+	dest := []any{
+		&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt, &book.Status, &book.StatusChangedAt,
+		&book.CoverURL, &book.Description, &book.PageCount, &book.Publisher, &book.PublishedDate, &book.Language,
+		&book.Notes, &book.CreatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, notFound(err)
+	}
+	book.Read = readInt == 1
+	return &book, nil
+}
+
+// queryRower is satisfied by both sqlDB and sqlTx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// bookBatchSize caps the book IDs inBatches puts in one query, to stay
+// under SQLite's limit on query parameters.
+const bookBatchSize = 500
+
+// inBatches calls fn for batches of the books with an "IN (?, ...)" list
+// and the books' IDs as its arguments.
+func inBatches(books []models.Book, fn func(in string, args []any) error) error {
+	for start := 0; start < len(books); start += bookBatchSize {
+		batch := books[start:min(start+bookBatchSize, len(books))]
+		args := make([]any, len(batch))
+		for i, book := range batch {
+			args[i] = book.ID
+		}
+		if err := fn("("+strings.Repeat("?, ", len(batch)-1)+"?)", args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRelations sets the credits, genres and tags of each book.
+func loadRelations(ctx context.Context, db sqlConn, books []models.Book) error {
+	if err := loadCredits(ctx, db, books); err != nil {
+		return err
+	}
+	if err := loadGenres(ctx, db, books); err != nil {
+		return err
+	}
+	return loadTags(ctx, db, books)
+}
+
+// normalizeBook normalizes the book's credits, genres and tags before it is
+// written.
+func normalizeBook(book *models.Book) error {
+	if err := authors.Normalize(book); err != nil {
+		return err
+	}
+	return tags.Normalize(book)
+}
+
+// insertBook inserts the book with its credits, genres and tags and sets its
+// ID and creation time. A book that already has a creation time, such as
+// one being restored, keeps it. Its status must have been settled, see
+// reading.Settle.
+func insertBook(ctx context.Context, db sqlConn, userID int, book *models.Book) error {
+	if err := normalizeBook(book); err != nil {
+		return err
+	}
+	tags.ResolveGenres(book, nil)
+	columns := `user_id, title, author, isbn, genre, read, status, status_changed_at, cover_url, description,
+		page_count, publisher, published_date, language, notes`
+	values := "?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?"
+	args := []any{
+		userID, book.Title, book.Author, book.ISBN, book.Genre, boolToInt(book.Read), book.Status, book.StatusChangedAt,
+		book.CoverURL, book.Description, book.PageCount, book.Publisher, book.PublishedDate, book.Language, book.Notes,
+	}
+	if book.CreatedAt != nil {
+		columns += ", created_at"
+		values += ", ?"
+		args = append(args, book.CreatedAt.UTC())
+	}
+
+	err := db.QueryRowContext(ctx,
+		"INSERT INTO books ("+columns+") VALUES ("+values+") RETURNING id, created_at",
+		args...,
+	).Scan(&book.ID, &book.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeCredits(ctx, db, book); err != nil {
+		return err
+	}
+	if err := writeGenres(ctx, db, book); err != nil {
+		return err
+	}
+	return writeTags(ctx, db, userID, book)
+}
+
+func (s *sqlBookStore) List(ctx context.Context, userID int) ([]models.Book, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT "+bookColumns+" FROM books b WHERE b.user_id = ?",
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			continue
+		}
+		books = append(books, *book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return books, loadRelations(ctx, s.db, books)
+}
+
+// bookFilters returns the WHERE clause and arguments for q's filters, with
+// books aliased as b.
+func (s *sqlBookStore) bookFilters(userID int, q BookQuery) (string, []any) {
+	where := []string{"b.user_id = ?"}
+	args := []any{userID}
+
+	if q.Read != nil {
+		where = append(where, "b.read = ?")
+		args = append(args, boolToInt(*q.Read))
+	}
+	if q.Status != "" {
+		where = append(where, "b.status = ?")
+		args = append(args, q.Status)
+	}
+	if q.LentOut != nil {
+		lent := "EXISTS (SELECT 1 FROM lending l WHERE l.book_id = b.id AND l.returned_at IS NULL)"
+		if !*q.LentOut {
+			lent = "NOT " + lent
+		}
+		where = append(where, lent)
+	}
+	if q.Reading != nil {
+		active := `EXISTS (SELECT 1 FROM reading_history h
+			WHERE h.book_id = b.id AND h.completed_at IS NULL AND h.abandoned_at IS NULL)`
+		if !*q.Reading {
+			active = "NOT " + active
+		}
+		where = append(where, active)
+	}
+	if q.Started != nil {
+		started := "EXISTS (SELECT 1 FROM reading_history h WHERE h.book_id = b.id)"
+		if !*q.Started {
+			started = "NOT " + started
+		}
+		where = append(where, started)
+	}
+	if q.ShelfID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM shelf_books sb WHERE sb.book_id = b.id AND sb.shelf_id = ?)")
+		args = append(args, q.ShelfID)
+	}
+	if q.Genre != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM book_genres g WHERE g.book_id = b.id AND LOWER(g.genre) = LOWER(?))")
+		args = append(args, q.Genre)
+	}
+	for _, tag := range q.Tags {
+		where = append(where, `EXISTS (SELECT 1 FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.book_id = b.id AND t.name_key = ?)`)
+		args = append(args, tags.Key(tag))
+	}
+	if q.Author != "" {
+		where = append(where, "LOWER(b.author) LIKE ? ESCAPE '\\'")
+		args = append(args, "%"+escapeLike(strings.ToLower(q.Author))+"%")
+	}
+	if q.AuthorID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM book_authors ba WHERE ba.book_id = b.id AND ba.author_id = ?)")
+		args = append(args, q.AuthorID)
+	}
+	if !q.AddedFrom.IsZero() {
+		where = append(where, s.db.timestamp("b.created_at")+" >= ?")
+		args = append(args, s.db.timestampArg(q.AddedFrom))
+	}
+	if !q.AddedTo.IsZero() {
+		where = append(where, s.db.timestamp("b.created_at")+" < ?")
+		args = append(args, s.db.timestampArg(q.AddedTo))
+	}
+	if !q.FinishedFrom.IsZero() || !q.FinishedTo.IsZero() {
+		finished := "EXISTS (SELECT 1 FROM reading_history h WHERE h.book_id = b.id AND h.completed_at IS NOT NULL"
+		if !q.FinishedFrom.IsZero() {
+			finished += " AND " + s.db.timestamp("h.completed_at") + " >= ?"
+			args = append(args, s.db.timestampArg(q.FinishedFrom))
+		}
+		if !q.FinishedTo.IsZero() {
+			finished += " AND " + s.db.timestamp("h.completed_at") + " < ?"
+			args = append(args, s.db.timestampArg(q.FinishedTo))
+		}
+		where = append(where, finished+")")
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// escapeLike escapes the LIKE wildcards in a literal search term.
+func escapeLike(term string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term)
+}
+
+// searchTerms splits free text into the words a full-text query should
+// match. Anything other than letters and digits separates words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Snippets come back from the database with matches between startMatch and
+// endMatch, control characters that cannot clash with the markup the text
+// is escaped into.
+const (
+	startMatch = "\x02"
+	endMatch   = "\x03"
+)
+
+// highlight HTML-escapes a snippet from the database and marks its matches
+// with <mark> tags.
+func highlight(snippet string) string {
+	return strings.NewReplacer(startMatch, "<mark>", endMatch, "</mark>").Replace(html.EscapeString(snippet))
+}
+
+// searchSource returns a subquery yielding (id, score, snippet) for the
+// user's books matching every term as a prefix, along with its arguments.
+// Lower scores are better matches. SQLite uses the books_fts index and
+// PostgreSQL the books.search tsvector; both weight title over author over
+// genre over notes. Snippets need highlight.
+func (s *sqlBookStore) searchSource(userID int, terms []string) (string, []any) {
+	if s.db.dialect == dialect.Postgres {
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		return `(
+			SELECT id,
+				(-ts_rank(search, query))::float8 AS score,
+				ts_headline('simple', concat_ws(' / ', title, author, genre, notes), query,
+					'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=1, MaxWords=20, MinWords=5') AS snippet
+			FROM books, to_tsquery('simple', ?) query
+			WHERE search @@ query AND user_id = ?
+		)`, []any{strings.Join(prefixes, " & "), userID}
+	}
+
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+	return `(
+		SELECT rowid AS id,
+			bm25(books_fts, 10.0, 5.0, 2.0, 1.0) AS score,
+			snippet(books_fts, -1, char(2), char(3), '…', 12) AS snippet
+		FROM books_fts
+		WHERE books_fts MATCH ? AND rowid IN (SELECT id FROM books WHERE user_id = ?)
+	)`, []any{strings.Join(phrases, " "), userID}
+}
+
+func (s *sqlBookStore) Query(ctx context.Context, userID int, q BookQuery) (*BookPage, error) {
+	from := "books b"
+	var args []any
+	search := q.Search != ""
+	if search {
+		terms := searchTerms(q.Search)
+		if len(terms) == 0 {
+			return &BookPage{Books: []models.Book{}, Snippets: map[int]string{}}, nil
+		}
+		source, sourceArgs := s.searchSource(userID, terms)
+		from += " JOIN " + source + " m ON m.id = b.id"
+		args = append(args, sourceArgs...)
+	}
+	where, filterArgs := s.bookFilters(userID, q)
+	args = append(args, filterArgs...)
+
+	page := &BookPage{Books: []models.Book{}}
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+from+" WHERE "+where, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	var key string
+	switch q.Sort {
+	case SortTitle:
+		key = "LOWER(b.title)"
+	case SortAuthor:
+		key = "LOWER(COALESCE(b.author, ''))"
+	case SortRank:
+		if !search {
+			return nil, errors.New("rank order requires a search")
+		}
+		key = "m.score"
+	default:
+		key = s.db.timestamp("b.created_at")
+	}
+	direction, compare := "ASC", ">"
+	if q.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	if q.After != nil {
+		var after any = q.After.Key
+		switch {
+		case q.Sort == SortRank:
+			score, err := strconv.ParseFloat(q.After.Key, 64)
+			if err != nil {
+				return nil, err
+			}
+			after = score
+		case q.Sort != SortTitle && q.Sort != SortAuthor && s.db.dialect == dialect.Postgres:
+			t, err := time.Parse(time.RFC3339Nano, q.After.Key)
+			if err != nil {
+				return nil, err
+			}
+			after = t
+		}
+		where += " AND (" + key + " " + compare + " ? OR (" + key + " = ? AND b.id " + compare + " ?))"
+		args = append(args, after, after, q.After.ID)
+	}
+
+	columns := bookColumns + ", " + key
+	if search {
+		columns += ", m.snippet"
+		page.Snippets = make(map[int]string)
+	}
+	query := `
+		SELECT ` + columns + `
+		FROM ` + from + `
+		WHERE ` + where + `
+		ORDER BY ` + key + ` ` + direction + `, b.id ` + direction
+	if q.Limit > 0 {
+		// Fetch one extra row to learn whether there is a next page
+		query += " LIMIT " + strconv.Itoa(q.Limit+1)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lastKey any
+	for rows.Next() {
+		if q.Limit > 0 && len(page.Books) == q.Limit {
+			last := page.Books[len(page.Books)-1]
+			page.Next = &BookCursor{Key: cursorKey(lastKey), ID: last.ID}
+			break
+		}
+
+		extra := []any{&lastKey}
+		var snippet sql.NullString
+		if search {
+			extra = append(extra, &snippet)
+		}
+		book, err := scanBook(rows, extra...)
+		if err != nil {
+			return nil, err
+		}
+		page.Books = append(page.Books, *book)
+		if search {
+			page.Snippets[book.ID] = highlight(snippet.String)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return page, loadRelations(ctx, s.db, page.Books)
+}
+
+// cursorKey converts a scanned sort key to its cursor form.
+func cursorKey(v any) string {
+	switch key := v.(type) {
+	case time.Time:
+		return key.UTC().Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(key, 'g', -1, 64)
+	case []byte:
+		return string(key)
+	case string:
+		return key
+	}
+	return ""
+}
+
+func (s *sqlBookStore) Get(ctx context.Context, userID, bookID int) (*models.Book, error) {
+	book, err := scanBook(s.db.QueryRowContext(ctx,
+		"SELECT "+bookColumns+" FROM books b WHERE b.id = ? AND b.user_id = ?",
+		bookID, userID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	books := []models.Book{*book}
+	if err := loadRelations(ctx, s.db, books); err != nil {
+		return nil, err
+	}
+	return &books[0], nil
+}
+
+func (s *sqlBookStore) OwnerID(ctx context.Context, bookID int) (int, error) {
+	var userID int
+	err := s.db.QueryRowContext(ctx, "SELECT user_id FROM books WHERE id = ?", bookID).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (s *sqlBookStore) FindByISBN(ctx context.Context, userID int, isbn string) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id FROM books WHERE user_id = ? AND isbn = ?",
+		userID, isbn,
+	).Scan(&id)
+	return id, notFound(err)
+}
+
+func (s *sqlBookStore) Create(ctx context.Context, userID int, book *models.Book) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	book.CreatedAt = nil
+	book.StatusChangedAt = nil
+	reading.Settle(book, nil)
+	if err := insertBook(ctx, tx, userID, book); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlBookStore) Import(ctx context.Context, userID int, books []*models.ImportBook) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, b := range books {
+		book := &b.Book
+		book.CreatedAt = nil
+		book.StatusChangedAt = nil
+		reading.Settle(book, b.Sessions)
+		if err := insertBook(ctx, tx, userID, book); err != nil {
+			return err
+		}
+
+		for i := range b.Sessions {
+			session := &b.Sessions[i]
+			session.BookID = book.ID
+			session.UserID = userID
+			err := tx.QueryRowContext(ctx,
+				"INSERT INTO reading_history (book_id, user_id, started_at, completed_at) VALUES (?, ?, ?, ?) RETURNING id",
+				session.BookID, session.UserID, session.StartedAt, session.CompletedAt,
+			).Scan(&session.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlBookStore) Update(ctx context.Context, userID int, book *models.Book) error {
+	if err := normalizeBook(book); err != nil {
+		return err
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Genres and tags the update leaves out are kept
+	current := []models.Book{{ID: book.ID}}
+	if err := loadGenres(ctx, tx, current); err != nil {
+		return err
+	}
+	tags.ResolveGenres(book, current[0].Genres)
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE books
+		SET title=?, author=?, isbn=?, genre=?, cover_url=?, description=?, page_count=?,
+			publisher=?, published_date=?, language=?, notes=?, updated_at=CURRENT_TIMESTAMP
+		WHERE id=? AND user_id=?`,
+		book.Title, book.Author, book.ISBN, book.Genre, book.CoverURL,
+		book.Description, book.PageCount, book.Publisher, book.PublishedDate, book.Language,
+		book.Notes, book.ID, userID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrConflict
+		}
+		return err
+	}
+	if err := requireRows(result); err != nil {
+		return err
+	}
+	var readInt int
+	err = tx.QueryRowContext(ctx,
+		"SELECT read, status, status_changed_at FROM books WHERE id = ?", book.ID,
+	).Scan(&readInt, &book.Status, &book.StatusChangedAt)
+	if err != nil {
+		return err
+	}
+	book.Read = readInt == 1
+	if err := writeCredits(ctx, tx, book); err != nil {
+		return err
+	}
+	if err := writeGenres(ctx, tx, book); err != nil {
+		return err
+	}
+	if book.Tags == nil {
+		if err := loadTags(ctx, tx, current); err != nil {
+			return err
+		}
+		book.Tags = current[0].Tags
+	} else if err := writeTags(ctx, tx, userID, book); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlBookStore) Delete(ctx context.Context, userID, bookID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM books WHERE id=? AND user_id=?", bookID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+type sqlISBNCacheStore struct {
+	db *sqlDB
+}
+
+// isbnCacheColumns selects an isbn_cache row in the order scanISBNCache
+// reads it.
+const isbnCacheColumns = `isbn, COALESCE(title, ''), COALESCE(author, ''), COALESCE(genre, ''), genres,
+	COALESCE(cover_url, ''), COALESCE(description, ''), COALESCE(page_count, 0), COALESCE(publisher, ''),
+	COALESCE(published_date, ''), COALESCE(language, ''), cached_at, pinned`
+
+func scanISBNCache(row interface{ Scan(...any) error }) (*models.IsbnCache, error) {
+	var cache models.IsbnCache
+	var genres sql.NullString
+	var pinned int
+	err := row.Scan(&cache.ISBN, &cache.Title, &cache.Author, &cache.Genre, &genres, &cache.CoverUrl, &cache.Description,
+		&cache.PageCount, &cache.Publisher, &cache.PublishedDate, &cache.Language, &cache.CachedAt, &pinned)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	// Entries cached before genres were kept only have the main genre
+	if genres.Valid {
+		if err := json.Unmarshal([]byte(genres.String), &cache.Genres); err != nil {
+			return nil, err
+		}
+	} else if cache.Genre != "" {
+		cache.Genres = []string{cache.Genre}
+	}
+	cache.Pinned = pinned == 1
+	return &cache, nil
+}
+
+// encodeGenres returns the JSON stored in isbn_cache.genres.
+func encodeGenres(genres []string) (string, error) {
+	if genres == nil {
+		genres = []string{}
+	}
+	data, err := json.Marshal(genres)
+	return string(data), err
+}
+
+func (s *sqlISBNCacheStore) Get(ctx context.Context, isbn string) (*models.IsbnCache, error) {
+	return scanISBNCache(s.db.QueryRowContext(ctx,
+		"SELECT "+isbnCacheColumns+" FROM isbn_cache WHERE isbn = ?",
+		isbn,
+	))
+}
+
+func (s *sqlISBNCacheStore) Put(ctx context.Context, entry *models.IsbnCache) error {
+	return s.insert(ctx, entry, "DO NOTHING")
+}
+
+func (s *sqlISBNCacheStore) Save(ctx context.Context, entry *models.IsbnCache) error {
+	return s.insert(ctx, entry, `DO UPDATE SET
+		title = excluded.title, author = excluded.author, genre = excluded.genre, genres = excluded.genres,
+		cover_url = excluded.cover_url, description = excluded.description,
+		page_count = excluded.page_count, publisher = excluded.publisher,
+		published_date = excluded.published_date, language = excluded.language,
+		cached_at = excluded.cached_at, pinned = excluded.pinned`)
+}
+
+// insert inserts the entry, resolving an existing entry for the ISBN with
+// the given ON CONFLICT action.
+func (s *sqlISBNCacheStore) insert(ctx context.Context, entry *models.IsbnCache, onConflict string) error {
+	cachedAt := time.Now()
+	if entry.CachedAt != nil {
+		cachedAt = *entry.CachedAt
+	}
+	genres, err := encodeGenres(entry.Genres)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO isbn_cache (isbn, title, author, genre, genres, cover_url, description, page_count,
+			publisher, published_date, language, cached_at, pinned)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(isbn) `+onConflict,
+		entry.ISBN, entry.Title, entry.Author, entry.Genre, genres, entry.CoverUrl, entry.Description, entry.PageCount,
+		entry.Publisher, entry.PublishedDate, entry.Language, s.db.timestampArg(cachedAt), boolToInt(entry.Pinned),
+	)
+	return err
+}
+
+func (s *sqlISBNCacheStore) List(ctx context.Context, q ISBNCacheQuery) ([]models.IsbnCache, int, error) {
+	where := "1 = 1"
+	var args []any
+	if q.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(q.Search)) + "%"
+		where += ` AND (isbn LIKE ? ESCAPE '\' OR LOWER(COALESCE(title, '')) LIKE ? ESCAPE '\'
+			OR LOWER(COALESCE(author, '')) LIKE ? ESCAPE '\')`
+		args = append(args, pattern, pattern, pattern)
+	}
+	order := "isbn"
+	if !q.ExpiredBefore.IsZero() {
+		where += " AND pinned = 0 AND " + s.db.timestamp("cached_at") + " < ?"
+		args = append(args, s.db.timestampArg(q.ExpiredBefore))
+		order = s.db.timestamp("cached_at") + ", isbn"
+	}
+
+	var total int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM isbn_cache WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := "SELECT " + isbnCacheColumns + " FROM isbn_cache WHERE " + where + " ORDER BY " + order
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit) + " OFFSET " + strconv.Itoa(q.Offset)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []models.IsbnCache{}
+	for rows.Next() {
+		entry, err := scanISBNCache(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, total, rows.Err()
+}
+
+func (s *sqlISBNCacheStore) Delete(ctx context.Context, isbn string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM isbn_cache WHERE isbn = ?", isbn)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlISBNCacheStore) Purge(ctx context.Context, cachedBefore time.Time) (int, error) {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM isbn_cache WHERE pinned = 0 AND "+s.db.timestamp("cached_at")+" < ?",
+		s.db.timestampArg(cachedBefore),
+	)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
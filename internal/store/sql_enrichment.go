@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+
+	"booklib/internal/models"
+)
+
+type sqlEnrichmentStore struct {
+	db *sqlDB
+}
+
+// proposalColumns selects an enrichment_proposals row aliased as p in the
+// order scanProposal reads it.
+const proposalColumns = `p.id, p.book_id, p.status, p.matched_by, p.score, COALESCE(p.isbn, ''),
+	COALESCE(p.genre, ''), COALESCE(p.cover_url, ''), COALESCE(p.description, ''),
+	COALESCE(p.page_count, 0), COALESCE(p.publisher, ''), COALESCE(p.published_date, ''),
+	COALESCE(p.language, ''), p.created_at`
+
+// scanProposal reads bookColumns followed by proposalColumns.
+func scanProposal(row interface{ Scan(...any) error }) (*models.EnrichmentProposal, error) {
+	var p models.EnrichmentProposal
+	book, err := scanBook(row,
+		&p.ID, &p.BookID, &p.Status, &p.MatchedBy, &p.Score, &p.ISBN,
+		&p.Genre, &p.CoverURL, &p.Description,
+		&p.PageCount, &p.Publisher, &p.PublishedDate,
+		&p.Language, &p.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	p.Book = book
+	return &p, nil
+}
+
+func (s *sqlEnrichmentStore) List(ctx context.Context, userID int, status string) ([]models.EnrichmentProposal, error) {
+	query := "SELECT " + bookColumns + ", " + proposalColumns + `
+		FROM enrichment_proposals p
+		JOIN books b ON b.id = p.book_id
+		WHERE p.user_id = ?`
+	args := []any{userID}
+	if status != "" {
+		query += " AND p.status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY p.id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	proposals := []models.EnrichmentProposal{}
+	for rows.Next() {
+		p, err := scanProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return proposals, s.loadBooks(ctx, proposals)
+}
+
+// loadBooks sets the credits, genres and tags of the proposals' books.
+func (s *sqlEnrichmentStore) loadBooks(ctx context.Context, proposals []models.EnrichmentProposal) error {
+	books := make([]models.Book, len(proposals))
+	for i, p := range proposals {
+		books[i] = *p.Book
+	}
+	if err := loadRelations(ctx, s.db, books); err != nil {
+		return err
+	}
+	for i := range proposals {
+		proposals[i].Book = &books[i]
+	}
+	return nil
+}
+
+func (s *sqlEnrichmentStore) Get(ctx context.Context, userID, proposalID int) (*models.EnrichmentProposal, error) {
+	p, err := scanProposal(s.db.QueryRowContext(ctx, "SELECT "+bookColumns+", "+proposalColumns+`
+		FROM enrichment_proposals p
+		JOIN books b ON b.id = p.book_id
+		WHERE p.id = ? AND p.user_id = ?`, proposalID, userID))
+	if err != nil {
+		return nil, err
+	}
+	proposals := []models.EnrichmentProposal{*p}
+	if err := s.loadBooks(ctx, proposals); err != nil {
+		return nil, err
+	}
+	return &proposals[0], nil
+}
+
+func (s *sqlEnrichmentStore) Create(ctx context.Context, userID int, p *models.EnrichmentProposal) error {
+	if p.Status == "" {
+		p.Status = models.ProposalPending
+	}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO enrichment_proposals (
+			book_id, user_id, status, matched_by, score, isbn, genre, cover_url,
+			description, page_count, publisher, published_date, language
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at
+	`,
+		p.BookID, userID, p.Status, p.MatchedBy, p.Score, p.ISBN, p.Genre, p.CoverURL,
+		p.Description, p.PageCount, p.Publisher, p.PublishedDate, p.Language,
+	).Scan(&p.ID, &p.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlEnrichmentStore) SetStatus(ctx context.Context, userID, proposalID int, status string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE enrichment_proposals SET status = ? WHERE id = ? AND user_id = ?",
+		status, proposalID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlEnrichmentStore) Delete(ctx context.Context, userID, proposalID int) error {
+	result, err := s.db.ExecContext(ctx,
+		"DELETE FROM enrichment_proposals WHERE id = ? AND user_id = ?",
+		proposalID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
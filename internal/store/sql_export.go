@@ -0,0 +1,569 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+)
+
+type sqlExportStore struct {
+	db *sqlDB
+}
+
+func (s *sqlExportStore) Export(ctx context.Context, userID int, fn func(ExportReader) error) error {
+	// Read everything in one transaction so the archive is a consistent
+	// snapshot, which PostgreSQL only keeps across statements from
+	// repeatable read up
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(&sqlExportReader{ctx: ctx, tx: tx, userID: userID})
+}
+
+// sqlExportReader reads an export from the transaction Export opened.
+type sqlExportReader struct {
+	ctx    context.Context
+	tx     *sqlTx
+	userID int
+}
+
+// each runs the query and calls scan on every row.
+func (r *sqlExportReader) each(query string, scan func(rows *sql.Rows) error, args ...any) error {
+	rows, err := r.tx.QueryContext(r.ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Books reads the books in batches, loading each batch's relations once its
+// rows are closed; PostgreSQL can't run a query while another's rows are
+// open on the same connection.
+func (r *sqlExportReader) Books(fn func(models.Book) error) error {
+	after := 0
+	for {
+		var batch []models.Book
+		err := r.each(
+			"SELECT "+bookColumns+" FROM books b WHERE b.user_id = ? AND b.id > ? ORDER BY b.id LIMIT "+strconv.Itoa(bookBatchSize),
+			func(rows *sql.Rows) error {
+				book, err := scanBook(rows)
+				if err != nil {
+					return err
+				}
+				batch = append(batch, *book)
+				return nil
+			},
+			r.userID, after,
+		)
+		if err != nil {
+			return err
+		}
+		if err := loadRelations(r.ctx, r.tx, batch); err != nil {
+			return err
+		}
+		if err := each(batch, fn); err != nil {
+			return err
+		}
+		if len(batch) < bookBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].ID
+	}
+}
+
+func (r *sqlExportReader) Lending(fn func(models.Lending) error) error {
+	return r.each(`
+		SELECT id, book_id, user_id, lent_to, lent_at, due_date, returned_at, last_reminder_sent
+		FROM lending
+		WHERE user_id = ?
+		ORDER BY id
+	`, func(rows *sql.Rows) error {
+		var l models.Lending
+		if err := rows.Scan(&l.ID, &l.BookID, &l.UserID, &l.LentTo, &l.LentAt, &l.DueDate, &l.ReturnedAt, &l.LastReminderSent); err != nil {
+			return err
+		}
+		return fn(l)
+	}, r.userID)
+}
+
+func (r *sqlExportReader) ReadingHistory(fn func(models.ReadingHistory) error) error {
+	return r.each("SELECT "+readingColumns+" FROM reading_history WHERE user_id = ? ORDER BY id", func(rows *sql.Rows) error {
+		h, err := scanReading(rows)
+		if err != nil {
+			return err
+		}
+		return fn(*h)
+	}, r.userID)
+}
+
+func (r *sqlExportReader) StatusChanges(fn func(models.StatusChange) error) error {
+	return r.each(`
+		SELECT id, book_id, from_status, to_status, changed_at
+		FROM reading_status_changes
+		WHERE user_id = ?
+		ORDER BY changed_at, id
+	`, func(rows *sql.Rows) error {
+		var c models.StatusChange
+		if err := rows.Scan(&c.ID, &c.BookID, &c.From, &c.To, &c.ChangedAt); err != nil {
+			return err
+		}
+		return fn(c)
+	}, r.userID)
+}
+
+func (r *sqlExportReader) ReadingProgress(fn func(models.ReadingProgress) error) error {
+	return r.each("SELECT "+progressColumns+" FROM reading_progress WHERE user_id = ? ORDER BY id", func(rows *sql.Rows) error {
+		p, err := scanProgress(rows)
+		if err != nil {
+			return err
+		}
+		return fn(*p)
+	}, r.userID)
+}
+
+// Reviews reads the reviews in batches like Books, loading each batch's
+// edits after its rows are closed.
+func (r *sqlExportReader) Reviews(fn func(models.Review) error) error {
+	after := 0
+	for {
+		var batch []models.Review
+		index := make(map[int]int)
+		err := r.each(
+			"SELECT "+reviewColumns+" FROM reviews WHERE user_id = ? AND id > ? ORDER BY id LIMIT "+strconv.Itoa(bookBatchSize),
+			func(rows *sql.Rows) error {
+				review, err := scanReview(rows)
+				if err != nil {
+					return err
+				}
+				index[review.ID] = len(batch)
+				batch = append(batch, *review)
+				return nil
+			},
+			r.userID, after,
+		)
+		if err != nil || len(batch) == 0 {
+			return err
+		}
+		last := batch[len(batch)-1].ID
+
+		err = r.each(`
+			SELECT e.id, e.review_id, e.rating, e.body, e.spoiler, e.edited_at
+			FROM review_edits e
+			JOIN reviews rv ON rv.id = e.review_id
+			WHERE rv.user_id = ? AND rv.id > ? AND rv.id <= ?
+			ORDER BY e.edited_at, e.id
+		`, func(rows *sql.Rows) error {
+			edit, err := scanReviewEdit(rows)
+			if err != nil {
+				return err
+			}
+			review := &batch[index[edit.ReviewID]]
+			review.Edits = append(review.Edits, *edit)
+			return nil
+		}, r.userID, after, last)
+		if err != nil {
+			return err
+		}
+		if err := each(batch, fn); err != nil {
+			return err
+		}
+		if len(batch) < bookBatchSize {
+			return nil
+		}
+		after = last
+	}
+}
+
+func (r *sqlExportReader) Notes(fn func(models.Note) error) error {
+	return r.each("SELECT "+noteColumns+" FROM notes n WHERE n.user_id = ? ORDER BY n.id", func(rows *sql.Rows) error {
+		note, err := scanNote(rows)
+		if err != nil {
+			return err
+		}
+		return fn(*note)
+	}, r.userID)
+}
+
+// Shelves reads a row per shelf and book, handing on each shelf once its
+// last book has been read.
+func (r *sqlExportReader) Shelves(fn func(models.ExportShelf) error) error {
+	var shelf *models.ExportShelf
+	err := r.each(`
+		SELECT s.id, s.name, s.description, sb.book_id
+		FROM shelves s
+		LEFT JOIN shelf_books sb ON sb.shelf_id = s.id
+		WHERE s.user_id = ?
+		ORDER BY s.position, s.id, sb.position, sb.book_id
+	`, func(rows *sql.Rows) error {
+		var row models.ExportShelf
+		var bookID *int
+		if err := rows.Scan(&row.ID, &row.Name, &row.Description, &bookID); err != nil {
+			return err
+		}
+		if shelf == nil || shelf.ID != row.ID {
+			if shelf != nil {
+				if err := fn(*shelf); err != nil {
+					return err
+				}
+			}
+			row.BookIDs = []int{}
+			shelf = &row
+		}
+		if bookID != nil {
+			shelf.BookIDs = append(shelf.BookIDs, *bookID)
+		}
+		return nil
+	}, r.userID)
+	if err != nil || shelf == nil {
+		return err
+	}
+	return fn(*shelf)
+}
+
+func (r *sqlExportReader) SmartShelves(fn func(models.ExportSmartShelf) error) error {
+	return r.each(
+		"SELECT id, name, description, rules, created_at FROM smart_shelves WHERE user_id = ? ORDER BY id",
+		func(rows *sql.Rows) error {
+			shelf, err := scanSmartShelf(rows)
+			if err != nil {
+				return err
+			}
+			return fn(models.ExportSmartShelf{
+				ID:          shelf.ID,
+				Name:        shelf.Name,
+				Description: shelf.Description,
+				Rules:       shelf.Rules,
+			})
+		},
+		r.userID,
+	)
+}
+
+func (r *sqlExportReader) UserSettings() (*models.UserSettings, error) {
+	var settings models.UserSettings
+	err := r.tx.QueryRowContext(r.ctx, `
+		SELECT user_id, email_reminders_enabled, email_upcoming_reminders, email_overdue_reminders,
+			default_lending_days, yearly_reading_goal, created_at, updated_at
+		FROM user_settings
+		WHERE user_id = ?
+	`, r.userID).Scan(
+		&settings.UserID, &settings.EmailRemindersEnabled, &settings.EmailUpcomingReminders, &settings.EmailOverdueReminders,
+		&settings.DefaultLendingDays, &settings.YearlyReadingGoal, &settings.CreatedAt, &settings.UpdatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// restoreNote points an archived note at the restored book and session,
+// dropping a session that wasn't restored. It reports false if the book
+// wasn't.
+func restoreNote(note *models.Note, bookIDs, sessionIDs map[int]int) bool {
+	bookID, ok := bookIDs[note.BookID]
+	if !ok {
+		return false
+	}
+	note.BookID = bookID
+	if note.SessionID != nil {
+		if sessionID, ok := sessionIDs[*note.SessionID]; ok {
+			note.SessionID = &sessionID
+		} else {
+			note.SessionID = nil
+		}
+	}
+	return true
+}
+
+// sessionsByBook groups the archive's reading sessions by the archive ID of
+// their book.
+func sessionsByBook(archive *models.Export) map[int][]models.ReadingHistory {
+	sessions := make(map[int][]models.ReadingHistory)
+	for _, h := range archive.ReadingHistory {
+		sessions[h.BookID] = append(sessions[h.BookID], h)
+	}
+	return sessions
+}
+
+// bookKey identifies a book without an ISBN for duplicate detection during
+// restores.
+func bookKey(title, author string) string {
+	return strings.ToLower(strings.TrimSpace(title)) + "\x00" + strings.ToLower(strings.TrimSpace(author))
+}
+
+func (s *sqlExportStore) Restore(ctx context.Context, userID int, archive *models.Export, replace bool) (*models.RestoreResult, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		for _, table := range []string{"lending", "reading_history", "reading_status_changes", "shelves", "smart_shelves", "books"} {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	owned := make(map[string]bool)
+	rows, err := tx.QueryContext(ctx, "SELECT title, author, isbn FROM books WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var title, author, isbn string
+		if err := rows.Scan(&title, &author, &isbn); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if isbn != "" {
+			owned[isbn] = true
+		}
+		owned[bookKey(title, author)] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := &models.RestoreResult{}
+	now := time.Now()
+	bookIDs := make(map[int]int)
+	sessions := sessionsByBook(archive)
+	for _, book := range archive.Books {
+		key := book.ISBN
+		if key == "" {
+			key = bookKey(book.Title, book.Author)
+		}
+		if owned[key] {
+			result.BooksSkipped++
+			continue
+		}
+		owned[key] = true
+
+		archiveID := book.ID
+		reading.Settle(&book, sessions[archiveID])
+		err := insertBook(ctx, tx, userID, &book)
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrDuplicateISBN
+		}
+		if err != nil {
+			return nil, err
+		}
+		bookIDs[archiveID] = book.ID
+		result.BooksCreated++
+	}
+
+	for _, l := range archive.Lending {
+		bookID, ok := bookIDs[l.BookID]
+		if !ok {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO lending (book_id, user_id, lent_to, lent_at, due_date, returned_at, last_reminder_sent)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, bookID, userID, l.LentTo, l.LentAt, l.DueDate, l.ReturnedAt, l.LastReminderSent)
+		if err != nil {
+			return nil, err
+		}
+		result.LendingCreated++
+	}
+
+	sessionIDs := make(map[int]int)
+	for _, h := range archive.ReadingHistory {
+		bookID, ok := bookIDs[h.BookID]
+		if !ok {
+			continue
+		}
+		var sessionID int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO reading_history (book_id, user_id, started_at, completed_at, abandoned_at)
+			VALUES (?, ?, ?, ?, ?)
+			RETURNING id`,
+			bookID, userID, h.StartedAt, h.CompletedAt, h.AbandonedAt,
+		).Scan(&sessionID)
+		if err != nil {
+			return nil, err
+		}
+		sessionIDs[h.ID] = sessionID
+		result.ReadingHistoryCreated++
+	}
+
+	for _, c := range archive.StatusChanges {
+		bookID, ok := bookIDs[c.BookID]
+		if !ok {
+			continue
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO reading_status_changes (book_id, user_id, from_status, to_status, changed_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			bookID, userID, c.From, c.To, c.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.StatusChangesCreated++
+	}
+
+	for _, p := range archive.ReadingProgress {
+		sessionID, ok := sessionIDs[p.SessionID]
+		if !ok {
+			continue
+		}
+		p.SessionID = sessionID
+		if err := insertProgress(ctx, tx, userID, &p); err != nil {
+			return nil, err
+		}
+		result.ReadingProgressCreated++
+	}
+
+	for _, review := range archive.Reviews {
+		sessionID, ok := sessionIDs[review.SessionID]
+		if !ok {
+			continue
+		}
+		var reviewID int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO reviews (session_id, user_id, rating, body, spoiler, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)
+			RETURNING id`,
+			sessionID, userID, review.Rating, review.Body, boolToInt(review.Spoiler), review.CreatedAt, review.UpdatedAt,
+		).Scan(&reviewID)
+		if err != nil {
+			return nil, err
+		}
+		for _, edit := range review.Edits {
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO review_edits (review_id, rating, body, spoiler, edited_at)
+				VALUES (?, ?, ?, ?, ?)`,
+				reviewID, edit.Rating, edit.Body, boolToInt(edit.Spoiler), edit.EditedAt,
+			)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result.ReviewsCreated++
+	}
+
+	for _, note := range archive.Notes {
+		if !restoreNote(&note, bookIDs, sessionIDs) {
+			continue
+		}
+		if err := insertNote(ctx, tx, userID, &note, now); err != nil {
+			return nil, err
+		}
+		if note.ID != 0 {
+			result.NotesCreated++
+		}
+	}
+
+	for _, shelf := range archive.Shelves {
+		restored := models.Shelf{Name: shelf.Name, Description: shelf.Description}
+		if err := shelves.Validate(&restored); err != nil {
+			return nil, err
+		}
+		var shelfID int
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM shelves WHERE user_id = ? AND name_key = ?",
+			userID, shelves.Key(restored.Name),
+		).Scan(&shelfID)
+		if err = notFound(err); errors.Is(err, ErrNotFound) {
+			err := createShelf(ctx, tx, userID, &restored)
+			if errors.Is(err, ErrConflict) {
+				return nil, ErrDuplicateShelf
+			}
+			if err != nil {
+				return nil, err
+			}
+			shelfID = restored.ID
+			result.ShelvesCreated++
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, archiveID := range shelf.BookIDs {
+			bookID, ok := bookIDs[archiveID]
+			if !ok {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `
+				INSERT INTO shelf_books (shelf_id, book_id, position)
+				VALUES (?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM shelf_books WHERE shelf_id = ?))
+				ON CONFLICT DO NOTHING
+			`, shelfID, bookID, shelfID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, shelf := range archive.SmartShelves {
+		restored := models.SmartShelf{Name: shelf.Name, Description: shelf.Description, Rules: shelf.Rules}
+		if err := shelves.ValidateSmart(&restored); err != nil {
+			return nil, err
+		}
+		var id int
+		err := tx.QueryRowContext(ctx,
+			"SELECT id FROM smart_shelves WHERE user_id = ? AND name_key = ?",
+			userID, shelves.Key(restored.Name),
+		).Scan(&id)
+		if err == nil {
+			continue
+		}
+		if err = notFound(err); !errors.Is(err, ErrNotFound) {
+			return nil, err
+		}
+		err = createSmartShelf(ctx, tx, userID, &restored)
+		if errors.Is(err, ErrConflict) {
+			return nil, ErrDuplicateSmartShelf
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.SmartShelvesCreated++
+	}
+
+	if settings := archive.UserSettings; settings != nil {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO user_settings (
+				user_id, email_reminders_enabled, email_upcoming_reminders, email_overdue_reminders,
+				default_lending_days, yearly_reading_goal, created_at, updated_at
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET
+				email_reminders_enabled = excluded.email_reminders_enabled,
+				email_upcoming_reminders = excluded.email_upcoming_reminders,
+				email_overdue_reminders = excluded.email_overdue_reminders,
+				default_lending_days = excluded.default_lending_days,
+				yearly_reading_goal = excluded.yearly_reading_goal,
+				updated_at = excluded.updated_at
+		`,
+			userID, settings.EmailRemindersEnabled, settings.EmailUpcomingReminders, settings.EmailOverdueReminders,
+			settings.DefaultLendingDays, settings.YearlyReadingGoal, now, now,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.UserSettingsRestored = true
+	}
+
+	return result, tx.Commit()
+}
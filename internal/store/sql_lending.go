@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type sqlLendingStore struct {
+	db *sqlDB
+}
+
+func (s *sqlLendingStore) ListActive(ctx context.Context, userID int) ([]models.LendingWithBook, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT 
+			l.id, l.book_id, l.user_id, l.lent_to, l.lent_at, l.due_date,
+			b.id, b.title, b.author, b.isbn, b.genre, b.read, b.status
+		FROM lending l
+		JOIN books b ON l.book_id = b.id
+		WHERE l.user_id = ? AND l.returned_at IS NULL
+		ORDER BY l.lent_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lendings := []models.LendingWithBook{}
+	for rows.Next() {
+		var lending models.LendingWithBook
+		var book models.Book
+		var readInt int
+		var dueDate sql.NullTime
+
+		if err := rows.Scan(
+			&lending.ID, &lending.BookID, &lending.UserID, &lending.LentTo, &lending.LentAt, &dueDate,
+			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt, &book.Status,
+		); err != nil {
+			continue
+		}
+
+		book.Read = readInt == 1
+		lending.Book = &book
+
+		if dueDate.Valid {
+			lending.DueDate = &dueDate.Time
+		}
+
+		lendings = append(lendings, lending)
+	}
+	return lendings, rows.Err()
+}
+
+func (s *sqlLendingStore) ListHistory(ctx context.Context, userID, bookID int) ([]models.LendingWithBook, error) {
+	query := `
+		SELECT 
+			l.id, l.book_id, l.user_id, l.lent_to, l.lent_at, l.due_date, l.returned_at,
+			b.id, b.title, b.author, b.isbn, b.genre, b.read, b.status
+		FROM lending l
+		JOIN books b ON l.book_id = b.id
+		WHERE l.user_id = ?`
+	args := []any{userID}
+	if bookID != 0 {
+		query += " AND l.book_id = ?"
+		args = append(args, bookID)
+	}
+	query += " ORDER BY l.lent_at DESC"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.LendingWithBook{}
+	for rows.Next() {
+		var lending models.LendingWithBook
+		var book models.Book
+		var readInt int
+		var dueDate, returnedAt sql.NullTime
+
+		if err := rows.Scan(
+			&lending.ID, &lending.BookID, &lending.UserID, &lending.LentTo,
+			&lending.LentAt, &dueDate, &returnedAt,
+			&book.ID, &book.Title, &book.Author, &book.ISBN, &book.Genre, &readInt, &book.Status,
+		); err != nil {
+			continue
+		}
+
+		book.Read = readInt == 1
+		lending.Book = &book
+
+		if dueDate.Valid {
+			lending.DueDate = &dueDate.Time
+		}
+
+		history = append(history, lending)
+	}
+	return history, rows.Err()
+}
+
+func (s *sqlLendingStore) ActiveForBook(ctx context.Context, bookID int) (int, error) {
+	var id int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id FROM lending WHERE book_id = ? AND returned_at IS NULL",
+		bookID,
+	).Scan(&id)
+	return id, notFound(err)
+}
+
+func (s *sqlLendingStore) GetActive(ctx context.Context, lendingID int) (*models.Lending, error) {
+	var lending models.Lending
+	var dueDate, lastReminderSent sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, book_id, user_id, lent_to, lent_at, due_date, last_reminder_sent
+		FROM lending WHERE id = ? AND returned_at IS NULL
+	`, lendingID).Scan(
+		&lending.ID, &lending.BookID, &lending.UserID, &lending.LentTo,
+		&lending.LentAt, &dueDate, &lastReminderSent,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if dueDate.Valid {
+		lending.DueDate = &dueDate.Time
+	}
+	if lastReminderSent.Valid {
+		lending.LastReminderSent = &lastReminderSent.Time
+	}
+	return &lending, nil
+}
+
+func (s *sqlLendingStore) Create(ctx context.Context, lending *models.Lending) error {
+	return s.db.QueryRowContext(ctx,
+		"INSERT INTO lending (book_id, user_id, lent_to, due_date) VALUES (?, ?, ?, ?) RETURNING id, lent_at",
+		lending.BookID, lending.UserID, lending.LentTo, lending.DueDate,
+	).Scan(&lending.ID, &lending.LentAt)
+}
+
+func (s *sqlLendingStore) MarkReturned(ctx context.Context, lendingID int, at time.Time) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE lending SET returned_at = ? WHERE id = ? AND returned_at IS NULL",
+		at.UTC(), lendingID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+// reminderQuery selects lendings for reminder emails; callers append their
+// own conditions.
+const reminderQuery = `
+	SELECT 
+		l.id,
+		l.user_id,
+		u.email,
+		b.title,
+		b.author,
+		l.lent_to,
+		l.due_date,
+		l.lent_at,
+		l.last_reminder_sent
+	FROM lending l
+	JOIN users u ON l.user_id = u.id
+	JOIN books b ON l.book_id = b.id
+	LEFT JOIN user_settings us ON u.id = us.user_id
+	WHERE l.returned_at IS NULL
+	AND l.due_date IS NOT NULL
+	AND (l.last_reminder_sent IS NULL OR l.last_reminder_sent < ?)
+	AND (us.email_reminders_enabled IS NULL OR us.email_reminders_enabled = ?)
+`
+
+func (s *sqlLendingStore) ListUpcomingReminders(ctx context.Context, dueFrom, dueTo, remindedBefore time.Time) ([]models.ReminderLending, error) {
+	return s.listReminders(ctx, reminderQuery+`
+		AND l.due_date >= ? AND l.due_date < ?
+		AND (us.email_upcoming_reminders IS NULL OR us.email_upcoming_reminders = ?)
+	`, remindedBefore.UTC(), true, dueFrom.UTC(), dueTo.UTC(), true)
+}
+
+func (s *sqlLendingStore) ListOverdueReminders(ctx context.Context, dueBefore, remindedBefore time.Time) ([]models.ReminderLending, error) {
+	return s.listReminders(ctx, reminderQuery+`
+		AND l.due_date < ?
+		AND (us.email_overdue_reminders IS NULL OR us.email_overdue_reminders = ?)
+		ORDER BY l.user_id, l.due_date
+	`, remindedBefore.UTC(), true, dueBefore.UTC(), true)
+}
+
+func (s *sqlLendingStore) listReminders(ctx context.Context, query string, args ...any) ([]models.ReminderLending, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lendings := []models.ReminderLending{}
+	for rows.Next() {
+		var lending models.ReminderLending
+		if err := rows.Scan(
+			&lending.LendingID,
+			&lending.UserID,
+			&lending.UserEmail,
+			&lending.BookTitle,
+			&lending.BookAuthor,
+			&lending.LentTo,
+			&lending.DueDate,
+			&lending.LentAt,
+			&lending.LastReminderSent,
+		); err != nil {
+			return nil, err
+		}
+		lendings = append(lendings, lending)
+	}
+	return lendings, rows.Err()
+}
+
+func (s *sqlLendingStore) MarkReminderSent(ctx context.Context, lendingID int, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, "UPDATE lending SET last_reminder_sent = ? WHERE id = ?", at.UTC(), lendingID)
+	return err
+}
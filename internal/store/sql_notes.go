@@ -0,0 +1,288 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"booklib/internal/dialect"
+	"booklib/internal/models"
+)
+
+type sqlNoteStore struct {
+	db *sqlDB
+}
+
+const noteColumns = "n.id, n.book_id, n.session_id, n.type, n.page, n.location, n.body, n.import_key, n.created_at, " +
+	"n.updated_at"
+
+func scanNote(row interface{ Scan(...any) error }, extra ...any) (*models.Note, error) {
+	var note models.Note
+	dest := []any{&note.ID, &note.BookID, &note.SessionID, &note.Type, &note.Page, &note.Location, &note.Body,
+		&note.ImportKey, &note.CreatedAt, &note.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, notFound(err)
+	}
+	return &note, nil
+}
+
+func (s *sqlNoteStore) ListForBook(ctx context.Context, userID, bookID int) ([]models.Note, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+noteColumns+`
+		FROM notes n
+		WHERE n.book_id = ? AND n.user_id = ?
+		ORDER BY n.page IS NULL, n.page, n.location IS NULL, n.location, n.created_at, n.id
+	`, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Note{}
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *note)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlNoteStore) Get(ctx context.Context, userID, noteID int) (*models.Note, error) {
+	return getNote(ctx, s.db, userID, noteID)
+}
+
+func getNote(ctx context.Context, db sqlConn, userID, noteID int) (*models.Note, error) {
+	return scanNote(db.QueryRowContext(ctx,
+		"SELECT "+noteColumns+" FROM notes n WHERE n.id = ? AND n.user_id = ?",
+		noteID, userID,
+	))
+}
+
+// checkNoteSession checks that the note's session, if any, is one of its
+// book's.
+func checkNoteSession(ctx context.Context, db sqlConn, userID int, note *models.Note) error {
+	if note.SessionID == nil {
+		return nil
+	}
+	var id int
+	err := db.QueryRowContext(ctx,
+		"SELECT id FROM reading_history WHERE id = ? AND book_id = ? AND user_id = ?",
+		*note.SessionID, note.BookID, userID,
+	).Scan(&id)
+	return notFound(err)
+}
+
+func (s *sqlNoteStore) Create(ctx context.Context, userID int, note *models.Note, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM books WHERE id = ? AND user_id = ?", note.BookID, userID).Scan(&id)
+	if err != nil {
+		return notFound(err)
+	}
+	if err := checkNoteSession(ctx, tx, userID, note); err != nil {
+		return err
+	}
+	if err := insertNote(ctx, tx, userID, note, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertNote writes a note checked to be the user's, stamped at unless it
+// has its own times. A note whose import key the user already has is
+// skipped, leaving its ID zero.
+func insertNote(ctx context.Context, db sqlConn, userID int, note *models.Note, at time.Time) error {
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = at
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = note.CreatedAt
+	}
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO notes (book_id, user_id, session_id, type, page, location, body, import_key, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+		RETURNING id`,
+		note.BookID, userID, note.SessionID, note.Type, note.Page, note.Location, note.Body, note.ImportKey,
+		note.CreatedAt, note.UpdatedAt,
+	).Scan(&note.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		note.ID = 0
+		return nil
+	}
+	return err
+}
+
+func (s *sqlNoteStore) ImportKeys(ctx context.Context, userID int) (map[string]bool, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT import_key FROM notes WHERE user_id = ? AND import_key IS NOT NULL", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys[key] = true
+	}
+	return keys, rows.Err()
+}
+
+func (s *sqlNoteStore) Import(ctx context.Context, userID int, list []*models.Note, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	owned := make(map[int]bool)
+	for _, note := range list {
+		if !owned[note.BookID] {
+			var id int
+			err := tx.QueryRowContext(ctx, "SELECT id FROM books WHERE id = ? AND user_id = ?", note.BookID, userID).Scan(&id)
+			if err != nil {
+				return notFound(err)
+			}
+			owned[note.BookID] = true
+		}
+		if err := checkNoteSession(ctx, tx, userID, note); err != nil {
+			return err
+		}
+		if err := insertNote(ctx, tx, userID, note, at); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlNoteStore) Update(ctx context.Context, userID int, note *models.Note, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	existing, err := getNote(ctx, tx, userID, note.ID)
+	if err != nil {
+		return err
+	}
+	note.BookID = existing.BookID
+	if err := checkNoteSession(ctx, tx, userID, note); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE notes SET session_id = ?, type = ?, page = ?, location = ?, body = ?, updated_at = ? WHERE id = ?",
+		note.SessionID, note.Type, note.Page, note.Location, note.Body, at, note.ID,
+	)
+	if err != nil {
+		return err
+	}
+	updated, err := getNote(ctx, tx, userID, note.ID)
+	if err != nil {
+		return err
+	}
+	*note = *updated
+	return tx.Commit()
+}
+
+func (s *sqlNoteStore) Delete(ctx context.Context, userID, noteID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM notes WHERE id = ? AND user_id = ?", noteID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+// searchSource returns a subquery yielding (id, score, snippet) for the
+// user's notes whose bodies match every term as a prefix, along with its
+// arguments, like sqlBookStore.searchSource.
+func (s *sqlNoteStore) searchSource(userID int, terms []string) (string, []any) {
+	if s.db.dialect == dialect.Postgres {
+		prefixes := make([]string, len(terms))
+		for i, term := range terms {
+			prefixes[i] = term + ":*"
+		}
+		return `(
+			SELECT id,
+				(-ts_rank(search, query))::float8 AS score,
+				ts_headline('simple', body, query,
+					'StartSel=' || chr(2) || ', StopSel=' || chr(3) || ', MaxFragments=1, MaxWords=20, MinWords=5') AS snippet
+			FROM notes, to_tsquery('simple', ?) query
+			WHERE search @@ query AND user_id = ?
+		)`, []any{strings.Join(prefixes, " & "), userID}
+	}
+
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+	return `(
+		SELECT rowid AS id,
+			bm25(notes_fts) AS score,
+			snippet(notes_fts, 0, char(2), char(3), '…', 12) AS snippet
+		FROM notes_fts
+		WHERE notes_fts MATCH ? AND rowid IN (SELECT id FROM notes WHERE user_id = ?)
+	)`, []any{strings.Join(phrases, " "), userID}
+}
+
+func (s *sqlNoteStore) Search(ctx context.Context, userID int, q NoteQuery) ([]models.NoteMatch, error) {
+	matches := []models.NoteMatch{}
+	terms := searchTerms(q.Search)
+	if len(terms) == 0 {
+		return matches, nil
+	}
+
+	source, args := s.searchSource(userID, terms)
+	where := "n.user_id = ?"
+	args = append(args, userID)
+	if q.BookID != 0 {
+		where += " AND n.book_id = ?"
+		args = append(args, q.BookID)
+	}
+	if q.Type != "" {
+		where += " AND n.type = ?"
+		args = append(args, q.Type)
+	}
+	query := `
+		SELECT ` + noteColumns + `, b.title, m.snippet
+		FROM notes n
+		JOIN ` + source + ` m ON m.id = n.id
+		JOIN books b ON b.id = n.book_id
+		WHERE ` + where + `
+		ORDER BY m.score, n.id`
+	if q.Limit > 0 {
+		query += " LIMIT " + strconv.Itoa(q.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var match models.NoteMatch
+		note, err := scanNote(rows, &match.BookTitle, &match.Snippet)
+		if err != nil {
+			return nil, err
+		}
+		match.Note = *note
+		match.Snippet = highlight(match.Snippet)
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
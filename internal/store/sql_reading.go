@@ -0,0 +1,566 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/reading"
+)
+
+type sqlReadingStore struct {
+	db *sqlDB
+}
+
+const readingColumns = "id, book_id, user_id, started_at, completed_at, abandoned_at"
+
+// inProgress is the condition on reading_history for sessions in progress.
+const inProgress = "completed_at IS NULL AND abandoned_at IS NULL"
+
+func scanReading(row interface{ Scan(...any) error }) (*models.ReadingHistory, error) {
+	var history models.ReadingHistory
+	err := row.Scan(&history.ID, &history.BookID, &history.UserID, &history.StartedAt, &history.CompletedAt,
+		&history.AbandonedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &history, nil
+}
+
+func (s *sqlReadingStore) Get(ctx context.Context, historyID int) (*models.ReadingHistory, error) {
+	return scanReading(s.db.QueryRowContext(ctx,
+		"SELECT "+readingColumns+" FROM reading_history WHERE id = ?",
+		historyID,
+	))
+}
+
+func (s *sqlReadingStore) ListForBook(ctx context.Context, userID, bookID int) ([]models.ReadingHistory, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+readingColumns+`
+		FROM reading_history
+		WHERE book_id = ? AND user_id = ?
+		ORDER BY started_at DESC
+	`, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []models.ReadingHistory{}
+	for rows.Next() {
+		h, err := scanReading(rows)
+		if err != nil {
+			continue
+		}
+		history = append(history, *h)
+	}
+	return history, rows.Err()
+}
+
+func (s *sqlReadingStore) Active(ctx context.Context, userID, bookID int) (*models.ReadingHistory, error) {
+	return activeSession(ctx, s.db, userID, bookID)
+}
+
+func activeSession(ctx context.Context, db sqlConn, userID, bookID int) (*models.ReadingHistory, error) {
+	return scanReading(db.QueryRowContext(ctx, `
+		SELECT `+readingColumns+`
+		FROM reading_history
+		WHERE book_id = ? AND user_id = ? AND `+inProgress+`
+		ORDER BY started_at DESC LIMIT 1
+	`, bookID, userID))
+}
+
+func (s *sqlReadingStore) Start(ctx context.Context, userID, bookID int, at time.Time) (*models.ReadingHistory, error) {
+	change, err := s.SetStatus(ctx, userID, bookID, reading.Reading, at)
+	if err != nil {
+		return nil, err
+	}
+	return change.Session, nil
+}
+
+func (s *sqlReadingStore) Finish(ctx context.Context, historyID int, review *models.Review, at time.Time) (*models.ReadingHistory, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	history, err := scanReading(tx.QueryRowContext(ctx,
+		"SELECT "+readingColumns+" FROM reading_history WHERE id = ?",
+		historyID,
+	))
+	if err != nil {
+		return nil, err
+	}
+	change, err := setStatus(ctx, tx, history.UserID, history.BookID, reading.Finished, at)
+	if err != nil {
+		return nil, err
+	}
+	if review != nil {
+		review.SessionID = history.ID
+		if err := saveReview(ctx, tx, history.UserID, review, at); err != nil {
+			return nil, err
+		}
+	}
+	return change.Session, tx.Commit()
+}
+
+func (s *sqlReadingStore) SetStatus(ctx context.Context, userID, bookID int, status string, at time.Time) (*models.StatusChange, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change, err := setStatus(ctx, tx, userID, bookID, status, at)
+	if err != nil {
+		return nil, err
+	}
+	return change, tx.Commit()
+}
+
+// setStatus moves the book to status within tx, see
+// ReadingStore.SetStatus.
+func setStatus(ctx context.Context, tx *sqlTx, userID, bookID int, status string, at time.Time) (*models.StatusChange, error) {
+	change := &models.StatusChange{BookID: bookID, To: status, ChangedAt: at}
+	err := tx.QueryRowContext(ctx,
+		"SELECT status FROM books WHERE id = ? AND user_id = ?",
+		bookID, userID,
+	).Scan(&change.From)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if !reading.CanMove(change.From, status) {
+		return nil, reading.ErrInvalidTransition
+	}
+
+	switch {
+	case status == reading.Reading && change.From != reading.Paused:
+		change.Session, err = scanReading(tx.QueryRowContext(ctx, `
+			INSERT INTO reading_history (book_id, user_id, started_at)
+			VALUES (?, ?, ?)
+			RETURNING `+readingColumns,
+			bookID, userID, at,
+		))
+	case status == reading.Finished || status == reading.DidNotFinish:
+		column := "completed_at"
+		if status == reading.DidNotFinish {
+			column = "abandoned_at"
+		}
+		change.Session, err = scanReading(tx.QueryRowContext(ctx, `
+			UPDATE reading_history SET `+column+` = ?
+			WHERE book_id = ? AND user_id = ? AND `+inProgress+`
+			RETURNING `+readingColumns,
+			at, bookID, userID,
+		))
+	case status != reading.WantToRead:
+		change.Session, err = activeSession(ctx, tx, userID, bookID)
+	}
+	// Books whose session went missing still move
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+
+	change.ID, err = recordStatus(ctx, tx, userID, bookID, change.From, status, at)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := refreshRead(ctx, tx, bookID); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// recordStatus moves the book to status and records the change, returning
+// its ID. Callers refresh the read flag once its sessions are settled.
+func recordStatus(ctx context.Context, tx *sqlTx, userID, bookID int, from, status string, at time.Time) (int, error) {
+	if _, err := tx.ExecContext(ctx,
+		"UPDATE books SET status = ?, status_changed_at = ? WHERE id = ?",
+		status, at, bookID,
+	); err != nil {
+		return 0, err
+	}
+	var id int
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO reading_status_changes (book_id, user_id, from_status, to_status, changed_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id`,
+		bookID, userID, from, status, at,
+	).Scan(&id)
+	return id, err
+}
+
+// refreshRead sets the book's read flag from its status and sessions as
+// reading.Read does, and returns it.
+func refreshRead(ctx context.Context, tx *sqlTx, bookID int) (bool, error) {
+	var read int
+	err := tx.QueryRowContext(ctx, `
+		UPDATE books SET read = CASE WHEN status = ? OR EXISTS (
+			SELECT 1 FROM reading_history h WHERE h.book_id = books.id AND h.completed_at IS NOT NULL
+		) THEN 1 ELSE 0 END
+		WHERE id = ?
+		RETURNING read`,
+		reading.Finished, bookID,
+	).Scan(&read)
+	return read == 1, err
+}
+
+// bookSessions returns the status of the user's book and all its sessions.
+func bookSessions(ctx context.Context, tx *sqlTx, userID, bookID int) (string, []models.ReadingHistory, error) {
+	var status string
+	err := tx.QueryRowContext(ctx, "SELECT status FROM books WHERE id = ? AND user_id = ?", bookID, userID).Scan(&status)
+	if err != nil {
+		return "", nil, notFound(err)
+	}
+	rows, err := tx.QueryContext(ctx,
+		"SELECT "+readingColumns+" FROM reading_history WHERE book_id = ? AND user_id = ?",
+		bookID, userID,
+	)
+	if err != nil {
+		return "", nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.ReadingHistory
+	for rows.Next() {
+		h, err := scanReading(rows)
+		if err != nil {
+			return "", nil, err
+		}
+		sessions = append(sessions, *h)
+	}
+	return status, sessions, rows.Err()
+}
+
+// settleSessions moves the book in status to the one derived from its
+// sessions, if that differs, and refreshes its read flag, returning both.
+// The move is stamped with when the sessions reached the status, or at if
+// the book has none left.
+func settleSessions(ctx context.Context, tx *sqlTx, userID, bookID int, status string, sessions []models.ReadingHistory, at time.Time) (models.ReadState, error) {
+	derived, since := reading.Derive(status, sessions)
+	if since != nil {
+		at = *since
+	}
+	state := models.ReadState{Status: derived}
+	if state.Status != status {
+		if _, err := recordStatus(ctx, tx, userID, bookID, status, state.Status, at); err != nil {
+			return models.ReadState{}, err
+		}
+	}
+	var err error
+	state.Read, err = refreshRead(ctx, tx, bookID)
+	return state, err
+}
+
+func (s *sqlReadingStore) LogSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	defer tx.Rollback()
+
+	status, sessions, err := bookSessions(ctx, tx, userID, session.BookID)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	if reading.Overlaps(*session, sessions) {
+		return models.ReadState{}, reading.ErrOverlap
+	}
+	logged, err := scanReading(tx.QueryRowContext(ctx, `
+		INSERT INTO reading_history (book_id, user_id, started_at, completed_at, abandoned_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING `+readingColumns,
+		session.BookID, userID, session.StartedAt, session.CompletedAt, session.AbandonedAt,
+	))
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	*session = *logged
+
+	state, err := settleSessions(ctx, tx, userID, session.BookID, status, append(sessions, *session), at)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	return state, tx.Commit()
+}
+
+func (s *sqlReadingStore) EditSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanReading(tx.QueryRowContext(ctx,
+		"SELECT "+readingColumns+" FROM reading_history WHERE id = ? AND user_id = ?",
+		session.ID, userID,
+	))
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	status, sessions, err := bookSessions(ctx, tx, userID, existing.BookID)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	session.BookID = existing.BookID
+	if reading.Overlaps(*session, sessions) {
+		return models.ReadState{}, reading.ErrOverlap
+	}
+	edited, err := scanReading(tx.QueryRowContext(ctx, `
+		UPDATE reading_history SET started_at = ?, completed_at = ?, abandoned_at = ?
+		WHERE id = ?
+		RETURNING `+readingColumns,
+		session.StartedAt, session.CompletedAt, session.AbandonedAt, session.ID,
+	))
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	*session = *edited
+	for i := range sessions {
+		if sessions[i].ID == session.ID {
+			sessions[i] = *session
+		}
+	}
+
+	state, err := settleSessions(ctx, tx, userID, session.BookID, status, sessions, at)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	return state, tx.Commit()
+}
+
+func (s *sqlReadingStore) DeleteSession(ctx context.Context, userID, historyID int, at time.Time) (models.ReadState, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	defer tx.Rollback()
+
+	existing, err := scanReading(tx.QueryRowContext(ctx,
+		"SELECT "+readingColumns+" FROM reading_history WHERE id = ? AND user_id = ?",
+		historyID, userID,
+	))
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	status, sessions, err := bookSessions(ctx, tx, userID, existing.BookID)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	// Progress and the review go with the session; notes stay on the book
+	if _, err := tx.ExecContext(ctx, "DELETE FROM reading_history WHERE id = ?", historyID); err != nil {
+		return models.ReadState{}, err
+	}
+	sessions = slices.DeleteFunc(sessions, func(h models.ReadingHistory) bool { return h.ID == historyID })
+
+	state, err := settleSessions(ctx, tx, userID, existing.BookID, status, sessions, at)
+	if err != nil {
+		return models.ReadState{}, err
+	}
+	return state, tx.Commit()
+}
+
+func (s *sqlReadingStore) StatusChanges(ctx context.Context, userID, bookID int) ([]models.StatusChange, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, book_id, from_status, to_status, changed_at
+		FROM reading_status_changes
+		WHERE book_id = ? AND user_id = ?
+		ORDER BY changed_at, id
+	`, bookID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.StatusChange{}
+	for rows.Next() {
+		var change models.StatusChange
+		if err := rows.Scan(&change.ID, &change.BookID, &change.From, &change.To, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+const progressColumns = "id, session_id, page, location, location_total, percent, recorded_at"
+
+func scanProgress(row interface{ Scan(...any) error }) (*models.ReadingProgress, error) {
+	var progress models.ReadingProgress
+	err := row.Scan(&progress.ID, &progress.SessionID, &progress.Page, &progress.Location, &progress.LocationTotal,
+		&progress.Percent, &progress.RecordedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &progress, nil
+}
+
+func (s *sqlReadingStore) AddProgress(ctx context.Context, userID int, progress *models.ReadingProgress) error {
+	return insertProgress(ctx, s.db, userID, progress)
+}
+
+func insertProgress(ctx context.Context, db sqlConn, userID int, progress *models.ReadingProgress) error {
+	return db.QueryRowContext(ctx, `
+		INSERT INTO reading_progress (session_id, user_id, page, location, location_total, percent, recorded_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id`,
+		progress.SessionID, userID, progress.Page, progress.Location, progress.LocationTotal, progress.Percent,
+		progress.RecordedAt,
+	).Scan(&progress.ID)
+}
+
+func (s *sqlReadingStore) Progress(ctx context.Context, historyID int) ([]models.ReadingProgress, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+progressColumns+`
+		FROM reading_progress
+		WHERE session_id = ?
+		ORDER BY recorded_at, id
+	`, historyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	progress := []models.ReadingProgress{}
+	for rows.Next() {
+		p, err := scanProgress(rows)
+		if err != nil {
+			return nil, err
+		}
+		progress = append(progress, *p)
+	}
+	return progress, rows.Err()
+}
+
+const reviewColumns = "id, session_id, rating, body, spoiler, created_at, updated_at"
+
+func scanReview(row interface{ Scan(...any) error }) (*models.Review, error) {
+	var review models.Review
+	var spoiler int
+	err := row.Scan(&review.ID, &review.SessionID, &review.Rating, &review.Body, &spoiler, &review.CreatedAt,
+		&review.UpdatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	review.Spoiler = spoiler == 1
+	review.Edits = []models.ReviewEdit{}
+	return &review, nil
+}
+
+const reviewEditColumns = "id, review_id, rating, body, spoiler, edited_at"
+
+func scanReviewEdit(row interface{ Scan(...any) error }) (*models.ReviewEdit, error) {
+	var edit models.ReviewEdit
+	var spoiler int
+	if err := row.Scan(&edit.ID, &edit.ReviewID, &edit.Rating, &edit.Body, &spoiler, &edit.EditedAt); err != nil {
+		return nil, err
+	}
+	edit.Spoiler = spoiler == 1
+	return &edit, nil
+}
+
+func (s *sqlReadingStore) Review(ctx context.Context, historyID int) (*models.Review, error) {
+	return sessionReview(ctx, s.db, historyID)
+}
+
+// sessionReview returns the session's review with its edits.
+func sessionReview(ctx context.Context, db sqlConn, historyID int) (*models.Review, error) {
+	review, err := scanReview(db.QueryRowContext(ctx,
+		"SELECT "+reviewColumns+" FROM reviews WHERE session_id = ?",
+		historyID,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT `+reviewEditColumns+`
+		FROM review_edits
+		WHERE review_id = ?
+		ORDER BY edited_at, id
+	`, review.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		edit, err := scanReviewEdit(rows)
+		if err != nil {
+			return nil, err
+		}
+		review.Edits = append(review.Edits, *edit)
+	}
+	return review, rows.Err()
+}
+
+func (s *sqlReadingStore) SaveReview(ctx context.Context, userID int, review *models.Review, at time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := saveReview(ctx, tx, userID, review, at); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// saveReview writes the review of the user's session as SaveReview does.
+func saveReview(ctx context.Context, tx *sqlTx, userID int, review *models.Review, at time.Time) error {
+	var exists int
+	err := tx.QueryRowContext(ctx,
+		"SELECT 1 FROM reading_history WHERE id = ? AND user_id = ?",
+		review.SessionID, userID,
+	).Scan(&exists)
+	if err != nil {
+		return notFound(err)
+	}
+
+	existing, err := scanReview(tx.QueryRowContext(ctx,
+		"SELECT "+reviewColumns+" FROM reviews WHERE session_id = ?",
+		review.SessionID,
+	))
+	switch {
+	case errors.Is(err, ErrNotFound):
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO reviews (session_id, user_id, rating, body, spoiler, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			review.SessionID, userID, review.Rating, review.Body, boolToInt(review.Spoiler), at, at,
+		)
+	case err == nil:
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO review_edits (review_id, rating, body, spoiler, edited_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			existing.ID, existing.Rating, existing.Body, boolToInt(existing.Spoiler), at,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE reviews SET rating = ?, body = ?, spoiler = ?, updated_at = ? WHERE id = ?",
+			review.Rating, review.Body, boolToInt(review.Spoiler), at, existing.ID,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	saved, err := sessionReview(ctx, tx, review.SessionID)
+	if err != nil {
+		return err
+	}
+	*review = *saved
+	return nil
+}
+
+func (s *sqlReadingStore) DeleteReview(ctx context.Context, historyID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM reviews WHERE session_id = ?", historyID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type sqlSettingsStore struct {
+	db *sqlDB
+}
+
+func (s *sqlSettingsStore) GetUserSettings(ctx context.Context, userID int) (*models.UserSettings, error) {
+	var settings models.UserSettings
+	err := s.db.QueryRowContext(ctx, `
+		SELECT 
+			user_id,
+			email_reminders_enabled,
+			email_upcoming_reminders,
+			email_overdue_reminders,
+			default_lending_days,
+			yearly_reading_goal,
+			created_at,
+			updated_at
+		FROM user_settings
+		WHERE user_id = ?
+	`, userID).Scan(
+		&settings.UserID,
+		&settings.EmailRemindersEnabled,
+		&settings.EmailUpcomingReminders,
+		&settings.EmailOverdueReminders,
+		&settings.DefaultLendingDays,
+		&settings.YearlyReadingGoal,
+		&settings.CreatedAt,
+		&settings.UpdatedAt,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &settings, nil
+}
+
+func (s *sqlSettingsStore) CreateUserSettings(ctx context.Context, settings *models.UserSettings) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO user_settings (
+			user_id,
+			email_reminders_enabled,
+			email_upcoming_reminders,
+			email_overdue_reminders,
+			default_lending_days,
+			yearly_reading_goal,
+			created_at,
+			updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`,
+		settings.UserID,
+		settings.EmailRemindersEnabled,
+		settings.EmailUpcomingReminders,
+		settings.EmailOverdueReminders,
+		settings.DefaultLendingDays,
+		settings.YearlyReadingGoal,
+		settings.CreatedAt,
+		settings.UpdatedAt,
+	)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlSettingsStore) UpdateUserSettings(ctx context.Context, userID int, req models.UpdateUserSettingsRequest, at time.Time) error {
+	// Build dynamic update query
+	query := "UPDATE user_settings SET updated_at = ?"
+	args := []any{at}
+
+	if req.EmailRemindersEnabled != nil {
+		query += ", email_reminders_enabled = ?"
+		args = append(args, *req.EmailRemindersEnabled)
+	}
+	if req.EmailUpcomingReminders != nil {
+		query += ", email_upcoming_reminders = ?"
+		args = append(args, *req.EmailUpcomingReminders)
+	}
+	if req.EmailOverdueReminders != nil {
+		query += ", email_overdue_reminders = ?"
+		args = append(args, *req.EmailOverdueReminders)
+	}
+	if req.DefaultLendingDays != nil {
+		query += ", default_lending_days = ?"
+		args = append(args, *req.DefaultLendingDays)
+	}
+	if req.YearlyReadingGoal != nil {
+		query += ", yearly_reading_goal = ?"
+		args = append(args, *req.YearlyReadingGoal)
+	}
+
+	query += " WHERE user_id = ?"
+	args = append(args, userID)
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlSettingsStore) GetAppSetting(ctx context.Context, key string) (string, error) {
+	var value string
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	return value, notFound(err)
+}
+
+func (s *sqlSettingsStore) ListAppSettings(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			continue
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+func (s *sqlSettingsStore) SetAppSetting(ctx context.Context, key, value string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO settings (key, value, updated_at) 
+		VALUES (?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET 
+			value = excluded.value,
+			updated_at = CURRENT_TIMESTAMP
+	`, key, value)
+	return err
+}
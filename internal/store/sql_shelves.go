@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"slices"
+
+	"booklib/internal/models"
+	"booklib/internal/shelves"
+)
+
+type sqlShelfStore struct {
+	db *sqlDB
+}
+
+func (s *sqlShelfStore) List(ctx context.Context, userID int) ([]models.Shelf, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.id, s.name, s.description, s.created_at, COUNT(sb.book_id)
+		FROM shelves s
+		LEFT JOIN shelf_books sb ON sb.shelf_id = s.id
+		WHERE s.user_id = ?
+		GROUP BY s.id, s.name, s.description, s.position, s.created_at
+		ORDER BY s.position, s.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.Shelf{}
+	for rows.Next() {
+		var shelf models.Shelf
+		if err := rows.Scan(&shelf.ID, &shelf.Name, &shelf.Description, &shelf.CreatedAt, &shelf.BookCount); err != nil {
+			return nil, err
+		}
+		list = append(list, shelf)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlShelfStore) Get(ctx context.Context, userID, shelfID int) (*models.ShelfDetail, error) {
+	detail := &models.ShelfDetail{Books: []models.Book{}}
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, name, description, created_at FROM shelves WHERE id = ? AND user_id = ?",
+		shelfID, userID,
+	).Scan(&detail.ID, &detail.Name, &detail.Description, &detail.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+bookColumns+`
+		FROM shelf_books sb
+		JOIN books b ON b.id = sb.book_id
+		WHERE sb.shelf_id = ?
+		ORDER BY sb.position, sb.book_id`, shelfID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		detail.Books = append(detail.Books, *book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	detail.BookCount = len(detail.Books)
+	return detail, loadRelations(ctx, s.db, detail.Books)
+}
+
+func (s *sqlShelfStore) Create(ctx context.Context, userID int, shelf *models.Shelf) error {
+	return createShelf(ctx, s.db, userID, shelf)
+}
+
+// createShelf inserts the shelf after the user's other shelves.
+func createShelf(ctx context.Context, db sqlConn, userID int, shelf *models.Shelf) error {
+	err := db.QueryRowContext(ctx, `
+		INSERT INTO shelves (user_id, name, name_key, description, position)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(position), -1) + 1 FROM shelves WHERE user_id = ?))
+		RETURNING id, created_at`,
+		userID, shelf.Name, shelves.Key(shelf.Name), shelf.Description, userID,
+	).Scan(&shelf.ID, &shelf.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlShelfStore) Update(ctx context.Context, userID int, shelf *models.Shelf) error {
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE shelves SET name = ?, name_key = ?, description = ?
+		WHERE id = ? AND user_id = ?
+		RETURNING created_at, (SELECT COUNT(*) FROM shelf_books WHERE shelf_id = shelves.id)`,
+		shelf.Name, shelves.Key(shelf.Name), shelf.Description, shelf.ID, userID,
+	).Scan(&shelf.CreatedAt, &shelf.BookCount)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return notFound(err)
+}
+
+func (s *sqlShelfStore) Delete(ctx context.Context, userID, shelfID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM shelves WHERE id = ? AND user_id = ?", shelfID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlShelfStore) Reorder(ctx context.Context, userID int, shelfIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := queryIDs(ctx, tx, "SELECT id FROM shelves WHERE user_id = ?", userID)
+	if err != nil {
+		return err
+	}
+	if !samePermutation(current, shelfIDs) {
+		return ErrConflict
+	}
+	for i, id := range shelfIDs {
+		if _, err := tx.ExecContext(ctx, "UPDATE shelves SET position = ? WHERE id = ?", i, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// shelfBookIDs returns the IDs of the books on the user's shelf in shelf
+// order.
+func shelfBookIDs(ctx context.Context, db sqlConn, userID, shelfID int) ([]int, error) {
+	var id int
+	err := db.QueryRowContext(ctx, "SELECT id FROM shelves WHERE id = ? AND user_id = ?", shelfID, userID).Scan(&id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return queryIDs(ctx, db, "SELECT book_id FROM shelf_books WHERE shelf_id = ? ORDER BY position, book_id", shelfID)
+}
+
+// writeShelfOrder numbers the shelf's books in the given order.
+func writeShelfOrder(ctx context.Context, db sqlConn, shelfID int, bookIDs []int) error {
+	for i, bookID := range bookIDs {
+		_, err := db.ExecContext(ctx,
+			"UPDATE shelf_books SET position = ? WHERE shelf_id = ? AND book_id = ?",
+			i, shelfID, bookID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlShelfStore) AddBook(ctx context.Context, userID, shelfID, bookID, position int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	bookIDs, err := shelfBookIDs(ctx, tx, userID, shelfID)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(bookIDs, bookID) {
+		return ErrConflict
+	}
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM books WHERE id = ? AND user_id = ?", bookID, userID).Scan(&id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	if position < 0 || position > len(bookIDs) {
+		position = len(bookIDs)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO shelf_books (shelf_id, book_id, position) VALUES (?, ?, ?)",
+		shelfID, bookID, position,
+	)
+	if err != nil {
+		return err
+	}
+	if position < len(bookIDs) {
+		if err := writeShelfOrder(ctx, tx, shelfID, slices.Insert(bookIDs, position, bookID)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlShelfStore) RemoveBook(ctx context.Context, userID, shelfID, bookID int) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM shelf_books
+		WHERE shelf_id = ? AND book_id = ?
+			AND shelf_id IN (SELECT id FROM shelves WHERE user_id = ?)`,
+		shelfID, bookID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlShelfStore) ReorderBooks(ctx context.Context, userID, shelfID int, bookIDs []int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := shelfBookIDs(ctx, tx, userID, shelfID)
+	if err != nil {
+		return err
+	}
+	if !samePermutation(current, bookIDs) {
+		return ErrConflict
+	}
+	if err := writeShelfOrder(ctx, tx, shelfID, bookIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queryIDs returns the single integer column of the query's rows.
+func queryIDs(ctx context.Context, db sqlConn, query string, args ...any) ([]int, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// samePermutation reports whether order lists each of ids exactly once.
+func samePermutation(ids, order []int) bool {
+	if len(ids) != len(order) {
+		return false
+	}
+	sorted := slices.Sorted(slices.Values(order))
+	return slices.Equal(slices.Sorted(slices.Values(ids)), slices.Compact(sorted))
+}
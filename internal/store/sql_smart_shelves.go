@@ -0,0 +1,253 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"booklib/internal/models"
+	"booklib/internal/shelves"
+	"booklib/internal/tags"
+)
+
+// ruleFilter returns a condition selecting the books, aliased as b, that
+// match the rules, along with its arguments.
+func (db *sqlDB) ruleFilter(rules models.ShelfRules, now time.Time) (string, []any) {
+	var conditions []string
+	var args []any
+	for _, rule := range rules.Rules {
+		condition, ruleArgs := db.ruleCondition(rule, now)
+		conditions = append(conditions, "("+condition+")")
+		args = append(args, ruleArgs...)
+	}
+	if len(conditions) == 0 {
+		return "1 = 1", nil
+	}
+	join := " AND "
+	if rules.Match == shelves.MatchAny {
+		join = " OR "
+	}
+	return "(" + strings.Join(conditions, join) + ")", args
+}
+
+// ruleCondition returns the condition for a single rule.
+func (db *sqlDB) ruleCondition(rule models.ShelfRule, now time.Time) (string, []any) {
+	var condition string
+	var args []any
+	negate := rule.Op == "is_not" || rule.Op == "not_contains"
+
+	switch rule.Field {
+	case "title", "author":
+		column := "LOWER(COALESCE(b." + rule.Field + ", ''))"
+		if rule.Op == "contains" || rule.Op == "not_contains" {
+			condition = column + " LIKE ? ESCAPE '\\'"
+			args = append(args, "%"+escapeLike(strings.ToLower(shelves.Text(rule)))+"%")
+		} else {
+			condition = column + " = LOWER(?)"
+			args = append(args, shelves.Text(rule))
+		}
+	case "genre":
+		condition = "EXISTS (SELECT 1 FROM book_genres g WHERE g.book_id = b.id AND LOWER(g.genre) = LOWER(?))"
+		args = append(args, shelves.Text(rule))
+	case "tag":
+		condition = `EXISTS (SELECT 1 FROM book_tags bt JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.book_id = b.id AND t.name_key = ?)`
+		args = append(args, tags.Key(shelves.Text(rule)))
+	case "language":
+		condition = "LOWER(COALESCE(b.language, '')) = LOWER(?)"
+		args = append(args, shelves.Text(rule))
+	case "read":
+		condition = "b.read = ?"
+		args = append(args, boolToInt(shelves.Bool(rule)))
+	case "status":
+		condition = "b.status = ?"
+		args = append(args, shelves.Text(rule))
+	case "lent_out", "reading", "started":
+		condition = map[string]string{
+			"lent_out": "EXISTS (SELECT 1 FROM lending l WHERE l.book_id = b.id AND l.returned_at IS NULL)",
+			"reading": `EXISTS (SELECT 1 FROM reading_history h
+				WHERE h.book_id = b.id AND h.completed_at IS NULL AND h.abandoned_at IS NULL)`,
+			"started": "EXISTS (SELECT 1 FROM reading_history h WHERE h.book_id = b.id)",
+		}[rule.Field]
+		negate = !shelves.Bool(rule)
+	case "page_count":
+		condition = "COALESCE(b.page_count, 0) " + map[string]string{"is": "=", "gt": ">", "lt": "<"}[rule.Op] + " ?"
+		args = append(args, shelves.Number(rule))
+	case "added", "finished":
+		column := db.timestamp("b.created_at")
+		if rule.Field == "finished" {
+			column = db.timestamp("h.completed_at")
+		}
+		var bounds []string
+		from, to := shelves.Range(rule, now)
+		if !from.IsZero() {
+			bounds = append(bounds, column+" >= ?")
+			args = append(args, db.timestampArg(from))
+		}
+		if !to.IsZero() {
+			bounds = append(bounds, column+" < ?")
+			args = append(args, db.timestampArg(to))
+		}
+		condition = strings.Join(bounds, " AND ")
+		if rule.Field == "finished" {
+			condition = `EXISTS (SELECT 1 FROM reading_history h
+				WHERE h.book_id = b.id AND h.completed_at IS NOT NULL AND ` + condition + ")"
+		}
+	}
+
+	if negate {
+		condition = "NOT (" + condition + ")"
+	}
+	return condition, args
+}
+
+type sqlSmartShelfStore struct {
+	db *sqlDB
+}
+
+// scanSmartShelf reads a smart_shelves row selected as id, name,
+// description, rules, created_at.
+func scanSmartShelf(row interface{ Scan(...any) error }) (*models.SmartShelf, error) {
+	var shelf models.SmartShelf
+	var rules string
+	if err := row.Scan(&shelf.ID, &shelf.Name, &shelf.Description, &rules, &shelf.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(rules), &shelf.Rules); err != nil {
+		return nil, err
+	}
+	return &shelf, nil
+}
+
+// count returns how many of the user's books match the rules.
+func (s *sqlSmartShelfStore) count(ctx context.Context, userID int, rules models.ShelfRules, now time.Time) (int, error) {
+	filter, args := s.db.ruleFilter(rules, now)
+	var count int
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM books b WHERE b.user_id = ? AND "+filter,
+		append([]any{userID}, args...)...,
+	).Scan(&count)
+	return count, err
+}
+
+func (s *sqlSmartShelfStore) List(ctx context.Context, userID int, now time.Time) ([]models.SmartShelf, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, description, rules, created_at
+		FROM smart_shelves
+		WHERE user_id = ?
+		ORDER BY name_key, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	list := []models.SmartShelf{}
+	for rows.Next() {
+		shelf, err := scanSmartShelf(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		list = append(list, *shelf)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		if list[i].BookCount, err = s.count(ctx, userID, list[i].Rules, now); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (s *sqlSmartShelfStore) Get(ctx context.Context, userID, shelfID int, now time.Time) (*models.SmartShelfDetail, error) {
+	shelf, err := scanSmartShelf(s.db.QueryRowContext(ctx,
+		"SELECT id, name, description, rules, created_at FROM smart_shelves WHERE id = ? AND user_id = ?",
+		shelfID, userID,
+	))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	books, err := s.Books(ctx, userID, shelf.Rules, now)
+	if err != nil {
+		return nil, err
+	}
+	shelf.BookCount = len(books)
+	return &models.SmartShelfDetail{SmartShelf: *shelf, Books: books}, nil
+}
+
+func (s *sqlSmartShelfStore) Books(ctx context.Context, userID int, rules models.ShelfRules, now time.Time) ([]models.Book, error) {
+	filter, args := s.db.ruleFilter(rules, now)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+bookColumns+`
+		FROM books b
+		WHERE b.user_id = ? AND `+filter+`
+		ORDER BY `+s.db.timestamp("b.created_at")+` DESC, b.id DESC`,
+		append([]any{userID}, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	books := []models.Book{}
+	for rows.Next() {
+		book, err := scanBook(rows)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, *book)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return books, loadRelations(ctx, s.db, books)
+}
+
+func (s *sqlSmartShelfStore) Create(ctx context.Context, userID int, shelf *models.SmartShelf) error {
+	return createSmartShelf(ctx, s.db, userID, shelf)
+}
+
+func createSmartShelf(ctx context.Context, db sqlConn, userID int, shelf *models.SmartShelf) error {
+	rules, err := json.Marshal(shelf.Rules)
+	if err != nil {
+		return err
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO smart_shelves (user_id, name, name_key, description, rules)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id, created_at`,
+		userID, shelf.Name, shelves.Key(shelf.Name), shelf.Description, string(rules),
+	).Scan(&shelf.ID, &shelf.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlSmartShelfStore) Update(ctx context.Context, userID int, shelf *models.SmartShelf) error {
+	rules, err := json.Marshal(shelf.Rules)
+	if err != nil {
+		return err
+	}
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE smart_shelves SET name = ?, name_key = ?, description = ?, rules = ?
+		WHERE id = ? AND user_id = ?
+		RETURNING created_at`,
+		shelf.Name, shelves.Key(shelf.Name), shelf.Description, string(rules), shelf.ID, userID,
+	).Scan(&shelf.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return notFound(err)
+}
+
+func (s *sqlSmartShelfStore) Delete(ctx context.Context, userID, shelfID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM smart_shelves WHERE id = ? AND user_id = ?", shelfID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
@@ -0,0 +1,314 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"booklib/internal/models"
+)
+
+type sqlStatsStore struct {
+	db *sqlDB
+}
+
+// count runs a COUNT query, treating failures as zero so that a single
+// broken statistic does not hide the rest.
+func (s *sqlStatsStore) count(ctx context.Context, query string, args ...any) int {
+	var n int
+	if err := s.db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0
+	}
+	return n
+}
+
+func (s *sqlStatsStore) UserStats(ctx context.Context, userID int, now time.Time) (*models.UserStats, error) {
+	stats := models.UserStats{}
+
+	// Total books
+	err := s.db.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM books WHERE user_id = ?",
+		userID,
+	).Scan(&stats.TotalBooks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Books read
+	stats.BooksRead = s.count(ctx, "SELECT COUNT(*) FROM books WHERE user_id = ? AND read = 1", userID)
+
+	// Books currently lent out (not returned)
+	stats.BooksLentOut = s.count(ctx, `
+		SELECT COUNT(DISTINCT book_id) 
+		FROM lending 
+		WHERE user_id = ? AND returned_at IS NULL
+	`, userID)
+
+	// Total lendings (all time, including returned)
+	stats.TotalLendings = s.count(ctx, "SELECT COUNT(*) FROM lending WHERE user_id = ?", userID)
+
+	// Books added this month
+	firstDayOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	stats.BooksThisMonth = s.count(ctx, `
+		SELECT COUNT(*) FROM books 
+		WHERE user_id = ? AND created_at >= ?
+	`, userID, firstDayOfMonth)
+
+	// Books added this year
+	firstDayOfYear := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+	stats.BooksThisYear = s.count(ctx, `
+		SELECT COUNT(*) FROM books 
+		WHERE user_id = ? AND created_at >= ?
+	`, userID, firstDayOfYear)
+
+	// Books read this year
+	stats.BooksReadThisYear = s.count(ctx, `
+		SELECT COUNT(*) FROM reading_history 
+		WHERE user_id = ? AND completed_at >= ?
+	`, userID, firstDayOfYear)
+
+	// Genre breakdown (top 5)
+	stats.GenreBreakdown = []models.GenreStat{}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT g.genre, COUNT(*) as count
+		FROM book_genres g
+		JOIN books b ON b.id = g.book_id
+		WHERE b.user_id = ?
+		GROUP BY g.genre
+		ORDER BY count DESC
+		LIMIT 5
+	`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var genre models.GenreStat
+			if err := rows.Scan(&genre.Genre, &genre.Count); err == nil {
+				stats.GenreBreakdown = append(stats.GenreBreakdown, genre)
+			}
+		}
+	}
+
+	// Monthly reading for last 12 months
+	stats.MonthlyReading = []models.MonthlyCount{}
+	for i := 11; i >= 0; i-- {
+		monthStart := firstDayOfMonth.AddDate(0, -i, 0)
+		monthEnd := monthStart.AddDate(0, 1, 0)
+
+		var count int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM books 
+			WHERE user_id = ? AND created_at >= ? AND created_at < ?
+		`, userID, monthStart, monthEnd).Scan(&count)
+		if err == nil {
+			stats.MonthlyReading = append(stats.MonthlyReading, models.MonthlyCount{
+				Month: monthStart.Format("Jan 2006"),
+				Count: count,
+			})
+		}
+	}
+
+	// Top authors
+	stats.TopAuthors = []models.AuthorStat{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT a.id, a.name, COUNT(DISTINCT b.id) as count
+		FROM authors a
+		JOIN book_authors ba ON ba.author_id = a.id
+		JOIN books b ON b.id = ba.book_id
+		WHERE b.user_id = ? AND ba.role = ?
+		GROUP BY a.id, a.name
+		ORDER BY count DESC, LOWER(a.name)
+		LIMIT 5
+	`, userID, models.RoleAuthor)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var author models.AuthorStat
+			if err := rows.Scan(&author.AuthorID, &author.Name, &author.Count); err == nil {
+				stats.TopAuthors = append(stats.TopAuthors, author)
+			}
+		}
+	}
+
+	// Tag breakdown
+	stats.TagBreakdown = []models.TagStat{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT t.name, COUNT(b.id) as count, COALESCE(SUM(b.read), 0)
+		FROM tags t
+		LEFT JOIN book_tags bt ON bt.tag_id = t.id
+		LEFT JOIN books b ON b.id = bt.book_id
+		WHERE t.user_id = ?
+		GROUP BY t.id, t.name, t.name_key
+		ORDER BY count DESC, t.name_key
+	`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var tag models.TagStat
+			if err := rows.Scan(&tag.Tag, &tag.Count, &tag.Read); err == nil {
+				stats.TagBreakdown = append(stats.TagBreakdown, tag)
+			}
+		}
+	}
+
+	// Ratings, per book and per author
+	s.db.QueryRowContext(ctx,
+		"SELECT COUNT(rating), COALESCE(AVG(rating), 0) FROM reviews WHERE user_id = ?",
+		userID,
+	).Scan(&stats.RatingsGiven, &stats.AverageRating)
+	stats.AverageRating = roundRating(stats.AverageRating)
+
+	stats.BookRatings = []models.BookRating{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT b.id, b.title, b.author, AVG(rv.rating) as average, COUNT(rv.rating) as ratings
+		FROM reviews rv
+		JOIN reading_history h ON h.id = rv.session_id
+		JOIN books b ON b.id = h.book_id
+		WHERE rv.user_id = ? AND rv.rating IS NOT NULL
+		GROUP BY b.id, b.title, b.author
+		ORDER BY average DESC, ratings DESC, LOWER(b.title)
+	`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var book models.BookRating
+			if err := rows.Scan(&book.BookID, &book.Title, &book.Author, &book.Average, &book.Ratings); err == nil {
+				book.Average = roundRating(book.Average)
+				stats.BookRatings = append(stats.BookRatings, book)
+			}
+		}
+	}
+
+	stats.AuthorRatings = []models.AuthorRating{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT a.id, a.name, AVG(rv.rating) as average, COUNT(rv.rating) as ratings, COUNT(DISTINCT h.book_id)
+		FROM reviews rv
+		JOIN reading_history h ON h.id = rv.session_id
+		JOIN book_authors ba ON ba.book_id = h.book_id
+		JOIN authors a ON a.id = ba.author_id
+		WHERE rv.user_id = ? AND rv.rating IS NOT NULL AND ba.role = ?
+		GROUP BY a.id, a.name
+		ORDER BY average DESC, ratings DESC, LOWER(a.name)
+	`, userID, models.RoleAuthor)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var author models.AuthorRating
+			if err := rows.Scan(&author.AuthorID, &author.Name, &author.Average, &author.Ratings, &author.Books); err == nil {
+				author.Average = roundRating(author.Average)
+				stats.AuthorRatings = append(stats.AuthorRatings, author)
+			}
+		}
+	}
+
+	stats.TopLentBooks = []models.TopBook{}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT b.title, b.author, COUNT(l.id) as lent_count, b.cover_url
+		FROM books b
+		JOIN lending l ON b.id = l.book_id
+		WHERE b.user_id = ?
+		GROUP BY b.id, b.title, b.author, b.cover_url
+		ORDER BY lent_count DESC
+		LIMIT 5
+	`, userID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var book models.TopBook
+			var coverURL sql.NullString
+			if err := rows.Scan(&book.Title, &book.Author, &book.LentCount, &coverURL); err == nil {
+				if coverURL.Valid {
+					book.CoverURL = coverURL.String
+				}
+				stats.TopLentBooks = append(stats.TopLentBooks, book)
+			}
+		}
+	}
+
+	return &stats, nil
+}
+
+// roundRating rounds an average rating to two decimal places.
+func roundRating(r float64) float64 {
+	return math.Round(r*100) / 100
+}
+
+func (s *sqlStatsStore) AdminStats(ctx context.Context, now time.Time) (*models.AdminStats, error) {
+	var stats models.AdminStats
+
+	stats.TotalUsers = s.count(ctx, "SELECT COUNT(*) FROM users")
+	stats.TotalBooks = s.count(ctx, "SELECT COUNT(*) FROM books")
+
+	stats.BooksRead = s.count(ctx, "SELECT COUNT(*) FROM books WHERE read = 1")
+	stats.BooksUnread = s.count(ctx, "SELECT COUNT(*) FROM books WHERE read = 0")
+
+	// Lending stats
+	stats.BooksLentOut = s.count(ctx, "SELECT COUNT(*) FROM lending WHERE returned_at IS NULL")
+	stats.OverdueBooks = s.count(ctx, `
+		SELECT COUNT(*) 
+		FROM lending 
+		WHERE returned_at IS NULL 
+		AND due_date IS NOT NULL 
+		AND due_date < ?
+	`, now.UTC())
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, username, email, role, created_at
+		FROM users
+		ORDER BY created_at DESC
+		LIMIT 5`)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var user models.User
+			if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt); err == nil {
+				stats.RecentUsers = append(stats.RecentUsers, user)
+			}
+		}
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT b.id, b.title, b.author, b.isbn, b.genre, b.read, b.created_at, u.username
+		FROM books b
+		JOIN users u ON b.user_id = u.id
+		ORDER BY b.created_at DESC
+		LIMIT 10`)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var book models.BookWithUser
+			var readInt int
+			if err := rows.Scan(
+				&book.ID,
+				&book.Title,
+				&book.Author,
+				&book.ISBN,
+				&book.Genre,
+				&readInt,
+				&book.CreatedAt,
+				&book.Username,
+			); err == nil {
+				book.Read = readInt == 1
+				stats.RecentBooks = append(stats.RecentBooks, book)
+			}
+		}
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT genre, COUNT(*) as count
+		FROM book_genres
+		GROUP BY genre
+		ORDER BY count DESC
+		LIMIT 10`)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var gc models.GenreCount
+			if err := rows.Scan(&gc.Genre, &gc.Count); err == nil {
+				stats.PopularGenres = append(stats.PopularGenres, gc)
+			}
+		}
+	}
+
+	return &stats, nil
+}
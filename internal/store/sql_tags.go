@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+
+	"booklib/internal/models"
+	"booklib/internal/tags"
+)
+
+// writeGenres replaces the book's genres with book.Genres.
+func writeGenres(ctx context.Context, db sqlConn, book *models.Book) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM book_genres WHERE book_id = ?", book.ID); err != nil {
+		return err
+	}
+	for i, genre := range book.Genres {
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO book_genres (book_id, genre, position) VALUES (?, ?, ?)",
+			book.ID, genre, i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTags replaces the book's tags with book.Tags, creating the user's
+// tags that don't exist yet, and sets the names as loadTags will return
+// them.
+func writeTags(ctx context.Context, db sqlConn, userID int, book *models.Book) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM book_tags WHERE book_id = ?", book.ID); err != nil {
+		return err
+	}
+	for i, name := range book.Tags {
+		key := tags.Key(name)
+		_, err := db.ExecContext(ctx,
+			"INSERT INTO tags (user_id, name, name_key) VALUES (?, ?, ?) ON CONFLICT (user_id, name_key) DO NOTHING",
+			userID, name, key,
+		)
+		if err != nil {
+			return err
+		}
+		var tagID int
+		err = db.QueryRowContext(ctx,
+			"SELECT id, name FROM tags WHERE user_id = ? AND name_key = ?",
+			userID, key,
+		).Scan(&tagID, &book.Tags[i])
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx,
+			"INSERT INTO book_tags (book_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			book.ID, tagID,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadGenres sets the Genres of each book, in the order they were written.
+func loadGenres(ctx context.Context, db sqlConn, books []models.Book) error {
+	index := make(map[int]int, len(books))
+	for i := range books {
+		index[books[i].ID] = i
+		books[i].Genres = nil
+	}
+
+	return inBatches(books, func(in string, args []any) error {
+		rows, err := db.QueryContext(ctx, `
+			SELECT book_id, genre
+			FROM book_genres
+			WHERE book_id IN `+in+`
+			ORDER BY book_id, position`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID int
+			var genre string
+			if err := rows.Scan(&bookID, &genre); err != nil {
+				return err
+			}
+			book := &books[index[bookID]]
+			book.Genres = append(book.Genres, genre)
+		}
+		return rows.Err()
+	})
+}
+
+// loadTags sets the Tags of each book, sorted by name.
+func loadTags(ctx context.Context, db sqlConn, books []models.Book) error {
+	index := make(map[int]int, len(books))
+	for i := range books {
+		index[books[i].ID] = i
+		books[i].Tags = nil
+	}
+
+	return inBatches(books, func(in string, args []any) error {
+		rows, err := db.QueryContext(ctx, `
+			SELECT bt.book_id, t.name
+			FROM book_tags bt
+			JOIN tags t ON t.id = bt.tag_id
+			WHERE bt.book_id IN `+in+`
+			ORDER BY bt.book_id, t.name_key`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var bookID int
+			var name string
+			if err := rows.Scan(&bookID, &name); err != nil {
+				return err
+			}
+			book := &books[index[bookID]]
+			book.Tags = append(book.Tags, name)
+		}
+		return rows.Err()
+	})
+}
+
+type sqlTagStore struct {
+	db *sqlDB
+}
+
+func (s *sqlTagStore) List(ctx context.Context, userID int) ([]models.TagSummary, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.name, t.created_at, COUNT(bt.book_id)
+		FROM tags t
+		LEFT JOIN book_tags bt ON bt.tag_id = t.id
+		WHERE t.user_id = ?
+		GROUP BY t.id, t.name, t.name_key, t.created_at
+		ORDER BY t.name_key, t.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []models.TagSummary{}
+	for rows.Next() {
+		var t models.TagSummary
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &t.BookCount); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+func (s *sqlTagStore) Create(ctx context.Context, userID int, tag *models.Tag) error {
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO tags (user_id, name, name_key) VALUES (?, ?, ?) RETURNING id, created_at",
+		userID, tag.Name, tags.Key(tag.Name),
+	).Scan(&tag.ID, &tag.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlTagStore) Rename(ctx context.Context, userID int, tag *models.Tag) error {
+	err := s.db.QueryRowContext(ctx,
+		"UPDATE tags SET name = ?, name_key = ? WHERE id = ? AND user_id = ? RETURNING created_at",
+		tag.Name, tags.Key(tag.Name), tag.ID, userID,
+	).Scan(&tag.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return notFound(err)
+}
+
+func (s *sqlTagStore) Delete(ctx context.Context, userID, tagID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM tags WHERE id = ? AND user_id = ?", tagID, userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlTagStore) AddBooks(ctx context.Context, userID, tagID int, bookIDs []int) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRowContext(ctx, "SELECT id FROM tags WHERE id = ? AND user_id = ?", tagID, userID).Scan(&id)
+	if err != nil {
+		return 0, notFound(err)
+	}
+
+	added := 0
+	for _, bookID := range bookIDs {
+		err := tx.QueryRowContext(ctx, "SELECT id FROM books WHERE id = ? AND user_id = ?", bookID, userID).Scan(&id)
+		if err != nil {
+			return 0, notFound(err)
+		}
+		result, err := tx.ExecContext(ctx,
+			"INSERT INTO book_tags (book_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			bookID, tagID,
+		)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n > 0 {
+			added++
+		}
+	}
+	return added, tx.Commit()
+}
+
+func (s *sqlTagStore) RemoveBook(ctx context.Context, userID, tagID, bookID int) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM book_tags
+		WHERE tag_id = ? AND book_id = ?
+			AND tag_id IN (SELECT id FROM tags WHERE user_id = ?)`,
+		tagID, bookID, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
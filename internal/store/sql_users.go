@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+
+	"booklib/internal/models"
+)
+
+type sqlUserStore struct {
+	db *sqlDB
+}
+
+func (s *sqlUserStore) Create(ctx context.Context, user *models.User) error {
+	err := s.db.QueryRowContext(ctx,
+		"INSERT INTO users (username, email, password_hash, role) VALUES (?, ?, ?, ?) RETURNING id, created_at, updated_at",
+		user.Username, user.Email, user.PasswordHash, user.Role,
+	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	if isUniqueViolation(err) {
+		return ErrConflict
+	}
+	return err
+}
+
+func (s *sqlUserStore) Get(ctx context.Context, userID int) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, email, role, created_at FROM users WHERE id = ?",
+		userID,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.Role, &user.CreatedAt)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *sqlUserStore) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, username, email, password_hash, role FROM users WHERE email = ?",
+		email,
+	).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (s *sqlUserStore) ListWithStats(ctx context.Context) ([]models.UserWithStats, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.id, u.username, u.email, u.role, u.created_at, COUNT(b.id) as book_count
+		FROM users u
+		LEFT JOIN books b ON u.id = b.user_id
+		GROUP BY u.id, u.username, u.email, u.role, u.created_at
+		ORDER BY u.created_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.UserWithStats{}
+	for rows.Next() {
+		var user models.UserWithStats
+		if err := rows.Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.Role,
+			&user.CreatedAt,
+			&user.BookCount,
+		); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlUserStore) UpdateRole(ctx context.Context, userID int, role string) error {
+	result, err := s.db.ExecContext(ctx,
+		"UPDATE users SET role = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		role, userID,
+	)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
+
+func (s *sqlUserStore) Delete(ctx context.Context, userID int) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM users WHERE id = ?", userID)
+	if err != nil {
+		return err
+	}
+	return requireRows(result)
+}
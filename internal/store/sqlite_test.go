@@ -0,0 +1,22 @@
+//go:build sqlite_fts5
+
+package store
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"booklib/internal/dialect"
+)
+
+func TestSQLiteStores(t *testing.T) {
+	db, err := sql.Open(dialect.SQLite.DriverName(), filepath.Join(t.TempDir(), "booklib.db")+"?_foreign_keys=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	testMigrations(t, db, dialect.SQLite)
+	testSQLStores(t, NewSQL(db, dialect.SQLite))
+}
@@ -0,0 +1,457 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"booklib/internal/models"
+)
+
+var (
+	// ErrNotFound is returned when a requested record does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write would violate a uniqueness rule.
+	ErrConflict = errors.New("conflict")
+
+	// ErrDuplicateISBN, ErrDuplicateShelf and ErrDuplicateSmartShelf are the
+	// conflicts ExportStore.Restore reports, naming what clashed. Each
+	// matches ErrConflict.
+	ErrDuplicateISBN       = fmt.Errorf("duplicate ISBN: %w", ErrConflict)
+	ErrDuplicateShelf      = fmt.Errorf("duplicate shelf name: %w", ErrConflict)
+	ErrDuplicateSmartShelf = fmt.Errorf("duplicate smart shelf name: %w", ErrConflict)
+)
+
+// Sort orders accepted by BookQuery.
+const (
+	SortTitle     = "title"
+	SortAuthor    = "author"
+	SortCreatedAt = "created_at"
+	// SortRank orders search results best match first and is only valid
+	// with BookQuery.Search.
+	SortRank = "rank"
+)
+
+// BookQuery selects, orders and pages a user's books. Zero-valued filters
+// are ignored. Time ranges include From and exclude To.
+type BookQuery struct {
+	// Sort is one of the Sort constants; titles and authors sort
+	// case-insensitively. Ties are broken by book ID.
+	Sort string
+	Desc bool
+	// Limit caps the page size; zero returns every match.
+	Limit int
+	// After continues from the cursor returned with the previous page.
+	After *BookCursor
+
+	// Search restricts the results to books whose title, author, genre or
+	// notes contain words starting with each word of the search text.
+	Search string
+
+	Read    *bool
+	LentOut *bool
+	// Status matches books with the reading status.
+	Status string
+	// Reading matches books with a reading session in progress and Started
+	// books with any reading session, finished or not.
+	Reading *bool
+	Started *bool
+	// ShelfID matches books on the shelf.
+	ShelfID int
+	// Genre matches any of the book's genres exactly and Author matches
+	// any part of the author, both ignoring case. AuthorID matches books
+	// crediting the author in any role.
+	Genre    string
+	Author   string
+	AuthorID int
+	// Tags matches books carrying every one of the tags.
+	Tags []string
+
+	AddedFrom, AddedTo time.Time
+	// FinishedFrom and FinishedTo match books with a reading session
+	// completed in the range.
+	FinishedFrom, FinishedTo time.Time
+}
+
+// BookCursor marks the last book of a page: its sort key and ID.
+type BookCursor struct {
+	Key string
+	ID  int
+}
+
+// BookPage is one page of a BookQuery. Next is nil on the last page.
+type BookPage struct {
+	Books []models.Book
+	Total int
+	Next  *BookCursor
+	// Snippets holds, for searches, an excerpt of each book's best
+	// matching field with the matches wrapped in <mark> tags, keyed by
+	// book ID.
+	Snippets map[int]string
+}
+
+// BookStore manages a user's books.
+type BookStore interface {
+	List(ctx context.Context, userID int) ([]models.Book, error)
+	// Query returns the page of the user's books matching q, along with the
+	// number of matches across all pages.
+	Query(ctx context.Context, userID int, q BookQuery) (*BookPage, error)
+	Get(ctx context.Context, userID, bookID int) (*models.Book, error)
+	// OwnerID returns the ID of the user who owns the book.
+	OwnerID(ctx context.Context, bookID int) (int, error)
+	// FindByISBN returns the ID of the user's book with the given ISBN.
+	FindByISBN(ctx context.Context, userID int, isbn string) (int, error)
+	// Create inserts the book with its credits, genres and tags and sets
+	// its ID. Tags the user doesn't have yet are created. The book starts
+	// out finished if Status says so or it is marked read, and as
+	// want_to_read otherwise.
+	Create(ctx context.Context, userID int, book *models.Book) error
+	// Import inserts the books and their reading sessions in a single
+	// transaction and sets their IDs, settling each book's status with
+	// reading.Settle. If any insert fails nothing is kept.
+	Import(ctx context.Context, userID int, books []*models.ImportBook) error
+	// Update replaces the book's fields, credits, genres and tags, so empty
+	// cover and publication details clear the stored ones. The tags are kept
+	// when Tags is nil and the genres when Genres is nil, see
+	// tags.ResolveGenres. The reading status and read flag are left alone
+	// and set on book from the stored values.
+	Update(ctx context.Context, userID int, book *models.Book) error
+	Delete(ctx context.Context, userID, bookID int) error
+}
+
+// AuthorStore reads the authors credited on a user's books. Authors are
+// created and credited by BookStore writes.
+type AuthorStore interface {
+	// List returns the authors credited on the user's books, ordered by
+	// name, with how many books each is credited on. search matches any part
+	// of the name, ignoring case.
+	List(ctx context.Context, userID int, search string) ([]models.AuthorSummary, error)
+	// Get returns the author with the user's books crediting them. It
+	// returns ErrNotFound if none of the user's books do.
+	Get(ctx context.Context, userID, authorID int) (*models.AuthorDetail, error)
+}
+
+// ISBNCacheQuery selects and pages ISBN cache entries, ordered by ISBN or,
+// when ExpiredBefore is set, oldest first. Zero-valued fields are ignored.
+type ISBNCacheQuery struct {
+	// Search matches any part of the ISBN, title or author, ignoring case.
+	Search string
+	// ExpiredBefore restricts the results to unpinned entries cached before
+	// it.
+	ExpiredBefore time.Time
+	Limit         int
+	Offset        int
+}
+
+// ISBNCacheStore caches book metadata fetched from external providers.
+type ISBNCacheStore interface {
+	Get(ctx context.Context, isbn string) (*models.IsbnCache, error)
+	// Put stores the entry unless one already exists for the ISBN.
+	Put(ctx context.Context, entry *models.IsbnCache) error
+	// Save stores the entry, replacing any existing one for the ISBN.
+	Save(ctx context.Context, entry *models.IsbnCache) error
+	// List returns the entries matching q along with the number of matches
+	// across all pages.
+	List(ctx context.Context, q ISBNCacheQuery) ([]models.IsbnCache, int, error)
+	Delete(ctx context.Context, isbn string) error
+	// Purge deletes the unpinned entries cached before the given time and
+	// returns how many were deleted.
+	Purge(ctx context.Context, cachedBefore time.Time) (int, error)
+}
+
+// EnrichmentStore manages the metadata proposals made for a user's books.
+type EnrichmentStore interface {
+	// List returns the user's proposals with the given status, or all of
+	// them when status is empty, ordered by ID and with their books.
+	List(ctx context.Context, userID int, status string) ([]models.EnrichmentProposal, error)
+	Get(ctx context.Context, userID, proposalID int) (*models.EnrichmentProposal, error)
+	// Create inserts the proposal and sets its ID. It returns ErrConflict if
+	// the book already has one.
+	Create(ctx context.Context, userID int, proposal *models.EnrichmentProposal) error
+	SetStatus(ctx context.Context, userID, proposalID int, status string) error
+	Delete(ctx context.Context, userID, proposalID int) error
+}
+
+// LendingStore manages lending records and the reminder queries run against
+// them.
+type LendingStore interface {
+	// ListActive returns the user's lendings that have not been returned.
+	ListActive(ctx context.Context, userID int) ([]models.LendingWithBook, error)
+	// ListHistory returns all of the user's lendings, restricted to a single
+	// book when bookID is non-zero.
+	ListHistory(ctx context.Context, userID, bookID int) ([]models.LendingWithBook, error)
+	// ActiveForBook returns the ID of the book's unreturned lending.
+	ActiveForBook(ctx context.Context, bookID int) (int, error)
+	// GetActive returns an unreturned lending by ID.
+	GetActive(ctx context.Context, lendingID int) (*models.Lending, error)
+	// Create inserts the lending and sets its ID.
+	Create(ctx context.Context, lending *models.Lending) error
+	MarkReturned(ctx context.Context, lendingID int, at time.Time) error
+
+	// ListUpcomingReminders returns unreturned lendings due in [dueFrom, dueTo)
+	// whose owners want upcoming-due emails and who have not been reminded
+	// since remindedBefore.
+	ListUpcomingReminders(ctx context.Context, dueFrom, dueTo, remindedBefore time.Time) ([]models.ReminderLending, error)
+	// ListOverdueReminders returns unreturned lendings due before dueBefore
+	// whose owners want overdue emails and who have not been reminded since
+	// remindedBefore, ordered by user and due date.
+	ListOverdueReminders(ctx context.Context, dueBefore, remindedBefore time.Time) ([]models.ReminderLending, error)
+	MarkReminderSent(ctx context.Context, lendingID int, at time.Time) error
+}
+
+// ReadingStore manages reading sessions.
+type ReadingStore interface {
+	Get(ctx context.Context, historyID int) (*models.ReadingHistory, error)
+	ListForBook(ctx context.Context, userID, bookID int) ([]models.ReadingHistory, error)
+	// Active returns the user's latest session in progress for the book.
+	Active(ctx context.Context, userID, bookID int) (*models.ReadingHistory, error)
+	// Start moves the book to reading, starting a session, like SetStatus.
+	Start(ctx context.Context, userID, bookID int, at time.Time) (*models.ReadingHistory, error)
+	// Finish completes the session, moving its book to finished and so
+	// marking it read, like SetStatus. A review, if not nil, is saved as the
+	// session's like SaveReview does, in the same transaction so that
+	// neither is written without the other.
+	Finish(ctx context.Context, historyID int, review *models.Review, at time.Time) (*models.ReadingHistory, error)
+	// SetStatus moves the user's book to the reading status and records the
+	// change, failing with reading.ErrInvalidTransition if the state
+	// machine doesn't allow the move. Moving to reading starts a session,
+	// or resumes the paused one; finished completes the session in progress
+	// and did_not_finish abandons it. The book's read flag follows, see
+	// reading.Read.
+	SetStatus(ctx context.Context, userID, bookID int, status string, at time.Time) (*models.StatusChange, error)
+	// LogSession inserts a session of the user's book with the times given,
+	// such as one read before the book was added, and sets its ID. It fails
+	// with reading.ErrOverlap if the session overlaps another of the book's.
+	// The book's status is then derived from its sessions with
+	// reading.Derive, recording a change if it moved stamped with when its
+	// sessions reached the new status, or at if it has none, and its read
+	// flag with reading.Read; both are returned.
+	LogSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error)
+	// EditSession replaces the start, completion and abandonment times of
+	// the user's session and fills in the rest of it. Errors and the
+	// state returned are those of LogSession.
+	EditSession(ctx context.Context, userID int, session *models.ReadingHistory, at time.Time) (models.ReadState, error)
+	// DeleteSession removes the user's session with its progress updates
+	// and review, leaving notes taken in it on the book, and returns the
+	// book's state as LogSession does.
+	DeleteSession(ctx context.Context, userID, historyID int, at time.Time) (models.ReadState, error)
+	// StatusChanges returns the status changes of the user's book, oldest
+	// first.
+	StatusChanges(ctx context.Context, userID, bookID int) ([]models.StatusChange, error)
+	// AddProgress records a progress update for the user's session and
+	// sets its ID.
+	AddProgress(ctx context.Context, userID int, progress *models.ReadingProgress) error
+	// Progress returns the session's progress updates, oldest first.
+	Progress(ctx context.Context, historyID int) ([]models.ReadingProgress, error)
+	// Review returns the session's review with its edits, or ErrNotFound.
+	Review(ctx context.Context, historyID int) (*models.Review, error)
+	// SaveReview writes the review of the user's session review.SessionID
+	// and fills in the rest of it. Saving over an existing review keeps the
+	// version it replaces as an edit.
+	SaveReview(ctx context.Context, userID int, review *models.Review, at time.Time) error
+	// DeleteReview removes the session's review along with its edits.
+	DeleteReview(ctx context.Context, historyID int) error
+}
+
+// NoteQuery selects notes by a full-text search over their bodies.
+// Zero-valued filters are ignored.
+type NoteQuery struct {
+	// Search matches notes containing words starting with each word of the
+	// search text.
+	Search string
+	BookID int
+	Type   string
+	// Limit caps the number of notes returned; zero means no limit.
+	Limit int
+}
+
+// NoteStore manages the notes, quotes and highlights users keep on their
+// books.
+type NoteStore interface {
+	// ListForBook returns the notes on the user's book by page, then by
+	// location, those without one last, then oldest first.
+	ListForBook(ctx context.Context, userID, bookID int) ([]models.Note, error)
+	Get(ctx context.Context, userID, noteID int) (*models.Note, error)
+	// Create inserts the note, stamped at, and sets its ID. It returns
+	// ErrNotFound if the book isn't the user's or the session isn't one of
+	// the book's.
+	Create(ctx context.Context, userID int, note *models.Note, at time.Time) error
+	// Update replaces the note's session, type, page, location and body,
+	// stamped at, and fills in the rest of it. Errors are those of Create.
+	Update(ctx context.Context, userID int, note *models.Note, at time.Time) error
+	Delete(ctx context.Context, userID, noteID int) error
+	// ImportKeys returns the import keys of the user's notes.
+	ImportKeys(ctx context.Context, userID int) (map[string]bool, error)
+	// Import inserts the notes in a single transaction, keeping their own
+	// times where set, and sets the IDs of those inserted. Notes whose
+	// import key the user already has are skipped and keep a zero ID.
+	// Errors are those of Create; if any insert fails nothing is kept.
+	Import(ctx context.Context, userID int, list []*models.Note, at time.Time) error
+	// Search returns the user's notes matching the query, best match first.
+	Search(ctx context.Context, userID int, q NoteQuery) ([]models.NoteMatch, error)
+}
+
+// UserStore manages user accounts.
+type UserStore interface {
+	// Create inserts the user and sets its ID. It returns ErrConflict if the
+	// username or email is taken.
+	Create(ctx context.Context, user *models.User) error
+	Get(ctx context.Context, userID int) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// ListWithStats returns every user, newest first, with their book counts.
+	ListWithStats(ctx context.Context) ([]models.UserWithStats, error)
+	UpdateRole(ctx context.Context, userID int, role string) error
+	Delete(ctx context.Context, userID int) error
+}
+
+// SettingsStore manages per-user settings and instance-wide settings.
+type SettingsStore interface {
+	GetUserSettings(ctx context.Context, userID int) (*models.UserSettings, error)
+	CreateUserSettings(ctx context.Context, settings *models.UserSettings) error
+	// UpdateUserSettings applies the non-nil fields of req.
+	UpdateUserSettings(ctx context.Context, userID int, req models.UpdateUserSettingsRequest, at time.Time) error
+
+	GetAppSetting(ctx context.Context, key string) (string, error)
+	ListAppSettings(ctx context.Context) (map[string]string, error)
+	SetAppSetting(ctx context.Context, key, value string) error
+}
+
+// StatsStore computes aggregate statistics. Period boundaries such as "this
+// month" are derived from now.
+type StatsStore interface {
+	UserStats(ctx context.Context, userID int, now time.Time) (*models.UserStats, error)
+	AdminStats(ctx context.Context, now time.Time) (*models.AdminStats, error)
+}
+
+// ExportStore reads and restores a user's complete data set.
+type ExportStore interface {
+	// Export calls fn with a reader over the user's data that is valid until
+	// fn returns. The SQL stores read from one read-only transaction, so
+	// the export is a consistent snapshot without being held in memory.
+	Export(ctx context.Context, userID int, fn func(ExportReader) error) error
+	// Restore writes the archive's records to the user's account in a single
+	// transaction, assigning new IDs. With replace set the user's existing
+	// books, lending, reading history, shelves and smart shelves are
+	// deleted first; otherwise books matching one the user already owns, by
+	// ISBN or else by title and author, are skipped, as are notes whose
+	// import key the user already has. A book, shelf or smart shelf that
+	// clashes with one written meanwhile fails the restore with
+	// ErrDuplicateISBN, ErrDuplicateShelf or ErrDuplicateSmartShelf.
+	Restore(ctx context.Context, userID int, archive *models.Export, replace bool) (*models.RestoreResult, error)
+}
+
+// ExportReader reads the tables of a user's export a record at a time, in
+// the order models.Export documents. Each method calls fn with every record
+// of its table, in ID order unless noted, and stops at the first error fn
+// returns. Methods may be called more than once and in any order, but not
+// from within fn.
+type ExportReader interface {
+	// Books come with their credits, genres and tags.
+	Books(fn func(models.Book) error) error
+	Lending(fn func(models.Lending) error) error
+	ReadingHistory(fn func(models.ReadingHistory) error) error
+	StatusChanges(fn func(models.StatusChange) error) error
+	ReadingProgress(fn func(models.ReadingProgress) error) error
+	// Reviews come with their edits.
+	Reviews(fn func(models.Review) error) error
+	Notes(fn func(models.Note) error) error
+	// Shelves are read in the user's order.
+	Shelves(fn func(models.ExportShelf) error) error
+	SmartShelves(fn func(models.ExportSmartShelf) error) error
+	// UserSettings returns nil if the user has none.
+	UserSettings() (*models.UserSettings, error)
+}
+
+// TagStore manages a user's tags. Tags are also created by BookStore
+// writes naming tags the user doesn't have yet.
+type TagStore interface {
+	// List returns the user's tags, ordered by name, with how many books
+	// carry each.
+	List(ctx context.Context, userID int) ([]models.TagSummary, error)
+	// Create inserts the tag and sets its ID. It returns ErrConflict if the
+	// user already has a tag by that name.
+	Create(ctx context.Context, userID int, tag *models.Tag) error
+	// Rename changes the tag's name on every book carrying it. It returns
+	// ErrConflict if another of the user's tags has that name.
+	Rename(ctx context.Context, userID int, tag *models.Tag) error
+	// Delete removes the tag from the user's books and deletes it.
+	Delete(ctx context.Context, userID, tagID int) error
+	// AddBooks puts the tag on the books and returns how many didn't carry
+	// it yet. It returns ErrNotFound, tagging nothing, if the tag or any
+	// of the books isn't the user's.
+	AddBooks(ctx context.Context, userID, tagID int, bookIDs []int) (int, error)
+	// RemoveBook takes the tag off the book.
+	RemoveBook(ctx context.Context, userID, tagID, bookID int) error
+}
+
+// ShelfStore manages a user's shelves and the order of the books on them.
+type ShelfStore interface {
+	// List returns the user's shelves in their order, with how many books
+	// each holds.
+	List(ctx context.Context, userID int) ([]models.Shelf, error)
+	// Get returns the shelf with its books in shelf order.
+	Get(ctx context.Context, userID, shelfID int) (*models.ShelfDetail, error)
+	// Create inserts the shelf after the user's other shelves and sets its
+	// ID. It returns ErrConflict if the user already has a shelf by that
+	// name.
+	Create(ctx context.Context, userID int, shelf *models.Shelf) error
+	// Update changes the shelf's name and description. It returns
+	// ErrConflict if another of the user's shelves has that name.
+	Update(ctx context.Context, userID int, shelf *models.Shelf) error
+	// Delete deletes the shelf. The books on it are kept.
+	Delete(ctx context.Context, userID, shelfID int) error
+	// Reorder puts the user's shelves in the given order. It returns
+	// ErrConflict unless shelfIDs lists each of them exactly once.
+	Reorder(ctx context.Context, userID int, shelfIDs []int) error
+	// AddBook places the book on the shelf at position, counted from 0, or
+	// at the end when position is negative or past the end. It returns
+	// ErrNotFound if the shelf or the book isn't the user's and ErrConflict
+	// if the book is already on the shelf.
+	AddBook(ctx context.Context, userID, shelfID, bookID, position int) error
+	// RemoveBook takes the book off the shelf.
+	RemoveBook(ctx context.Context, userID, shelfID, bookID int) error
+	// ReorderBooks puts the shelf's books in the given order. It returns
+	// ErrConflict unless bookIDs lists each of them exactly once.
+	ReorderBooks(ctx context.Context, userID, shelfID int, bookIDs []int) error
+}
+
+// SmartShelfStore manages a user's smart shelves. Their books are the
+// user's books matching the shelf's rules when it is read; rules relative
+// to the current time, such as books added in the last 30 days, are
+// evaluated against now. Rules must have passed shelves.ValidateRules.
+type SmartShelfStore interface {
+	// List returns the user's smart shelves, ordered by name, with how many
+	// books match each.
+	List(ctx context.Context, userID int, now time.Time) ([]models.SmartShelf, error)
+	// Get returns the smart shelf with its books, newest first.
+	Get(ctx context.Context, userID, shelfID int, now time.Time) (*models.SmartShelfDetail, error)
+	// Books returns the user's books matching the rules, newest first.
+	Books(ctx context.Context, userID int, rules models.ShelfRules, now time.Time) ([]models.Book, error)
+	// Create inserts the smart shelf and sets its ID. It returns ErrConflict
+	// if the user already has a smart shelf by that name.
+	Create(ctx context.Context, userID int, shelf *models.SmartShelf) error
+	// Update replaces the smart shelf's name, description and rules. It
+	// returns ErrConflict if another of the user's smart shelves has that
+	// name.
+	Update(ctx context.Context, userID int, shelf *models.SmartShelf) error
+	Delete(ctx context.Context, userID, shelfID int) error
+}
+
+// Stores bundles one implementation of every store.
+type Stores struct {
+	Books      BookStore
+	Authors    AuthorStore
+	Tags       TagStore
+	Shelves    ShelfStore
+	Smart      SmartShelfStore
+	Cache      ISBNCacheStore
+	Enrichment EnrichmentStore
+	Lending    LendingStore
+	Reading    ReadingStore
+	Notes      NoteStore
+	Users      UserStore
+	Settings   SettingsStore
+	Stats      StatsStore
+	Export     ExportStore
+}
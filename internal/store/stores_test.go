@@ -0,0 +1,2056 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"booklib/internal/dialect"
+	"booklib/internal/migrations"
+	"booklib/internal/models"
+	"booklib/internal/reading"
+	"booklib/internal/shelves"
+)
+
+func TestMemoryStores(t *testing.T) {
+	testStores(t, NewMemory())
+}
+
+// day returns midnight UTC of the date, for session times that compare
+// equal after a round trip through any database.
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+// testUsers counts the users tests have created, to name them apart.
+var testUsers int
+
+// createUser adds a user with a name of its own and returns its ID.
+func createUser(t *testing.T, stores *Stores) int {
+	t.Helper()
+	testUsers++
+	user := &models.User{
+		Username:     fmt.Sprintf("reader%d", testUsers),
+		Email:        fmt.Sprintf("reader%d@example.com", testUsers),
+		PasswordHash: "hash",
+		Role:         "user",
+	}
+	if err := stores.Users.Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// testStores runs the checks every Stores implementation must pass. Each
+// subtest works with users of its own, so they can share the stores.
+func testStores(t *testing.T, stores *Stores) {
+	ctx := context.Background()
+	newUser := func(t *testing.T) int {
+		t.Helper()
+		return createUser(t, stores)
+	}
+	newBook := func(t *testing.T, userID int, book models.Book) models.Book {
+		t.Helper()
+		if err := stores.Books.Create(ctx, userID, &book); err != nil {
+			t.Fatal(err)
+		}
+		return book
+	}
+	getBook := func(t *testing.T, userID, bookID int) *models.Book {
+		t.Helper()
+		book, err := stores.Books.Get(ctx, userID, bookID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return book
+	}
+
+	t.Run("Books", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune", Author: "Frank Herbert", ISBN: "9780441013593"})
+		if book.ID == 0 || book.Status != reading.WantToRead || book.Read {
+			t.Errorf("created %+v", book)
+		}
+
+		got := getBook(t, owner, book.ID)
+		if got.Title != "Dune" || got.Author != "Frank Herbert" {
+			t.Errorf("got %+v", got)
+		}
+		if _, err := stores.Books.Get(ctx, other, book.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get as another user: %v, want ErrNotFound", err)
+		}
+		if id, err := stores.Books.FindByISBN(ctx, owner, "9780441013593"); err != nil || id != book.ID {
+			t.Errorf("FindByISBN = %d, %v; want %d", id, err, book.ID)
+		}
+		duplicate := models.Book{Title: "Dune again", ISBN: "9780441013593"}
+		if err := stores.Books.Create(ctx, owner, &duplicate); !errors.Is(err, ErrConflict) {
+			t.Errorf("duplicate ISBN: %v, want ErrConflict", err)
+		}
+		newBook(t, other, models.Book{Title: "Dune", ISBN: "9780441013593"})
+
+		update := models.Book{ID: book.ID, Title: "Dune Messiah", Author: "Frank Herbert", ISBN: "9780441013593", Description: "Arrakis", PageCount: 256}
+		if err := stores.Books.Update(ctx, owner, &update); err != nil {
+			t.Fatal(err)
+		}
+		if got := getBook(t, owner, book.ID); got.Title != "Dune Messiah" || got.Description != "Arrakis" || got.PageCount != 256 {
+			t.Errorf("after update got %+v", got)
+		}
+		// Fields left out are cleared, not kept
+		update = models.Book{ID: book.ID, Title: "Dune Messiah", Author: "Frank Herbert", ISBN: "9780441013593"}
+		if err := stores.Books.Update(ctx, owner, &update); err != nil {
+			t.Fatal(err)
+		}
+		if got := getBook(t, owner, book.ID); got.Description != "" || got.PageCount != 0 {
+			t.Errorf("after clearing the details got %+v", got)
+		}
+		if err := stores.Books.Update(ctx, other, &models.Book{ID: book.ID, Title: "Taken"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update as another user: %v, want ErrNotFound", err)
+		}
+
+		read := newBook(t, owner, models.Book{Title: "Emma", Read: true})
+		if read.Status != reading.Finished || !read.Read {
+			t.Errorf("book added as read is %s, read %v", read.Status, read.Read)
+		}
+
+		if err := stores.Books.Delete(ctx, other, book.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("delete as another user: %v, want ErrNotFound", err)
+		}
+		if err := stores.Books.Delete(ctx, owner, book.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Books.Get(ctx, owner, book.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get after delete: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("BookQueryPaging", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		// Three books share a sort key, so the cursor has to break ties by ID
+		var ids []int
+		for _, title := range []string{"Dune", "emma", "DUNE", "Anne", "dune"} {
+			ids = append(ids, newBook(t, owner, models.Book{Title: title}).ID)
+		}
+		newBook(t, other, models.Book{Title: "Dune"})
+
+		walk := func(t *testing.T, q BookQuery) []int {
+			t.Helper()
+			var got []int
+			for pages := 0; ; pages++ {
+				if pages > len(ids) {
+					t.Fatalf("cursor doesn't advance, got %v so far", got)
+				}
+				page, err := stores.Books.Query(ctx, owner, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if page.Total != len(ids) {
+					t.Errorf("total is %d, want %d", page.Total, len(ids))
+				}
+				if len(page.Books) > q.Limit {
+					t.Errorf("page of %d books, limit %d", len(page.Books), q.Limit)
+				}
+				for _, b := range page.Books {
+					got = append(got, b.ID)
+				}
+				if page.Next == nil {
+					return got
+				}
+				q.After = page.Next
+			}
+		}
+
+		byTitle := []int{ids[3], ids[0], ids[2], ids[4], ids[1]}
+		if got := walk(t, BookQuery{Sort: SortTitle, Limit: 2}); !slices.Equal(got, byTitle) {
+			t.Errorf("by title got %v, want %v", got, byTitle)
+		}
+		slices.Reverse(byTitle)
+		if got := walk(t, BookQuery{Sort: SortTitle, Desc: true, Limit: 2}); !slices.Equal(got, byTitle) {
+			t.Errorf("by title descending got %v, want %v", got, byTitle)
+		}
+
+		// Books created within the same instant tie on created_at too
+		all, err := stores.Books.Query(ctx, owner, BookQuery{Sort: SortCreatedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var byCreated []int
+		for _, b := range all.Books {
+			byCreated = append(byCreated, b.ID)
+		}
+		if !slices.Equal(byCreated, ids) {
+			t.Errorf("by creation got %v, want %v", byCreated, ids)
+		}
+		for _, limit := range []int{1, 2, 4} {
+			if got := walk(t, BookQuery{Sort: SortCreatedAt, Limit: limit}); !slices.Equal(got, ids) {
+				t.Errorf("pages of %d by creation got %v, want %v", limit, got, ids)
+			}
+		}
+		if got := walk(t, BookQuery{Sort: SortAuthor, Desc: true, Limit: 3}); len(got) != len(ids) {
+			t.Errorf("by author got %v, want all %d books", got, len(ids))
+		}
+
+		if _, err := stores.Books.Query(ctx, owner, BookQuery{Sort: SortRank}); err == nil {
+			t.Error("rank order without a search succeeded")
+		}
+	})
+
+	t.Run("BookQueryFilters", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{
+			Title: "Dune", Author: "Frank Herbert", Genres: []string{"Science Fiction", "Classics"}, Tags: []string{"signed", "Gift"},
+		})
+		emma := newBook(t, owner, models.Book{Title: "Emma", Author: "Jane Austen", Genres: []string{"Classics"}, Tags: []string{"gift"}})
+		hobbit := newBook(t, owner, models.Book{Title: "The Hobbit", Author: "J.R.R. Tolkien", Genres: []string{"Fantasy"}})
+		messiah := newBook(t, owner, models.Book{Title: "Dune Messiah", Author: "Frank Herbert"})
+		newBook(t, other, models.Book{Title: "Dune", Author: "Frank Herbert", Genres: []string{"Classics"}, Tags: []string{"signed"}})
+
+		logged := day(2025, time.January, 1)
+		sessions := []*models.ReadingHistory{
+			{BookID: dune.ID, StartedAt: day(2024, time.January, 1), CompletedAt: timePtr(day(2024, time.February, 1))},
+			{BookID: emma.ID, StartedAt: day(2024, time.May, 1)},
+			{BookID: messiah.ID, StartedAt: day(2023, time.January, 1), AbandonedAt: timePtr(day(2023, time.March, 1))},
+		}
+		for _, session := range sessions {
+			if _, err := stores.Reading.LogSession(ctx, owner, session, logged); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lent := &models.Lending{BookID: emma.ID, UserID: owner, LentTo: "Anne", LentAt: day(2024, time.June, 1)}
+		if err := stores.Lending.Create(ctx, lent); err != nil {
+			t.Fatal(err)
+		}
+		shelf := &models.Shelf{Name: "Favourites"}
+		if err := stores.Shelves.Create(ctx, owner, shelf); err != nil {
+			t.Fatal(err)
+		}
+		for _, id := range []int{hobbit.ID, dune.ID} {
+			if err := stores.Shelves.AddBook(ctx, owner, shelf.ID, id, -1); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		yes, no := true, false
+		now := time.Now()
+		all := []int{dune.ID, emma.ID, hobbit.ID, messiah.ID}
+		tests := []struct {
+			name string
+			q    BookQuery
+			want []int
+		}{
+			{"no filters", BookQuery{}, all},
+			{"read", BookQuery{Read: &yes}, []int{dune.ID}},
+			{"unread", BookQuery{Read: &no}, []int{emma.ID, hobbit.ID, messiah.ID}},
+			{"status", BookQuery{Status: reading.DidNotFinish}, []int{messiah.ID}},
+			{"lent out", BookQuery{LentOut: &yes}, []int{emma.ID}},
+			{"not lent out", BookQuery{LentOut: &no}, []int{dune.ID, hobbit.ID, messiah.ID}},
+			{"reading", BookQuery{Reading: &yes}, []int{emma.ID}},
+			{"not reading", BookQuery{Reading: &no}, []int{dune.ID, hobbit.ID, messiah.ID}},
+			{"started", BookQuery{Started: &yes}, []int{dune.ID, emma.ID, messiah.ID}},
+			{"not started", BookQuery{Started: &no}, []int{hobbit.ID}},
+			{"shelf", BookQuery{ShelfID: shelf.ID}, []int{dune.ID, hobbit.ID}},
+			{"genre", BookQuery{Genre: "classics"}, []int{dune.ID, emma.ID}},
+			{"genre other than the main one", BookQuery{Genre: "Science Fiction"}, []int{dune.ID}},
+			{"tag", BookQuery{Tags: []string{"GIFT"}}, []int{dune.ID, emma.ID}},
+			{"every tag", BookQuery{Tags: []string{"gift", "signed"}}, []int{dune.ID}},
+			{"author", BookQuery{Author: "herb"}, []int{dune.ID, messiah.ID}},
+			{"author with a wildcard", BookQuery{Author: "%"}, nil},
+			{"author credit", BookQuery{AuthorID: emma.Authors[0].ID}, []int{emma.ID}},
+			{"added in range", BookQuery{AddedFrom: now.Add(-time.Hour), AddedTo: now.Add(time.Hour)}, all},
+			{"added before range", BookQuery{AddedTo: now.Add(-time.Hour)}, nil},
+			{"added after range", BookQuery{AddedFrom: now.Add(time.Hour)}, nil},
+			{"finished from", BookQuery{FinishedFrom: day(2024, time.February, 1)}, []int{dune.ID}},
+			{"finished after", BookQuery{FinishedFrom: day(2024, time.February, 2)}, nil},
+			{"finished to", BookQuery{FinishedTo: day(2024, time.February, 1)}, nil},
+			{"finished in range", BookQuery{FinishedFrom: day(2024, time.January, 1), FinishedTo: day(2024, time.February, 2)}, []int{dune.ID}},
+			{"combined", BookQuery{Author: "Herbert", Started: &yes, Read: &no}, []int{messiah.ID}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := stores.Books.Query(ctx, owner, tt.q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []int
+				for _, b := range page.Books {
+					got = append(got, b.ID)
+				}
+				if !slices.Equal(got, tt.want) || page.Total != len(tt.want) {
+					t.Errorf("got books %v of %d, want %v", got, page.Total, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("BookSearch", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		inNotes := newBook(t, owner, models.Book{Title: "Sandworms", Author: "Brian Herbert", Notes: "a dune sequel", Read: true})
+		inTitle := newBook(t, owner, models.Book{Title: "Dune", Author: "Frank Herbert"})
+		inAuthor := newBook(t, owner, models.Book{Title: "Children", Author: "Ann Dunleavy"})
+		inGenre := newBook(t, owner, models.Book{Title: "Emma", Author: "Jane Austen", Genres: []string{"Classics"}})
+		newBook(t, other, models.Book{Title: "Dune", Author: "Frank Herbert"})
+
+		search := func(t *testing.T, q BookQuery) ([]int, *BookPage) {
+			t.Helper()
+			page, err := stores.Books.Query(ctx, owner, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, b := range page.Books {
+				ids = append(ids, b.ID)
+			}
+			return ids, page
+		}
+
+		// Title matches outrank author matches, which outrank notes
+		ranked := []int{inTitle.ID, inAuthor.ID, inNotes.ID}
+		got, page := search(t, BookQuery{Search: "DUN", Sort: SortRank})
+		if !slices.Equal(got, ranked) || page.Total != len(ranked) {
+			t.Errorf("ranked got %v of %d, want %v", got, page.Total, ranked)
+		}
+		for _, id := range ranked {
+			if !strings.Contains(page.Snippets[id], "<mark>") {
+				t.Errorf("snippet for book %d is %q, want a marked match", id, page.Snippets[id])
+			}
+		}
+		if !strings.Contains(page.Snippets[inTitle.ID], "<mark>Dune</mark>") {
+			t.Errorf("title match snippet is %q", page.Snippets[inTitle.ID])
+		}
+
+		// Paging by rank keeps the order
+		var paged []int
+		q := BookQuery{Search: "dun", Sort: SortRank, Limit: 1}
+		for range ranked {
+			ids, page := search(t, q)
+			paged = append(paged, ids...)
+			if page.Next == nil {
+				break
+			}
+			q.After = page.Next
+		}
+		if !slices.Equal(paged, ranked) {
+			t.Errorf("ranked pages got %v, want %v", paged, ranked)
+		}
+
+		read := true
+		tests := []struct {
+			name string
+			q    BookQuery
+			want []int
+		}{
+			{"every term must match", BookQuery{Search: "frank dune"}, []int{inTitle.ID}},
+			{"terms match word prefixes", BookQuery{Search: "herb"}, []int{inNotes.ID, inTitle.ID}},
+			{"genre", BookQuery{Search: "classic"}, []int{inGenre.ID}},
+			{"no match", BookQuery{Search: "arrakis"}, nil},
+			{"no words", BookQuery{Search: "?!"}, nil},
+			{"with a filter", BookQuery{Search: "dun", Read: &read}, []int{inNotes.ID}},
+			{"by title", BookQuery{Search: "dun", Sort: SortTitle}, []int{inAuthor.ID, inTitle.ID, inNotes.ID}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got, _ := search(t, tt.q); !slices.Equal(got, tt.want) {
+					t.Errorf("got books %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		// Snippets are escaped, leaving the marks as the only markup
+		markup := newBook(t, owner, models.Book{Title: "Markup", Notes: `<script>alert("spice")</script> & more`})
+		_, page = search(t, BookQuery{Search: "spice"})
+		snippet := page.Snippets[markup.ID]
+		if strings.Contains(snippet, "<script>") || !strings.Contains(snippet, "&lt;script&gt;") || !strings.Contains(snippet, "<mark>spice</mark>") {
+			t.Errorf("snippet with markup is %q", snippet)
+		}
+	})
+
+	t.Run("Authors", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		// Authors are shared between users, so these are names no other
+		// test uses
+		omens := newBook(t, owner, models.Book{Title: "Good Omens", Authors: []models.BookAuthor{
+			{Name: "Quill, Ottoline"},
+			{Name: "Bram Vesper", Role: models.RoleTranslator},
+			{Name: "Bram Vesper", Role: models.RoleIllustrator},
+		}})
+		atlas := newBook(t, owner, models.Book{Title: "atlas", Author: "Ottoline Quill and Bram Vesper"})
+		newBook(t, owner, models.Book{Title: "Moths", Author: "O. T. Quill"})
+		newBook(t, owner, models.Book{Title: "Zephyr", Author: "Ottoline Quill"})
+		newBook(t, other, models.Book{Title: "Lanterns", Author: "Bram Vesper"})
+
+		// Matched by key and named as first seen
+		if got := atlas.Authors; len(got) != 2 || got[0].Name != "Quill, Ottoline" || got[1].Name != "Bram Vesper" {
+			t.Fatalf("credits %+v", got)
+		}
+		quill, vesper := atlas.Authors[0].ID, atlas.Authors[1].ID
+
+		summary := func(list []models.AuthorSummary) []string {
+			var got []string
+			for _, a := range list {
+				got = append(got, fmt.Sprintf("%s %d", a.Name, a.BookCount))
+			}
+			return got
+		}
+		tests := []struct {
+			userID int
+			search string
+			want   []string
+		}{
+			// "O. T. Quill" is an author of their own
+			{owner, "", []string{"Bram Vesper 2", "O. T. Quill 1", "Quill, Ottoline 3"}},
+			{owner, "QUILL", []string{"O. T. Quill 1", "Quill, Ottoline 3"}},
+			{owner, "nobody", nil},
+			{other, "", []string{"Bram Vesper 1"}},
+		}
+		for _, tt := range tests {
+			list, err := stores.Authors.List(ctx, tt.userID, tt.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summary(list); !slices.Equal(got, tt.want) {
+				t.Errorf("List(%q) = %q, want %q", tt.search, got, tt.want)
+			}
+		}
+
+		detail, err := stores.Authors.Get(ctx, owner, vesper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Ordered by title, ignoring case, with the roles on each
+		var got []string
+		for _, b := range detail.Books {
+			got = append(got, b.Title+": "+strings.Join(b.Roles, ", "))
+		}
+		want := []string{"atlas: author", "Good Omens: illustrator, translator"}
+		if detail.Name != "Bram Vesper" || !slices.Equal(got, want) {
+			t.Errorf("Get = %s, %q; want Bram Vesper, %q", detail.Name, got, want)
+		}
+		if detail.Books[1].ID != omens.ID {
+			t.Errorf("Get returned book %d, want %d", detail.Books[1].ID, omens.ID)
+		}
+		if _, err := stores.Authors.Get(ctx, other, quill); !errors.Is(err, ErrNotFound) {
+			t.Errorf("author on none of the user's books: %v, want ErrNotFound", err)
+		}
+		if _, err := stores.Authors.Get(ctx, owner, -1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("missing author: %v, want ErrNotFound", err)
+		}
+
+		// Top authors count only credits as author, and stop at five
+		for i := 1; i <= 5; i++ {
+			newBook(t, owner, models.Book{Title: "Filler", Author: fmt.Sprintf("Aster Filler%d", i)})
+		}
+		stats, err := stores.Stats.UserStats(ctx, owner, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = nil
+		for _, a := range stats.TopAuthors {
+			got = append(got, fmt.Sprintf("%s %d", a.Name, a.Count))
+		}
+		want = []string{"Quill, Ottoline 3", "Aster Filler1 1", "Aster Filler2 1", "Aster Filler3 1", "Aster Filler4 1"}
+		if !slices.Equal(got, want) {
+			t.Errorf("top authors %q, want %q", got, want)
+		}
+		if stats.TopAuthors[0].AuthorID != quill {
+			t.Errorf("top author ID %d, want %d", stats.TopAuthors[0].AuthorID, quill)
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{Title: "Dune", Tags: []string{"Book Club"}})
+		emma := newBook(t, owner, models.Book{Title: "Emma", Read: true})
+		theirs := newBook(t, other, models.Book{Title: "Dune", Tags: []string{"Favourites"}})
+
+		list := func(t *testing.T, userID int) []string {
+			t.Helper()
+			summaries, err := stores.Tags.List(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, tag := range summaries {
+				got = append(got, fmt.Sprintf("%s %d", tag.Name, tag.BookCount))
+			}
+			return got
+		}
+
+		favourites := models.Tag{Name: "Favourites"}
+		if err := stores.Tags.Create(ctx, owner, &favourites); err != nil {
+			t.Fatal(err)
+		}
+		if favourites.ID == 0 || favourites.CreatedAt == nil {
+			t.Errorf("created %+v", favourites)
+		}
+		// Names are matched ignoring case and spacing, per user
+		if err := stores.Tags.Create(ctx, owner, &models.Tag{Name: "book  club"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("duplicate name: %v, want ErrConflict", err)
+		}
+		if got, want := list(t, owner), []string{"Book Club 1", "Favourites 0"}; !slices.Equal(got, want) {
+			t.Errorf("List = %q, want %q", got, want)
+		}
+
+		added, err := stores.Tags.AddBooks(ctx, owner, favourites.ID, []int{dune.ID, emma.ID})
+		if err != nil || added != 2 {
+			t.Fatalf("AddBooks = %d, %v; want 2", added, err)
+		}
+		// Books already carrying it don't count
+		if added, err := stores.Tags.AddBooks(ctx, owner, favourites.ID, []int{dune.ID}); err != nil || added != 0 {
+			t.Errorf("tagging again = %d, %v; want 0", added, err)
+		}
+		if got := getBook(t, owner, dune.ID).Tags; !slices.Equal(got, []string{"Book Club", "Favourites"}) {
+			t.Errorf("tags after AddBooks %q", got)
+		}
+		// Nothing is tagged when any book isn't the user's
+		fresh := models.Tag{Name: "Fresh"}
+		if err := stores.Tags.Create(ctx, owner, &fresh); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Tags.AddBooks(ctx, owner, fresh.ID, []int{dune.ID, theirs.ID}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("tagging another user's book: %v, want ErrNotFound", err)
+		}
+		if _, err := stores.Tags.AddBooks(ctx, other, favourites.ID, []int{theirs.ID}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("tagging with another user's tag: %v, want ErrNotFound", err)
+		}
+		if got, want := list(t, owner), []string{"Book Club 1", "Favourites 2", "Fresh 0"}; !slices.Equal(got, want) {
+			t.Errorf("List = %q, want %q", got, want)
+		}
+
+		rename := models.Tag{ID: favourites.ID, Name: "Loved"}
+		if err := stores.Tags.Rename(ctx, owner, &rename); err != nil {
+			t.Fatal(err)
+		}
+		if got := getBook(t, owner, emma.ID).Tags; !slices.Equal(got, []string{"Loved"}) {
+			t.Errorf("tags after rename %q", got)
+		}
+		if err := stores.Tags.Rename(ctx, owner, &models.Tag{ID: favourites.ID, Name: "BOOK CLUB"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("renaming to an existing tag: %v, want ErrConflict", err)
+		}
+		// A tag can change the case of its own name
+		if err := stores.Tags.Rename(ctx, owner, &models.Tag{ID: favourites.ID, Name: "LOVED"}); err != nil {
+			t.Errorf("renaming to its own name: %v", err)
+		}
+		if err := stores.Tags.Rename(ctx, other, &models.Tag{ID: favourites.ID, Name: "Mine"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("renaming another user's tag: %v, want ErrNotFound", err)
+		}
+		// The other user's tag of the old name is untouched
+		if got := getBook(t, other, theirs.ID).Tags; !slices.Equal(got, []string{"Favourites"}) {
+			t.Errorf("other user's tags %q", got)
+		}
+
+		if err := stores.Tags.RemoveBook(ctx, owner, favourites.ID, dune.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Tags.RemoveBook(ctx, owner, favourites.ID, dune.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("removing twice: %v, want ErrNotFound", err)
+		}
+		if got := getBook(t, owner, dune.ID).Tags; !slices.Equal(got, []string{"Book Club"}) {
+			t.Errorf("tags after RemoveBook %q", got)
+		}
+
+		if err := stores.Tags.Delete(ctx, other, favourites.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting another user's tag: %v, want ErrNotFound", err)
+		}
+		if err := stores.Tags.Delete(ctx, owner, favourites.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got := getBook(t, owner, emma.ID).Tags; len(got) != 0 {
+			t.Errorf("tags after Delete %q", got)
+		}
+		if got, want := list(t, owner), []string{"Book Club 1", "Fresh 0"}; !slices.Equal(got, want) {
+			t.Errorf("List = %q, want %q", got, want)
+		}
+
+		stats, err := stores.Stats.UserStats(ctx, owner, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, tag := range stats.TagBreakdown {
+			got = append(got, fmt.Sprintf("%s %d/%d", tag.Tag, tag.Read, tag.Count))
+		}
+		if want := []string{"Book Club 0/1", "Fresh 0/0"}; !slices.Equal(got, want) {
+			t.Errorf("tag breakdown %q, want %q", got, want)
+		}
+	})
+
+	t.Run("Genres", func(t *testing.T) {
+		owner := newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune", Genres: []string{"Science Fiction", "science  fiction", "Classics"}})
+		if book.Genre != "Science Fiction" || !slices.Equal(book.Genres, []string{"Science Fiction", "Classics"}) {
+			t.Errorf("created with %q, %q", book.Genre, book.Genres)
+		}
+		if got := newBook(t, owner, models.Book{Title: "Emma", Genre: "Romance"}); !slices.Equal(got.Genres, []string{"Romance"}) {
+			t.Errorf("genre alone gives genres %q", got.Genres)
+		}
+
+		tests := []struct {
+			name      string
+			book      models.Book
+			wantGenre string
+			want      []string
+		}{
+			// A client that only knows the main genre keeps the rest
+			{"same genre", models.Book{Genre: "science fiction"}, "Science Fiction", []string{"Science Fiction", "Classics"}},
+			{"new genre", models.Book{Genre: "Adventure"}, "Adventure", []string{"Adventure"}},
+			{"genres", models.Book{Genre: "ignored", Genres: []string{"Epic", "Adventure"}}, "Epic", []string{"Epic", "Adventure"}},
+			{"no genre", models.Book{}, "", nil},
+		}
+		for _, tt := range tests {
+			tt.book.ID, tt.book.Title = book.ID, "Dune"
+			if err := stores.Books.Update(ctx, owner, &tt.book); err != nil {
+				t.Fatal(err)
+			}
+			got := getBook(t, owner, book.ID)
+			if got.Genre != tt.wantGenre || !slices.Equal(got.Genres, tt.want) {
+				t.Errorf("%s: got %q, %q; want %q, %q", tt.name, got.Genre, got.Genres, tt.wantGenre, tt.want)
+			}
+		}
+		if err := stores.Books.Update(ctx, owner, &models.Book{ID: book.ID, Title: "Dune", Genres: []string{"Science Fiction", "Classics"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := stores.Stats.UserStats(ctx, owner, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, genre := range stats.GenreBreakdown {
+			got = append(got, fmt.Sprintf("%s %d", genre.Genre, genre.Count))
+		}
+		slices.Sort(got)
+		// Every genre of a book counts, not just the main one
+		if want := []string{"Classics 1", "Romance 1", "Science Fiction 1"}; !slices.Equal(got, want) {
+			t.Errorf("genre breakdown %q, want %q", got, want)
+		}
+	})
+
+	t.Run("ReadingStatus", func(t *testing.T) {
+		owner := newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune"})
+		at := day(2024, time.March, 1)
+
+		session, err := stores.Reading.Start(ctx, owner, book.ID, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Reading.SetStatus(ctx, owner, book.ID, reading.Finished, at.Add(24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := stores.Reading.Get(ctx, session.ID); got.CompletedAt == nil {
+			t.Errorf("finishing the book left its session in progress")
+		}
+		if got := getBook(t, owner, book.ID); got.Status != reading.Finished || !got.Read {
+			t.Errorf("after finishing the book is %s, read %v", got.Status, got.Read)
+		}
+
+		// A re-read starts a new session and keeps the book read
+		change, err := stores.Reading.SetStatus(ctx, owner, book.ID, reading.Reading, at.Add(48*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if change.Session == nil || change.Session.ID == session.ID {
+			t.Errorf("re-read session is %+v", change.Session)
+		}
+		if got := getBook(t, owner, book.ID); got.Status != reading.Reading || !got.Read {
+			t.Errorf("while re-reading the book is %s, read %v", got.Status, got.Read)
+		}
+
+		if _, err := stores.Reading.SetStatus(ctx, owner, book.ID, reading.Paused, at.Add(72*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Reading.SetStatus(ctx, owner, book.ID, reading.WantToRead, at.Add(96*time.Hour)); !errors.Is(err, reading.ErrInvalidTransition) {
+			t.Errorf("paused to want_to_read: %v, want ErrInvalidTransition", err)
+		}
+
+		changes, err := stores.Reading.StatusChanges(ctx, owner, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"want_to_read>reading", "reading>finished", "finished>reading", "reading>paused"}
+		if len(changes) != len(want) {
+			t.Fatalf("got %d status changes, want %d", len(changes), len(want))
+		}
+		for i, c := range changes {
+			if c.From+">"+c.To != want[i] {
+				t.Errorf("change %d is %s>%s, want %s", i, c.From, c.To, want[i])
+			}
+		}
+	})
+
+	t.Run("Sessions", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune"})
+		now := day(2025, time.January, 1)
+
+		first := &models.ReadingHistory{BookID: book.ID, StartedAt: day(2020, time.January, 1), CompletedAt: timePtr(day(2020, time.February, 1))}
+		state, err := stores.Reading.LogSession(ctx, owner, first, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first.ID == 0 || state != (models.ReadState{Status: reading.Finished, Read: true}) {
+			t.Errorf("after logging a finished session: %+v, %+v", first, state)
+		}
+		// The move is dated when the session ended
+		if got := getBook(t, owner, book.ID); got.StatusChangedAt == nil || !got.StatusChangedAt.Equal(*first.CompletedAt) {
+			t.Errorf("status_changed_at is %v, want %v", got.StatusChangedAt, first.CompletedAt)
+		}
+
+		overlapping := &models.ReadingHistory{BookID: book.ID, StartedAt: day(2020, time.January, 15)}
+		if _, err := stores.Reading.LogSession(ctx, owner, overlapping, now); !errors.Is(err, reading.ErrOverlap) {
+			t.Errorf("overlapping session: %v, want ErrOverlap", err)
+		}
+		stranger := &models.ReadingHistory{BookID: book.ID, StartedAt: day(2021, time.January, 1)}
+		if _, err := stores.Reading.LogSession(ctx, other, stranger, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("session on another user's book: %v, want ErrNotFound", err)
+		}
+
+		second := &models.ReadingHistory{BookID: book.ID, StartedAt: day(2021, time.January, 1)}
+		if state, err = stores.Reading.LogSession(ctx, owner, second, now); err != nil {
+			t.Fatal(err)
+		}
+		if state != (models.ReadState{Status: reading.Reading, Read: true}) {
+			t.Errorf("while re-reading: %+v", state)
+		}
+
+		second.AbandonedAt = timePtr(day(2021, time.March, 1))
+		if state, err = stores.Reading.EditSession(ctx, owner, second, now); err != nil {
+			t.Fatal(err)
+		}
+		if state != (models.ReadState{Status: reading.DidNotFinish, Read: true}) {
+			t.Errorf("after abandoning the re-read: %+v", state)
+		}
+		if got := getBook(t, owner, book.ID); got.StatusChangedAt == nil || !got.StatusChangedAt.Equal(*second.AbandonedAt) {
+			t.Errorf("status_changed_at is %v, want %v", got.StatusChangedAt, second.AbandonedAt)
+		}
+
+		if state, err = stores.Reading.DeleteSession(ctx, owner, first.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if state != (models.ReadState{Status: reading.DidNotFinish, Read: false}) {
+			t.Errorf("without the finished session: %+v", state)
+		}
+		if state, err = stores.Reading.DeleteSession(ctx, owner, second.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if state != (models.ReadState{Status: reading.WantToRead, Read: false}) {
+			t.Errorf("without sessions: %+v", state)
+		}
+		if got := getBook(t, owner, book.ID); got.StatusChangedAt == nil || !got.StatusChangedAt.Equal(now) {
+			t.Errorf("status_changed_at is %v, want %v", got.StatusChangedAt, now)
+		}
+	})
+
+	t.Run("FinishWithReview", func(t *testing.T) {
+		owner := newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune"})
+		at := day(2024, time.March, 1)
+		session, err := stores.Reading.Start(ctx, owner, book.ID, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rating := 4.5
+		review := &models.Review{Rating: &rating, Body: "Spice"}
+		if _, err := stores.Reading.Finish(ctx, session.ID, review, at.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if review.ID == 0 || review.SessionID != session.ID {
+			t.Errorf("saved review is %+v", review)
+		}
+		saved, err := stores.Reading.Review(ctx, session.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if saved.Rating == nil || *saved.Rating != 4.5 || saved.Body != "Spice" {
+			t.Errorf("stored review is %+v", saved)
+		}
+		if got := getBook(t, owner, book.ID); got.Status != reading.Finished || !got.Read {
+			t.Errorf("after finishing the book is %s, read %v", got.Status, got.Read)
+		}
+	})
+
+	t.Run("SmartShelfRules", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{
+			Title: "Dune", Author: "Frank Herbert", Genres: []string{"Science Fiction", "Classics"},
+			Tags: []string{"Signed"}, Language: "en", PageCount: 412,
+		})
+		emma := newBook(t, owner, models.Book{
+			Title: "Emma", Author: "Jane Austen", Genres: []string{"Classics"}, Language: "EN", PageCount: 474,
+		})
+		hobbit := newBook(t, owner, models.Book{
+			Title: "The Hobbit", Author: "J.R.R. Tolkien", Genres: []string{"Fantasy"}, Tags: []string{"gift"},
+		})
+		messiah := newBook(t, owner, models.Book{Title: "Dune Messiah", Author: "Frank Herbert", PageCount: 256})
+		// Matches every rule below that some of the owner's books match
+		newBook(t, other, models.Book{Title: "Dune", Author: "Frank Herbert", Genres: []string{"Classics"}, Tags: []string{"signed"}})
+
+		logged := day(2025, time.January, 1)
+		sessions := []*models.ReadingHistory{
+			{BookID: dune.ID, StartedAt: day(2024, time.January, 1), CompletedAt: timePtr(day(2024, time.February, 1))},
+			{BookID: emma.ID, StartedAt: day(2024, time.May, 1)},
+			{BookID: messiah.ID, StartedAt: day(2023, time.January, 1), AbandonedAt: timePtr(day(2023, time.March, 1))},
+		}
+		for _, session := range sessions {
+			if _, err := stores.Reading.LogSession(ctx, owner, session, logged); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lent := &models.Lending{BookID: emma.ID, UserID: owner, LentTo: "Anne", LentAt: day(2024, time.June, 1)}
+		returned := &models.Lending{BookID: messiah.ID, UserID: owner, LentTo: "Anne", LentAt: day(2024, time.June, 1)}
+		for _, l := range []*models.Lending{lent, returned} {
+			if err := stores.Lending.Create(ctx, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stores.Lending.MarkReturned(ctx, returned.ID, day(2024, time.July, 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		date := func(days int) string { return now.UTC().AddDate(0, 0, days).Format("2006-01-02") }
+		rule := func(field, op string, value any) []models.ShelfRule {
+			return []models.ShelfRule{{Field: field, Op: op, Value: value}}
+		}
+		all := []int{dune.ID, emma.ID, hobbit.ID, messiah.ID}
+		tests := []struct {
+			name  string
+			rules models.ShelfRules
+			now   time.Time
+			want  []int
+		}{
+			{"title is", models.ShelfRules{Rules: rule("title", "is", "dune")}, now, []int{dune.ID}},
+			{"title is not", models.ShelfRules{Rules: rule("title", "is_not", "Dune")}, now, []int{emma.ID, hobbit.ID, messiah.ID}},
+			{"title contains", models.ShelfRules{Rules: rule("title", "contains", "DUNE")}, now, []int{dune.ID, messiah.ID}},
+			{"title does not contain", models.ShelfRules{Rules: rule("title", "not_contains", "dune")}, now, []int{emma.ID, hobbit.ID}},
+			{"title contains a wildcard", models.ShelfRules{Rules: rule("title", "contains", "%")}, now, nil},
+			{"author is", models.ShelfRules{Rules: rule("author", "is", "frank herbert")}, now, []int{dune.ID, messiah.ID}},
+			{"genre is", models.ShelfRules{Rules: rule("genre", "is", "classics")}, now, []int{dune.ID, emma.ID}},
+			{"genre is not", models.ShelfRules{Rules: rule("genre", "is_not", "Classics")}, now, []int{hobbit.ID, messiah.ID}},
+			{"tag is", models.ShelfRules{Rules: rule("tag", "is", "SIGNED")}, now, []int{dune.ID}},
+			{"tag is not", models.ShelfRules{Rules: rule("tag", "is_not", "signed")}, now, []int{emma.ID, hobbit.ID, messiah.ID}},
+			{"language is", models.ShelfRules{Rules: rule("language", "is", "en")}, now, []int{dune.ID, emma.ID}},
+			{"read", models.ShelfRules{Rules: rule("read", "is", true)}, now, []int{dune.ID}},
+			{"unread", models.ShelfRules{Rules: rule("read", "is", false)}, now, []int{emma.ID, hobbit.ID, messiah.ID}},
+			{"status is", models.ShelfRules{Rules: rule("status", "is", reading.Reading)}, now, []int{emma.ID}},
+			{"status is not", models.ShelfRules{Rules: rule("status", "is_not", reading.WantToRead)}, now, []int{dune.ID, emma.ID, messiah.ID}},
+			{"lent out", models.ShelfRules{Rules: rule("lent_out", "is", true)}, now, []int{emma.ID}},
+			{"not lent out", models.ShelfRules{Rules: rule("lent_out", "is", false)}, now, []int{dune.ID, hobbit.ID, messiah.ID}},
+			{"reading", models.ShelfRules{Rules: rule("reading", "is", true)}, now, []int{emma.ID}},
+			{"not reading", models.ShelfRules{Rules: rule("reading", "is", false)}, now, []int{dune.ID, hobbit.ID, messiah.ID}},
+			{"started", models.ShelfRules{Rules: rule("started", "is", true)}, now, []int{dune.ID, emma.ID, messiah.ID}},
+			{"not started", models.ShelfRules{Rules: rule("started", "is", false)}, now, []int{hobbit.ID}},
+			{"page count is", models.ShelfRules{Rules: rule("page_count", "is", 412)}, now, []int{dune.ID}},
+			{"page count above", models.ShelfRules{Rules: rule("page_count", "gt", 412)}, now, []int{emma.ID}},
+			{"page count below", models.ShelfRules{Rules: rule("page_count", "lt", 300)}, now, []int{hobbit.ID, messiah.ID}},
+			{"added within days", models.ShelfRules{Rules: rule("added", "within_days", 1)}, now, all},
+			{"added within days from later", models.ShelfRules{Rules: rule("added", "within_days", 1)}, now.AddDate(0, 0, 3), nil},
+			{"added before", models.ShelfRules{Rules: rule("added", "before", date(2))}, now, all},
+			{"added before today", models.ShelfRules{Rules: rule("added", "before", date(-2))}, now, nil},
+			{"added after", models.ShelfRules{Rules: rule("added", "after", date(-2))}, now, all},
+			// The range leaves the date itself out
+			{"finished after", models.ShelfRules{Rules: rule("finished", "after", "2024-01-31")}, now, []int{dune.ID}},
+			{"finished after the day", models.ShelfRules{Rules: rule("finished", "after", "2024-02-01")}, now, nil},
+			{"finished before the day", models.ShelfRules{Rules: rule("finished", "before", "2024-02-01")}, now, nil},
+			{"finished before", models.ShelfRules{Rules: rule("finished", "before", "2024-02-02")}, now, []int{dune.ID}},
+			{"finished within days", models.ShelfRules{Rules: rule("finished", "within_days", 14)}, day(2024, time.February, 10), []int{dune.ID}},
+			{"finished too long ago", models.ShelfRules{Rules: rule("finished", "within_days", 5)}, day(2024, time.February, 10), nil},
+			{"all of", models.ShelfRules{Rules: []models.ShelfRule{
+				{Field: "author", Op: "is", Value: "Frank Herbert"}, {Field: "read", Op: "is", Value: false},
+			}}, now, []int{messiah.ID}},
+			{"any of", models.ShelfRules{Match: "any", Rules: []models.ShelfRule{
+				{Field: "title", Op: "is", Value: "Emma"}, {Field: "tag", Op: "is", Value: "signed"},
+			}}, now, []int{dune.ID, emma.ID}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := shelves.ValidateRules(&tt.rules); err != nil {
+					t.Fatal(err)
+				}
+				books, err := stores.Smart.Books(ctx, owner, tt.rules, tt.now)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got []int
+				for _, b := range books {
+					got = append(got, b.ID)
+				}
+				slices.Sort(got)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("got books %v, want %v", got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("Shelves", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		var books []int
+		for _, title := range []string{"Dune", "Emma", "The Hobbit", "Hyperion"} {
+			books = append(books, newBook(t, owner, models.Book{Title: title}).ID)
+		}
+		dune, emma, hobbit, hyperion := books[0], books[1], books[2], books[3]
+		theirs := newBook(t, other, models.Book{Title: "Dune"}).ID
+
+		var shelfIDs []int
+		for _, name := range []string{"Favourites", "To lend", "Classics"} {
+			shelf := models.Shelf{Name: name, Description: "My " + name}
+			if err := stores.Shelves.Create(ctx, owner, &shelf); err != nil {
+				t.Fatal(err)
+			}
+			shelfIDs = append(shelfIDs, shelf.ID)
+		}
+		favourites, lend, classics := shelfIDs[0], shelfIDs[1], shelfIDs[2]
+		if err := stores.Shelves.Create(ctx, owner, &models.Shelf{Name: "FAVOURITES"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("duplicate name: %v, want ErrConflict", err)
+		}
+		if err := stores.Shelves.Create(ctx, other, &models.Shelf{Name: "Favourites"}); err != nil {
+			t.Errorf("another user's shelf of the same name: %v", err)
+		}
+
+		names := func(t *testing.T) []string {
+			t.Helper()
+			list, err := stores.Shelves.List(ctx, owner)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, shelf := range list {
+				got = append(got, fmt.Sprintf("%s %d", shelf.Name, shelf.BookCount))
+			}
+			return got
+		}
+		// In the order they were created
+		if got, want := names(t), []string{"Favourites 0", "To lend 0", "Classics 0"}; !slices.Equal(got, want) {
+			t.Errorf("List = %q, want %q", got, want)
+		}
+
+		if err := stores.Shelves.Reorder(ctx, owner, []int{classics, favourites, lend}); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := names(t), []string{"Classics 0", "Favourites 0", "To lend 0"}; !slices.Equal(got, want) {
+			t.Errorf("after Reorder = %q, want %q", got, want)
+		}
+		for _, order := range [][]int{{classics, favourites}, {classics, favourites, lend, lend}, {classics, favourites, favourites}, nil} {
+			if err := stores.Shelves.Reorder(ctx, owner, order); !errors.Is(err, ErrConflict) {
+				t.Errorf("Reorder(%v) = %v, want ErrConflict", order, err)
+			}
+		}
+		if got, want := names(t), []string{"Classics 0", "Favourites 0", "To lend 0"}; !slices.Equal(got, want) {
+			t.Errorf("a rejected order changed it to %q", got)
+		}
+		// New shelves go after the reordered ones
+		last := models.Shelf{Name: "Last"}
+		if err := stores.Shelves.Create(ctx, owner, &last); err != nil {
+			t.Fatal(err)
+		}
+		if got := names(t); got[len(got)-1] != "Last 0" {
+			t.Errorf("new shelf placed in %q", got)
+		}
+
+		order := func(t *testing.T, shelfID int) []int {
+			t.Helper()
+			detail, err := stores.Shelves.Get(ctx, owner, shelfID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, b := range detail.Books {
+				got = append(got, b.ID)
+			}
+			return got
+		}
+		steps := []struct {
+			book, position int
+			want           []int
+		}{
+			{dune, -1, []int{dune}},
+			{emma, -1, []int{dune, emma}},
+			{hobbit, 0, []int{hobbit, dune, emma}},
+			{hyperion, 2, []int{hobbit, dune, hyperion, emma}},
+		}
+		for _, step := range steps {
+			if err := stores.Shelves.AddBook(ctx, owner, favourites, step.book, step.position); err != nil {
+				t.Fatal(err)
+			}
+			if got := order(t, favourites); !slices.Equal(got, step.want) {
+				t.Errorf("after adding %d at %d: %v, want %v", step.book, step.position, got, step.want)
+			}
+		}
+		// Past the end is the end
+		if err := stores.Shelves.AddBook(ctx, owner, classics, emma, 5); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Shelves.AddBook(ctx, owner, classics, dune, 7); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(t, classics); !slices.Equal(got, []int{emma, dune}) {
+			t.Errorf("adding past the end: %v", got)
+		}
+
+		if err := stores.Shelves.AddBook(ctx, owner, favourites, dune, 0); !errors.Is(err, ErrConflict) {
+			t.Errorf("adding twice: %v, want ErrConflict", err)
+		}
+		if err := stores.Shelves.AddBook(ctx, owner, favourites, theirs, -1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("adding another user's book: %v, want ErrNotFound", err)
+		}
+		if err := stores.Shelves.AddBook(ctx, other, favourites, theirs, -1); !errors.Is(err, ErrNotFound) {
+			t.Errorf("adding to another user's shelf: %v, want ErrNotFound", err)
+		}
+		if _, err := stores.Shelves.Get(ctx, other, favourites); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get as another user: %v, want ErrNotFound", err)
+		}
+
+		if err := stores.Shelves.ReorderBooks(ctx, owner, favourites, []int{emma, hyperion, dune, hobbit}); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(t, favourites); !slices.Equal(got, []int{emma, hyperion, dune, hobbit}) {
+			t.Errorf("after ReorderBooks: %v", got)
+		}
+		// Adding at a position counts from the new order
+		if err := stores.Shelves.RemoveBook(ctx, owner, favourites, hyperion); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Shelves.AddBook(ctx, owner, favourites, hyperion, 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(t, favourites); !slices.Equal(got, []int{emma, hyperion, dune, hobbit}) {
+			t.Errorf("re-adding at 1: %v", got)
+		}
+		for _, bad := range [][]int{{emma, hyperion, dune}, {emma, hyperion, dune, hobbit, theirs}, {emma, emma, dune, hobbit}} {
+			if err := stores.Shelves.ReorderBooks(ctx, owner, favourites, bad); !errors.Is(err, ErrConflict) {
+				t.Errorf("ReorderBooks(%v) = %v, want ErrConflict", bad, err)
+			}
+		}
+		if err := stores.Shelves.ReorderBooks(ctx, other, favourites, []int{emma, hyperion, dune, hobbit}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("reordering another user's shelf: %v, want ErrNotFound", err)
+		}
+		if got := order(t, favourites); !slices.Equal(got, []int{emma, hyperion, dune, hobbit}) {
+			t.Errorf("a rejected order changed it to %v", got)
+		}
+
+		if err := stores.Shelves.RemoveBook(ctx, owner, lend, dune); !errors.Is(err, ErrNotFound) {
+			t.Errorf("removing a book not on the shelf: %v, want ErrNotFound", err)
+		}
+		// Deleting a book takes it off its shelves
+		if err := stores.Books.Delete(ctx, owner, dune); err != nil {
+			t.Fatal(err)
+		}
+		if got := order(t, favourites); !slices.Equal(got, []int{emma, hyperion, hobbit}) {
+			t.Errorf("after deleting a book: %v", got)
+		}
+
+		update := models.Shelf{ID: lend, Name: "Lent", Description: ""}
+		if err := stores.Shelves.Update(ctx, owner, &update); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Shelves.Update(ctx, owner, &models.Shelf{ID: lend, Name: "classics"}); !errors.Is(err, ErrConflict) {
+			t.Errorf("renaming to an existing shelf: %v, want ErrConflict", err)
+		}
+		if err := stores.Shelves.Update(ctx, other, &models.Shelf{ID: lend, Name: "Mine"}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("updating another user's shelf: %v, want ErrNotFound", err)
+		}
+
+		if err := stores.Shelves.Delete(ctx, other, favourites); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting another user's shelf: %v, want ErrNotFound", err)
+		}
+		if err := stores.Shelves.Delete(ctx, owner, favourites); err != nil {
+			t.Fatal(err)
+		}
+		// The books on it are kept
+		getBook(t, owner, emma)
+		if got, want := names(t), []string{"Classics 1", "Lent 0", "Last 0"}; !slices.Equal(got, want) {
+			t.Errorf("after Delete = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("SmartShelves", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{Title: "Dune", Genre: "Science Fiction"})
+		hyperion := newBook(t, owner, models.Book{Title: "Hyperion", Genre: "Science Fiction"})
+		newBook(t, owner, models.Book{Title: "Emma", Genre: "Classics"})
+		newBook(t, other, models.Book{Title: "Dune", Genre: "Science Fiction"})
+
+		rules := func(genre string) models.ShelfRules {
+			r := models.ShelfRules{Rules: []models.ShelfRule{{Field: "genre", Op: "is", Value: genre}}}
+			if err := shelves.ValidateRules(&r); err != nil {
+				t.Fatal(err)
+			}
+			return r
+		}
+		shelf := models.SmartShelf{Name: "SF", Rules: rules("science fiction")}
+		if err := stores.Smart.Create(ctx, owner, &shelf); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Smart.Create(ctx, owner, &models.SmartShelf{Name: "sf", Rules: rules("Classics")}); !errors.Is(err, ErrConflict) {
+			t.Errorf("duplicate name: %v, want ErrConflict", err)
+		}
+		if err := stores.Smart.Create(ctx, owner, &models.SmartShelf{Name: "Austen", Rules: rules("Classics")}); err != nil {
+			t.Fatal(err)
+		}
+
+		now := time.Now()
+		list, err := stores.Smart.List(ctx, owner, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, s := range list {
+			got = append(got, fmt.Sprintf("%s %d", s.Name, s.BookCount))
+		}
+		// By name, counting only the owner's books
+		if want := []string{"Austen 1", "SF 2"}; !slices.Equal(got, want) {
+			t.Errorf("List = %q, want %q", got, want)
+		}
+
+		detail, err := stores.Smart.Get(ctx, owner, shelf.ID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(detail.Books) != 2 || detail.Books[0].ID != hyperion.ID || detail.Books[1].ID != dune.ID {
+			t.Errorf("Get returned %+v, want Hyperion then Dune", detail.Books)
+		}
+		if detail.Rules.Match != "all" || len(detail.Rules.Rules) != 1 || detail.Rules.Rules[0].Value != "science fiction" {
+			t.Errorf("stored rules %+v", detail.Rules)
+		}
+		if _, err := stores.Smart.Get(ctx, other, shelf.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get as another user: %v, want ErrNotFound", err)
+		}
+
+		shelf.Name, shelf.Rules = "Classics", rules("Classics")
+		if err := stores.Smart.Update(ctx, owner, &shelf); err != nil {
+			t.Fatal(err)
+		}
+		if detail, err := stores.Smart.Get(ctx, owner, shelf.ID, now); err != nil || detail.BookCount != 1 || detail.Name != "Classics" {
+			t.Errorf("after update got %+v, %v", detail, err)
+		}
+		if err := stores.Smart.Update(ctx, owner, &models.SmartShelf{ID: shelf.ID, Name: "AUSTEN", Rules: rules("x")}); !errors.Is(err, ErrConflict) {
+			t.Errorf("renaming to an existing shelf: %v, want ErrConflict", err)
+		}
+		if err := stores.Smart.Update(ctx, other, &models.SmartShelf{ID: shelf.ID, Name: "Mine", Rules: rules("x")}); !errors.Is(err, ErrNotFound) {
+			t.Errorf("updating another user's shelf: %v, want ErrNotFound", err)
+		}
+
+		if err := stores.Smart.Delete(ctx, other, shelf.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting another user's shelf: %v, want ErrNotFound", err)
+		}
+		if err := stores.Smart.Delete(ctx, owner, shelf.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Smart.Get(ctx, owner, shelf.ID, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get after delete: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Notes", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune"})
+		otherBook := newBook(t, owner, models.Book{Title: "Emma"})
+		session, err := stores.Reading.Start(ctx, owner, book.ID, day(2024, time.March, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherSession, err := stores.Reading.Start(ctx, owner, otherBook.ID, day(2024, time.March, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		at := day(2024, time.March, 2)
+
+		create := func(t *testing.T, note models.Note, at time.Time) models.Note {
+			t.Helper()
+			if err := stores.Notes.Create(ctx, owner, &note, at); err != nil {
+				t.Fatal(err)
+			}
+			return note
+		}
+		late := create(t, models.Note{BookID: book.ID, Type: "quote", Page: intPtr(90), Body: "Fear is the mind-killer."}, at)
+		unplaced := create(t, models.Note{BookID: book.ID, Type: "note", Body: "Reread the appendix."}, at)
+		early := create(t, models.Note{BookID: book.ID, SessionID: &session.ID, Type: "highlight", Page: intPtr(12), Location: intPtr(300), Body: "spice"}, at.Add(time.Hour))
+		earlier := create(t, models.Note{BookID: book.ID, Type: "note", Page: intPtr(12), Location: intPtr(200), Body: "Arrakis"}, at.Add(2*time.Hour))
+		located := create(t, models.Note{BookID: book.ID, Type: "note", Location: intPtr(50), Body: "Fremen"}, at)
+		if late.ID == 0 || !late.CreatedAt.Equal(at) || !late.UpdatedAt.Equal(at) {
+			t.Errorf("created %+v", late)
+		}
+
+		list, err := stores.Notes.ListForBook(ctx, owner, book.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []int{earlier.ID, early.ID, late.ID, located.ID, unplaced.ID}
+		var got []int
+		for _, n := range list {
+			got = append(got, n.ID)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("listed notes %v, want %v", got, want)
+		}
+		if list, _ := stores.Notes.ListForBook(ctx, other, book.ID); len(list) != 0 {
+			t.Errorf("another user lists %d notes on the book", len(list))
+		}
+
+		note, err := stores.Notes.Get(ctx, owner, early.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if note.SessionID == nil || *note.SessionID != session.ID || *note.Page != 12 || *note.Location != 300 || note.Body != "spice" || note.Type != "highlight" {
+			t.Errorf("got %+v", note)
+		}
+		if _, err := stores.Notes.Get(ctx, other, early.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get as another user: %v, want ErrNotFound", err)
+		}
+
+		bad := []struct {
+			name   string
+			userID int
+			note   models.Note
+		}{
+			{"another user's book", other, models.Note{BookID: book.ID, Body: "mine"}},
+			{"missing book", owner, models.Note{BookID: book.ID + 1000, Body: "lost"}},
+			{"another book's session", owner, models.Note{BookID: book.ID, SessionID: &otherSession.ID, Body: "mixed up"}},
+		}
+		for _, tt := range bad {
+			if err := stores.Notes.Create(ctx, tt.userID, &tt.note, at); !errors.Is(err, ErrNotFound) {
+				t.Errorf("create on %s: %v, want ErrNotFound", tt.name, err)
+			}
+		}
+
+		updated := day(2024, time.April, 1)
+		update := models.Note{ID: early.ID, Type: "quote", Body: "The spice must flow."}
+		if err := stores.Notes.Update(ctx, owner, &update, updated); err != nil {
+			t.Fatal(err)
+		}
+		if update.BookID != book.ID || !update.CreatedAt.Equal(early.CreatedAt) || !update.UpdatedAt.Equal(updated) {
+			t.Errorf("after update got %+v", update)
+		}
+		if got, _ := stores.Notes.Get(ctx, owner, early.ID); got.SessionID != nil || got.Page != nil || got.Location != nil || got.Body != "The spice must flow." {
+			t.Errorf("after update stored %+v", got)
+		}
+		moved := models.Note{ID: early.ID, SessionID: &otherSession.ID, Type: "note", Body: "moved"}
+		if err := stores.Notes.Update(ctx, owner, &moved, updated); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update onto another book's session: %v, want ErrNotFound", err)
+		}
+		if err := stores.Notes.Update(ctx, other, &models.Note{ID: early.ID, Type: "note", Body: "taken"}, updated); !errors.Is(err, ErrNotFound) {
+			t.Errorf("update as another user: %v, want ErrNotFound", err)
+		}
+
+		if err := stores.Notes.Delete(ctx, other, early.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("delete as another user: %v, want ErrNotFound", err)
+		}
+		if err := stores.Notes.Delete(ctx, owner, early.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Notes.Get(ctx, owner, early.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get after delete: %v, want ErrNotFound", err)
+		}
+
+		key := "dune-loc-50"
+		imported := []*models.Note{
+			{BookID: otherBook.ID, Type: "highlight", Body: "Emma Woodhouse", ImportKey: &key, CreatedAt: day(2023, time.May, 1)},
+		}
+		if err := stores.Notes.Import(ctx, owner, imported, at); err != nil {
+			t.Fatal(err)
+		}
+		if imported[0].ID == 0 || !imported[0].CreatedAt.Equal(day(2023, time.May, 1)) {
+			t.Errorf("imported %+v", imported[0])
+		}
+		again := []*models.Note{
+			{BookID: otherBook.ID, Type: "highlight", Body: "Emma Woodhouse", ImportKey: &key},
+			{BookID: otherBook.ID, Type: "note", Body: "handsome, clever, and rich"},
+		}
+		if err := stores.Notes.Import(ctx, owner, again, at); err != nil {
+			t.Fatal(err)
+		}
+		if again[0].ID != 0 || again[1].ID == 0 {
+			t.Errorf("re-import set IDs %d and %d, want only the new note's", again[0].ID, again[1].ID)
+		}
+		if keys, err := stores.Notes.ImportKeys(ctx, owner); err != nil || len(keys) != 1 || !keys[key] {
+			t.Errorf("ImportKeys = %v, %v", keys, err)
+		}
+		failing := []*models.Note{
+			{BookID: otherBook.ID, Type: "note", Body: "kept?"},
+			{BookID: book.ID, SessionID: &otherSession.ID, Type: "note", Body: "mixed up"},
+		}
+		if err := stores.Notes.Import(ctx, owner, failing, at); !errors.Is(err, ErrNotFound) {
+			t.Errorf("import with a bad session: %v, want ErrNotFound", err)
+		}
+		if list, _ := stores.Notes.ListForBook(ctx, owner, otherBook.ID); len(list) != 2 {
+			t.Errorf("after a failed import the book has %d notes, want 2", len(list))
+		}
+	})
+
+	t.Run("NoteSearch", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{Title: "Dune"})
+		emma := newBook(t, owner, models.Book{Title: "Emma"})
+		at := day(2024, time.March, 1)
+		create := func(t *testing.T, userID int, note models.Note) models.Note {
+			t.Helper()
+			if err := stores.Notes.Create(ctx, userID, &note, at); err != nil {
+				t.Fatal(err)
+			}
+			return note
+		}
+		passing := create(t, owner, models.Note{BookID: dune.ID, Type: "note", Body: "The desert planet, and a long aside about the politics of the great houses and the guild"})
+		desert := create(t, owner, models.Note{BookID: dune.ID, Type: "quote", Body: "Desert power. The deserts of Arrakis."})
+		emmaNote := create(t, owner, models.Note{BookID: emma.ID, Type: "note", Body: "No deserts in Highbury, only desertion of good sense"})
+		edited := create(t, owner, models.Note{BookID: emma.ID, Type: "note", Body: "Mr. Knightley"})
+		otherBook := newBook(t, other, models.Book{Title: "Dune"})
+		create(t, other, models.Note{BookID: otherBook.ID, Type: "note", Body: "desert"})
+
+		search := func(t *testing.T, q NoteQuery) ([]int, []models.NoteMatch) {
+			t.Helper()
+			matches, err := stores.Notes.Search(ctx, owner, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, m := range matches {
+				ids = append(ids, m.ID)
+			}
+			return ids, matches
+		}
+
+		// The note repeating the term ranks above the one mentioning it once
+		got, matches := search(t, NoteQuery{Search: "DESERT"})
+		if len(got) != 3 || got[0] == passing.ID || !slices.Contains(got, desert.ID) || !slices.Contains(got, emmaNote.ID) {
+			t.Errorf("search got %v, want %d ranked above %d", got, desert.ID, passing.ID)
+		}
+		for _, m := range matches {
+			if !strings.Contains(m.Snippet, "<mark>") {
+				t.Errorf("snippet for note %d is %q, want a marked match", m.ID, m.Snippet)
+			}
+			if want := map[int]string{dune.ID: "Dune", emma.ID: "Emma"}[m.BookID]; m.BookTitle != want {
+				t.Errorf("note %d is on %q, want %q", m.ID, m.BookTitle, want)
+			}
+		}
+
+		tests := []struct {
+			name string
+			q    NoteQuery
+			want []int
+		}{
+			{"every term must match", NoteQuery{Search: "desert arrakis"}, []int{desert.ID}},
+			{"by book", NoteQuery{Search: "desert", BookID: emma.ID}, []int{emmaNote.ID}},
+			{"by type", NoteQuery{Search: "desert", Type: "quote"}, []int{desert.ID}},
+			{"no match", NoteQuery{Search: "sandworm"}, nil},
+			{"no words", NoteQuery{Search: "--"}, nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if got, _ := search(t, tt.q); !slices.Equal(got, tt.want) {
+					t.Errorf("got notes %v, want %v", got, tt.want)
+				}
+			})
+		}
+		if got, _ := search(t, NoteQuery{Search: "desert", Limit: 2}); len(got) != 2 || got[0] != desert.ID {
+			t.Errorf("limited search got %v, want 2 notes starting with %d", got, desert.ID)
+		}
+
+		markup := create(t, owner, models.Note{BookID: dune.ID, Type: "note", Body: `<img src=x onerror="alert(1)"> sandstorm & thunder`})
+		if _, matches := search(t, NoteQuery{Search: "sandstorm"}); len(matches) != 1 || matches[0].ID != markup.ID {
+			t.Errorf("markup search got %+v", matches)
+		} else if snippet := matches[0].Snippet; strings.Contains(snippet, "<img") || !strings.Contains(snippet, "&lt;img") || !strings.Contains(snippet, "<mark>sandstorm</mark>") {
+			t.Errorf("snippet with markup is %q", snippet)
+		}
+
+		// The index follows edits and deletes
+		update := models.Note{ID: edited.ID, Type: "note", Body: "Mr. Knightley crosses no desert"}
+		if err := stores.Notes.Update(ctx, owner, &update, at); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := search(t, NoteQuery{Search: "knightley desert"}); !slices.Equal(got, []int{edited.ID}) {
+			t.Errorf("after an edit got %v, want %v", got, []int{edited.ID})
+		}
+		if got, _ := search(t, NoteQuery{Search: "highbury"}); !slices.Equal(got, []int{emmaNote.ID}) {
+			t.Errorf("before the delete got %v, want %v", got, []int{emmaNote.ID})
+		}
+		if err := stores.Notes.Delete(ctx, owner, emmaNote.ID); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := search(t, NoteQuery{Search: "highbury"}); len(got) != 0 {
+			t.Errorf("after the delete got %v", got)
+		}
+	})
+
+	t.Run("ISBNCache", func(t *testing.T) {
+		// The cache is shared by every user, so entries are dated long ago
+		// and searched for by an ISBN prefix of their own
+		const prefix = "97810000000"
+		entry := func(n int, title string, cachedAt time.Time, pinned bool) *models.IsbnCache {
+			return &models.IsbnCache{
+				ISBN: fmt.Sprintf("%s%02d", prefix, n), Title: title, Author: "Frank Herbert",
+				Genre: "Science Fiction", Genres: []string{"Science Fiction", "Classics"}, PageCount: 412,
+				CachedAt: timePtr(cachedAt), Pinned: pinned,
+			}
+		}
+		entries := []*models.IsbnCache{
+			entry(1, "Dune", day(2001, time.March, 1), false),
+			entry(2, "Dune Messiah", day(2001, time.January, 1), false),
+			entry(3, "Children of Dune", day(2001, time.February, 1), true),
+			entry(4, "God Emperor of Dune", day(2001, time.February, 1), false),
+			entry(5, "Heretics of Dune", day(2003, time.January, 1), false),
+		}
+		for _, e := range entries {
+			if err := stores.Cache.Save(ctx, e); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := stores.Cache.Get(ctx, prefix+"03")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Title != "Children of Dune" || !got.Pinned || !got.CachedAt.Equal(day(2001, time.February, 1)) ||
+			!slices.Equal(got.Genres, []string{"Science Fiction", "Classics"}) || got.PageCount != 412 {
+			t.Errorf("got %+v", got)
+		}
+		if _, err := stores.Cache.Get(ctx, prefix+"99"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("get of a missing entry: %v, want ErrNotFound", err)
+		}
+
+		// Put keeps an existing entry and Save replaces it, pin included
+		if err := stores.Cache.Put(ctx, &models.IsbnCache{ISBN: prefix + "03", Title: "Replaced"}); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := stores.Cache.Get(ctx, prefix+"03"); got.Title != "Children of Dune" {
+			t.Errorf("Put replaced the entry with %+v", got)
+		}
+		unpinned := entry(3, "Children of Dune (corrected)", day(2001, time.February, 1), false)
+		if err := stores.Cache.Save(ctx, unpinned); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := stores.Cache.Get(ctx, prefix+"03"); got.Title != "Children of Dune (corrected)" || got.Pinned {
+			t.Errorf("after Save got %+v", got)
+		}
+		entries[2].Pinned = true
+		if err := stores.Cache.Save(ctx, entries[2]); err != nil {
+			t.Fatal(err)
+		}
+
+		isbns := func(list []models.IsbnCache) []string {
+			var out []string
+			for _, e := range list {
+				out = append(out, strings.TrimPrefix(e.ISBN, prefix))
+			}
+			return out
+		}
+		tests := []struct {
+			name  string
+			q     ISBNCacheQuery
+			want  []string
+			total int
+		}{
+			{"by ISBN", ISBNCacheQuery{Search: prefix}, []string{"01", "02", "03", "04", "05"}, 5},
+			{"by title", ISBNCacheQuery{Search: "MESSIAH"}, []string{"02"}, 1},
+			{"page", ISBNCacheQuery{Search: prefix, Limit: 2, Offset: 2}, []string{"03", "04"}, 5},
+			{"past the end", ISBNCacheQuery{Search: prefix, Limit: 2, Offset: 10}, nil, 5},
+			// Oldest first, ties by ISBN, without the pinned entry
+			{"expired", ISBNCacheQuery{Search: prefix, ExpiredBefore: day(2002, time.January, 1)}, []string{"02", "04", "01"}, 3},
+			{"expired batch", ISBNCacheQuery{Search: prefix, ExpiredBefore: day(2002, time.January, 1), Limit: 2}, []string{"02", "04"}, 3},
+			{"expired before any", ISBNCacheQuery{Search: prefix, ExpiredBefore: day(2000, time.January, 1)}, nil, 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				list, total, err := stores.Cache.List(ctx, tt.q)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := isbns(list); !slices.Equal(got, tt.want) || total != tt.total {
+					t.Errorf("got %v of %d, want %v of %d", got, total, tt.want, tt.total)
+				}
+			})
+		}
+
+		purged, err := stores.Cache.Purge(ctx, day(2002, time.January, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 3 {
+			t.Errorf("purged %d entries, want 3", purged)
+		}
+		list, _, err := stores.Cache.List(ctx, ISBNCacheQuery{Search: prefix})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isbns(list); !slices.Equal(got, []string{"03", "05"}) {
+			t.Errorf("after purging got %v, want the pinned and the recent entry", got)
+		}
+
+		if err := stores.Cache.Delete(ctx, prefix+"03"); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Cache.Delete(ctx, prefix+"03"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting twice: %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Reminders", func(t *testing.T) {
+		// Lendings due in 1990, so no other test's are due in the windows
+		// below; their owners are matched anyway
+		owner, quiet, muted := newUser(t), newUser(t), newUser(t)
+		settings := []models.UserSettings{
+			{UserID: quiet, EmailRemindersEnabled: true, EmailUpcomingReminders: false, EmailOverdueReminders: true},
+			{UserID: muted, EmailRemindersEnabled: false, EmailUpcomingReminders: true, EmailOverdueReminders: true},
+		}
+		for i := range settings {
+			if err := stores.Settings.CreateUserSettings(ctx, &settings[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		lend := func(t *testing.T, userID int, title string, due *time.Time) int {
+			t.Helper()
+			book := newBook(t, userID, models.Book{Title: title, Author: "Frank Herbert"})
+			lending := &models.Lending{BookID: book.ID, UserID: userID, LentTo: "Anne", DueDate: due}
+			if err := stores.Lending.Create(ctx, lending); err != nil {
+				t.Fatal(err)
+			}
+			return lending.ID
+		}
+		overdue := lend(t, owner, "Overdue", timePtr(day(1990, time.May, 1)))
+		upcoming := lend(t, owner, "Upcoming", timePtr(day(1990, time.June, 10)))
+		returned := lend(t, owner, "Returned", timePtr(day(1990, time.April, 1)))
+		recent := lend(t, owner, "Reminded recently", timePtr(day(1990, time.April, 15)))
+		earlier := lend(t, owner, "Reminded earlier", timePtr(day(1990, time.March, 1)))
+		lend(t, owner, "No due date", nil)
+		quietOverdue := lend(t, quiet, "Quiet overdue", timePtr(day(1990, time.February, 1)))
+		lend(t, quiet, "Quiet upcoming", timePtr(day(1990, time.June, 12)))
+		lend(t, muted, "Muted overdue", timePtr(day(1990, time.February, 1)))
+		lend(t, muted, "Muted upcoming", timePtr(day(1990, time.June, 12)))
+
+		if err := stores.Lending.MarkReturned(ctx, returned, day(1990, time.April, 2)); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Lending.MarkReminderSent(ctx, recent, day(1990, time.May, 30)); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Lending.MarkReminderSent(ctx, earlier, day(1990, time.May, 1)); err != nil {
+			t.Fatal(err)
+		}
+
+		ids := func(list []models.ReminderLending) []int {
+			var got []int
+			for _, l := range list {
+				if l.UserID == owner || l.UserID == quiet || l.UserID == muted {
+					got = append(got, l.LendingID)
+				}
+			}
+			return got
+		}
+		remindedBefore := day(1990, time.May, 25)
+		list, err := stores.Lending.ListOverdueReminders(ctx, day(1990, time.June, 1), remindedBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// By user, then due date
+		if got, want := ids(list), []int{earlier, overdue, quietOverdue}; !slices.Equal(got, want) {
+			t.Errorf("overdue reminders %v, want %v", got, want)
+		}
+		for _, l := range list {
+			if l.LendingID != earlier {
+				continue
+			}
+			email, _ := stores.Users.Get(ctx, owner)
+			if l.UserEmail != email.Email || l.BookTitle != "Reminded earlier" || l.BookAuthor != "Frank Herbert" || l.LentTo != "Anne" ||
+				!l.DueDate.Equal(day(1990, time.March, 1)) || l.LastReminderSent == nil || !l.LastReminderSent.Equal(day(1990, time.May, 1)) {
+				t.Errorf("reminder %+v", l)
+			}
+		}
+
+		list, err = stores.Lending.ListUpcomingReminders(ctx, day(1990, time.June, 5), day(1990, time.June, 15), remindedBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(list), []int{upcoming}; !slices.Equal(got, want) {
+			t.Errorf("upcoming reminders %v, want %v", got, want)
+		}
+		// The window leaves its end out
+		list, err = stores.Lending.ListUpcomingReminders(ctx, day(1990, time.June, 5), day(1990, time.June, 10), remindedBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ids(list); len(got) != 0 {
+			t.Errorf("upcoming reminders before the due date %v", got)
+		}
+
+		if err := stores.Lending.MarkReminderSent(ctx, overdue, day(1990, time.May, 30)); err != nil {
+			t.Fatal(err)
+		}
+		list, err = stores.Lending.ListOverdueReminders(ctx, day(1990, time.June, 1), remindedBefore)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := ids(list), []int{earlier, quietOverdue}; !slices.Equal(got, want) {
+			t.Errorf("overdue reminders after one was sent %v, want %v", got, want)
+		}
+	})
+
+	t.Run("UserStats", func(t *testing.T) {
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{Title: "Dune"})
+		emma := newBook(t, owner, models.Book{Title: "Emma"})
+		newBook(t, owner, models.Book{Title: "Hyperion", Read: true})
+		newBook(t, other, models.Book{Title: "Dune", Read: true})
+
+		now := time.Now().UTC()
+		yearStart := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		session := &models.ReadingHistory{BookID: dune.ID, StartedAt: yearStart.AddDate(0, 0, -3), CompletedAt: &yearStart}
+		if _, err := stores.Reading.LogSession(ctx, owner, session, now); err != nil {
+			t.Fatal(err)
+		}
+		// Finished last year
+		session = &models.ReadingHistory{BookID: emma.ID, StartedAt: yearStart.AddDate(0, 0, -20), CompletedAt: timePtr(yearStart.AddDate(0, 0, -10))}
+		if _, err := stores.Reading.LogSession(ctx, owner, session, now); err != nil {
+			t.Fatal(err)
+		}
+		for _, bookID := range []int{dune.ID, dune.ID, emma.ID} {
+			lending := &models.Lending{BookID: bookID, UserID: owner, LentTo: "Anne"}
+			if err := stores.Lending.Create(ctx, lending); err != nil {
+				t.Fatal(err)
+			}
+			if err := stores.Lending.MarkReturned(ctx, lending.ID, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := stores.Lending.Create(ctx, &models.Lending{BookID: emma.ID, UserID: owner, LentTo: "Anne"}); err != nil {
+			t.Fatal(err)
+		}
+
+		stats, err := stores.Stats.UserStats(ctx, owner, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int{stats.TotalBooks, stats.BooksRead, stats.BooksLentOut, stats.TotalLendings, stats.BooksThisMonth, stats.BooksThisYear, stats.BooksReadThisYear}
+		if want := []int{3, 3, 1, 4, 3, 3, 1}; !slices.Equal(got, want) {
+			t.Errorf("total, read, lent out, lendings, this month, this year, read this year = %v, want %v", got, want)
+		}
+		if n := len(stats.MonthlyReading); n != 12 {
+			t.Fatalf("%d months of reading, want 12", n)
+		}
+		if last := stats.MonthlyReading[11]; last.Month != now.Format("Jan 2006") || last.Count != 3 {
+			t.Errorf("this month's reading is %+v", last)
+		}
+		var lent []string
+		for _, b := range stats.TopLentBooks {
+			lent = append(lent, fmt.Sprintf("%s %d", b.Title, b.LentCount))
+		}
+		if want := []string{"Emma 2", "Dune 2"}; len(lent) != 2 || !slices.Contains(lent, want[0]) || !slices.Contains(lent, want[1]) {
+			t.Errorf("top lent books %q, want %q", lent, want)
+		}
+
+		stats, err = stores.Stats.UserStats(ctx, newUser(t), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.TotalBooks != 0 || stats.BooksRead != 0 || len(stats.GenreBreakdown) != 0 || len(stats.TopLentBooks) != 0 || stats.AverageRating != 0 {
+			t.Errorf("stats of a user without books %+v", stats)
+		}
+	})
+
+	t.Run("Ratings", func(t *testing.T) {
+		// Authors are shared between users, so the other user's copy of a
+		// book shares its author
+		owner, other := newUser(t), newUser(t)
+		dune := newBook(t, owner, models.Book{Title: "Dune", Author: "Ottoline Rater"})
+		sequel := newBook(t, owner, models.Book{Title: "Dune Messiah", Author: "Ottoline Rater & Percival Rater"})
+		emma := newBook(t, owner, models.Book{Title: "Emma", Author: "Henrietta Rater"})
+		newBook(t, owner, models.Book{Title: "Unread", Author: "Henrietta Rater"})
+		theirs := newBook(t, other, models.Book{Title: "Dune", Author: "Ottoline Rater"})
+
+		at := day(2024, time.March, 1)
+		start := at
+		review := func(t *testing.T, userID, bookID int, rating *float64) {
+			t.Helper()
+			// One session a day, so that rereads don't overlap
+			start = start.AddDate(0, 0, 1)
+			session := &models.ReadingHistory{BookID: bookID, StartedAt: start, CompletedAt: timePtr(start.Add(time.Hour))}
+			if _, err := stores.Reading.LogSession(ctx, userID, session, at); err != nil {
+				t.Fatal(err)
+			}
+			if err := stores.Reading.SaveReview(ctx, userID, &models.Review{SessionID: session.ID, Rating: rating, Body: "Notes"}, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		rating := func(r float64) *float64 { return &r }
+		review(t, owner, dune.ID, rating(4))
+		review(t, owner, dune.ID, rating(5))
+		review(t, owner, dune.ID, rating(5))
+		review(t, owner, sequel.ID, rating(3))
+		review(t, owner, emma.ID, rating(2))
+		// A review without a rating counts for nothing
+		review(t, owner, emma.ID, nil)
+		review(t, other, theirs.ID, rating(1))
+
+		stats, err := stores.Stats.UserStats(ctx, owner, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.RatingsGiven != 5 || stats.AverageRating != 3.8 {
+			t.Errorf("%d ratings averaging %v, want 5 averaging 3.8", stats.RatingsGiven, stats.AverageRating)
+		}
+
+		var books []string
+		for _, b := range stats.BookRatings {
+			books = append(books, fmt.Sprintf("%s %v/%d", b.Title, b.Average, b.Ratings))
+		}
+		if want := []string{"Dune 4.67/3", "Dune Messiah 3/1", "Emma 2/1"}; !slices.Equal(books, want) {
+			t.Errorf("book ratings %q, want %q", books, want)
+		}
+		if stats.BookRatings[0].BookID != dune.ID {
+			t.Errorf("top rated book is %d, want %d", stats.BookRatings[0].BookID, dune.ID)
+		}
+
+		var authors []string
+		for _, a := range stats.AuthorRatings {
+			authors = append(authors, fmt.Sprintf("%s %v/%d over %d", a.Name, a.Average, a.Ratings, a.Books))
+		}
+		want := []string{"Ottoline Rater 4.25/4 over 2", "Percival Rater 3/1 over 1", "Henrietta Rater 2/1 over 1"}
+		if !slices.Equal(authors, want) {
+			t.Errorf("author ratings %q, want %q", authors, want)
+		}
+
+		// The other user sees only their own rating of the shared author
+		stats, err = stores.Stats.UserStats(ctx, other, at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.RatingsGiven != 1 || stats.AverageRating != 1 || len(stats.BookRatings) != 1 || stats.BookRatings[0].BookID != theirs.ID {
+			t.Errorf("other user's ratings %+v", stats.BookRatings)
+		}
+		if len(stats.AuthorRatings) != 1 || stats.AuthorRatings[0].Name != "Ottoline Rater" || stats.AuthorRatings[0].Average != 1 || stats.AuthorRatings[0].Books != 1 {
+			t.Errorf("other user's author ratings %+v", stats.AuthorRatings)
+		}
+
+		// A user without reviews has nothing to average
+		stats, err = stores.Stats.UserStats(ctx, newUser(t), at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.RatingsGiven != 0 || stats.AverageRating != 0 || len(stats.BookRatings) != 0 || len(stats.AuthorRatings) != 0 {
+			t.Errorf("ratings of a user without reviews: %d, %v, %+v, %+v", stats.RatingsGiven, stats.AverageRating, stats.BookRatings, stats.AuthorRatings)
+		}
+	})
+
+	t.Run("AdminStats", func(t *testing.T) {
+		// The stats cover every user, so compare against a baseline
+		now := time.Now()
+		before, err := stores.Stats.AdminStats(ctx, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		owner, empty := newUser(t), newUser(t)
+		newBook(t, owner, models.Book{Title: "Dune", Read: true})
+		emma := newBook(t, owner, models.Book{Title: "Emma"})
+		hobbit := newBook(t, owner, models.Book{Title: "The Hobbit"})
+		for _, l := range []*models.Lending{
+			{BookID: emma.ID, UserID: owner, LentTo: "Anne", DueDate: timePtr(day(1990, time.January, 1))},
+			{BookID: hobbit.ID, UserID: owner, LentTo: "Anne", DueDate: timePtr(now.UTC().AddDate(0, 0, 7))},
+		} {
+			if err := stores.Lending.Create(ctx, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		returned := &models.Lending{BookID: emma.ID, UserID: owner, LentTo: "Anne", DueDate: timePtr(day(1990, time.January, 1))}
+		if err := stores.Lending.Create(ctx, returned); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Lending.MarkReturned(ctx, returned.ID, now); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := stores.Stats.AdminStats(ctx, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []int{
+			after.TotalUsers - before.TotalUsers,
+			after.TotalBooks - before.TotalBooks,
+			after.BooksRead - before.BooksRead,
+			after.BooksUnread - before.BooksUnread,
+			after.BooksLentOut - before.BooksLentOut,
+			after.OverdueBooks - before.OverdueBooks,
+		}
+		if want := []int{2, 3, 1, 2, 2, 1}; !slices.Equal(got, want) {
+			t.Errorf("users, books, read, unread, lent out, overdue went up by %v, want %v", got, want)
+		}
+		if after.TotalUsers == 0 || after.TotalBooks == 0 {
+			t.Errorf("counted %d users and %d books", after.TotalUsers, after.TotalBooks)
+		}
+		if n := len(after.RecentUsers); n == 0 || n > 5 {
+			t.Errorf("%d recent users, want 1 to 5", n)
+		}
+		for _, u := range after.RecentUsers {
+			if u.PasswordHash != "" || u.Username == "" {
+				t.Errorf("recent user %+v", u)
+			}
+		}
+		if n := len(after.RecentBooks); n == 0 || n > 10 {
+			t.Errorf("%d recent books, want 1 to 10", n)
+		}
+		for _, b := range after.RecentBooks {
+			if b.Username == "" || b.Title == "" {
+				t.Errorf("recent book %+v", b)
+			}
+		}
+
+		users, err := stores.Users.ListWithStats(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != after.TotalUsers {
+			t.Errorf("listed %d users, want %d", len(users), after.TotalUsers)
+		}
+		counts := make(map[int]int)
+		for i, u := range users {
+			counts[u.ID] = u.BookCount
+			if u.PasswordHash != "" {
+				t.Errorf("listed %s with a password hash", u.Username)
+			}
+			// Newest first
+			if i > 0 && u.CreatedAt.After(users[i-1].CreatedAt) {
+				t.Errorf("%s listed after an older user", u.Username)
+			}
+		}
+		if counts[owner] != 3 || counts[empty] != 0 {
+			t.Errorf("book counts %d and %d, want 3 and 0", counts[owner], counts[empty])
+		}
+		if _, ok := counts[empty]; !ok {
+			t.Error("a user without books isn't listed")
+		}
+	})
+
+	t.Run("ExportRestore", func(t *testing.T) {
+		owner, restorer := newUser(t), newUser(t)
+		book := newBook(t, owner, models.Book{Title: "Dune", Author: "Frank Herbert", Tags: []string{"Desert"}})
+		session := &models.ReadingHistory{BookID: book.ID, StartedAt: day(2020, time.January, 1), CompletedAt: timePtr(day(2020, time.February, 1))}
+		if _, err := stores.Reading.LogSession(ctx, owner, session, day(2025, time.January, 1)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stores.Reading.SetStatus(ctx, owner, book.ID, reading.Reading, day(2024, time.May, 1)); err != nil {
+			t.Fatal(err)
+		}
+		// Saving the review again keeps the first version as an edit
+		for i, rating := range []float64{4, 5} {
+			review := &models.Review{SessionID: session.ID, Rating: &rating, Body: "Spice"}
+			if err := stores.Reading.SaveReview(ctx, owner, review, day(2020, time.February, 2+i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		importKey := "kindle:1"
+		note := models.Note{BookID: book.ID, Type: "quote", Body: "Fear is the mind-killer.", ImportKey: &importKey}
+		if err := stores.Notes.Create(ctx, owner, &note, day(2020, time.January, 2)); err != nil {
+			t.Fatal(err)
+		}
+		shelf := models.Shelf{Name: "Favourites"}
+		if err := stores.Shelves.Create(ctx, owner, &shelf); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Shelves.AddBook(ctx, owner, shelf.ID, book.ID, -1); err != nil {
+			t.Fatal(err)
+		}
+		rules := models.ShelfRules{Rules: []models.ShelfRule{{Field: "genre", Op: "is", Value: "Classics"}}}
+		if err := shelves.ValidateRules(&rules); err != nil {
+			t.Fatal(err)
+		}
+		if err := stores.Smart.Create(ctx, owner, &models.SmartShelf{Name: "Classics", Rules: rules}); err != nil {
+			t.Fatal(err)
+		}
+		settings := &models.UserSettings{UserID: owner, DefaultLendingDays: 21, CreatedAt: day(2020, time.January, 1), UpdatedAt: day(2020, time.January, 1)}
+		if err := stores.Settings.CreateUserSettings(ctx, settings); err != nil {
+			t.Fatal(err)
+		}
+
+		archive := exportAll(t, stores, owner)
+		got := []int{
+			len(archive.Books), len(archive.ReadingHistory), len(archive.StatusChanges), len(archive.Reviews),
+			len(archive.Notes), len(archive.Shelves), len(archive.SmartShelves),
+		}
+		if want := []int{1, 2, 2, 1, 1, 1, 1}; !slices.Equal(got, want) {
+			t.Fatalf("exported books, sessions, status changes, reviews, notes, shelves and smart shelves %v, want %v", got, want)
+		}
+		if b := archive.Books[0]; !slices.Equal(b.Tags, []string{"Desert"}) || len(b.Authors) != 1 {
+			t.Errorf("exported book without its relations: %+v", b)
+		}
+		if r := archive.Reviews[0]; len(r.Edits) != 1 || *r.Rating != 5 || *r.Edits[0].Rating != 4 {
+			t.Errorf("exported review %+v", r)
+		}
+		if !slices.Equal(archive.Shelves[0].BookIDs, []int{book.ID}) || archive.UserSettings == nil || archive.UserSettings.DefaultLendingDays != 21 {
+			t.Errorf("exported shelf %+v and settings %+v", archive.Shelves[0], archive.UserSettings)
+		}
+
+		// A note repeating an import key is skipped, not a conflict
+		duplicate := archive.Notes[0]
+		duplicate.ID++
+		archive.Notes = append(archive.Notes, duplicate)
+
+		result, err := stores.Export.Restore(ctx, restorer, archive, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := models.RestoreResult{
+			BooksCreated: 1, ReadingHistoryCreated: 2, StatusChangesCreated: 2, ReviewsCreated: 1, NotesCreated: 1,
+			ShelvesCreated: 1, SmartShelvesCreated: 1, UserSettingsRestored: true,
+		}
+		if *result != want {
+			t.Errorf("restore wrote %+v, want %+v", *result, want)
+		}
+
+		restored := exportAll(t, stores, restorer)
+		if len(restored.Books) != 1 {
+			t.Fatalf("restored %d books", len(restored.Books))
+		}
+		restoredBook := restored.Books[0]
+		if b := restoredBook; b.Title != "Dune" || b.Status != reading.Reading || !b.Read {
+			t.Errorf("restored book is %s, %s, read %v", b.Title, b.Status, b.Read)
+		}
+		if len(restored.StatusChanges) != 2 {
+			t.Fatalf("restored %d status changes", len(restored.StatusChanges))
+		}
+		for i, c := range restored.StatusChanges {
+			exported := archive.StatusChanges[i]
+			if c.BookID != restoredBook.ID || c.From != exported.From || c.To != exported.To || !c.ChangedAt.Equal(exported.ChangedAt) {
+				t.Errorf("restored status change %+v from %+v", c, exported)
+			}
+		}
+		if len(restored.Reviews) != 1 || len(restored.Reviews[0].Edits) != 1 {
+			t.Errorf("restored reviews %+v", restored.Reviews)
+		}
+		if len(restored.Notes) != 1 || restored.Notes[0].BookID != restoredBook.ID || *restored.Notes[0].ImportKey != "kindle:1" {
+			t.Errorf("restored notes %+v", restored.Notes)
+		}
+		if len(restored.Shelves) != 1 || !slices.Equal(restored.Shelves[0].BookIDs, []int{restoredBook.ID}) {
+			t.Errorf("restored shelves %+v", restored.Shelves)
+		}
+
+		again, err := stores.Export.Restore(ctx, restorer, archive, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *again != (models.RestoreResult{BooksSkipped: 1, UserSettingsRestored: true}) {
+			t.Errorf("restoring again wrote %+v", *again)
+		}
+	})
+}
+
+// exportAll reads the user's whole export into memory, reading the books
+// twice as archive.WriteZip does.
+func exportAll(t *testing.T, stores *Stores, userID int) *models.Export {
+	t.Helper()
+	e := &models.Export{Version: models.ExportVersion}
+	err := stores.Export.Export(context.Background(), userID, func(r ExportReader) error {
+		books := 0
+		err := errors.Join(
+			r.Books(collect(&e.Books)),
+			r.Books(func(models.Book) error { books++; return nil }),
+			r.Lending(collect(&e.Lending)),
+			r.ReadingHistory(collect(&e.ReadingHistory)),
+			r.StatusChanges(collect(&e.StatusChanges)),
+			r.ReadingProgress(collect(&e.ReadingProgress)),
+			r.Reviews(collect(&e.Reviews)),
+			r.Notes(collect(&e.Notes)),
+			r.Shelves(collect(&e.Shelves)),
+			r.SmartShelves(collect(&e.SmartShelves)),
+		)
+		if books != len(e.Books) {
+			t.Errorf("read %d books the second time, want %d", books, len(e.Books))
+		}
+		if err != nil {
+			return err
+		}
+		e.UserSettings, err = r.UserSettings()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// collect returns a function appending records to list.
+func collect[T any](list *[]T) func(T) error {
+	return func(record T) error {
+		*list = append(*list, record)
+		return nil
+	}
+}
+
+// testSQLStores runs testStores along with the checks that rely on the
+// database's constraints and transactions.
+func testSQLStores(t *testing.T, stores *Stores) {
+	testStores(t, stores)
+
+	t.Run("FinishRollsBack", func(t *testing.T) {
+		ctx := context.Background()
+		owner := createUser(t, stores)
+		book := models.Book{Title: "Dune"}
+		if err := stores.Books.Create(ctx, owner, &book); err != nil {
+			t.Fatal(err)
+		}
+		session, err := stores.Reading.Start(ctx, owner, book.ID, day(2024, time.March, 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The reviews table rejects the rating, so nothing is kept
+		rating := 7.0
+		if _, err := stores.Reading.Finish(ctx, session.ID, &models.Review{Rating: &rating}, day(2024, time.March, 2)); err == nil {
+			t.Fatal("finishing with an out of range rating succeeded")
+		}
+		if got, err := stores.Reading.Get(ctx, session.ID); err != nil || got.CompletedAt != nil {
+			t.Errorf("session after the failed finish: %+v, %v", got, err)
+		}
+		if got, err := stores.Books.Get(ctx, owner, book.ID); err != nil || got.Status != reading.Reading || got.Read {
+			t.Errorf("book after the failed finish: %+v, %v", got, err)
+		}
+		if changes, _ := stores.Reading.StatusChanges(ctx, owner, book.ID); len(changes) != 1 {
+			t.Errorf("got %d status changes, want 1", len(changes))
+		}
+	})
+}
+
+// testMigrations migrates the database all the way up, down and up again,
+// checking that each step applies or reverts every migration, and leaves it
+// migrated down once the test is done.
+func testMigrations(t *testing.T, db *sql.DB, d dialect.Dialect) {
+	t.Helper()
+	all := len(migrations.All(d))
+	if _, err := migrations.Up(db, d); err != nil {
+		t.Fatalf("migrating up: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := migrations.Down(db, d, all); err != nil {
+			t.Errorf("migrating down after the test: %v", err)
+		}
+	})
+
+	reverted, err := migrations.Down(db, d, all)
+	if err != nil {
+		t.Fatalf("migrating down: %v", err)
+	}
+	if reverted != all {
+		t.Fatalf("reverted %d migrations, want %d", reverted, all)
+	}
+	var tables int
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')"
+	if d == dialect.Postgres {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'"
+	}
+	if err := db.QueryRow(query).Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("%d tables are left after migrating down", tables)
+	}
+
+	applied, err := migrations.Up(db, d)
+	if err != nil {
+		t.Fatalf("migrating up again: %v", err)
+	}
+	if applied != all {
+		t.Fatalf("applied %d migrations, want %d", applied, all)
+	}
+}
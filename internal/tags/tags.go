@@ -0,0 +1,109 @@
+// Package tags normalizes the labels attached to books: the genres they
+// are filed under and the free-form tags users give them.
+package tags
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"booklib/internal/models"
+)
+
+// MaxLength caps the length of a tag name in characters.
+const MaxLength = 50
+
+// ErrInvalidName is returned for a tag name that is empty or longer than
+// MaxLength.
+var ErrInvalidName = errors.New("invalid tag name")
+
+// Clean trims a label and collapses its inner whitespace.
+func Clean(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// Key returns the form labels are matched by, so "Book Club" and
+// "book  club" are the same tag.
+func Key(name string) string {
+	return strings.ToLower(Clean(name))
+}
+
+// Validate cleans a tag name and checks its length.
+func Validate(name string) (string, error) {
+	name = Clean(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// Dedupe cleans labels, dropping empty ones and repeats of an earlier
+// label. It keeps nil as nil, which book updates read as "unchanged".
+func Dedupe(names []string) []string {
+	if names == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(names))
+	labels := []string{}
+	for _, name := range names {
+		name = Clean(name)
+		if name == "" || seen[Key(name)] {
+			continue
+		}
+		seen[Key(name)] = true
+		labels = append(labels, name)
+	}
+	return labels
+}
+
+// Normalize cleans the book's genres and tags. Given genres make the first
+// of them the book's genre. A book without genres gets nil genres, for
+// ResolveGenres to settle once the stored genres are known.
+func Normalize(book *models.Book) error {
+	book.Genre = Clean(book.Genre)
+	book.Genres = Dedupe(book.Genres)
+	if len(book.Genres) > 0 {
+		book.Genre = book.Genres[0]
+	} else {
+		book.Genres = nil
+	}
+	book.Tags = Dedupe(book.Tags)
+	for _, tag := range book.Tags {
+		if _, err := Validate(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResolveGenres sets the genres of a book saved without any. It keeps the
+// current genres while Genre is still the first of them, so clients that
+// only know about Genre don't drop the rest, and otherwise files the book
+// under Genre alone.
+func ResolveGenres(book *models.Book, current []string) {
+	if book.Genres != nil {
+		return
+	}
+	switch {
+	case len(current) > 0 && Key(current[0]) == Key(book.Genre):
+		book.Genres = append([]string(nil), current...)
+		book.Genre = current[0]
+	case book.Genre != "":
+		book.Genres = []string{book.Genre}
+	default:
+		book.Genres = []string{}
+	}
+}
+
+// NormalizeMetadata makes a metadata entry's genre the first of its
+// genres, or its only genre if it lists none.
+func NormalizeMetadata(meta *models.IsbnCache) {
+	meta.Genre = Clean(meta.Genre)
+	meta.Genres = Dedupe(meta.Genres)
+	switch {
+	case len(meta.Genres) > 0:
+		meta.Genre = meta.Genres[0]
+	case meta.Genre != "":
+		meta.Genres = []string{meta.Genre}
+	}
+}
@@ -0,0 +1,73 @@
+package tags
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"booklib/internal/models"
+)
+
+func TestResolveGenres(t *testing.T) {
+	tests := []struct {
+		name      string
+		book      models.Book
+		current   []string
+		wantGenre string
+		want      []string
+	}{
+		{"genres given", models.Book{Genre: "Epic", Genres: []string{"Epic"}}, []string{"Classics"}, "Epic", []string{"Epic"}},
+		{"empty genres given", models.Book{Genres: []string{}}, []string{"Classics"}, "", []string{}},
+		{"same main genre", models.Book{Genre: "science  FICTION"}, []string{"Science Fiction", "Classics"}, "Science Fiction", []string{"Science Fiction", "Classics"}},
+		{"main genre changed", models.Book{Genre: "Classics"}, []string{"Science Fiction", "Classics"}, "Classics", []string{"Classics"}},
+		{"new book", models.Book{Genre: "Romance"}, nil, "Romance", []string{"Romance"}},
+		{"no genre", models.Book{}, []string{"Classics"}, "", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := tt.book
+			ResolveGenres(&book, tt.current)
+			if book.Genre != tt.wantGenre || !slices.Equal(book.Genres, tt.want) || book.Genres == nil {
+				t.Errorf("got %q, %q; want %q, %q", book.Genre, book.Genres, tt.wantGenre, tt.want)
+			}
+		})
+	}
+
+	// The current genres are copied, not shared
+	current := []string{"Science Fiction", "Classics"}
+	book := models.Book{Genre: "Science Fiction"}
+	ResolveGenres(&book, current)
+	book.Genres[1] = "Changed"
+	if current[1] != "Classics" {
+		t.Error("ResolveGenres shares the current genres")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	book := models.Book{
+		Genre:  "ignored",
+		Genres: []string{" Science  Fiction ", "science fiction", "", "Classics"},
+		Tags:   []string{"Book Club", "book club ", "  "},
+	}
+	if err := Normalize(&book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Genre != "Science Fiction" || !slices.Equal(book.Genres, []string{"Science Fiction", "Classics"}) || !slices.Equal(book.Tags, []string{"Book Club"}) {
+		t.Errorf("got %+v", book)
+	}
+
+	// Without genres, ResolveGenres decides
+	book = models.Book{Genre: " Romance ", Genres: []string{" "}}
+	if err := Normalize(&book); err != nil {
+		t.Fatal(err)
+	}
+	if book.Genre != "Romance" || book.Genres != nil {
+		t.Errorf("got %q, %q; want Romance, nil", book.Genre, book.Genres)
+	}
+
+	book = models.Book{Tags: []string{strings.Repeat("é", MaxLength+1)}}
+	if err := Normalize(&book); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("long tag: %v, want ErrInvalidName", err)
+	}
+}